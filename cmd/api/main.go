@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 	"volaticus-go/internal/config"
@@ -43,6 +44,13 @@ func main() {
 		logger.Init("development") // Fallback to Debug Level
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrateCommand(os.Args[2:]); err != nil {
+			log.Fatal().Err(err).Msg("Migration command failed")
+		}
+		return
+	}
+
 	log.Info().
 		Str("environment", env).
 		Str("log_level", zerolog.GlobalLevel().String()).
@@ -130,6 +138,11 @@ func main() {
 			log.Error().Err(err).Msg("HTTP server shutdown error")
 		}
 
+		// Write buffered click analytics before the database is closed
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Error().Err(err).Msg("Server shutdown error")
+		}
+
 		// Cancel the main context
 		cancel()
 	}()
@@ -148,6 +161,53 @@ func main() {
 	log.Info().Msg("Server shutdown completed")
 }
 
+// runMigrateCommand handles "migrate up|down [steps]|status" without starting the server
+func runMigrateCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: volaticus migrate up|down [steps]|status")
+	}
+
+	db, err := database.NewFromEnv()
+	if err != nil {
+		return fmt.Errorf("initializing database: %w", err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Error().Err(err).Msg("Error closing database connection")
+		}
+	}()
+
+	switch args[0] {
+	case "up":
+		return migrate.RunMigrations(db.DB)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid number of steps: %s", args[1])
+			}
+		}
+		return migrate.StepDown(db.DB, steps)
+	case "status":
+		status, err := migrate.GetStatus(db.DB)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Current version: %d (dirty: %t)\n", status.Version, status.Dirty)
+		for _, m := range status.Migrations {
+			state := "pending"
+			if m.Applied {
+				state = "applied"
+			}
+			fmt.Printf("  %06d %-8s %s\n", m.Version, state, m.Identifier)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command: %s", args[0])
+	}
+}
+
 func formatVersionInfo() string {
 	return fmt.Sprintf(`Version: %s
 Commit: %s
@@ -0,0 +1,21 @@
+package web
+
+import "strings"
+
+// basePath is the path prefix the app is served under, empty when served from the root
+var basePath string
+
+// SetBasePath sets the path prefix used by Path, it is called once on startup
+func SetBasePath(path string) {
+	basePath = strings.TrimSuffix(path, "/")
+}
+
+// BasePath returns the path prefix the app is served under
+func BasePath() string {
+	return basePath
+}
+
+// Path prefixes an absolute app path like "/files/list" with the base path
+func Path(path string) string {
+	return basePath + path
+}
@@ -0,0 +1,25 @@
+package pages
+
+import "fmt"
+
+// APIEndpointDoc describes an API route on the API docs page
+type APIEndpointDoc struct {
+	Method  string
+	Path    string
+	Summary string // Empty for routes that are not documented yet
+	Params  []APIParamDoc
+	Curl    string // Example command, the API token is a placeholder
+}
+
+// APIParamDoc is a query, header or form parameter of an API route
+type APIParamDoc struct {
+	Name        string
+	In          string
+	Description string
+	Required    bool
+}
+
+// curlID is the element ID of the curl command of the i-th endpoint
+func curlID(i int) string {
+	return fmt.Sprintf("curl-%d", i)
+}
@@ -0,0 +1,19 @@
+package pages
+
+// Meta holds the page title and the Open Graph and Twitter card tags of a page
+type Meta struct {
+	PageTitle   string // Title of the browser tab
+	Title       string // Title of link previews
+	Description string
+	Type        string // Open Graph type, e.g. website or article
+	URL         string // Canonical absolute URL, omitted if empty
+	Image       string // Absolute URL of the preview image, omitted if empty
+}
+
+// DefaultMeta describes the app itself, used by every page without its own tags
+var DefaultMeta = Meta{
+	PageTitle:   "Volaticus",
+	Title:       "Volaticus - File Sharing & URL Shortening",
+	Description: "Securely upload files, create custom short URLs, and track engagement with comprehensive analytics. Features include custom URLs, QR code generation, and expiring links.",
+	Type:        "website",
+}
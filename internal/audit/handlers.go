@@ -0,0 +1,101 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+	"volaticus-go/internal/common/apierror"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+type Handler struct {
+	logger *Logger
+}
+
+func NewHandler(logger *Logger) *Handler {
+	return &Handler{
+		logger: logger,
+	}
+}
+
+// ListResponse is a page of the audit log
+type ListResponse struct {
+	Entries    []*Entry `json:"entries"`
+	Page       int      `json:"page"`
+	Limit      int      `json:"limit"`
+	Total      int      `json:"total"`
+	TotalPages int      `json:"total_pages"`
+}
+
+// HandleList returns the audit log as JSON, newest entries first. It is filtered by the action,
+// actor (user ID or username), target_type, target_id and result query parameters and the since
+// and until RFC 3339 timestamps, paged by page and limit.
+func (h *Handler) HandleList(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := Filter{
+		Action:     query.Get("action"),
+		TargetType: query.Get("target_type"),
+		TargetID:   query.Get("target_id"),
+		Result:     query.Get("result"),
+	}
+	if actor := query.Get("actor"); actor != "" {
+		if id, err := uuid.Parse(actor); err == nil {
+			filter.ActorID = &id
+		} else {
+			filter.ActorName = actor
+		}
+	}
+	for name, dst := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			apierror.Error(w, r, "Invalid "+name+" timestamp, use RFC 3339", http.StatusBadRequest)
+			return
+		}
+		*dst = t
+	}
+
+	page, limit := 1, defaultListLimit
+	if p, err := strconv.Atoi(query.Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	if l, err := strconv.Atoi(query.Get("limit")); err == nil && l > 0 {
+		limit = min(l, maxListLimit)
+	}
+
+	entries, total, err := h.logger.List(r.Context(), filter, limit, (page-1)*limit)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error listing audit log")
+		apierror.Error(w, r, "Error listing audit log", http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []*Entry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ListResponse{
+		Entries:    entries,
+		Page:       page,
+		Limit:      limit,
+		Total:      total,
+		TotalPages: (total + limit - 1) / limit,
+	}); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error encoding audit log")
+	}
+}
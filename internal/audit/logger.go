@@ -0,0 +1,143 @@
+// Package audit records sensitive actions like logins, token changes, deletions and admin
+// operations in the audit_log table, so operators can review who did what and from where.
+package audit
+
+import (
+	"context"
+	"net/http"
+	"time"
+	"volaticus-go/internal/common/batch"
+	"volaticus-go/internal/common/clientip"
+	userctx "volaticus-go/internal/context"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionLogin          = "login"
+	ActionLogout         = "logout"
+	ActionAccountDelete  = "account.delete"
+	ActionProfileUpdate  = "profile.update"
+	ActionTokenCreate    = "token.create"
+	ActionTokenRevoke    = "token.revoke"
+	ActionTokenRotate    = "token.rotate"
+	ActionFileDelete     = "file.delete"
+	ActionURLDelete      = "url.delete"
+	ActionURLRegenerate  = "url.regenerate"
+	ActionDomainDelete   = "domain.delete"
+	ActionStorageSync    = "admin.storage_sync"
+	ActionStorageVerify  = "admin.storage_verify"
+	ActionTokenRateLimit = "admin.token_rate_limit"
+)
+
+// Results of recorded actions
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// Event describes an action to record, the actor, client IP and request ID are taken from the request
+type Event struct {
+	Action     string
+	TargetType string
+	TargetID   string
+	Result     string // ResultSuccess when empty
+	Details    string
+	// Actor overrides the user of the request context, for logins where nobody is signed in yet.
+	// ActorName alone records the username of a failed login attempt.
+	ActorID   *uuid.UUID
+	ActorName string
+}
+
+// Logger writes audit entries in the background so recording an action never waits on the
+// database. A nil Logger records nothing.
+type Logger struct {
+	repo     Repository
+	clientIP *clientip.Resolver
+	writer   *batch.Writer[*Entry]
+}
+
+// NewLogger creates a logger writing to repo, clientIP resolves the address of the actor behind proxies
+func NewLogger(repo Repository, clientIP *clientip.Resolver) *Logger {
+	return &Logger{
+		repo:     repo,
+		clientIP: clientIP,
+		writer:   batch.NewWriter("audit log", repo.Insert, dropEntry),
+	}
+}
+
+// Record queues an entry for the event of the request. It never blocks: when the writer falls
+// behind, the entry is dropped and only written to the application log.
+func (l *Logger) Record(r *http.Request, event Event) {
+	if l == nil {
+		return
+	}
+
+	entry := &Entry{
+		ID:         uuid.New(),
+		CreatedAt:  time.Now().UTC(),
+		Action:     event.Action,
+		ActorID:    event.ActorID,
+		ActorName:  event.ActorName,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		RequestID:  middleware.GetReqID(r.Context()),
+		Result:     event.Result,
+		Details:    event.Details,
+	}
+	if entry.Result == "" {
+		entry.Result = ResultSuccess
+	}
+	if entry.ActorID == nil && entry.ActorName == "" {
+		if user := userctx.GetUserFromContext(r.Context()); user != nil {
+			entry.ActorID = &user.ID
+			entry.ActorName = user.Username
+		}
+	}
+	if l.clientIP != nil {
+		entry.IPAddress = l.clientIP.FromRequest(r)
+	}
+
+	l.writer.Add(entry)
+}
+
+// dropEntry leaves a trace in the application log of an entry that won't reach the database
+func dropEntry(entry *Entry, reason string) {
+	log.Warn().
+		Str("action", entry.Action).
+		Str("actor", entry.ActorName).
+		Str("target_type", entry.TargetType).
+		Str("target_id", entry.TargetID).
+		Str("result", entry.Result).
+		Str("rid", entry.RequestID).
+		Msg(reason + ", entry dropped")
+}
+
+// Start writes queued entries until the logger is closed
+func (l *Logger) Start() {
+	l.writer.Start()
+}
+
+// Close stops accepting entries and waits until the queued ones are written
+func (l *Logger) Close(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	return l.writer.Close(ctx)
+}
+
+// List returns a page of the entries matching the filter, newest first, and how many match in total
+func (l *Logger) List(ctx context.Context, filter Filter, limit, offset int) ([]*Entry, int, error) {
+	total, err := l.repo.Count(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	entries, err := l.repo.List(ctx, filter, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
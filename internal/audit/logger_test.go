@@ -0,0 +1,122 @@
+package audit
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+	"volaticus-go/internal/common/batch"
+	"volaticus-go/internal/common/clientip"
+	userctx "volaticus-go/internal/context"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+)
+
+// memoryRepository keeps inserted entries in memory, blocking inserts until unblocked
+type memoryRepository struct {
+	Repository
+	mu      sync.Mutex
+	entries []*Entry
+	batches int
+	block   chan struct{}
+}
+
+func (r *memoryRepository) Insert(_ context.Context, entries []*Entry) error {
+	if r.block != nil {
+		<-r.block
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entries...)
+	r.batches++
+	return nil
+}
+
+func TestLoggerRecord(t *testing.T) {
+	repo := &memoryRepository{}
+	logger := NewLogger(repo, clientip.NewResolver(0, nil))
+	logger.Start()
+
+	userID := uuid.New()
+	req := httptest.NewRequest("DELETE", "/files/1", nil)
+	req.RemoteAddr = "203.0.113.7:4321"
+	ctx := userctx.WithUser(req.Context(), &userctx.UserInfo{ID: userID, Username: "alice"})
+	ctx = context.WithValue(ctx, middleware.RequestIDKey, "req-1")
+	req = req.WithContext(ctx)
+
+	logger.Record(req, Event{Action: ActionFileDelete, TargetType: "file", TargetID: "1"})
+	// Failed logins name the attempted user instead of the signed in one
+	logger.Record(req, Event{Action: ActionLogin, ActorName: "mallory", Result: ResultFailure})
+
+	if err := logger.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if len(repo.entries) != 2 {
+		t.Fatalf("entries = %d, want 2", len(repo.entries))
+	}
+
+	entry := repo.entries[0]
+	if entry.ActorID == nil || *entry.ActorID != userID || entry.ActorName != "alice" {
+		t.Errorf("actor = %v %q, want alice", entry.ActorID, entry.ActorName)
+	}
+	if entry.IPAddress != "203.0.113.7" || entry.RequestID != "req-1" || entry.Result != ResultSuccess {
+		t.Errorf("entry = %+v", entry)
+	}
+	if entry.CreatedAt.IsZero() || entry.ID == uuid.Nil {
+		t.Errorf("entry without ID or time: %+v", entry)
+	}
+
+	failed := repo.entries[1]
+	if failed.ActorID != nil || failed.ActorName != "mallory" || failed.Result != ResultFailure {
+		t.Errorf("failed login = %+v", failed)
+	}
+
+	// Entries after closing are dropped rather than written
+	logger.Record(req, Event{Action: ActionLogout})
+	if len(repo.entries) != 2 {
+		t.Errorf("entry recorded after Close()")
+	}
+}
+
+func TestLoggerNeverBlocks(t *testing.T) {
+	repo := &memoryRepository{block: make(chan struct{})}
+	logger := NewLogger(repo, nil)
+	logger.Start()
+	req := httptest.NewRequest("GET", "/logout", nil)
+
+	done := make(chan struct{})
+	go func() {
+		// The writer is stuck on the first batch, everything beyond the buffer is dropped
+		for i := 0; i < batch.BufferSize+2*batch.BatchSize; i++ {
+			logger.Record(req, Event{Action: ActionLogout})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Record() blocked while the database was slow")
+	}
+
+	close(repo.block)
+	if err := logger.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	// The stuck batch holds up to batch.BatchSize entries taken out of the buffer
+	if n := len(repo.entries); n == 0 || n > batch.BufferSize+batch.BatchSize {
+		t.Errorf("written entries = %d, want between 1 and %d", n, batch.BufferSize+batch.BatchSize)
+	}
+	if repo.batches >= len(repo.entries) {
+		t.Errorf("%d entries were written in %d batches, want them batched", len(repo.entries), repo.batches)
+	}
+}
+
+func TestNilLogger(t *testing.T) {
+	var logger *Logger
+	logger.Record(httptest.NewRequest("GET", "/", nil), Event{Action: ActionLogout})
+	if err := logger.Close(context.Background()); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
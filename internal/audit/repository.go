@@ -0,0 +1,142 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"volaticus-go/internal/database"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// Entry is one recorded action
+type Entry struct {
+	ID         uuid.UUID  `db:"id" json:"id"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	Action     string     `db:"action" json:"action"`
+	ActorID    *uuid.UUID `db:"actor_id" json:"actor_id,omitempty"` // nil for failed logins of unknown users
+	ActorName  string     `db:"actor_name" json:"actor_name,omitempty"`
+	TargetType string     `db:"target_type" json:"target_type,omitempty"`
+	TargetID   string     `db:"target_id" json:"target_id,omitempty"`
+	IPAddress  string     `db:"ip_address" json:"ip_address,omitempty"`
+	RequestID  string     `db:"request_id" json:"request_id,omitempty"`
+	Result     string     `db:"result" json:"result"`
+	Details    string     `db:"details" json:"details,omitempty"`
+}
+
+// Filter narrows down a listing of the audit log, zero fields match every entry
+type Filter struct {
+	Action     string
+	ActorID    *uuid.UUID
+	ActorName  string // Matched ignoring case
+	TargetType string
+	TargetID   string
+	Result     string
+	Since      time.Time
+	Until      time.Time
+}
+
+// Repository defines methods for audit log persistence
+type Repository interface {
+	Insert(ctx context.Context, entries []*Entry) error
+	// List returns a page of the entries matching the filter, newest first
+	List(ctx context.Context, filter Filter, limit, offset int) ([]*Entry, error)
+	Count(ctx context.Context, filter Filter) (int, error)
+}
+
+type repository struct {
+	*database.Repository
+}
+
+// NewRepository creates a new audit log repository
+func NewRepository(db *database.DB) Repository {
+	return &repository{
+		Repository: database.NewRepository(db),
+	}
+}
+
+// Insert writes a batch of entries in one transaction
+func (r *repository) Insert(ctx context.Context, entries []*Entry) error {
+	return r.WithTx(ctx, func(tx *sqlx.Tx) error {
+		for _, entry := range entries {
+			_, err := tx.ExecContext(ctx, `
+                INSERT INTO audit_log (id, created_at, action, actor_id, actor_name, target_type,
+                    target_id, ip_address, request_id, result, details)
+                VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+				entry.ID, entry.CreatedAt, entry.Action, entry.ActorID, entry.ActorName, entry.TargetType,
+				entry.TargetID, entry.IPAddress, entry.RequestID, entry.Result, entry.Details,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *repository) List(ctx context.Context, filter Filter, limit, offset int) ([]*Entry, error) {
+	where, args := filter.where()
+	args = append(args, limit, offset)
+	query := fmt.Sprintf(`
+        SELECT * FROM audit_log
+        %s
+        ORDER BY created_at DESC, id
+        LIMIT $%d OFFSET $%d`,
+		where, len(args)-1, len(args),
+	)
+
+	var entries []*Entry
+	if err := r.Select(ctx, &entries, query, args...); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (r *repository) Count(ctx context.Context, filter Filter) (int, error) {
+	where, args := filter.where()
+	var count int
+	err := r.Get(ctx, &count, "SELECT COUNT(*) FROM audit_log "+where, args...)
+	return count, err
+}
+
+// where builds the WHERE clause of the filter and its arguments
+func (f Filter) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.Action != "" {
+		add("action = $%d", f.Action)
+	}
+	if f.ActorID != nil {
+		add("actor_id = $%d", *f.ActorID)
+	}
+	if f.ActorName != "" {
+		add("LOWER(actor_name) = LOWER($%d)", f.ActorName)
+	}
+	if f.TargetType != "" {
+		add("target_type = $%d", f.TargetType)
+	}
+	if f.TargetID != "" {
+		add("target_id = $%d", f.TargetID)
+	}
+	if f.Result != "" {
+		add("result = $%d", f.Result)
+	}
+	if !f.Since.IsZero() {
+		add("created_at >= $%d", f.Since)
+	}
+	if !f.Until.IsZero() {
+		add("created_at < $%d", f.Until)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
@@ -0,0 +1,180 @@
+package audit
+
+import (
+	"context"
+	"github.com/rs/zerolog/log"
+	"os"
+	"testing"
+	"time"
+	"volaticus-go/internal/database"
+	"volaticus-go/internal/database/migrate"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+var (
+	testHost     string
+	testPort     string
+	testDatabase string
+	testUsername string
+	testPassword string
+)
+
+func TestMain(m *testing.M) {
+	// Start the container before running tests
+	teardown, err := mustStartPostgresContainer()
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("could not start postgres container")
+	}
+
+	// Run the tests
+	code := m.Run()
+
+	// Cleanup after tests finish
+	if teardown != nil {
+		if err := teardown(context.Background()); err != nil {
+			log.Warn().
+				Err(err).
+				Msg("could not teardown postgres container")
+		}
+	}
+
+	os.Exit(code)
+}
+
+// Setup Postgres container for testing
+func mustStartPostgresContainer() (func(context.Context) error, error) {
+	ctx := context.Background()
+	var (
+		dbName = "testdb"
+		dbPwd  = "testpass"
+		dbUser = "testuser"
+	)
+
+	container, err := postgres.Run(ctx, "postgres:14-alpine",
+		postgres.WithDatabase(dbName),
+		postgres.WithUsername(dbUser),
+		postgres.WithPassword(dbPwd),
+		testcontainers.WithWaitStrategy(
+			wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2).
+				WithStartupTimeout(5*time.Second)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set the global test variables
+	testDatabase = dbName
+	testPassword = dbPwd
+	testUsername = dbUser
+
+	// Get host and port
+	host, err := container.Host(ctx)
+	if err != nil {
+		return container.Terminate, err
+	}
+	testHost = host
+
+	port, err := container.MappedPort(ctx, "5432")
+	if err != nil {
+		return container.Terminate, err
+	}
+	testPort = port.Port()
+
+	log.Info().
+		Str("host", testHost).
+		Str("port", testPort).
+		Msg("Started postgres container")
+	return container.Terminate, nil
+}
+
+func setupTestDB(t *testing.T) *database.DB {
+	cfg := database.Config{
+		Host:     testHost,
+		Port:     testPort,
+		Database: testDatabase,
+		Username: testUsername,
+		Password: testPassword,
+		Schema:   "public",
+	}
+	db, err := database.New(cfg)
+	require.NoError(t, err)
+	require.NotNil(t, db)
+
+	// Run migrations to create necessary tables
+	err = migrate.RunMigrations(db.DB)
+	require.NoError(t, err)
+
+	return db
+}
+
+func TestRepository_List(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	ctx := context.Background()
+	aliceID := uuid.New()
+	start := time.Now().UTC().Add(-time.Hour).Truncate(time.Microsecond)
+	entry := func(minutes int, action, result string, actorID *uuid.UUID, actorName string) *Entry {
+		return &Entry{
+			ID:        uuid.New(),
+			CreatedAt: start.Add(time.Duration(minutes) * time.Minute),
+			Action:    action,
+			ActorID:   actorID,
+			ActorName: actorName,
+			Result:    result,
+		}
+	}
+	require.NoError(t, repo.Insert(ctx, []*Entry{
+		entry(0, ActionLogin, ResultFailure, nil, "Alice"),
+		entry(1, ActionLogin, ResultSuccess, &aliceID, "alice"),
+		entry(2, ActionFileDelete, ResultSuccess, &aliceID, "alice"),
+		entry(3, ActionLogin, ResultSuccess, nil, "bob"),
+	}))
+
+	t.Run("newest first", func(t *testing.T) {
+		entries, err := repo.List(ctx, Filter{}, 10, 0)
+		require.NoError(t, err)
+		require.Len(t, entries, 4)
+		assert.Equal(t, "bob", entries[0].ActorName)
+		assert.Equal(t, start, entries[3].CreatedAt.UTC())
+
+		entries, err = repo.List(ctx, Filter{}, 2, 2)
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.Equal(t, ActionLogin, entries[0].Action)
+		assert.Equal(t, &aliceID, entries[0].ActorID)
+	})
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   int
+	}{
+		{name: "action", filter: Filter{Action: ActionLogin}, want: 3},
+		{name: "actor ID", filter: Filter{ActorID: &aliceID}, want: 2},
+		{name: "actor name ignores case", filter: Filter{ActorName: "ALICE"}, want: 3},
+		{name: "failed logins", filter: Filter{Action: ActionLogin, Result: ResultFailure}, want: 1},
+		{name: "time range", filter: Filter{Since: start.Add(time.Minute), Until: start.Add(3 * time.Minute)}, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := repo.List(ctx, tt.filter, 10, 0)
+			require.NoError(t, err)
+			assert.Len(t, entries, tt.want)
+
+			count, err := repo.Count(ctx, tt.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, count)
+		})
+	}
+}
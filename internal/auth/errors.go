@@ -7,4 +7,8 @@ var (
 	ErrTokenExists   = errors.New("token already exists")
 	ErrTokenRevoked  = errors.New("token is revoked")
 	ErrTokenExpired  = errors.New("token has expired")
+
+	ErrTokenCollision = errors.New("failed to generate a unique token")
+
+	ErrInvalidRateLimit = errors.New("rate limit must be a positive number of requests per minute")
 )
@@ -2,7 +2,13 @@ package auth
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"volaticus-go/cmd/web/components"
+	"volaticus-go/internal/audit"
+	"volaticus-go/internal/common/apierror"
+	"volaticus-go/internal/common/models"
 	"volaticus-go/internal/context"
 	"volaticus-go/internal/user"
 	"volaticus-go/internal/validation"
@@ -16,6 +22,8 @@ import (
 type Handler struct {
 	userRepo    user.Repository
 	authService Service
+	baseURL     string
+	audit       *audit.Logger
 }
 
 type CreateTokenRequest struct {
@@ -29,10 +37,12 @@ type TokenResponse struct {
 	ID    uuid.UUID `json:"id"`
 }
 
-func NewHandler(userRepo user.Repository, authService Service) *Handler {
+func NewHandler(userRepo user.Repository, authService Service, baseURL string, auditLog *audit.Logger) *Handler {
 	return &Handler{
 		userRepo:    userRepo,
 		authService: authService,
+		baseURL:     baseURL,
+		audit:       auditLog,
 	}
 }
 
@@ -66,6 +76,12 @@ func (h *Handler) GenerateToken(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Server error", http.StatusInternalServerError)
 		return
 	}
+	h.audit.Record(r, audit.Event{
+		Action:     audit.ActionTokenCreate,
+		TargetType: "api_token",
+		TargetID:   token.ID.String(),
+		Details:    token.Name,
+	})
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("HX-Refresh", "true")
@@ -101,10 +117,184 @@ func (h *Handler) DeleteToken(w http.ResponseWriter, r *http.Request) {
 			Str("token", token).
 			Str("user_id", user.ID.String()).
 			Msg("Failed to delete token")
+		// The token value is a secret, entries don't name the token
+		h.audit.Record(r, audit.Event{Action: audit.ActionTokenRevoke, TargetType: "api_token", Result: audit.ResultFailure})
 		http.Error(w, "failed to delete token", http.StatusInternalServerError)
 		return
 	}
+	h.audit.Record(r, audit.Event{Action: audit.ActionTokenRevoke, TargetType: "api_token"})
 
 	// Return success for htmx-delete request
 	w.WriteHeader(http.StatusOK)
 }
+
+// RotateToken replaces the value of one of the user's API tokens. The new secret is only
+// returned in this response, the old value stops working immediately.
+func (h *Handler) RotateToken(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid token ID", http.StatusBadRequest)
+		return
+	}
+
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	token, err := h.authService.RotateToken(r.Context(), user.ID, tokenID)
+	if err != nil {
+		h.audit.Record(r, audit.Event{
+			Action:     audit.ActionTokenRotate,
+			TargetType: "api_token",
+			TargetID:   tokenID.String(),
+			Result:     audit.ResultFailure,
+		})
+		if errors.Is(err, ErrTokenNotFound) {
+			http.Error(w, "Token not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	h.audit.Record(r, audit.Event{
+		Action:     audit.ActionTokenRotate,
+		TargetType: "api_token",
+		TargetID:   tokenID.String(),
+		Details:    "replaced by " + token.ID.String(),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("HX-Refresh", "true")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(TokenResponse{Token: token.Token, Name: token.Name, ID: token.ID}); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error encoding response")
+	}
+}
+
+// TokenUsage renders the recent audit log of one of the user's API tokens
+func (h *Handler) TokenUsage(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid token ID", http.StatusBadRequest)
+		return
+	}
+
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	token, usage, err := h.authService.GetTokenUsage(r.Context(), user.ID, tokenID)
+	if err != nil {
+		if errors.Is(err, ErrTokenNotFound) {
+			http.Error(w, "Token not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := components.TokenUsageModal(token, usage).Render(r.Context(), w); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error rendering token usage")
+	}
+}
+
+// RateLimitRequest sets the requests per minute of an API token, null restores the default
+type RateLimitRequest struct {
+	RateLimit *int `json:"rate_limit"`
+}
+
+// SetRateLimit lets an admin change how many requests per minute any API token may send
+func (h *Handler) SetRateLimit(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Error(w, r, "Invalid token ID", http.StatusBadRequest)
+		return
+	}
+
+	var req RateLimitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Error(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	event := audit.Event{Action: audit.ActionTokenRateLimit, TargetType: "api_token", TargetID: tokenID.String(), Details: "default"}
+	if req.RateLimit != nil {
+		event.Details = strconv.Itoa(*req.RateLimit) + "/min"
+	}
+
+	if err := h.authService.SetTokenRateLimit(r.Context(), tokenID, req.RateLimit); err != nil {
+		event.Result = audit.ResultFailure
+		h.audit.Record(r, event)
+		switch {
+		case errors.Is(err, ErrInvalidRateLimit):
+			apierror.Error(w, r, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrTokenNotFound):
+			apierror.Error(w, r, "Token not found", http.StatusNotFound)
+		default:
+			apierror.Error(w, r, "Server error", http.StatusInternalServerError)
+		}
+		return
+	}
+	h.audit.Record(r, event)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleShareXConfig downloads a ShareX uploader config for one of the user's API tokens.
+// The token is selected with the token_id query parameter, defaulting to the newest active token.
+func (h *Handler) HandleShareXConfig(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var tokenID uuid.UUID
+	if idStr := r.URL.Query().Get("token_id"); idStr != "" {
+		var err error
+		tokenID, err = uuid.Parse(idStr)
+		if err != nil {
+			http.Error(w, "Invalid token ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	tokens, err := h.authService.GetUserAPITokens(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Tokens are listed newest first
+	var selected *models.APIToken
+	for _, token := range tokens {
+		if !token.IsActive || (tokenID != uuid.Nil && token.ID != tokenID) {
+			continue
+		}
+		selected = token
+		break
+	}
+	if selected == nil {
+		http.Error(w, "No active API token found, generate one in the settings first", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="volaticus.sxcu"`)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(NewShareXConfig(h.baseURL, selected.Token)); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error encoding ShareX config")
+	}
+}
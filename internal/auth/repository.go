@@ -27,10 +27,19 @@ type Repository interface {
 	TokenExists(ctx context.Context, token string) (bool, error)
 	// RevokeToken marks a token as revoked
 	RevokeToken(ctx context.Context, id uuid.UUID) error
-	// UpdateLastUsed updates the last used timestamp
-	UpdateLastUsed(ctx context.Context, id uuid.UUID) error
+	// UpdateRateLimit sets the requests per minute of a token, nil restores the default
+	UpdateRateLimit(ctx context.Context, id uuid.UUID, rateLimit *int) error
 	// DeleteTokenByUserIdAndToken deletes a token by user ID and token value
 	DeleteTokenByUserIdAndToken(ctx context.Context, userID uuid.UUID, token string) error
+	// RotateToken revokes an active token of the user and stores its replacement in one transaction,
+	// the replacement inherits the name, expiry and rate limit of the old token
+	RotateToken(ctx context.Context, userID, oldID uuid.UUID, replacement *models.APIToken) error
+	// RecordUsage appends a batch of audit entries and updates the last used timestamps of their
+	// tokens, only the newest keep entries of each token are retained. Entries of tokens deleted
+	// meanwhile are skipped.
+	RecordUsage(ctx context.Context, usage []*models.TokenUsage, keep int) error
+	// ListTokenUsage retrieves the newest audit entries of a token
+	ListTokenUsage(ctx context.Context, tokenID uuid.UUID, limit int) ([]*models.TokenUsage, error)
 }
 
 type repository struct {
@@ -133,12 +142,28 @@ func (r *repository) RevokeToken(ctx context.Context, id uuid.UUID) error {
 	})
 }
 
-func (r *repository) UpdateLastUsed(ctx context.Context, id uuid.UUID) error {
+func (r *repository) UpdateRateLimit(ctx context.Context, id uuid.UUID, rateLimit *int) error {
+	query := `UPDATE api_tokens SET rate_limit = $1 WHERE id = $2`
+	result, err := r.Exec(ctx, query, rateLimit, id)
+	if err != nil {
+		return fmt.Errorf("updating rate limit: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("getting rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+func (r *repository) DeleteTokenByUserIdAndToken(ctx context.Context, userID uuid.UUID, tokenStr string) error {
 	return r.WithTx(ctx, func(tx *sqlx.Tx) error {
-		query := `UPDATE api_tokens SET last_used_at = $1 WHERE id = $2`
-		result, err := tx.ExecContext(ctx, query, time.Now(), id)
+		query := `DELETE FROM api_tokens WHERE user_id = $1 AND token = $2`
+		result, err := tx.ExecContext(ctx, query, userID, tokenStr)
 		if err != nil {
-			return fmt.Errorf("updating last used: %w", err)
+			return fmt.Errorf("deleting token: %w", err)
 		}
 		rows, err := result.RowsAffected()
 		if err != nil {
@@ -151,20 +176,95 @@ func (r *repository) UpdateLastUsed(ctx context.Context, id uuid.UUID) error {
 	})
 }
 
-func (r *repository) DeleteTokenByUserIdAndToken(ctx context.Context, userID uuid.UUID, tokenStr string) error {
+func (r *repository) RotateToken(ctx context.Context, userID, oldID uuid.UUID, replacement *models.APIToken) error {
 	return r.WithTx(ctx, func(tx *sqlx.Tx) error {
-		query := `DELETE FROM api_tokens WHERE user_id = $1 AND token = $2`
-		result, err := tx.ExecContext(ctx, query, userID, tokenStr)
-		if err != nil {
-			return fmt.Errorf("deleting token: %w", err)
+		var old models.APIToken
+		query := `
+            SELECT * FROM api_tokens
+            WHERE id = $1 AND user_id = $2 AND is_active = true AND revoked_at IS NULL
+            FOR UPDATE`
+		if err := tx.GetContext(ctx, &old, query, oldID, userID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrTokenNotFound
+			}
+			return fmt.Errorf("getting token to rotate: %w", err)
 		}
-		rows, err := result.RowsAffected()
-		if err != nil {
-			return fmt.Errorf("getting rows affected: %w", err)
+
+		var exists bool
+		existsQuery := `SELECT EXISTS(SELECT 1 FROM api_tokens WHERE token = $1)`
+		if err := tx.GetContext(ctx, &exists, existsQuery, replacement.Token); err != nil {
+			return fmt.Errorf("checking token existence: %w", err)
 		}
-		if rows == 0 {
-			return ErrTokenNotFound
+		if exists {
+			return ErrTokenExists
+		}
+
+		revokeQuery := `UPDATE api_tokens SET is_active = false, revoked_at = NOW() WHERE id = $1`
+		if _, err := tx.ExecContext(ctx, revokeQuery, old.ID); err != nil {
+			return fmt.Errorf("revoking token: %w", err)
+		}
+
+		replacement.UserID = old.UserID
+		replacement.Name = old.Name
+		replacement.ExpiresAt = old.ExpiresAt
+		replacement.RateLimit = old.RateLimit
+		replacement.IsActive = true
+
+		insertQuery := `
+            INSERT INTO api_tokens (id, user_id, name, token, created_at, expires_at, is_active, rate_limit)
+            VALUES ($1, $2, $3, $4, NOW(), $5, $6, $7) RETURNING created_at`
+		if err := tx.GetContext(ctx, &replacement.CreatedAt, insertQuery,
+			replacement.ID, replacement.UserID, replacement.Name, replacement.Token,
+			replacement.ExpiresAt, replacement.IsActive, replacement.RateLimit); err != nil {
+			return fmt.Errorf("creating rotated token: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func (r *repository) RecordUsage(ctx context.Context, usage []*models.TokenUsage, keep int) error {
+	return r.WithTx(ctx, func(tx *sqlx.Tx) error {
+		lastUsed := make(map[uuid.UUID]time.Time)
+		insertQuery := `
+            INSERT INTO token_usage (token_id, used_at, ip_address, endpoint, status)
+            SELECT $1, $2, $3, $4, $5
+            WHERE EXISTS (SELECT 1 FROM api_tokens WHERE id = $1)`
+		for _, u := range usage {
+			if _, err := tx.ExecContext(ctx, insertQuery,
+				u.TokenID, u.UsedAt, u.IPAddress, u.Endpoint, u.Status); err != nil {
+				return fmt.Errorf("recording token usage: %w", err)
+			}
+			if u.UsedAt.After(lastUsed[u.TokenID]) {
+				lastUsed[u.TokenID] = u.UsedAt
+			}
 		}
+
+		updateQuery := `UPDATE api_tokens SET last_used_at = GREATEST(COALESCE(last_used_at, $1), $1) WHERE id = $2`
+		pruneQuery := `
+            DELETE FROM token_usage WHERE id IN (
+                SELECT id FROM token_usage WHERE token_id = $1
+                ORDER BY used_at DESC, id DESC
+                OFFSET $2
+            )`
+		for tokenID, usedAt := range lastUsed {
+			if _, err := tx.ExecContext(ctx, updateQuery, usedAt, tokenID); err != nil {
+				return fmt.Errorf("updating last used: %w", err)
+			}
+			if _, err := tx.ExecContext(ctx, pruneQuery, tokenID, keep); err != nil {
+				return fmt.Errorf("pruning token usage: %w", err)
+			}
+		}
+
 		return nil
 	})
 }
+
+func (r *repository) ListTokenUsage(ctx context.Context, tokenID uuid.UUID, limit int) ([]*models.TokenUsage, error) {
+	query := `SELECT * FROM token_usage WHERE token_id = $1 ORDER BY used_at DESC, id DESC LIMIT $2`
+	var usage []*models.TokenUsage
+	if err := r.Select(ctx, &usage, query, tokenID, limit); err != nil {
+		return nil, fmt.Errorf("listing token usage: %w", err)
+	}
+	return usage, nil
+}
@@ -304,7 +304,7 @@ func TestRepository_RevokeToken(t *testing.T) {
 	})
 }
 
-func TestRepository_UpdateLastUsed(t *testing.T) {
+func TestRepository_UpdateRateLimit(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
@@ -315,32 +315,39 @@ func TestRepository_UpdateLastUsed(t *testing.T) {
 	userID, err := createTestUser(ctx, db)
 	require.NoError(t, err)
 
-	t.Run("update last used timestamp", func(t *testing.T) {
-		// Create a token first
-		token := &models.APIToken{
-			ID:       uuid.New(),
-			UserID:   userID,
-			Name:     "Test Token",
-			Token:    "update-test-token-" + uuid.New().String(),
-			IsActive: true,
-		}
-		err := repo.CreateToken(ctx, token)
+	token := &models.APIToken{
+		ID:       uuid.New(),
+		UserID:   userID,
+		Name:     "Rate Limited Token",
+		Token:    "rate-limit-test-token-" + uuid.New().String(),
+		IsActive: true,
+	}
+	require.NoError(t, repo.CreateToken(ctx, token))
+
+	t.Run("new token uses default limit", func(t *testing.T) {
+		fetched, err := repo.GetAPITokenByID(ctx, token.ID)
 		require.NoError(t, err)
+		assert.Nil(t, fetched.RateLimit)
+	})
 
-		// Update last used timestamp
-		time.Sleep(time.Second) // Ensure time difference
-		err = repo.UpdateLastUsed(ctx, token.ID)
-		assert.NoError(t, err)
+	t.Run("set and reset rate limit", func(t *testing.T) {
+		limit := 10
+		require.NoError(t, repo.UpdateRateLimit(ctx, token.ID, &limit))
 
-		// Verify last used timestamp is updated
-		updatedToken, err := repo.GetAPITokenByToken(ctx, token.Token)
-		assert.NoError(t, err)
-		assert.NotNil(t, updatedToken.LastUsedAt)
+		fetched, err := repo.GetAPITokenByID(ctx, token.ID)
+		require.NoError(t, err)
+		require.NotNil(t, fetched.RateLimit)
+		assert.Equal(t, 10, *fetched.RateLimit)
+
+		require.NoError(t, repo.UpdateRateLimit(ctx, token.ID, nil))
+		fetched, err = repo.GetAPITokenByID(ctx, token.ID)
+		require.NoError(t, err)
+		assert.Nil(t, fetched.RateLimit)
 	})
 
 	t.Run("update non-existent token", func(t *testing.T) {
-		err := repo.UpdateLastUsed(ctx, uuid.New())
-		assert.Error(t, err)
+		limit := 10
+		err := repo.UpdateRateLimit(ctx, uuid.New(), &limit)
 		assert.ErrorIs(t, err, ErrTokenNotFound)
 	})
 }
@@ -383,3 +390,132 @@ func TestRepository_DeleteTokenByUserIdAndToken(t *testing.T) {
 		assert.ErrorIs(t, err, ErrTokenNotFound)
 	})
 }
+
+func TestRepository_RotateToken(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	ctx := context.Background()
+
+	// Create a test user
+	userID, err := createTestUser(ctx, db)
+	require.NoError(t, err)
+
+	token := &models.APIToken{
+		ID:       uuid.New(),
+		UserID:   userID,
+		Name:     "Rotated Token",
+		Token:    "rotate-test-token-" + uuid.New().String(),
+		IsActive: true,
+	}
+	require.NoError(t, repo.CreateToken(ctx, token))
+	limit := 5
+	require.NoError(t, repo.UpdateRateLimit(ctx, token.ID, &limit))
+
+	t.Run("rotate active token", func(t *testing.T) {
+		replacement := &models.APIToken{
+			ID:    uuid.New(),
+			Token: "rotate-test-token-" + uuid.New().String(),
+		}
+		require.NoError(t, repo.RotateToken(ctx, userID, token.ID, replacement))
+
+		old, err := repo.GetAPITokenByID(ctx, token.ID)
+		require.NoError(t, err)
+		assert.False(t, old.IsActive)
+		assert.NotNil(t, old.RevokedAt)
+
+		fetched, err := repo.GetAPITokenByToken(ctx, replacement.Token)
+		require.NoError(t, err)
+		assert.True(t, fetched.IsActive)
+		assert.Equal(t, "Rotated Token", fetched.Name)
+		assert.Equal(t, userID, fetched.UserID)
+		require.NotNil(t, fetched.RateLimit)
+		assert.Equal(t, 5, *fetched.RateLimit)
+	})
+
+	t.Run("rotate revoked token", func(t *testing.T) {
+		replacement := &models.APIToken{ID: uuid.New(), Token: "rotate-test-token-" + uuid.New().String()}
+		err := repo.RotateToken(ctx, userID, token.ID, replacement)
+		assert.ErrorIs(t, err, ErrTokenNotFound)
+	})
+
+	t.Run("rotate token of another user", func(t *testing.T) {
+		other := &models.APIToken{
+			ID:       uuid.New(),
+			UserID:   userID,
+			Name:     "Other Token",
+			Token:    "rotate-test-token-" + uuid.New().String(),
+			IsActive: true,
+		}
+		require.NoError(t, repo.CreateToken(ctx, other))
+
+		replacement := &models.APIToken{ID: uuid.New(), Token: "rotate-test-token-" + uuid.New().String()}
+		err := repo.RotateToken(ctx, uuid.New(), other.ID, replacement)
+		assert.ErrorIs(t, err, ErrTokenNotFound)
+	})
+}
+
+func TestRepository_RecordUsage(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	ctx := context.Background()
+
+	// Create a test user
+	userID, err := createTestUser(ctx, db)
+	require.NoError(t, err)
+
+	token := &models.APIToken{
+		ID:       uuid.New(),
+		UserID:   userID,
+		Name:     "Audited Token",
+		Token:    "usage-test-token-" + uuid.New().String(),
+		IsActive: true,
+	}
+	require.NoError(t, repo.CreateToken(ctx, token))
+
+	t.Run("record and list usage", func(t *testing.T) {
+		start := time.Now().Add(-time.Hour)
+		var batch []*models.TokenUsage
+		for i := 0; i < 5; i++ {
+			batch = append(batch, &models.TokenUsage{
+				TokenID:   token.ID,
+				UsedAt:    start.Add(time.Duration(i) * time.Minute),
+				IPAddress: "203.0.113.7",
+				Endpoint:  "POST /api/v1/upload",
+				Status:    200 + i,
+			})
+		}
+		require.NoError(t, repo.RecordUsage(ctx, batch[:2], 3))
+		require.NoError(t, repo.RecordUsage(ctx, batch[2:], 3))
+
+		usage, err := repo.ListTokenUsage(ctx, token.ID, 10)
+		require.NoError(t, err)
+		require.Len(t, usage, 3)
+		assert.Equal(t, 204, usage[0].Status)
+		assert.Equal(t, 202, usage[2].Status)
+		assert.Equal(t, "203.0.113.7", usage[0].IPAddress)
+
+		fetched, err := repo.GetAPITokenByID(ctx, token.ID)
+		require.NoError(t, err)
+		require.NotNil(t, fetched.LastUsedAt)
+		assert.WithinDuration(t, batch[4].UsedAt, *fetched.LastUsedAt, time.Millisecond)
+	})
+
+	t.Run("skip usage of non-existent token", func(t *testing.T) {
+		missing := uuid.New()
+		err := repo.RecordUsage(ctx, []*models.TokenUsage{{
+			TokenID:  missing,
+			UsedAt:   time.Now(),
+			Endpoint: "GET /api/v1/files",
+			Status:   200,
+		}}, 3)
+		require.NoError(t, err)
+
+		usage, err := repo.ListTokenUsage(ctx, missing, 10)
+		require.NoError(t, err)
+		assert.Empty(t, usage)
+	})
+}
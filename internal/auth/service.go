@@ -22,6 +22,9 @@ type Service interface {
 	ValidateAPIToken(ctx context.Context, token string) (*models.APIToken, error)
 	DeleteTokenByUserIdAndToken(ctx context.Context, userID uuid.UUID, token string) error
 	GetUserAPITokens(ctx context.Context, userID uuid.UUID) ([]*models.APIToken, error)
+	RotateToken(ctx context.Context, userID, tokenID uuid.UUID) (*models.APIToken, error)
+	GetTokenUsage(ctx context.Context, userID, tokenID uuid.UUID) (*models.APIToken, []*models.TokenUsage, error)
+	SetTokenRateLimit(ctx context.Context, tokenID uuid.UUID, rateLimit *int) error
 }
 type authService struct {
 	tokenAuth *jwtauth.JWTAuth
@@ -31,6 +34,12 @@ type authService struct {
 
 const TokenExpiry = time.Hour * 24 // 24 hours TODO: implement refresh tokens
 
+// tokenValueAttempts is how often a new token value is generated before giving up on collisions
+const tokenValueAttempts = 3
+
+// TokenUsageRetention is the number of audit entries kept per API token
+const TokenUsageRetention = 100
+
 // NewService creates a new auth service
 func NewService(secretKey string, repo Repository) Service {
 	tokenAuth := jwtauth.New("HS256", []byte(secretKey), nil)
@@ -78,19 +87,17 @@ type LoginResponse struct {
 	User  interface{} `json:"user"`
 }
 
-func (s *authService) GenerateAPIToken(ctx context.Context, userID uuid.UUID, name string) (*models.APIToken, error) {
-	var token string
-	var exists bool
-	var err error
-
-	for attempts := 0; attempts < 3; attempts++ {
+// newTokenValue generates a random HMAC signed token value that is not in use yet.
+// Returns ErrTokenCollision if every attempt produced a value that already exists.
+func (s *authService) newTokenValue(ctx context.Context, userID uuid.UUID) (string, error) {
+	for attempt := 1; attempt <= tokenValueAttempts; attempt++ {
 		tokenBytes := make([]byte, 32)
-		if _, err = rand.Read(tokenBytes); err != nil {
+		if _, err := rand.Read(tokenBytes); err != nil {
 			log.Error().
 				Err(err).
 				Str("user_id", userID.String()).
 				Msg("Failed to generate random bytes for API token")
-			return nil, fmt.Errorf("failed to generate random bytes: %w", err)
+			return "", fmt.Errorf("failed to generate random bytes: %w", err)
 		}
 
 		h := hmac.New(sha256.New, s.secretKey)
@@ -98,33 +105,38 @@ func (s *authService) GenerateAPIToken(ctx context.Context, userID uuid.UUID, na
 		hmacBytes := h.Sum(nil)
 
 		finalBytes := append(tokenBytes, hmacBytes...)
-		token = base64.URLEncoding.EncodeToString(finalBytes)
+		token := base64.URLEncoding.EncodeToString(finalBytes)
 
-		exists, err = s.repo.TokenExists(ctx, token)
+		exists, err := s.repo.TokenExists(ctx, token)
 		if err != nil {
 			log.Error().
 				Err(err).
 				Str("user_id", userID.String()).
-				Int("attempt", attempts+1).
+				Int("attempt", attempt).
 				Msg("Failed to check token existence")
-			return nil, fmt.Errorf("failed to check token existence: %w", err)
+			return "", fmt.Errorf("failed to check token existence: %w", err)
 		}
-
 		if !exists {
-			break
+			return token, nil
 		}
 
 		log.Warn().
 			Str("user_id", userID.String()).
-			Int("attempt", attempts+1).
+			Int("attempt", attempt).
 			Msg("Token collision occurred, retrying")
 	}
 
-	if exists {
-		log.Error().
-			Str("user_id", userID.String()).
-			Msg("Failed to generate unique token after 3 attempts")
-		return nil, errors.New("failed to generate unique token after 3 attempts")
+	log.Error().
+		Str("user_id", userID.String()).
+		Int("attempts", tokenValueAttempts).
+		Msg("Failed to generate unique token")
+	return "", ErrTokenCollision
+}
+
+func (s *authService) GenerateAPIToken(ctx context.Context, userID uuid.UUID, name string) (*models.APIToken, error) {
+	token, err := s.newTokenValue(ctx, userID)
+	if err != nil {
+		return nil, err
 	}
 
 	apiToken := &models.APIToken{
@@ -185,14 +197,6 @@ func (s *authService) ValidateAPIToken(ctx context.Context, token string) (*mode
 		return nil, errors.New("token has expired")
 	}
 
-	err = s.repo.UpdateLastUsed(ctx, apiToken.ID)
-	if err != nil {
-		log.Error().
-			Err(err).
-			Str("token_id", apiToken.ID.String()).
-			Msg("Failed to update last used timestamp")
-	}
-
 	return apiToken, nil
 }
 
@@ -224,3 +228,72 @@ func (s *authService) DeleteTokenByUserIdAndToken(ctx context.Context, userID uu
 
 	return nil
 }
+
+// RotateToken revokes an active token of the user and replaces it with a new value under the
+// same name, expiry and rate limit. The returned token holds the new secret.
+func (s *authService) RotateToken(ctx context.Context, userID, tokenID uuid.UUID) (*models.APIToken, error) {
+	token, err := s.newTokenValue(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	replacement := &models.APIToken{
+		ID:    uuid.New(),
+		Token: token,
+	}
+	if err := s.repo.RotateToken(ctx, userID, tokenID, replacement); err != nil {
+		log.Error().
+			Err(err).
+			Str("token_id", tokenID.String()).
+			Str("user_id", userID.String()).
+			Msg("Failed to rotate API token")
+		return nil, err
+	}
+
+	log.Info().
+		Str("old_token_id", tokenID.String()).
+		Str("token_id", replacement.ID.String()).
+		Str("user_id", userID.String()).
+		Msg("Rotated API token")
+
+	return replacement, nil
+}
+
+// GetTokenUsage returns a token owned by the user together with its recent audit entries
+func (s *authService) GetTokenUsage(ctx context.Context, userID, tokenID uuid.UUID) (*models.APIToken, []*models.TokenUsage, error) {
+	token, err := s.repo.GetAPITokenByID(ctx, tokenID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if token.UserID != userID {
+		return nil, nil, ErrTokenNotFound
+	}
+
+	usage, err := s.repo.ListTokenUsage(ctx, tokenID, TokenUsageRetention)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("token_id", tokenID.String()).
+			Msg("Failed to retrieve API token usage")
+		return nil, nil, err
+	}
+	return token, usage, nil
+}
+
+// SetTokenRateLimit overrides the requests per minute allowed for a token, nil restores the
+// configured default. It takes effect with the next request of the token.
+func (s *authService) SetTokenRateLimit(ctx context.Context, tokenID uuid.UUID, rateLimit *int) error {
+	if rateLimit != nil && *rateLimit <= 0 {
+		return ErrInvalidRateLimit
+	}
+	if err := s.repo.UpdateRateLimit(ctx, tokenID, rateLimit); err != nil {
+		if !errors.Is(err, ErrTokenNotFound) {
+			log.Error().
+				Err(err).
+				Str("token_id", tokenID.String()).
+				Msg("Failed to update API token rate limit")
+		}
+		return err
+	}
+	return nil
+}
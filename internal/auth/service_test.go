@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"volaticus-go/internal/common/models"
+)
+
+// collidingRepository reports every token value as taken
+type collidingRepository struct {
+	Repository
+	checks  int
+	created int
+}
+
+func (r *collidingRepository) TokenExists(context.Context, string) (bool, error) {
+	r.checks++
+	return true, nil
+}
+
+func (r *collidingRepository) CreateToken(context.Context, *models.APIToken) error {
+	r.created++
+	return nil
+}
+
+func TestGenerateAPITokenCollision(t *testing.T) {
+	repo := &collidingRepository{}
+	s := NewService("secret", repo)
+
+	token, err := s.GenerateAPIToken(context.Background(), uuid.New(), "ci")
+	if !errors.Is(err, ErrTokenCollision) {
+		t.Fatalf("GenerateAPIToken() error = %v, want ErrTokenCollision", err)
+	}
+	if token != nil {
+		t.Errorf("GenerateAPIToken() returned a token despite the collision")
+	}
+	if repo.checks != tokenValueAttempts {
+		t.Errorf("TokenExists called %d times, want %d", repo.checks, tokenValueAttempts)
+	}
+	if repo.created != 0 {
+		t.Errorf("CreateToken called %d times, want 0", repo.created)
+	}
+}
+
+// rateLimitRepository records the rate limit stored for a token
+type rateLimitRepository struct {
+	Repository
+	stored  *int
+	updates int
+}
+
+func (r *rateLimitRepository) UpdateRateLimit(_ context.Context, _ uuid.UUID, rateLimit *int) error {
+	r.stored = rateLimit
+	r.updates++
+	return nil
+}
+
+func TestSetTokenRateLimit(t *testing.T) {
+	limit := func(n int) *int { return &n }
+
+	tests := []struct {
+		name    string
+		limit   *int
+		wantErr error
+	}{
+		{name: "custom limit", limit: limit(600)},
+		{name: "default", limit: nil},
+		{name: "zero", limit: limit(0), wantErr: ErrInvalidRateLimit},
+		{name: "negative", limit: limit(-1), wantErr: ErrInvalidRateLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &rateLimitRepository{}
+			s := NewService("secret", repo)
+
+			err := s.SetTokenRateLimit(context.Background(), uuid.New(), tt.limit)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SetTokenRateLimit() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if repo.updates != 0 {
+					t.Errorf("invalid limit was stored")
+				}
+				return
+			}
+			if repo.stored != tt.limit {
+				t.Errorf("stored limit = %v, want %v", repo.stored, tt.limit)
+			}
+		})
+	}
+}
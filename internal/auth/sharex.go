@@ -0,0 +1,35 @@
+package auth
+
+import "strings"
+
+// ShareXConfig is a ShareX custom uploader definition (.sxcu file)
+type ShareXConfig struct {
+	Version         string            `json:"Version"`
+	Name            string            `json:"Name"`
+	DestinationType string            `json:"DestinationType"`
+	RequestMethod   string            `json:"RequestMethod"`
+	RequestURL      string            `json:"RequestURL"`
+	Headers         map[string]string `json:"Headers"`
+	Body            string            `json:"Body"`
+	FileFormName    string            `json:"FileFormName"`
+	URL             string            `json:"URL"`
+	ErrorMessage    string            `json:"ErrorMessage"`
+}
+
+// NewShareXConfig creates an uploader definition posting files to the API upload endpoint with the given token
+func NewShareXConfig(baseURL, token string) ShareXConfig {
+	return ShareXConfig{
+		Version:         "15.0.0",
+		Name:            "Volaticus",
+		DestinationType: "ImageUploader, TextUploader, FileUploader",
+		RequestMethod:   "POST",
+		RequestURL:      strings.TrimSuffix(baseURL, "/") + "/api/v1/upload",
+		Headers: map[string]string{
+			"Authorization": "Bearer " + token,
+		},
+		Body:         "MultipartFormData",
+		FileFormName: "file",
+		URL:          "{json:url}",
+		ErrorMessage: "{json:error}",
+	}
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"context"
+	"time"
+	"volaticus-go/internal/common/batch"
+	"volaticus-go/internal/common/models"
+
+	"github.com/rs/zerolog/log"
+)
+
+// UsageWriter stores token usage in the background, so API requests don't wait on the
+// audit entry of their token being written
+type UsageWriter struct {
+	writer *batch.Writer[*models.TokenUsage]
+}
+
+// NewUsageWriter creates a writer storing usage in repo, keeping the last TokenUsageRetention
+// entries of each token
+func NewUsageWriter(repo Repository) *UsageWriter {
+	write := func(ctx context.Context, usage []*models.TokenUsage) error {
+		return repo.RecordUsage(ctx, usage, TokenUsageRetention)
+	}
+	return &UsageWriter{writer: batch.NewWriter("token usage", write, dropUsage)}
+}
+
+// Record queues the usage of a token without blocking the request
+func (w *UsageWriter) Record(usage *models.TokenUsage) {
+	if usage.UsedAt.IsZero() {
+		usage.UsedAt = time.Now()
+	}
+	w.writer.Add(usage)
+}
+
+// dropUsage logs the usage that is lost when the writer falls behind or is closed
+func dropUsage(usage *models.TokenUsage, reason string) {
+	log.Warn().
+		Str("token_id", usage.TokenID.String()).
+		Str("endpoint", usage.Endpoint).
+		Int("status", usage.Status).
+		Msg(reason + ", entry dropped")
+}
+
+// Start writes the queued usage until the writer is closed
+func (w *UsageWriter) Start() {
+	w.writer.Start()
+}
+
+// Close writes the usage still queued, later usage is dropped
+func (w *UsageWriter) Close(ctx context.Context) error {
+	return w.writer.Close(ctx)
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"volaticus-go/internal/common/models"
+)
+
+// usageRepository keeps recorded usage in memory, blocking writes until unblocked
+type usageRepository struct {
+	Repository
+	mu      sync.Mutex
+	usage   []*models.TokenUsage
+	batches int
+	block   chan struct{}
+}
+
+func (r *usageRepository) RecordUsage(_ context.Context, usage []*models.TokenUsage, _ int) error {
+	if r.block != nil {
+		<-r.block
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.usage = append(r.usage, usage...)
+	r.batches++
+	return nil
+}
+
+func TestUsageWriterBatches(t *testing.T) {
+	repo := &usageRepository{block: make(chan struct{})}
+	writer := NewUsageWriter(repo)
+	writer.Start()
+
+	tokenID := uuid.New()
+	// The first entry holds up the writer, the rest queue up and are written together
+	for i := 0; i < 5; i++ {
+		writer.Record(&models.TokenUsage{TokenID: tokenID, Endpoint: "GET /api/v1/files", Status: 200})
+	}
+	close(repo.block)
+
+	if err := writer.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if len(repo.usage) != 5 {
+		t.Fatalf("usage = %d, want 5", len(repo.usage))
+	}
+	if repo.batches > 2 {
+		t.Errorf("batches = %d, want at most 2", repo.batches)
+	}
+	if repo.usage[0].UsedAt.IsZero() {
+		t.Errorf("UsedAt not set")
+	}
+
+	// Entries arriving after Close are dropped instead of panicking on the closed queue
+	writer.Record(&models.TokenUsage{TokenID: tokenID})
+	if len(repo.usage) != 5 {
+		t.Errorf("usage after Close = %d, want 5", len(repo.usage))
+	}
+}
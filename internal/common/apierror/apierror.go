@@ -0,0 +1,99 @@
+// Package apierror writes the error responses shared by the JSON API handlers.
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// APIError represents a standardized error response
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details string `json:"details,omitempty"`
+}
+
+// Common error codes
+const (
+	ErrCodeInvalidInput    = "INVALID_INPUT"
+	ErrCodeNotFound        = "NOT_FOUND"
+	ErrCodeUnauthorized    = "UNAUTHORIZED"
+	ErrCodeForbidden       = "FORBIDDEN"
+	ErrCodeAlreadyExists   = "ALREADY_EXISTS"
+	ErrCodeTooLarge        = "TOO_LARGE"
+	ErrCodeRejected        = "REJECTED"
+	ErrCodeTooManyRequests = "TOO_MANY_REQUESTS"
+	ErrCodeInternalError   = "INTERNAL_ERROR"
+	ErrCodeExpired         = "EXPIRED"
+	ErrCodeLimitExceeded   = "LIMIT_EXCEEDED"
+)
+
+// CodeForStatus returns the error code matching an HTTP status
+func CodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return ErrCodeInvalidInput
+	case http.StatusUnauthorized:
+		return ErrCodeUnauthorized
+	case http.StatusForbidden:
+		return ErrCodeForbidden
+	case http.StatusNotFound:
+		return ErrCodeNotFound
+	case http.StatusConflict:
+		return ErrCodeAlreadyExists
+	case http.StatusGone:
+		return ErrCodeExpired
+	case http.StatusRequestEntityTooLarge:
+		return ErrCodeTooLarge
+	case http.StatusUnprocessableEntity:
+		return ErrCodeRejected
+	case http.StatusTooManyRequests:
+		return ErrCodeTooManyRequests
+	default:
+		if status >= http.StatusInternalServerError {
+			return ErrCodeInternalError
+		}
+		return ErrCodeInvalidInput
+	}
+}
+
+// Write sends the error as JSON
+func Write(w http.ResponseWriter, err *APIError, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+
+	if encodeErr := json.NewEncoder(w).Encode(err); encodeErr != nil {
+		log.Error().
+			Err(encodeErr).
+			Interface("api_error", err).
+			Msg("failed to encode error response")
+	}
+}
+
+// Respond sends the error as JSON to API clients. HTMX requests get the plain
+// message instead, as the pages show the response text as it is.
+func Respond(w http.ResponseWriter, r *http.Request, err *APIError, status int) {
+	if r.Header.Get("HX-Request") == "true" {
+		http.Error(w, err.Message, status)
+		return
+	}
+	Write(w, err, status)
+}
+
+// WantsHTML reports whether the request is a browser navigation rather than an HTMX or API
+// call, so a missing or expired link can be shown as a page instead of a JSON error
+func WantsHTML(r *http.Request) bool {
+	if r.Header.Get("HX-Request") == "true" || strings.HasPrefix(r.URL.Path, "/api/") {
+		return false
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// Error works like http.Error, with the code derived from the status
+func Error(w http.ResponseWriter, r *http.Request, message string, status int) {
+	Respond(w, r, &APIError{Code: CodeForStatus(status), Message: message}, status)
+}
@@ -0,0 +1,86 @@
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestError(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/login", nil)
+	w := httptest.NewRecorder()
+	Error(w, r, "Invalid credentials", http.StatusUnauthorized)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var got APIError
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if got.Code != ErrCodeUnauthorized || got.Message != "Invalid credentials" {
+		t.Errorf("response = %+v, want UNAUTHORIZED with the message", got)
+	}
+}
+
+func TestErrorHTMX(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/login", nil)
+	r.Header.Set("HX-Request", "true")
+	w := httptest.NewRecorder()
+	Error(w, r, "Invalid credentials", http.StatusUnauthorized)
+
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q, want plain text for HTMX", ct)
+	}
+	if body := strings.TrimSpace(w.Body.String()); body != "Invalid credentials" {
+		t.Errorf("body = %q, want the message", body)
+	}
+}
+
+func TestCodeForStatus(t *testing.T) {
+	tests := map[int]string{
+		http.StatusBadRequest:          ErrCodeInvalidInput,
+		http.StatusNotFound:            ErrCodeNotFound,
+		http.StatusConflict:            ErrCodeAlreadyExists,
+		http.StatusTooManyRequests:     ErrCodeTooManyRequests,
+		http.StatusInternalServerError: ErrCodeInternalError,
+		http.StatusBadGateway:          ErrCodeInternalError,
+	}
+	for status, want := range tests {
+		if got := CodeForStatus(status); got != want {
+			t.Errorf("CodeForStatus(%d) = %q, want %q", status, got, want)
+		}
+	}
+}
+
+func TestWantsHTML(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		header map[string]string
+		want   bool
+	}{
+		{name: "browser", path: "/s/abc", header: map[string]string{"Accept": "text/html,application/xhtml+xml,*/*;q=0.8"}, want: true},
+		{name: "curl", path: "/s/abc", header: map[string]string{"Accept": "*/*"}},
+		{name: "json client", path: "/f/file.png", header: map[string]string{"Accept": "application/json"}},
+		{name: "htmx", path: "/s/abc", header: map[string]string{"Accept": "text/html", "HX-Request": "true"}},
+		{name: "api route", path: "/api/v1/files", header: map[string]string{"Accept": "text/html"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			if got := WantsHTML(r); got != tt.want {
+				t.Errorf("WantsHTML() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+// Package batch writes records in the background, so requests recording them never wait on the
+// database. Records queued while a batch is written go into the next one together.
+package batch
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// BufferSize is how many records wait for the writer before new ones are dropped
+	BufferSize = 1024
+	// BatchSize is the most records written in one transaction
+	BatchSize = 100
+	// writeTimeout bounds writing one batch of records
+	writeTimeout = 10 * time.Second
+)
+
+// Writer queues records of type T and hands them to its write function in batches
+type Writer[T any] struct {
+	name  string
+	write func(ctx context.Context, batch []T) error
+	drop  func(record T, reason string)
+	queue chan T
+
+	mu      sync.Mutex
+	started bool
+	closed  bool
+	done    chan struct{}
+}
+
+// NewWriter creates a writer storing batches with write. name describes the records in log
+// messages, drop is called with the reason for every record that won't reach the database.
+func NewWriter[T any](name string, write func(ctx context.Context, batch []T) error, drop func(record T, reason string)) *Writer[T] {
+	return &Writer[T]{
+		name:  name,
+		write: write,
+		drop:  drop,
+		queue: make(chan T, BufferSize),
+		done:  make(chan struct{}),
+	}
+}
+
+// Add queues a record. It never blocks: when the writer falls behind, the record is dropped.
+func (w *Writer[T]) Add(record T) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		w.drop(record, w.name+" writer closed")
+		return
+	}
+	select {
+	case w.queue <- record:
+	default:
+		w.drop(record, w.name+" buffer full")
+	}
+}
+
+// Start writes queued records until the writer is closed
+func (w *Writer[T]) Start() {
+	w.mu.Lock()
+	if w.started || w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.started = true
+	w.mu.Unlock()
+
+	go func() {
+		defer close(w.done)
+		for record := range w.queue {
+			w.flush(w.collect([]T{record}))
+		}
+	}()
+}
+
+// collect fills the batch with what else is queued, up to BatchSize records
+func (w *Writer[T]) collect(batch []T) []T {
+	for len(batch) < BatchSize {
+		select {
+		case record, ok := <-w.queue:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, record)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// Close stops accepting records and waits until the queued ones are written. Without Start
+// they are written before it returns.
+func (w *Writer[T]) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	started := w.started
+	close(w.queue)
+	w.mu.Unlock()
+
+	if !started {
+		for record := range w.queue {
+			w.flush(w.collect([]T{record}))
+		}
+		return nil
+	}
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flush writes one batch, failures are only logged as the recorded requests already happened
+func (w *Writer[T]) flush(batch []T) {
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+	if err := w.write(ctx, batch); err != nil {
+		log.Error().
+			Err(err).
+			Int("entries", len(batch)).
+			Msg("Failed to write " + w.name + " entries")
+	}
+}
@@ -0,0 +1,59 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestWriterCloseWithoutStart(t *testing.T) {
+	var written [][]int
+	var dropped []string
+	w := NewWriter("numbers", func(_ context.Context, batch []int) error {
+		written = append(written, batch)
+		return nil
+	}, func(_ int, reason string) {
+		dropped = append(dropped, reason)
+	})
+
+	for i := range BatchSize + 1 {
+		w.Add(i)
+	}
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if len(written) != 2 || len(written[0]) != BatchSize || len(written[1]) != 1 {
+		t.Errorf("wrote batches of %v records, want %d and 1", batchLens(written), BatchSize)
+	}
+
+	w.Add(1)
+	if len(dropped) != 1 || dropped[0] != "numbers writer closed" {
+		t.Errorf("dropped = %v, want the record added after Close()", dropped)
+	}
+}
+
+func TestWriterKeepsWritingAfterFailure(t *testing.T) {
+	calls := 0
+	w := NewWriter("numbers", func(context.Context, []int) error {
+		calls++
+		return errors.New("database unavailable")
+	}, func(int, string) {})
+	w.Start()
+
+	w.Add(1)
+	w.Add(2)
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if calls == 0 {
+		t.Error("no batch was written")
+	}
+}
+
+func batchLens(batches [][]int) []int {
+	lens := make([]int, 0, len(batches))
+	for _, batch := range batches {
+		lens = append(lens, len(batch))
+	}
+	return lens
+}
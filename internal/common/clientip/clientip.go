@@ -0,0 +1,171 @@
+// Package clientip resolves the IP address of the client that sent a request.
+package clientip
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Resolver finds the client IP of requests according to the configured reverse proxies.
+// A nil Resolver trusts no proxy and always uses the remote address.
+type Resolver struct {
+	hops    int
+	proxies []netip.Prefix
+}
+
+// NewResolver creates a resolver trusting the given proxy networks. Without networks it
+// falls back to trusting the last trustedHops entries of X-Forwarded-For, see FromRequest.
+func NewResolver(trustedHops int, trustedProxies []netip.Prefix) *Resolver {
+	return &Resolver{hops: trustedHops, proxies: trustedProxies}
+}
+
+// FromRequest returns the client IP of a request
+func (res *Resolver) FromRequest(r *http.Request) string {
+	if res == nil {
+		return Host(r.RemoteAddr)
+	}
+	if len(res.proxies) == 0 {
+		return FromRequest(r, res.hops)
+	}
+	return res.fromTrustedProxies(r)
+}
+
+// fromTrustedProxies only honors forwarding headers of requests sent by a trusted proxy.
+// X-Forwarded-For is walked from the right, skipping trusted proxies, so the client is
+// the first address that is not one of ours. X-Real-IP is used if there is no X-Forwarded-For.
+func (res *Resolver) fromTrustedProxies(r *http.Request) string {
+	remote := Host(r.RemoteAddr)
+	if !res.trusted(remote) {
+		return remote
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+
+	if len(hops) == 0 {
+		if ip := Host(strings.TrimSpace(r.Header.Get("X-Real-IP"))); net.ParseIP(ip) != nil {
+			return ip
+		}
+		return remote
+	}
+
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := Host(hops[i])
+		if net.ParseIP(ip) == nil {
+			// Anything left of a malformed entry can't be attributed to a proxy
+			break
+		}
+		client = ip
+		if !res.trusted(ip) {
+			break
+		}
+	}
+	return client
+}
+
+// trusted reports whether the address belongs to one of the trusted proxy networks
+func (res *Resolver) trusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range res.proxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// FromRequest returns the client IP of a request.
+//
+// X-Forwarded-For is only consulted when trustedHops is greater than zero, i.e. when
+// the server runs behind that many reverse proxies. Every proxy appends the address it
+// received the request from, so the client is trustedHops entries from the right;
+// anything further left can be forged by the client.
+func FromRequest(r *http.Request, trustedHops int) string {
+	remote := Host(r.RemoteAddr)
+	if trustedHops <= 0 {
+		return remote
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+
+	// The last proxy is the remote address itself, which is not part of the header
+	idx := len(hops) - trustedHops
+	if idx < 0 {
+		idx = 0
+	}
+	if idx < len(hops) {
+		if ip := Host(hops[idx]); net.ParseIP(ip) != nil {
+			return ip
+		}
+	}
+
+	return remote
+}
+
+// Host strips the port and IPv6 brackets from an address such as "[::1]:1234" or "10.0.0.1:80"
+func Host(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+
+	// Drop the zone of link-local addresses, e.g. "fe80::1%eth0"
+	if i := strings.IndexByte(addr, '%'); i >= 0 {
+		addr = addr[:i]
+	}
+	return addr
+}
+
+// Anonymize masks the host part of an IP address: the last octet of IPv4
+// addresses and everything after the /48 network prefix of IPv6 addresses.
+// Values that are not IP addresses are returned unchanged.
+func Anonymize(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// ForStorage prepares a visitor IP for storing in analytics according to the configured mode:
+// "truncate" masks the host part, "hash" replaces it with a keyed hash and "full" keeps it.
+// Hashing is deterministic, so unique visitors can still be counted.
+func ForStorage(ip, mode, secret string) string {
+	switch mode {
+	case "truncate":
+		return Anonymize(ip)
+	case "hash":
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(ip))
+		return hex.EncodeToString(mac.Sum(nil))
+	default:
+		return ip
+	}
+}
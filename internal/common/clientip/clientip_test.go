@@ -0,0 +1,236 @@
+package clientip
+
+import (
+	"net/http"
+	"net/netip"
+	"testing"
+)
+
+func TestHost(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"192.168.1.10:1234", "192.168.1.10"},
+		{"[::1]:1234", "::1"},
+		{"[2001:db8::1]:443", "2001:db8::1"},
+		{"2001:db8::1", "2001:db8::1"},
+		{"[fe80::1%eth0]:80", "fe80::1"},
+		{"10.0.0.1", "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		if got := Host(tt.addr); got != tt.want {
+			t.Errorf("Host(%q) = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		remoteAddr  string
+		xff         []string
+		trustedHops int
+		want        string
+	}{
+		{
+			name:       "no proxy ignores forwarded header",
+			remoteAddr: "[2001:db8::2]:5555",
+			xff:        []string{"1.2.3.4"},
+			want:       "2001:db8::2",
+		},
+		{
+			name:        "single proxy takes last hop",
+			remoteAddr:  "10.0.0.1:80",
+			xff:         []string{"6.6.6.6, 1.2.3.4"},
+			trustedHops: 1,
+			want:        "1.2.3.4",
+		},
+		{
+			name:        "two proxies across multiple headers",
+			remoteAddr:  "10.0.0.1:80",
+			xff:         []string{"6.6.6.6, 2001:db8::5", "10.0.0.2"},
+			trustedHops: 2,
+			want:        "2001:db8::5",
+		},
+		{
+			name:        "fewer hops than trusted uses the first",
+			remoteAddr:  "10.0.0.1:80",
+			xff:         []string{"1.2.3.4"},
+			trustedHops: 3,
+			want:        "1.2.3.4",
+		},
+		{
+			name:        "invalid forwarded value falls back to remote address",
+			remoteAddr:  "10.0.0.1:80",
+			xff:         []string{"not-an-ip"},
+			trustedHops: 1,
+			want:        "10.0.0.1",
+		},
+		{
+			name:        "missing header falls back to remote address",
+			remoteAddr:  "10.0.0.1:80",
+			trustedHops: 1,
+			want:        "10.0.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+
+			if got := FromRequest(r, tt.trustedHops); got != tt.want {
+				t.Errorf("FromRequest() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolverTrustedProxies(t *testing.T) {
+	resolver := NewResolver(0, []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8:ffff::/48"),
+	})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        []string
+		realIP     string
+		want       string
+	}{
+		{
+			name:       "untrusted remote ignores forwarded header",
+			remoteAddr: "203.0.113.9:5555",
+			xff:        []string{"1.2.3.4"},
+			realIP:     "5.6.7.8",
+			want:       "203.0.113.9",
+		},
+		{
+			name:       "trusted remote uses forwarded client",
+			remoteAddr: "10.0.0.1:80",
+			xff:        []string{"1.2.3.4"},
+			want:       "1.2.3.4",
+		},
+		{
+			name:       "spoofed entries left of the client are ignored",
+			remoteAddr: "10.0.0.1:80",
+			xff:        []string{"6.6.6.6, 1.2.3.4", "10.0.0.2"},
+			want:       "1.2.3.4",
+		},
+		{
+			name:       "trusted IPv6 proxy",
+			remoteAddr: "[2001:db8:ffff::1]:443",
+			xff:        []string{"2001:db8::5"},
+			want:       "2001:db8::5",
+		},
+		{
+			name:       "IPv4 mapped remote address",
+			remoteAddr: "[::ffff:10.0.0.1]:80",
+			xff:        []string{"1.2.3.4"},
+			want:       "1.2.3.4",
+		},
+		{
+			name:       "only proxies uses the leftmost",
+			remoteAddr: "10.0.0.1:80",
+			xff:        []string{"10.0.0.3, 10.0.0.2"},
+			want:       "10.0.0.3",
+		},
+		{
+			name:       "malformed entry stops the walk",
+			remoteAddr: "10.0.0.1:80",
+			xff:        []string{"1.2.3.4, not-an-ip, 10.0.0.2"},
+			want:       "10.0.0.2",
+		},
+		{
+			name:       "real IP header without forwarded header",
+			remoteAddr: "10.0.0.1:80",
+			realIP:     "1.2.3.4",
+			want:       "1.2.3.4",
+		},
+		{
+			name:       "no headers falls back to remote address",
+			remoteAddr: "10.0.0.1:80",
+			want:       "10.0.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			if got := resolver.FromRequest(r); got != tt.want {
+				t.Errorf("FromRequest() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolverWithoutProxies(t *testing.T) {
+	r, _ := http.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:80"
+	r.Header.Set("X-Forwarded-For", "6.6.6.6, 1.2.3.4")
+
+	if got := NewResolver(1, nil).FromRequest(r); got != "1.2.3.4" {
+		t.Errorf("hop based FromRequest() = %q, want 1.2.3.4", got)
+	}
+
+	var nilResolver *Resolver
+	if got := nilResolver.FromRequest(r); got != "10.0.0.1" {
+		t.Errorf("nil resolver FromRequest() = %q, want the remote address", got)
+	}
+}
+
+func TestAnonymize(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"192.168.1.10", "192.168.1.0"},
+		{"2001:db8:abcd:12:1:2:3:4", "2001:db8:abcd::"},
+		{"::ffff:10.1.2.3", "10.1.2.0"},
+		{"unknown", "unknown"},
+	}
+
+	for _, tt := range tests {
+		if got := Anonymize(tt.ip); got != tt.want {
+			t.Errorf("Anonymize(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestForStorage(t *testing.T) {
+	if got := ForStorage("203.0.113.7", "full", "secret"); got != "203.0.113.7" {
+		t.Errorf("full mode = %q, want the original IP", got)
+	}
+
+	if got := ForStorage("203.0.113.7", "truncate", "secret"); got != "203.0.113.0" {
+		t.Errorf("truncate mode = %q, want 203.0.113.0", got)
+	}
+
+	hashed := ForStorage("203.0.113.7", "hash", "secret")
+	if hashed == "203.0.113.7" || len(hashed) != 64 {
+		t.Errorf("hash mode = %q, want a 64 character hex digest", hashed)
+	}
+	if again := ForStorage("203.0.113.7", "hash", "secret"); again != hashed {
+		t.Errorf("hash mode is not deterministic: %q != %q", again, hashed)
+	}
+	if other := ForStorage("203.0.113.8", "hash", "secret"); other == hashed {
+		t.Error("hash mode returned the same digest for different IPs")
+	}
+	if rekeyed := ForStorage("203.0.113.7", "hash", "other"); rekeyed == hashed {
+		t.Error("hash mode ignores the secret")
+	}
+}
@@ -0,0 +1,65 @@
+// Package cursor encodes positions in lists ordered by creation time for keyset pagination.
+package cursor
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalid is returned for cursors that weren't created by Cursor.String
+var ErrInvalid = errors.New("invalid cursor")
+
+// QueryParam is the query parameter carrying the cursor of the next page
+const QueryParam = "cursor"
+
+// Cursor is the position after the last item of a page. The ID breaks ties between items
+// created at the same time, so no item is skipped or repeated when the list changes.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// New returns the cursor of an item
+func New(createdAt time.Time, id uuid.UUID) *Cursor {
+	return &Cursor{CreatedAt: createdAt, ID: id}
+}
+
+// String encodes the cursor for URLs. Postgres stores microseconds, finer time is dropped.
+func (c *Cursor) String() string {
+	buf := make([]byte, 8, 8+len(c.ID))
+	binary.BigEndian.PutUint64(buf, uint64(c.CreatedAt.UnixMicro()))
+	return base64.RawURLEncoding.EncodeToString(append(buf, c.ID[:]...))
+}
+
+// Parse decodes a cursor returned by String
+func Parse(value string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(raw) != 8+len(uuid.UUID{}) {
+		return nil, ErrInvalid
+	}
+
+	id, err := uuid.FromBytes(raw[8:])
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	return New(time.UnixMicro(int64(binary.BigEndian.Uint64(raw[:8]))), id), nil
+}
+
+// FromRequest reads the cursor query parameter. requested is false without the parameter, an empty
+// value asks for the first page of cursor pagination and returns a nil cursor.
+func FromRequest(r *http.Request) (c *Cursor, requested bool, err error) {
+	query := r.URL.Query()
+	if !query.Has(QueryParam) {
+		return nil, false, nil
+	}
+	if query.Get(QueryParam) == "" {
+		return nil, true, nil
+	}
+	c, err = Parse(query.Get(QueryParam))
+	return c, true, err
+}
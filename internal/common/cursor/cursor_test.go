@@ -0,0 +1,52 @@
+package cursor
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestParse(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.UTC)
+	c := New(created, uuid.New())
+
+	got, err := Parse(c.String())
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got.ID != c.ID || !got.CreatedAt.Equal(created.Truncate(time.Microsecond)) {
+		t.Errorf("Parse() = %v %v, want %v %v", got.CreatedAt, got.ID, created, c.ID)
+	}
+
+	for _, value := range []string{"not base64!", "c2hvcnQ", c.String() + "AA"} {
+		if _, err := Parse(value); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Parse(%q) error = %v, want ErrInvalid", value, err)
+		}
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	valid := New(time.Now(), uuid.New()).String()
+
+	tests := []struct {
+		query         string
+		wantCursor    bool
+		wantRequested bool
+		wantErr       bool
+	}{
+		{query: ""},
+		{query: "?page=2"},
+		{query: "?cursor=", wantRequested: true},
+		{query: "?cursor=" + valid, wantCursor: true, wantRequested: true},
+		{query: "?cursor=garbage", wantRequested: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		c, requested, err := FromRequest(httptest.NewRequest("GET", "/api/v1/files"+tt.query, nil))
+		if (c != nil) != tt.wantCursor || requested != tt.wantRequested || (err != nil) != tt.wantErr {
+			t.Errorf("FromRequest(%q) = %v, %v, %v", tt.query, c, requested, err)
+		}
+	}
+}
@@ -21,10 +21,22 @@ type UploadedFile struct {
 	CreatedAt      time.Time  `db:"created_at" json:"created_at"`                       // Timestamp when the file was uploaded
 	LastAccessedAt *time.Time `db:"last_accessed_at" json:"last_accessed_at,omitempty"` // Timestamp when the file was last accessed
 	AccessCount    int        `db:"access_count" json:"access_count"`                   // Number of times the file has been accessed
-	ExpiresAt      time.Time  `db:"expires_at" json:"expires_at"`                       // Timestamp when the file will expire
+	ExpiresAt      *time.Time `db:"expires_at" json:"expires_at"`                       // Timestamp when the file will expire, nil never expires
 	URLValue       string     `db:"url_value" json:"url_value"`                         // URL value associated with the uploaded file
+	ForceDownload  bool       `db:"force_download" json:"force_download"`               // Always serve the file as an attachment
+	Visibility     string     `db:"visibility" json:"visibility"`                       // FileVisibilityPublic or FileVisibilityPrivate
+	StorageMissing bool       `db:"storage_missing" json:"storage_missing"`             // The storage verification found no object for the file
+	FolderID       *uuid.UUID `db:"folder_id" json:"folder_id,omitempty"`               // Folder the file is filed in, nil at the top level
+
+	OwnerForceDownload bool `db:"owner_force_download" json:"-"` // The owner serves all of their files as attachments, only loaded for single files
 }
 
+// Visibilities of uploaded files
+const (
+	FileVisibilityPublic  = "public"  // Served to anyone who knows the URL
+	FileVisibilityPrivate = "private" // Served only to the owner's session and through signed links
+)
+
 type CreateFileResponse struct {
 	FileUrl      string `json:"file_url"`
 	OriginalName string `json:"original_name"`
@@ -42,17 +54,32 @@ type APIToken struct {
 	ExpiresAt  *time.Time `db:"expires_at" json:"expires_at,omitempty"`     // Timestamp when the API token will expire
 	RevokedAt  *time.Time `db:"revoked_at" json:"revoked_at,omitempty"`     // Timestamp when the API token was revoked
 	IsActive   bool       `db:"is_active" json:"is_active"`                 // Indicates whether the API token is active
+	RateLimit  *int       `db:"rate_limit" json:"rate_limit,omitempty"`     // Requests per minute allowed for the token, nil uses the default
+}
+
+// TokenUsage is an audit entry of a single request authenticated with an API token
+type TokenUsage struct {
+	ID        uuid.UUID `db:"id" json:"id"`
+	TokenID   uuid.UUID `db:"token_id" json:"token_id"`
+	UsedAt    time.Time `db:"used_at" json:"used_at"`
+	IPAddress string    `db:"ip_address" json:"ip_address"`
+	Endpoint  string    `db:"endpoint" json:"endpoint"` // Method and path of the request, e.g. "POST /api/v1/upload"
+	Status    int       `db:"status" json:"status"`     // HTTP status of the response
 }
 
 // User represents a user in the system
 type User struct {
-	ID           uuid.UUID `db:"id" json:"id"`
-	Email        string    `db:"email" json:"email"`
-	Username     string    `db:"username" json:"username"`
-	PasswordHash string    `db:"password_hash" json:"-"`
-	IsActive     bool      `db:"is_active" json:"is_active"`
-	CreatedAt    time.Time `db:"created_at" json:"created_at"`
-	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+	ID            uuid.UUID `db:"id" json:"id"`
+	Email         string    `db:"email" json:"email"`
+	Username      string    `db:"username" json:"username"`
+	PasswordHash  string    `db:"password_hash" json:"-"`
+	IsActive      bool      `db:"is_active" json:"is_active"`
+	EmailVerified bool      `db:"email_verified" json:"email_verified"`
+	PendingEmail  *string   `db:"pending_email" json:"pending_email,omitempty"` // New address waiting for verification
+	ForceDownload bool      `db:"force_download" json:"force_download"`         // Serve all of the user's files as attachments
+	AvatarKey     *string   `db:"avatar_key" json:"-"`                          // Storage object of the profile picture, nil without one
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt     time.Time `db:"updated_at" json:"updated_at"`
 }
 
 // ShortenedURL represents a shortened URL in the system
@@ -67,6 +94,46 @@ type ShortenedURL struct {
 	AccessCount    int        `db:"access_count" json:"access_count"`
 	IsVanity       bool       `db:"is_vanity" json:"is_vanity"`
 	IsActive       bool       `db:"is_active" json:"is_active"`
+	Title          string     `db:"title" json:"title,omitempty"`
+	Description    string     `db:"description" json:"description,omitempty"`
+	FaviconURL     string     `db:"favicon_url" json:"favicon_url,omitempty"`
+	TrackAnalytics bool       `db:"track_analytics" json:"track_analytics"`
+	DeletedAt      *time.Time `db:"deleted_at" json:"-"`                  // Set by deletion, inactive URLs are only paused
+	Type           string     `db:"url_type" json:"type"`                 // URLTypeRedirect or URLTypePage
+	DomainID       *uuid.UUID `db:"domain_id" json:"domain_id,omitempty"` // Custom domain the code belongs to, nil for the default domain
+	Domain         string     `db:"domain" json:"domain,omitempty"`       // Name of the custom domain, only set by URL lists
+}
+
+// Types of shortened URLs
+const (
+	URLTypeRedirect = "redirect" // Redirects to the original URL
+	URLTypePage     = "page"     // Shows a landing page with the links of the page, the original URL is empty
+)
+
+// CustomDomain is a branded domain of a user that short links can be served on. It can only
+// be used once VerifiedAt is set.
+type CustomDomain struct {
+	ID                uuid.UUID  `db:"id" json:"id"`
+	UserID            uuid.UUID  `db:"user_id" json:"user_id"`
+	Domain            string     `db:"domain" json:"domain"`
+	VerificationToken string     `db:"verification_token" json:"verification_token"`
+	VerifiedAt        *time.Time `db:"verified_at" json:"verified_at,omitempty"`
+	CreatedAt         time.Time  `db:"created_at" json:"created_at"`
+}
+
+// PageLink is one destination listed on a link page
+type PageLink struct {
+	ID       uuid.UUID `db:"id" json:"id"`
+	PageID   uuid.UUID `db:"page_id" json:"-"`
+	Position int       `db:"position" json:"position"`
+	Title    string    `db:"title" json:"title"`
+	URL      string    `db:"url" json:"url"`
+}
+
+// LinkPage is a shortened URL of the page type together with its links in display order
+type LinkPage struct {
+	URL   *ShortenedURL `json:"url"`
+	Links []*PageLink   `json:"links"`
 }
 
 // ClickAnalytics represents a single click event
@@ -84,12 +151,15 @@ type ClickAnalytics struct {
 
 // URLAnalytics represents analytics for a shortened URL
 type URLAnalytics struct {
-	URL          *ShortenedURL   `json:"url"`
-	TotalClicks  int             `json:"total_clicks"`
-	UniqueClicks int             `json:"unique_clicks"`
-	TopReferrers []ReferrerStats `json:"top_referrers"`
-	TopCountries []CountryStats  `json:"top_countries"`
-	ClicksByDay  []ClicksByDay   `json:"clicks_by_day"`
+	URL            *ShortenedURL   `json:"url"`
+	TotalClicks    int             `json:"total_clicks"`
+	UniqueClicks   int             `json:"unique_clicks"`   // Visits, repeat clicks of a visitor within the unique window count once
+	UniqueVisitors int             `json:"unique_visitors"` // Distinct IP and user agent combinations
+	TopReferrers   []ReferrerStats `json:"top_referrers"`
+	TopCountries   []CountryStats  `json:"top_countries"`
+	ClicksByDay    []ClicksByDay   `json:"clicks_by_day"`
+
+	VisitorsApproximate bool `json:"unique_visitors_approximate"` // Rolled up days are included, visitors returning on several of them count more than once
 }
 
 // ReferrerStats represents statistics for referrers
@@ -110,6 +180,25 @@ type ClicksByDay struct {
 	Count int       `json:"count" db:"count"`
 }
 
+// FileAccess is a single download of an uploaded file
+type FileAccess struct {
+	ID         uuid.UUID `db:"id" json:"id"`
+	FileID     uuid.UUID `db:"file_id" json:"file_id"`
+	AccessedAt time.Time `db:"accessed_at" json:"accessed_at"`
+	Referrer   string    `db:"referrer" json:"referrer"`
+	UserAgent  string    `db:"user_agent" json:"user_agent"`
+	IPAddress  string    `db:"ip_address" json:"ip_address"` // Stored according to the analytics IP mode
+}
+
+// FileAnalytics represents the download history of an uploaded file
+type FileAnalytics struct {
+	File           *UploadedFile   `json:"file"`
+	TotalAccesses  int             `json:"total_accesses"`
+	UniqueVisitors int             `json:"unique_visitors"` // Distinct IP and user agent combinations
+	TopReferrers   []ReferrerStats `json:"top_referrers"`
+	AccessesByDay  []ClicksByDay   `json:"accesses_by_day"`
+}
+
 // RequestInfo contains information about the incoming request for analytics
 type RequestInfo struct {
 	Referrer    string
@@ -125,24 +214,175 @@ type CreateURLRequest struct {
 	URL        string     `json:"url" validate:"required,url"`
 	VanityCode string     `json:"vanity_code,omitempty" validate:"omitempty,vanitycode"`
 	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	// TrackAnalytics records clicks of the URL, defaults to true when omitted
+	TrackAnalytics *bool `json:"track_analytics,omitempty"`
+	// Domain is one of the user's verified custom domains, the default domain is used when omitted
+	Domain string `json:"domain,omitempty" validate:"max=253"`
+}
+
+// AddDomainRequest represents the request to add a custom domain
+type AddDomainRequest struct {
+	Domain string `json:"domain" validate:"required,max=253"`
+}
+
+// PageLinkInput is a link of a page in a create or update request
+type PageLinkInput struct {
+	Title string `json:"title" validate:"required,max=100"`
+	URL   string `json:"url" validate:"required,url"`
+}
+
+// CreatePageRequest represents the request to create a link page under a vanity code, a page lists at most 50 links
+type CreatePageRequest struct {
+	VanityCode  string          `json:"vanity_code" validate:"required,vanitycode"`
+	Title       string          `json:"title" validate:"required,max=100"`
+	Description string          `json:"description,omitempty" validate:"max=500"`
+	Links       []PageLinkInput `json:"links" validate:"required,min=1,max=50,dive"`
+	ExpiresAt   *time.Time      `json:"expires_at,omitempty"`
+}
+
+// UpdatePageRequest replaces the title, description and links of a link page
+type UpdatePageRequest struct {
+	Title       string          `json:"title" validate:"required,max=100"`
+	Description string          `json:"description,omitempty" validate:"max=500"`
+	Links       []PageLinkInput `json:"links" validate:"required,min=1,max=50,dive"`
+}
+
+// RegenerateCodeRequest gives a URL a new short code, the old one keeps redirecting for GraceHours
+type RegenerateCodeRequest struct {
+	GraceHours int `json:"grace_hours,omitempty"`
 }
 
 // CreateURLResponse represents the response after creating a shortened URL
 type CreateURLResponse struct {
-	ShortURL    string     `json:"short_url"`
-	OriginalURL string     `json:"original_url"`
-	ShortCode   string     `json:"short_code"`
-	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
-	IsVanity    bool       `json:"is_vanity"`
+	ID           uuid.UUID  `json:"id"`
+	ShortURL     string     `json:"short_url"`
+	OriginalURL  string     `json:"original_url,omitempty"`
+	ShortCode    string     `json:"short_code"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	IsVanity     bool       `json:"is_vanity"`
+	QRURL        string     `json:"qr_url"`        // Image of a QR code pointing to the short URL
+	AnalyticsURL string     `json:"analytics_url"` // API resource returning the URL with its click analytics
+}
+
+// MaxBulkDeleteIDs is the largest number of items a single bulk delete may contain
+const MaxBulkDeleteIDs = 100
+
+// BulkDeleteRequest represents a request to delete several URLs or files at once
+type BulkDeleteRequest struct {
+	IDs []uuid.UUID `json:"ids"`
+}
+
+// BulkDeleteResult is the outcome of deleting a single item of a bulk delete
+type BulkDeleteResult struct {
+	ID      uuid.UUID `json:"id"`
+	Success bool      `json:"success"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// BulkDeleteResponse represents the response of a bulk delete
+type BulkDeleteResponse struct {
+	Deleted int                `json:"deleted"`
+	Results []BulkDeleteResult `json:"results"`
+}
+
+// Folder groups files of a user, folders without a parent are at the top level
+type Folder struct {
+	ID        uuid.UUID  `db:"id" json:"id"`
+	UserID    uuid.UUID  `db:"user_id" json:"-"`
+	ParentID  *uuid.UUID `db:"parent_id" json:"parent_id"`
+	Name      string     `db:"name" json:"name"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+}
+
+// FolderPath is a folder with the names of its ancestors, e.g. "Photos / 2024"
+type FolderPath struct {
+	ID   uuid.UUID
+	Path string
+}
+
+// FolderRequest creates or renames a folder, parent_id is only read when creating one. IDs are
+// strings as the web interface sends an empty value for the top level.
+type FolderRequest struct {
+	Name     string `json:"name"`
+	ParentID string `json:"parent_id"`
+}
+
+// MaxMoveFileIDs is the largest number of files a single move may contain
+const MaxMoveFileIDs = 100
+
+// MoveFilesRequest moves files into a folder, an empty folder_id moves them to the top level
+type MoveFilesRequest struct {
+	IDs      []uuid.UUID `json:"ids"`
+	FolderID string      `json:"folder_id"`
+}
+
+// MoveFilesResponse reports how many of the requested files were moved, files of other users
+// and unknown IDs are skipped
+type MoveFilesResponse struct {
+	Moved int64 `json:"moved"`
 }
 
 // FileStats represents statistics about uploaded files
 type FileStats struct {
-	TotalFiles   int      `db:"total_files"`   // Total number of files uploaded
-	TotalSize    int64    `db:"total_size"`    // Total size of all files in bytes
-	TotalViews   int64    `db:"total_views"`   // Total number of views
-	StorageQuota int64    `db:"storage_quota"` // User's storage quota in bytes
-	PopularTypes []string `db:"popular_types"` // Most common file types
+	TotalFiles       int      `db:"total_files" json:"total_files"`     // Total number of files uploaded
+	TotalSize        int64    `db:"total_size" json:"used"`             // Total size of all files in bytes
+	TotalViews       int64    `db:"total_views" json:"total_views"`     // Total number of views
+	StorageQuota     int64    `db:"storage_quota" json:"quota"`         // User's storage quota in bytes
+	StorageRemaining int64    `db:"-" json:"remaining"`                 // Bytes left of the quota, never negative
+	PopularTypes     []string `db:"popular_types" json:"popular_types"` // Most common file types
+}
+
+// StorageReport summarizes storage usage and the drift between storage and database
+type StorageReport struct {
+	GeneratedAt     time.Time          `json:"generated_at"`
+	TotalFiles      int                `json:"total_files"`
+	TotalSize       int64              `json:"total_size"`
+	Users           []UserStorageUsage `json:"users"`
+	OrphanedObjects []StorageObject    `json:"orphaned_objects"` // Objects in storage without a database record
+	OrphanedSize    int64              `json:"orphaned_size"`
+	MissingObjects  []*UploadedFile    `json:"missing_objects"` // Database records whose object is missing in storage
+	ExpiringSoon    []*UploadedFile    `json:"expiring_soon"`   // Files expiring within the report window
+}
+
+// StorageSyncResult lists what a storage sync deleted, or would delete in a dry run
+type StorageSyncResult struct {
+	DryRun          bool            `json:"dry_run"`
+	OrphanedObjects []StorageObject `json:"orphaned_objects"` // Objects in storage without a database record
+	MissingObjects  []*UploadedFile `json:"missing_objects"`  // Database records whose object is missing in storage
+	Failed          int             `json:"failed"`           // Deletions that failed, always 0 in a dry run
+}
+
+// StorageVerifyResult lists the file records whose object is missing in storage
+type StorageVerifyResult struct {
+	Missing  []*UploadedFile `json:"missing"`  // Records whose object is missing, they are flagged as storage_missing
+	Flagged  int             `json:"flagged"`  // Records newly flagged by this verification
+	Restored int             `json:"restored"` // Flagged records whose object is back in storage
+	Failed   int             `json:"failed"`   // Records that couldn't be checked or updated, their flag is unchanged
+}
+
+// UserStorageUsage is the storage used by the files of a single user
+type UserStorageUsage struct {
+	UserID    uuid.UUID `db:"user_id" json:"user_id"`
+	Username  string    `db:"username" json:"username"`
+	FileCount int       `db:"file_count" json:"file_count"`
+	TotalSize int64     `db:"total_size" json:"total_size"`
+}
+
+// PendingDeletion is the object of a deleted file whose removal from storage failed, it is retried
+// by the cleanup worker
+type PendingDeletion struct {
+	Filename      string    `db:"filename" json:"filename"`
+	Attempts      int       `db:"attempts" json:"attempts"`
+	LastError     string    `db:"last_error" json:"last_error"`
+	NextAttemptAt time.Time `db:"next_attempt_at" json:"next_attempt_at"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+}
+
+// StorageObject describes an object in the storage backend
+type StorageObject struct {
+	Name         string    `json:"name"`
+	Size         int64     `json:"size"`
+	ModifiedTime time.Time `json:"modified_time"`
 }
 
 // DashboardStats represents the statistics shown on the dashboard
@@ -155,6 +395,12 @@ type DashboardStats struct {
 	RecentFiles  []RecentFile `json:"recent_files"`
 }
 
+// RecentItems represents the most recently created URLs and files of a user
+type RecentItems struct {
+	URLs  []RecentURL  `json:"urls"`
+	Files []RecentFile `json:"files"`
+}
+
 // RecentURL represents a recently created shortened URL
 type RecentURL struct {
 	ShortCode   string `json:"short_code" db:"short_code"`
@@ -0,0 +1,44 @@
+// Package reserved lists path segments that short codes and file URLs must not use,
+// so links never shadow application routes or look like static assets.
+package reserved
+
+import "strings"
+
+// words are the top level routes of the application
+var words = []string{
+	"login", "logout", "register", "health", "dashboard", "settings",
+	"files", "upload", "url-shortener", "auth", "f", "d", "s",
+}
+
+// rootFiles are requested at the root by browsers and crawlers
+var rootFiles = []string{
+	"favicon.ico", "robots.txt", "sitemap.xml", "apple-touch-icon.png",
+	"apple-touch-icon-precomposed.png", "manifest.json", "site.webmanifest",
+}
+
+// prefixes are route trees, reserved along with every path below them
+var prefixes = []string{
+	"api", "admin", "assets", "static", ".well-known",
+}
+
+// IsReserved reports whether a code is a reserved word or file, or a reserved route tree or a path
+// in it, ignoring case. Only whole path segments match, so "apidocs" is not reserved.
+func IsReserved(code string) bool {
+	code = strings.ToLower(code)
+	for _, word := range words {
+		if code == word {
+			return true
+		}
+	}
+	for _, file := range rootFiles {
+		if code == file {
+			return true
+		}
+	}
+	for _, prefix := range prefixes {
+		if code == prefix || strings.HasPrefix(code, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
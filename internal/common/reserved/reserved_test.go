@@ -0,0 +1,37 @@
+package reserved
+
+import "testing"
+
+func TestIsReserved(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{"login", true},
+		{"Settings", true},
+		{"url-shortener", true},
+		{"s", true},
+		{"api", true},
+		{"API/v1", true},
+		{"assets", true},
+		{"assets/css/output.css", true},
+		{"favicon.ico", true},
+		{"robots.txt", true},
+		{".well-known", true},
+		{"API-docs", false},
+		{"apidocs", false},
+		{"assetsy", false},
+		{"logins", false},
+		{"abc123", false},
+		{"my-files", false},
+		{"xapi", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			if got := IsReserved(tt.code); got != tt.want {
+				t.Errorf("IsReserved(%q) = %v, want %v", tt.code, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,9 @@ package config
 
 import (
 	"fmt"
+	"mime"
+	"net/netip"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -12,24 +15,168 @@ import (
 
 // Config holds server configuration
 type Config struct {
-	Port            int           // Port to listen on
-	Secret          string        // Secret key for JWT & api tokens
-	Env             string        // Environment (dev | prod)
-	BaseURL         string        // Base URL for the server
-	UploadMaxSize   int64         // Maximum upload size in bytes
-	UploadUserQuota int64         // Quota user is allowed to upload in bytes
-	UploadExpiresIn time.Duration // Upload expiration time in hours
+	Port            int               // Port to listen on
+	Secret          string            // Secret key for JWT & api tokens
+	Env             string            // Environment (dev | prod)
+	BaseURL         string            // Base URL for the server, including the base path
+	BasePath        string            // Path prefix the app is served under behind a reverse proxy, e.g. /volaticus
+	UploadMaxSize   int64             // Maximum upload size in bytes
+	UploadMaxFiles  int               // Files a single upload request may carry
+	UploadUserQuota int64             // Quota user is allowed to upload in bytes
+	MaxBodySize     int64             // Largest request body accepted by routes other than uploads
+	RequestTimeout  time.Duration     // Longest a request may take, routes streaming files are exempt (0 disables)
+	MaxUserFiles    int               // Files a user may have at once, 0 is unlimited
+	UploadsPerUser  int               // Uploads a user may send at the same time, 0 is unlimited
+	UploadExpiresIn time.Duration     // Upload expiration time in hours
+	UploadMaxExpiry time.Duration     // Longest expiration a user can choose for an upload, 0 allows never expiring uploads
+	UploadNaming    string            // How stored upload objects are named (timestamp | uuid | hash)
+	FilenameMaxLen  int               // Longest original filename kept for an upload in characters, longer ones are shortened
+	FolderDeletion  string            // What deleting a folder with files or folders in it does (block | reparent)
+	ImageMaxPixels  int64             // Largest width times height of uploaded images, 0 accepts any size
+	SandboxTypes    []string          // MIME types that are always served as sandboxed attachments
+	MIMEOverrides   map[string]string // Content types of extensions, used when sniffing only finds plain text or binary
+	ForceDownload   bool              // Serve every file as an attachment instead of rendering it in the browser
+	FileCacheMaxAge time.Duration     // How long browsers and proxies may cache public files, 0 makes them revalidate
+	APIRateLimit    int               // Default requests per minute allowed per API token
+	IdempotencyTTL  time.Duration     // How long responses of API requests with an Idempotency-Key are replayed
+	FetchMetadata   bool              // Fetch link previews for shortened URLs
+	URLBlocklist    []string          // Domains that can't be shortened, their subdomains included
+	SafeBrowsingKey string            // Google Safe Browsing API key to look up destinations (empty disables the lookup)
+	URLhausKey      string            // URLhaus auth key to look up destinations (empty disables the lookup)
+	BlockPrivateIPs bool              // Reject destinations resolving to loopback, private or link-local addresses
+	CustomDomains   bool              // Let users serve short links on their own verified domains
+	GeoIPDBPath     string            // Path to the MaxMind GeoLite2 City database
+	GeoIPReload     time.Duration     // Interval to check the GeoIP database for updates, 0 disables reloading
+	TrustProxyHops  int               // Number of reverse proxies whose X-Forwarded-For entries are trusted
+	TrustedProxies  []netip.Prefix    // Networks of reverse proxies allowed to set X-Forwarded-For, replaces TrustProxyHops when set
+	RequestIDHeader string            // Header request IDs are read from and returned in, e.g. to reuse the ID of a proxy
+	AnalyticsIPMode string            // How visitor IPs are stored in analytics and token usage (full | truncate | hash)
+	RetentionDays   int               // Days click analytics and file downloads are kept, 0 keeps them forever
+	RollupDays      int               // Days raw clicks are kept before they are rolled up into daily counts, 0 keeps them raw
+	UniqueWindow    time.Duration     // Repeat clicks of a visitor (IP and user agent) within this window count as one unique click
+	ClickBatchSize  int               // Clicks buffered before they are written in one transaction, 0 writes every click on its own
+	ClickFlushEvery time.Duration     // Longest time buffered clicks wait before they are written
+	ShortCodeLen    int               // Length of generated short codes
+	ShortCodeChars  string            // Characters generated short codes are made of
+	ShortCodeTries  int               // Attempts to generate an unused short code before giving up
+	MaxUserURLs     int               // Short URLs a user may have at once, 0 is unlimited
+	URLMaxExpiry    time.Duration     // Longest a short URL may stay valid, later expirations are clamped to it (0 is unlimited)
+	PageSize        int               // Items per page of file and short URL lists unless limit is given
+	MaxPageSize     int               // Largest page size the limit query parameter may ask for
+	StatsCacheTTL   time.Duration     // How long dashboard totals are cached and refreshed in the background, 0 computes them on every load
+	ClamAVAddress   string            // clamd address for virus scanning uploads, e.g. localhost:3310 (empty disables scanning)
+	ClamAVTimeout   time.Duration     // Maximum time a virus scan may take
+	AdminUsers      []string          // User IDs or exact usernames allowed to access the admin endpoints
+	SyncDeletes     bool              // Let the periodic storage sync delete orphans instead of only reporting them
+	SMTPHost        string            // SMTP server for outgoing emails (empty logs emails instead of sending them)
+	SMTPPort        int               // Port of the SMTP server
+	SMTPUsername    string            // SMTP username, empty disables authentication
+	SMTPPassword    string            // SMTP password
+	MailFrom        string            // Sender address of outgoing emails
+	VerifyEmail     bool              // Refuse logins until the user has verified their email address
+	LoginAttempts   int               // Failed logins of a username from one IP before it is locked, 0 disables the lockout
+	LoginLockout    time.Duration     // How long logins are refused after too many failed attempts
+	PasswordScheme  string            // Hashing scheme for new passwords (bcrypt | argon2), older hashes are upgraded on login
+	BcryptCost      int               // Cost of new bcrypt password hashes
+	CookieSecure    bool              // Always mark the session cookie Secure, needed behind proxies terminating TLS
+	CookieSameSite  string            // SameSite mode of the session cookie (strict | lax)
+	CookieDomain    string            // Domain of the session cookie to share it with subdomains, empty for the host only
 	Storage         StorageConfig
 }
 
+// defaultShortCodeAlphabet is used for generated short codes unless SHORT_CODE_ALPHABET is set
+const defaultShortCodeAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// ambiguousChars are easily confused when a short code is read or typed by hand
+const ambiguousChars = "0O1lI"
+
+// defaultSandboxTypes are MIME types that can execute script when rendered inline
+var defaultSandboxTypes = []string{"text/html", "image/svg+xml", "application/xhtml+xml"}
+
+// defaultMIMEOverrides are types of common text formats that content sniffing reports as plain
+// text and minimal containers have no mime.types entry for, UPLOAD_MIME_TYPES adds to them
+var defaultMIMEOverrides = map[string]string{
+	".md":       "text/markdown; charset=utf-8",
+	".markdown": "text/markdown; charset=utf-8",
+	".csv":      "text/csv; charset=utf-8",
+	".tsv":      "text/tab-separated-values; charset=utf-8",
+	".json":     "application/json",
+	".yaml":     "application/yaml",
+	".yml":      "application/yaml",
+	".toml":     "application/toml",
+	".log":      "text/plain; charset=utf-8",
+	".go":       "text/x-go; charset=utf-8",
+	".py":       "text/x-python; charset=utf-8",
+	".rs":       "text/x-rust; charset=utf-8",
+	".sh":       "text/x-shellscript; charset=utf-8",
+}
+
 func (c *Config) Log() {
 	log.Info().
 		Int("port", c.Port).
 		Str("env", c.Env).
 		Str("base_url", c.BaseURL).
+		Str("base_path", c.BasePath).
 		Int64("upload_max_size", c.UploadMaxSize).
+		Int("upload_max_files", c.UploadMaxFiles).
 		Int64("upload_user_quota", c.UploadUserQuota).
+		Int64("max_body_size", c.MaxBodySize).
+		Dur("request_timeout", c.RequestTimeout).
+		Int("max_files_per_user", c.MaxUserFiles).
+		Int("max_concurrent_uploads", c.UploadsPerUser).
 		Dur("upload_expires_in", c.UploadExpiresIn).
+		Dur("upload_max_expiry", c.UploadMaxExpiry).
+		Str("upload_naming", c.UploadNaming).
+		Int("filename_max_len", c.FilenameMaxLen).
+		Str("folder_deletion", c.FolderDeletion).
+		Int64("image_max_pixels", c.ImageMaxPixels).
+		Strs("sandbox_types", c.SandboxTypes).
+		Interface("mime_overrides", c.MIMEOverrides).
+		Bool("force_download", c.ForceDownload).
+		Dur("file_cache_max_age", c.FileCacheMaxAge).
+		Int("api_rate_limit", c.APIRateLimit).
+		Dur("idempotency_ttl", c.IdempotencyTTL).
+		Bool("fetch_metadata", c.FetchMetadata).
+		Strs("url_blocklist", c.URLBlocklist).
+		Bool("safe_browsing", c.SafeBrowsingKey != "").
+		Bool("urlhaus", c.URLhausKey != "").
+		Bool("block_private_urls", c.BlockPrivateIPs).
+		Bool("custom_domains", c.CustomDomains).
+		Str("geoip_db_path", c.GeoIPDBPath).
+		Dur("geoip_reload", c.GeoIPReload).
+		Int("trust_proxy_hops", c.TrustProxyHops).
+		Interface("trusted_proxies", c.TrustedProxies).
+		Str("request_id_header", c.RequestIDHeader).
+		Str("analytics_ip_mode", c.AnalyticsIPMode).
+		Int("analytics_retention_days", c.RetentionDays).
+		Int("analytics_rollup_days", c.RollupDays).
+		Dur("analytics_unique_window", c.UniqueWindow).
+		Int("click_batch_size", c.ClickBatchSize).
+		Dur("click_flush_interval", c.ClickFlushEvery).
+		Int("short_code_length", c.ShortCodeLen).
+		Str("short_code_alphabet", c.ShortCodeChars).
+		Int("short_code_retries", c.ShortCodeTries).
+		Int("max_urls_per_user", c.MaxUserURLs).
+		Dur("url_max_expiry", c.URLMaxExpiry).
+		Int("page_size", c.PageSize).
+		Int("max_page_size", c.MaxPageSize).
+		Dur("dashboard_stats_cache_ttl", c.StatsCacheTTL).
+		Str("clamav_address", c.ClamAVAddress).
+		Dur("clamav_timeout", c.ClamAVTimeout).
+		Strs("admin_users", c.AdminUsers).
+		Bool("storage_sync_delete", c.SyncDeletes).
+		Str("smtp_host", c.SMTPHost).
+		Int("smtp_port", c.SMTPPort).
+		Str("smtp_username", c.SMTPUsername).
+		Str("mail_from", c.MailFrom).
+		Bool("email_verification_required", c.VerifyEmail).
+		Int("login_max_attempts", c.LoginAttempts).
+		Dur("login_lockout_duration", c.LoginLockout).
+		Str("password_hash", c.PasswordScheme).
+		Int("bcrypt_cost", c.BcryptCost).
+		Bool("cookie_secure", c.CookieSecure).
+		Str("cookie_samesite", c.CookieSameSite).
+		Str("cookie_domain", c.CookieDomain).
 		Msg("server configuration")
 }
 
@@ -38,11 +185,14 @@ type StorageConfig struct {
 	Provider string `json:"provider"`
 
 	// Local storage config
-	LocalPath string `json:"local_path,omitempty"`
+	LocalPath  string `json:"local_path,omitempty"`
+	ShardDepth int    `json:"shard_depth,omitempty"` // Nested directory levels of two filename characters each, 0 stores files flat
 
 	// GCS config
-	ProjectID  string `json:"project_id,omitempty"`
-	BucketName string `json:"bucket_name,omitempty"`
+	ProjectID     string `json:"project_id,omitempty"`
+	BucketName    string `json:"bucket_name,omitempty"`
+	PublicObjects bool   `json:"public_objects,omitempty"` // Let public files that never expire be read from the bucket and redirect downloads to them
+	PublicURL     string `json:"public_url,omitempty"`     // Base URL of the public objects, e.g. a CDN in front of the bucket
 }
 
 // NewConfig creates a server configuration from environment variables
@@ -69,6 +219,23 @@ func NewConfig() (*Config, error) {
 		baseURL = "http://localhost"
 	}
 
+	basePath := strings.TrimSuffix(os.Getenv("BASE_PATH"), "/")
+	if basePath != "" {
+		if !strings.HasPrefix(basePath, "/") {
+			basePath = "/" + basePath
+		}
+		if strings.ContainsAny(basePath, "?# ") {
+			log.Error().Str("base_path", basePath).Msg("invalid BASE_PATH environment variable")
+			return nil, fmt.Errorf("invalid BASE_PATH: %s", basePath)
+		}
+
+		// Generated links must point below the base path
+		baseURL = strings.TrimSuffix(baseURL, "/")
+		if !strings.HasSuffix(baseURL, basePath) {
+			baseURL += basePath
+		}
+	}
+
 	uploadMaxSizeStr := os.Getenv("UPLOAD_MAX_SIZE")
 	if uploadMaxSizeStr == "" {
 		uploadMaxSizeStr = "25MB" // Default value
@@ -79,6 +246,15 @@ func NewConfig() (*Config, error) {
 		return nil, err
 	}
 
+	uploadMaxFiles := 10
+	if maxFilesStr := os.Getenv("UPLOAD_MAX_FILES"); maxFilesStr != "" {
+		uploadMaxFiles, err = strconv.Atoi(maxFilesStr)
+		if err != nil || uploadMaxFiles < 1 {
+			log.Error().Err(err).Msg("invalid UPLOAD_MAX_FILES environment variable")
+			return nil, fmt.Errorf("invalid UPLOAD_MAX_FILES: %s", maxFilesStr)
+		}
+	}
+
 	uploadUserQuotaStr := os.Getenv("UPLOAD_USER_MAX_SIZE")
 	if uploadUserQuotaStr == "" {
 		uploadUserQuotaStr = "100MB" // Default value
@@ -89,6 +265,43 @@ func NewConfig() (*Config, error) {
 		return nil, err
 	}
 
+	maxBodySizeStr := os.Getenv("MAX_REQUEST_BODY_SIZE")
+	if maxBodySizeStr == "" {
+		maxBodySizeStr = "1MB"
+	}
+	maxBodySize, err := parseUploadMaxSize(maxBodySizeStr)
+	if err != nil || maxBodySize <= 0 {
+		log.Error().Err(err).Msg("invalid MAX_REQUEST_BODY_SIZE environment variable")
+		return nil, fmt.Errorf("invalid MAX_REQUEST_BODY_SIZE: %s", maxBodySizeStr)
+	}
+
+	requestTimeout := 30 * time.Second
+	if timeoutStr := os.Getenv("REQUEST_TIMEOUT"); timeoutStr != "" {
+		requestTimeout, err = time.ParseDuration(timeoutStr)
+		if err != nil || requestTimeout < 0 {
+			log.Error().Err(err).Msg("invalid REQUEST_TIMEOUT environment variable")
+			return nil, fmt.Errorf("invalid REQUEST_TIMEOUT: %s", timeoutStr)
+		}
+	}
+
+	var maxUserFiles int
+	if maxFilesStr := os.Getenv("MAX_FILES_PER_USER"); maxFilesStr != "" {
+		maxUserFiles, err = strconv.Atoi(maxFilesStr)
+		if err != nil || maxUserFiles < 0 {
+			log.Error().Err(err).Msg("invalid MAX_FILES_PER_USER environment variable")
+			return nil, fmt.Errorf("invalid MAX_FILES_PER_USER: %s", maxFilesStr)
+		}
+	}
+
+	uploadsPerUser := 4
+	if uploadsStr := os.Getenv("MAX_CONCURRENT_UPLOADS"); uploadsStr != "" {
+		uploadsPerUser, err = strconv.Atoi(uploadsStr)
+		if err != nil || uploadsPerUser < 0 {
+			log.Error().Err(err).Msg("invalid MAX_CONCURRENT_UPLOADS environment variable")
+			return nil, fmt.Errorf("invalid MAX_CONCURRENT_UPLOADS: %s", uploadsStr)
+		}
+	}
+
 	uploadExpiresInStr := os.Getenv("UPLOAD_EXPIRES_IN")
 	if uploadExpiresInStr == "" {
 		uploadExpiresInStr = "24h"
@@ -106,17 +319,408 @@ func NewConfig() (*Config, error) {
 		return nil, fmt.Errorf("invalid UPLOAD_EXPIRES_IN: %w", err)
 	}
 
+	var uploadMaxExpiry time.Duration
+	if maxExpiryStr := os.Getenv("UPLOAD_MAX_EXPIRES_IN"); maxExpiryStr != "" {
+		uploadMaxExpiry, err = time.ParseDuration(maxExpiryStr)
+		if err != nil || uploadMaxExpiry < 0 {
+			log.Error().Err(err).Msg("invalid UPLOAD_MAX_EXPIRES_IN environment variable")
+			return nil, fmt.Errorf("invalid UPLOAD_MAX_EXPIRES_IN: %s", maxExpiryStr)
+		}
+	}
+
+	sandboxTypes := defaultSandboxTypes
+	if sandboxTypesStr := os.Getenv("UPLOAD_SANDBOX_TYPES"); sandboxTypesStr != "" {
+		sandboxTypes = parseList(sandboxTypesStr)
+	}
+
+	mimeOverrides, err := parseMIMEOverrides(os.Getenv("UPLOAD_MIME_TYPES"))
+	if err != nil {
+		log.Error().Err(err).Msg("invalid UPLOAD_MIME_TYPES environment variable")
+		return nil, err
+	}
+
+	forceDownload, err := parseBool(os.Getenv("UPLOAD_FORCE_DOWNLOAD"))
+	if err != nil {
+		log.Error().Err(err).Msg("invalid UPLOAD_FORCE_DOWNLOAD environment variable")
+		return nil, fmt.Errorf("invalid UPLOAD_FORCE_DOWNLOAD: %w", err)
+	}
+
+	fileCacheMaxAge := 24 * time.Hour
+	if maxAgeStr := os.Getenv("FILE_CACHE_MAX_AGE"); maxAgeStr != "" {
+		fileCacheMaxAge, err = time.ParseDuration(maxAgeStr)
+		if err != nil || fileCacheMaxAge < 0 {
+			log.Error().Err(err).Msg("invalid FILE_CACHE_MAX_AGE environment variable")
+			return nil, fmt.Errorf("invalid FILE_CACHE_MAX_AGE: %s", maxAgeStr)
+		}
+	}
+
+	apiRateLimit := 60
+	if apiRateLimitStr := os.Getenv("API_RATE_LIMIT"); apiRateLimitStr != "" {
+		apiRateLimit, err = strconv.Atoi(apiRateLimitStr)
+		if err != nil || apiRateLimit <= 0 {
+			log.Error().Err(err).Msg("invalid API_RATE_LIMIT environment variable")
+			return nil, fmt.Errorf("invalid API_RATE_LIMIT: %s", apiRateLimitStr)
+		}
+	}
+
+	idempotencyTTL := 24 * time.Hour
+	if ttlStr := os.Getenv("IDEMPOTENCY_TTL"); ttlStr != "" {
+		idempotencyTTL, err = time.ParseDuration(ttlStr)
+		if err != nil || idempotencyTTL <= 0 {
+			log.Error().Err(err).Msg("invalid IDEMPOTENCY_TTL environment variable")
+			return nil, fmt.Errorf("invalid IDEMPOTENCY_TTL: %s", ttlStr)
+		}
+	}
+
+	fetchMetadata, err := parseBool(os.Getenv("URL_FETCH_METADATA"))
+	if err != nil {
+		log.Error().Err(err).Msg("invalid URL_FETCH_METADATA environment variable")
+		return nil, fmt.Errorf("invalid URL_FETCH_METADATA: %w", err)
+	}
+
+	blockPrivateIPs, err := parseBool(os.Getenv("URL_BLOCK_PRIVATE"))
+	if err != nil {
+		log.Error().Err(err).Msg("invalid URL_BLOCK_PRIVATE environment variable")
+		return nil, fmt.Errorf("invalid URL_BLOCK_PRIVATE: %w", err)
+	}
+
+	customDomains, err := parseBool(os.Getenv("URL_CUSTOM_DOMAINS"))
+	if err != nil {
+		log.Error().Err(err).Msg("invalid URL_CUSTOM_DOMAINS environment variable")
+		return nil, fmt.Errorf("invalid URL_CUSTOM_DOMAINS: %w", err)
+	}
+
+	geoIPDBPath := os.Getenv("GEOIP_DB_PATH")
+	if geoIPDBPath == "" {
+		geoIPDBPath = "./GeoLite2-City.mmdb"
+	}
+
+	var geoIPReload time.Duration
+	if intervalStr := os.Getenv("GEOIP_RELOAD_INTERVAL"); intervalStr != "" {
+		geoIPReload, err = time.ParseDuration(intervalStr)
+		if err != nil || geoIPReload < 0 {
+			log.Error().Err(err).Msg("invalid GEOIP_RELOAD_INTERVAL environment variable")
+			return nil, fmt.Errorf("invalid GEOIP_RELOAD_INTERVAL: %s", intervalStr)
+		}
+	}
+
+	var trustProxyHops int
+	if hopsStr := os.Getenv("TRUST_PROXY_HOPS"); hopsStr != "" {
+		trustProxyHops, err = strconv.Atoi(hopsStr)
+		if err != nil || trustProxyHops < 0 {
+			log.Error().Err(err).Msg("invalid TRUST_PROXY_HOPS environment variable")
+			return nil, fmt.Errorf("invalid TRUST_PROXY_HOPS: %s", hopsStr)
+		}
+	}
+
+	trustedProxies, err := parsePrefixes(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Error().Err(err).Msg("invalid TRUSTED_PROXIES environment variable")
+		return nil, fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+
+	requestIDHeader := os.Getenv("REQUEST_ID_HEADER")
+	if requestIDHeader == "" {
+		requestIDHeader = "X-Request-ID"
+	} else if !validHeaderName(requestIDHeader) {
+		log.Error().Str("header", requestIDHeader).Msg("invalid REQUEST_ID_HEADER environment variable")
+		return nil, fmt.Errorf("invalid REQUEST_ID_HEADER: %s", requestIDHeader)
+	}
+
+	uploadNaming := os.Getenv("UPLOAD_FILENAME_STRATEGY")
+	switch uploadNaming {
+	case "":
+		uploadNaming = "timestamp"
+	case "timestamp", "uuid", "hash":
+	default:
+		log.Error().Str("strategy", uploadNaming).Msg("invalid UPLOAD_FILENAME_STRATEGY environment variable")
+		return nil, fmt.Errorf("invalid UPLOAD_FILENAME_STRATEGY: %s", uploadNaming)
+	}
+
+	folderDeletion := os.Getenv("FOLDER_DELETE_MODE")
+	switch folderDeletion {
+	case "":
+		folderDeletion = "block"
+	case "block", "reparent":
+	default:
+		log.Error().Str("mode", folderDeletion).Msg("invalid FOLDER_DELETE_MODE environment variable")
+		return nil, fmt.Errorf("invalid FOLDER_DELETE_MODE: %s", folderDeletion)
+	}
+
+	filenameMaxLen := 255
+	if lenStr := os.Getenv("UPLOAD_MAX_FILENAME_LENGTH"); lenStr != "" {
+		filenameMaxLen, err = strconv.Atoi(lenStr)
+		if err != nil || filenameMaxLen < 1 {
+			log.Error().Err(err).Msg("invalid UPLOAD_MAX_FILENAME_LENGTH environment variable")
+			return nil, fmt.Errorf("invalid UPLOAD_MAX_FILENAME_LENGTH: %s", lenStr)
+		}
+	}
+
+	imageMaxPixels := int64(100_000_000)
+	if pixelsStr := os.Getenv("IMAGE_MAX_PIXELS"); pixelsStr != "" {
+		imageMaxPixels, err = strconv.ParseInt(pixelsStr, 10, 64)
+		if err != nil || imageMaxPixels < 0 {
+			log.Error().Err(err).Msg("invalid IMAGE_MAX_PIXELS environment variable")
+			return nil, fmt.Errorf("invalid IMAGE_MAX_PIXELS: %s", pixelsStr)
+		}
+	}
+
+	analyticsIPMode := os.Getenv("ANALYTICS_IP_MODE")
+	switch analyticsIPMode {
+	case "":
+		analyticsIPMode = "full"
+	case "full", "truncate", "hash":
+	default:
+		log.Error().Str("mode", analyticsIPMode).Msg("invalid ANALYTICS_IP_MODE environment variable")
+		return nil, fmt.Errorf("invalid ANALYTICS_IP_MODE: %s", analyticsIPMode)
+	}
+
+	var retentionDays int
+	if retentionStr := os.Getenv("ANALYTICS_RETENTION_DAYS"); retentionStr != "" {
+		retentionDays, err = strconv.Atoi(retentionStr)
+		if err != nil || retentionDays < 0 {
+			log.Error().Err(err).Msg("invalid ANALYTICS_RETENTION_DAYS environment variable")
+			return nil, fmt.Errorf("invalid ANALYTICS_RETENTION_DAYS: %s", retentionStr)
+		}
+	}
+
+	var rollupDays int
+	if rollupStr := os.Getenv("ANALYTICS_ROLLUP_DAYS"); rollupStr != "" {
+		rollupDays, err = strconv.Atoi(rollupStr)
+		if err != nil || rollupDays < 0 {
+			log.Error().Err(err).Msg("invalid ANALYTICS_ROLLUP_DAYS environment variable")
+			return nil, fmt.Errorf("invalid ANALYTICS_ROLLUP_DAYS: %s", rollupStr)
+		}
+		// Clicks would be purged before they are old enough to be rolled up
+		if retentionDays > 0 && rollupDays >= retentionDays {
+			log.Error().Msg("invalid ANALYTICS_ROLLUP_DAYS environment variable")
+			return nil, fmt.Errorf("invalid ANALYTICS_ROLLUP_DAYS: %s, must be below ANALYTICS_RETENTION_DAYS", rollupStr)
+		}
+	}
+
+	uniqueWindow := 24 * time.Hour
+	if windowStr := os.Getenv("ANALYTICS_UNIQUE_WINDOW"); windowStr != "" {
+		uniqueWindow, err = time.ParseDuration(windowStr)
+		if err != nil || uniqueWindow <= 0 {
+			log.Error().Err(err).Msg("invalid ANALYTICS_UNIQUE_WINDOW environment variable")
+			return nil, fmt.Errorf("invalid ANALYTICS_UNIQUE_WINDOW: %s", windowStr)
+		}
+	}
+
+	var clickBatchSize int
+	if batchStr := os.Getenv("CLICK_BATCH_SIZE"); batchStr != "" {
+		clickBatchSize, err = strconv.Atoi(batchStr)
+		if err != nil || clickBatchSize < 0 {
+			log.Error().Err(err).Msg("invalid CLICK_BATCH_SIZE environment variable")
+			return nil, fmt.Errorf("invalid CLICK_BATCH_SIZE: %s", batchStr)
+		}
+	}
+
+	clickFlushEvery := 5 * time.Second
+	if flushStr := os.Getenv("CLICK_FLUSH_INTERVAL"); flushStr != "" {
+		clickFlushEvery, err = time.ParseDuration(flushStr)
+		if err != nil || clickFlushEvery <= 0 {
+			log.Error().Err(err).Msg("invalid CLICK_FLUSH_INTERVAL environment variable")
+			return nil, fmt.Errorf("invalid CLICK_FLUSH_INTERVAL: %s", flushStr)
+		}
+	}
+
+	shortCodeLen := 8
+	if lengthStr := os.Getenv("SHORT_CODE_LENGTH"); lengthStr != "" {
+		shortCodeLen, err = strconv.Atoi(lengthStr)
+		if err != nil || shortCodeLen < 4 || shortCodeLen > 30 {
+			log.Error().Err(err).Msg("invalid SHORT_CODE_LENGTH environment variable")
+			return nil, fmt.Errorf("invalid SHORT_CODE_LENGTH: %s, must be between 4 and 30", lengthStr)
+		}
+	}
+
+	excludeAmbiguous, err := parseBool(os.Getenv("SHORT_CODE_EXCLUDE_AMBIGUOUS"))
+	if err != nil {
+		log.Error().Err(err).Msg("invalid SHORT_CODE_EXCLUDE_AMBIGUOUS environment variable")
+		return nil, fmt.Errorf("invalid SHORT_CODE_EXCLUDE_AMBIGUOUS: %w", err)
+	}
+	shortCodeChars, err := parseShortCodeAlphabet(os.Getenv("SHORT_CODE_ALPHABET"), excludeAmbiguous)
+	if err != nil {
+		log.Error().Err(err).Msg("invalid SHORT_CODE_ALPHABET environment variable")
+		return nil, err
+	}
+
+	shortCodeTries := 10
+	if retriesStr := os.Getenv("SHORT_CODE_RETRIES"); retriesStr != "" {
+		shortCodeTries, err = strconv.Atoi(retriesStr)
+		if err != nil || shortCodeTries <= 0 {
+			log.Error().Err(err).Msg("invalid SHORT_CODE_RETRIES environment variable")
+			return nil, fmt.Errorf("invalid SHORT_CODE_RETRIES: %s", retriesStr)
+		}
+	}
+
+	var maxUserURLs int
+	if maxURLsStr := os.Getenv("MAX_URLS_PER_USER"); maxURLsStr != "" {
+		maxUserURLs, err = strconv.Atoi(maxURLsStr)
+		if err != nil || maxUserURLs < 0 {
+			log.Error().Err(err).Msg("invalid MAX_URLS_PER_USER environment variable")
+			return nil, fmt.Errorf("invalid MAX_URLS_PER_USER: %s", maxURLsStr)
+		}
+	}
+
+	var urlMaxExpiry time.Duration
+	if maxExpiryStr := os.Getenv("URL_MAX_EXPIRES_IN"); maxExpiryStr != "" {
+		urlMaxExpiry, err = time.ParseDuration(maxExpiryStr)
+		if err != nil || urlMaxExpiry < 0 {
+			log.Error().Err(err).Msg("invalid URL_MAX_EXPIRES_IN environment variable")
+			return nil, fmt.Errorf("invalid URL_MAX_EXPIRES_IN: %s", maxExpiryStr)
+		}
+	}
+
+	pageSize := 10
+	if pageSizeStr := os.Getenv("PAGE_SIZE"); pageSizeStr != "" {
+		pageSize, err = strconv.Atoi(pageSizeStr)
+		if err != nil || pageSize <= 0 {
+			log.Error().Err(err).Msg("invalid PAGE_SIZE environment variable")
+			return nil, fmt.Errorf("invalid PAGE_SIZE: %s", pageSizeStr)
+		}
+	}
+
+	maxPageSize := max(50, pageSize)
+	if maxPageSizeStr := os.Getenv("MAX_PAGE_SIZE"); maxPageSizeStr != "" {
+		maxPageSize, err = strconv.Atoi(maxPageSizeStr)
+		if err != nil || maxPageSize < pageSize {
+			log.Error().Err(err).Msg("invalid MAX_PAGE_SIZE environment variable")
+			return nil, fmt.Errorf("invalid MAX_PAGE_SIZE: %s, must be at least PAGE_SIZE (%d)", maxPageSizeStr, pageSize)
+		}
+	}
+
+	var statsCacheTTL time.Duration
+	if ttlStr := os.Getenv("DASHBOARD_STATS_CACHE_TTL"); ttlStr != "" {
+		statsCacheTTL, err = time.ParseDuration(ttlStr)
+		if err != nil || statsCacheTTL < 0 {
+			log.Error().Err(err).Msg("invalid DASHBOARD_STATS_CACHE_TTL environment variable")
+			return nil, fmt.Errorf("invalid DASHBOARD_STATS_CACHE_TTL: %s", ttlStr)
+		}
+	}
+
+	syncDeletes, err := parseBool(os.Getenv("STORAGE_SYNC_DELETE"))
+	if err != nil {
+		log.Error().Err(err).Msg("invalid STORAGE_SYNC_DELETE environment variable")
+		return nil, fmt.Errorf("invalid STORAGE_SYNC_DELETE: %w", err)
+	}
+
+	smtpPort := 587
+	if smtpPortStr := os.Getenv("SMTP_PORT"); smtpPortStr != "" {
+		smtpPort, err = strconv.Atoi(smtpPortStr)
+		if err != nil || smtpPort <= 0 || smtpPort > 65535 {
+			log.Error().Err(err).Msg("invalid SMTP_PORT environment variable")
+			return nil, fmt.Errorf("invalid SMTP_PORT: %s", smtpPortStr)
+		}
+	}
+
+	mailFrom := os.Getenv("MAIL_FROM")
+	if mailFrom == "" {
+		mailFrom = "volaticus@localhost"
+	}
+
+	verifyEmail, err := parseBool(os.Getenv("EMAIL_VERIFICATION_REQUIRED"))
+	if err != nil {
+		log.Error().Err(err).Msg("invalid EMAIL_VERIFICATION_REQUIRED environment variable")
+		return nil, fmt.Errorf("invalid EMAIL_VERIFICATION_REQUIRED: %w", err)
+	}
+
+	loginAttempts := 5
+	if attemptsStr := os.Getenv("LOGIN_MAX_ATTEMPTS"); attemptsStr != "" {
+		loginAttempts, err = strconv.Atoi(attemptsStr)
+		if err != nil || loginAttempts < 0 {
+			log.Error().Err(err).Msg("invalid LOGIN_MAX_ATTEMPTS environment variable")
+			return nil, fmt.Errorf("invalid LOGIN_MAX_ATTEMPTS: %s", attemptsStr)
+		}
+	}
+
+	loginLockout := 15 * time.Minute
+	if lockoutStr := os.Getenv("LOGIN_LOCKOUT_DURATION"); lockoutStr != "" {
+		loginLockout, err = time.ParseDuration(lockoutStr)
+		if err != nil || loginLockout <= 0 {
+			log.Error().Err(err).Msg("invalid LOGIN_LOCKOUT_DURATION environment variable")
+			return nil, fmt.Errorf("invalid LOGIN_LOCKOUT_DURATION: %s", lockoutStr)
+		}
+	}
+
+	passwordScheme := strings.ToLower(os.Getenv("PASSWORD_HASH"))
+	switch passwordScheme {
+	case "":
+		passwordScheme = "bcrypt"
+	case "bcrypt", "argon2":
+	default:
+		log.Error().Str("password_hash", passwordScheme).Msg("invalid PASSWORD_HASH environment variable")
+		return nil, fmt.Errorf("invalid PASSWORD_HASH: %s, must be bcrypt or argon2", passwordScheme)
+	}
+
+	bcryptCost := 10
+	if costStr := os.Getenv("BCRYPT_COST"); costStr != "" {
+		bcryptCost, err = strconv.Atoi(costStr)
+		if err != nil || bcryptCost < 4 || bcryptCost > 31 {
+			log.Error().Err(err).Msg("invalid BCRYPT_COST environment variable")
+			return nil, fmt.Errorf("invalid BCRYPT_COST: %s, must be between 4 and 31", costStr)
+		}
+	}
+
+	cookieSecure, err := parseBool(os.Getenv("COOKIE_SECURE"))
+	if err != nil {
+		log.Error().Err(err).Msg("invalid COOKIE_SECURE environment variable")
+		return nil, fmt.Errorf("invalid COOKIE_SECURE: %w", err)
+	}
+
+	cookieSameSite := strings.ToLower(os.Getenv("COOKIE_SAMESITE"))
+	switch cookieSameSite {
+	case "":
+		cookieSameSite = "strict"
+	case "strict", "lax":
+	case "none":
+		// CORS allows credentials from any origin and there are no CSRF tokens, the SameSite
+		// cookie is what keeps other sites from calling the routes of a signed in user
+		log.Error().Msg("COOKIE_SAMESITE=none is not supported, it would allow cross-site requests with the session")
+		return nil, fmt.Errorf("invalid COOKIE_SAMESITE: none is not supported, use strict or lax")
+	default:
+		log.Error().Str("samesite", cookieSameSite).Msg("invalid COOKIE_SAMESITE environment variable")
+		return nil, fmt.Errorf("invalid COOKIE_SAMESITE: %s, must be strict or lax", cookieSameSite)
+	}
+
 	// Configure storage
 	storageProvider := os.Getenv("STORAGE_PROVIDER")
 	if storageProvider == "" {
 		storageProvider = "local"
 	}
 
+	clamAVTimeout := 30 * time.Second
+	if timeoutStr := os.Getenv("CLAMAV_TIMEOUT"); timeoutStr != "" {
+		clamAVTimeout, err = time.ParseDuration(timeoutStr)
+		if err != nil || clamAVTimeout <= 0 {
+			log.Error().Err(err).Msg("invalid CLAMAV_TIMEOUT environment variable")
+			return nil, fmt.Errorf("invalid CLAMAV_TIMEOUT: %s", timeoutStr)
+		}
+	}
+
+	var shardDepth int
+	if shardDepthStr := os.Getenv("UPLOAD_SHARD_DEPTH"); shardDepthStr != "" {
+		shardDepth, err = strconv.Atoi(shardDepthStr)
+		if err != nil || shardDepth < 0 || shardDepth > 2 {
+			log.Error().Err(err).Msg("invalid UPLOAD_SHARD_DEPTH environment variable")
+			return nil, fmt.Errorf("invalid UPLOAD_SHARD_DEPTH: %s, must be between 0 and 2", shardDepthStr)
+		}
+	}
+
+	publicObjects, err := parseBool(os.Getenv("GCS_PUBLIC_OBJECTS"))
+	if err != nil {
+		log.Error().Err(err).Msg("invalid GCS_PUBLIC_OBJECTS environment variable")
+		return nil, fmt.Errorf("invalid GCS_PUBLIC_OBJECTS: %w", err)
+	}
+
 	storageConfig := StorageConfig{
-		Provider:   storageProvider,
-		LocalPath:  os.Getenv("UPLOAD_DIR"),
-		ProjectID:  os.Getenv("GCS_PROJECT_ID"),
-		BucketName: os.Getenv("GCS_BUCKET_NAME"),
+		Provider:      storageProvider,
+		LocalPath:     os.Getenv("UPLOAD_DIR"),
+		ShardDepth:    shardDepth,
+		ProjectID:     os.Getenv("GCS_PROJECT_ID"),
+		BucketName:    os.Getenv("GCS_BUCKET_NAME"),
+		PublicObjects: publicObjects,
+		PublicURL:     strings.TrimSuffix(os.Getenv("GCS_PUBLIC_URL"), "/"),
 	}
 
 	// Validate storage configuration
@@ -129,9 +733,68 @@ func NewConfig() (*Config, error) {
 		Secret:          secret,
 		Env:             env,
 		BaseURL:         baseURL,
+		BasePath:        basePath,
 		UploadMaxSize:   uploadMaxSize,
+		UploadMaxFiles:  uploadMaxFiles,
 		UploadUserQuota: uploadUserQuota,
+		MaxBodySize:     maxBodySize,
+		RequestTimeout:  requestTimeout,
+		MaxUserFiles:    maxUserFiles,
+		UploadsPerUser:  uploadsPerUser,
 		UploadExpiresIn: uploadExpiresIn,
+		UploadMaxExpiry: uploadMaxExpiry,
+		UploadNaming:    uploadNaming,
+		FilenameMaxLen:  filenameMaxLen,
+		FolderDeletion:  folderDeletion,
+		ImageMaxPixels:  imageMaxPixels,
+		SandboxTypes:    sandboxTypes,
+		MIMEOverrides:   mimeOverrides,
+		ForceDownload:   forceDownload,
+		FileCacheMaxAge: fileCacheMaxAge,
+		APIRateLimit:    apiRateLimit,
+		IdempotencyTTL:  idempotencyTTL,
+		FetchMetadata:   fetchMetadata,
+		URLBlocklist:    parseDomains(os.Getenv("URL_BLOCKLIST")),
+		SafeBrowsingKey: os.Getenv("SAFE_BROWSING_API_KEY"),
+		URLhausKey:      os.Getenv("URLHAUS_AUTH_KEY"),
+		BlockPrivateIPs: blockPrivateIPs,
+		CustomDomains:   customDomains,
+		GeoIPDBPath:     geoIPDBPath,
+		GeoIPReload:     geoIPReload,
+		TrustProxyHops:  trustProxyHops,
+		TrustedProxies:  trustedProxies,
+		RequestIDHeader: requestIDHeader,
+		AnalyticsIPMode: analyticsIPMode,
+		RetentionDays:   retentionDays,
+		RollupDays:      rollupDays,
+		UniqueWindow:    uniqueWindow,
+		ClickBatchSize:  clickBatchSize,
+		ClickFlushEvery: clickFlushEvery,
+		ShortCodeLen:    shortCodeLen,
+		ShortCodeChars:  shortCodeChars,
+		ShortCodeTries:  shortCodeTries,
+		MaxUserURLs:     maxUserURLs,
+		URLMaxExpiry:    urlMaxExpiry,
+		PageSize:        pageSize,
+		MaxPageSize:     maxPageSize,
+		StatsCacheTTL:   statsCacheTTL,
+		ClamAVAddress:   os.Getenv("CLAMAV_ADDRESS"),
+		ClamAVTimeout:   clamAVTimeout,
+		AdminUsers:      parseNames(os.Getenv("ADMIN_USERS")),
+		SyncDeletes:     syncDeletes,
+		SMTPHost:        os.Getenv("SMTP_HOST"),
+		SMTPPort:        smtpPort,
+		SMTPUsername:    os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:    os.Getenv("SMTP_PASSWORD"),
+		MailFrom:        mailFrom,
+		VerifyEmail:     verifyEmail,
+		LoginAttempts:   loginAttempts,
+		LoginLockout:    loginLockout,
+		PasswordScheme:  passwordScheme,
+		BcryptCost:      bcryptCost,
+		CookieSecure:    cookieSecure,
+		CookieSameSite:  cookieSameSite,
+		CookieDomain:    os.Getenv("COOKIE_DOMAIN"),
 		Storage:         storageConfig,
 	}, nil
 }
@@ -143,6 +806,9 @@ func validateStorageConfig(cfg StorageConfig) error {
 		if cfg.LocalPath == "" {
 			return fmt.Errorf("UPLOAD_DIR is required for local storage")
 		}
+		if cfg.PublicObjects {
+			return fmt.Errorf("GCS_PUBLIC_OBJECTS requires GCS storage")
+		}
 	case "gcs":
 		if cfg.ProjectID == "" {
 			return fmt.Errorf("GCS_PROJECT_ID is required for GCS storage")
@@ -150,12 +816,42 @@ func validateStorageConfig(cfg StorageConfig) error {
 		if cfg.BucketName == "" {
 			return fmt.Errorf("GCS_BUCKET_NAME is required for GCS storage")
 		}
+		if cfg.PublicURL != "" {
+			if u, err := url.Parse(cfg.PublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("GCS_PUBLIC_URL must be an http or https URL: %s", cfg.PublicURL)
+			}
+		}
 	default:
 		return fmt.Errorf("unsupported storage provider: %s", cfg.Provider)
 	}
 	return nil
 }
 
+// parseShortCodeAlphabet returns the distinct characters of the alphabet, defaulting to letters and digits.
+// Only characters that are valid in vanity codes are accepted so generated codes never need escaping.
+func parseShortCodeAlphabet(alphabet string, excludeAmbiguous bool) (string, error) {
+	if alphabet == "" {
+		alphabet = defaultShortCodeAlphabet
+	}
+
+	var b strings.Builder
+	for _, c := range alphabet {
+		valid := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_'
+		if !valid {
+			return "", fmt.Errorf("invalid SHORT_CODE_ALPHABET: %q is not a letter, digit, hyphen or underscore", c)
+		}
+		if strings.ContainsRune(b.String(), c) || (excludeAmbiguous && strings.ContainsRune(ambiguousChars, c)) {
+			continue
+		}
+		b.WriteRune(c)
+	}
+
+	if b.Len() < 2 {
+		return "", fmt.Errorf("invalid SHORT_CODE_ALPHABET: at least 2 distinct characters are required")
+	}
+	return b.String(), nil
+}
+
 // parseUploadMaxSize parses the UPLOAD_MAX_SIZE environment variable
 // Value is expected to be postfixed with "MB" for megabytes or "GB" for gigabytes, e.g. "100MB"
 // If no postfix is provided, the value is assumed to be in megabytes
@@ -180,3 +876,105 @@ func parseUploadMaxSize(size string) (int64, error) {
 		return value * 1024 * 1024, nil
 	}
 }
+
+// parseList splits a comma separated environment variable into trimmed, lower-cased values
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseNames parses a comma separated list keeping the case of its items, usernames are case-sensitive
+func parseNames(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseMIMEOverrides parses a comma separated list of extension=type pairs like
+// ".md=text/markdown,.rst=text/x-rst" and adds them to the default overrides
+func parseMIMEOverrides(value string) (map[string]string, error) {
+	overrides := make(map[string]string, len(defaultMIMEOverrides))
+	for ext, contentType := range defaultMIMEOverrides {
+		overrides[ext] = contentType
+	}
+
+	for _, item := range parseList(value) {
+		ext, contentType, ok := strings.Cut(item, "=")
+		ext, contentType = strings.TrimSpace(ext), strings.TrimSpace(contentType)
+		if !ok || strings.Trim(ext, ".") == "" {
+			return nil, fmt.Errorf("invalid UPLOAD_MIME_TYPES: %q is not an extension=type pair", item)
+		}
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			return nil, fmt.Errorf("invalid UPLOAD_MIME_TYPES: %q is not a MIME type", contentType)
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		overrides[ext] = contentType
+	}
+	return overrides, nil
+}
+
+// parseDomains parses a comma separated list of domains, trailing dots and a leading "*." are dropped
+func parseDomains(value string) []string {
+	var domains []string
+	for _, item := range parseList(value) {
+		item = strings.TrimPrefix(strings.TrimSuffix(item, "."), "*.")
+		if item != "" {
+			domains = append(domains, item)
+		}
+	}
+	return domains
+}
+
+// parsePrefixes parses a comma separated list of CIDR ranges, single addresses are a range of their own
+func parsePrefixes(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range parseList(value) {
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, err
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// validHeaderName reports whether name only has letters, digits and dashes, which covers every
+// header a request ID is commonly sent in
+func validHeaderName(name string) bool {
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// parseBool parses an optional boolean environment variable, unset means false
+func parseBool(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"net/netip"
 	"os"
 	"reflect"
 	"testing"
@@ -33,8 +34,40 @@ func TestNewConfig(t *testing.T) {
 				Env:             "development",
 				BaseURL:         "http://localhost",
 				UploadMaxSize:   25 * 1024 * 1024,
+				UploadMaxFiles:  10,
 				UploadUserQuota: 100 * 1024 * 1024,
+				MaxBodySize:     1024 * 1024,
+				RequestTimeout:  30 * time.Second,
 				UploadExpiresIn: 24 * time.Hour,
+				UploadNaming:    "timestamp",
+				FolderDeletion:  "block",
+				UploadsPerUser:  4,
+				ImageMaxPixels:  100_000_000,
+				FilenameMaxLen:  255,
+				SandboxTypes:    []string{"text/html", "image/svg+xml", "application/xhtml+xml"},
+				FileCacheMaxAge: 24 * time.Hour,
+				APIRateLimit:    60,
+				IdempotencyTTL:  24 * time.Hour,
+				FetchMetadata:   false,
+				GeoIPDBPath:     "./GeoLite2-City.mmdb",
+				RequestIDHeader: "X-Request-ID",
+				AnalyticsIPMode: "full",
+				UniqueWindow:    24 * time.Hour,
+				ClickFlushEvery: 5 * time.Second,
+				ShortCodeLen:    8,
+				ShortCodeChars:  "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789",
+				ShortCodeTries:  10,
+				PageSize:        10,
+				MaxPageSize:     50,
+				ClamAVTimeout:   30 * time.Second,
+				SMTPPort:        587,
+				MailFrom:        "volaticus@localhost",
+				LoginAttempts:   5,
+				LoginLockout:    15 * time.Minute,
+				PasswordScheme:  "bcrypt",
+				BcryptCost:      10,
+				CookieSameSite:  "strict",
+				MIMEOverrides:   defaultMIMEOverrides,
 				Storage: StorageConfig{
 					Provider:  "local",
 					LocalPath: "./uploads",
@@ -62,8 +95,40 @@ func TestNewConfig(t *testing.T) {
 				Env:             "development",
 				BaseURL:         "http://localhost",
 				UploadMaxSize:   25 * 1024 * 1024,
+				UploadMaxFiles:  10,
 				UploadUserQuota: 100 * 1024 * 1024,
+				MaxBodySize:     1024 * 1024,
+				RequestTimeout:  30 * time.Second,
 				UploadExpiresIn: 24 * time.Hour,
+				UploadNaming:    "timestamp",
+				FolderDeletion:  "block",
+				UploadsPerUser:  4,
+				ImageMaxPixels:  100_000_000,
+				FilenameMaxLen:  255,
+				SandboxTypes:    []string{"text/html", "image/svg+xml", "application/xhtml+xml"},
+				FileCacheMaxAge: 24 * time.Hour,
+				APIRateLimit:    60,
+				IdempotencyTTL:  24 * time.Hour,
+				FetchMetadata:   false,
+				GeoIPDBPath:     "./GeoLite2-City.mmdb",
+				RequestIDHeader: "X-Request-ID",
+				AnalyticsIPMode: "full",
+				UniqueWindow:    24 * time.Hour,
+				ClickFlushEvery: 5 * time.Second,
+				ShortCodeLen:    8,
+				ShortCodeChars:  "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789",
+				ShortCodeTries:  10,
+				PageSize:        10,
+				MaxPageSize:     50,
+				ClamAVTimeout:   30 * time.Second,
+				SMTPPort:        587,
+				MailFrom:        "volaticus@localhost",
+				LoginAttempts:   5,
+				LoginLockout:    15 * time.Minute,
+				PasswordScheme:  "bcrypt",
+				BcryptCost:      10,
+				CookieSameSite:  "strict",
+				MIMEOverrides:   defaultMIMEOverrides,
 				Storage: StorageConfig{
 					Provider:   "gcs",
 					ProjectID:  "my-project",
@@ -134,6 +199,48 @@ func TestNewConfig(t *testing.T) {
 			want:    nil,
 			wantErr: true,
 		},
+		{
+			name: "Rollup not below retention",
+			envVars: map[string]string{
+				"PORT":                     "8080",
+				"SECRET":                   "mysecret",
+				"BASE_URL":                 "http://localhost",
+				"STORAGE_PROVIDER":         "local",
+				"UPLOAD_DIR":               "./uploads",
+				"ANALYTICS_RETENTION_DAYS": "90",
+				"ANALYTICS_ROLLUP_DAYS":    "90",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Max page size below page size",
+			envVars: map[string]string{
+				"PORT":             "8080",
+				"SECRET":           "mysecret",
+				"BASE_URL":         "http://localhost",
+				"STORAGE_PROVIDER": "local",
+				"UPLOAD_DIR":       "./uploads",
+				"PAGE_SIZE":        "25",
+				"MAX_PAGE_SIZE":    "20",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "SameSite none",
+			envVars: map[string]string{
+				"PORT":             "8080",
+				"SECRET":           "mysecret",
+				"BASE_URL":         "http://localhost",
+				"STORAGE_PROVIDER": "local",
+				"UPLOAD_DIR":       "./uploads",
+				"COOKIE_SECURE":    "true",
+				"COOKIE_SAMESITE":  "none",
+			},
+			want:    nil,
+			wantErr: true,
+		},
 		{
 			name: "Missing GCS configuration",
 			envVars: map[string]string{
@@ -149,6 +256,34 @@ func TestNewConfig(t *testing.T) {
 			want:    nil,
 			wantErr: true,
 		},
+		{
+			name: "Public objects with local storage",
+			envVars: map[string]string{
+				"PORT":               "8080",
+				"SECRET":             "mysecret",
+				"BASE_URL":           "http://localhost",
+				"STORAGE_PROVIDER":   "local",
+				"UPLOAD_DIR":         "./uploads",
+				"GCS_PUBLIC_OBJECTS": "true",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Invalid GCS public URL",
+			envVars: map[string]string{
+				"PORT":               "8080",
+				"SECRET":             "mysecret",
+				"BASE_URL":           "http://localhost",
+				"STORAGE_PROVIDER":   "gcs",
+				"GCS_PROJECT_ID":     "my-project",
+				"GCS_BUCKET_NAME":    "my-bucket",
+				"GCS_PUBLIC_OBJECTS": "true",
+				"GCS_PUBLIC_URL":     "cdn.example.com",
+			},
+			want:    nil,
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -175,6 +310,49 @@ func TestNewConfig(t *testing.T) {
 	}
 }
 
+func TestNewConfigBasePath(t *testing.T) {
+	tests := []struct {
+		name        string
+		basePath    string
+		baseURL     string
+		wantPath    string
+		wantBaseURL string
+		wantErr     bool
+	}{
+		{"unset", "", "http://localhost", "", "http://localhost", false},
+		{"root", "/", "http://localhost", "", "http://localhost", false},
+		{"appended to base URL", "/volaticus/", "https://example.com/", "/volaticus", "https://example.com/volaticus", false},
+		{"leading slash added", "volaticus", "https://example.com", "/volaticus", "https://example.com/volaticus", false},
+		{"already in base URL", "/volaticus", "https://example.com/volaticus", "/volaticus", "https://example.com/volaticus", false},
+		{"query not allowed", "/app?x=1", "http://localhost", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Clearenv()
+			t.Setenv("PORT", "8080")
+			t.Setenv("SECRET", "mysecret")
+			t.Setenv("UPLOAD_DIR", "./uploads")
+			t.Setenv("BASE_URL", tt.baseURL)
+			t.Setenv("BASE_PATH", tt.basePath)
+
+			got, err := NewConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.BasePath != tt.wantPath {
+				t.Errorf("BasePath = %q, want %q", got.BasePath, tt.wantPath)
+			}
+			if got.BaseURL != tt.wantBaseURL {
+				t.Errorf("BaseURL = %q, want %q", got.BaseURL, tt.wantBaseURL)
+			}
+		})
+	}
+}
+
 func Test_parseUploadMaxSize(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -227,3 +405,162 @@ func Test_parseUploadMaxSize(t *testing.T) {
 		})
 	}
 }
+
+func Test_parseList(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{
+			name:  "Single value",
+			value: "text/html",
+			want:  []string{"text/html"},
+		},
+		{
+			name:  "Multiple values with whitespace and casing",
+			value: " Text/HTML , image/svg+xml,,application/xhtml+xml ",
+			want:  []string{"text/html", "image/svg+xml", "application/xhtml+xml"},
+		},
+		{
+			name:  "Only separators",
+			value: ", ,",
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseList(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseList() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseDomains(t *testing.T) {
+	got := parseDomains(" Example.com., *.evil.example ,,")
+	want := []string{"example.com", "evil.example"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDomains() = %v, want %v", got, want)
+	}
+}
+
+func Test_parsePrefixes(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []netip.Prefix
+		wantErr bool
+	}{
+		{
+			name:  "Unset",
+			value: "",
+			want:  nil,
+		},
+		{
+			name:  "CIDR ranges are masked",
+			value: "10.1.2.3/8, 2001:DB8::1/32",
+			want:  []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("2001:db8::/32")},
+		},
+		{
+			name:  "Single addresses",
+			value: "192.0.2.1,::1",
+			want:  []netip.Prefix{netip.MustParsePrefix("192.0.2.1/32"), netip.MustParsePrefix("::1/128")},
+		},
+		{
+			name:    "Invalid range",
+			value:   "10.0.0.0/33",
+			wantErr: true,
+		},
+		{
+			name:    "Hostname",
+			value:   "proxy.internal",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePrefixes(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePrefixes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsePrefixes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseShortCodeAlphabet(t *testing.T) {
+	tests := []struct {
+		name             string
+		alphabet         string
+		excludeAmbiguous bool
+		want             string
+		wantErr          bool
+	}{
+		{
+			name:     "Default alphabet",
+			alphabet: "",
+			want:     "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789",
+		},
+		{
+			name:             "Default alphabet without ambiguous characters",
+			alphabet:         "",
+			excludeAmbiguous: true,
+			want:             "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789",
+		},
+		{
+			name:     "Duplicates removed",
+			alphabet: "aabbc-_",
+			want:     "abc-_",
+		},
+		{
+			name:     "Invalid character",
+			alphabet: "abc/",
+			wantErr:  true,
+		},
+		{
+			name:             "Too few characters left",
+			alphabet:         "0O1a",
+			excludeAmbiguous: true,
+			wantErr:          true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseShortCodeAlphabet(tt.alphabet, tt.excludeAmbiguous)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseShortCodeAlphabet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseShortCodeAlphabet() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseMIMEOverrides(t *testing.T) {
+	got, err := parseMIMEOverrides("rst=text/x-rst, .MD=text/x-markdown")
+	if err != nil {
+		t.Fatalf("parseMIMEOverrides() error = %v", err)
+	}
+	if got[".rst"] != "text/x-rst" || got[".md"] != "text/x-markdown" {
+		t.Errorf("parseMIMEOverrides() = %v, want .rst added and .md replaced", got)
+	}
+	if got[".csv"] != defaultMIMEOverrides[".csv"] {
+		t.Errorf("default .csv type dropped, got %q", got[".csv"])
+	}
+	if defaultMIMEOverrides[".md"] != "text/markdown; charset=utf-8" {
+		t.Error("replacing a type changed the defaults")
+	}
+
+	for _, value := range []string{".md", "=text/plain", ".md=not a type"} {
+		if _, err := parseMIMEOverrides(value); err == nil {
+			t.Errorf("parseMIMEOverrides(%q) succeeded, want an error", value)
+		}
+	}
+}
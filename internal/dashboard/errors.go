@@ -5,4 +5,5 @@ import "errors"
 var (
 	ErrFetchingStats = errors.New("error fetching dashboard statistics")
 	ErrUnauthorized  = errors.New("unauthorized access to dashboard")
+	ErrNoCachedStats = errors.New("no fresh cached dashboard statistics")
 )
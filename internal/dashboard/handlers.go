@@ -4,9 +4,15 @@ import (
 	"encoding/json"
 	"github.com/rs/zerolog/log"
 	"net/http"
+	"strconv"
 	"volaticus-go/internal/context"
 )
 
+const (
+	defaultRecentLimit = 5
+	maxRecentLimit     = 50
+)
+
 type Handler struct {
 	service Service
 }
@@ -46,3 +52,42 @@ func (h *Handler) HandleGetDashboardStats(w http.ResponseWriter, r *http.Request
 		return
 	}
 }
+
+func (h *Handler) HandleGetRecentItems(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		log.Error().Msg("unauthorized access attempt to dashboard recent items")
+		http.Error(w, ErrUnauthorized.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	limit := defaultRecentLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(parsed, maxRecentLimit)
+	}
+
+	items, err := h.service.GetRecentItems(r.Context(), user.ID, limit)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("user_id", user.ID.String()).
+			Msg("failed to fetch recent dashboard items")
+		http.Error(w, "Error fetching recent items", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(items); err != nil {
+		log.Error().
+			Err(err).
+			Str("user_id", user.ID.String()).
+			Msg("failed to encode recent dashboard items response")
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		return
+	}
+}
@@ -2,8 +2,11 @@ package dashboard
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"time"
 	"volaticus-go/internal/common/models"
 	"volaticus-go/internal/database"
 )
@@ -12,6 +15,14 @@ type Repository interface {
 	GetDashboardStats(ctx context.Context, userID uuid.UUID) (*models.DashboardStats, error)
 	GetRecentURLs(ctx context.Context, userID uuid.UUID, limit int) ([]models.RecentURL, error)
 	GetRecentFiles(ctx context.Context, userID uuid.UUID, limit int) ([]models.RecentFile, error)
+
+	// GetCachedStats returns the cached totals of the user if they were computed after since,
+	// ErrNoCachedStats otherwise
+	GetCachedStats(ctx context.Context, userID uuid.UUID, since time.Time) (*models.DashboardStats, error)
+	SaveCachedStats(ctx context.Context, userID uuid.UUID, stats *models.DashboardStats) error
+	// RefreshCachedStats recomputes the totals computed before staleBefore of users who looked at
+	// their dashboard after activeSince, the totals of other users are dropped
+	RefreshCachedStats(ctx context.Context, staleBefore, activeSince time.Time) (refreshed, dropped int64, err error)
 }
 
 type repository struct {
@@ -34,7 +45,7 @@ func (r *repository) GetDashboardStats(ctx context.Context, userID uuid.UUID) (*
                 COUNT(*) as total_urls,
                 COALESCE(SUM(access_count), 0) as total_clicks
             FROM shortened_urls 
-            WHERE user_id = $1 AND is_active = true`
+            WHERE user_id = $1 AND deleted_at IS NULL`
 
 		if err := tx.GetContext(ctx, stats, urlQuery, userID); err != nil {
 			return err
@@ -62,7 +73,7 @@ func (r *repository) GetRecentURLs(ctx context.Context, userID uuid.UUID, limit
             access_count,
             to_char(created_at, 'YYYY-MM-DD HH24:MI:SS') as created_at
         FROM shortened_urls
-        WHERE user_id = $1 AND is_active = true
+        WHERE user_id = $1 AND deleted_at IS NULL
         ORDER BY created_at DESC
         LIMIT $2`
 
@@ -87,3 +98,75 @@ func (r *repository) GetRecentFiles(ctx context.Context, userID uuid.UUID, limit
 	err := r.Select(ctx, &files, query, userID, limit)
 	return files, err
 }
+
+func (r *repository) GetCachedStats(ctx context.Context, userID uuid.UUID, since time.Time) (*models.DashboardStats, error) {
+	stats := &models.DashboardStats{}
+	err := r.Get(ctx, stats, `
+        UPDATE dashboard_stats
+        SET accessed_at = CURRENT_TIMESTAMP
+        WHERE user_id = $1 AND computed_at > $2
+        RETURNING total_urls, total_clicks, total_files, total_storage`,
+		userID, since,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoCachedStats
+	}
+	return stats, err
+}
+
+func (r *repository) SaveCachedStats(ctx context.Context, userID uuid.UUID, stats *models.DashboardStats) error {
+	_, err := r.Exec(ctx, `
+        INSERT INTO dashboard_stats (user_id, total_urls, total_clicks, total_files, total_storage)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (user_id) DO UPDATE
+        SET total_urls = EXCLUDED.total_urls,
+            total_clicks = EXCLUDED.total_clicks,
+            total_files = EXCLUDED.total_files,
+            total_storage = EXCLUDED.total_storage,
+            computed_at = CURRENT_TIMESTAMP,
+            accessed_at = CURRENT_TIMESTAMP`,
+		userID, stats.TotalURLs, stats.TotalClicks, stats.TotalFiles, stats.TotalStorage,
+	)
+	return err
+}
+
+func (r *repository) RefreshCachedStats(ctx context.Context, staleBefore, activeSince time.Time) (refreshed, dropped int64, err error) {
+	err = r.WithTx(ctx, func(tx *sqlx.Tx) error {
+		result, err := tx.ExecContext(ctx, "DELETE FROM dashboard_stats WHERE accessed_at < $1", activeSince)
+		if err != nil {
+			return err
+		}
+		if dropped, err = result.RowsAffected(); err != nil {
+			return err
+		}
+
+		// Same totals as GetDashboardStats, computed for every stale row in one statement
+		result, err = tx.ExecContext(ctx, `
+            UPDATE dashboard_stats AS d
+            SET total_urls = u.total_urls,
+                total_clicks = u.total_clicks,
+                total_files = f.total_files,
+                total_storage = f.total_storage,
+                computed_at = CURRENT_TIMESTAMP
+            FROM dashboard_stats AS s
+            CROSS JOIN LATERAL (
+                SELECT COUNT(*) AS total_urls, COALESCE(SUM(access_count), 0) AS total_clicks
+                FROM shortened_urls
+                WHERE user_id = s.user_id AND deleted_at IS NULL
+            ) AS u
+            CROSS JOIN LATERAL (
+                SELECT COUNT(*) AS total_files, COALESCE(SUM(file_size), 0) AS total_storage
+                FROM uploaded_files
+                WHERE user_id = s.user_id
+            ) AS f
+            WHERE d.user_id = s.user_id AND s.computed_at < $1`,
+			staleBefore,
+		)
+		if err != nil {
+			return err
+		}
+		refreshed, err = result.RowsAffected()
+		return err
+	})
+	return refreshed, dropped, err
+}
@@ -290,3 +290,64 @@ func TestRepository_GetRecentFiles(t *testing.T) {
 		}
 	})
 }
+
+func TestRepository_CachedStats(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	ctx := context.Background()
+
+	userID, err := createTestUser(ctx, db)
+	require.NoError(t, err)
+	require.NoError(t, createTestURLs(ctx, db, userID, 2))
+
+	_, err = repo.GetCachedStats(ctx, userID, time.Now().Add(-time.Minute))
+	assert.ErrorIs(t, err, ErrNoCachedStats)
+
+	live, err := repo.GetDashboardStats(ctx, userID)
+	require.NoError(t, err)
+	require.NoError(t, repo.SaveCachedStats(ctx, userID, live))
+
+	cached, err := repo.GetCachedStats(ctx, userID, time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), cached.TotalURLs)
+	assert.Equal(t, int64(10), cached.TotalClicks)
+
+	_, err = repo.GetCachedStats(ctx, userID, time.Now().Add(time.Minute))
+	assert.ErrorIs(t, err, ErrNoCachedStats, "stale totals were returned")
+
+	t.Run("clicks show up after a refresh", func(t *testing.T) {
+		_, err := db.ExecContext(ctx, "UPDATE shortened_urls SET access_count = access_count + 5 WHERE user_id = $1", userID)
+		require.NoError(t, err)
+
+		refreshed, dropped, err := repo.RefreshCachedStats(ctx, time.Now().Add(time.Minute), time.Now().Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), refreshed)
+		assert.Zero(t, dropped)
+
+		cached, err := repo.GetCachedStats(ctx, userID, time.Now().Add(-time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, int64(20), cached.TotalClicks)
+	})
+
+	t.Run("writes invalidate the cache", func(t *testing.T) {
+		require.NoError(t, createTestFiles(ctx, db, userID, 1))
+		_, err := repo.GetCachedStats(ctx, userID, time.Now().Add(-time.Minute))
+		assert.ErrorIs(t, err, ErrNoCachedStats, "new file didn't invalidate the totals")
+
+		require.NoError(t, repo.SaveCachedStats(ctx, userID, live))
+		_, err = db.ExecContext(ctx, "UPDATE shortened_urls SET deleted_at = CURRENT_TIMESTAMP WHERE user_id = $1", userID)
+		require.NoError(t, err)
+		_, err = repo.GetCachedStats(ctx, userID, time.Now().Add(-time.Minute))
+		assert.ErrorIs(t, err, ErrNoCachedStats, "deleted links didn't invalidate the totals")
+	})
+
+	t.Run("idle users are dropped", func(t *testing.T) {
+		require.NoError(t, repo.SaveCachedStats(ctx, userID, live))
+		refreshed, dropped, err := repo.RefreshCachedStats(ctx, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+		require.NoError(t, err)
+		assert.Zero(t, refreshed)
+		assert.Equal(t, int64(1), dropped)
+	})
+}
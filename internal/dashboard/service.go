@@ -2,27 +2,40 @@ package dashboard
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"time"
 	"volaticus-go/internal/common/models"
 )
 
+// statsIdleTime is how long cached totals of a user who doesn't open the dashboard are kept refreshed
+const statsIdleTime = 24 * time.Hour
+
 type Service interface {
 	GetDashboardStats(ctx context.Context, userID uuid.UUID) (*models.DashboardStats, error)
+	GetRecentItems(ctx context.Context, userID uuid.UUID, limit int) (*models.RecentItems, error)
+	// RefreshCachedStats recomputes cached totals older than the cache TTL, run periodically
+	RefreshCachedStats(ctx context.Context) error
 }
 
 type service struct {
-	repo Repository
+	repo     Repository
+	cacheTTL time.Duration // 0 computes the totals on every request
 }
 
-func NewService(repo Repository) Service {
+// NewService creates a dashboard service, totals are cached for cacheTTL if it is positive
+func NewService(repo Repository, cacheTTL time.Duration) Service {
 	return &service{
-		repo: repo,
+		repo:     repo,
+		cacheTTL: cacheTTL,
 	}
 }
 
 func (s *service) GetDashboardStats(ctx context.Context, userID uuid.UUID) (*models.DashboardStats, error) {
 	// Get main statistics
-	stats, err := s.repo.GetDashboardStats(ctx, userID)
+	stats, err := s.totals(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -43,3 +56,71 @@ func (s *service) GetDashboardStats(ctx context.Context, userID uuid.UUID) (*mod
 
 	return stats, nil
 }
+
+func (s *service) GetRecentItems(ctx context.Context, userID uuid.UUID, limit int) (*models.RecentItems, error) {
+	recentURLs, err := s.repo.GetRecentURLs(ctx, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	recentFiles, err := s.repo.GetRecentFiles(ctx, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// Always encode empty lists instead of null
+	items := &models.RecentItems{
+		URLs:  []models.RecentURL{},
+		Files: []models.RecentFile{},
+	}
+	items.URLs = append(items.URLs, recentURLs...)
+	items.Files = append(items.Files, recentFiles...)
+
+	return items, nil
+}
+
+// totals returns the cached totals of the user, computing and caching them when there are none
+func (s *service) totals(ctx context.Context, userID uuid.UUID) (*models.DashboardStats, error) {
+	if s.cacheTTL <= 0 {
+		return s.repo.GetDashboardStats(ctx, userID)
+	}
+
+	stats, err := s.repo.GetCachedStats(ctx, userID, time.Now().Add(-s.cacheTTL))
+	if err == nil {
+		return stats, nil
+	}
+	if !errors.Is(err, ErrNoCachedStats) {
+		log.Warn().
+			Err(err).
+			Str("user_id", userID.String()).
+			Msg("failed to read cached dashboard stats, computing them")
+	}
+
+	stats, err = s.repo.GetDashboardStats(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SaveCachedStats(ctx, userID, stats); err != nil {
+		log.Warn().
+			Err(err).
+			Str("user_id", userID.String()).
+			Msg("failed to cache dashboard stats")
+	}
+	return stats, nil
+}
+
+func (s *service) RefreshCachedStats(ctx context.Context) error {
+	now := time.Now()
+	refreshed, dropped, err := s.repo.RefreshCachedStats(ctx, now.Add(-s.cacheTTL), now.Add(-statsIdleTime))
+	if err != nil {
+		return fmt.Errorf("refreshing dashboard stats: %w", err)
+	}
+
+	if refreshed > 0 || dropped > 0 {
+		log.Debug().
+			Int64("refreshed", refreshed).
+			Int64("dropped", dropped).
+			Msg("Refreshed cached dashboard stats")
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package dashboard
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"volaticus-go/internal/common/models"
+
+	"github.com/google/uuid"
+)
+
+// cacheRepository computes fixed totals and keeps cached totals in memory
+type cacheRepository struct {
+	Repository
+	live     models.DashboardStats
+	cached   *models.DashboardStats
+	cacheErr error
+	computed int
+}
+
+func (r *cacheRepository) GetDashboardStats(context.Context, uuid.UUID) (*models.DashboardStats, error) {
+	r.computed++
+	stats := r.live
+	return &stats, nil
+}
+
+func (r *cacheRepository) GetRecentURLs(context.Context, uuid.UUID, int) ([]models.RecentURL, error) {
+	return nil, nil
+}
+
+func (r *cacheRepository) GetRecentFiles(context.Context, uuid.UUID, int) ([]models.RecentFile, error) {
+	return nil, nil
+}
+
+func (r *cacheRepository) GetCachedStats(context.Context, uuid.UUID, time.Time) (*models.DashboardStats, error) {
+	if r.cacheErr != nil {
+		return nil, r.cacheErr
+	}
+	if r.cached == nil {
+		return nil, ErrNoCachedStats
+	}
+	stats := *r.cached
+	return &stats, nil
+}
+
+func (r *cacheRepository) SaveCachedStats(_ context.Context, _ uuid.UUID, stats *models.DashboardStats) error {
+	cached := *stats
+	r.cached = &cached
+	return nil
+}
+
+func TestGetDashboardStatsCache(t *testing.T) {
+	userID := uuid.New()
+
+	t.Run("disabled", func(t *testing.T) {
+		repo := &cacheRepository{live: models.DashboardStats{TotalURLs: 3}}
+		s := NewService(repo, 0)
+		for i := 0; i < 2; i++ {
+			if _, err := s.GetDashboardStats(context.Background(), userID); err != nil {
+				t.Fatalf("GetDashboardStats() error = %v", err)
+			}
+		}
+		if repo.computed != 2 || repo.cached != nil {
+			t.Errorf("computed %d times with cache %v, want every load computed and nothing cached", repo.computed, repo.cached)
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		repo := &cacheRepository{live: models.DashboardStats{TotalURLs: 3}}
+		s := NewService(repo, time.Minute)
+		for i := 0; i < 2; i++ {
+			stats, err := s.GetDashboardStats(context.Background(), userID)
+			if err != nil {
+				t.Fatalf("GetDashboardStats() error = %v", err)
+			}
+			if stats.TotalURLs != 3 {
+				t.Errorf("TotalURLs = %d, want 3", stats.TotalURLs)
+			}
+		}
+		if repo.computed != 1 {
+			t.Errorf("computed %d times, want once and then served from the cache", repo.computed)
+		}
+	})
+
+	t.Run("broken cache falls back to live totals", func(t *testing.T) {
+		repo := &cacheRepository{live: models.DashboardStats{TotalFiles: 2}, cacheErr: errors.New("connection reset")}
+		stats, err := NewService(repo, time.Minute).GetDashboardStats(context.Background(), userID)
+		if err != nil {
+			t.Fatalf("GetDashboardStats() error = %v", err)
+		}
+		if stats.TotalFiles != 2 || repo.computed != 1 {
+			t.Errorf("stats = %+v after %d computations, want the live totals", stats, repo.computed)
+		}
+	})
+}
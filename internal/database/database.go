@@ -1,9 +1,11 @@
 package database
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"os"
+	"strconv"
 	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
@@ -24,49 +26,169 @@ type Config struct {
 	Username string
 	Password string
 	Schema   string
+
+	ConnectRetries int           // Additional connection attempts after the first one fails
+	ConnectTimeout time.Duration // Timeout of a single connection attempt, 0 disables it
+
+	MaxOpenConns    int           // Maximum open connections, 0 uses the default
+	MaxIdleConns    *int          // Maximum idle connections, nil uses the default and 0 keeps none
+	ConnMaxLifetime time.Duration // Maximum connection lifetime, 0 uses the default
 }
 
+const (
+	defaultMaxOpenConns    = 25
+	defaultMaxIdleConns    = 5
+	defaultConnMaxLifetime = 5 * time.Minute
+
+	initialConnectBackoff = time.Second
+	maxConnectBackoff     = 30 * time.Second
+)
+
 // New creates a new database connection
 func New(cfg Config) (*DB, error) {
 	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable&search_path=%s",
 		cfg.Username, cfg.Password, cfg.Host, cfg.Port, cfg.Database, cfg.Schema)
 
-	db, err := sqlx.Connect("pgx", dsn)
+	db, err := connectWithRetry(dsn, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("connecting to database: %w", err)
 	}
 
 	// Set connection pool settings
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(5 * time.Minute)
+	maxOpenConns := cmp.Or(cfg.MaxOpenConns, defaultMaxOpenConns)
+	maxIdleConns := defaultMaxIdleConns
+	if cfg.MaxIdleConns != nil {
+		maxIdleConns = *cfg.MaxIdleConns
+	}
+	connMaxLifetime := cmp.Or(cfg.ConnMaxLifetime, defaultConnMaxLifetime)
+
+	db.SetMaxOpenConns(maxOpenConns)
+	db.SetMaxIdleConns(maxIdleConns)
+	db.SetConnMaxLifetime(connMaxLifetime)
 
 	log.Info().
 		Str("host", cfg.Host).
 		Str("port", cfg.Port).
 		Str("database", cfg.Database).
 		Str("schema", cfg.Schema).
-		Int("max_open_conns", 25).
-		Int("max_idle_conns", 5).
-		Dur("conn_max_lifetime", 5*time.Minute).
+		Int("max_open_conns", maxOpenConns).
+		Int("max_idle_conns", maxIdleConns).
+		Dur("conn_max_lifetime", connMaxLifetime).
 		Msg("database connection established")
 
 	return &DB{DB: db}, nil
 }
 
+// connectWithRetry opens the database and pings it, retrying with exponential backoff
+// so the application survives starting before the database is ready
+func connectWithRetry(dsn string, cfg Config) (*sqlx.DB, error) {
+	backoff := initialConnectBackoff
+	attempts := cfg.ConnectRetries + 1
+
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		db, err := connect(dsn, cfg.ConnectTimeout)
+		if err == nil {
+			return db, nil
+		}
+		lastErr = err
+
+		if attempt == attempts {
+			break
+		}
+
+		log.Warn().
+			Err(err).
+			Int("attempt", attempt).
+			Int("max_attempts", attempts).
+			Dur("retry_in", backoff).
+			Msg("database connection failed, retrying")
+
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxConnectBackoff)
+	}
+
+	return nil, fmt.Errorf("after %d attempts: %w", attempts, lastErr)
+}
+
+// connect performs a single connection attempt
+func connect(dsn string, timeout time.Duration) (*sqlx.DB, error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	return sqlx.ConnectContext(ctx, "pgx", dsn)
+}
+
 // NewFromEnv creates a new database connection using environment variables
 func NewFromEnv() (*DB, error) {
+	connectRetries, err := envInt("DB_CONNECT_RETRIES", 5)
+	if err != nil {
+		return nil, err
+	}
+	connectTimeout, err := envDuration("DB_CONNECT_TIMEOUT", 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	maxOpenConns, err := envInt("DB_MAX_OPEN_CONNS", defaultMaxOpenConns)
+	if err != nil {
+		return nil, err
+	}
+	maxIdleConns, err := envInt("DB_MAX_IDLE_CONNS", defaultMaxIdleConns)
+	if err != nil {
+		return nil, err
+	}
+	connMaxLifetime, err := envDuration("DB_CONN_MAX_LIFETIME", defaultConnMaxLifetime)
+	if err != nil {
+		return nil, err
+	}
+
 	cfg := Config{
-		Host:     os.Getenv("DB_HOST"),
-		Port:     os.Getenv("DB_PORT"),
-		Database: os.Getenv("DB_DATABASE"),
-		Username: os.Getenv("DB_USERNAME"),
-		Password: os.Getenv("DB_PASSWORD"),
-		Schema:   os.Getenv("DB_SCHEMA"),
+		Host:           os.Getenv("DB_HOST"),
+		Port:           os.Getenv("DB_PORT"),
+		Database:       os.Getenv("DB_DATABASE"),
+		Username:       os.Getenv("DB_USERNAME"),
+		Password:       os.Getenv("DB_PASSWORD"),
+		Schema:         os.Getenv("DB_SCHEMA"),
+		ConnectRetries: connectRetries,
+		ConnectTimeout: connectTimeout,
+
+		MaxOpenConns:    maxOpenConns,
+		MaxIdleConns:    &maxIdleConns,
+		ConnMaxLifetime: connMaxLifetime,
 	}
 	return New(cfg)
 }
 
+// envInt reads a non-negative integer environment variable, falling back to def if unset
+func envInt(key string, def int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s: %q", key, value)
+	}
+	return n, nil
+}
+
+// envDuration reads a duration environment variable such as "5s", falling back to def if unset
+func envDuration(key string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid %s: %q", key, value)
+	}
+	return d, nil
+}
+
 // Health returns database health information
 func (db *DB) Health(ctx context.Context) map[string]string {
 	stats := make(map[string]string)
@@ -77,7 +199,6 @@ func (db *DB) Health(ctx context.Context) map[string]string {
 			Err(err).
 			Msg("database health check failed")
 		stats["status"] = "down"
-		stats["error"] = fmt.Sprintf("database ping failed: %v", err)
 		return stats
 	}
 
@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"strings"
 	"testing"
 	"time"
 
@@ -158,3 +159,54 @@ func TestClose(t *testing.T) {
 		t.Fatalf("expected Close() to return nil")
 	}
 }
+
+func TestNewRetriesUnreachable(t *testing.T) {
+	cfg := Config{
+		Host:           host,
+		Port:           "1", // Nothing listens here
+		Database:       database,
+		Username:       username,
+		Password:       password,
+		Schema:         "public",
+		ConnectRetries: 1,
+		ConnectTimeout: time.Second,
+	}
+
+	start := time.Now()
+	_, err := New(cfg)
+	if err == nil {
+		t.Fatal("expected New() to fail for an unreachable database")
+	}
+	if !strings.Contains(err.Error(), "after 2 attempts") {
+		t.Fatalf("expected error to report both attempts, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < initialConnectBackoff {
+		t.Fatalf("expected backoff between attempts, finished after %v", elapsed)
+	}
+}
+
+func TestNewPoolSettings(t *testing.T) {
+	cfg := Config{
+		Host:         host,
+		Port:         port,
+		Database:     database,
+		Username:     username,
+		Password:     password,
+		Schema:       "public",
+		MaxOpenConns: 7,
+		MaxIdleConns: new(int),
+	}
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	defer srv.Close()
+
+	if got := srv.Stats().MaxOpenConnections; got != 7 {
+		t.Fatalf("expected max open connections to be 7, got %d", got)
+	}
+	// No idle connections are kept, the ping of New is closed right away
+	if got := srv.Stats().Idle; got != 0 {
+		t.Fatalf("expected no idle connections, got %d", got)
+	}
+}
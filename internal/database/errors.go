@@ -0,0 +1,36 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// uniqueViolation is the Postgres error code for unique constraint violations,
+// see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const uniqueViolation = "23505"
+
+// pgError returns the Postgres error wrapped by err, if any
+func pgError(err error) (*pgconn.PgError, bool) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr, true
+	}
+	return nil, false
+}
+
+// IsUniqueViolation reports whether the error was caused by a unique constraint
+func IsUniqueViolation(err error) bool {
+	pgErr, ok := pgError(err)
+	return ok && pgErr.Code == uniqueViolation
+}
+
+// UniqueConstraint returns the name of the unique constraint the error violated,
+// so repositories with several unique columns can tell them apart
+func UniqueConstraint(err error) (string, bool) {
+	pgErr, ok := pgError(err)
+	if !ok || pgErr.Code != uniqueViolation {
+		return "", false
+	}
+	return pgErr.ConstraintName, true
+}
@@ -0,0 +1,30 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestUniqueConstraint(t *testing.T) {
+	err := fmt.Errorf("inserting user: %w", &pgconn.PgError{Code: "23505", ConstraintName: "users_email_key"})
+
+	if !IsUniqueViolation(err) {
+		t.Error("IsUniqueViolation() = false for a wrapped unique violation")
+	}
+	if name, ok := UniqueConstraint(err); !ok || name != "users_email_key" {
+		t.Errorf("UniqueConstraint() = %q, %v, want users_email_key", name, ok)
+	}
+
+	// Other errors, including other Postgres errors, are not unique violations
+	for _, err := range []error{nil, errors.New("duplicate key"), &pgconn.PgError{Code: "23503"}} {
+		if IsUniqueViolation(err) {
+			t.Errorf("IsUniqueViolation(%v) = true", err)
+		}
+		if _, ok := UniqueConstraint(err); ok {
+			t.Errorf("UniqueConstraint(%v) reported a constraint", err)
+		}
+	}
+}
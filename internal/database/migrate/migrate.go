@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"github.com/rs/zerolog/log"
+	"os"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
 	"github.com/jmoiron/sqlx"
 )
@@ -15,16 +17,30 @@ import (
 //go:embed migrations/*.sql
 var migrationsFS embed.FS
 
-// RunMigrations performs database migrations
-func RunMigrations(db *sqlx.DB) error {
+// MigrationInfo describes a single migration and whether it has been applied
+type MigrationInfo struct {
+	Version    uint
+	Identifier string
+	Applied    bool
+}
+
+// Status describes the current schema version and all known migrations
+type Status struct {
+	Version    uint // Currently applied version, 0 if none
+	Dirty      bool // A previous migration failed halfway
+	Migrations []MigrationInfo
+}
+
+// newMigrate creates a migrate instance for the embedded migrations
+func newMigrate(db *sqlx.DB) (*migrate.Migrate, source.Driver, error) {
 	driver, err := postgres.WithInstance(db.DB, &postgres.Config{})
 	if err != nil {
-		return fmt.Errorf("could not create postgres driver: %w", err)
+		return nil, nil, fmt.Errorf("could not create postgres driver: %w", err)
 	}
 
 	d, err := iofs.New(migrationsFS, "migrations")
 	if err != nil {
-		return fmt.Errorf("could not create source driver: %w", err)
+		return nil, nil, fmt.Errorf("could not create source driver: %w", err)
 	}
 
 	m, err := migrate.NewWithInstance(
@@ -32,7 +48,17 @@ func RunMigrations(db *sqlx.DB) error {
 		"postgres", driver,
 	)
 	if err != nil {
-		return fmt.Errorf("could not create migrate instance: %w", err)
+		return nil, nil, fmt.Errorf("could not create migrate instance: %w", err)
+	}
+
+	return m, d, nil
+}
+
+// RunMigrations performs database migrations
+func RunMigrations(db *sqlx.DB) error {
+	m, _, err := newMigrate(db)
+	if err != nil {
+		return err
 	}
 
 	err = m.Up()
@@ -59,22 +85,9 @@ func RunMigrations(db *sqlx.DB) error {
 
 // RollbackMigrations rolls back the last batch of migrations
 func RollbackMigrations(db *sqlx.DB) error {
-	driver, err := postgres.WithInstance(db.DB, &postgres.Config{})
+	m, _, err := newMigrate(db)
 	if err != nil {
-		return fmt.Errorf("could not create postgres driver: %w", err)
-	}
-
-	d, err := iofs.New(migrationsFS, "migrations")
-	if err != nil {
-		return fmt.Errorf("could not create source driver: %w", err)
-	}
-
-	m, err := migrate.NewWithInstance(
-		"iofs", d,
-		"postgres", driver,
-	)
-	if err != nil {
-		return fmt.Errorf("could not create migrate instance: %w", err)
+		return err
 	}
 
 	err = m.Down()
@@ -90,3 +103,72 @@ func RollbackMigrations(db *sqlx.DB) error {
 	log.Info().Msg("migration rollback completed successfully")
 	return nil
 }
+
+// StepDown rolls back the given number of applied migrations
+func StepDown(db *sqlx.DB, steps int) error {
+	if steps <= 0 {
+		return fmt.Errorf("steps must be positive, got %d", steps)
+	}
+
+	m, _, err := newMigrate(db)
+	if err != nil {
+		return err
+	}
+
+	err = m.Steps(-steps)
+	if errors.Is(err, migrate.ErrNoChange) || errors.Is(err, os.ErrNotExist) {
+		log.Info().Msg("no migrations to rollback")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not rollback migrations: %w", err)
+	}
+
+	version, dirty, err := m.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return fmt.Errorf("could not get migration version: %w", err)
+	}
+
+	log.Info().
+		Int("steps", steps).
+		Uint("version", version).
+		Bool("dirty", dirty).
+		Msg("migration rollback completed successfully")
+	return nil
+}
+
+// GetStatus returns the applied and pending migrations
+func GetStatus(db *sqlx.DB) (*Status, error) {
+	m, d, err := newMigrate(db)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{}
+	status.Version, status.Dirty, err = m.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return nil, fmt.Errorf("could not get migration version: %w", err)
+	}
+
+	version, err := d.First()
+	for err == nil {
+		r, identifier, readErr := d.ReadUp(version)
+		if readErr != nil {
+			return nil, fmt.Errorf("could not read migration %d: %w", version, readErr)
+		}
+		_ = r.Close()
+
+		status.Migrations = append(status.Migrations, MigrationInfo{
+			Version:    version,
+			Identifier: identifier,
+			Applied:    version <= status.Version,
+		})
+
+		version, err = d.Next(version)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("could not list migrations: %w", err)
+	}
+
+	return status, nil
+}
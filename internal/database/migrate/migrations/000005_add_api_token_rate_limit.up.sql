@@ -0,0 +1,2 @@
+-- Requests per minute allowed for the token, NULL uses the server default
+ALTER TABLE api_tokens ADD COLUMN rate_limit INTEGER CHECK (rate_limit > 0);
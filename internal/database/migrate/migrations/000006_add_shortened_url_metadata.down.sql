@@ -0,0 +1,4 @@
+ALTER TABLE shortened_urls
+    DROP COLUMN IF EXISTS title,
+    DROP COLUMN IF EXISTS description,
+    DROP COLUMN IF EXISTS favicon_url;
@@ -0,0 +1,5 @@
+-- Link preview metadata fetched from the destination page
+ALTER TABLE shortened_urls
+    ADD COLUMN title TEXT NOT NULL DEFAULT '',
+    ADD COLUMN description TEXT NOT NULL DEFAULT '',
+    ADD COLUMN favicon_url TEXT NOT NULL DEFAULT '';
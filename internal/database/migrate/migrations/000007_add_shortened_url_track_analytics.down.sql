@@ -0,0 +1,2 @@
+ALTER TABLE shortened_urls
+    DROP COLUMN IF EXISTS track_analytics;
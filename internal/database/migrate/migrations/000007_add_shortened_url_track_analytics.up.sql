@@ -0,0 +1,3 @@
+-- Allows creating short links without click tracking
+ALTER TABLE shortened_urls
+    ADD COLUMN track_analytics BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,11 @@
+-- Audit log of API token authentications, only the newest entries per token are kept
+CREATE TABLE token_usage (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    token_id UUID NOT NULL REFERENCES api_tokens(id) ON DELETE CASCADE,
+    used_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ip_address TEXT NOT NULL,
+    endpoint TEXT NOT NULL,
+    status INTEGER NOT NULL
+);
+
+CREATE INDEX idx_token_usage_token_used ON token_usage(token_id, used_at DESC);
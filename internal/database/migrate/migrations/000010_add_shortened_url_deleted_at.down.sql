@@ -0,0 +1,2 @@
+UPDATE shortened_urls SET is_active = false WHERE deleted_at IS NOT NULL;
+ALTER TABLE shortened_urls DROP COLUMN IF EXISTS deleted_at;
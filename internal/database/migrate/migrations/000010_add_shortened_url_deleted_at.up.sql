@@ -0,0 +1,5 @@
+-- Deletion is tracked separately so is_active can pause a link without removing it
+ALTER TABLE shortened_urls ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+
+-- Until now an inactive URL was a deleted one
+UPDATE shortened_urls SET deleted_at = CURRENT_TIMESTAMP WHERE is_active = false;
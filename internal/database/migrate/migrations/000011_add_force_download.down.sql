@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS force_download;
+ALTER TABLE uploaded_files DROP COLUMN IF EXISTS force_download;
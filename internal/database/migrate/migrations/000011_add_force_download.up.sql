@@ -0,0 +1,3 @@
+-- Files of an owner with force_download set, or flagged themselves, are always served as attachments
+ALTER TABLE uploaded_files ADD COLUMN force_download BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN force_download BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,11 @@
+CREATE TABLE file_access_log (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    file_id UUID NOT NULL REFERENCES uploaded_files(id) ON DELETE CASCADE,
+    accessed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    referrer TEXT,
+    user_agent TEXT,
+    ip_address TEXT
+);
+
+CREATE INDEX idx_file_access_log_file ON file_access_log(file_id, accessed_at);
+CREATE INDEX idx_file_access_log_accessed ON file_access_log(accessed_at);
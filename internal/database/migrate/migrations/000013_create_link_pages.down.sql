@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS page_links;
+ALTER TABLE shortened_urls
+    DROP COLUMN IF EXISTS url_type;
@@ -0,0 +1,13 @@
+-- Link pages show a list of destinations at their short code instead of redirecting
+ALTER TABLE shortened_urls
+    ADD COLUMN url_type VARCHAR(10) NOT NULL DEFAULT 'redirect'
+        CHECK (url_type IN ('redirect', 'page'));
+
+CREATE TABLE page_links (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    page_id UUID NOT NULL REFERENCES shortened_urls(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    url TEXT NOT NULL,
+    UNIQUE (page_id, position)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE uploaded_files
+    DROP COLUMN IF EXISTS visibility;
@@ -0,0 +1,4 @@
+-- Private files are only served to their owner, or through a signed download link
+ALTER TABLE uploaded_files
+    ADD COLUMN visibility VARCHAR(10) NOT NULL DEFAULT 'public'
+        CHECK (visibility IN ('public', 'private'));
@@ -0,0 +1,3 @@
+-- Set by the storage verification for files whose object is missing in storage, they are answered with a 404
+ALTER TABLE uploaded_files
+    ADD COLUMN storage_missing BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,10 @@
+-- Storage objects of deleted files whose removal from storage failed, the cleanup worker retries them
+CREATE TABLE pending_deletions (
+    filename TEXT PRIMARY KEY,
+    attempts INTEGER NOT NULL DEFAULT 1,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_pending_deletions_next_attempt ON pending_deletions(next_attempt_at);
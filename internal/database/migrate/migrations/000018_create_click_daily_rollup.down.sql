@@ -0,0 +1 @@
+DROP TABLE IF EXISTS click_daily_rollup;
@@ -0,0 +1,14 @@
+-- Daily click counts of a URL per referrer and country, raw clicks older than ANALYTICS_ROLLUP_DAYS
+-- are aggregated here and deleted. Missing referrers and countries are stored as empty strings.
+CREATE TABLE click_daily_rollup (
+    url_id UUID NOT NULL REFERENCES shortened_urls(id) ON DELETE CASCADE,
+    day TIMESTAMP WITH TIME ZONE NOT NULL,
+    referrer TEXT NOT NULL DEFAULT '',
+    country_code VARCHAR(2) NOT NULL DEFAULT '',
+    clicks INTEGER NOT NULL DEFAULT 0,
+    unique_clicks INTEGER NOT NULL DEFAULT 0,
+    visitors INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (url_id, day, referrer, country_code)
+);
+
+CREATE INDEX idx_click_daily_rollup_day ON click_daily_rollup(day);
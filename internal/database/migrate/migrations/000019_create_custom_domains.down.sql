@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_shortened_urls_domain_code;
+DELETE FROM shortened_urls WHERE domain_id IS NOT NULL;
+ALTER TABLE shortened_urls DROP COLUMN IF EXISTS domain_id;
+ALTER TABLE shortened_urls ADD CONSTRAINT shortened_urls_short_code_key UNIQUE (short_code);
+DROP TABLE IF EXISTS custom_domains;
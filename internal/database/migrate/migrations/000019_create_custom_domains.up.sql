@@ -0,0 +1,19 @@
+-- Branded domains short links can be served on. A domain only becomes usable once its owner
+-- proved control over it, so unverified claims don't block the real owner.
+CREATE TABLE custom_domains (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    domain TEXT NOT NULL,
+    verification_token TEXT NOT NULL,
+    verified_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, domain)
+);
+
+CREATE UNIQUE INDEX idx_custom_domains_verified ON custom_domains(domain) WHERE verified_at IS NOT NULL;
+
+-- Short codes are unique per domain, links on the default domain have no domain_id
+ALTER TABLE shortened_urls ADD COLUMN domain_id UUID REFERENCES custom_domains(id) ON DELETE CASCADE;
+ALTER TABLE shortened_urls DROP CONSTRAINT shortened_urls_short_code_key;
+CREATE UNIQUE INDEX idx_shortened_urls_domain_code
+    ON shortened_urls(COALESCE(domain_id, '00000000-0000-0000-0000-000000000000'), short_code);
@@ -0,0 +1,3 @@
+-- Storage object of the profile picture, NULL for users without one
+ALTER TABLE users
+    ADD COLUMN avatar_key TEXT;
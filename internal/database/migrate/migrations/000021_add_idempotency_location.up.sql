@@ -0,0 +1,3 @@
+-- Location header of the stored response, replayed along with the body for created resources
+ALTER TABLE idempotency_keys
+    ADD COLUMN location TEXT NOT NULL DEFAULT '';
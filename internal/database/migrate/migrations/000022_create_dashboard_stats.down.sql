@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS shortened_urls_dashboard_stats ON shortened_urls;
+DROP TRIGGER IF EXISTS uploaded_files_dashboard_stats ON uploaded_files;
+DROP FUNCTION IF EXISTS invalidate_dashboard_stats();
+DROP TABLE IF EXISTS dashboard_stats;
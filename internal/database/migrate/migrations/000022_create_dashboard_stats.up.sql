@@ -0,0 +1,32 @@
+-- Dashboard totals of users, only used when DASHBOARD_STATS_CACHE_TTL is set
+CREATE TABLE dashboard_stats (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    total_urls BIGINT NOT NULL,
+    total_clicks BIGINT NOT NULL,
+    total_files BIGINT NOT NULL,
+    total_storage BIGINT NOT NULL,
+    computed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    accessed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Creating or deleting files and short links drops the cached totals of their owner, whatever
+-- code path wrote them. Clicks don't, they show up when the totals are refreshed.
+CREATE FUNCTION invalidate_dashboard_stats() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        DELETE FROM dashboard_stats WHERE user_id = OLD.user_id;
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        DELETE FROM dashboard_stats WHERE user_id = NEW.user_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER uploaded_files_dashboard_stats
+    AFTER INSERT OR DELETE ON uploaded_files
+    FOR EACH ROW EXECUTE FUNCTION invalidate_dashboard_stats();
+
+CREATE TRIGGER shortened_urls_dashboard_stats
+    AFTER INSERT OR DELETE OR UPDATE OF deleted_at ON shortened_urls
+    FOR EACH ROW EXECUTE FUNCTION invalidate_dashboard_stats();
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_shortened_urls_user_created;
+DROP INDEX IF EXISTS idx_uploaded_files_user_created;
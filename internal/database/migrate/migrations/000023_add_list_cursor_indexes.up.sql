@@ -0,0 +1,3 @@
+-- Cursor pagination of the file and URL lists seeks to (created_at, id) within the user's rows
+CREATE INDEX idx_uploaded_files_user_created ON uploaded_files(user_id, created_at, id);
+CREATE INDEX idx_shortened_urls_user_created ON shortened_urls(user_id, created_at, id);
@@ -0,0 +1,4 @@
+ALTER TABLE uploaded_files
+    DROP COLUMN IF EXISTS folder_id;
+
+DROP TABLE IF EXISTS folders;
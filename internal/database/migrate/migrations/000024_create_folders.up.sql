@@ -0,0 +1,19 @@
+-- Folders group the files of a user and nest through parent_id
+CREATE TABLE folders (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    parent_id UUID REFERENCES folders(id),
+    name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Names are unique among the folders of one parent, ignoring case. The nil UUID stands in for the
+-- top level as NULLs never collide in unique indexes.
+CREATE UNIQUE INDEX idx_folders_parent_name
+    ON folders(user_id, COALESCE(parent_id, '00000000-0000-0000-0000-000000000000'), LOWER(name));
+CREATE INDEX idx_folders_parent_id ON folders(parent_id);
+
+-- Files of a deleted folder move to the top level unless they were moved beforehand
+ALTER TABLE uploaded_files
+    ADD COLUMN folder_id UUID REFERENCES folders(id) ON DELETE SET NULL;
+CREATE INDEX idx_uploaded_files_folder_id ON uploaded_files(folder_id);
@@ -0,0 +1,19 @@
+-- Sensitive actions of users and admins. Actors are not referenced by a foreign key so the
+-- history outlives deleted accounts, actor_name keeps who they were.
+CREATE TABLE audit_log (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    action VARCHAR(50) NOT NULL,
+    actor_id UUID,
+    actor_name VARCHAR(255) NOT NULL DEFAULT '',
+    target_type VARCHAR(50) NOT NULL DEFAULT '',
+    target_id VARCHAR(255) NOT NULL DEFAULT '',
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    request_id VARCHAR(255) NOT NULL DEFAULT '',
+    result VARCHAR(20) NOT NULL,
+    details TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_audit_log_created_at ON audit_log(created_at);
+CREATE INDEX idx_audit_log_actor_id ON audit_log(actor_id, created_at);
+CREATE INDEX idx_audit_log_action ON audit_log(action, created_at);
@@ -0,0 +1,14 @@
+-- Codes a URL had before its code was regenerated. They stay taken so a leaked code never points
+-- to someone else's link, and keep redirecting to the URL until redirect_until if a grace period
+-- was requested.
+CREATE TABLE short_code_aliases (
+    url_id UUID NOT NULL REFERENCES shortened_urls(id) ON DELETE CASCADE,
+    domain_id UUID REFERENCES custom_domains(id) ON DELETE CASCADE,
+    short_code VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    redirect_until TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX idx_short_code_aliases_domain_code
+    ON short_code_aliases(COALESCE(domain_id, '00000000-0000-0000-0000-000000000000'), short_code);
+CREATE INDEX idx_short_code_aliases_url ON short_code_aliases(url_id);
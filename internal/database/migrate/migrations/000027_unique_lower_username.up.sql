@@ -0,0 +1,2 @@
+-- Usernames that only differ in case could pass as each other, e.g. "Admin" for "admin"
+CREATE UNIQUE INDEX idx_users_username_lower ON users(LOWER(username));
@@ -0,0 +1,3 @@
+-- A changed email address waits here until its verification link is opened, the current address
+-- stays verified so a typo can't lock the user out
+ALTER TABLE users ADD COLUMN pending_email VARCHAR(255);
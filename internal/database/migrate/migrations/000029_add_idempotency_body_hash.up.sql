@@ -0,0 +1,3 @@
+-- SHA-256 of the request body, a retry with the same key and another body is rejected
+ALTER TABLE idempotency_keys
+    ADD COLUMN body_hash TEXT NOT NULL DEFAULT '';
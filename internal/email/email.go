@@ -0,0 +1,102 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrInvalidHeader is returned if a recipient or subject would inject additional mail headers
+var ErrInvalidHeader = errors.New("invalid mail header")
+
+// Emailer sends plain text emails
+type Emailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// NewEmailer returns an SMTP emailer for the host, or an emailer that only logs messages if no host is set
+func NewEmailer(host string, port int, username, password, from string) Emailer {
+	if host == "" {
+		return logEmailer{}
+	}
+	return NewSMTPEmailer(host, port, username, password, from)
+}
+
+// logEmailer writes emails to the log, so links can be followed in development without a mail server
+type logEmailer struct{}
+
+func (logEmailer) Send(_ context.Context, to, subject, body string) error {
+	log.Info().
+		Str("to", to).
+		Str("subject", subject).
+		Str("body", body).
+		Msg("email not sent, no SMTP host configured")
+	return nil
+}
+
+// SMTPEmailer sends emails through an SMTP server, using STARTTLS if the server offers it
+type SMTPEmailer struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+}
+
+// NewSMTPEmailer creates an emailer for the server. Authentication is skipped if no username is set.
+func NewSMTPEmailer(host string, port int, username, password, from string) *SMTPEmailer {
+	return &SMTPEmailer{
+		addr:     net.JoinHostPort(host, strconv.Itoa(port)),
+		host:     host,
+		username: username,
+		password: password,
+		from:     from,
+	}
+}
+
+func (e *SMTPEmailer) Send(ctx context.Context, to, subject, body string) error {
+	for _, header := range []string{to, subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return ErrInvalidHeader
+		}
+	}
+
+	var auth smtp.Auth
+	if e.username != "" {
+		auth = smtp.PlainAuth("", e.username, e.password, e.host)
+	}
+
+	msg := strings.Join([]string{
+		"From: " + e.from,
+		"To: " + to,
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		strings.ReplaceAll(body, "\n", "\r\n"),
+	}, "\r\n")
+
+	// net/smtp has no context support, the send is abandoned once the context is done
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(e.addr, auth, e.from, []string{to}, []byte(msg))
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("sending email: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,6 @@
+package idempotency
+
+import "errors"
+
+// ErrNotFound is returned when no record exists for the key
+var ErrNotFound = errors.New("idempotency key not found")
@@ -0,0 +1,115 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+	"volaticus-go/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// Record is the stored outcome of a request sent with an idempotency key
+type Record struct {
+	UserID      uuid.UUID `db:"user_id"`
+	Key         string    `db:"idempotency_key"`
+	Request     string    `db:"request"` // Method and path the key was first used for
+	Status      int       `db:"status"`  // 0 while the first request is still running
+	ContentType string    `db:"content_type"`
+	Location    string    `db:"location"` // Location header of responses to created resources
+	Body        []byte    `db:"body"`
+	BodyHash    string    `db:"body_hash"` // Hex SHA-256 of the request body, retries must send the same
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+// Repository defines methods for idempotency key persistence
+type Repository interface {
+	// Reserve claims the key of the user for a request, taking over records created before
+	// expiredBefore. It returns false if the key is still taken by another request.
+	Reserve(ctx context.Context, userID uuid.UUID, key, request string, expiredBefore time.Time) (bool, error)
+	Get(ctx context.Context, userID uuid.UUID, key string) (*Record, error)
+	Complete(ctx context.Context, userID uuid.UUID, key string, status int, contentType, location string, body []byte, bodyHash string) error
+	Release(ctx context.Context, userID uuid.UUID, key string) error
+	DeleteBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+type repository struct {
+	*database.Repository
+}
+
+// NewRepository creates a new idempotency key repository
+func NewRepository(db *database.DB) Repository {
+	return &repository{
+		Repository: database.NewRepository(db),
+	}
+}
+
+func (r *repository) Reserve(ctx context.Context, userID uuid.UUID, key, request string, expiredBefore time.Time) (bool, error) {
+	result, err := r.Exec(ctx, `
+        INSERT INTO idempotency_keys (user_id, idempotency_key, request)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (user_id, idempotency_key) DO UPDATE
+        SET request = EXCLUDED.request,
+            status = 0,
+            content_type = '',
+            location = '',
+            body = NULL,
+            body_hash = '',
+            created_at = CURRENT_TIMESTAMP
+        WHERE idempotency_keys.created_at < $4`,
+		userID, key, request, expiredBefore,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	return rows == 1, err
+}
+
+func (r *repository) Get(ctx context.Context, userID uuid.UUID, key string) (*Record, error) {
+	record := new(Record)
+	err := r.Repository.Get(ctx, record, `
+        SELECT * FROM idempotency_keys
+        WHERE user_id = $1 AND idempotency_key = $2`,
+		userID, key,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return record, err
+}
+
+// Complete stores the response of the request holding the key
+func (r *repository) Complete(ctx context.Context, userID uuid.UUID, key string, status int, contentType, location string, body []byte, bodyHash string) error {
+	_, err := r.Exec(ctx, `
+        UPDATE idempotency_keys
+        SET status = $3,
+            content_type = $4,
+            location = $5,
+            body = $6,
+            body_hash = $7
+        WHERE user_id = $1 AND idempotency_key = $2`,
+		userID, key, status, contentType, location, body, bodyHash,
+	)
+	return err
+}
+
+// Release frees the key after a failed request so a retry runs it again
+func (r *repository) Release(ctx context.Context, userID uuid.UUID, key string) error {
+	_, err := r.Exec(ctx,
+		"DELETE FROM idempotency_keys WHERE user_id = $1 AND idempotency_key = $2",
+		userID, key,
+	)
+	return err
+}
+
+// DeleteBefore removes the records created before the given time
+func (r *repository) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.Exec(ctx, "DELETE FROM idempotency_keys WHERE created_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,193 @@
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"os"
+	"testing"
+	"time"
+	"volaticus-go/internal/database"
+	"volaticus-go/internal/database/migrate"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+var (
+	testHost     string
+	testPort     string
+	testDatabase string
+	testUsername string
+	testPassword string
+)
+
+func TestMain(m *testing.M) {
+	// Start the container before running tests
+	teardown, err := mustStartPostgresContainer()
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("could not start postgres container")
+	}
+
+	// Run the tests
+	code := m.Run()
+
+	// Cleanup after tests finish
+	if teardown != nil {
+		if err := teardown(context.Background()); err != nil {
+			log.Warn().
+				Err(err).
+				Msg("could not teardown postgres container")
+		}
+	}
+
+	os.Exit(code)
+}
+
+// Setup Postgres container for testing
+func mustStartPostgresContainer() (func(context.Context) error, error) {
+	ctx := context.Background()
+	var (
+		dbName = "testdb"
+		dbPwd  = "testpass"
+		dbUser = "testuser"
+	)
+
+	container, err := postgres.Run(ctx, "postgres:14-alpine",
+		postgres.WithDatabase(dbName),
+		postgres.WithUsername(dbUser),
+		postgres.WithPassword(dbPwd),
+		testcontainers.WithWaitStrategy(
+			wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2).
+				WithStartupTimeout(5*time.Second)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set the global test variables
+	testDatabase = dbName
+	testPassword = dbPwd
+	testUsername = dbUser
+
+	// Get host and port
+	host, err := container.Host(ctx)
+	if err != nil {
+		return container.Terminate, err
+	}
+	testHost = host
+
+	port, err := container.MappedPort(ctx, "5432")
+	if err != nil {
+		return container.Terminate, err
+	}
+	testPort = port.Port()
+
+	log.Info().
+		Str("host", testHost).
+		Str("port", testPort).
+		Msg("Started postgres container")
+	return container.Terminate, nil
+}
+
+func setupTestDB(t *testing.T) *database.DB {
+	cfg := database.Config{
+		Host:     testHost,
+		Port:     testPort,
+		Database: testDatabase,
+		Username: testUsername,
+		Password: testPassword,
+		Schema:   "public",
+	}
+	db, err := database.New(cfg)
+	require.NoError(t, err)
+	require.NotNil(t, db)
+
+	// Run migrations to create necessary tables
+	err = migrate.RunMigrations(db.DB)
+	require.NoError(t, err)
+
+	return db
+}
+
+// createTestUser creates a test user and returns its ID
+func createTestUser(ctx context.Context, db *database.DB) (uuid.UUID, error) {
+	userID := uuid.New()
+	// Unique email and username for every test user
+	email := fmt.Sprintf("test-%s@example.com", uuid.New().String())
+	username := fmt.Sprintf("testuser-%s", uuid.New().String())
+
+	query := `
+        INSERT INTO users (id, email, username, password_hash) 
+        VALUES ($1, $2, $3, $4)
+    `
+	_, err := db.ExecContext(ctx, query,
+		userID,
+		email,
+		username,
+		"hashedpassword",
+	)
+	return userID, err
+}
+
+func TestRepository_Keys(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	ctx := context.Background()
+	userID, err := createTestUser(ctx, db)
+	require.NoError(t, err)
+	longAgo := time.Now().Add(-time.Hour)
+
+	t.Run("reserve and complete", func(t *testing.T) {
+		reserved, err := repo.Reserve(ctx, userID, "key-1", "POST /api/v1/upload", longAgo)
+		require.NoError(t, err)
+		assert.True(t, reserved)
+
+		reserved, err = repo.Reserve(ctx, userID, "key-1", "POST /api/v1/upload", longAgo)
+		require.NoError(t, err)
+		assert.False(t, reserved, "a taken key was reserved again")
+
+		require.NoError(t, repo.Complete(ctx, userID, "key-1", 201, "application/json", "/api/v1/files/1", []byte(`{"success":true}`), "abc123"))
+
+		record, err := repo.Get(ctx, userID, "key-1")
+		require.NoError(t, err)
+		assert.Equal(t, 201, record.Status)
+		assert.Equal(t, "application/json", record.ContentType)
+		assert.Equal(t, "/api/v1/files/1", record.Location)
+		assert.Equal(t, `{"success":true}`, string(record.Body))
+		assert.Equal(t, "abc123", record.BodyHash)
+	})
+
+	t.Run("expired keys are taken over", func(t *testing.T) {
+		reserved, err := repo.Reserve(ctx, userID, "key-1", "POST /api/v1/shorten", time.Now().Add(time.Minute))
+		require.NoError(t, err)
+		assert.True(t, reserved)
+
+		record, err := repo.Get(ctx, userID, "key-1")
+		require.NoError(t, err)
+		assert.Equal(t, 0, record.Status)
+		assert.Equal(t, "POST /api/v1/shorten", record.Request)
+		assert.Empty(t, record.BodyHash)
+	})
+
+	t.Run("release and purge", func(t *testing.T) {
+		require.NoError(t, repo.Release(ctx, userID, "key-1"))
+		_, err := repo.Get(ctx, userID, "key-1")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		_, err = repo.Reserve(ctx, userID, "key-2", "POST /api/v1/upload", longAgo)
+		require.NoError(t, err)
+		deleted, err := repo.DeleteBefore(ctx, time.Now().Add(time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), deleted)
+	})
+}
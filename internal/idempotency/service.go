@@ -0,0 +1,249 @@
+// Package idempotency replays the stored response of API requests that are retried with the
+// same Idempotency-Key header, so a retry after a lost response doesn't create a duplicate.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"time"
+	"volaticus-go/internal/common/apierror"
+	userctx "volaticus-go/internal/context"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// Header is the request header carrying the idempotency key
+	Header = "Idempotency-Key"
+	// ReplayedHeader is set on responses that are replayed from an earlier request
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+	// maxStoredBody is the largest response that is stored, larger ones are not replayed
+	maxStoredBody = 64 * 1024
+)
+
+type Service struct {
+	repo Repository
+	ttl  time.Duration
+}
+
+// NewService creates a service remembering the responses of idempotency keys for ttl
+func NewService(repo Repository, ttl time.Duration) *Service {
+	return &Service{
+		repo: repo,
+		ttl:  ttl,
+	}
+}
+
+// Middleware runs a request with an Idempotency-Key header once per user and key, retries get
+// the stored response. Requests without the header or without a user are passed through.
+func (s *Service) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(Header)
+		user := userctx.GetUserFromContext(r.Context())
+		if key == "" || user == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > maxKeyLength {
+			apierror.Write(w, &apierror.APIError{
+				Code:    apierror.ErrCodeInvalidInput,
+				Message: fmt.Sprintf("%s must be at most %d characters", Header, maxKeyLength),
+			}, http.StatusBadRequest)
+			return
+		}
+
+		request := r.Method + " " + r.URL.Path
+		reserved, err := s.repo.Reserve(r.Context(), user.ID, key, request, time.Now().Add(-s.ttl))
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("user_id", user.ID.String()).
+				Msg("Failed to reserve idempotency key")
+			apierror.Write(w, &apierror.APIError{
+				Code:    apierror.ErrCodeInternalError,
+				Message: "Failed to check the idempotency key",
+			}, http.StatusInternalServerError)
+			return
+		}
+		if !reserved {
+			s.replay(w, r, user.ID, key, request)
+			return
+		}
+
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		completed := false
+		// The store outlives the request, a client giving up must not leave the key reserved
+		ctx := context.WithoutCancel(r.Context())
+		defer func() {
+			if !completed {
+				s.release(ctx, user.ID, key)
+			}
+		}()
+
+		body := hashBody(r)
+		next.ServeHTTP(rec, r)
+
+		// Server errors and oversized responses are not stored, a retry runs the request again
+		if rec.status >= http.StatusInternalServerError || rec.overflow {
+			return
+		}
+		bodyHash := body.sum()
+		if err := s.repo.Complete(ctx, user.ID, key, rec.status, rec.Header().Get("Content-Type"), rec.Header().Get("Location"), rec.body.Bytes(), bodyHash); err != nil {
+			log.Error().
+				Err(err).
+				Str("user_id", user.ID.String()).
+				Msg("Failed to store idempotent response")
+			return
+		}
+		completed = true
+	})
+}
+
+// replay writes the stored response of a key that is already taken
+func (s *Service) replay(w http.ResponseWriter, r *http.Request, userID uuid.UUID, key, request string) {
+	record, err := s.repo.Get(r.Context(), userID, key)
+	if errors.Is(err, ErrNotFound) {
+		// The first request failed and released the key in the meantime
+		apierror.Write(w, &apierror.APIError{
+			Code:    apierror.ErrCodeAlreadyExists,
+			Message: "A request with this idempotency key just failed, please retry",
+		}, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("user_id", userID.String()).
+			Msg("Failed to retrieve idempotent response")
+		apierror.Write(w, &apierror.APIError{
+			Code:    apierror.ErrCodeInternalError,
+			Message: "Failed to check the idempotency key",
+		}, http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case record.Request != request:
+		apierror.Write(w, &apierror.APIError{
+			Code:    apierror.ErrCodeRejected,
+			Message: "The idempotency key was already used for a different request",
+		}, http.StatusUnprocessableEntity)
+	case record.Status == 0:
+		apierror.Write(w, &apierror.APIError{
+			Code:    apierror.ErrCodeAlreadyExists,
+			Message: "A request with this idempotency key is still in progress",
+		}, http.StatusConflict)
+	// Records stored before bodies were hashed have no hash to compare
+	case record.BodyHash != "" && hashBody(r).sum() != record.BodyHash:
+		apierror.Write(w, &apierror.APIError{
+			Code:    apierror.ErrCodeRejected,
+			Message: "The idempotency key was already used with a different request body",
+		}, http.StatusUnprocessableEntity)
+	default:
+		if record.ContentType != "" {
+			w.Header().Set("Content-Type", record.ContentType)
+		}
+		if record.Location != "" {
+			w.Header().Set("Location", record.Location)
+		}
+		w.Header().Set(ReplayedHeader, "true")
+		w.WriteHeader(record.Status)
+		if _, err := w.Write(record.Body); err != nil {
+			log.Debug().
+				Err(err).
+				Msg("Failed to write idempotent response")
+		}
+	}
+}
+
+func (s *Service) release(ctx context.Context, userID uuid.UUID, key string) {
+	if err := s.repo.Release(ctx, userID, key); err != nil {
+		log.Error().
+			Err(err).
+			Str("user_id", userID.String()).
+			Msg("Failed to release idempotency key")
+	}
+}
+
+// PurgeExpired deletes the records older than the TTL
+func (s *Service) PurgeExpired(ctx context.Context) error {
+	deleted, err := s.repo.DeleteBefore(ctx, time.Now().Add(-s.ttl))
+	if err != nil {
+		return fmt.Errorf("deleting expired idempotency keys: %w", err)
+	}
+
+	if deleted > 0 {
+		log.Info().
+			Int64("deleted", deleted).
+			Msg("Purged expired idempotency keys")
+	}
+	return nil
+}
+
+// hashedBody hashes the request body while the handler reads it
+type hashedBody struct {
+	io.Reader
+	io.Closer
+	hash hash.Hash
+}
+
+// hashBody replaces the body of r with one hashing what is read from it
+func hashBody(r *http.Request) *hashedBody {
+	body := &hashedBody{Closer: r.Body, hash: sha256.New()}
+	body.Reader = io.TeeReader(r.Body, body.hash)
+	r.Body = body
+	return body
+}
+
+// sum reads the rest of the body the handler left and returns the hex SHA-256 of all of it.
+// Bodies above the request size limit are hashed up to the limit, like their retries.
+func (b *hashedBody) sum() string {
+	_, _ = io.Copy(io.Discard, b.Reader)
+	return hex.EncodeToString(b.hash.Sum(nil))
+}
+
+// recorder passes the response through while keeping a copy of it
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+	overflow    bool
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	if !r.overflow {
+		if r.body.Len()+len(b) > maxStoredBody {
+			r.overflow = true
+			r.body.Reset()
+		} else {
+			r.body.Write(b)
+		}
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap gives http.ResponseController access to the connection, e.g. to lift the deadlines of uploads
+func (r *recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
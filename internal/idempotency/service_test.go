@@ -0,0 +1,184 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	userctx "volaticus-go/internal/context"
+
+	"github.com/google/uuid"
+)
+
+// memoryRepository keeps records in a map and ignores expiration
+type memoryRepository struct {
+	mu      sync.Mutex
+	records map[string]*Record
+}
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{records: make(map[string]*Record)}
+}
+
+func (m *memoryRepository) Reserve(_ context.Context, userID uuid.UUID, key, request string, _ time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.records[userID.String()+key]; ok {
+		return false, nil
+	}
+	m.records[userID.String()+key] = &Record{UserID: userID, Key: key, Request: request}
+	return true, nil
+}
+
+func (m *memoryRepository) Get(_ context.Context, userID uuid.UUID, key string) (*Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record, ok := m.records[userID.String()+key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return record, nil
+}
+
+func (m *memoryRepository) Complete(_ context.Context, userID uuid.UUID, key string, status int, contentType, location string, body []byte, bodyHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record := m.records[userID.String()+key]
+	record.Status, record.ContentType, record.Location, record.Body, record.BodyHash = status, contentType, location, body, bodyHash
+	return nil
+}
+
+func (m *memoryRepository) Release(_ context.Context, userID uuid.UUID, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, userID.String()+key)
+	return nil
+}
+
+func (m *memoryRepository) DeleteBefore(context.Context, time.Time) (int64, error) {
+	return 0, nil
+}
+
+// countingHandler answers with the given status and counts how often it ran
+type countingHandler struct {
+	calls  int
+	status int
+}
+
+func (h *countingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.calls++
+	w.Header().Set("Content-Type", "application/json")
+	if h.status == http.StatusCreated {
+		w.Header().Set("Location", "/api/v1/files/1")
+	}
+	w.WriteHeader(h.status)
+	w.Write([]byte(`{"success":true}`))
+}
+
+func idempotentRequest(userID uuid.UUID, path, key string) *http.Request {
+	return idempotentRequestWithBody(userID, path, key, "")
+}
+
+func idempotentRequestWithBody(userID uuid.UUID, path, key, body string) *http.Request {
+	r := httptest.NewRequest("POST", path, strings.NewReader(body))
+	if key != "" {
+		r.Header.Set(Header, key)
+	}
+	return r.WithContext(userctx.WithUser(r.Context(), &userctx.UserInfo{ID: userID, Username: "alice"}))
+}
+
+func TestMiddlewareReplays(t *testing.T) {
+	handler := &countingHandler{status: http.StatusCreated}
+	middleware := NewService(newMemoryRepository(), time.Hour).Middleware(handler)
+	userID := uuid.New()
+
+	first := httptest.NewRecorder()
+	middleware.ServeHTTP(first, idempotentRequest(userID, "/api/v1/shorten", "key-1"))
+	retry := httptest.NewRecorder()
+	middleware.ServeHTTP(retry, idempotentRequest(userID, "/api/v1/shorten", "key-1"))
+
+	if handler.calls != 1 {
+		t.Errorf("handler ran %d times, want 1", handler.calls)
+	}
+	if retry.Body.String() != first.Body.String() || retry.Code != first.Code {
+		t.Errorf("replay = %d %q, want %d %q", retry.Code, retry.Body, first.Code, first.Body)
+	}
+	if retry.Header().Get(ReplayedHeader) != "true" {
+		t.Errorf("replay is missing the %s header", ReplayedHeader)
+	}
+	if retry.Header().Get("Location") != "/api/v1/files/1" {
+		t.Errorf("replay Location = %q, want the first response's", retry.Header().Get("Location"))
+	}
+
+	// Keys are scoped per user
+	middleware.ServeHTTP(httptest.NewRecorder(), idempotentRequest(uuid.New(), "/api/v1/shorten", "key-1"))
+	if handler.calls != 2 {
+		t.Errorf("handler ran %d times after another user used the key, want 2", handler.calls)
+	}
+}
+
+func TestMiddlewareDifferentRequest(t *testing.T) {
+	handler := &countingHandler{status: http.StatusOK}
+	middleware := NewService(newMemoryRepository(), time.Hour).Middleware(handler)
+	userID := uuid.New()
+
+	middleware.ServeHTTP(httptest.NewRecorder(), idempotentRequest(userID, "/api/v1/shorten", "key-1"))
+	w := httptest.NewRecorder()
+	middleware.ServeHTTP(w, idempotentRequest(userID, "/api/v1/upload", "key-1"))
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestMiddlewareDifferentBody(t *testing.T) {
+	handler := &countingHandler{status: http.StatusCreated}
+	middleware := NewService(newMemoryRepository(), time.Hour).Middleware(handler)
+	userID := uuid.New()
+
+	middleware.ServeHTTP(httptest.NewRecorder(), idempotentRequestWithBody(userID, "/api/v1/shorten", "key-1", `{"url": "https://example.com/a"}`))
+
+	same := httptest.NewRecorder()
+	middleware.ServeHTTP(same, idempotentRequestWithBody(userID, "/api/v1/shorten", "key-1", `{"url": "https://example.com/a"}`))
+	if same.Code != http.StatusCreated || same.Header().Get(ReplayedHeader) != "true" {
+		t.Errorf("retry with the same body = %d, want the replayed response", same.Code)
+	}
+
+	other := httptest.NewRecorder()
+	middleware.ServeHTTP(other, idempotentRequestWithBody(userID, "/api/v1/shorten", "key-1", `{"url": "https://example.com/b"}`))
+	if other.Code != http.StatusUnprocessableEntity {
+		t.Errorf("retry with another body status = %d, want %d", other.Code, http.StatusUnprocessableEntity)
+	}
+	if handler.calls != 1 {
+		t.Errorf("handler ran %d times, want 1", handler.calls)
+	}
+}
+
+func TestMiddlewareServerErrorNotStored(t *testing.T) {
+	handler := &countingHandler{status: http.StatusInternalServerError}
+	middleware := NewService(newMemoryRepository(), time.Hour).Middleware(handler)
+	userID := uuid.New()
+
+	for i := 0; i < 2; i++ {
+		middleware.ServeHTTP(httptest.NewRecorder(), idempotentRequest(userID, "/api/v1/upload", "key-1"))
+	}
+	if handler.calls != 2 {
+		t.Errorf("handler ran %d times, want the failed request to run again", handler.calls)
+	}
+}
+
+func TestMiddlewareWithoutKey(t *testing.T) {
+	handler := &countingHandler{status: http.StatusOK}
+	middleware := NewService(newMemoryRepository(), time.Hour).Middleware(handler)
+	userID := uuid.New()
+
+	for i := 0; i < 2; i++ {
+		middleware.ServeHTTP(httptest.NewRecorder(), idempotentRequest(userID, "/api/v1/upload", ""))
+	}
+	if handler.calls != 2 {
+		t.Errorf("handler ran %d times, want every request without a key to run", handler.calls)
+	}
+}
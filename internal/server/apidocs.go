@@ -0,0 +1,378 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"volaticus-go/cmd/web/pages"
+	"volaticus-go/internal/common/models"
+	"volaticus-go/internal/shortener"
+	"volaticus-go/internal/uploader"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// Where a parameter of an API endpoint is sent
+const (
+	inHeader = "header"
+	inQuery  = "query"
+	inForm   = "form" // multipart form field
+)
+
+// apiParam is a documented query, header or form parameter of an API endpoint, path parameters
+// are part of the path. Required parameters and those with an example are in the curl command.
+type apiParam struct {
+	Name        string
+	In          string
+	Description string
+	Example     string
+	Required    bool
+}
+
+// apiEndpoint documents a route of the public API. Method and Path match the chi route,
+// the docs page only lists endpoints that are registered.
+type apiEndpoint struct {
+	Method  string
+	Path    string
+	Summary string
+	Params  []apiParam
+	Body    string // Example JSON request body
+	Upload  string // Example file sent as the raw request body
+
+	OptionalAuth bool // Also callable without an API token
+
+	// Values of the JSON bodies, their types are the schemas of the OpenAPI document
+	Request  any
+	Response any
+	Status   int // Status of a successful response, 200 if zero
+	Error    any // Body of error responses, apierror.APIError if nil
+}
+
+const tokenPlaceholder = "YOUR_API_TOKEN"
+
+var (
+	pageParam  = apiParam{Name: "page", In: inQuery, Description: "Page to return, starting at 1"}
+	limitParam = apiParam{Name: "limit", In: inQuery, Description: "Items per page, capped at MAX_PAGE_SIZE (50 by default)"}
+
+	cursorParam = apiParam{
+		Name:        "cursor",
+		In:          inQuery,
+		Description: "next_cursor of the previous page, empty for the first one. Replaces page, items added meanwhile don't shift it",
+	}
+	idempotencyParam = apiParam{
+		Name:        "Idempotency-Key",
+		In:          inHeader,
+		Description: "Retries with the same key return the first response instead of running again",
+	}
+	expiresInParam = apiParam{
+		Name:        "X-Expires-In",
+		In:          inHeader,
+		Description: `Lifetime of the file like 90m, 12h or 7d, or "never"`,
+	}
+	forceDownloadParam = apiParam{
+		Name:        "X-Force-Download",
+		In:          inHeader,
+		Description: "true serves the file as a download instead of rendering it in the browser",
+	}
+)
+
+var apiEndpoints = []apiEndpoint{
+	{
+		Method:  http.MethodPost,
+		Path:    "/api/v1/upload",
+		Summary: "Upload one or more files, repeat the file field for several",
+		Params: []apiParam{
+			{Name: "file", In: inForm, Description: "The file to upload", Example: "@/path/to/your/file.jpg", Required: true},
+			{Name: "Url-Type", In: inHeader, Description: "URL style: default, original_name, random, date, uuid or gfycat"},
+			expiresInParam,
+			forceDownloadParam,
+			idempotencyParam,
+		},
+		Response: uploader.APIUploadResponse{},
+		Error:    uploader.APIUploadResponse{},
+		Status:   http.StatusCreated,
+	},
+	{
+		Method:  http.MethodPut,
+		Path:    "/api/v1/upload",
+		Summary: "Upload the raw request body as one file",
+		Params: []apiParam{
+			{Name: "X-Filename", In: inHeader, Description: "Name of the file, derived from Content-Type if missing", Example: "report.pdf"},
+			expiresInParam,
+			forceDownloadParam,
+		},
+		Upload:   "./report.pdf",
+		Response: uploader.APIUploadResponse{},
+		Error:    uploader.APIUploadResponse{},
+		Status:   http.StatusCreated,
+	},
+	{
+		Method:   http.MethodPost,
+		Path:     "/api/v1/shorten",
+		Summary:  "Shorten a URL, vanity_code, expires_at, track_analytics and domain are optional",
+		Params:   []apiParam{idempotencyParam},
+		Body:     `{"url": "https://example.com/a/long/link", "vanity_code": "my-link"}`,
+		Request:  models.CreateURLRequest{},
+		Response: models.CreateURLResponse{},
+		Status:   http.StatusCreated,
+	},
+	{
+		Method:   http.MethodPost,
+		Path:     "/api/v1/pages",
+		Summary:  "Create a link page listing up to 50 links under one short code",
+		Body:     `{"vanity_code": "me", "title": "My links", "links": [{"title": "Blog", "url": "https://blog.example.com"}]}`,
+		Request:  models.CreatePageRequest{},
+		Response: models.CreateURLResponse{},
+		Status:   http.StatusCreated,
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/api/v1/pages/{urlID}",
+		Summary:  "Get a link page with its links",
+		Response: models.LinkPage{},
+	},
+	{
+		Method:   http.MethodPut,
+		Path:     "/api/v1/pages/{urlID}",
+		Summary:  "Replace the title, description and links of a link page",
+		Body:     `{"title": "My links", "links": [{"title": "Shop", "url": "https://shop.example.com"}]}`,
+		Request:  models.UpdatePageRequest{},
+		Response: models.LinkPage{},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/v1/files",
+		Summary: "List your files, newest first",
+		Params: []apiParam{
+			pageParam,
+			limitParam,
+			cursorParam,
+			{Name: "folder_id", In: inQuery, Description: "Only list the files directly in this folder"},
+		},
+		Response: uploader.APIFileListResponse{},
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/api/v1/files/{fileID}",
+		Summary:  "Get the metadata of one of your files",
+		Response: uploader.APIFile{},
+	},
+	{
+		Method:  http.MethodDelete,
+		Path:    "/api/v1/files/{fileID}",
+		Summary: "Delete one of your files, or any file with the delete token of its upload",
+		Params: []apiParam{
+			{Name: "token", In: inQuery, Description: "Delete token returned by the upload, replaces the API token"},
+		},
+		OptionalAuth: true,
+		Response:     uploader.APIUploadResponse{},
+		Error:        uploader.APIUploadResponse{},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/v1/urls",
+		Summary: "List your short links",
+		Params: []apiParam{
+			pageParam,
+			limitParam,
+			cursorParam,
+			{Name: "sort", In: inQuery, Description: "newest, oldest, clicks or expires, only newest and oldest with a cursor"},
+		},
+		Response: shortener.APIURLListResponse{},
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/api/v1/urls/{urlID}",
+		Summary:  "Get one of your short links with its click analytics",
+		Response: models.URLAnalytics{},
+	},
+	{
+		Method:   http.MethodDelete,
+		Path:     "/api/v1/urls/{urlID}",
+		Summary:  "Delete one of your short links or link pages",
+		Response: map[string]bool{"success": true},
+	},
+	{
+		Method:   http.MethodPost,
+		Path:     "/api/v1/urls/{urlID}/regenerate",
+		Summary:  "Replace the code of one of your short links, the old code keeps redirecting for grace_hours (at most 168)",
+		Body:     `{"grace_hours": 24}`,
+		Request:  models.RegenerateCodeRequest{},
+		Response: models.CreateURLResponse{},
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/api/v1/folders",
+		Summary:  "List all your folders, parent_id nests them and is missing at the top level",
+		Response: uploader.APIFolderListResponse{},
+	},
+	{
+		Method:   http.MethodPost,
+		Path:     "/api/v1/folders",
+		Summary:  "Create a folder, inside parent_id if it is given",
+		Body:     `{"name": "Screenshots", "parent_id": ""}`,
+		Request:  models.FolderRequest{},
+		Response: models.Folder{},
+		Status:   http.StatusCreated,
+	},
+	{
+		Method:   http.MethodPatch,
+		Path:     "/api/v1/folders/{folderID}",
+		Summary:  "Rename one of your folders",
+		Body:     `{"name": "Archive"}`,
+		Request:  models.FolderRequest{},
+		Response: models.Folder{},
+	},
+	{
+		Method:  http.MethodDelete,
+		Path:    "/api/v1/folders/{folderID}",
+		Summary: "Delete one of your folders. Depending on the server it must be empty, or its contents move up to its parent",
+		Status:  http.StatusNoContent,
+	},
+	{
+		Method:   http.MethodPost,
+		Path:     "/api/v1/files/move",
+		Summary:  "Move up to 100 of your files into a folder, an empty folder_id moves them to the top level",
+		Body:     `{"ids": ["FILE_ID"], "folder_id": "FOLDER_ID"}`,
+		Request:  models.MoveFilesRequest{},
+		Response: models.MoveFilesResponse{},
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/api/v1/domains",
+		Summary:  "List your custom domains with the records that verify them",
+		Response: shortener.APIDomainListResponse{},
+	},
+	{
+		Method:   http.MethodPost,
+		Path:     "/api/v1/domains",
+		Summary:  "Add a custom domain, publish its token in the TXT record or well-known file to verify it",
+		Body:     `{"domain": "go.example.com"}`,
+		Request:  models.AddDomainRequest{},
+		Response: shortener.APIDomain{},
+		Status:   http.StatusCreated,
+	},
+	{
+		Method:   http.MethodPost,
+		Path:     "/api/v1/domains/{domainID}/verify",
+		Summary:  "Check the TXT record or well-known file of a domain, links can use it once it is verified",
+		Response: shortener.APIDomain{},
+	},
+	{
+		Method:   http.MethodDelete,
+		Path:     "/api/v1/domains/{domainID}",
+		Summary:  "Delete a custom domain that has no short links",
+		Response: map[string]bool{"success": true},
+	},
+}
+
+// curl returns a command calling the endpoint on the server at baseURL
+func (e apiEndpoint) curl(baseURL string) string {
+	var query []string
+	for _, p := range e.Params {
+		if p.In == inQuery && p.Example != "" {
+			query = append(query, p.Name+"="+p.Example)
+		}
+	}
+	// Path parameters become placeholders like <fileID>
+	target := baseURL + strings.NewReplacer("{", "<", "}", ">").Replace(e.Path)
+	if len(query) > 0 {
+		target += "?" + strings.Join(query, "&")
+	}
+
+	var command string
+	switch {
+	case e.Upload != "":
+		command = fmt.Sprintf("curl --upload-file %s %q", e.Upload, target)
+	case e.Method == http.MethodGet:
+		command = fmt.Sprintf("curl %q", target)
+	default:
+		command = fmt.Sprintf("curl -X %s %q", e.Method, target)
+	}
+
+	parts := []string{command, fmt.Sprintf(`-H "Authorization: Bearer %s"`, tokenPlaceholder)}
+	for _, p := range e.Params {
+		if p.Example == "" && !p.Required {
+			continue
+		}
+		switch p.In {
+		case inHeader:
+			parts = append(parts, fmt.Sprintf(`-H "%s: %s"`, p.Name, p.Example))
+		case inForm:
+			parts = append(parts, fmt.Sprintf(`-F "%s=%s"`, p.Name, p.Example))
+		}
+	}
+	if e.Body != "" {
+		parts = append(parts, `-H "Content-Type: application/json"`, "-d '"+e.Body+"'")
+	}
+	return strings.Join(parts, " \\\n  ")
+}
+
+// apiRoutes returns the documented endpoints that are registered, and the registered /api/v1
+// routes without documentation with only their method and path
+func (s *Server) apiRoutes() (documented, undocumented []apiEndpoint) {
+	known := make(map[string]bool, len(apiEndpoints))
+	for _, e := range apiEndpoints {
+		known[e.Method+" "+e.Path] = true
+	}
+
+	registered := make(map[string]bool)
+	if s.routes != nil {
+		err := chi.Walk(s.routes, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+			if !strings.HasPrefix(route, "/api/v1/") {
+				return nil
+			}
+			registered[method+" "+route] = true
+			if !known[method+" "+route] {
+				undocumented = append(undocumented, apiEndpoint{Method: method, Path: route})
+			}
+			return nil
+		})
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("failed to walk the registered API routes")
+		}
+	}
+
+	for _, e := range apiEndpoints {
+		if registered[e.Method+" "+e.Path] {
+			documented = append(documented, e)
+		}
+	}
+	sort.Slice(undocumented, func(i, j int) bool {
+		return undocumented[i].Path+undocumented[i].Method < undocumented[j].Path+undocumented[j].Method
+	})
+	return documented, undocumented
+}
+
+// apiDocs returns the documentation of the registered API routes with curl examples for
+// the configured base URL. Routes without documentation are listed by method and path only.
+func (s *Server) apiDocs() []pages.APIEndpointDoc {
+	documented, undocumented := s.apiRoutes()
+
+	docs := make([]pages.APIEndpointDoc, 0, len(documented)+len(undocumented))
+	for _, e := range documented {
+		doc := pages.APIEndpointDoc{
+			Method:  e.Method,
+			Path:    e.Path,
+			Summary: e.Summary,
+			Curl:    e.curl(s.config.BaseURL),
+		}
+		for _, p := range e.Params {
+			doc.Params = append(doc.Params, pages.APIParamDoc{
+				Name:        p.Name,
+				In:          p.In,
+				Description: p.Description,
+				Required:    p.Required,
+			})
+		}
+		docs = append(docs, doc)
+	}
+	for _, e := range undocumented {
+		docs = append(docs, pages.APIEndpointDoc{Method: e.Method, Path: e.Path})
+	}
+	return docs
+}
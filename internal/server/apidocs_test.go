@@ -0,0 +1,79 @@
+package server
+
+import (
+	"testing"
+	"volaticus-go/internal/auth"
+	"volaticus-go/internal/config"
+	"volaticus-go/internal/shortener"
+
+	"github.com/go-chi/jwtauth/v5"
+)
+
+// routesAuthService only provides the JWT verifier needed to register the routes
+type routesAuthService struct {
+	auth.Service
+}
+
+func (routesAuthService) GetAuth() *jwtauth.JWTAuth {
+	return jwtauth.New("HS256", []byte("secret"), nil)
+}
+
+// newRoutesServer returns a server registering every route, optional features included
+func newRoutesServer() *Server {
+	cfg := &config.Config{BaseURL: "https://files.example.com", CustomDomains: true}
+	return &Server{
+		config:           cfg,
+		authService:      routesAuthService{},
+		shortenerHandler: shortener.NewHandler(shortener.NewService(nil, cfg), nil),
+	}
+}
+
+func TestAPIDocsCoverRoutes(t *testing.T) {
+	s := newRoutesServer()
+	s.RegisterRoutes()
+
+	docs := s.apiDocs()
+	if len(docs) != len(apiEndpoints) {
+		t.Errorf("docs list %d endpoints, %d are documented", len(docs), len(apiEndpoints))
+	}
+	for _, doc := range docs {
+		if doc.Summary == "" {
+			t.Errorf("%s %s is registered but not documented", doc.Method, doc.Path)
+		}
+	}
+}
+
+func TestAPIEndpointCurl(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint apiEndpoint
+		want     string
+	}{
+		{
+			name:     "multipart upload",
+			endpoint: apiEndpoints[0],
+			want: "curl -X POST \"https://files.example.com/api/v1/upload\" \\\n" +
+				"  -H \"Authorization: Bearer YOUR_API_TOKEN\" \\\n  -F \"file=@/path/to/your/file.jpg\"",
+		},
+		{
+			name:     "path parameter",
+			endpoint: apiEndpoint{Method: "GET", Path: "/api/v1/files/{fileID}"},
+			want:     "curl \"https://files.example.com/api/v1/files/<fileID>\" \\\n  -H \"Authorization: Bearer YOUR_API_TOKEN\"",
+		},
+		{
+			name:     "json body",
+			endpoint: apiEndpoint{Method: "POST", Path: "/api/v1/shorten", Body: `{"url": "https://example.com"}`},
+			want: "curl -X POST \"https://files.example.com/api/v1/shorten\" \\\n" +
+				"  -H \"Authorization: Bearer YOUR_API_TOKEN\" \\\n  -H \"Content-Type: application/json\" \\\n" +
+				"  -d '{\"url\": \"https://example.com\"}'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.endpoint.curl("https://files.example.com"); got != tt.want {
+				t.Errorf("curl() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -24,11 +24,23 @@ func (s *Server) handleHome(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleUrlShort(w http.ResponseWriter, r *http.Request) {
-	templ.Handler(pages.UrlShortPage()).ServeHTTP(w, r)
+	// Verified custom domains are offered for new links, the page works without them
+	var domains []string
+	if user := context.GetUserFromContext(r.Context()); user != nil {
+		var err error
+		domains, err = s.shortenerService.VerifiedDomainNames(r.Context(), user.ID)
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("user_id", user.ID.String()).
+				Msg("failed to fetch custom domains")
+		}
+	}
+	templ.Handler(pages.UrlShortPage(domains)).ServeHTTP(w, r)
 }
 
 func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
-	templ.Handler(pages.UploadPage(s.config.UploadExpiresIn)).ServeHTTP(w, r)
+	templ.Handler(pages.UploadPage(s.config.UploadExpiresIn, s.config.UploadMaxExpiry)).ServeHTTP(w, r)
 }
 
 func (s *Server) handleFiles(w http.ResponseWriter, r *http.Request) {
@@ -62,7 +74,17 @@ func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
 		Int("token_count", len(userTokens)).
 		Msg("fetched user tokens")
 
-	component := pages.SettingsPage(userTokens)
+	account, err := s.userService.GetByID(r.Context(), user.ID)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("user_id", user.ID.String()).
+			Msg("failed to fetch user")
+		http.Error(w, "Error fetching account", http.StatusInternalServerError)
+		return
+	}
+
+	component := pages.SettingsPage(userTokens, account)
 	if err := component.Render(r.Context(), w); err != nil {
 		log.Error().
 			Err(err).
@@ -94,9 +116,31 @@ func (s *Server) showTokenModal(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleAPIDocs shows how to call the API routes, with curl commands for this server
+func (s *Server) handleAPIDocs(w http.ResponseWriter, r *http.Request) {
+	if err := pages.APIDocsPage(s.apiDocs()).Render(r.Context(), w); err != nil {
+		log.Error().
+			Err(err).
+			Msg("failed to render API docs")
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+	}
+}
+
 // API Handlers
 func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
-	health := s.db.Health(r.Context())
+	dbHealth := s.db.Health(r.Context())
+	storageHealth := s.storageHealth(r.Context())
+
+	health := map[string]interface{}{
+		"status":   "up",
+		"database": dbHealth,
+		"storage":  storageHealth,
+	}
+	if dbHealth["status"] != "up" || storageHealth["status"] != "up" {
+		health["status"] = "down"
+		s.sendJSON(w, http.StatusServiceUnavailable, false, "Health check failed", health)
+		return
+	}
 	s.sendJSON(w, http.StatusOK, true, "Health check successful", health)
 }
 
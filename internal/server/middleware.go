@@ -1,15 +1,25 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/dustin/go-humanize"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
+	"volaticus-go/cmd/web"
+	"volaticus-go/internal/common/clientip"
+	"volaticus-go/internal/common/models"
 	userctx "volaticus-go/internal/context"
+	"volaticus-go/internal/uploader"
+	"volaticus-go/internal/user"
 
 	"github.com/go-chi/jwtauth/v5"
 )
@@ -41,9 +51,9 @@ func (s *Server) AuthMiddleware(ja *jwtauth.JWTAuth) func(http.Handler) http.Han
 				if err == nil && token != nil {
 					// Redirect authenticated users away from login/register
 					if r.Header.Get("HX-Request") == "true" {
-						w.Header().Set("HX-Redirect", "/")
+						w.Header().Set("HX-Redirect", web.Path("/"))
 					} else {
-						http.Redirect(w, r, "/", http.StatusSeeOther)
+						http.Redirect(w, r, web.Path("/"), http.StatusSeeOther)
 					}
 					return
 				}
@@ -53,19 +63,86 @@ func (s *Server) AuthMiddleware(ja *jwtauth.JWTAuth) func(http.Handler) http.Han
 
 			// Require authentication for all other routes
 			if err != nil || token == nil {
-				if r.Header.Get("HX-Request") == "true" {
-					w.Header().Set("HX-Redirect", "/login")
-				} else {
-					http.Redirect(w, r, "/login", http.StatusSeeOther)
-				}
+				redirectToLogin(w, r)
 				return
 			}
 
-			next.ServeHTTP(w, r)
+			account, err := s.sessionUser(r)
+			if err != nil {
+				log.Error().
+					Err(err).
+					Msg("session user lookup failed")
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if account == nil {
+				redirectToLogin(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(userctx.WithUser(r.Context(), account)))
 		})
 	}
 }
 
+// redirectToLogin sends users without a valid session to the login page
+func redirectToLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Redirect", web.Path("/login"))
+	} else {
+		http.Redirect(w, r, web.Path("/login"), http.StatusSeeOther)
+	}
+}
+
+// sessionUser looks up the account of the session token. The token keeps the username it was
+// issued with, so the current one is read to show renames in every session. Deleted and disabled
+// accounts have no user, the error is only set when the lookup failed.
+func (s *Server) sessionUser(r *http.Request) (*userctx.UserInfo, error) {
+	claimed := userctx.GetUserFromContext(r.Context())
+	if claimed == nil {
+		return nil, nil
+	}
+	account, err := s.userService.GetByID(r.Context(), claimed.ID)
+	if errors.Is(err, user.ErrUserNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !account.IsActive {
+		return nil, nil
+	}
+	return &userctx.UserInfo{ID: account.ID, Username: account.Username}, nil
+}
+
+// OptionalSessionMiddleware checks the account of a session on public routes. Requests
+// without a session pass through, sessions of deleted or disabled accounts are dropped so
+// their claims don't grant access to private files.
+func (s *Server) OptionalSessionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _, err := jwtauth.FromContext(r.Context())
+		if err != nil || token == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		account, err := s.sessionUser(r)
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("session user lookup failed")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if account == nil {
+			next.ServeHTTP(w, r.WithContext(jwtauth.NewContext(r.Context(), nil, jwtauth.ErrNoTokenFound)))
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(userctx.WithUser(r.Context(), account)))
+	})
+}
+
 // APITokenAuthMiddleware verifies API token for routes under /api/v1/
 func (s *Server) APITokenAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -102,6 +179,27 @@ func (s *Server) APITokenAuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// Audit the request once the response status is known
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		w = ww
+		defer s.recordTokenUsage(r, apiToken.ID, ww)
+
+		// Enforce the per token rate limit
+		limit := s.config.APIRateLimit
+		if apiToken.RateLimit != nil {
+			limit = *apiToken.RateLimit
+		}
+		if ok, retryAfter := s.tokenLimiter.Allow(apiToken.ID, limit); !ok {
+			log.Warn().
+				Str("token_id", apiToken.ID.String()).
+				Int("limit", limit).
+				Dur("retry_after", retryAfter).
+				Msg("api token rate limit exceeded")
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+
 		// Get user information
 		user, err := s.userService.GetByID(r.Context(), apiToken.UserID)
 		if err != nil {
@@ -125,8 +223,56 @@ func (s *Server) APITokenAuthMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// LoggerMiddleware logs request details and duration
-func LoggerMiddleware() func(next http.Handler) http.Handler {
+// OptionalAPITokenAuthMiddleware authenticates the request with an API token if an
+// Authorization header is present, other requests are passed through unauthenticated
+func (s *Server) OptionalAPITokenAuthMiddleware(next http.Handler) http.Handler {
+	authenticated := s.APITokenAuthMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		authenticated.ServeHTTP(w, r)
+	})
+}
+
+// requestIDMaxLen caps request IDs sent by clients or proxies, longer ones are replaced
+const requestIDMaxLen = 64
+
+// RequestIDMiddleware passes on the request ID of the given header, or generates one when it's
+// missing or malformed. The ID is stored in the context for the logs and returned in the same
+// response header, so clients can refer to the log lines of their request.
+func RequestIDMiddleware(header string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID := r.Header.Get(header)
+			if !validRequestID(requestID) {
+				requestID = uuid.New().String()
+			}
+
+			w.Header().Set(header, requestID)
+			ctx := context.WithValue(r.Context(), middleware.RequestIDKey, requestID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// validRequestID reports whether an incoming request ID is short and only made of characters
+// that can't forge log fields or response headers
+func validRequestID(id string) bool {
+	if id == "" || len(id) > requestIDMaxLen {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_.:", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// LoggerMiddleware logs request details and duration, clientIP resolves the logged visitor address
+func LoggerMiddleware(clientIP *clientip.Resolver) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Skip noisy static asset logging
@@ -138,23 +284,17 @@ func LoggerMiddleware() func(next http.Handler) http.Handler {
 			start := time.Now()
 			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
 
-			// Generate or get request ID
-			requestID := middleware.GetReqID(r.Context())
-			if requestID == "" {
-				requestID = uuid.New().String()[:8]
-			}
-
-			// Group logs by request using consistent fields
+			// Group logs by the request ID the client sees in the response
 			reqLogger := log.With().
-				Str("rid", requestID).
+				Str("rid", middleware.GetReqID(r.Context())).
 				Str("method", r.Method).
 				Str("path", shortenPath(r.URL.Path)). // Shorten very long paths
 				Logger()
 
 			// Initial request log
 			reqLogger.Info().
-				Str("ip", anonymizeIP(r.RemoteAddr)).         // Anonymize IPs in logs for privacy
-				Str("ua", summarizeUserAgent(r.UserAgent())). // Summarize UA
+				Str("ip", anonymizeIP(clientIP.FromRequest(r))). // Anonymize IPs in logs for privacy
+				Str("ua", summarizeUserAgent(r.UserAgent())).    // Summarize UA
 				Msg("Request started")
 
 			defer func() {
@@ -178,6 +318,109 @@ func LoggerMiddleware() func(next http.Handler) http.Handler {
 	}
 }
 
+// RequestLimitsMiddleware caps the size of request bodies and the time a request may take.
+// Uploads may send UploadMaxSize for each file they may carry, the size of every single file is
+// checked by the uploader. Routes streaming files in or out are exempt from the timeout as a large
+// file on a slow connection legitimately takes longer.
+func RequestLimitsMiddleware(maxBodySize, uploadMaxSize int64, uploadMaxFiles int, timeout time.Duration) func(next http.Handler) http.Handler {
+	batchLimit := uploader.BodyLimit(uploadMaxSize, uploadMaxFiles)
+	return func(next http.Handler) http.Handler {
+		limited := next
+		if timeout > 0 {
+			limited = middleware.Timeout(timeout)(next)
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := maxBodySize
+			switch {
+			case isBatchUploadPath(r.URL.Path) && r.Method != http.MethodPut:
+				limit = batchLimit
+			case isUploadPath(r.URL.Path), isBatchUploadPath(r.URL.Path):
+				limit = uploader.BodyLimit(uploadMaxSize, 1)
+			}
+			if r.Body != nil && limit > 0 {
+				r.Body = http.MaxBytesReader(w, r.Body, limit)
+			}
+
+			if isStreamingPath(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			limited.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isUploadPath reports whether the path receives a single file upload
+func isUploadPath(path string) bool {
+	path = strings.TrimSuffix(path, "/")
+	return path == "/upload/verify" || path == "/settings/avatar"
+}
+
+// isBatchUploadPath reports whether the path receives uploads of several files at once.
+// A PUT to the API upload path carries a single raw file instead.
+func isBatchUploadPath(path string) bool {
+	path = strings.TrimSuffix(path, "/")
+	return path == "/upload" || path == "/api/v1/upload"
+}
+
+// isStreamingPath reports whether the path streams a file or upload progress and runs without a timeout
+func isStreamingPath(path string) bool {
+	return isUploadPath(path) || isBatchUploadPath(path) ||
+		strings.HasPrefix(path, "/f/") ||
+		strings.HasPrefix(path, "/d/") ||
+		strings.HasPrefix(path, "/upload/progress/")
+}
+
+// AdminMiddleware restricts routes to the users listed in ADMIN_USERS
+func (s *Server) AdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := userctx.GetUserFromContext(r.Context())
+		if user == nil || !s.isAdmin(user) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isAdmin matches ADMIN_USERS against the user ID or the exact username. Listed usernames can't be
+// registered or taken by a rename, so only an account that already had the name matches.
+func (s *Server) isAdmin(user *userctx.UserInfo) bool {
+	id := user.ID.String()
+	for _, admin := range s.config.AdminUsers {
+		if admin == id || admin == user.Username {
+			return true
+		}
+	}
+	return false
+}
+
+// recordTokenUsage queues an audit entry for a request authenticated with an API token.
+// Requests turned away by the rate limit are left out, they would flood the entries kept per token.
+func (s *Server) recordTokenUsage(r *http.Request, tokenID uuid.UUID, ww middleware.WrapResponseWriter) {
+	status := ww.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if status == http.StatusTooManyRequests {
+		return
+	}
+
+	s.tokenUsage.Record(&models.TokenUsage{
+		TokenID:   tokenID,
+		IPAddress: clientip.ForStorage(s.clientIP.FromRequest(r), s.config.AnalyticsIPMode, s.config.Secret),
+		Endpoint:  r.Method + " " + r.URL.Path,
+		Status:    status,
+	})
+}
+
+// keyByClientIP is the rate limit key of the client IP. httprate.KeyByIP would trust
+// forwarding headers sent by anyone, so a client could pick its own bucket.
+func (s *Server) keyByClientIP(r *http.Request) (string, error) {
+	return s.clientIP.FromRequest(r), nil
+}
+
 // Helper functions for cleaner logging
 
 func isStaticAsset(path string) bool {
@@ -197,20 +440,12 @@ func shortenPath(path string) string {
 	return path
 }
 
-func anonymizeIP(ip string) string {
-	parts := strings.Split(ip, ":")
-	if len(parts) > 0 {
-		if parts[0] == "[::1]" {
-			return "localhost"
-		}
-		// Anonymize last octet for IPv4
-		ipParts := strings.Split(parts[0], ".")
-		if len(ipParts) == 4 {
-			ipParts[3] = "xxx"
-			return strings.Join(ipParts, ".")
-		}
+func anonymizeIP(addr string) string {
+	host := clientip.Host(addr)
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return "localhost"
 	}
-	return ip
+	return clientip.Anonymize(host)
 }
 
 func summarizeUserAgent(ua string) string {
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"volaticus-go/internal/common/models"
+	"volaticus-go/internal/config"
+	userctx "volaticus-go/internal/context"
+	"volaticus-go/internal/uploader"
+	"volaticus-go/internal/user"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/google/uuid"
+)
+
+func TestRequestLimitsMiddleware(t *testing.T) {
+	handler := RequestLimitsMiddleware(16, 64, 3, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				return
+			}
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+
+	tests := []struct {
+		method     string
+		path       string
+		size       int
+		wantStatus int
+	}{
+		{"POST", "/url-shortener/urls", 16, http.StatusOK},
+		{"POST", "/url-shortener/urls", 17, http.StatusRequestEntityTooLarge},
+		{"POST", "/upload", 1024, http.StatusOK},
+		{"POST", "/upload/", 1024, http.StatusOK},
+		{"POST", "/api/v1/upload", 3*64 + uploader.MultipartOverhead, http.StatusOK},
+		{"POST", "/api/v1/upload", 3*64 + 1 + uploader.MultipartOverhead, http.StatusRequestEntityTooLarge},
+		{"PUT", "/api/v1/upload", 64 + uploader.MultipartOverhead, http.StatusOK},
+		{"PUT", "/api/v1/upload", 65 + uploader.MultipartOverhead, http.StatusRequestEntityTooLarge},
+		{"POST", "/settings/avatar", 64 + uploader.MultipartOverhead, http.StatusOK},
+		{"POST", "/settings/avatar", 65 + uploader.MultipartOverhead, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, bytes.NewReader(make([]byte, tt.size)))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s %s with %d bytes: status = %d, want %d", tt.method, tt.path, tt.size, w.Code, tt.wantStatus)
+		}
+	}
+}
+
+func TestRequestLimitsMiddlewareTimeout(t *testing.T) {
+	handler := RequestLimitsMiddleware(16, 64, 3, time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); !ok {
+			t.Errorf("%s has no deadline", r.URL.Path)
+		}
+	}))
+	streaming := RequestLimitsMiddleware(16, 64, 3, time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); ok {
+			t.Errorf("streaming route %s has a deadline", r.URL.Path)
+		}
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/files/list", nil))
+	for _, path := range []string{"/f/abc", "/d/abc", "/upload", "/upload/progress/123", "/api/v1/upload"} {
+		streaming.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var got string
+	handler := RequestIDMiddleware("X-Request-ID")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = middleware.GetReqID(r.Context())
+	}))
+
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{name: "from the proxy", incoming: "req-1a2b.3c:4d_5e", keep: true},
+		{name: "missing"},
+		{name: "forged log line", incoming: "abc\nlevel=fatal"},
+		{name: "too long", incoming: strings.Repeat("a", requestIDMaxLen+1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.incoming != "" {
+				r.Header["X-Request-Id"] = []string{tt.incoming}
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if got == "" || w.Header().Get("X-Request-ID") != got {
+				t.Fatalf("context ID = %q, response header = %q", got, w.Header().Get("X-Request-ID"))
+			}
+			if (got == tt.incoming) != tt.keep {
+				t.Errorf("request ID = %q for incoming %q, keep = %v", got, tt.incoming, tt.keep)
+			}
+		})
+	}
+}
+
+func TestIsAdmin(t *testing.T) {
+	adminID := uuid.New()
+	s := &Server{config: &config.Config{AdminUsers: []string{adminID.String(), "admin"}}}
+
+	tests := []struct {
+		name string
+		user *userctx.UserInfo
+		want bool
+	}{
+		{"listed ID", &userctx.UserInfo{ID: adminID, Username: "whoever"}, true},
+		{"listed username", &userctx.UserInfo{ID: uuid.New(), Username: "admin"}, true},
+		{"username in another case", &userctx.UserInfo{ID: uuid.New(), Username: "Admin"}, false},
+		{"other user", &userctx.UserInfo{ID: uuid.New(), Username: "alice"}, false},
+	}
+	for _, tt := range tests {
+		if got := s.isAdmin(tt.user); got != tt.want {
+			t.Errorf("%s: isAdmin() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// accountService knows one account by its ID
+type accountService struct {
+	user.Service
+	account *models.User
+}
+
+func (s accountService) GetByID(_ context.Context, id uuid.UUID) (*models.User, error) {
+	if s.account == nil || s.account.ID != id {
+		return nil, user.ErrUserNotFound
+	}
+	return s.account, nil
+}
+
+func TestSessionUser(t *testing.T) {
+	account := &models.User{ID: uuid.New(), Username: "renamed", IsActive: true}
+	s := &Server{userService: accountService{account: account}}
+	// The session was issued before the rename
+	session := func(id uuid.UUID) *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		return r.WithContext(userctx.WithUser(r.Context(), &userctx.UserInfo{ID: id, Username: "original"}))
+	}
+
+	got, err := s.sessionUser(session(account.ID))
+	if err != nil || got == nil || got.Username != "renamed" {
+		t.Errorf("sessionUser() = %+v, %v, want the current username", got, err)
+	}
+
+	if got, err := s.sessionUser(session(uuid.New())); got != nil || err != nil {
+		t.Errorf("sessionUser() of a deleted account = %+v, %v, want none", got, err)
+	}
+
+	account.IsActive = false
+	if got, err := s.sessionUser(session(account.ID)); got != nil || err != nil {
+		t.Errorf("sessionUser() of a disabled account = %+v, %v, want none", got, err)
+	}
+}
+
+func TestOptionalSessionMiddleware(t *testing.T) {
+	account := &models.User{ID: uuid.New(), Username: "owner", IsActive: true}
+	s := &Server{userService: accountService{account: account}}
+	ja := jwtauth.New("HS256", []byte("secret"), nil)
+
+	var got *userctx.UserInfo
+	handler := jwtauth.Verifier(ja)(s.OptionalSessionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = userctx.GetUserFromContext(r.Context())
+	})))
+	serve := func(id uuid.UUID) {
+		got = nil
+		r := httptest.NewRequest("GET", "/f/abc", nil)
+		if id != uuid.Nil {
+			_, token, err := ja.Encode(map[string]interface{}{"user_id": id.String(), "username": "owner"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.AddCookie(&http.Cookie{Name: "jwt", Value: token})
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	serve(uuid.Nil)
+	if got != nil {
+		t.Errorf("user without a session = %+v, want none", got)
+	}
+
+	serve(account.ID)
+	if got == nil || got.ID != account.ID {
+		t.Errorf("user of an active session = %+v, want the account", got)
+	}
+
+	serve(uuid.New())
+	if got != nil {
+		t.Errorf("user of a deleted account = %+v, want none", got)
+	}
+
+	account.IsActive = false
+	serve(account.ID)
+	if got != nil {
+		t.Errorf("user of a disabled account = %+v, want none", got)
+	}
+}
@@ -0,0 +1,268 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"volaticus-go/internal/common/apierror"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const openAPIVersion = "3.0.3"
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	uuidType = reflect.TypeOf(uuid.UUID{})
+
+	pathParamPattern = regexp.MustCompile(`\{(\w+)\}`)
+)
+
+// bearerAuth is the security requirement of endpoints authenticated with an API token
+var bearerAuth = map[string]any{"bearerAuth": []string{}}
+
+// schemaRegistry builds JSON schemas from the json tags of Go types. Named structs are
+// added to the components once and referenced from everywhere else.
+type schemaRegistry struct {
+	components map[string]any
+}
+
+func (s *schemaRegistry) schemaOf(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case uuidType:
+		return map[string]any{"type": "string", "format": "uuid"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		// encoding/json writes byte slices as base64
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": s.schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.structSchema(t)
+		}
+		if _, ok := s.components[t.Name()]; !ok {
+			// Reserved before the fields are walked so self references terminate
+			s.components[t.Name()] = nil
+			s.components[t.Name()] = s.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	default:
+		return map[string]any{}
+	}
+}
+
+func (s *schemaRegistry) structSchema(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	var required []string
+	s.addFields(t, properties, &required, false)
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// addFields adds the JSON fields of a struct to properties, the fields of embedded structs
+// are inlined like encoding/json does. Fields of embedded pointers are missing while the
+// pointer is nil, so they are never required.
+func (s *schemaRegistry) addFields(t reflect.Type, properties map[string]any, required *[]string, optional bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				s.addFields(embedded, properties, required, optional || field.Type.Kind() == reflect.Pointer)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = s.schemaOf(field.Type)
+		if !optional && !strings.Contains(","+options+",", ",omitempty,") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// jsonContent is the content of a request or response body with a JSON schema
+func jsonContent(schema map[string]any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+// operation returns the OpenAPI operation of the endpoint
+func (e apiEndpoint) operation(schemas *schemaRegistry) map[string]any {
+	operation := map[string]any{"summary": e.Summary}
+	if e.OptionalAuth {
+		operation["security"] = []any{map[string]any{}, bearerAuth}
+	}
+
+	var params []any
+	for _, match := range pathParamPattern.FindAllStringSubmatch(e.Path, -1) {
+		params = append(params, map[string]any{
+			"name":     match[1],
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]any{"type": "string", "format": "uuid"},
+		})
+	}
+	formFields := make(map[string]any)
+	var requiredFields []string
+	for _, p := range e.Params {
+		if p.In == inForm {
+			field := map[string]any{"type": "string", "description": p.Description}
+			// Files are sent like curl -F "file=@path"
+			if strings.HasPrefix(p.Example, "@") {
+				field["format"] = "binary"
+			}
+			formFields[p.Name] = field
+			if p.Required {
+				requiredFields = append(requiredFields, p.Name)
+			}
+			continue
+		}
+		params = append(params, map[string]any{
+			"name":        p.Name,
+			"in":          p.In,
+			"description": p.Description,
+			"required":    p.Required,
+			"schema":      map[string]any{"type": "string"},
+		})
+	}
+	if len(params) > 0 {
+		operation["parameters"] = params
+	}
+
+	switch {
+	case len(formFields) > 0:
+		schema := map[string]any{"type": "object", "properties": formFields}
+		if len(requiredFields) > 0 {
+			schema["required"] = requiredFields
+		}
+		operation["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"multipart/form-data": map[string]any{"schema": schema}},
+		}
+	case e.Upload != "":
+		operation["requestBody"] = map[string]any{
+			"required": true,
+			"content": map[string]any{"application/octet-stream": map[string]any{
+				"schema": map[string]any{"type": "string", "format": "binary"},
+			}},
+		}
+	case e.Request != nil:
+		operation["requestBody"] = map[string]any{
+			"required": true,
+			"content":  jsonContent(schemas.schemaOf(reflect.TypeOf(e.Request))),
+		}
+	}
+
+	status := e.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	var errorBody any = apierror.APIError{}
+	if e.Error != nil {
+		errorBody = e.Error
+	}
+	success := map[string]any{"description": http.StatusText(status)}
+	if e.Response != nil {
+		success["content"] = jsonContent(schemas.schemaOf(reflect.TypeOf(e.Response)))
+	}
+	operation["responses"] = map[string]any{
+		strconv.Itoa(status): success,
+		"default": map[string]any{
+			"description": "Error",
+			"content":     jsonContent(schemas.schemaOf(reflect.TypeOf(errorBody))),
+		},
+	}
+	return operation
+}
+
+// openAPISpec returns the OpenAPI document of the registered and documented API routes
+func (s *Server) openAPISpec() map[string]any {
+	documented, _ := s.apiRoutes()
+	schemas := &schemaRegistry{components: make(map[string]any)}
+
+	paths := make(map[string]any)
+	for _, e := range documented {
+		item, ok := paths[e.Path].(map[string]any)
+		if !ok {
+			item = make(map[string]any)
+			paths[e.Path] = item
+		}
+		item[strings.ToLower(e.Method)] = e.operation(schemas)
+	}
+
+	return map[string]any{
+		"openapi": openAPIVersion,
+		"info": map[string]any{
+			"title":   "Volaticus API",
+			"version": "1",
+		},
+		"servers":  []any{map[string]any{"url": s.config.BaseURL}},
+		"paths":    paths,
+		"security": []any{bearerAuth},
+		"components": map[string]any{
+			"schemas": schemas.components,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "API token created in the settings",
+				},
+			},
+		},
+	}
+}
+
+// handleOpenAPI serves the OpenAPI document for API clients and code generators
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.openAPISpec()); err != nil {
+		log.Error().
+			Err(err).
+			Msg("failed to encode OpenAPI document")
+	}
+}
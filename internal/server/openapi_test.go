@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPISpec(t *testing.T) {
+	s := newRoutesServer()
+	handler := s.RegisterRoutes()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://files.example.com/api/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	var spec struct {
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]json.RawMessage `json:"properties"`
+				Required   []string                   `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&spec); err != nil {
+		t.Fatalf("decoding the document: %v", err)
+	}
+
+	for _, e := range apiEndpoints {
+		if _, ok := spec.Paths[e.Path][strings.ToLower(e.Method)]; !ok {
+			t.Errorf("%s %s is missing from the document", e.Method, e.Path)
+		}
+	}
+
+	response, ok := spec.Components.Schemas["CreateURLResponse"]
+	if !ok {
+		t.Fatal("CreateURLResponse schema is missing")
+	}
+	if _, ok := response.Properties["short_url"]; !ok {
+		t.Error("CreateURLResponse is missing short_url")
+	}
+	if strings.Join(response.Required, ",") != "id,short_url,short_code,is_vanity,qr_url,analytics_url" {
+		t.Errorf("CreateURLResponse required = %v", response.Required)
+	}
+
+	// Fields of embedded structs are inlined, those of embedded pointers are optional
+	upload := spec.Components.Schemas["APIUploadResponse"]
+	for _, name := range []string{"file_id", "delete_token", "remaining"} {
+		if _, ok := upload.Properties[name]; !ok {
+			t.Errorf("APIUploadResponse is missing %s", name)
+		}
+	}
+	if strings.Join(upload.Required, ",") != "success" {
+		t.Errorf("APIUploadResponse required = %v, want only success", upload.Required)
+	}
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// bucketIdleTimeout is how long an unused bucket is kept before it is pruned
+const bucketIdleTimeout = 10 * time.Minute
+
+// tokenBucket holds the remaining capacity for a single API token
+type tokenBucket struct {
+	tokens   float64
+	capacity float64
+	lastSeen time.Time
+}
+
+// tokenRateLimiter is a token bucket rate limiter keyed by API token ID.
+// Each bucket refills continuously at its limit per minute.
+type tokenRateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[uuid.UUID]*tokenBucket
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+func newTokenRateLimiter() *tokenRateLimiter {
+	return &tokenRateLimiter{
+		buckets: make(map[uuid.UUID]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// Allow consumes one request from the token's bucket. If the bucket is empty
+// it returns false and the time until the next request is permitted.
+func (l *tokenRateLimiter) Allow(tokenID uuid.UUID, perMinute int) (bool, time.Duration) {
+	if perMinute <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+
+	capacity := float64(perMinute)
+	refillRate := capacity / time.Minute.Seconds()
+
+	bucket, ok := l.buckets[tokenID]
+	if !ok {
+		bucket = &tokenBucket{tokens: capacity, capacity: capacity, lastSeen: now}
+		l.buckets[tokenID] = bucket
+	}
+
+	// The limit of a token can change between requests
+	if bucket.capacity != capacity {
+		bucket.capacity = capacity
+		bucket.tokens = math.Min(bucket.tokens, capacity)
+	}
+
+	elapsed := now.Sub(bucket.lastSeen).Seconds()
+	bucket.tokens = math.Min(capacity, bucket.tokens+elapsed*refillRate)
+	bucket.lastSeen = now
+
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / refillRate * float64(time.Second))
+		return false, wait
+	}
+
+	bucket.tokens--
+	return true, 0
+}
+
+// prune removes buckets that have not been used recently, must be called with the lock held
+func (l *tokenRateLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < bucketIdleTimeout {
+		return
+	}
+	for id, bucket := range l.buckets {
+		if now.Sub(bucket.lastSeen) > bucketIdleTimeout {
+			delete(l.buckets, id)
+		}
+	}
+	l.lastPrune = now
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestTokenRateLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := newTokenRateLimiter()
+	limiter.now = func() time.Time { return now }
+
+	tokenID := uuid.New()
+	otherID := uuid.New()
+
+	// Burst up to the limit is allowed
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.Allow(tokenID, 3); !ok {
+			t.Fatalf("request %d should be allowed", i+1)
+		}
+	}
+
+	ok, retryAfter := limiter.Allow(tokenID, 3)
+	if ok {
+		t.Fatal("request over the limit should be rejected")
+	}
+	if retryAfter <= 0 || retryAfter > 20*time.Second {
+		t.Errorf("retryAfter = %v, want between 0 and 20s", retryAfter)
+	}
+
+	// Other tokens have their own bucket
+	if ok, _ := limiter.Allow(otherID, 3); !ok {
+		t.Error("other token should not be limited")
+	}
+
+	// One request is refilled after a third of a minute
+	now = now.Add(20 * time.Second)
+	if ok, _ := limiter.Allow(tokenID, 3); !ok {
+		t.Error("request after refill should be allowed")
+	}
+	if ok, _ := limiter.Allow(tokenID, 3); ok {
+		t.Error("bucket should be empty again")
+	}
+}
+
+func TestTokenRateLimiterPrune(t *testing.T) {
+	now := time.Now()
+	limiter := newTokenRateLimiter()
+	limiter.now = func() time.Time { return now }
+
+	limiter.Allow(uuid.New(), 10)
+	now = now.Add(2 * bucketIdleTimeout)
+	limiter.Allow(uuid.New(), 10)
+
+	if len(limiter.buckets) != 1 {
+		t.Errorf("expected idle bucket to be pruned, got %d buckets", len(limiter.buckets))
+	}
+}
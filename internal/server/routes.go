@@ -2,6 +2,7 @@ package server
 
 import (
 	"net/http"
+	"strings"
 	"time"
 	"volaticus-go/cmd/web"
 
@@ -16,8 +17,11 @@ import (
 
 func (s *Server) RegisterRoutes() http.Handler {
 	r := chi.NewRouter()
-	r.Use(LoggerMiddleware())
+	s.routes = r
+	r.Use(RequestIDMiddleware(s.config.RequestIDHeader))
+	r.Use(LoggerMiddleware(s.clientIP))
 	r.Use(middleware.Recoverer)
+	r.Use(RequestLimitsMiddleware(s.config.MaxBodySize, s.config.UploadMaxSize, s.config.UploadMaxFiles, s.config.RequestTimeout))
 
 	// JWT authentication middleware
 	// Get the JWT auth instance
@@ -30,9 +34,9 @@ func (s *Server) RegisterRoutes() http.Handler {
 	// CORS configuration
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", s.config.RequestIDHeader},
+		ExposedHeaders:   []string{"Link", s.config.RequestIDHeader},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -41,7 +45,7 @@ func (s *Server) RegisterRoutes() http.Handler {
 	r.Use(httprate.Limit(
 		100,
 		time.Minute,
-		httprate.WithKeyFuncs(httprate.KeyByIP, httprate.KeyByEndpoint),
+		httprate.WithKeyFuncs(s.keyByClientIP, httprate.KeyByEndpoint),
 
 		httprate.WithLimitHandler(func(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, `{"error": "Rate-limited. Please, slow down."}`, http.StatusTooManyRequests)
@@ -51,6 +55,10 @@ func (s *Server) RegisterRoutes() http.Handler {
 	// Serve static files
 	fileServer := http.FileServer(http.FS(web.Files)) // embedded in binary
 	r.Handle("/assets/*", fileServer)
+	// Browsers and link preview crawlers look for the icon at the root
+	r.Get("/favicon.ico", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFileFS(w, r, web.Files, "assets/favicon.ico")
+	})
 
 	// Error 404 handler
 	r.NotFound(s.handleError404)
@@ -63,12 +71,45 @@ func (s *Server) RegisterRoutes() http.Handler {
 		r.Get("/register", s.handleRegister)
 		r.Post("/register", s.userHandler.HandleRegister)
 
+		// Email verification, resending is limited as every request sends an email
+		r.Get("/auth/verify", s.userHandler.HandleVerifyEmail)
+		r.With(httprate.Limit(
+			3,
+			time.Hour,
+			httprate.WithKeyFuncs(s.keyByClientIP),
+
+			httprate.WithLimitHandler(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, `{"error": "Too many verification emails requested."}`, http.StatusTooManyRequests)
+			}),
+		)).Post("/auth/verify/resend", s.userHandler.HandleResendVerification)
+
 		// Health check
 		r.Get("/health", s.healthHandler)
 
-		// File serving and short URL redirection
-		r.Get("/f/{fileUrl}", s.fileHandler.HandleServeFile)
+		// OpenAPI document of the API routes, the routes themselves need an API token
+		r.Get("/api/openapi.json", s.handleOpenAPI)
+
+		// File serving and short URL redirection. A session is optional, it only grants
+		// the owner access to private files while their account is active.
+		r.With(jwtauth.Verifier(tokenAuth), s.OptionalSessionMiddleware).Get("/f/{fileUrl}", s.fileHandler.HandleServeFile)
+		r.With(jwtauth.Verifier(tokenAuth), s.OptionalSessionMiddleware).Head("/f/{fileUrl}", s.fileHandler.HandleServeFile)
+		r.With(jwtauth.Verifier(tokenAuth), s.OptionalSessionMiddleware).Get("/f/{fileUrl}/view", s.fileHandler.HandleViewFile)
+		r.Get("/d/{token}", s.fileHandler.HandleServeSignedFile)
+		r.Head("/d/{token}", s.fileHandler.HandleServeSignedFile)
 		r.Get("/s/{shortCode}", s.shortenerHandler.HandleRedirect)
+
+		// Deletion with the token returned by the API upload, so it works without a session.
+		// Without a delete token the owner can authenticate with an API token instead.
+		// The rate limit comes first, so floods are turned away before their tokens are looked up
+		r.With(httprate.Limit(
+			20,
+			time.Minute,
+			httprate.WithKeyFuncs(s.keyByClientIP, httprate.KeyByEndpoint),
+
+			httprate.WithLimitHandler(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, `{"error": "Too many delete requests!."}`, http.StatusTooManyRequests)
+			}),
+		), s.OptionalAPITokenAuthMiddleware).Delete("/api/v1/files/{fileID}", s.fileHandler.HandleAPIDeleteFile)
 	})
 
 	// Protected routes
@@ -84,11 +125,23 @@ func (s *Server) RegisterRoutes() http.Handler {
 		// Logout
 		r.Get("/logout", s.userHandler.HandleLogout)
 
+		// Profile pictures shown next to the username
+		r.Get("/users/{userID}/avatar", s.fileHandler.HandleServeAvatar)
+
 		r.Route("/files", func(r chi.Router) {
 			r.Get("/", s.handleFiles)
 			r.Get("/list", s.fileHandler.HandleFilesList)
 			r.Get("/stats", s.fileHandler.HandleGetFileStats)
 			r.Delete("/{fileID}", s.fileHandler.HandleDeleteFile)
+			r.Post("/bulk-delete", s.fileHandler.HandleBulkDeleteFiles)
+			r.Post("/{fileID}/sign", s.fileHandler.HandleSignFile)
+			r.Put("/{fileID}/expiration", s.fileHandler.HandleUpdateExpiration)
+			r.Put("/{fileID}/visibility", s.fileHandler.HandleUpdateVisibility)
+			r.Get("/{fileID}/analytics", s.fileHandler.HandleFileAnalytics)
+			r.Put("/{fileID}/folder", s.fileHandler.HandleMoveFile)
+			r.Post("/folders", s.fileHandler.HandleCreateFolder)
+			r.Patch("/folders/{folderID}", s.fileHandler.HandleRenameFolder)
+			r.Delete("/folders/{folderID}", s.fileHandler.HandleDeleteFolder)
 		})
 
 		// Upload routes
@@ -97,15 +150,16 @@ func (s *Server) RegisterRoutes() http.Handler {
 			r.Use(httprate.Limit(
 				100,
 				time.Minute,
-				httprate.WithKeyFuncs(httprate.KeyByIP, httprate.KeyByEndpoint),
+				httprate.WithKeyFuncs(s.keyByClientIP, httprate.KeyByEndpoint),
 
 				httprate.WithLimitHandler(func(w http.ResponseWriter, r *http.Request) {
 					http.Error(w, `{"error": "Too many uploads!."}`, http.StatusTooManyRequests)
 				}),
 			))
-			r.Post("/", s.fileHandler.HandleUpload)
+			r.With(s.fileHandler.LimitConcurrentUploads).Post("/", s.fileHandler.HandleUpload)
 			r.Get("/", s.handleUpload)
 			r.Post("/verify", s.fileHandler.HandleVerifyFile)
+			r.Get("/progress/{id}", s.fileHandler.HandleUploadProgress)
 		})
 
 		// Settings routes
@@ -114,6 +168,14 @@ func (s *Server) RegisterRoutes() http.Handler {
 			r.Get("/token-modal", s.showTokenModal)
 			r.Post("/token-modal", s.authHandler.GenerateToken)
 			r.Delete("/token/{token}", s.authHandler.DeleteToken)
+			r.Post("/token/{id}/rotate", s.authHandler.RotateToken)
+			r.Get("/token/{id}/usage", s.authHandler.TokenUsage)
+			r.Get("/sharex", s.authHandler.HandleShareXConfig)
+			r.Get("/api-docs", s.handleAPIDocs)
+			r.Put("/profile", s.userHandler.HandleUpdateProfile)
+			r.Post("/avatar", s.fileHandler.HandleUploadAvatar)
+			r.Put("/force-download", s.userHandler.HandleForceDownload)
+			r.Delete("/account", s.userHandler.HandleDeleteAccount)
 		})
 
 		// URL shortener routes
@@ -124,15 +186,36 @@ func (s *Server) RegisterRoutes() http.Handler {
 			r.Route("/urls", func(r chi.Router) {
 				r.Post("/", s.shortenerHandler.HandleCreateShortURL)
 				r.Post("/shorten", s.shortenerHandler.HandleShortenForm)
+				r.Post("/bulk-delete", s.shortenerHandler.HandleBulkDeleteURLs)
 				r.Get("/{urlID}", s.shortenerHandler.HandleGetURLAnalytics)
+				r.Patch("/{urlID}", s.shortenerHandler.HandleUpdateURL)
 				r.Delete("/{urlID}", s.shortenerHandler.HandleDeleteURL)
 				r.Put("/{urlID}/expiration", s.shortenerHandler.HandleUpdateExpiration)
+				r.Post("/{urlID}/regenerate", s.shortenerHandler.HandleRegenerateShortCode)
 			})
+
+			// Link pages, deleted through the URL endpoints like every short code
+			r.Route("/pages", func(r chi.Router) {
+				r.Post("/", s.shortenerHandler.HandleCreatePage)
+				r.Get("/{urlID}", s.shortenerHandler.HandleGetPage)
+				r.Put("/{urlID}", s.shortenerHandler.HandleUpdatePage)
+			})
+		})
+
+		// Operator endpoints
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(s.AdminMiddleware)
+			r.Get("/storage-report", s.fileHandler.HandleStorageReport)
+			r.Post("/storage-sync", s.fileHandler.HandleStorageSync)
+			r.Post("/verify-storage", s.fileHandler.HandleVerifyStorage)
+			r.Get("/audit-log", s.auditHandler.HandleList)
+			r.Put("/tokens/{id}/rate-limit", s.authHandler.SetRateLimit)
 		})
 
 		// Dashboard routes
 		r.Route("/dashboard", func(r chi.Router) {
 			r.Get("/stats", s.dashboardHandler.HandleGetDashboardStats)
+			r.Get("/recent", s.dashboardHandler.HandleGetRecentItems)
 		})
 	})
 
@@ -146,22 +229,74 @@ func (s *Server) RegisterRoutes() http.Handler {
 		r.Use(httprate.Limit(
 			100,
 			time.Minute,
-			httprate.WithKeyFuncs(httprate.KeyByIP, httprate.KeyByEndpoint),
+			httprate.WithKeyFuncs(s.keyByClientIP, httprate.KeyByEndpoint),
 
 			httprate.WithLimitHandler(func(w http.ResponseWriter, r *http.Request) {
 				http.Error(w, `{"error": "Too many requests!."}`, http.StatusTooManyRequests)
 			}),
 		))
 
-		// Upload endpoint
-		r.Post("/api/v1/upload", func(w http.ResponseWriter, r *http.Request) {
+		// Upload endpoint, retries with the same Idempotency-Key get the first response
+		r.With(s.fileHandler.LimitConcurrentUploads, s.idempotency.Middleware).Post("/api/v1/upload", func(w http.ResponseWriter, r *http.Request) {
 
 			log.Info().
 				Str("path", r.URL.Path).
 				Msg("api upload request received")
 			s.fileHandler.HandleAPIUpload(w, r)
 		})
+		r.With(s.fileHandler.LimitConcurrentUploads).Put("/api/v1/upload", s.fileHandler.HandleAPIPutUpload)
+
+		// Short links for scripts, same request and response as the web interface JSON endpoint
+		r.With(s.idempotency.Middleware).Post("/api/v1/shorten", s.shortenerHandler.HandleCreateShortURL)
+		r.Post("/api/v1/pages", s.shortenerHandler.HandleCreatePage)
+		r.Get("/api/v1/pages/{urlID}", s.shortenerHandler.HandleGetPage)
+		r.Put("/api/v1/pages/{urlID}", s.shortenerHandler.HandleUpdatePage)
+
+		// Listing and deleting the token owner's files and short links
+		r.Get("/api/v1/files", s.fileHandler.HandleAPIListFiles)
+		r.Get("/api/v1/files/{fileID}", s.fileHandler.HandleAPIGetFile)
+		r.Get("/api/v1/urls", s.shortenerHandler.HandleAPIListURLs)
+		r.Get("/api/v1/urls/{urlID}", s.shortenerHandler.HandleGetURLAnalytics)
+		r.Delete("/api/v1/urls/{urlID}", s.shortenerHandler.HandleAPIDeleteURL)
+		r.Post("/api/v1/urls/{urlID}/regenerate", s.shortenerHandler.HandleRegenerateShortCode)
+
+		// Folders of the token owner and moving files between them
+		r.Get("/api/v1/folders", s.fileHandler.HandleListFolders)
+		r.Post("/api/v1/folders", s.fileHandler.HandleCreateFolder)
+		r.Patch("/api/v1/folders/{folderID}", s.fileHandler.HandleRenameFolder)
+		r.Delete("/api/v1/folders/{folderID}", s.fileHandler.HandleDeleteFolder)
+		r.Post("/api/v1/files/move", s.fileHandler.HandleMoveFiles)
+
+		// Custom domains for short links
+		if s.config.CustomDomains {
+			r.Get("/api/v1/domains", s.shortenerHandler.HandleListDomains)
+			r.Post("/api/v1/domains", s.shortenerHandler.HandleAddDomain)
+			r.Post("/api/v1/domains/{domainID}/verify", s.shortenerHandler.HandleVerifyDomain)
+			r.Delete("/api/v1/domains/{domainID}", s.shortenerHandler.HandleDeleteDomain)
+		}
 	})
 
-	return r
+	handler := withBasePath(s.config.BasePath, r)
+	if s.config.CustomDomains {
+		// Custom domains serve their short links from the root, outside of the base path
+		handler = s.shortenerHandler.CustomDomainMiddleware(handler)
+	}
+	return handler
+}
+
+// withBasePath serves the router below the base path. The prefix is stripped, so routes
+// and middleware keep matching paths relative to the app root.
+func withBasePath(basePath string, next http.Handler) http.Handler {
+	if basePath == "" {
+		return next
+	}
+	stripped := http.StripPrefix(basePath, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest, ok := strings.CutPrefix(r.URL.Path, basePath)
+		if !ok || (rest != "" && rest[0] != '/') {
+			http.NotFound(w, r)
+			return
+		}
+		stripped.ServeHTTP(w, r)
+	})
 }
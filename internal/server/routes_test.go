@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithBasePath(t *testing.T) {
+	var gotPath string
+	handler := withBasePath("/volaticus", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+	}))
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantPath   string
+	}{
+		{"/volaticus/files/list", http.StatusOK, "/files/list"},
+		{"/volaticus/", http.StatusOK, "/"},
+		{"/volaticus", http.StatusOK, ""},
+		{"/files/list", http.StatusNotFound, ""},
+		{"/volaticusother/files", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		gotPath = ""
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.path, rec.Code, tt.wantStatus)
+		}
+		if gotPath != tt.wantPath {
+			t.Errorf("%s: routed path = %q, want %q", tt.path, gotPath, tt.wantPath)
+		}
+	}
+}
@@ -6,21 +6,30 @@ import (
 	"fmt"
 	"net/http"
 	"time"
+	"volaticus-go/cmd/web"
+	"volaticus-go/internal/audit"
+	"volaticus-go/internal/common/clientip"
 	"volaticus-go/internal/config"
 	"volaticus-go/internal/dashboard"
 	"volaticus-go/internal/shortener"
 	"volaticus-go/internal/storage"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog/log"
 
 	_ "github.com/joho/godotenv/autoload"
 
 	"volaticus-go/internal/auth"
 	"volaticus-go/internal/database"
+	"volaticus-go/internal/email"
+	"volaticus-go/internal/idempotency"
 	"volaticus-go/internal/uploader"
 	"volaticus-go/internal/user"
 )
 
+// storageHealthTimeout bounds the storage check of the health endpoint
+const storageHealthTimeout = 5 * time.Second
+
 // Server represents the HTTP server and its dependencies
 type Server struct {
 	config           *config.Config
@@ -32,18 +41,32 @@ type Server struct {
 	userHandler      *user.Handler
 	fileHandler      *uploader.Handler
 	shortenerHandler *shortener.Handler
+	shortenerService *shortener.Service
 	dashboardHandler *dashboard.Handler
+	auditHandler     *audit.Handler
+	auditLog         *audit.Logger
+	tokenUsage       *auth.UsageWriter
+	tokenLimiter     *tokenRateLimiter
+	idempotency      *idempotency.Service
+	clientIP         *clientip.Resolver
+	routes           chi.Routes // Set by RegisterRoutes, listed on the API docs page
 }
 
 // NewServer creates a new server instance
 func NewServer(config *config.Config, db *database.DB) (*Server, error) {
+	// Links rendered by the templates and handlers are prefixed with the base path
+	web.SetBasePath(config.BasePath)
+
 	// Initialize Storage
 	storageProvider, err := storage.NewStorageProvider(storage.StorageConfig{
-		Provider:   config.Storage.Provider,
-		LocalPath:  config.Storage.LocalPath,
-		BaseURL:    config.BaseURL,
-		ProjectID:  config.Storage.ProjectID,
-		BucketName: config.Storage.BucketName,
+		Provider:      config.Storage.Provider,
+		LocalPath:     config.Storage.LocalPath,
+		ShardDepth:    config.Storage.ShardDepth,
+		BaseURL:       config.BaseURL,
+		ProjectID:     config.Storage.ProjectID,
+		BucketName:    config.Storage.BucketName,
+		PublicObjects: config.Storage.PublicObjects,
+		PublicURL:     config.Storage.PublicURL,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("initializing storage provider: %w", err)
@@ -59,22 +82,47 @@ func NewServer(config *config.Config, db *database.DB) (*Server, error) {
 
 	// Initialize Services
 	authService := auth.NewService(config.Secret, tokenRepo)
-	userService := user.NewService(userRepo)
+	userService := user.NewService(userRepo, config, email.NewEmailer(
+		config.SMTPHost, config.SMTPPort, config.SMTPUsername, config.SMTPPassword, config.MailFrom))
 	fileService := uploader.NewService(fileRepo, config, storageProvider)
-	dashboardService := dashboard.NewService(dashboardRepo)
-
-	// Initialize file service & start expired files worker
-	ctx := context.Background() // TODO: Use proper context
-	uploader.StartExpiredFilesWorker(ctx, fileService, 1*time.Minute)
+	dashboardService := dashboard.NewService(dashboardRepo, config.StatsCacheTTL)
 
 	// Initialize shortened URL service
+	ctx := context.Background() // TODO: Use proper context
 	shortenerService := shortener.NewService(shortenerRepo, config)
+	if config.GeoIPReload > 0 {
+		shortenerService.StartGeoIPReloader(ctx, config.GeoIPReload)
+	}
+	shortenerService.StartClickWriter(ctx)
+
+	// Start expired files worker, which also enforces the analytics retention
+	cleanupWorker := uploader.NewCleanupWorker(fileService, 1*time.Minute)
+	if config.RetentionDays > 0 {
+		cleanupWorker.AddTask("purge old click analytics", shortenerService.PurgeOldAnalytics)
+		cleanupWorker.AddTask("purge old file access logs", fileService.PurgeOldAccessLogs)
+	}
+	if config.RollupDays > 0 {
+		cleanupWorker.AddTask("roll up old click analytics", shortenerService.RollupOldAnalytics)
+	}
+	idempotencyService := idempotency.NewService(idempotency.NewRepository(db), config.IdempotencyTTL)
+	cleanupWorker.AddTask("purge expired idempotency keys", idempotencyService.PurgeExpired)
+	cleanupWorker.AddTask("retry failed storage deletions", fileService.RetryPendingDeletions)
+	if config.StatsCacheTTL > 0 {
+		cleanupWorker.AddTask("refresh cached dashboard stats", dashboardService.RefreshCachedStats)
+	}
+	cleanupWorker.Start(ctx)
 
 	// Initialize handlers
-	userHandler := user.NewHandler(userService, authService)
-	authHandler := auth.NewHandler(userRepo, authService)
-	fileHandler := uploader.NewHandler(fileService)
-	shortenerHandler := shortener.NewHandler(shortenerService)
+	clientIP := clientip.NewResolver(config.TrustProxyHops, config.TrustedProxies)
+	auditLog := audit.NewLogger(audit.NewRepository(db), clientIP)
+	auditLog.Start()
+	tokenUsage := auth.NewUsageWriter(tokenRepo)
+	tokenUsage.Start()
+	cookies := user.NewSessionCookie(config.CookieSecure, config.CookieSameSite, config.CookieDomain)
+	userHandler := user.NewHandler(userService, authService, fileService, clientIP, cookies, auditLog)
+	authHandler := auth.NewHandler(userRepo, authService, config.BaseURL, auditLog)
+	fileHandler := uploader.NewHandler(fileService, auditLog)
+	shortenerHandler := shortener.NewHandler(shortenerService, auditLog)
 	dashboardHandler := dashboard.NewHandler(dashboardService)
 
 	server := &Server{
@@ -87,7 +135,14 @@ func NewServer(config *config.Config, db *database.DB) (*Server, error) {
 		userHandler:      userHandler,
 		fileHandler:      fileHandler,
 		shortenerHandler: shortenerHandler,
+		shortenerService: shortenerService,
 		dashboardHandler: dashboardHandler,
+		auditHandler:     audit.NewHandler(auditLog),
+		auditLog:         auditLog,
+		tokenUsage:       tokenUsage,
+		tokenLimiter:     newTokenRateLimiter(),
+		idempotency:      idempotencyService,
+		clientIP:         clientIP,
 	}
 
 	return server, nil
@@ -112,6 +167,20 @@ func (s *Server) Start() (*http.Server, error) {
 	return srv, nil
 }
 
+// Shutdown writes data still buffered in memory, it is called after the HTTP server stopped serving requests
+func (s *Server) Shutdown(ctx context.Context) error {
+	if err := s.shortenerService.StopClickWriter(ctx); err != nil {
+		return fmt.Errorf("flushing click analytics: %w", err)
+	}
+	if err := s.auditLog.Close(ctx); err != nil {
+		return fmt.Errorf("flushing audit log: %w", err)
+	}
+	if err := s.tokenUsage.Close(ctx); err != nil {
+		return fmt.Errorf("flushing token usage: %w", err)
+	}
+	return nil
+}
+
 // sendJSON sends a JSON response with consistent formatting
 func (s *Server) sendJSON(w http.ResponseWriter, status int, success bool, message string, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -131,6 +200,26 @@ func (s *Server) sendJSON(w http.ResponseWriter, status int, success bool, messa
 	}
 }
 
+// storageHealth reports whether the storage provider is reachable
+func (s *Server) storageHealth(ctx context.Context) map[string]string {
+	ctx, cancel := context.WithTimeout(ctx, storageHealthTimeout)
+	defer cancel()
+
+	stats := map[string]string{
+		"status":   "up",
+		"provider": s.config.Storage.Provider,
+	}
+	if err := s.storage.Health(ctx); err != nil {
+		log.Error().
+			Err(err).
+			Str("provider", s.config.Storage.Provider).
+			Msg("storage health check failed")
+		// The cause is only logged, the endpoint is public and errors can name paths and buckets
+		stats["status"] = "down"
+	}
+	return stats
+}
+
 func (s *Server) Close() error {
 	if err := s.storage.Close(); err != nil {
 		log.Printf("Error closing storage provider: %v", err)
@@ -0,0 +1,211 @@
+package shortener
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// urlCheckTimeout bounds a lookup in an external threat list, a slow list must not stall shortening
+const urlCheckTimeout = 5 * time.Second
+
+// ownPaths are the routes of this server that must not be shortened, a short URL pointing at
+// another short URL loops and wrapping file links hides where they lead
+var ownPaths = []string{"/s/", "/f/", "/d/"}
+
+// URLChecker looks up destinations in an external list of malicious URLs
+type URLChecker interface {
+	// Check returns the kind of threat if the URL is listed, or an empty string if it is not
+	Check(ctx context.Context, rawURL string) (string, error)
+}
+
+var urlCheckClient = &http.Client{Timeout: urlCheckTimeout}
+
+// SafeBrowsingChecker looks up URLs with the Google Safe Browsing Lookup API v4
+type SafeBrowsingChecker struct {
+	apiKey   string
+	endpoint string
+}
+
+// NewSafeBrowsingChecker creates a checker using the Safe Browsing API key
+func NewSafeBrowsingChecker(apiKey string) *SafeBrowsingChecker {
+	return &SafeBrowsingChecker{
+		apiKey:   apiKey,
+		endpoint: "https://safebrowsing.googleapis.com/v4/threatMatches:find",
+	}
+}
+
+func (c *SafeBrowsingChecker) Check(ctx context.Context, rawURL string) (string, error) {
+	body, err := json.Marshal(map[string]any{
+		"client": map[string]string{"clientId": "volaticus", "clientVersion": "1.0"},
+		"threatInfo": map[string]any{
+			"threatTypes":      []string{"MALWARE", "SOCIAL_ENGINEERING", "UNWANTED_SOFTWARE", "POTENTIALLY_HARMFUL_APPLICATION"},
+			"platformTypes":    []string{"ANY_PLATFORM"},
+			"threatEntryTypes": []string{"URL"},
+			"threatEntries":    []map[string]string{{"url": rawURL}},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("encoding lookup: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// A header keeps the key out of the URLs logged by proxies and in errors
+	req.Header.Set("X-Goog-Api-Key", c.apiKey)
+
+	var result struct {
+		Matches []struct {
+			ThreatType string `json:"threatType"`
+		} `json:"matches"`
+	}
+	if err := doURLCheck(req, &result); err != nil {
+		return "", err
+	}
+	if len(result.Matches) == 0 {
+		return "", nil
+	}
+	return strings.ToLower(result.Matches[0].ThreatType), nil
+}
+
+// URLhausChecker looks up URLs in the abuse.ch URLhaus database of malware distribution sites
+type URLhausChecker struct {
+	authKey  string
+	endpoint string
+}
+
+// NewURLhausChecker creates a checker using the URLhaus auth key
+func NewURLhausChecker(authKey string) *URLhausChecker {
+	return &URLhausChecker{
+		authKey:  authKey,
+		endpoint: "https://urlhaus-api.abuse.ch/v1/url/",
+	}
+}
+
+func (c *URLhausChecker) Check(ctx context.Context, rawURL string) (string, error) {
+	form := url.Values{"url": {rawURL}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Auth-Key", c.authKey)
+
+	var result struct {
+		QueryStatus string `json:"query_status"`
+		Threat      string `json:"threat"`
+	}
+	if err := doURLCheck(req, &result); err != nil {
+		return "", err
+	}
+	switch result.QueryStatus {
+	case "no_results":
+		return "", nil
+	case "ok":
+		if result.Threat == "" {
+			return "malware", nil
+		}
+		return result.Threat, nil
+	default:
+		return "", fmt.Errorf("unexpected query status: %s", result.QueryStatus)
+	}
+}
+
+// doURLCheck sends a lookup and decodes its JSON response
+func doURLCheck(req *http.Request, result any) error {
+	resp, err := urlCheckClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending lookup: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("decoding lookup: %w", err)
+	}
+	return nil
+}
+
+// blockedDomain reports whether the host is one of the blocked domains or a subdomain of one
+func blockedDomain(host string, blocklist []string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, domain := range blocklist {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// isOwnLink reports whether the URL points at a short URL or file of this server, verified
+// custom domains serve nothing but short URLs so every link to them counts
+func (s *Service) isOwnLink(ctx context.Context, u *url.URL) bool {
+	if s.ResolveDomain(ctx, u.Hostname()) != nil {
+		return true
+	}
+
+	base, err := url.Parse(s.baseURL)
+	if err != nil || base.Host == "" || !strings.EqualFold(u.Hostname(), base.Hostname()) {
+		return false
+	}
+
+	basePath := strings.TrimSuffix(base.Path, "/")
+	for _, path := range ownPaths {
+		if strings.HasPrefix(u.Path, basePath+path) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDestination returns an error wrapping ErrURLBlocked if the URL may not be shortened.
+// Failed lookups in external threat lists are logged and the URL is accepted.
+func (s *Service) checkDestination(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("parsing URL: %w", err)
+	}
+
+	if s.isOwnLink(ctx, u) {
+		return fmt.Errorf("%w: short URLs and files of this server can't be shortened", ErrURLBlocked)
+	}
+	if blockedDomain(u.Hostname(), s.blocklist) {
+		return fmt.Errorf("%w: links to %s are not allowed", ErrURLBlocked, u.Hostname())
+	}
+	if s.blockPrivate {
+		if err := s.checkPublicHost(ctx, u.Hostname()); err != nil {
+			return err
+		}
+	}
+
+	for _, checker := range s.urlCheckers {
+		threat, err := checker.Check(ctx, rawURL)
+		if err != nil {
+			log.Warn().
+				Err(err).
+				Str("url", rawURL).
+				Msg("URL threat lookup failed, accepting the URL")
+			continue
+		}
+		if threat != "" {
+			log.Info().
+				Str("url", rawURL).
+				Str("threat", threat).
+				Msg("Rejected URL listed as a threat")
+			return fmt.Errorf("%w: the URL is listed as %s", ErrURLBlocked, strings.ReplaceAll(threat, "_", " "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"volaticus-go/internal/common/models"
+)
+
+// stubChecker answers every lookup with the same threat or error
+type stubChecker struct {
+	threat string
+	err    error
+}
+
+func (c stubChecker) Check(context.Context, string) (string, error) {
+	return c.threat, c.err
+}
+
+func TestCheckDestination(t *testing.T) {
+	verifiedAt := time.Now()
+	s := &Service{
+		repo: &domainRepository{domains: []*models.CustomDomain{
+			{Domain: "go.brand.example", VerifiedAt: &verifiedAt},
+			{Domain: "pending.brand.example"},
+		}},
+		baseURL:   "https://sho.rt/app",
+		baseHost:  "sho.rt",
+		blocklist: []string{"evil.example"},
+	}
+
+	tests := []struct {
+		url     string
+		blocked bool
+	}{
+		{url: "https://example.com/page", blocked: false},
+		{url: "https://evil.example/login", blocked: true},
+		{url: "https://login.EVIL.example./", blocked: true},
+		{url: "https://notevil.example/", blocked: false},
+		{url: "https://sho.rt/app/s/abc", blocked: true},
+		{url: "https://sho.rt:443/app/f/report.pdf", blocked: true},
+		{url: "https://sho.rt/app/login", blocked: false},
+		{url: "https://sho.rt/s/abc", blocked: false}, // Outside the base path
+		{url: "https://GO.brand.example/abc", blocked: true},
+		{url: "https://pending.brand.example/abc", blocked: false}, // Not verified, the app doesn't serve it yet
+	}
+	for _, tt := range tests {
+		err := s.checkDestination(context.Background(), tt.url)
+		if got := errors.Is(err, ErrURLBlocked); got != tt.blocked {
+			t.Errorf("checkDestination(%q) = %v, want blocked %v", tt.url, err, tt.blocked)
+		}
+	}
+}
+
+func TestCheckDestinationThreatLists(t *testing.T) {
+	s := &Service{repo: &domainRepository{}, urlCheckers: []URLChecker{stubChecker{err: errors.New("timeout")}}}
+	if err := s.checkDestination(context.Background(), "https://example.com"); err != nil {
+		t.Errorf("failed lookup blocked the URL: %v", err)
+	}
+
+	s.urlCheckers = append(s.urlCheckers, stubChecker{threat: "social_engineering"})
+	err := s.checkDestination(context.Background(), "https://example.com")
+	if !errors.Is(err, ErrURLBlocked) || !strings.Contains(err.Error(), "social engineering") {
+		t.Errorf("checkDestination() = %v, want the listed threat", err)
+	}
+}
+
+func TestSafeBrowsingChecker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Goog-Api-Key") != "api-key" || r.URL.RawQuery != "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"matches": [{"threatType": "MALWARE", "platformType": "ANY_PLATFORM"}]}`))
+	}))
+	defer server.Close()
+
+	checker := NewSafeBrowsingChecker("api-key")
+	checker.endpoint = server.URL
+	threat, err := checker.Check(context.Background(), "https://evil.example")
+	if err != nil || threat != "malware" {
+		t.Errorf("Check() = %q, %v, want malware", threat, err)
+	}
+
+	checker.apiKey = "wrong"
+	if _, err := checker.Check(context.Background(), "https://evil.example"); err == nil {
+		t.Error("Check() accepted a rejected lookup")
+	}
+}
+
+func TestURLhausChecker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("url") == "https://evil.example" {
+			w.Write([]byte(`{"query_status": "ok", "threat": "malware_download"}`))
+			return
+		}
+		w.Write([]byte(`{"query_status": "no_results"}`))
+	}))
+	defer server.Close()
+
+	checker := NewURLhausChecker("auth-key")
+	checker.endpoint = server.URL
+	if threat, err := checker.Check(context.Background(), "https://evil.example"); err != nil || threat != "malware_download" {
+		t.Errorf("Check() = %q, %v, want malware_download", threat, err)
+	}
+	if threat, err := checker.Check(context.Background(), "https://example.com"); err != nil || threat != "" {
+		t.Errorf("Check() = %q, %v, want no threat", threat, err)
+	}
+}
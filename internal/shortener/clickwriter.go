@@ -0,0 +1,185 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+	"volaticus-go/internal/common/models"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// clickFlushTimeout bounds writing one batch of clicks
+	clickFlushTimeout = 10 * time.Second
+	// clickRetryBatches is how many batches the buffer holds while writes fail, older failed
+	// batches are dropped beyond that
+	clickRetryBatches = 10
+)
+
+// ClickWriter buffers clicks in memory and writes them in batches, so a busy link
+// costs one transaction per batch instead of one per redirect
+type ClickWriter struct {
+	repo      Repository
+	batchSize int
+	interval  time.Duration
+
+	mu      sync.Mutex
+	clicks  []*models.ClickAnalytics
+	counts  map[uuid.UUID]int
+	pending int
+	started bool
+	closed  bool
+
+	full chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewClickWriter creates a writer flushing every batchSize clicks or every interval, whichever comes first
+func NewClickWriter(repo Repository, batchSize int, interval time.Duration) *ClickWriter {
+	return &ClickWriter{
+		repo:      repo,
+		batchSize: batchSize,
+		interval:  interval,
+		counts:    make(map[uuid.UUID]int),
+		full:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Record buffers a click of the URL. click is nil for links without tracking, which only count the access.
+func (w *ClickWriter) Record(urlID uuid.UUID, click *models.ClickAnalytics) {
+	w.mu.Lock()
+	if click != nil {
+		w.clicks = append(w.clicks, click)
+	}
+	w.counts[urlID]++
+	w.pending++
+	full := w.pending >= w.batchSize
+	closed := w.closed
+	w.mu.Unlock()
+
+	// Nothing flushes the buffer anymore once the writer is closed
+	if closed {
+		ctx, cancel := context.WithTimeout(context.Background(), clickFlushTimeout)
+		defer cancel()
+		_ = w.flush(ctx)
+		return
+	}
+
+	if full {
+		select {
+		case w.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Start writes the buffered clicks periodically and whenever a batch is full,
+// until the context is done or the writer is closed
+func (w *ClickWriter) Start(ctx context.Context) {
+	w.mu.Lock()
+	if w.started || w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.started = true
+	w.mu.Unlock()
+
+	ticker := time.NewTicker(w.interval)
+
+	go func() {
+		defer close(w.done)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.stop:
+				return
+			case <-ticker.C:
+			case <-w.full:
+			}
+
+			flushCtx, cancel := context.WithTimeout(context.Background(), clickFlushTimeout)
+			_ = w.flush(flushCtx)
+			cancel()
+		}
+	}()
+}
+
+// Close stops the periodic flushing and writes the clicks still buffered
+func (w *ClickWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	started := w.started
+	w.mu.Unlock()
+
+	close(w.stop)
+	if started {
+		select {
+		case <-w.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return w.flush(ctx)
+}
+
+// flush writes and empties the buffer. A batch that fails goes back into the buffer for the
+// next flush to retry.
+func (w *ClickWriter) flush(ctx context.Context) error {
+	w.mu.Lock()
+	clicks, counts, accesses := w.clicks, w.counts, w.pending
+	w.clicks, w.counts, w.pending = nil, make(map[uuid.UUID]int), 0
+	w.mu.Unlock()
+
+	if len(counts) == 0 {
+		return nil
+	}
+
+	if err := w.repo.RecordClicks(ctx, clicks, counts); err != nil {
+		if w.requeue(clicks, counts, accesses) {
+			log.Error().
+				Err(err).
+				Int("clicks", len(clicks)).
+				Int("urls", len(counts)).
+				Msg("Failed to write click batch, retrying with the next one")
+		} else {
+			log.Error().
+				Err(err).
+				Int("clicks", len(clicks)).
+				Int("accesses", accesses).
+				Msg("Failed to write click batch, clicks lost")
+		}
+		return fmt.Errorf("writing %d clicks: %w", len(clicks), err)
+	}
+	return nil
+}
+
+// requeue puts a failed batch back in front of the clicks recorded meanwhile. It's dropped
+// instead once the writer is closed, as nothing flushes it anymore, or when the buffer would
+// outgrow clickRetryBatches batches while the database is unavailable.
+func (w *ClickWriter) requeue(clicks []*models.ClickAnalytics, counts map[uuid.UUID]int, accesses int) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed || w.pending+accesses > clickRetryBatches*w.batchSize {
+		return false
+	}
+
+	w.clicks = append(clicks, w.clicks...)
+	for id, count := range counts {
+		w.counts[id] += count
+	}
+	w.pending += accesses
+	return true
+}
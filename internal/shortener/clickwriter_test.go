@@ -0,0 +1,135 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+	"volaticus-go/internal/common/models"
+
+	"github.com/google/uuid"
+)
+
+// batchRepository collects the batches written by a ClickWriter
+type batchRepository struct {
+	Repository
+	mu      sync.Mutex
+	clicks  int
+	counts  map[uuid.UUID]int
+	batches chan int
+	fail    int // Number of writes failing before they succeed
+}
+
+func newBatchRepository() *batchRepository {
+	return &batchRepository{counts: make(map[uuid.UUID]int), batches: make(chan int, 10)}
+}
+
+func (r *batchRepository) RecordClicks(_ context.Context, clicks []*models.ClickAnalytics, accessCounts map[uuid.UUID]int) error {
+	r.mu.Lock()
+	if r.fail > 0 {
+		r.fail--
+		r.mu.Unlock()
+		return errors.New("database unavailable")
+	}
+	r.clicks += len(clicks)
+	for id, count := range accessCounts {
+		r.counts[id] += count
+	}
+	r.mu.Unlock()
+
+	r.batches <- len(clicks)
+	return nil
+}
+
+func TestClickWriterFlushesFullBatch(t *testing.T) {
+	repo := newBatchRepository()
+	writer := NewClickWriter(repo, 3, time.Hour)
+	writer.Start(context.Background())
+	defer writer.Close(context.Background())
+
+	urlID := uuid.New()
+	writer.Record(urlID, &models.ClickAnalytics{ID: uuid.New(), URLID: urlID})
+	writer.Record(urlID, nil)
+	writer.Record(urlID, &models.ClickAnalytics{ID: uuid.New(), URLID: urlID})
+
+	select {
+	case n := <-repo.batches:
+		if n != 2 {
+			t.Errorf("batch has %d clicks, want 2", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("full batch was not written")
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if repo.counts[urlID] != 3 {
+		t.Errorf("access count = %d, want 3 including the untracked click", repo.counts[urlID])
+	}
+}
+
+func TestClickWriterFlushesOnInterval(t *testing.T) {
+	repo := newBatchRepository()
+	writer := NewClickWriter(repo, 100, 10*time.Millisecond)
+	writer.Start(context.Background())
+	defer writer.Close(context.Background())
+
+	writer.Record(uuid.New(), &models.ClickAnalytics{ID: uuid.New()})
+
+	select {
+	case <-repo.batches:
+	case <-time.After(time.Second):
+		t.Fatal("buffered click was not written after the interval")
+	}
+}
+
+func TestClickWriterCloseFlushes(t *testing.T) {
+	repo := newBatchRepository()
+	writer := NewClickWriter(repo, 100, time.Hour)
+	writer.Start(context.Background())
+
+	urlID := uuid.New()
+	writer.Record(urlID, &models.ClickAnalytics{ID: uuid.New(), URLID: urlID})
+	if err := writer.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if repo.clicks != 1 || repo.counts[urlID] != 1 {
+		t.Errorf("Close() wrote %d clicks and count %d, want 1 and 1", repo.clicks, repo.counts[urlID])
+	}
+
+	// Late clicks are written directly
+	writer.Record(urlID, &models.ClickAnalytics{ID: uuid.New(), URLID: urlID})
+	if repo.clicks != 2 {
+		t.Errorf("click after Close() was not written, %d clicks stored", repo.clicks)
+	}
+}
+
+func TestClickWriterRetriesFailedBatch(t *testing.T) {
+	repo := newBatchRepository()
+	repo.fail = 1
+	writer := NewClickWriter(repo, 2, time.Hour)
+
+	urlID := uuid.New()
+	writer.Record(urlID, &models.ClickAnalytics{ID: uuid.New(), URLID: urlID})
+	if err := writer.flush(context.Background()); err == nil {
+		t.Fatal("flush() error = nil, want the failed write")
+	}
+	writer.Record(urlID, nil)
+	if err := writer.flush(context.Background()); err != nil {
+		t.Fatalf("flush() error = %v", err)
+	}
+	if repo.clicks != 1 || repo.counts[urlID] != 2 {
+		t.Errorf("retry wrote %d clicks and count %d, want 1 and 2", repo.clicks, repo.counts[urlID])
+	}
+
+	// A failing database doesn't grow the buffer beyond clickRetryBatches batches
+	repo.fail = 1
+	for i := 0; i < clickRetryBatches*2+1; i++ {
+		writer.Record(urlID, nil)
+	}
+	writer.flush(context.Background())
+	if writer.pending != 0 || len(writer.counts) != 0 {
+		t.Errorf("buffer holds %d accesses after an oversized batch failed, want none", writer.pending)
+	}
+}
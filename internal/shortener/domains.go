@@ -0,0 +1,296 @@
+package shortener
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"volaticus-go/internal/common/models"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// A domain is verified by publishing its token in a TXT record or a file on the domain
+const (
+	domainTXTPrefix  = "_volaticus."
+	domainTXTValue   = "volaticus-verify="
+	domainWellKnown  = "/.well-known/volaticus-verify.txt"
+	domainFileLimit  = 1024
+	domainCacheTTL   = time.Minute
+	domainCacheSize  = 1000 // Arbitrary Host headers must not grow the cache without bound
+	domainTokenBytes = 16
+)
+
+// domainPattern matches lowercase host names with at least two labels
+var domainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// cachedDomain is a request host resolved to a verified domain, domain is nil for other hosts
+type cachedDomain struct {
+	domain  *models.CustomDomain
+	expires time.Time
+}
+
+type domainContextKey struct{}
+
+// withDomain returns a context carrying the custom domain a request was sent to
+func withDomain(ctx context.Context, domain *models.CustomDomain) context.Context {
+	return context.WithValue(ctx, domainContextKey{}, domain)
+}
+
+// domainFromContext returns the custom domain of the request, or nil for the default domain
+func domainFromContext(ctx context.Context) *models.CustomDomain {
+	domain, _ := ctx.Value(domainContextKey{}).(*models.CustomDomain)
+	return domain
+}
+
+// normalizeDomain lowercases a domain and strips a trailing dot, it returns an error wrapping
+// ErrInvalidDomain if it isn't a host name that can be added
+func (s *Service) normalizeDomain(name string) (string, error) {
+	name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+	if len(name) > 253 || !domainPattern.MatchString(name) {
+		return "", fmt.Errorf("%w: %q is not a host name like go.example.com", ErrInvalidDomain, name)
+	}
+	if name == s.baseHost {
+		return "", fmt.Errorf("%w: links on %s don't need a custom domain", ErrInvalidDomain, name)
+	}
+	return name, nil
+}
+
+// AddDomain adds an unverified custom domain for the user with a new verification token
+func (s *Service) AddDomain(ctx context.Context, userID uuid.UUID, name string) (*models.CustomDomain, error) {
+	name, err := s.normalizeDomain(name)
+	if err != nil {
+		return nil, err
+	}
+	// Another user already proved control over the domain
+	if _, err := s.repo.GetVerifiedDomain(ctx, name); err == nil {
+		return nil, ErrDomainTaken
+	} else if !errors.Is(err, ErrDomainNotFound) {
+		return nil, fmt.Errorf("checking domain: %w", err)
+	}
+
+	token := make([]byte, domainTokenBytes)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("generating verification token: %w", err)
+	}
+
+	domain := &models.CustomDomain{
+		ID:                uuid.New(),
+		UserID:            userID,
+		Domain:            name,
+		VerificationToken: hex.EncodeToString(token),
+		CreatedAt:         time.Now(),
+	}
+	if err := s.repo.CreateDomain(ctx, domain); err != nil {
+		return nil, fmt.Errorf("creating domain: %w", err)
+	}
+	return domain, nil
+}
+
+// ListDomains returns the custom domains of the user
+func (s *Service) ListDomains(ctx context.Context, userID uuid.UUID) ([]*models.CustomDomain, error) {
+	return s.repo.GetDomainsByUserID(ctx, userID)
+}
+
+// VerifiedDomainNames returns the names of the user's verified domains, which new links can use
+func (s *Service) VerifiedDomainNames(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	if !s.customDomains {
+		return nil, nil
+	}
+	domains, err := s.repo.GetDomainsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, domain := range domains {
+		if domain.VerifiedAt != nil {
+			names = append(names, domain.Domain)
+		}
+	}
+	return names, nil
+}
+
+// userDomain returns the domain with the ID if it belongs to the user
+func (s *Service) userDomain(ctx context.Context, userID, domainID uuid.UUID) (*models.CustomDomain, error) {
+	domains, err := s.repo.GetDomainsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, domain := range domains {
+		if domain.ID == domainID {
+			return domain, nil
+		}
+	}
+	return nil, ErrDomainNotFound
+}
+
+// verifiedUserDomain returns the user's domain with the name, links can only be created on it once it is verified
+func (s *Service) verifiedUserDomain(ctx context.Context, userID uuid.UUID, name string) (*models.CustomDomain, error) {
+	if !s.customDomains {
+		return nil, ErrDomainNotFound
+	}
+	name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+	domains, err := s.repo.GetDomainsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, domain := range domains {
+		if domain.Domain != name {
+			continue
+		}
+		if domain.VerifiedAt == nil {
+			return nil, ErrDomainNotVerified
+		}
+		return domain, nil
+	}
+	return nil, ErrDomainNotFound
+}
+
+// VerifyDomain checks that the verification token of the domain is published and marks the
+// domain as verified. Verified domains are returned as they are.
+func (s *Service) VerifyDomain(ctx context.Context, userID, domainID uuid.UUID) (*models.CustomDomain, error) {
+	domain, err := s.userDomain(ctx, userID, domainID)
+	if err != nil {
+		return nil, err
+	}
+	if domain.VerifiedAt != nil {
+		return domain, nil
+	}
+
+	if !s.hasVerificationToken(ctx, domain) {
+		return nil, fmt.Errorf("%w: add a TXT record %s%s with the value %s%s, or serve the token at http://%s%s",
+			ErrVerificationFailed,
+			domainTXTPrefix, domain.Domain, domainTXTValue, domain.VerificationToken,
+			domain.Domain, domainWellKnown)
+	}
+
+	if err := s.repo.MarkDomainVerified(ctx, domain.ID); err != nil {
+		return nil, fmt.Errorf("verifying domain: %w", err)
+	}
+	s.forgetDomain(domain.Domain)
+
+	now := time.Now()
+	domain.VerifiedAt = &now
+	log.Info().
+		Str("domain", domain.Domain).
+		Str("user_id", userID.String()).
+		Msg("Verified custom domain")
+	return domain, nil
+}
+
+// hasVerificationToken reports whether the token of the domain is in its TXT record or well-known file
+func (s *Service) hasVerificationToken(ctx context.Context, domain *models.CustomDomain) bool {
+	lookupTXT := s.lookupTXT
+	if lookupTXT == nil {
+		lookupTXT = net.DefaultResolver.LookupTXT
+	}
+	records, err := lookupTXT(ctx, domainTXTPrefix+domain.Domain)
+	if err == nil {
+		for _, record := range records {
+			if strings.TrimSpace(record) == domainTXTValue+domain.VerificationToken {
+				return true
+			}
+		}
+	}
+
+	// Users pick the domain, so it may point anywhere and BLOCK_PRIVATE_IPS doesn't apply
+	client := s.domainClient
+	if client == nil {
+		client = publicOnlyClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+domain.Domain+domainWellKnown, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Debug().
+			Err(err).
+			Str("domain", domain.Domain).
+			Msg("Failed to fetch domain verification file")
+		return false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, domainFileLimit))
+	return err == nil && strings.TrimSpace(string(body)) == domain.VerificationToken
+}
+
+// DeleteDomain removes a custom domain of the user, domains with short links are kept
+func (s *Service) DeleteDomain(ctx context.Context, userID, domainID uuid.UUID) error {
+	domain, err := s.userDomain(ctx, userID, domainID)
+	if err != nil {
+		return err
+	}
+
+	count, err := s.repo.CountDomainURLs(ctx, domain.ID)
+	if err != nil {
+		return fmt.Errorf("counting domain URLs: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: delete its %d short links first", ErrDomainInUse, count)
+	}
+
+	if err := s.repo.DeleteDomain(ctx, domain.ID); err != nil {
+		return fmt.Errorf("deleting domain: %w", err)
+	}
+	s.forgetDomain(domain.Domain)
+	return nil
+}
+
+// ResolveDomain returns the verified custom domain a request host names, or nil for the host of
+// the base URL and unknown hosts. Lookups are cached briefly as every request on a custom domain
+// needs one.
+func (s *Service) ResolveDomain(ctx context.Context, host string) *models.CustomDomain {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" || host == s.baseHost {
+		return nil
+	}
+
+	s.domainMu.Lock()
+	cached, ok := s.domainCache[host]
+	s.domainMu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.domain
+	}
+
+	domain, err := s.repo.GetVerifiedDomain(ctx, host)
+	if err != nil {
+		if !errors.Is(err, ErrDomainNotFound) {
+			log.Error().
+				Err(err).
+				Str("host", host).
+				Msg("Failed to resolve custom domain")
+			return nil
+		}
+		domain = nil
+	}
+
+	s.domainMu.Lock()
+	if s.domainCache == nil || len(s.domainCache) >= domainCacheSize {
+		s.domainCache = make(map[string]cachedDomain)
+	}
+	s.domainCache[host] = cachedDomain{domain: domain, expires: time.Now().Add(domainCacheTTL)}
+	s.domainMu.Unlock()
+	return domain
+}
+
+// forgetDomain drops the cached resolution of a domain after it was verified or deleted
+func (s *Service) forgetDomain(name string) {
+	s.domainMu.Lock()
+	delete(s.domainCache, name)
+	s.domainMu.Unlock()
+}
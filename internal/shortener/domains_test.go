@@ -0,0 +1,300 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"volaticus-go/internal/common/models"
+	userctx "volaticus-go/internal/context"
+
+	"github.com/google/uuid"
+)
+
+// domainRepository holds the custom domains of one user and counts lookups of verified domains
+type domainRepository struct {
+	racingRepository
+	domains  []*models.CustomDomain
+	lookups  int
+	verified []uuid.UUID
+}
+
+func (r *domainRepository) GetDomainsByUserID(context.Context, uuid.UUID) ([]*models.CustomDomain, error) {
+	return r.domains, nil
+}
+
+func (r *domainRepository) GetVerifiedDomain(_ context.Context, name string) (*models.CustomDomain, error) {
+	r.lookups++
+	for _, domain := range r.domains {
+		if domain.Domain == name && domain.VerifiedAt != nil {
+			return domain, nil
+		}
+	}
+	return nil, ErrDomainNotFound
+}
+
+func (r *domainRepository) MarkDomainVerified(_ context.Context, id uuid.UUID) error {
+	r.verified = append(r.verified, id)
+	return nil
+}
+
+func TestNormalizeDomain(t *testing.T) {
+	s := &Service{baseHost: "sho.rt"}
+
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "go.example.com", want: "go.example.com"},
+		{name: " Go.Example.COM. ", want: "go.example.com"},
+		{name: "localhost", wantErr: true},
+		{name: "-bad.example.com", wantErr: true},
+		{name: "go.example.com/path", wantErr: true},
+		{name: "go.example.com:8080", wantErr: true},
+		{name: "sho.rt", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := s.normalizeDomain(tt.name)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidDomain) {
+				t.Errorf("normalizeDomain(%q) error = %v, want ErrInvalidDomain", tt.name, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("normalizeDomain(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestVerifyDomain(t *testing.T) {
+	userID := uuid.New()
+	newDomain := func() *models.CustomDomain {
+		return &models.CustomDomain{ID: uuid.New(), UserID: userID, Domain: "go.example.com", VerificationToken: "abc123"}
+	}
+	// The well-known file is served by a test server that every request is sent to
+	wellKnown := func(body string) *http.Client {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != domainWellKnown || body == "" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(body + "\n"))
+		}))
+		t.Cleanup(server.Close)
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+			},
+		}
+		return &http.Client{Transport: transport}
+	}
+
+	tests := []struct {
+		name     string
+		txt      []string
+		file     string
+		verified bool
+	}{
+		{name: "TXT record", txt: []string{"other", "volaticus-verify=abc123"}, verified: true},
+		{name: "well-known file", file: "abc123", verified: true},
+		{name: "wrong token", txt: []string{"volaticus-verify=def456"}, file: "def456", verified: false},
+		{name: "nothing published", verified: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			domain := newDomain()
+			repo := &domainRepository{domains: []*models.CustomDomain{domain}}
+			var lookedUp string
+			s := &Service{
+				repo:         repo,
+				domainClient: wellKnown(tt.file),
+				lookupTXT: func(_ context.Context, name string) ([]string, error) {
+					lookedUp = name
+					return tt.txt, nil
+				},
+			}
+
+			got, err := s.VerifyDomain(context.Background(), userID, domain.ID)
+			if lookedUp != "_volaticus.go.example.com" {
+				t.Errorf("looked up TXT records of %q", lookedUp)
+			}
+			if !tt.verified {
+				if !errors.Is(err, ErrVerificationFailed) {
+					t.Fatalf("VerifyDomain() error = %v, want ErrVerificationFailed", err)
+				}
+				if !strings.Contains(err.Error(), "volaticus-verify=abc123") {
+					t.Errorf("error %q doesn't explain the record to add", err)
+				}
+				if len(repo.verified) != 0 {
+					t.Error("domain marked as verified")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyDomain() error = %v", err)
+			}
+			if got.VerifiedAt == nil || len(repo.verified) != 1 || repo.verified[0] != domain.ID {
+				t.Errorf("domain not marked as verified, verified = %v", repo.verified)
+			}
+		})
+	}
+
+	t.Run("other user", func(t *testing.T) {
+		domain := newDomain()
+		s := &Service{repo: &domainRepository{domains: []*models.CustomDomain{domain}}}
+		if _, err := s.VerifyDomain(context.Background(), userID, uuid.New()); !errors.Is(err, ErrDomainNotFound) {
+			t.Errorf("VerifyDomain() of an unknown domain error = %v, want ErrDomainNotFound", err)
+		}
+	})
+}
+
+func TestCreateShortURLOnDomain(t *testing.T) {
+	now := time.Now()
+	verified := &models.CustomDomain{ID: uuid.New(), Domain: "go.example.com", VerifiedAt: &now}
+	pending := &models.CustomDomain{ID: uuid.New(), Domain: "new.example.com"}
+	repo := &domainRepository{domains: []*models.CustomDomain{verified, pending}}
+	s := &Service{
+		repo:          repo,
+		baseURL:       "https://sho.rt/app",
+		customDomains: true,
+		codeLength:    8,
+		alphabet:      "abcdef",
+		codeRetries:   1,
+	}
+
+	resp, err := s.CreateShortURL(context.Background(), uuid.New(), &models.CreateURLRequest{
+		URL:        "https://example.com",
+		VanityCode: "my-link",
+		Domain:     "Go.Example.com",
+	})
+	if err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+	if resp.ShortURL != "https://go.example.com/my-link" {
+		t.Errorf("ShortURL = %q, want https://go.example.com/my-link", resp.ShortURL)
+	}
+	if want := "https://sho.rt/app/api/v1/urls/" + resp.ID.String(); resp.AnalyticsURL != want {
+		t.Errorf("AnalyticsURL = %q, want %q", resp.AnalyticsURL, want)
+	}
+
+	tests := []struct {
+		domain string
+		want   error
+	}{
+		{domain: "new.example.com", want: ErrDomainNotVerified},
+		{domain: "other.example.com", want: ErrDomainNotFound},
+	}
+	for _, tt := range tests {
+		req := &models.CreateURLRequest{URL: "https://example.com", Domain: tt.domain}
+		if _, err := s.CreateShortURL(context.Background(), uuid.New(), req); !errors.Is(err, tt.want) {
+			t.Errorf("CreateShortURL() on %s error = %v, want %v", tt.domain, err, tt.want)
+		}
+	}
+
+	s.customDomains = false
+	req := &models.CreateURLRequest{URL: "https://example.com", Domain: "go.example.com"}
+	if _, err := s.CreateShortURL(context.Background(), uuid.New(), req); !errors.Is(err, ErrDomainNotFound) {
+		t.Errorf("CreateShortURL() with custom domains disabled error = %v, want ErrDomainNotFound", err)
+	}
+}
+
+func TestHandleCreateShortURLLocation(t *testing.T) {
+	h := NewHandler(&Service{
+		repo:        &domainRepository{},
+		baseURL:     "https://sho.rt/app",
+		codeLength:  8,
+		alphabet:    "abcdef",
+		codeRetries: 1,
+	}, nil)
+
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(`{"url": "https://example.com"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r = r.WithContext(userctx.WithUser(r.Context(), &userctx.UserInfo{ID: uuid.New(), Username: "alice"}))
+	w := httptest.NewRecorder()
+	h.HandleCreateShortURL(w, r)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusCreated, w.Body)
+	}
+	if !strings.HasPrefix(w.Header().Get("Location"), "https://sho.rt/app/api/v1/urls/") {
+		t.Errorf("Location = %q, want the API resource of the link", w.Header().Get("Location"))
+	}
+}
+
+func TestResolveDomainCache(t *testing.T) {
+	now := time.Now()
+	domain := &models.CustomDomain{ID: uuid.New(), Domain: "go.example.com", VerifiedAt: &now}
+	repo := &domainRepository{domains: []*models.CustomDomain{domain}}
+	s := &Service{repo: repo, baseHost: "sho.rt"}
+
+	for i := 0; i < 3; i++ {
+		if got := s.ResolveDomain(context.Background(), "GO.example.com:443"); got != domain {
+			t.Fatalf("ResolveDomain() = %v, want the verified domain", got)
+		}
+	}
+	if got := s.ResolveDomain(context.Background(), "unknown.example.com"); got != nil {
+		t.Errorf("ResolveDomain() of an unknown host = %v, want nil", got)
+	}
+	s.ResolveDomain(context.Background(), "unknown.example.com")
+	if repo.lookups != 2 {
+		t.Errorf("looked up %d hosts, want 2 with the cache", repo.lookups)
+	}
+
+	if got := s.ResolveDomain(context.Background(), "sho.rt"); got != nil || repo.lookups != 2 {
+		t.Errorf("ResolveDomain() of the base host = %v after %d lookups", got, repo.lookups)
+	}
+
+	s.forgetDomain("go.example.com")
+	s.ResolveDomain(context.Background(), "go.example.com")
+	if repo.lookups != 3 {
+		t.Errorf("forgotten domain not looked up again, lookups = %d", repo.lookups)
+	}
+}
+
+func TestCustomDomainMiddleware(t *testing.T) {
+	now := time.Now()
+	domain := &models.CustomDomain{ID: uuid.New(), Domain: "go.example.com", VerifiedAt: &now}
+	h := NewHandler(&Service{repo: &domainRepository{domains: []*models.CustomDomain{domain}}, baseHost: "sho.rt"}, nil)
+
+	var gotPath string
+	var gotDomain *models.CustomDomain
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotDomain = domainFromContext(r.Context())
+	})
+
+	tests := []struct {
+		url        string
+		wantPath   string
+		wantDomain bool
+		wantStatus int
+	}{
+		{url: "https://go.example.com/my-link", wantPath: "/s/my-link", wantDomain: true, wantStatus: http.StatusOK},
+		{url: "https://go.example.com/assets/css/output.css", wantPath: "/assets/css/output.css", wantStatus: http.StatusOK},
+		{url: "https://go.example.com/login", wantPath: "/s/login", wantDomain: true, wantStatus: http.StatusOK},
+		{url: "https://go.example.com/", wantStatus: http.StatusNotFound},
+		{url: "https://go.example.com/api/v1/urls", wantStatus: http.StatusNotFound},
+		{url: "https://sho.rt/login", wantPath: "/login", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		gotPath, gotDomain = "", nil
+		w := httptest.NewRecorder()
+		h.CustomDomainMiddleware(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.url, nil))
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.url, w.Code, tt.wantStatus)
+		}
+		if gotPath != tt.wantPath {
+			t.Errorf("%s: served %q, want %q", tt.url, gotPath, tt.wantPath)
+		}
+		if (gotDomain != nil) != tt.wantDomain {
+			t.Errorf("%s: domain in context = %v", tt.url, gotDomain)
+		}
+	}
+}
@@ -1,26 +1,26 @@
 package shortener
 
 import (
-	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/rs/zerolog/log"
 	"net/http"
+	"volaticus-go/internal/common/apierror"
 )
 
 // APIError represents a standardized error response
-type APIError struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
-	Details string `json:"details,omitempty"`
-}
+type APIError = apierror.APIError
 
 // Common error codes
 const (
-	ErrCodeInvalidInput  = "INVALID_INPUT"
-	ErrCodeNotFound      = "NOT_FOUND"
-	ErrCodeUnauthorized  = "UNAUTHORIZED"
-	ErrCodeAlreadyExists = "ALREADY_EXISTS"
-	ErrCodeInternalError = "INTERNAL_ERROR"
-	ErrCodeExpired       = "EXPIRED"
+	ErrCodeInvalidInput  = apierror.ErrCodeInvalidInput
+	ErrCodeNotFound      = apierror.ErrCodeNotFound
+	ErrCodeUnauthorized  = apierror.ErrCodeUnauthorized
+	ErrCodeAlreadyExists = apierror.ErrCodeAlreadyExists
+	ErrCodeInternalError = apierror.ErrCodeInternalError
+	ErrCodeExpired       = apierror.ErrCodeExpired
+	ErrCodeLimitExceeded = apierror.ErrCodeLimitExceeded
+	ErrCodeRejected      = apierror.ErrCodeRejected
 )
 
 // Error responses
@@ -49,19 +49,67 @@ var (
 		Code:    ErrCodeExpired,
 		Message: "URL has expired",
 	}
+	ErrURLLimitExceeded = &APIError{
+		Code:    ErrCodeLimitExceeded,
+		Message: "Short URL limit reached",
+	}
+	ErrCustomDomainNotFound = &APIError{
+		Code:    ErrCodeNotFound,
+		Message: "Domain not found",
+	}
+	ErrInvalidCustomDomain = &APIError{
+		Code:    ErrCodeInvalidInput,
+		Message: "Invalid domain",
+	}
+	ErrCustomDomainTaken = &APIError{
+		Code:    ErrCodeAlreadyExists,
+		Message: "Domain already in use",
+	}
+)
+
+// Errors returned by the service
+var (
+	// ErrShortCodeExists is returned when the short code is already used by another URL
+	ErrShortCodeExists = errors.New("short code already in use")
+	// ErrInvalidVanity is wrapped by the validation errors of vanity codes
+	ErrInvalidVanity = errors.New("invalid vanity code")
+	// ErrNotFound is returned when no active URL matches
+	ErrNotFound = errors.New("URL not found")
+	// ErrExpired is returned when the URL exists but has expired
+	ErrExpired = errors.New("URL has expired")
+	// ErrForbidden is returned when the URL belongs to another user
+	ErrForbidden = errors.New("unauthorized access to URL")
+	// ErrURLLimitReached is returned when the user already has the maximum number of URLs
+	ErrURLLimitReached = errors.New("short URL limit reached")
+	// ErrNotPage is returned when a link page operation is used on a redirect
+	ErrNotPage = errors.New("URL is not a link page")
+	// ErrURLBlocked is wrapped with the reason when a destination may not be shortened
+	ErrURLBlocked = errors.New("URL is not allowed")
+	// ErrPrivateURL is returned for destinations on a private network when those are blocked
+	ErrPrivateURL = fmt.Errorf("%w: the host resolves to a private network address", ErrURLBlocked)
+	// ErrInvalidDomain is wrapped by the validation errors of custom domains
+	ErrInvalidDomain = errors.New("invalid domain")
+	// ErrDomainNotFound is returned when no custom domain of the user matches
+	ErrDomainNotFound = errors.New("domain not found")
+	// ErrDomainTaken is returned when the domain was already added by the user or verified by another user
+	ErrDomainTaken = errors.New("domain already in use")
+	// ErrDomainNotVerified is returned when links are created on a domain that isn't verified yet
+	ErrDomainNotVerified = errors.New("domain is not verified")
+	// ErrVerificationFailed is returned when neither the TXT record nor the well-known file has the token
+	ErrVerificationFailed = errors.New("domain verification failed")
+	// ErrDomainInUse is returned when a domain that still has short links is deleted
+	ErrDomainInUse = errors.New("domain still has short links")
+	// ErrInvalidExpiration is wrapped with the reason when an expiration date is rejected
+	ErrInvalidExpiration = errors.New("invalid expiration")
+	// ErrCursorSort is returned when a list sorted by anything but creation time is continued from a cursor
+	ErrCursorSort = errors.New("cursor pagination only supports the newest and oldest sort")
+	// ErrInvalidGracePeriod is returned when an old code should keep redirecting for too long after regenerating
+	ErrInvalidGracePeriod = fmt.Errorf("grace period must be between 0 and %d hours", int(maxCodeGracePeriod.Hours()))
 )
 
 // HandleError sends a standardized error response
 func HandleError(w http.ResponseWriter, err *APIError, status int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-
-	if err := json.NewEncoder(w).Encode(err); err != nil {
-		log.Error().
-			Err(err).
-			Interface("api_error", err).
-			Msg("failed to encode error response")
-	}
+	apierror.Write(w, err, status)
 }
 
 // LogError logs an error and returns an appropriate API error
@@ -79,10 +127,10 @@ func LogError(err error, context string) *APIError {
 
 // IsNotFound checks if an error is a not found error
 func IsNotFound(err error) bool {
-	return err.Error() == "URL not found" || err.Error() == "URL not found or expired"
+	return errors.Is(err, ErrNotFound)
 }
 
 // IsUnauthorized checks if an error is an unauthorized error
 func IsUnauthorized(err error) bool {
-	return err.Error() == "unauthorized access" || err.Error() == "unauthorized access to URL"
+	return errors.Is(err, ErrForbidden)
 }
@@ -0,0 +1,35 @@
+package shortener
+
+import (
+	"fmt"
+	"time"
+)
+
+// parseExpiresAt parses the expires_at form value, an RFC 3339 timestamp. A time without an offset
+// would depend on the time zone of the server, the web forms convert their local time before sending
+// it.
+func parseExpiresAt(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expiration needs a date, time and UTC offset like 2030-06-01T12:00:00+02:00")
+	}
+	return t.UTC(), nil
+}
+
+// checkExpiration rejects expiration dates that aren't in the future and clamps them, or a
+// missing one, to the configured maximum. Expirations are returned in UTC.
+func (s *Service) checkExpiration(expiresAt *time.Time, now time.Time) (*time.Time, error) {
+	if expiresAt != nil && !expiresAt.After(now) {
+		return nil, fmt.Errorf("%w: expiration must be in the future", ErrInvalidExpiration)
+	}
+	if s.maxExpiry > 0 {
+		if limit := now.Add(s.maxExpiry).UTC(); expiresAt == nil || expiresAt.After(limit) {
+			return &limit, nil
+		}
+	}
+	if expiresAt == nil {
+		return nil, nil
+	}
+	utc := expiresAt.UTC()
+	return &utc, nil
+}
@@ -0,0 +1,82 @@
+package shortener
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseExpiresAt(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "utc", value: "2030-06-01T12:00:00Z", want: time.Date(2030, 6, 1, 12, 0, 0, 0, time.UTC)},
+		{name: "offset", value: "2030-06-01T14:00:00+02:00", want: time.Date(2030, 6, 1, 12, 0, 0, 0, time.UTC)},
+		{name: "negative offset", value: "2030-06-01T07:30:00-04:30", want: time.Date(2030, 6, 1, 12, 0, 0, 0, time.UTC)},
+		{name: "datetime-local without offset", value: "2030-06-01T12:00", wantErr: true},
+		{name: "date only", value: "2030-06-01", wantErr: true},
+		{name: "garbage", value: "tomorrow", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseExpiresAt(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseExpiresAt(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if err == nil && (!got.Equal(tt.want) || got.Location() != time.UTC) {
+				t.Errorf("parseExpiresAt(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckExpiration(t *testing.T) {
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+	tokyo := now.Add(time.Hour).In(time.FixedZone("UTC+9", 9*60*60))
+
+	tests := []struct {
+		name      string
+		expiresAt *time.Time
+		max       time.Duration
+		want      *time.Time
+		wantErr   bool
+	}{
+		{name: "never", expiresAt: nil, want: nil},
+		{name: "future", expiresAt: at(time.Hour), want: at(time.Hour)},
+		{name: "offset", expiresAt: &tokyo, want: at(time.Hour)},
+		{name: "past", expiresAt: at(-time.Minute), wantErr: true},
+		{name: "now", expiresAt: at(0), wantErr: true},
+		{name: "far future", expiresAt: at(100 * 365 * 24 * time.Hour), want: at(100 * 365 * 24 * time.Hour)},
+		{name: "far future clamped", expiresAt: at(100 * 365 * 24 * time.Hour), max: 24 * time.Hour, want: at(24 * time.Hour)},
+		{name: "below max", expiresAt: at(time.Hour), max: 24 * time.Hour, want: at(time.Hour)},
+		{name: "never clamped", expiresAt: nil, max: 24 * time.Hour, want: at(24 * time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{maxExpiry: tt.max}
+			got, err := s.checkExpiration(tt.expiresAt, now)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidExpiration) {
+					t.Fatalf("checkExpiration() error = %v, want ErrInvalidExpiration", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("checkExpiration() error = %v", err)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && !got.Equal(*tt.want)) {
+				t.Errorf("checkExpiration() = %v, want %v", got, tt.want)
+			}
+			if got != nil && got.Location() != time.UTC {
+				t.Errorf("checkExpiration() = %v, want UTC", got)
+			}
+		})
+	}
+}
@@ -1,46 +1,102 @@
 package shortener
 
 import (
+	"context"
 	"net"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/oschwald/geoip2-golang"
 	"github.com/rs/zerolog/log"
 )
 
 type GeoIPService struct {
-	reader *geoip2.Reader
-	mu     sync.RWMutex
+	reader  *geoip2.Reader
+	mu      sync.RWMutex
+	dbPath  string
+	modTime time.Time
 }
 
-var (
-	geoIPInstance *GeoIPService
-	geoIPOnce     sync.Once
-)
+// NewGeoIPService loads the MaxMind database at dbPath.
+// A missing or broken database is not fatal, lookups then return unknown locations.
+func NewGeoIPService(dbPath string) *GeoIPService {
+	g := &GeoIPService{dbPath: dbPath}
+	if err := g.load(); err != nil {
+		log.Warn().
+			Err(err).
+			Str("path", dbPath).
+			Msg("Could not load GeoIP database")
+	}
+	return g
+}
+
+// load opens the database file and swaps it in for the current reader
+func (g *GeoIPService) load() error {
+	info, err := os.Stat(g.dbPath)
+	if err != nil {
+		return err
+	}
+
+	reader, err := geoip2.Open(g.dbPath)
+	if err != nil {
+		return err
+	}
 
-// GetGeoIPService returns a singleton instance of GeoIPService
-func GetGeoIPService() *GeoIPService {
-	geoIPOnce.Do(func() {
-		dbPath := "./GeoLite2-City.mmdb"
+	g.mu.Lock()
+	old := g.reader
+	g.reader = reader
+	g.modTime = info.ModTime()
+	g.mu.Unlock()
 
-		reader, err := geoip2.Open(dbPath)
-		if err != nil {
-			log.Warn().
+	// Lookups hold the read lock, so nobody uses the old reader anymore
+	if old != nil {
+		if err := old.Close(); err != nil {
+			log.Error().
 				Err(err).
-				Str("path", dbPath).
-				Msg("Could not load GeoIP database")
-			geoIPInstance = &GeoIPService{}
-			return
+				Msg("Failed to close previous GeoIP database")
 		}
+	}
 
-		log.Info().
-			Str("path", dbPath).
-			Msg("Successfully loaded GeoIP database")
-		geoIPInstance = &GeoIPService{
-			reader: reader,
+	log.Info().
+		Str("path", g.dbPath).
+		Time("modified", info.ModTime()).
+		Msg("Successfully loaded GeoIP database")
+	return nil
+}
+
+// StartReloader periodically re-opens the database when the file changed on disk,
+// e.g. after geoipupdate fetched a new release
+func (g *GeoIPService) StartReloader(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				info, err := os.Stat(g.dbPath)
+				if err != nil {
+					continue
+				}
+
+				g.mu.RLock()
+				changed := !info.ModTime().Equal(g.modTime)
+				g.mu.RUnlock()
+
+				if changed {
+					if err := g.load(); err != nil {
+						log.Error().
+							Err(err).
+							Str("path", g.dbPath).
+							Msg("Failed to reload GeoIP database")
+					}
+				}
+			}
 		}
-	})
-	return geoIPInstance
+	}()
 }
 
 // LocationInfo contains geographic information about an IP address
@@ -52,13 +108,13 @@ type LocationInfo struct {
 
 // GetLocation returns location information for an IP address
 func (g *GeoIPService) GetLocation(ipAddr string) *LocationInfo {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
 	if g.reader == nil {
 		return &LocationInfo{CountryCode: "XX"} // Unknown
 	}
 
-	g.mu.RLock()
-	defer g.mu.RUnlock()
-
 	ip := net.ParseIP(ipAddr)
 	if ip == nil {
 		log.Warn().
@@ -101,6 +157,9 @@ func (g *GeoIPService) GetLocation(ipAddr string) *LocationInfo {
 
 // Close releases the GeoIP database resources
 func (g *GeoIPService) Close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
 	if g.reader != nil {
 		if err := g.reader.Close(); err != nil {
 			log.Error().
@@ -2,15 +2,24 @@ package shortener
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
+	"volaticus-go/cmd/web"
 	"volaticus-go/cmd/web/components"
 	"volaticus-go/cmd/web/pages"
+	"volaticus-go/internal/audit"
+	"volaticus-go/internal/common/apierror"
+	"volaticus-go/internal/common/cursor"
 	"volaticus-go/internal/common/models"
 	"volaticus-go/internal/context"
 	"volaticus-go/internal/validation"
 
+	"github.com/a-h/templ"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
@@ -18,14 +27,26 @@ import (
 
 type Handler struct {
 	service *Service
+	audit   *audit.Logger
 }
 
-func NewHandler(service *Service) *Handler {
+func NewHandler(service *Service, auditLog *audit.Logger) *Handler {
 	return &Handler{
 		service: service,
+		audit:   auditLog,
 	}
 }
 
+// recordURLDelete adds the deletion of a URL to the audit log, target is its ID or short code
+func (h *Handler) recordURLDelete(r *http.Request, target string, err error) {
+	event := audit.Event{Action: audit.ActionURLDelete, TargetType: "url", TargetID: target}
+	if err != nil {
+		event.Result = audit.ResultFailure
+		event.Details = err.Error()
+	}
+	h.audit.Record(r, event)
+}
+
 // HandleCreateShortURL handles the creation of shortened URLs via API
 func (h *Handler) HandleCreateShortURL(w http.ResponseWriter, r *http.Request) {
 	var req models.CreateURLRequest
@@ -55,9 +76,45 @@ func (h *Handler) HandleCreateShortURL(w http.ResponseWriter, r *http.Request) {
 
 	response, err := h.service.CreateShortURL(r.Context(), user.ID, &req)
 	if err != nil {
-		if strings.Contains(err.Error(), "vanity code") {
+		switch {
+		case errors.Is(err, ErrShortCodeExists):
 			HandleError(w, ErrVanityCodeTaken, http.StatusConflict)
 			return
+		case errors.Is(err, ErrURLLimitReached):
+			HandleError(w, &APIError{
+				Code:    ErrCodeLimitExceeded,
+				Message: ErrURLLimitExceeded.Message,
+				Details: err.Error(),
+			}, http.StatusForbidden)
+			return
+		case errors.Is(err, ErrInvalidVanity):
+			HandleError(w, &APIError{
+				Code:    ErrCodeInvalidInput,
+				Message: ErrInvalidVanityCode.Message,
+				Details: err.Error(),
+			}, http.StatusBadRequest)
+			return
+		case errors.Is(err, ErrURLBlocked):
+			HandleError(w, &APIError{
+				Code:    ErrCodeInvalidInput,
+				Message: ErrInvalidURL.Message,
+				Details: err.Error(),
+			}, http.StatusBadRequest)
+			return
+		case errors.Is(err, ErrInvalidExpiration):
+			HandleError(w, &APIError{
+				Code:    ErrCodeInvalidInput,
+				Message: "Invalid expiration date",
+				Details: err.Error(),
+			}, http.StatusBadRequest)
+			return
+		case errors.Is(err, ErrDomainNotFound), errors.Is(err, ErrDomainNotVerified):
+			HandleError(w, &APIError{
+				Code:    ErrCodeInvalidInput,
+				Message: ErrInvalidCustomDomain.Message,
+				Details: err.Error(),
+			}, http.StatusBadRequest)
+			return
 		}
 		log.Error().
 			Err(err).
@@ -68,8 +125,166 @@ func (h *Handler) HandleCreateShortURL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("Location", response.AnalyticsURL)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Failed to encode JSON response")
+	}
+}
+
+// listParams parses the page, limit and sort query parameters, falling back to the defaults.
+// A limit above the configured maximum is capped.
+func (h *Handler) listParams(r *http.Request) (page, limit int, sort string) {
+	page, limit = 1, h.service.pageSize
+
+	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = min(l, h.service.maxPageSize)
+		}
+	}
+
+	sort = r.URL.Query().Get("sort")
+	if _, ok := urlSortOrders[sort]; !ok {
+		sort = defaultURLSort
+	}
+
+	return page, limit, sort
+}
+
+// APIURL is a shortened URL in the API URL list
+type APIURL struct {
+	*models.ShortenedURL
+	ShortURL string `json:"short_url"`
+}
+
+// APIURLListResponse is a page of the URLs of the API token owner
+type APIURLListResponse struct {
+	URLs       []APIURL `json:"urls"`
+	Page       int      `json:"page,omitempty"`
+	Limit      int      `json:"limit"`
+	Total      int      `json:"total"`
+	TotalPages int      `json:"total_pages,omitempty"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// HandleAPIListURLs handles GET /api/v1/urls, listing the URLs of the API token owner
+func (h *Handler) HandleAPIListURLs(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		HandleError(w, ErrUnauthorized, http.StatusUnauthorized)
+		return
+	}
+
+	after, cursorPaging, err := cursor.FromRequest(r)
+	if err != nil {
+		HandleError(w, &APIError{
+			Code:    ErrCodeInvalidInput,
+			Message: "Invalid cursor",
+		}, http.StatusBadRequest)
+		return
+	}
+
+	page, limit, sort := h.listParams(r)
+	var response APIURLListResponse
+	var urls []*models.ShortenedURL
+	if cursorPaging {
+		urls, err = h.service.GetUserURLsAfter(r.Context(), user.ID, after, limit+1, sort)
+		if err == nil {
+			response.Total, err = h.service.GetUserURLsCount(r.Context(), user.ID)
+		}
+	} else {
+		urls, response.Total, err = h.service.GetUserURLsPage(r.Context(), user.ID, limit, (page-1)*limit, sort)
+	}
+	if errors.Is(err, ErrCursorSort) {
+		HandleError(w, &APIError{
+			Code:    ErrCodeInvalidInput,
+			Message: "Invalid sort",
+			Details: err.Error(),
+		}, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("user_id", user.ID.String()).
+			Msg("Failed to retrieve user URLs")
+		HandleError(w, LogError(err, "retrieving user URLs"), http.StatusInternalServerError)
+		return
+	}
+
+	response.Limit = limit
+	if cursorPaging {
+		// The extra URL fetched beyond the limit shows there is a next page
+		if len(urls) > limit {
+			urls = urls[:limit]
+			last := urls[limit-1]
+			response.NextCursor = cursor.New(last.CreatedAt, last.ID).String()
+		}
+	} else {
+		response.Page = page
+		response.TotalPages = (response.Total + limit - 1) / limit
+	}
+	response.URLs = make([]APIURL, 0, len(urls))
+	for _, url := range urls {
+		response.URLs = append(response.URLs, APIURL{
+			ShortenedURL: url,
+			ShortURL:     h.service.ShortURL(url.Domain, url.ShortCode),
+		})
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Failed to encode URL list")
+	}
+}
+
+// HandleAPIDeleteURL handles DELETE /api/v1/urls/{urlID}. URLs of other users are
+// reported as not found so their IDs cannot be probed.
+func (h *Handler) HandleAPIDeleteURL(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		HandleError(w, ErrUnauthorized, http.StatusUnauthorized)
+		return
+	}
+
+	urlID, err := uuid.Parse(chi.URLParam(r, "urlID"))
+	if err != nil {
+		HandleError(w, &APIError{
+			Code:    ErrCodeInvalidInput,
+			Message: "Invalid URL ID",
+		}, http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.DeleteURL(r.Context(), urlID, user.ID)
+	h.recordURLDelete(r, urlID.String(), err)
+	if err != nil {
+		if errors.Is(err, ErrForbidden) {
+			HandleError(w, ErrURLNotFound, http.StatusNotFound)
+			return
+		}
+		log.Error().
+			Err(err).
+			Str("url_id", urlID.String()).
+			Str("user_id", user.ID.String()).
+			Msg("Failed to delete URL")
+		HandleError(w, LogError(err, "deleting URL"), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]bool{"success": true}); err != nil {
 		log.Error().
 			Err(err).
 			Msg("Failed to encode JSON response")
@@ -91,12 +306,22 @@ func (h *Handler) HandleRedirect(w http.ResponseWriter, r *http.Request) {
 	reqInfo := &models.RequestInfo{
 		Referrer:  r.Referer(),
 		UserAgent: r.UserAgent(),
-		IPAddress: getIPAddress(r),
+		IPAddress: h.service.clientIP.FromRequest(r),
 	}
 
-	originalURL, err := h.service.GetOriginalURL(r.Context(), shortCode, reqInfo)
+	// Requests to a custom domain are routed here by CustomDomainMiddleware
+	domainID := uuid.Nil
+	if domain := domainFromContext(r.Context()); domain != nil {
+		domainID = domain.ID
+	}
+
+	shortenedURL, err := h.service.Visit(r.Context(), domainID, shortCode, reqInfo)
 	if err != nil {
-		if strings.Contains(err.Error(), "expired") {
+		if errors.Is(err, ErrExpired) {
+			if apierror.WantsHTML(r) {
+				renderErrorPage(w, r, http.StatusGone, pages.LinkExpired())
+				return
+			}
 			HandleError(w, ErrURLExpired, http.StatusGone)
 			return
 		}
@@ -105,11 +330,53 @@ func (h *Handler) HandleRedirect(w http.ResponseWriter, r *http.Request) {
 			Str("short_code", shortCode).
 			Str("ip", reqInfo.IPAddress).
 			Msg("Failed to retrieve original URL")
+		if apierror.WantsHTML(r) {
+			renderErrorPage(w, r, http.StatusNotFound, pages.LinkNotFound())
+			return
+		}
 		HandleError(w, ErrURLNotFound, http.StatusNotFound)
 		return
 	}
 
-	http.Redirect(w, r, originalURL, http.StatusTemporaryRedirect)
+	if shortenedURL.Type == models.URLTypePage {
+		h.renderLinkPage(w, r, shortenedURL)
+		return
+	}
+
+	http.Redirect(w, r, shortenedURL.OriginalURL, http.StatusTemporaryRedirect)
+}
+
+// renderLinkPage shows the landing page of a link page
+func (h *Handler) renderLinkPage(w http.ResponseWriter, r *http.Request, page *models.ShortenedURL) {
+	links, err := h.service.GetPageLinks(r.Context(), page.ID)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("url_id", page.ID.String()).
+			Msg("Failed to retrieve page links")
+		HandleError(w, LogError(err, "retrieving page links"), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := pages.LinkPage(page, links).Render(r.Context(), w); err != nil {
+		log.Error().
+			Err(err).
+			Str("url_id", page.ID.String()).
+			Msg("Failed to render link page")
+	}
+}
+
+// renderErrorPage shows an error page to a visitor opening a link in the browser
+func renderErrorPage(w http.ResponseWriter, r *http.Request, status int, page templ.Component) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := page.Render(r.Context(), w); err != nil {
+		log.Error().
+			Err(err).
+			Int("status", status).
+			Msg("Failed to render error page")
+	}
 }
 
 func (h *Handler) HandleGetUserURLs(w http.ResponseWriter, r *http.Request) {
@@ -119,7 +386,10 @@ func (h *Handler) HandleGetUserURLs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	urls, err := h.service.GetUserURLs(r.Context(), user.ID)
+	page, limit, sort := h.listParams(r)
+	offset := (page - 1) * limit
+
+	urls, total, err := h.service.GetUserURLsPage(r.Context(), user.ID, limit, offset, sort)
 	if err != nil {
 		log.Error().
 			Err(err).
@@ -129,8 +399,23 @@ func (h *Handler) HandleGetUserURLs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	shortURLs := make(map[uuid.UUID]string, len(urls))
+	for _, url := range urls {
+		shortURLs[url.ID] = h.service.ShortURL(url.Domain, url.ShortCode)
+	}
+
+	props := pages.URLListProps{
+		URLs:       urls,
+		ShortURLs:  shortURLs,
+		Page:       page,
+		Limit:      limit,
+		Total:      total,
+		TotalPages: (total + limit - 1) / limit, // Ceiling division
+		Sort:       sort,
+	}
+
 	// Render the template using the pages package
-	if err := pages.URLList(urls).Render(r.Context(), w); err != nil {
+	if err := pages.URLList(props).Render(r.Context(), w); err != nil {
 		log.Error().
 			Err(err).
 			Str("user_id", user.ID.String()).
@@ -158,7 +443,7 @@ func (h *Handler) HandleGetURLAnalytics(w http.ResponseWriter, r *http.Request)
 
 	analytics, err := h.service.GetURLAnalytics(r.Context(), urlID, user.ID)
 	if err != nil {
-		if strings.Contains(err.Error(), "unauthorized") {
+		if errors.Is(err, ErrForbidden) {
 			HandleError(w, ErrUnauthorized, http.StatusForbidden)
 			return
 		}
@@ -212,8 +497,10 @@ func (h *Handler) HandleDeleteURL(w http.ResponseWriter, r *http.Request) {
 	// Check if the URL ID is a valid UUID
 	if _, err := uuid.Parse(urlID); err != nil {
 		// Handle non-UUID short codes
-		if err := h.service.DeleteURLByShortCode(r.Context(), urlID, user.ID); err != nil {
-			if strings.Contains(err.Error(), "unauthorized") {
+		err := h.service.DeleteURLByShortCode(r.Context(), urlID, user.ID)
+		h.recordURLDelete(r, urlID, err)
+		if err != nil {
+			if errors.Is(err, ErrForbidden) {
 				HandleError(w, ErrUnauthorized, http.StatusForbidden)
 				return
 			}
@@ -228,8 +515,10 @@ func (h *Handler) HandleDeleteURL(w http.ResponseWriter, r *http.Request) {
 	} else {
 		// Handle UUIDs
 		parsedID := uuid.MustParse(urlID)
-		if err := h.service.DeleteURL(r.Context(), parsedID, user.ID); err != nil {
-			if strings.Contains(err.Error(), "unauthorized") {
+		err := h.service.DeleteURL(r.Context(), parsedID, user.ID)
+		h.recordURLDelete(r, parsedID.String(), err)
+		if err != nil {
+			if errors.Is(err, ErrForbidden) {
 				HandleError(w, ErrUnauthorized, http.StatusForbidden)
 				return
 			}
@@ -247,6 +536,62 @@ func (h *Handler) HandleDeleteURL(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// HandleBulkDeleteURLs soft deletes several URLs of the user
+func (h *Handler) HandleBulkDeleteURLs(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		HandleError(w, ErrUnauthorized, http.StatusUnauthorized)
+		return
+	}
+
+	var req models.BulkDeleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.IDs) == 0 {
+		HandleError(w, &APIError{
+			Code:    ErrCodeInvalidInput,
+			Message: "A list of URL IDs is required",
+		}, http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) > models.MaxBulkDeleteIDs {
+		HandleError(w, &APIError{
+			Code:    ErrCodeInvalidInput,
+			Message: fmt.Sprintf("At most %d URLs can be deleted at once", models.MaxBulkDeleteIDs),
+		}, http.StatusBadRequest)
+		return
+	}
+
+	results, err := h.service.DeleteURLs(r.Context(), req.IDs, user.ID)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("user_id", user.ID.String()).
+			Msg("Failed to bulk delete URLs")
+		HandleError(w, LogError(err, "deleting URLs"), http.StatusInternalServerError)
+		return
+	}
+
+	response := models.BulkDeleteResponse{Results: results}
+	for _, result := range results {
+		var resultErr error
+		if result.Success {
+			response.Deleted++
+		} else {
+			resultErr = errors.New(result.Error)
+		}
+		h.recordURLDelete(r, result.ID.String(), resultErr)
+	}
+
+	if response.Deleted > 0 {
+		w.Header().Set("HX-Trigger", "urlsChanged")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Failed to encode bulk delete response")
+	}
+}
+
 // HandleUpdateExpiration handles updating the URL expiration
 func (h *Handler) HandleUpdateExpiration(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
@@ -274,12 +619,12 @@ func (h *Handler) HandleUpdateExpiration(w http.ResponseWriter, r *http.Request)
 
 	var expiresAt *time.Time
 	if expStr := r.FormValue("expires_at"); expStr != "" {
-		// Parse the local time string
-		expTime, err := time.ParseInLocation("2006-01-02T15:04", expStr, time.Local)
+		expTime, err := parseExpiresAt(expStr)
 		if err != nil {
 			HandleError(w, &APIError{
 				Code:    ErrCodeInvalidInput,
 				Message: "Invalid expiration date format",
+				Details: err.Error(),
 			}, http.StatusBadRequest)
 			return
 		}
@@ -287,15 +632,22 @@ func (h *Handler) HandleUpdateExpiration(w http.ResponseWriter, r *http.Request)
 	}
 
 	if err := h.service.UpdateURLExpiration(r.Context(), urlID, user.ID, expiresAt); err != nil {
-		if strings.Contains(err.Error(), "unauthorized") {
+		switch {
+		case errors.Is(err, ErrForbidden):
 			HandleError(w, ErrUnauthorized, http.StatusForbidden)
 			return
+		case errors.Is(err, ErrInvalidExpiration):
+			HandleError(w, &APIError{
+				Code:    ErrCodeInvalidInput,
+				Message: "Invalid expiration date",
+				Details: err.Error(),
+			}, http.StatusBadRequest)
+			return
 		}
 		log.Error().
 			Err(err).
 			Str("url_id", urlID.String()).
 			Str("user_id", user.ID.String()).
-			Time("expires_at", *expiresAt).
 			Msg("Failed to update URL expiration")
 		HandleError(w, LogError(err, "updating expiration"), http.StatusInternalServerError)
 		return
@@ -305,12 +657,14 @@ func (h *Handler) HandleUpdateExpiration(w http.ResponseWriter, r *http.Request)
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// HandleShortenForm handles the URL shortening form submission with HTML response
-func (h *Handler) HandleShortenForm(w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseForm(); err != nil {
+// HandleUpdateURL handles PATCH /url-shortener/urls/{urlID}, pausing or resuming a URL with
+// is_active from a JSON body or form value. A paused URL keeps its code but stops redirecting.
+func (h *Handler) HandleUpdateURL(w http.ResponseWriter, r *http.Request) {
+	urlID, err := uuid.Parse(chi.URLParam(r, "urlID"))
+	if err != nil {
 		HandleError(w, &APIError{
 			Code:    ErrCodeInvalidInput,
-			Message: "Error parsing form",
+			Message: "Invalid URL ID",
 		}, http.StatusBadRequest)
 		return
 	}
@@ -321,92 +675,656 @@ func (h *Handler) HandleShortenForm(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	req := models.CreateURLRequest{
-		URL:        r.FormValue("url"),
-		VanityCode: r.FormValue("vanity_code"),
+	var req struct {
+		IsActive *bool `json:"is_active"`
 	}
-
-	if expStr := r.FormValue("expires_at"); expStr != "" {
-		expTime, err := time.ParseInLocation("2006-01-02T15:04", expStr, time.Local)
-		if err != nil {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			HandleError(w, &APIError{
 				Code:    ErrCodeInvalidInput,
-				Message: "Invalid expiration date format",
-				Details: err.Error(),
+				Message: "Invalid request body",
 			}, http.StatusBadRequest)
 			return
 		}
-		req.ExpiresAt = &expTime
+	} else if active, err := strconv.ParseBool(r.FormValue("is_active")); err == nil {
+		req.IsActive = &active
+	}
+	if req.IsActive == nil {
+		HandleError(w, &APIError{
+			Code:    ErrCodeInvalidInput,
+			Message: "is_active must be true or false",
+		}, http.StatusBadRequest)
+		return
 	}
 
-	response, err := h.service.CreateShortURL(r.Context(), user.ID, &req)
+	url, err := h.service.SetURLActive(r.Context(), urlID, user.ID, *req.IsActive)
 	if err != nil {
+		if errors.Is(err, ErrForbidden) {
+			HandleError(w, ErrUnauthorized, http.StatusForbidden)
+			return
+		}
 		log.Error().
 			Err(err).
+			Str("url_id", urlID.String()).
 			Str("user_id", user.ID.String()).
-			Str("url", req.URL).
-			Str("vanity_code", req.VanityCode).
-			Msg("Failed to create short URL via form")
-
-		// If HTMX request, return the shortened URL template
-		if r.Header.Get("HX-Request") == "true" {
-			w.Header().Set("Content-Type", "text/html")
-			errorMessage := "Error creating shortened URL"
-
-			if strings.Contains(err.Error(), "between 4 and 30") {
-				errorMessage = "Custom URL must be between 4 and 30 characters"
-			} else if strings.Contains(err.Error(), "already in use") {
-				errorMessage = "This custom URL is already taken"
-			}
-
-			if err := pages.ErrorResult(errorMessage).Render(r.Context(), w); err != nil {
-				log.Error().
-					Err(err).
-					Str("error_message", errorMessage).
-					Msg("Failed to render error result")
-			}
-			return
-		}
-
-		HandleError(w, LogError(err, "creating short URL"), http.StatusInternalServerError)
-		return
-	}
-
-	// If HTMX request, return the shortened URL template
-	if r.Header.Get("HX-Request") == "true" {
-		w.Header().Set("Content-Type", "text/html")
-		w.Header().Set("HX-Trigger", "urlsChanged")
-		if err := pages.ShortenedURLResult(response).Render(r.Context(), w); err != nil {
-			log.Error().
-				Err(err).
-				Msg("Failed to render shortened URL result")
-		}
+			Bool("is_active", *req.IsActive).
+			Msg("Failed to update URL state")
+		HandleError(w, LogError(err, "updating URL state"), http.StatusInternalServerError)
 		return
 	}
 
-	// If not HTMX, return JSON response
-	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("HX-Trigger", "urlsChanged")
-	if err := json.NewEncoder(w).Encode(response); err != nil {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":        url.ID,
+		"is_active": url.IsActive,
+	}); err != nil {
 		log.Error().
 			Err(err).
 			Msg("Failed to encode JSON response")
 	}
 }
 
-// Helper functions
-
-// getIPAddress gets the client's IP address
-func getIPAddress(r *http.Request) string {
-	// Check X-Forwarded-For header first
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		ips := strings.Split(xff, ",")
-		return strings.TrimSpace(ips[0])
-	}
-
-	host := strings.Split(r.RemoteAddr, ":")[0]
-	if host == "[" || host == "[]" || host == "[::1]" || host == "" {
-		return "127.0.0.1" // Return localhost IP for development
-	}
-	return host
+// HandleRegenerateShortCode handles POST /url-shortener/urls/{urlID}/regenerate and its API twin,
+// giving the URL a new random code. grace_hours from a JSON body or form value keeps the old code redirecting for
+// that long, without it the old code stops working right away.
+func (h *Handler) HandleRegenerateShortCode(w http.ResponseWriter, r *http.Request) {
+	urlID, err := uuid.Parse(chi.URLParam(r, "urlID"))
+	if err != nil {
+		HandleError(w, &APIError{
+			Code:    ErrCodeInvalidInput,
+			Message: "Invalid URL ID",
+		}, http.StatusBadRequest)
+		return
+	}
+
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		HandleError(w, ErrUnauthorized, http.StatusUnauthorized)
+		return
+	}
+
+	var req models.RegenerateCodeRequest
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		// The body is optional, an empty one keeps no grace period
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			HandleError(w, &APIError{
+				Code:    ErrCodeInvalidInput,
+				Message: "Invalid request body",
+			}, http.StatusBadRequest)
+			return
+		}
+	} else if hours := r.FormValue("grace_hours"); hours != "" {
+		req.GraceHours, err = strconv.Atoi(hours)
+		if err != nil {
+			HandleError(w, &APIError{
+				Code:    ErrCodeInvalidInput,
+				Message: "grace_hours must be a number",
+			}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	resp, err := h.service.RegenerateShortCode(r.Context(), urlID, user.ID, time.Duration(req.GraceHours)*time.Hour)
+	event := audit.Event{
+		Action:     audit.ActionURLRegenerate,
+		TargetType: "url",
+		TargetID:   urlID.String(),
+		Details:    fmt.Sprintf("grace_hours=%d", req.GraceHours),
+	}
+	if err != nil {
+		event.Result = audit.ResultFailure
+		event.Details = err.Error()
+	}
+	h.audit.Record(r, event)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrForbidden):
+			HandleError(w, ErrUnauthorized, http.StatusForbidden)
+			return
+		case errors.Is(err, ErrInvalidGracePeriod):
+			HandleError(w, &APIError{
+				Code:    ErrCodeInvalidInput,
+				Message: "Invalid grace period",
+				Details: err.Error(),
+			}, http.StatusBadRequest)
+			return
+		}
+		log.Error().
+			Err(err).
+			Str("url_id", urlID.String()).
+			Str("user_id", user.ID.String()).
+			Msg("Failed to regenerate short code")
+		HandleError(w, LogError(err, "regenerating short code"), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("HX-Trigger", "urlsChanged")
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Failed to encode JSON response")
+	}
+}
+
+// HandleShortenForm handles the URL shortening form submission with HTML response
+func (h *Handler) HandleShortenForm(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		HandleError(w, &APIError{
+			Code:    ErrCodeInvalidInput,
+			Message: "Error parsing form",
+		}, http.StatusBadRequest)
+		return
+	}
+
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		HandleError(w, ErrUnauthorized, http.StatusUnauthorized)
+		return
+	}
+
+	// Unchecked checkboxes are not submitted
+	trackAnalytics := r.FormValue("track_analytics") != ""
+	req := models.CreateURLRequest{
+		URL:            r.FormValue("url"),
+		VanityCode:     r.FormValue("vanity_code"),
+		TrackAnalytics: &trackAnalytics,
+		Domain:         r.FormValue("domain"),
+	}
+
+	if expStr := r.FormValue("expires_at"); expStr != "" {
+		expTime, err := parseExpiresAt(expStr)
+		if err != nil {
+			HandleError(w, &APIError{
+				Code:    ErrCodeInvalidInput,
+				Message: "Invalid expiration date format",
+				Details: err.Error(),
+			}, http.StatusBadRequest)
+			return
+		}
+		req.ExpiresAt = &expTime
+	}
+
+	response, err := h.service.CreateShortURL(r.Context(), user.ID, &req)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("user_id", user.ID.String()).
+			Str("url", req.URL).
+			Str("vanity_code", req.VanityCode).
+			Msg("Failed to create short URL via form")
+
+		// If HTMX request, return the shortened URL template
+		if r.Header.Get("HX-Request") == "true" {
+			w.Header().Set("Content-Type", "text/html")
+			errorMessage := "Error creating shortened URL"
+
+			switch {
+			case errors.Is(err, ErrInvalidVanity):
+				// e.g. "Custom URL must be between 4 and 30 characters"
+				errorMessage = "Custom URL " + strings.TrimPrefix(err.Error(), ErrInvalidVanity.Error()+": ")
+			case errors.Is(err, ErrShortCodeExists):
+				errorMessage = "This custom URL is already taken"
+			case errors.Is(err, ErrURLLimitReached):
+				errorMessage = fmt.Sprintf("You can keep at most %d short URLs, delete some to create new ones", h.service.maxURLs)
+			case errors.Is(err, ErrURLBlocked):
+				// e.g. "Links to example.com are not allowed"
+				reason := strings.TrimPrefix(err.Error(), ErrURLBlocked.Error()+": ")
+				errorMessage = strings.ToUpper(reason[:1]) + reason[1:]
+			case errors.Is(err, ErrDomainNotFound), errors.Is(err, ErrDomainNotVerified):
+				errorMessage = "Choose one of your verified domains"
+			case errors.Is(err, ErrInvalidExpiration):
+				errorMessage = "The expiration date must be in the future"
+			}
+
+			if err := pages.ErrorResult(errorMessage).Render(r.Context(), w); err != nil {
+				log.Error().
+					Err(err).
+					Str("error_message", errorMessage).
+					Msg("Failed to render error result")
+			}
+			return
+		}
+
+		HandleError(w, LogError(err, "creating short URL"), http.StatusInternalServerError)
+		return
+	}
+
+	// If HTMX request, return the shortened URL template
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("HX-Trigger", "urlsChanged")
+		if err := pages.ShortenedURLResult(response).Render(r.Context(), w); err != nil {
+			log.Error().
+				Err(err).
+				Msg("Failed to render shortened URL result")
+		}
+		return
+	}
+
+	// If not HTMX, return JSON response
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("HX-Trigger", "urlsChanged")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Failed to encode JSON response")
+	}
+}
+
+// HandleCreatePage handles the creation of link pages
+func (h *Handler) HandleCreatePage(w http.ResponseWriter, r *http.Request) {
+	var req models.CreatePageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		HandleError(w, &APIError{
+			Code:    ErrCodeInvalidInput,
+			Message: "Invalid request body",
+		}, http.StatusBadRequest)
+		return
+	}
+
+	if err := validation.Validate(&req); err != nil {
+		errors := validation.FormatError(err)
+		HandleError(w, &APIError{
+			Code:    ErrCodeInvalidInput,
+			Message: "Validation failed",
+			Details: errors[0].Error,
+		}, http.StatusBadRequest)
+		return
+	}
+
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		HandleError(w, ErrUnauthorized, http.StatusUnauthorized)
+		return
+	}
+
+	response, err := h.service.CreatePage(r.Context(), user.ID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrShortCodeExists):
+			HandleError(w, ErrVanityCodeTaken, http.StatusConflict)
+			return
+		case errors.Is(err, ErrURLLimitReached):
+			HandleError(w, &APIError{
+				Code:    ErrCodeLimitExceeded,
+				Message: ErrURLLimitExceeded.Message,
+				Details: err.Error(),
+			}, http.StatusForbidden)
+			return
+		case errors.Is(err, ErrInvalidVanity):
+			HandleError(w, &APIError{
+				Code:    ErrCodeInvalidInput,
+				Message: ErrInvalidVanityCode.Message,
+				Details: err.Error(),
+			}, http.StatusBadRequest)
+			return
+		case errors.Is(err, ErrURLBlocked):
+			HandleError(w, &APIError{
+				Code:    ErrCodeInvalidInput,
+				Message: ErrInvalidURL.Message,
+				Details: err.Error(),
+			}, http.StatusBadRequest)
+			return
+		case errors.Is(err, ErrInvalidExpiration):
+			HandleError(w, &APIError{
+				Code:    ErrCodeInvalidInput,
+				Message: "Invalid expiration date",
+				Details: err.Error(),
+			}, http.StatusBadRequest)
+			return
+		}
+		log.Error().
+			Err(err).
+			Str("user_id", user.ID.String()).
+			Str("vanity_code", req.VanityCode).
+			Msg("Failed to create link page")
+		HandleError(w, LogError(err, "creating link page"), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("HX-Trigger", "urlsChanged")
+	w.Header().Set("Location", h.service.baseURL+"/api/v1/pages/"+response.ID.String())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Failed to encode JSON response")
+	}
+}
+
+// HandleGetPage returns a link page of the user with its links
+func (h *Handler) HandleGetPage(w http.ResponseWriter, r *http.Request) {
+	urlID, err := uuid.Parse(chi.URLParam(r, "urlID"))
+	if err != nil {
+		HandleError(w, &APIError{
+			Code:    ErrCodeInvalidInput,
+			Message: "Invalid URL ID",
+		}, http.StatusBadRequest)
+		return
+	}
+
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		HandleError(w, ErrUnauthorized, http.StatusUnauthorized)
+		return
+	}
+
+	page, err := h.service.GetPage(r.Context(), urlID, user.ID)
+	if err != nil {
+		h.handlePageError(w, err, urlID, "retrieving link page")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Failed to encode JSON response")
+	}
+}
+
+// HandleUpdatePage replaces the title, description and links of a link page
+func (h *Handler) HandleUpdatePage(w http.ResponseWriter, r *http.Request) {
+	urlID, err := uuid.Parse(chi.URLParam(r, "urlID"))
+	if err != nil {
+		HandleError(w, &APIError{
+			Code:    ErrCodeInvalidInput,
+			Message: "Invalid URL ID",
+		}, http.StatusBadRequest)
+		return
+	}
+
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		HandleError(w, ErrUnauthorized, http.StatusUnauthorized)
+		return
+	}
+
+	var req models.UpdatePageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		HandleError(w, &APIError{
+			Code:    ErrCodeInvalidInput,
+			Message: "Invalid request body",
+		}, http.StatusBadRequest)
+		return
+	}
+
+	if err := validation.Validate(&req); err != nil {
+		errors := validation.FormatError(err)
+		HandleError(w, &APIError{
+			Code:    ErrCodeInvalidInput,
+			Message: "Validation failed",
+			Details: errors[0].Error,
+		}, http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.service.UpdatePage(r.Context(), urlID, user.ID, &req)
+	if err != nil {
+		h.handlePageError(w, err, urlID, "updating link page")
+		return
+	}
+
+	w.Header().Set("HX-Trigger", "urlsChanged")
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Failed to encode JSON response")
+	}
+}
+
+// handlePageError writes the response of a failed link page operation
+func (h *Handler) handlePageError(w http.ResponseWriter, err error, urlID uuid.UUID, action string) {
+	switch {
+	case errors.Is(err, ErrForbidden):
+		HandleError(w, ErrUnauthorized, http.StatusForbidden)
+	case errors.Is(err, ErrNotPage):
+		HandleError(w, &APIError{
+			Code:    ErrCodeInvalidInput,
+			Message: "URL is not a link page",
+		}, http.StatusBadRequest)
+	case errors.Is(err, ErrURLBlocked):
+		HandleError(w, &APIError{
+			Code:    ErrCodeInvalidInput,
+			Message: ErrInvalidURL.Message,
+			Details: err.Error(),
+		}, http.StatusBadRequest)
+	default:
+		log.Error().
+			Err(err).
+			Str("url_id", urlID.String()).
+			Msg("Failed " + action)
+		HandleError(w, LogError(err, action), http.StatusInternalServerError)
+	}
+}
+
+// APIDomain is a custom domain with the records that verify it
+type APIDomain struct {
+	*models.CustomDomain
+	Verified     bool   `json:"verified"`
+	TXTRecord    string `json:"txt_record"`     // Name of the TXT record holding TXTValue
+	TXTValue     string `json:"txt_value"`      // Value of the TXT record
+	WellKnownURL string `json:"well_known_url"` // Alternatively the verification token served at this URL
+}
+
+// APIDomainListResponse lists the custom domains of the user
+type APIDomainListResponse struct {
+	Domains []APIDomain `json:"domains"`
+}
+
+func newAPIDomain(domain *models.CustomDomain) APIDomain {
+	return APIDomain{
+		CustomDomain: domain,
+		Verified:     domain.VerifiedAt != nil,
+		TXTRecord:    domainTXTPrefix + domain.Domain,
+		TXTValue:     domainTXTValue + domain.VerificationToken,
+		WellKnownURL: "http://" + domain.Domain + domainWellKnown,
+	}
+}
+
+// HandleListDomains handles GET /api/v1/domains, listing the custom domains of the user
+func (h *Handler) HandleListDomains(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		HandleError(w, ErrUnauthorized, http.StatusUnauthorized)
+		return
+	}
+
+	domains, err := h.service.ListDomains(r.Context(), user.ID)
+	if err != nil {
+		h.handleDomainError(w, err, uuid.Nil, "retrieving domains")
+		return
+	}
+
+	response := APIDomainListResponse{Domains: make([]APIDomain, 0, len(domains))}
+	for _, domain := range domains {
+		response.Domains = append(response.Domains, newAPIDomain(domain))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Failed to encode domain list")
+	}
+}
+
+// HandleAddDomain handles POST /api/v1/domains, adding an unverified custom domain
+func (h *Handler) HandleAddDomain(w http.ResponseWriter, r *http.Request) {
+	var req models.AddDomainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		HandleError(w, &APIError{
+			Code:    ErrCodeInvalidInput,
+			Message: "Invalid request body",
+		}, http.StatusBadRequest)
+		return
+	}
+
+	if err := validation.Validate(&req); err != nil {
+		errors := validation.FormatError(err)
+		HandleError(w, &APIError{
+			Code:    ErrCodeInvalidInput,
+			Message: "Validation failed",
+			Details: errors[0].Error,
+		}, http.StatusBadRequest)
+		return
+	}
+
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		HandleError(w, ErrUnauthorized, http.StatusUnauthorized)
+		return
+	}
+
+	domain, err := h.service.AddDomain(r.Context(), user.ID, req.Domain)
+	if err != nil {
+		h.handleDomainError(w, err, uuid.Nil, "adding domain")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(newAPIDomain(domain)); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Failed to encode JSON response")
+	}
+}
+
+// HandleVerifyDomain handles POST /api/v1/domains/{domainID}/verify, checking the TXT record
+// or well-known file of the domain
+func (h *Handler) HandleVerifyDomain(w http.ResponseWriter, r *http.Request) {
+	domainID, err := uuid.Parse(chi.URLParam(r, "domainID"))
+	if err != nil {
+		HandleError(w, &APIError{
+			Code:    ErrCodeInvalidInput,
+			Message: "Invalid domain ID",
+		}, http.StatusBadRequest)
+		return
+	}
+
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		HandleError(w, ErrUnauthorized, http.StatusUnauthorized)
+		return
+	}
+
+	domain, err := h.service.VerifyDomain(r.Context(), user.ID, domainID)
+	if err != nil {
+		h.handleDomainError(w, err, domainID, "verifying domain")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(newAPIDomain(domain)); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Failed to encode JSON response")
+	}
+}
+
+// HandleDeleteDomain handles DELETE /api/v1/domains/{domainID}
+func (h *Handler) HandleDeleteDomain(w http.ResponseWriter, r *http.Request) {
+	domainID, err := uuid.Parse(chi.URLParam(r, "domainID"))
+	if err != nil {
+		HandleError(w, &APIError{
+			Code:    ErrCodeInvalidInput,
+			Message: "Invalid domain ID",
+		}, http.StatusBadRequest)
+		return
+	}
+
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		HandleError(w, ErrUnauthorized, http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.service.DeleteDomain(r.Context(), user.ID, domainID); err != nil {
+		h.audit.Record(r, audit.Event{
+			Action:     audit.ActionDomainDelete,
+			TargetType: "domain",
+			TargetID:   domainID.String(),
+			Result:     audit.ResultFailure,
+			Details:    err.Error(),
+		})
+		h.handleDomainError(w, err, domainID, "deleting domain")
+		return
+	}
+	h.audit.Record(r, audit.Event{Action: audit.ActionDomainDelete, TargetType: "domain", TargetID: domainID.String()})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]bool{"success": true}); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Failed to encode JSON response")
+	}
+}
+
+// handleDomainError writes the response of a failed custom domain operation
+func (h *Handler) handleDomainError(w http.ResponseWriter, err error, domainID uuid.UUID, action string) {
+	switch {
+	case errors.Is(err, ErrDomainNotFound):
+		HandleError(w, ErrCustomDomainNotFound, http.StatusNotFound)
+	case errors.Is(err, ErrInvalidDomain):
+		HandleError(w, &APIError{
+			Code:    ErrCodeInvalidInput,
+			Message: ErrInvalidCustomDomain.Message,
+			Details: err.Error(),
+		}, http.StatusBadRequest)
+	case errors.Is(err, ErrDomainTaken):
+		HandleError(w, ErrCustomDomainTaken, http.StatusConflict)
+	case errors.Is(err, ErrDomainInUse):
+		HandleError(w, &APIError{
+			Code:    ErrCodeRejected,
+			Message: "Domain still has short links",
+			Details: err.Error(),
+		}, http.StatusConflict)
+	case errors.Is(err, ErrVerificationFailed):
+		HandleError(w, &APIError{
+			Code:    ErrCodeRejected,
+			Message: "Domain verification failed",
+			Details: err.Error(),
+		}, http.StatusUnprocessableEntity)
+	default:
+		log.Error().
+			Err(err).
+			Str("domain_id", domainID.String()).
+			Msg("Failed " + action)
+		HandleError(w, LogError(err, action), http.StatusInternalServerError)
+	}
+}
+
+// CustomDomainMiddleware serves the short links of verified custom domains from the root of the
+// domain, like go.brand.com/abc. Such requests are routed to the redirect of the app with the
+// domain in the context, requests to the base URL and unknown hosts pass through unchanged.
+func (h *Handler) CustomDomainMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		domain := h.service.ResolveDomain(r.Context(), r.Host)
+		if domain == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Link pages load their styles and icon from the app
+		if strings.HasPrefix(r.URL.Path, web.Path("/assets/")) || r.URL.Path == web.Path("/favicon.ico") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		code := strings.TrimPrefix(r.URL.Path, "/")
+		if code == "" || strings.Contains(code, "/") {
+			renderErrorPage(w, r, http.StatusNotFound, pages.LinkNotFound())
+			return
+		}
+
+		r = r.Clone(withDomain(r.Context(), domain))
+		r.URL.Path = web.Path("/s/" + code)
+		r.URL.RawPath = ""
+		next.ServeHTTP(w, r)
+	})
 }
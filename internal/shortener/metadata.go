@@ -0,0 +1,151 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	metadataFetchTimeout = 5 * time.Second
+	metadataMaxBodySize  = 512 * 1024 // Only the head of the document is needed
+	metadataMaxLength    = 500
+)
+
+// Metadata holds link preview information of a destination page
+type Metadata struct {
+	Title       string
+	Description string
+	FaviconURL  string
+}
+
+// FetchMetadata retrieves the title, description and favicon of a page with the client.
+// Open Graph tags are preferred over the plain <title> and description meta tag.
+func FetchMetadata(ctx context.Context, client *http.Client, rawURL string) (*Metadata, error) {
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing URL: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("User-Agent", "Volaticus-LinkPreview/1.0")
+	req.Header.Set("Accept", "text/html")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching page: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.Contains(ct, "text/html") {
+		return nil, fmt.Errorf("unsupported content type: %s", ct)
+	}
+
+	// Redirects may have moved us to another page, relative links resolve against it
+	if resp.Request != nil && resp.Request.URL != nil {
+		base = resp.Request.URL
+	}
+
+	return parseMetadata(io.LimitReader(resp.Body, metadataMaxBodySize), base), nil
+}
+
+// parseMetadata extracts preview information from an HTML document
+func parseMetadata(r io.Reader, base *url.URL) *Metadata {
+	var title, ogTitle, description, ogDescription, favicon string
+	inTitle := false
+
+	z := html.NewTokenizer(r)
+loop:
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			break loop
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tag := z.Token()
+			switch tag.Data {
+			case "title":
+				inTitle = true
+			case "meta":
+				name := strings.ToLower(attr(tag, "name"))
+				property := strings.ToLower(attr(tag, "property"))
+				content := attr(tag, "content")
+				switch {
+				case property == "og:title":
+					ogTitle = content
+				case property == "og:description":
+					ogDescription = content
+				case name == "description":
+					description = content
+				}
+			case "link":
+				rel := strings.ToLower(attr(tag, "rel"))
+				if favicon == "" && (rel == "icon" || rel == "shortcut icon") {
+					favicon = attr(tag, "href")
+				}
+			case "body":
+				// Everything we need lives in <head>
+				break loop
+			}
+		case html.TextToken:
+			if inTitle && title == "" {
+				title = string(z.Text())
+			}
+		case html.EndTagToken:
+			if z.Token().Data == "title" {
+				inTitle = false
+			}
+		}
+	}
+
+	metadata := &Metadata{
+		Title:       truncate(strings.TrimSpace(firstNonEmpty(ogTitle, title))),
+		Description: truncate(strings.TrimSpace(firstNonEmpty(ogDescription, description))),
+	}
+
+	if favicon == "" {
+		favicon = "/favicon.ico"
+	}
+	if ref, err := url.Parse(favicon); err == nil && base != nil {
+		metadata.FaviconURL = base.ResolveReference(ref).String()
+	}
+
+	return metadata
+}
+
+func attr(t html.Token, key string) string {
+	for _, a := range t.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func truncate(s string) string {
+	runes := []rune(s)
+	if len(runes) > metadataMaxLength {
+		return string(runes[:metadataMaxLength])
+	}
+	return s
+}
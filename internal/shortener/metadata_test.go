@@ -0,0 +1,43 @@
+package shortener
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMetadata(t *testing.T) {
+	base, _ := url.Parse("https://example.com/articles/1")
+
+	t.Run("prefers open graph tags", func(t *testing.T) {
+		doc := `<html><head>
+			<title>Plain Title</title>
+			<meta name="description" content="Plain description">
+			<meta property="og:title" content="OG Title">
+			<meta property="og:description" content="OG description">
+			<link rel="icon" href="/static/icon.png">
+		</head><body><title>ignored</title></body></html>`
+
+		m := parseMetadata(strings.NewReader(doc), base)
+		assert.Equal(t, "OG Title", m.Title)
+		assert.Equal(t, "OG description", m.Description)
+		assert.Equal(t, "https://example.com/static/icon.png", m.FaviconURL)
+	})
+
+	t.Run("falls back to title and description", func(t *testing.T) {
+		doc := `<head><title> Plain Title </title><meta name="Description" content="Plain description"></head>`
+
+		m := parseMetadata(strings.NewReader(doc), base)
+		assert.Equal(t, "Plain Title", m.Title)
+		assert.Equal(t, "Plain description", m.Description)
+		assert.Equal(t, "https://example.com/favicon.ico", m.FaviconURL)
+	})
+
+	t.Run("empty document", func(t *testing.T) {
+		m := parseMetadata(strings.NewReader(""), base)
+		assert.Empty(t, m.Title)
+		assert.Empty(t, m.Description)
+	})
+}
@@ -0,0 +1,78 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+)
+
+// internalPrefixes are ranges the netip predicates don't cover: the shared address space of
+// carrier-grade NAT (RFC 6598), used inside cloud networks, and "this network", which Linux
+// connects to the local host
+var internalPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("0.0.0.0/8"),
+}
+
+// isPrivateAddr reports whether the address is loopback, private (RFC 1918 and RFC 4193),
+// shared, link-local or unspecified, addresses that only make sense inside our own network
+func isPrivateAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsUnspecified() {
+		return true
+	}
+	for _, prefix := range internalPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPublicHost resolves the host and returns ErrPrivateURL if any of its addresses is private
+func (s *Service) checkPublicHost(ctx context.Context, host string) error {
+	addrs := []netip.Addr{}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addrs = append(addrs, addr)
+	} else {
+		addrs, err = net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return fmt.Errorf("%w: the host %s can't be resolved", ErrURLBlocked, host)
+		}
+	}
+
+	for _, addr := range addrs {
+		if isPrivateAddr(addr) {
+			return fmt.Errorf("%w (%s)", ErrPrivateURL, addr.Unmap())
+		}
+	}
+	return nil
+}
+
+// publicOnlyClient refuses connections to private addresses. The check runs on every dial, so
+// redirects and hosts resolving differently than when the URL was created are covered too.
+var publicOnlyClient = &http.Client{
+	Timeout: metadataFetchTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Control: func(_, address string, _ syscall.RawConn) error {
+				addrPort, err := netip.ParseAddrPort(address)
+				if err != nil {
+					return err
+				}
+				if isPrivateAddr(addrPort.Addr()) {
+					return fmt.Errorf("%w (%s)", ErrPrivateURL, addrPort.Addr().Unmap())
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+}
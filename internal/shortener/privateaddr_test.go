@@ -0,0 +1,95 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"volaticus-go/internal/config"
+
+	"github.com/google/uuid"
+)
+
+func TestIsPrivateAddr(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1":       true,
+		"10.1.2.3":        true,
+		"172.16.0.1":      true,
+		"192.168.1.1":     true,
+		"169.254.169.254": true, // Cloud metadata endpoint
+		"0.0.0.0":         true,
+		"0.1.2.3":         true,
+		"100.64.0.1":      true, // Carrier-grade NAT
+		"100.127.255.254": true,
+		"100.128.0.1":     false,
+		"::1":             true,
+		"fd00::1":         true,
+		"fe80::1":         true,
+		"::ffff:10.0.0.1": true,
+		"8.8.8.8":         false,
+		"2606:4700::1111": false,
+		"172.32.0.1":      false,
+		"::ffff:93.1.1.1": false,
+	}
+	for addr, want := range tests {
+		if got := isPrivateAddr(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("isPrivateAddr(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestCheckDestinationPrivate(t *testing.T) {
+	s := &Service{repo: &domainRepository{}, blockPrivate: true}
+	for _, rawURL := range []string{"http://127.0.0.1:8080/admin", "http://[::1]/", "http://169.254.169.254/latest/meta-data", "http://localhost/"} {
+		if err := s.checkDestination(context.Background(), rawURL); !errors.Is(err, ErrPrivateURL) {
+			t.Errorf("checkDestination(%q) = %v, want ErrPrivateURL", rawURL, err)
+		}
+	}
+	if err := s.checkDestination(context.Background(), "http://93.184.215.14/"); err != nil {
+		t.Errorf("checkDestination() rejected a public address: %v", err)
+	}
+
+	s.blockPrivate = false
+	if err := s.checkDestination(context.Background(), "http://127.0.0.1:8080/admin"); err != nil {
+		t.Errorf("checkDestination() = %v with private addresses allowed", err)
+	}
+}
+
+func TestPublicOnlyClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	_, err := FetchMetadata(context.Background(), publicOnlyClient, server.URL)
+	if !errors.Is(err, ErrPrivateURL) {
+		t.Errorf("FetchMetadata() = %v, want the connection to the loopback server refused", err)
+	}
+}
+
+// metadataRepository records the link previews stored for URLs
+type metadataRepository struct {
+	Repository
+	stored bool
+}
+
+func (r *metadataRepository) UpdateMetadata(context.Context, uuid.UUID, string, string, string) error {
+	r.stored = true
+	return nil
+}
+
+func TestStoreMetadataRefusesPrivate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<title>Admin</title>"))
+	}))
+	defer server.Close()
+
+	// Previews never reach private addresses, also when links to them can be created
+	repo := &metadataRepository{}
+	s := NewService(repo, &config.Config{FetchMetadata: true, BlockPrivateIPs: false})
+	s.storeMetadata(uuid.New(), server.URL)
+	if repo.stored {
+		t.Error("storeMetadata() stored the preview of a loopback server")
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/jmoiron/sqlx"
 	"time"
+	"volaticus-go/internal/common/cursor"
 	"volaticus-go/internal/common/models"
 	"volaticus-go/internal/database"
 
@@ -15,22 +17,57 @@ import (
 // Repository defines methods for URL persistence
 type Repository interface {
 	Create(ctx context.Context, url *models.ShortenedURL) error
-	GetByShortCode(ctx context.Context, code string) (*models.ShortenedURL, error)
+	GetByShortCode(ctx context.Context, domainID uuid.UUID, code string) (*models.ShortenedURL, error)
+	ShortCodeExists(ctx context.Context, domainID uuid.UUID, code string) (bool, error)
 	GetByUserID(ctx context.Context, userID uuid.UUID) ([]*models.ShortenedURL, error)
+	GetByUserIDPaginated(ctx context.Context, userID uuid.UUID, limit, offset int, sort string) ([]*models.ShortenedURL, error)
+	GetByUserIDAfter(ctx context.Context, userID uuid.UUID, after *cursor.Cursor, limit int, ascending bool) ([]*models.ShortenedURL, error)
+	CountByUserID(ctx context.Context, userID uuid.UUID) (int, error)
 	IncrementAccessCount(ctx context.Context, id uuid.UUID) error
 	Delete(ctx context.Context, id uuid.UUID) error
+	DeleteUserURLs(ctx context.Context, userID uuid.UUID, ids []uuid.UUID) ([]uuid.UUID, error)
 	Update(ctx context.Context, url *models.ShortenedURL) error
+	UpdateMetadata(ctx context.Context, id uuid.UUID, title, description, faviconURL string) error
+	UpdateShortCode(ctx context.Context, id uuid.UUID, code string, redirectUntil *time.Time) error
+	GetByAlias(ctx context.Context, domainID uuid.UUID, code string) (*models.ShortenedURL, error)
+
+	// Link page methods
+	CreatePage(ctx context.Context, page *models.ShortenedURL, links []*models.PageLink) error
+	GetPageLinks(ctx context.Context, pageID uuid.UUID) ([]*models.PageLink, error)
+	UpdatePage(ctx context.Context, page *models.ShortenedURL, links []*models.PageLink) error
+
+	// Custom domain methods
+	CreateDomain(ctx context.Context, domain *models.CustomDomain) error
+	GetDomainsByUserID(ctx context.Context, userID uuid.UUID) ([]*models.CustomDomain, error)
+	GetVerifiedDomain(ctx context.Context, name string) (*models.CustomDomain, error)
+	MarkDomainVerified(ctx context.Context, id uuid.UUID) error
+	CountDomainURLs(ctx context.Context, domainID uuid.UUID) (int, error)
+	DeleteDomain(ctx context.Context, id uuid.UUID) error
 
 	// Analytics methods
 	RecordClick(ctx context.Context, analytics *models.ClickAnalytics) error
-	GetURLAnalytics(ctx context.Context, urlID uuid.UUID) (*models.URLAnalytics, error)
+	RecordClicks(ctx context.Context, clicks []*models.ClickAnalytics, accessCounts map[uuid.UUID]int) error
+	GetURLAnalytics(ctx context.Context, urlID uuid.UUID, uniqueWindow time.Duration) (*models.URLAnalytics, error)
 	GetURLsByExpiration(ctx context.Context, before time.Time) ([]*models.ShortenedURL, error)
+	DeleteClicksBefore(ctx context.Context, before time.Time) (int64, error)
+	RollupClicksBefore(ctx context.Context, before time.Time, uniqueWindow time.Duration) (int64, error)
 }
 
 type repository struct {
 	*database.Repository
 }
 
+// urlSortOrders maps the supported sort parameters of URL lists to their ORDER BY clause
+var urlSortOrders = map[string]string{
+	"newest":  "created_at DESC",
+	"oldest":  "created_at ASC",
+	"clicks":  "access_count DESC, created_at DESC",
+	"expires": "expires_at ASC NULLS LAST, created_at DESC",
+}
+
+// defaultURLSort is used for unknown or empty sort parameters
+const defaultURLSort = "newest"
+
 // NewRepository creates a new shortener repository
 func NewRepository(db *database.DB) Repository {
 	return &repository{
@@ -40,56 +77,245 @@ func NewRepository(db *database.DB) Repository {
 
 // Create stores a new shortened URL
 func (r *repository) Create(ctx context.Context, url *models.ShortenedURL) error {
+	err := r.WithTx(ctx, func(tx *sqlx.Tx) error {
+		return insertURL(ctx, tx, url)
+	})
+	// Another request may have taken the code after it was checked
+	if database.IsUniqueViolation(err) {
+		return ErrShortCodeExists
+	}
+	return err
+}
+
+// insertURL inserts a shortened URL, URLs without a type are redirects
+func insertURL(ctx context.Context, tx *sqlx.Tx, url *models.ShortenedURL) error {
+	if url.Type == "" {
+		url.Type = models.URLTypeRedirect
+	}
+
 	query := `
         INSERT INTO shortened_urls (
             id, user_id, original_url, short_code, created_at,
-            expires_at, is_vanity, is_active
-        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+            expires_at, is_vanity, is_active, track_analytics,
+            title, description, url_type, domain_id
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
         RETURNING id`
 
+	return tx.QueryRowContext(ctx, query,
+		url.ID,
+		url.UserID,
+		url.OriginalURL,
+		url.ShortCode,
+		url.CreatedAt,
+		url.ExpiresAt,
+		url.IsVanity,
+		url.IsActive,
+		url.TrackAnalytics,
+		url.Title,
+		url.Description,
+		url.Type,
+		url.DomainID,
+	).Scan(&url.ID)
+}
+
+// insertPageLinks stores the links of a page, numbering their positions in slice order
+func insertPageLinks(ctx context.Context, tx *sqlx.Tx, pageID uuid.UUID, links []*models.PageLink) error {
+	for i, link := range links {
+		link.PageID = pageID
+		link.Position = i
+		if link.ID == uuid.Nil {
+			link.ID = uuid.New()
+		}
+
+		_, err := tx.NamedExecContext(ctx, `
+            INSERT INTO page_links (id, page_id, position, title, url)
+            VALUES (:id, :page_id, :position, :title, :url)`,
+			link,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreatePage stores a new link page together with its links
+func (r *repository) CreatePage(ctx context.Context, page *models.ShortenedURL, links []*models.PageLink) error {
+	page.Type = models.URLTypePage
+	err := r.WithTx(ctx, func(tx *sqlx.Tx) error {
+		if err := insertURL(ctx, tx, page); err != nil {
+			return err
+		}
+		return insertPageLinks(ctx, tx, page.ID, links)
+	})
+	if database.IsUniqueViolation(err) {
+		return ErrShortCodeExists
+	}
+	return err
+}
+
+// GetPageLinks retrieves the links of a page in display order
+func (r *repository) GetPageLinks(ctx context.Context, pageID uuid.UUID) ([]*models.PageLink, error) {
+	links := []*models.PageLink{}
+	err := r.Select(ctx, &links, `
+        SELECT * FROM page_links
+        WHERE page_id = $1
+        ORDER BY position`,
+		pageID,
+	)
+	return links, err
+}
+
+// UpdatePage stores the title and description of a page and replaces all of its links
+func (r *repository) UpdatePage(ctx context.Context, page *models.ShortenedURL, links []*models.PageLink) error {
 	return r.WithTx(ctx, func(tx *sqlx.Tx) error {
-		return tx.QueryRowContext(ctx, query,
-			url.ID,
-			url.UserID,
-			url.OriginalURL,
-			url.ShortCode,
-			url.CreatedAt,
-			url.ExpiresAt,
-			url.IsVanity,
-			url.IsActive,
-		).Scan(&url.ID)
+		_, err := tx.ExecContext(ctx, `
+            UPDATE shortened_urls
+            SET title = $1,
+                description = $2
+            WHERE id = $3 AND url_type = $4`,
+			page.Title,
+			page.Description,
+			page.ID,
+			models.URLTypePage,
+		)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM page_links WHERE page_id = $1", page.ID); err != nil {
+			return err
+		}
+		return insertPageLinks(ctx, tx, page.ID, links)
 	})
 }
 
-// GetByShortCode retrieves a URL by its short code
-func (r *repository) GetByShortCode(ctx context.Context, code string) (*models.ShortenedURL, error) {
+// domainScope matches the URLs of the domain in $1, uuid.Nil matching the default domain.
+// It is the expression of the unique index on domains and short codes.
+const domainScope = `COALESCE(domain_id, '00000000-0000-0000-0000-000000000000') = $1`
+
+// GetByShortCode retrieves a URL by its short code on a custom domain, or on the
+// default domain if domainID is uuid.Nil
+func (r *repository) GetByShortCode(ctx context.Context, domainID uuid.UUID, code string) (*models.ShortenedURL, error) {
 	url := new(models.ShortenedURL)
 	err := r.Get(ctx, url, `
         SELECT * FROM shortened_urls
-        WHERE short_code = $1
+        WHERE `+domainScope+`
+        AND short_code = $2
         AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
-        AND is_active = true`,
-		code,
+        AND is_active = true
+        AND deleted_at IS NULL`,
+		domainID, code,
 	)
 	if errors.Is(err, sql.ErrNoRows) {
-		return nil, errors.New("URL not found or expired")
+		return nil, ErrNotFound
 	}
 	return url, err
 }
 
+// ShortCodeExists checks if a code is taken on the domain by any URL, including expired and deleted
+// ones and the old codes of regenerated URLs
+func (r *repository) ShortCodeExists(ctx context.Context, domainID uuid.UUID, code string) (bool, error) {
+	var exists bool
+	err := r.Get(ctx, &exists, `
+        SELECT EXISTS(SELECT 1 FROM shortened_urls WHERE `+domainScope+` AND short_code = $2)
+            OR EXISTS(SELECT 1 FROM short_code_aliases WHERE `+domainScope+` AND short_code = $2)`,
+		domainID, code,
+	)
+	return exists, err
+}
+
+// GetByAlias retrieves the URL an old code still redirects to during the grace period after the
+// code was regenerated
+func (r *repository) GetByAlias(ctx context.Context, domainID uuid.UUID, code string) (*models.ShortenedURL, error) {
+	url := new(models.ShortenedURL)
+	err := r.Get(ctx, url, `
+        SELECT * FROM shortened_urls
+        WHERE id = (
+            SELECT url_id FROM short_code_aliases
+            WHERE `+domainScope+`
+            AND short_code = $2
+            AND redirect_until > CURRENT_TIMESTAMP
+        )
+        AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+        AND is_active = true
+        AND deleted_at IS NULL`,
+		domainID, code,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return url, err
+}
+
+// urlWithDomain selects the columns of shortened_urls and the name of their custom domain
+const urlWithDomain = `*, COALESCE((SELECT domain FROM custom_domains WHERE id = shortened_urls.domain_id), '') AS domain`
+
 // GetByUserID retrieves all URLs created by a specific user
 func (r *repository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]*models.ShortenedURL, error) {
 	var urls []*models.ShortenedURL
 	err := r.Select(ctx, &urls, `
-        SELECT * FROM shortened_urls
+        SELECT `+urlWithDomain+` FROM shortened_urls
         WHERE user_id = $1
-        AND is_active = true
+        AND deleted_at IS NULL
         ORDER BY created_at DESC`,
 		userID,
 	)
 	return urls, err
 }
 
+// GetByUserIDPaginated retrieves a page of the URLs created by a specific user
+func (r *repository) GetByUserIDPaginated(ctx context.Context, userID uuid.UUID, limit, offset int, sort string) ([]*models.ShortenedURL, error) {
+	order, ok := urlSortOrders[sort]
+	if !ok {
+		order = urlSortOrders[defaultURLSort]
+	}
+
+	var urls []*models.ShortenedURL
+	err := r.Select(ctx, &urls, `
+        SELECT `+urlWithDomain+` FROM shortened_urls
+        WHERE user_id = $1
+        AND deleted_at IS NULL
+        ORDER BY `+order+`
+        LIMIT $2 OFFSET $3`,
+		userID, limit, offset,
+	)
+	return urls, err
+}
+
+// GetByUserIDAfter retrieves the URLs of a user following the cursor in creation order, newest
+// first unless ascending. Without a cursor the list starts at its beginning.
+func (r *repository) GetByUserIDAfter(ctx context.Context, userID uuid.UUID, after *cursor.Cursor, limit int, ascending bool) ([]*models.ShortenedURL, error) {
+	cmp, dir := "<", "DESC"
+	if ascending {
+		cmp, dir = ">", "ASC"
+	}
+
+	query := `SELECT ` + urlWithDomain + ` FROM shortened_urls WHERE user_id = $1 AND deleted_at IS NULL`
+	args := []any{userID}
+	if after != nil {
+		query += ` AND (created_at, id) ` + cmp + ` ($2, $3)`
+		args = append(args, after.CreatedAt, after.ID)
+	}
+	query += fmt.Sprintf(` ORDER BY created_at %[1]s, id %[1]s LIMIT $%[2]d`, dir, len(args)+1)
+
+	var urls []*models.ShortenedURL
+	err := r.Select(ctx, &urls, query, append(args, limit)...)
+	return urls, err
+}
+
+// CountByUserID returns the number of URLs created by a specific user that are not deleted
+func (r *repository) CountByUserID(ctx context.Context, userID uuid.UUID) (int, error) {
+	var count int
+	err := r.Get(ctx, &count, `
+        SELECT COUNT(*) FROM shortened_urls
+        WHERE user_id = $1
+        AND deleted_at IS NULL`,
+		userID,
+	)
+	return count, err
+}
+
 // IncrementAccessCount increases the access counter for a URL
 func (r *repository) IncrementAccessCount(ctx context.Context, id uuid.UUID) error {
 	_, err := r.Exec(ctx, `
@@ -106,7 +332,8 @@ func (r *repository) IncrementAccessCount(ctx context.Context, id uuid.UUID) err
 func (r *repository) Delete(ctx context.Context, id uuid.UUID) error {
 	result, err := r.Exec(ctx, `
         UPDATE shortened_urls
-        SET is_active = false
+        SET is_active = false,
+            deleted_at = COALESCE(deleted_at, CURRENT_TIMESTAMP)
         WHERE id = $1`,
 		id,
 	)
@@ -119,11 +346,43 @@ func (r *repository) Delete(ctx context.Context, id uuid.UUID) error {
 		return err
 	}
 	if rows == 0 {
-		return errors.New("URL not found")
+		return ErrNotFound
 	}
 	return nil
 }
 
+// DeleteUserURLs soft deletes the URLs of the user among ids in a single transaction
+// and returns the IDs that were deleted
+func (r *repository) DeleteUserURLs(ctx context.Context, userID uuid.UUID, ids []uuid.UUID) ([]uuid.UUID, error) {
+	var deleted []uuid.UUID
+	err := r.WithTx(ctx, func(tx *sqlx.Tx) error {
+		for _, id := range ids {
+			result, err := tx.ExecContext(ctx, `
+                UPDATE shortened_urls
+                SET is_active = false, deleted_at = CURRENT_TIMESTAMP
+                WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`,
+				id, userID,
+			)
+			if err != nil {
+				return err
+			}
+
+			rows, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if rows > 0 {
+				deleted = append(deleted, id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
 // Update updates a URL's properties
 func (r *repository) Update(ctx context.Context, url *models.ShortenedURL) error {
 	_, err := r.Exec(ctx, `
@@ -139,6 +398,63 @@ func (r *repository) Update(ctx context.Context, url *models.ShortenedURL) error
 	return err
 }
 
+// UpdateMetadata stores the link preview of a URL
+func (r *repository) UpdateMetadata(ctx context.Context, id uuid.UUID, title, description, faviconURL string) error {
+	_, err := r.Exec(ctx, `
+        UPDATE shortened_urls
+        SET title = $1,
+            description = $2,
+            favicon_url = $3
+        WHERE id = $4`,
+		title,
+		description,
+		faviconURL,
+		id,
+	)
+	return err
+}
+
+// UpdateShortCode replaces the code of a URL with a generated one. The old code stays reserved as an
+// alias, redirecting to the URL until redirectUntil or not at all if it is nil.
+func (r *repository) UpdateShortCode(ctx context.Context, id uuid.UUID, code string, redirectUntil *time.Time) error {
+	err := r.WithTx(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+            INSERT INTO short_code_aliases (url_id, domain_id, short_code, redirect_until)
+            SELECT id, domain_id, short_code, $2 FROM shortened_urls
+            WHERE id = $1`,
+			id, redirectUntil,
+		)
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, `
+            UPDATE shortened_urls
+            SET short_code = $1,
+                is_vanity = false
+            WHERE id = $2
+            AND deleted_at IS NULL`,
+			code, id,
+		)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+	// Another request may have taken the code after it was checked
+	if database.IsUniqueViolation(err) {
+		return ErrShortCodeExists
+	}
+	return err
+}
+
 // RecordClick stores analytics data for a click event
 func (r *repository) RecordClick(ctx context.Context, analytics *models.ClickAnalytics) error {
 	query := `
@@ -154,8 +470,47 @@ func (r *repository) RecordClick(ctx context.Context, analytics *models.ClickAna
 	})
 }
 
-// GetURLAnalytics retrieves analytics data for a specific URL
-func (r *repository) GetURLAnalytics(ctx context.Context, urlID uuid.UUID) (*models.URLAnalytics, error) {
+// clickInsertChunk is the number of clicks inserted per statement, keeping the
+// bind parameters well below the PostgreSQL limit of 65535
+const clickInsertChunk = 1000
+
+// RecordClicks stores a batch of click events and adds accessCounts to the access
+// counters of the URLs, all in one transaction
+func (r *repository) RecordClicks(ctx context.Context, clicks []*models.ClickAnalytics, accessCounts map[uuid.UUID]int) error {
+	query := `
+        INSERT INTO click_analytics (
+            id, url_id, clicked_at, referrer,
+            user_agent, ip_address, country_code,
+            city, region
+        ) VALUES (:id, :url_id, :clicked_at, :referrer, :user_agent, :ip_address, :country_code, :city, :region)`
+
+	return r.WithTx(ctx, func(tx *sqlx.Tx) error {
+		for start := 0; start < len(clicks); start += clickInsertChunk {
+			end := min(start+clickInsertChunk, len(clicks))
+			if _, err := tx.NamedExecContext(ctx, query, clicks[start:end]); err != nil {
+				return err
+			}
+		}
+
+		for id, count := range accessCounts {
+			_, err := tx.ExecContext(ctx, `
+                UPDATE shortened_urls
+                SET access_count = access_count + $2,
+                    last_accessed_at = CURRENT_TIMESTAMP
+                WHERE id = $1`,
+				id, count,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetURLAnalytics retrieves analytics data for a specific URL.
+// A click is unique if the same visitor did not click within uniqueWindow before it.
+func (r *repository) GetURLAnalytics(ctx context.Context, urlID uuid.UUID, uniqueWindow time.Duration) (*models.URLAnalytics, error) {
 	analytics := &models.URLAnalytics{}
 
 	// Get the URL details
@@ -166,31 +521,65 @@ func (r *repository) GetURLAnalytics(ctx context.Context, urlID uuid.UUID) (*mod
 	}
 	analytics.URL = url
 
-	// Get total clicks
-	err = r.Get(ctx, &analytics.TotalClicks, `
-        SELECT COUNT(*) FROM click_analytics WHERE url_id = $1`,
-		urlID,
-	)
-	if err != nil {
-		return nil, err
+	// Get total clicks, unique clicks and unique visitors. Unique clicks are visits: a visitor,
+	// identified by IP and user agent, clicking again within the window counts once. Rolled up
+	// days only keep these counts per day, referrer and country. Distinct visitors can't be
+	// merged across them, so their sum is only an upper bound.
+	var counts struct {
+		Total       int  `db:"total_clicks"`
+		Unique      int  `db:"unique_clicks"`
+		Visitors    int  `db:"unique_visitors"`
+		Approximate bool `db:"visitors_approximate"`
 	}
-
-	// Get unique clicks (by IP)
-	err = r.Get(ctx, &analytics.UniqueClicks, `
-        SELECT COUNT(DISTINCT ip_address)
-        FROM click_analytics
-        WHERE url_id = $1`,
-		urlID,
+	err = r.Get(ctx, &counts, `
+        SELECT
+            raw.total + rollup.total AS total_clicks,
+            raw.unique_clicks + rollup.unique_clicks AS unique_clicks,
+            raw.visitors + rollup.visitors AS unique_visitors,
+            rollup.days > 0 AS visitors_approximate
+        FROM (
+            SELECT
+                COUNT(*) AS total,
+                COUNT(*) FILTER (WHERE gap IS NULL OR gap >= make_interval(secs => $2)) AS unique_clicks,
+                COUNT(DISTINCT (ip_address, user_agent)) AS visitors
+            FROM (
+                SELECT ip_address, user_agent, clicked_at - LAG(clicked_at) OVER (
+                    PARTITION BY ip_address, user_agent ORDER BY clicked_at
+                ) AS gap
+                FROM click_analytics
+                WHERE url_id = $1
+            ) visits
+        ) raw, (
+            SELECT
+                COALESCE(SUM(clicks), 0) AS total,
+                COALESCE(SUM(unique_clicks), 0) AS unique_clicks,
+                COALESCE(SUM(visitors), 0) AS visitors,
+                COUNT(*) AS days
+            FROM click_daily_rollup
+            WHERE url_id = $1
+        ) rollup`,
+		urlID, uniqueWindow.Seconds(),
 	)
 	if err != nil {
 		return nil, err
 	}
+	analytics.TotalClicks, analytics.UniqueClicks, analytics.UniqueVisitors = counts.Total, counts.Unique, counts.Visitors
+	analytics.VisitorsApproximate = counts.Approximate
 
 	// Get top referrers
 	err = r.Select(ctx, &analytics.TopReferrers, `
-        SELECT referrer, COUNT(*) as count
-        FROM click_analytics
-        WHERE url_id = $1 AND referrer IS NOT NULL AND referrer != ''
+        SELECT referrer, SUM(count)::BIGINT AS count
+        FROM (
+            SELECT referrer, COUNT(*) AS count
+            FROM click_analytics
+            WHERE url_id = $1 AND referrer IS NOT NULL AND referrer != ''
+            GROUP BY referrer
+            UNION ALL
+            SELECT referrer, SUM(clicks) AS count
+            FROM click_daily_rollup
+            WHERE url_id = $1 AND referrer != ''
+            GROUP BY referrer
+        ) referrers
         GROUP BY referrer
         ORDER BY count DESC
         LIMIT 10`,
@@ -204,11 +593,20 @@ func (r *repository) GetURLAnalytics(ctx context.Context, urlID uuid.UUID) (*mod
 	err = r.Select(ctx, &analytics.TopCountries, `
     SELECT
         country_code,
-        COUNT(*) as count
-    FROM click_analytics
-    WHERE url_id = $1 AND country_code IS NOT NULL
+        SUM(count)::BIGINT AS count
+    FROM (
+        SELECT country_code, COUNT(*) AS count
+        FROM click_analytics
+        WHERE url_id = $1 AND country_code IS NOT NULL
+        GROUP BY country_code
+        UNION ALL
+        SELECT country_code, SUM(clicks) AS count
+        FROM click_daily_rollup
+        WHERE url_id = $1 AND country_code != ''
+        GROUP BY country_code
+    ) countries
     GROUP BY country_code
-    ORDER BY COUNT(*) DESC
+    ORDER BY count DESC
     LIMIT 10`,
 		urlID,
 	)
@@ -216,14 +614,21 @@ func (r *repository) GetURLAnalytics(ctx context.Context, urlID uuid.UUID) (*mod
 		return nil, err
 	}
 
-	// Get clicks by day
+	// Get clicks by day, days are UTC like the rolled up ones whatever the session time zone
 	err = r.Select(ctx, &analytics.ClicksByDay, `
-        SELECT
-            DATE_TRUNC('day', clicked_at) as date,
-            COUNT(*) as count
-        FROM click_analytics
-        WHERE url_id = $1
-        GROUP BY DATE_TRUNC('day', clicked_at)
+        SELECT date, SUM(count)::BIGINT AS count
+        FROM (
+            SELECT DATE_TRUNC('day', clicked_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS date, COUNT(*) AS count
+            FROM click_analytics
+            WHERE url_id = $1
+            GROUP BY 1
+            UNION ALL
+            SELECT day AS date, SUM(clicks) AS count
+            FROM click_daily_rollup
+            WHERE url_id = $1
+            GROUP BY day
+        ) days
+        GROUP BY date
         ORDER BY date DESC
         LIMIT 30`,
 		urlID,
@@ -242,8 +647,153 @@ func (r *repository) GetURLsByExpiration(ctx context.Context, before time.Time)
         SELECT * FROM shortened_urls
         WHERE expires_at IS NOT NULL
         AND expires_at < $1
-        AND is_active = true`,
+        AND deleted_at IS NULL`,
 		before,
 	)
 	return urls, err
 }
+
+// DeleteClicksBefore removes all click analytics recorded before a given time, raw clicks
+// and rolled up days alike, and returns the number of deleted rows
+func (r *repository) DeleteClicksBefore(ctx context.Context, before time.Time) (int64, error) {
+	var deleted int64
+	err := r.WithTx(ctx, func(tx *sqlx.Tx) error {
+		for _, query := range []string{
+			`DELETE FROM click_analytics WHERE clicked_at < $1`,
+			`DELETE FROM click_daily_rollup WHERE day < $1`,
+		} {
+			result, err := tx.ExecContext(ctx, query, before)
+			if err != nil {
+				return err
+			}
+			rows, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			deleted += rows
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// RollupClicksBefore aggregates the raw clicks recorded before a given time into daily counts
+// per referrer and country, deletes them and returns how many were rolled up. Days rolled up
+// in several runs are added to the existing counts.
+func (r *repository) RollupClicksBefore(ctx context.Context, before time.Time, uniqueWindow time.Duration) (int64, error) {
+	var rolledUp int64
+	err := r.WithTx(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+            INSERT INTO click_daily_rollup (url_id, day, referrer, country_code, clicks, unique_clicks, visitors)
+            SELECT
+                url_id,
+                DATE_TRUNC('day', clicked_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC',
+                COALESCE(referrer, ''),
+                COALESCE(country_code, ''),
+                COUNT(*),
+                COUNT(*) FILTER (WHERE gap IS NULL OR gap >= make_interval(secs => $2)),
+                COUNT(DISTINCT (ip_address, user_agent))
+            FROM (
+                SELECT *, clicked_at - LAG(clicked_at) OVER (
+                    PARTITION BY url_id, ip_address, user_agent ORDER BY clicked_at
+                ) AS gap
+                FROM click_analytics
+                WHERE clicked_at < $1
+            ) clicks
+            GROUP BY url_id, DATE_TRUNC('day', clicked_at AT TIME ZONE 'UTC'), COALESCE(referrer, ''), COALESCE(country_code, '')
+            ON CONFLICT (url_id, day, referrer, country_code) DO UPDATE
+            SET clicks = click_daily_rollup.clicks + EXCLUDED.clicks,
+                unique_clicks = click_daily_rollup.unique_clicks + EXCLUDED.unique_clicks,
+                visitors = click_daily_rollup.visitors + EXCLUDED.visitors`,
+			before, uniqueWindow.Seconds(),
+		)
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, `DELETE FROM click_analytics WHERE clicked_at < $1`, before)
+		if err != nil {
+			return err
+		}
+		rolledUp, err = result.RowsAffected()
+		return err
+	})
+	return rolledUp, err
+}
+
+// CreateDomain stores a new custom domain, a domain the user already added is reported as taken
+func (r *repository) CreateDomain(ctx context.Context, domain *models.CustomDomain) error {
+	_, err := r.Exec(ctx, `
+        INSERT INTO custom_domains (id, user_id, domain, verification_token, created_at)
+        VALUES ($1, $2, $3, $4, $5)`,
+		domain.ID,
+		domain.UserID,
+		domain.Domain,
+		domain.VerificationToken,
+		domain.CreatedAt,
+	)
+	if database.IsUniqueViolation(err) {
+		return ErrDomainTaken
+	}
+	return err
+}
+
+// GetDomainsByUserID retrieves the custom domains of a user, verified or not
+func (r *repository) GetDomainsByUserID(ctx context.Context, userID uuid.UUID) ([]*models.CustomDomain, error) {
+	domains := []*models.CustomDomain{}
+	err := r.Select(ctx, &domains, `
+        SELECT * FROM custom_domains
+        WHERE user_id = $1
+        ORDER BY domain`,
+		userID,
+	)
+	return domains, err
+}
+
+// GetVerifiedDomain retrieves the verified custom domain with the given name
+func (r *repository) GetVerifiedDomain(ctx context.Context, name string) (*models.CustomDomain, error) {
+	domain := new(models.CustomDomain)
+	err := r.Get(ctx, domain, `
+        SELECT * FROM custom_domains
+        WHERE domain = $1
+        AND verified_at IS NOT NULL`,
+		name,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDomainNotFound
+	}
+	return domain, err
+}
+
+// MarkDomainVerified records that the owner proved control over the domain. Only one user
+// can verify a domain, later verifications are reported as taken.
+func (r *repository) MarkDomainVerified(ctx context.Context, id uuid.UUID) error {
+	_, err := r.Exec(ctx, `
+        UPDATE custom_domains
+        SET verified_at = CURRENT_TIMESTAMP
+        WHERE id = $1 AND verified_at IS NULL`,
+		id,
+	)
+	if database.IsUniqueViolation(err) {
+		return ErrDomainTaken
+	}
+	return err
+}
+
+// CountDomainURLs returns the number of URLs on a custom domain that are not deleted
+func (r *repository) CountDomainURLs(ctx context.Context, domainID uuid.UUID) (int, error) {
+	var count int
+	err := r.Get(ctx, &count, `
+        SELECT COUNT(*) FROM shortened_urls
+        WHERE domain_id = $1
+        AND deleted_at IS NULL`,
+		domainID,
+	)
+	return count, err
+}
+
+// DeleteDomain removes a custom domain together with the deleted URLs still referencing it
+func (r *repository) DeleteDomain(ctx context.Context, id uuid.UUID) error {
+	_, err := r.Exec(ctx, `DELETE FROM custom_domains WHERE id = $1`, id)
+	return err
+}
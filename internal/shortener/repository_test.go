@@ -7,6 +7,7 @@ import (
 	"os"
 	"testing"
 	"time"
+	"volaticus-go/internal/common/cursor"
 	"volaticus-go/internal/common/models"
 	"volaticus-go/internal/database"
 	"volaticus-go/internal/database/migrate"
@@ -163,13 +164,31 @@ func TestRepository_Create(t *testing.T) {
 		assert.NoError(t, err)
 
 		// Verify URL was created
-		stored, err := repo.GetByShortCode(ctx, url.ShortCode)
+		stored, err := repo.GetByShortCode(ctx, uuid.Nil, url.ShortCode)
 		assert.NoError(t, err)
 		assert.Equal(t, url.OriginalURL, stored.OriginalURL)
 		assert.Equal(t, url.ShortCode, stored.ShortCode)
 		assert.Equal(t, url.UserID, stored.UserID)
 	})
 
+	t.Run("analytics opt-out is stored", func(t *testing.T) {
+		url := &models.ShortenedURL{
+			ID:             uuid.New(),
+			UserID:         userID,
+			OriginalURL:    "https://example.com/private",
+			ShortCode:      "notrack",
+			CreatedAt:      time.Now(),
+			IsActive:       true,
+			TrackAnalytics: false,
+		}
+
+		require.NoError(t, repo.Create(ctx, url))
+
+		stored, err := repo.GetByShortCode(ctx, uuid.Nil, url.ShortCode)
+		require.NoError(t, err)
+		assert.False(t, stored.TrackAnalytics)
+	})
+
 	t.Run("duplicate short code", func(t *testing.T) {
 		url1 := &models.ShortenedURL{
 			ID:          uuid.New(),
@@ -193,7 +212,7 @@ func TestRepository_Create(t *testing.T) {
 		assert.NoError(t, err)
 
 		err = repo.Create(ctx, url2)
-		assert.Error(t, err) // Should fail due to unique constraint
+		assert.ErrorIs(t, err, ErrShortCodeExists) // Should fail due to unique constraint
 	})
 }
 
@@ -219,13 +238,13 @@ func TestRepository_GetByShortCode(t *testing.T) {
 		err := repo.Create(ctx, url)
 		require.NoError(t, err)
 
-		found, err := repo.GetByShortCode(ctx, url.ShortCode)
+		found, err := repo.GetByShortCode(ctx, uuid.Nil, url.ShortCode)
 		assert.NoError(t, err)
 		assert.Equal(t, url.OriginalURL, found.OriginalURL)
 	})
 
 	t.Run("get non-existent url", func(t *testing.T) {
-		_, err := repo.GetByShortCode(ctx, "nonexistent")
+		_, err := repo.GetByShortCode(ctx, uuid.Nil, "nonexistent")
 		assert.Error(t, err)
 	})
 
@@ -243,11 +262,131 @@ func TestRepository_GetByShortCode(t *testing.T) {
 		err := repo.Create(ctx, url)
 		require.NoError(t, err)
 
-		_, err = repo.GetByShortCode(ctx, url.ShortCode)
+		_, err = repo.GetByShortCode(ctx, uuid.Nil, url.ShortCode)
 		assert.Error(t, err)
 	})
 }
 
+func TestRepository_ShortCodeExists(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	ctx := context.Background()
+	userID, err := createTestUser(ctx, db)
+	require.NoError(t, err)
+
+	url := &models.ShortenedURL{
+		ID:          uuid.New(),
+		UserID:      userID,
+		OriginalURL: "https://example.com/taken",
+		ShortCode:   "taken-" + uuid.New().String()[:8],
+		CreatedAt:   time.Now(),
+		IsActive:    true,
+	}
+	require.NoError(t, repo.Create(ctx, url))
+
+	t.Run("active code exists", func(t *testing.T) {
+		exists, err := repo.ShortCodeExists(ctx, uuid.Nil, url.ShortCode)
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+
+	t.Run("deleted code is still taken", func(t *testing.T) {
+		require.NoError(t, repo.Delete(ctx, url.ID))
+		exists, err := repo.ShortCodeExists(ctx, uuid.Nil, url.ShortCode)
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+
+	t.Run("unknown code", func(t *testing.T) {
+		exists, err := repo.ShortCodeExists(ctx, uuid.Nil, "free-"+uuid.New().String()[:8])
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+}
+
+func TestRepository_Domains(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	ctx := context.Background()
+	userID, err := createTestUser(ctx, db)
+	require.NoError(t, err)
+	otherUserID, err := createTestUser(ctx, db)
+	require.NoError(t, err)
+
+	name := "go-" + uuid.New().String()[:8] + ".example.com"
+	domain := &models.CustomDomain{
+		ID:                uuid.New(),
+		UserID:            userID,
+		Domain:            name,
+		VerificationToken: "token",
+		CreatedAt:         time.Now(),
+	}
+	require.NoError(t, repo.CreateDomain(ctx, domain))
+
+	t.Run("unverified domain is not served", func(t *testing.T) {
+		_, err := repo.GetVerifiedDomain(ctx, name)
+		assert.ErrorIs(t, err, ErrDomainNotFound)
+	})
+
+	t.Run("verify domain", func(t *testing.T) {
+		require.NoError(t, repo.MarkDomainVerified(ctx, domain.ID))
+		verified, err := repo.GetVerifiedDomain(ctx, name)
+		require.NoError(t, err)
+		assert.Equal(t, domain.ID, verified.ID)
+		assert.NotNil(t, verified.VerifiedAt)
+	})
+
+	t.Run("domain verified by another user", func(t *testing.T) {
+		other := &models.CustomDomain{
+			ID:                uuid.New(),
+			UserID:            otherUserID,
+			Domain:            name,
+			VerificationToken: "other",
+			CreatedAt:         time.Now(),
+		}
+		require.NoError(t, repo.CreateDomain(ctx, other))
+		assert.ErrorIs(t, repo.MarkDomainVerified(ctx, other.ID), ErrDomainTaken)
+	})
+
+	t.Run("same code on two domains", func(t *testing.T) {
+		code := "shared-" + uuid.New().String()[:8]
+		onDefault := &models.ShortenedURL{
+			ID:          uuid.New(),
+			UserID:      userID,
+			OriginalURL: "https://example.com/default",
+			ShortCode:   code,
+			CreatedAt:   time.Now(),
+			IsActive:    true,
+		}
+		onDomain := &models.ShortenedURL{
+			ID:          uuid.New(),
+			UserID:      userID,
+			OriginalURL: "https://example.com/custom",
+			ShortCode:   code,
+			DomainID:    &domain.ID,
+			CreatedAt:   time.Now(),
+			IsActive:    true,
+		}
+		require.NoError(t, repo.Create(ctx, onDefault))
+		require.NoError(t, repo.Create(ctx, onDomain))
+
+		found, err := repo.GetByShortCode(ctx, domain.ID, code)
+		require.NoError(t, err)
+		assert.Equal(t, onDomain.ID, found.ID)
+		found, err = repo.GetByShortCode(ctx, uuid.Nil, code)
+		require.NoError(t, err)
+		assert.Equal(t, onDefault.ID, found.ID)
+
+		count, err := repo.CountDomainURLs(ctx, domain.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+}
+
 func TestRepository_GetByUserID(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
@@ -291,6 +430,181 @@ func TestRepository_GetByUserID(t *testing.T) {
 	})
 }
 
+func TestRepository_GetByUserIDPaginated(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	ctx := context.Background()
+	userID, err := createTestUser(ctx, db)
+	require.NoError(t, err)
+
+	base := time.Now().Add(-time.Hour)
+	for i := 0; i < 5; i++ {
+		url := &models.ShortenedURL{
+			ID:          uuid.New(),
+			UserID:      userID,
+			OriginalURL: fmt.Sprintf("https://example.com/page/%d", i),
+			ShortCode:   fmt.Sprintf("page%d", i),
+			CreatedAt:   base.Add(time.Duration(i) * time.Minute),
+			IsActive:    true,
+		}
+		require.NoError(t, repo.Create(ctx, url))
+	}
+
+	t.Run("pages newest first", func(t *testing.T) {
+		urls, err := repo.GetByUserIDPaginated(ctx, userID, 2, 0, "newest")
+		require.NoError(t, err)
+		require.Len(t, urls, 2)
+		assert.Equal(t, "page4", urls[0].ShortCode)
+		assert.Equal(t, "page3", urls[1].ShortCode)
+
+		urls, err = repo.GetByUserIDPaginated(ctx, userID, 2, 4, "newest")
+		require.NoError(t, err)
+		require.Len(t, urls, 1)
+		assert.Equal(t, "page0", urls[0].ShortCode)
+	})
+
+	t.Run("oldest first", func(t *testing.T) {
+		urls, err := repo.GetByUserIDPaginated(ctx, userID, 1, 0, "oldest")
+		require.NoError(t, err)
+		require.Len(t, urls, 1)
+		assert.Equal(t, "page0", urls[0].ShortCode)
+	})
+
+	t.Run("unknown sort falls back to newest", func(t *testing.T) {
+		urls, err := repo.GetByUserIDPaginated(ctx, userID, 1, 0, "id; DROP TABLE shortened_urls")
+		require.NoError(t, err)
+		require.Len(t, urls, 1)
+		assert.Equal(t, "page4", urls[0].ShortCode)
+	})
+
+	t.Run("cursor", func(t *testing.T) {
+		first, err := repo.GetByUserIDAfter(ctx, userID, nil, 2, false)
+		require.NoError(t, err)
+		require.Len(t, first, 2)
+		assert.Equal(t, "page4", first[0].ShortCode)
+
+		next, err := repo.GetByUserIDAfter(ctx, userID, cursor.New(first[1].CreatedAt, first[1].ID), 2, false)
+		require.NoError(t, err)
+		require.Len(t, next, 2)
+		assert.Equal(t, "page2", next[0].ShortCode)
+		assert.Equal(t, "page1", next[1].ShortCode)
+
+		oldest, err := repo.GetByUserIDAfter(ctx, userID, cursor.New(next[0].CreatedAt, next[0].ID), 5, true)
+		require.NoError(t, err)
+		require.Len(t, oldest, 2)
+		assert.Equal(t, "page3", oldest[0].ShortCode)
+	})
+
+	t.Run("count", func(t *testing.T) {
+		count, err := repo.CountByUserID(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, 5, count)
+	})
+}
+
+func TestRepository_CountByUserID(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	ctx := context.Background()
+	userID, err := createTestUser(ctx, db)
+	require.NoError(t, err)
+	otherUserID, err := createTestUser(ctx, db)
+	require.NoError(t, err)
+
+	var ids []uuid.UUID
+	for i := 0; i < 3; i++ {
+		url := &models.ShortenedURL{
+			ID:          uuid.New(),
+			UserID:      userID,
+			OriginalURL: fmt.Sprintf("https://example.com/count/%d", i),
+			ShortCode:   fmt.Sprintf("count%d", i),
+			CreatedAt:   time.Now(),
+			IsActive:    true,
+		}
+		require.NoError(t, repo.Create(ctx, url))
+		ids = append(ids, url.ID)
+	}
+	require.NoError(t, repo.Create(ctx, &models.ShortenedURL{
+		ID:          uuid.New(),
+		UserID:      otherUserID,
+		OriginalURL: "https://example.com/other",
+		ShortCode:   "countother",
+		CreatedAt:   time.Now(),
+		IsActive:    true,
+	}))
+
+	t.Run("counts the user's URLs", func(t *testing.T) {
+		count, err := repo.CountByUserID(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, 3, count)
+	})
+
+	t.Run("ignores deleted URLs", func(t *testing.T) {
+		require.NoError(t, repo.Delete(ctx, ids[0]))
+
+		count, err := repo.CountByUserID(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("user with no URLs", func(t *testing.T) {
+		count, err := repo.CountByUserID(ctx, uuid.New())
+		require.NoError(t, err)
+		assert.Zero(t, count)
+	})
+}
+
+func TestRepository_DeleteUserURLs(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	ctx := context.Background()
+	userID, err := createTestUser(ctx, db)
+	require.NoError(t, err)
+
+	var ids []uuid.UUID
+	for i := 0; i < 2; i++ {
+		url := &models.ShortenedURL{
+			ID:          uuid.New(),
+			UserID:      userID,
+			OriginalURL: fmt.Sprintf("https://example.com/bulk/%d", i),
+			ShortCode:   fmt.Sprintf("bulk%d", i),
+			CreatedAt:   time.Now(),
+			IsActive:    true,
+		}
+		require.NoError(t, repo.Create(ctx, url))
+		ids = append(ids, url.ID)
+	}
+
+	t.Run("deletes only the user's active URLs", func(t *testing.T) {
+		deleted, err := repo.DeleteUserURLs(ctx, userID, []uuid.UUID{ids[0], uuid.New()})
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{ids[0]}, deleted)
+
+		urls, err := repo.GetByUserID(ctx, userID)
+		require.NoError(t, err)
+		require.Len(t, urls, 1)
+		assert.Equal(t, ids[1], urls[0].ID)
+	})
+
+	t.Run("other users cannot delete", func(t *testing.T) {
+		deleted, err := repo.DeleteUserURLs(ctx, uuid.New(), []uuid.UUID{ids[1]})
+		require.NoError(t, err)
+		assert.Empty(t, deleted)
+	})
+
+	t.Run("already deleted URLs are skipped", func(t *testing.T) {
+		deleted, err := repo.DeleteUserURLs(ctx, userID, []uuid.UUID{ids[0]})
+		require.NoError(t, err)
+		assert.Empty(t, deleted)
+	})
+}
+
 func TestRepository_IncrementAccessCount(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
@@ -320,13 +634,118 @@ func TestRepository_IncrementAccessCount(t *testing.T) {
 		}
 
 		// Verify count
-		updated, err := repo.GetByShortCode(ctx, url.ShortCode)
+		updated, err := repo.GetByShortCode(ctx, uuid.Nil, url.ShortCode)
 		assert.NoError(t, err)
 		assert.Equal(t, 3, updated.AccessCount)
 		assert.NotNil(t, updated.LastAccessedAt)
 	})
 }
 
+func TestRepository_RecordClicks(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	ctx := context.Background()
+	userID, err := createTestUser(ctx, db)
+	require.NoError(t, err)
+
+	url := &models.ShortenedURL{
+		ID:          uuid.New(),
+		UserID:      userID,
+		OriginalURL: "https://example.com",
+		ShortCode:   "batch123",
+		CreatedAt:   time.Now(),
+		IsActive:    true,
+	}
+	require.NoError(t, repo.Create(ctx, url))
+
+	clicks := []*models.ClickAnalytics{
+		{ID: uuid.New(), URLID: url.ID, ClickedAt: time.Now(), IPAddress: "1.1.1.1"},
+		{ID: uuid.New(), URLID: url.ID, ClickedAt: time.Now(), IPAddress: "2.2.2.2"},
+	}
+	// Three accesses, one of them without tracked details
+	err = repo.RecordClicks(ctx, clicks, map[uuid.UUID]int{url.ID: 3})
+	require.NoError(t, err)
+
+	analytics, err := repo.GetURLAnalytics(ctx, url.ID, 24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 2, analytics.TotalClicks)
+
+	updated, err := repo.GetByShortCode(ctx, uuid.Nil, url.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, 3, updated.AccessCount)
+	assert.NotNil(t, updated.LastAccessedAt)
+}
+
+func TestRepository_Pages(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	ctx := context.Background()
+	userID, err := createTestUser(ctx, db)
+	require.NoError(t, err)
+
+	page := &models.ShortenedURL{
+		ID:          uuid.New(),
+		UserID:      userID,
+		ShortCode:   "mylinks",
+		CreatedAt:   time.Now(),
+		IsVanity:    true,
+		IsActive:    true,
+		Title:       "My links",
+		Description: "Everything in one place",
+	}
+	links := []*models.PageLink{
+		{Title: "Blog", URL: "https://blog.example.com"},
+		{Title: "Shop", URL: "https://shop.example.com"},
+	}
+
+	t.Run("create page", func(t *testing.T) {
+		require.NoError(t, repo.CreatePage(ctx, page, links))
+
+		stored, err := repo.GetByShortCode(ctx, uuid.Nil, "mylinks")
+		require.NoError(t, err)
+		assert.Equal(t, models.URLTypePage, stored.Type)
+		assert.Equal(t, "My links", stored.Title)
+
+		got, err := repo.GetPageLinks(ctx, page.ID)
+		require.NoError(t, err)
+		require.Len(t, got, 2)
+		assert.Equal(t, "Blog", got[0].Title)
+		assert.Equal(t, 1, got[1].Position)
+	})
+
+	t.Run("code is shared with redirects", func(t *testing.T) {
+		err := repo.Create(ctx, &models.ShortenedURL{
+			ID:          uuid.New(),
+			UserID:      userID,
+			OriginalURL: "https://example.com",
+			ShortCode:   "mylinks",
+			CreatedAt:   time.Now(),
+			IsActive:    true,
+		})
+		assert.ErrorIs(t, err, ErrShortCodeExists)
+	})
+
+	t.Run("update replaces links", func(t *testing.T) {
+		page.Title = "Renamed"
+		err := repo.UpdatePage(ctx, page, []*models.PageLink{{Title: "Shop", URL: "https://shop.example.com"}})
+		require.NoError(t, err)
+
+		got, err := repo.GetPageLinks(ctx, page.ID)
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		assert.Equal(t, "Shop", got[0].Title)
+		assert.Equal(t, 0, got[0].Position)
+
+		stored, err := repo.GetByShortCode(ctx, uuid.Nil, "mylinks")
+		require.NoError(t, err)
+		assert.Equal(t, "Renamed", stored.Title)
+	})
+}
+
 func TestRepository_Delete(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
@@ -353,7 +772,7 @@ func TestRepository_Delete(t *testing.T) {
 		assert.NoError(t, err)
 
 		// Try to get the URL - should fail
-		_, err = repo.GetByShortCode(ctx, url.ShortCode)
+		_, err = repo.GetByShortCode(ctx, uuid.Nil, url.ShortCode)
 		assert.Error(t, err)
 	})
 
@@ -393,10 +812,135 @@ func TestRepository_Update(t *testing.T) {
 		assert.NoError(t, err)
 
 		// Verify updates
-		updated, err := repo.GetByShortCode(ctx, url.ShortCode)
+		updated, err := repo.GetByShortCode(ctx, uuid.Nil, url.ShortCode)
 		assert.Error(t, err) // Should fail because IsActive is false
 		assert.Nil(t, updated)
 	})
+
+	t.Run("paused url stays listed and can be resumed", func(t *testing.T) {
+		url := &models.ShortenedURL{
+			ID:          uuid.New(),
+			UserID:      userID,
+			OriginalURL: "https://example.com",
+			ShortCode:   "pause123",
+			CreatedAt:   time.Now(),
+			IsActive:    true,
+		}
+		require.NoError(t, repo.Create(ctx, url))
+
+		url.IsActive = false
+		require.NoError(t, repo.Update(ctx, url))
+
+		urls, err := repo.GetByUserID(ctx, userID)
+		require.NoError(t, err)
+		var listed *models.ShortenedURL
+		for _, u := range urls {
+			if u.ID == url.ID {
+				listed = u
+			}
+		}
+		require.NotNil(t, listed, "paused URL missing from the user's URLs")
+		assert.False(t, listed.IsActive)
+
+		url.IsActive = true
+		require.NoError(t, repo.Update(ctx, url))
+		_, err = repo.GetByShortCode(ctx, uuid.Nil, url.ShortCode)
+		assert.NoError(t, err)
+	})
+}
+
+func TestRepository_UpdateShortCode(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	ctx := context.Background()
+	userID, err := createTestUser(ctx, db)
+	require.NoError(t, err)
+
+	newURL := func(code string) *models.ShortenedURL {
+		url := &models.ShortenedURL{
+			ID:          uuid.New(),
+			UserID:      userID,
+			OriginalURL: "https://example.com/regenerate",
+			ShortCode:   code + "-" + uuid.New().String()[:8],
+			CreatedAt:   time.Now(),
+			IsVanity:    true,
+			IsActive:    true,
+		}
+		require.NoError(t, repo.Create(ctx, url))
+		return url
+	}
+
+	t.Run("old code redirects during the grace period", func(t *testing.T) {
+		url := newURL("grace")
+		newCode := "new-" + uuid.New().String()[:8]
+		require.NoError(t, repo.UpdateShortCode(ctx, url.ID, newCode, ptr(time.Now().Add(time.Hour))))
+
+		found, err := repo.GetByShortCode(ctx, uuid.Nil, newCode)
+		require.NoError(t, err)
+		assert.Equal(t, url.ID, found.ID)
+		assert.False(t, found.IsVanity)
+
+		_, err = repo.GetByShortCode(ctx, uuid.Nil, url.ShortCode)
+		assert.ErrorIs(t, err, ErrNotFound)
+		alias, err := repo.GetByAlias(ctx, uuid.Nil, url.ShortCode)
+		require.NoError(t, err)
+		assert.Equal(t, url.ID, alias.ID)
+	})
+
+	t.Run("old code without grace period stays taken", func(t *testing.T) {
+		url := newURL("retired")
+		require.NoError(t, repo.UpdateShortCode(ctx, url.ID, "new-"+uuid.New().String()[:8], nil))
+
+		_, err := repo.GetByAlias(ctx, uuid.Nil, url.ShortCode)
+		assert.ErrorIs(t, err, ErrNotFound)
+		exists, err := repo.ShortCodeExists(ctx, uuid.Nil, url.ShortCode)
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+
+	t.Run("code of another URL", func(t *testing.T) {
+		url, other := newURL("first"), newURL("second")
+		err := repo.UpdateShortCode(ctx, url.ID, other.ShortCode, nil)
+		assert.ErrorIs(t, err, ErrShortCodeExists)
+	})
+
+	t.Run("deleted url", func(t *testing.T) {
+		url := newURL("deleted")
+		require.NoError(t, repo.Delete(ctx, url.ID))
+		err := repo.UpdateShortCode(ctx, url.ID, "new-"+uuid.New().String()[:8], nil)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestRepository_UpdateMetadata(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	ctx := context.Background()
+	userID, err := createTestUser(ctx, db)
+	require.NoError(t, err)
+
+	url := &models.ShortenedURL{
+		ID:          uuid.New(),
+		UserID:      userID,
+		OriginalURL: "https://example.com",
+		ShortCode:   "meta123",
+		CreatedAt:   time.Now(),
+		IsActive:    true,
+	}
+	require.NoError(t, repo.Create(ctx, url))
+
+	err = repo.UpdateMetadata(ctx, url.ID, "Example", "An example page", "https://example.com/favicon.ico")
+	assert.NoError(t, err)
+
+	stored, err := repo.GetByShortCode(ctx, uuid.Nil, url.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, "Example", stored.Title)
+	assert.Equal(t, "An example page", stored.Description)
+	assert.Equal(t, "https://example.com/favicon.ico", stored.FaviconURL)
 }
 
 func TestRepository_AnalyticsFunctions(t *testing.T) {
@@ -465,13 +1009,14 @@ func TestRepository_AnalyticsFunctions(t *testing.T) {
 		}
 
 		// Get analytics
-		analytics, err := repo.GetURLAnalytics(ctx, url.ID)
+		analytics, err := repo.GetURLAnalytics(ctx, url.ID, 24*time.Hour)
 		assert.NoError(t, err)
 		assert.NotNil(t, analytics)
 
 		// Verwende int statt int64 für die Vergleiche
 		expectedTotalClicks := 3
 		expectedUniqueClicks := 3
+		expectedUniqueVisitors := 3
 		expectedGoogleCount := 2
 		expectedFBCount := 1
 		expectedCountryCount := 1
@@ -479,6 +1024,7 @@ func TestRepository_AnalyticsFunctions(t *testing.T) {
 		// Verify basic analytics
 		assert.Equal(t, expectedTotalClicks, analytics.TotalClicks)
 		assert.Equal(t, expectedUniqueClicks, analytics.UniqueClicks)
+		assert.Equal(t, expectedUniqueVisitors, analytics.UniqueVisitors)
 
 		// Verify top referrers
 		assert.Len(t, analytics.TopReferrers, 2)
@@ -499,8 +1045,117 @@ func TestRepository_AnalyticsFunctions(t *testing.T) {
 		assert.Contains(t, countryMap, "DE")
 	})
 
+	t.Run("delete clicks before cutoff", func(t *testing.T) {
+		old := &models.ClickAnalytics{
+			ID:        uuid.New(),
+			URLID:     url.ID,
+			ClickedAt: time.Now().AddDate(0, 0, -40),
+			IPAddress: "4.4.4.4",
+		}
+		require.NoError(t, repo.RecordClick(ctx, old))
+
+		deleted, err := repo.DeleteClicksBefore(ctx, time.Now().AddDate(0, 0, -30))
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), deleted)
+
+		// Recent clicks are untouched
+		analytics, err := repo.GetURLAnalytics(ctx, url.ID, 24*time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, 3, analytics.TotalClicks)
+	})
+
+	t.Run("unique clicks within window", func(t *testing.T) {
+		other := &models.ShortenedURL{
+			ID:          uuid.New(),
+			UserID:      url.UserID,
+			OriginalURL: "https://example.com/unique",
+			ShortCode:   "uniq123",
+			CreatedAt:   time.Now(),
+			IsActive:    true,
+		}
+		require.NoError(t, repo.Create(ctx, other))
+
+		// The same visitor clicks twice within an hour, then again two days later
+		base := time.Now().Add(-72 * time.Hour)
+		for _, offset := range []time.Duration{0, 30 * time.Minute, 48 * time.Hour} {
+			require.NoError(t, repo.RecordClick(ctx, &models.ClickAnalytics{
+				ID:        uuid.New(),
+				URLID:     other.ID,
+				ClickedAt: base.Add(offset),
+				UserAgent: "Mozilla/5.0",
+				IPAddress: "5.5.5.5",
+			}))
+		}
+		// Same IP behind a NAT with a different browser
+		require.NoError(t, repo.RecordClick(ctx, &models.ClickAnalytics{
+			ID:        uuid.New(),
+			URLID:     other.ID,
+			ClickedAt: base,
+			UserAgent: "curl/8.0",
+			IPAddress: "5.5.5.5",
+		}))
+
+		analytics, err := repo.GetURLAnalytics(ctx, other.ID, 24*time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, 4, analytics.TotalClicks)
+		assert.Equal(t, 3, analytics.UniqueClicks)
+		assert.Equal(t, 2, analytics.UniqueVisitors)
+	})
+
+	t.Run("roll up old clicks", func(t *testing.T) {
+		before, err := repo.GetURLAnalytics(ctx, url.ID, 24*time.Hour)
+		require.NoError(t, err)
+
+		rolledUp, err := repo.RollupClicksBefore(ctx, time.Now().Add(time.Minute), 24*time.Hour)
+		require.NoError(t, err)
+		// Clicks of other tests' URLs are rolled up as well
+		assert.GreaterOrEqual(t, rolledUp, int64(7))
+
+		// The counts survive the raw clicks
+		after, err := repo.GetURLAnalytics(ctx, url.ID, 24*time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, before.TotalClicks, after.TotalClicks)
+		assert.Equal(t, before.UniqueClicks, after.UniqueClicks)
+		assert.False(t, before.VisitorsApproximate)
+		assert.True(t, after.VisitorsApproximate)
+		assert.ElementsMatch(t, before.TopReferrers, after.TopReferrers)
+		assert.ElementsMatch(t, before.TopCountries, after.TopCountries)
+
+		// Later clicks of a rolled up day are added to it
+		require.NoError(t, repo.RecordClick(ctx, &models.ClickAnalytics{
+			ID:          uuid.New(),
+			URLID:       url.ID,
+			ClickedAt:   time.Now(),
+			Referrer:    "https://google.com",
+			IPAddress:   "6.6.6.6",
+			CountryCode: "US",
+		}))
+		rolledUp, err = repo.RollupClicksBefore(ctx, time.Now().Add(time.Minute), 24*time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), rolledUp)
+
+		analytics, err := repo.GetURLAnalytics(ctx, url.ID, 24*time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, before.TotalClicks+1, analytics.TotalClicks)
+		assert.Equal(t, "https://google.com", analytics.TopReferrers[0].Referrer)
+		assert.Equal(t, before.TopReferrers[0].Count+1, analytics.TopReferrers[0].Count)
+		total := 0
+		for _, day := range analytics.ClicksByDay {
+			total += day.Count
+		}
+		assert.Equal(t, analytics.TotalClicks, total)
+
+		// Retention deletes rolled up days too
+		deleted, err := repo.DeleteClicksBefore(ctx, time.Now().Add(time.Minute))
+		require.NoError(t, err)
+		assert.Positive(t, deleted)
+		analytics, err = repo.GetURLAnalytics(ctx, url.ID, 24*time.Hour)
+		require.NoError(t, err)
+		assert.Zero(t, analytics.TotalClicks)
+	})
+
 	t.Run("analytics for non-existent URL", func(t *testing.T) {
-		analytics, err := repo.GetURLAnalytics(ctx, uuid.New())
+		analytics, err := repo.GetURLAnalytics(ctx, uuid.New(), 24*time.Hour)
 		assert.Error(t, err)
 		assert.Nil(t, analytics)
 	})
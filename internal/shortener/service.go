@@ -3,35 +3,131 @@ package shortener
 import (
 	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"math/big"
+	mathrand "math/rand/v2"
+	"net/http"
 	"net/url"
 	"regexp"
+	"strings"
+	"sync"
 	"time"
+	"volaticus-go/internal/common/clientip"
+	"volaticus-go/internal/common/cursor"
 	"volaticus-go/internal/common/models"
+	"volaticus-go/internal/common/reserved"
 	"volaticus-go/internal/config"
 
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 )
 
-const (
-	alphabet   = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	codeLength = 8
-)
+// codeRetryJitter is the maximum delay added per attempt after a short code collision
+const codeRetryJitter = 10 * time.Millisecond
+
+// maxCodeGracePeriod is the longest an old code keeps redirecting after the URL got a new one
+const maxCodeGracePeriod = 7 * 24 * time.Hour
 
 type Service struct {
-	repo    Repository
-	baseURL string
-	geoIP   *GeoIPService
+	repo          Repository
+	baseURL       string
+	geoIP         *GeoIPService
+	fetchMetadata bool
+	httpClient    *http.Client // Fetches the metadata of destinations, never from private addresses
+	domainClient  *http.Client // Fetches domain verification files, never from private addresses
+	clientIP      *clientip.Resolver
+	ipMode        string
+	secret        string
+	retentionDays int
+	rollupDays    int
+	uniqueWindow  time.Duration
+	codeLength    int
+	alphabet      string
+	codeRetries   int
+	maxURLs       int
+	maxExpiry     time.Duration
+	pageSize      int // URLs listed per page unless a limit is given
+	maxPageSize   int
+	blocklist     []string     // Domains that can't be shortened, including their subdomains
+	urlCheckers   []URLChecker // External threat lists destinations are looked up in
+	blockPrivate  bool         // Reject destinations on private networks and never connect to them
+	clicks        *ClickWriter // nil writes every click in its own transaction
+	baseHost      string       // Host of the base URL, requests to other hosts may be for a custom domain
+	customDomains bool         // Users can add custom domains and create links on them
+
+	// lookupTXT resolves the TXT records checked by domain verification, nil uses the default resolver
+	lookupTXT   func(ctx context.Context, name string) ([]string, error)
+	domainMu    sync.Mutex
+	domainCache map[string]cachedDomain
 }
 
 func NewService(repo Repository, config *config.Config) *Service {
+	var clicks *ClickWriter
+	if config.ClickBatchSize > 0 {
+		clicks = NewClickWriter(repo, config.ClickBatchSize, config.ClickFlushEvery)
+	}
+
+	var urlCheckers []URLChecker
+	if config.SafeBrowsingKey != "" {
+		urlCheckers = append(urlCheckers, NewSafeBrowsingChecker(config.SafeBrowsingKey))
+	}
+	if config.URLhausKey != "" {
+		urlCheckers = append(urlCheckers, NewURLhausChecker(config.URLhausKey))
+	}
+
+	var baseHost string
+	if base, err := url.Parse(config.BaseURL); err == nil {
+		baseHost = strings.ToLower(base.Hostname())
+	}
+
 	return &Service{
-		repo:    repo,
-		baseURL: config.BaseURL,
-		geoIP:   GetGeoIPService(),
+		repo:          repo,
+		baseURL:       config.BaseURL,
+		geoIP:         NewGeoIPService(config.GeoIPDBPath),
+		fetchMetadata: config.FetchMetadata,
+		httpClient:    publicOnlyClient,
+		domainClient:  publicOnlyClient,
+		clientIP:      clientip.NewResolver(config.TrustProxyHops, config.TrustedProxies),
+		ipMode:        config.AnalyticsIPMode,
+		secret:        config.Secret,
+		retentionDays: config.RetentionDays,
+		rollupDays:    config.RollupDays,
+		uniqueWindow:  config.UniqueWindow,
+		codeLength:    config.ShortCodeLen,
+		alphabet:      config.ShortCodeChars,
+		codeRetries:   config.ShortCodeTries,
+		maxURLs:       config.MaxUserURLs,
+		maxExpiry:     config.URLMaxExpiry,
+		pageSize:      config.PageSize,
+		maxPageSize:   config.MaxPageSize,
+		blocklist:     config.URLBlocklist,
+		urlCheckers:   urlCheckers,
+		blockPrivate:  config.BlockPrivateIPs,
+		clicks:        clicks,
+		baseHost:      baseHost,
+		customDomains: config.CustomDomains,
+	}
+}
+
+// StartClickWriter starts flushing batched clicks, it does nothing if clicks are written synchronously
+func (s *Service) StartClickWriter(ctx context.Context) {
+	if s.clicks != nil {
+		s.clicks.Start(ctx)
+	}
+}
+
+// StopClickWriter writes the clicks still buffered, it must be called on shutdown so they are not lost
+func (s *Service) StopClickWriter(ctx context.Context) error {
+	if s.clicks == nil {
+		return nil
 	}
+	return s.clicks.Close(ctx)
+}
+
+// StartGeoIPReloader reloads the GeoIP database whenever it is updated on disk
+func (s *Service) StartGeoIPReloader(ctx context.Context, interval time.Duration) {
+	s.geoIP.StartReloader(ctx, interval)
 }
 
 // CreateShortURL creates a new shortened URL with optional vanity code and expiration
@@ -40,93 +136,205 @@ func (s *Service) CreateShortURL(ctx context.Context, userID uuid.UUID, req *mod
 	if _, err := url.ParseRequestURI(req.URL); err != nil {
 		return nil, fmt.Errorf("invalid URL format: %w", err)
 	}
+	if err := s.checkDestination(ctx, req.URL); err != nil {
+		return nil, err
+	}
+	expiresAt, err := s.checkExpiration(req.ExpiresAt, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkURLLimit(ctx, userID); err != nil {
+		return nil, err
+	}
 
 	var shortCode string
-	var err error
 	isVanity := false
 
+	// Codes are unique per domain, uuid.Nil is the default domain
+	var domain *models.CustomDomain
+	domainID := uuid.Nil
+	if req.Domain != "" {
+		domain, err = s.verifiedUserDomain(ctx, userID, req.Domain)
+		if err != nil {
+			return nil, err
+		}
+		domainID = domain.ID
+	}
+
 	// Handle vanity code if provided
 	if req.VanityCode != "" {
-		if err := s.validateVanityCode(ctx, req.VanityCode); err != nil {
+		if err := s.validateVanityCode(ctx, domainID, req.VanityCode); err != nil {
 			return nil, err
 		}
 		shortCode = req.VanityCode
 		isVanity = true
 	} else {
 		// Generate random code
-		shortCode, err = s.generateUniqueCode(ctx)
+		shortCode, err = s.generateUniqueCode(ctx, domainID)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	trackAnalytics := true
+	if req.TrackAnalytics != nil {
+		trackAnalytics = *req.TrackAnalytics
+	}
+
 	// Create ShortenedURL object
 	shortenedURL := &models.ShortenedURL{
-		ID:          uuid.New(),
-		UserID:      userID,
-		OriginalURL: req.URL,
-		ShortCode:   shortCode,
-		CreatedAt:   time.Now(),
-		ExpiresAt:   req.ExpiresAt,
-		IsVanity:    isVanity,
-		IsActive:    true,
+		ID:             uuid.New(),
+		UserID:         userID,
+		OriginalURL:    req.URL,
+		ShortCode:      shortCode,
+		CreatedAt:      time.Now(),
+		ExpiresAt:      expiresAt,
+		IsVanity:       isVanity,
+		IsActive:       true,
+		TrackAnalytics: trackAnalytics,
 	}
+	var domainName string
+	if domain != nil {
+		shortenedURL.DomainID = &domain.ID
+		domainName = domain.Domain
+	}
+
+	// Save URL in database. A generated code taken by a concurrent request is replaced,
+	// a vanity code is the user's choice and reported as taken.
+	for attempt := 1; ; attempt++ {
+		err := s.repo.Create(ctx, shortenedURL)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ErrShortCodeExists) || isVanity || attempt >= s.codeRetries {
+			return nil, fmt.Errorf("creating shortened URL: %w", err)
+		}
 
-	// Save URL in database
-	if err := s.repo.Create(ctx, shortenedURL); err != nil {
-		return nil, fmt.Errorf("creating shortened URL: %w", err)
+		shortCode, err = s.generateUniqueCode(ctx, domainID)
+		if err != nil {
+			return nil, err
+		}
+		shortenedURL.ShortCode = shortCode
+	}
+
+	if s.fetchMetadata {
+		go s.storeMetadata(shortenedURL.ID, req.URL)
 	}
 
+	shortURL := s.ShortURL(domainName, shortCode)
 	return &models.CreateURLResponse{
-		ShortURL:    s.baseURL + "/s/" + shortCode,
-		OriginalURL: req.URL,
-		ShortCode:   shortCode,
-		ExpiresAt:   req.ExpiresAt,
-		IsVanity:    isVanity,
+		ID:           shortenedURL.ID,
+		ShortURL:     shortURL,
+		OriginalURL:  req.URL,
+		ShortCode:    shortCode,
+		ExpiresAt:    expiresAt,
+		IsVanity:     isVanity,
+		QRURL:        qrCodeURL(shortURL),
+		AnalyticsURL: s.apiURL(shortenedURL.ID),
 	}, nil
 }
 
-// GetOriginalURL retrieves the original URL and records analytics
-func (s *Service) GetOriginalURL(ctx context.Context, shortCode string, r *models.RequestInfo) (string, error) {
-	// Retrieve URL from database
-	shortenedURL, err := s.repo.GetByShortCode(ctx, shortCode)
+// ShortURL returns the public link redirecting to the URL of the short code. Codes on a custom
+// domain are served from its root, with the scheme of the base URL.
+func (s *Service) ShortURL(domain, shortCode string) string {
+	if domain == "" {
+		return s.baseURL + "/s/" + shortCode
+	}
+	scheme := "https"
+	if base, err := url.Parse(s.baseURL); err == nil && base.Scheme != "" {
+		scheme = base.Scheme
+	}
+	return scheme + "://" + domain + "/" + shortCode
+}
+
+// apiURL returns the API resource of a short URL, which also holds its click analytics
+func (s *Service) apiURL(id uuid.UUID) string {
+	return s.baseURL + "/api/v1/urls/" + id.String()
+}
+
+// qrCodeURL returns an image URL of a QR code encoding the given link, using the same generator as the web interface
+func qrCodeURL(link string) string {
+	return "https://api.qrserver.com/v1/create-qr-code/?size=200x200&data=" + url.QueryEscape(link)
+}
+
+// storeMetadata fetches the link preview of a URL in the background.
+// Failures are only logged, the preview is purely cosmetic.
+func (s *Service) storeMetadata(urlID uuid.UUID, originalURL string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	metadata, err := FetchMetadata(ctx, s.httpClient, originalURL)
 	if err != nil {
-		return "", fmt.Errorf("retrieving URL: %w", err)
+		log.Debug().
+			Err(err).
+			Str("url_id", urlID.String()).
+			Msg("Failed to fetch URL metadata")
+		return
+	}
+
+	if err := s.repo.UpdateMetadata(ctx, urlID, metadata.Title, metadata.Description, metadata.FaviconURL); err != nil {
+		log.Error().
+			Err(err).
+			Str("url_id", urlID.String()).
+			Msg("Failed to store URL metadata")
+	}
+}
+
+// Visit retrieves the URL of a short code on the domain and records analytics. Redirects are
+// sent to the original URL, link pages are shown with their links.
+func (s *Service) Visit(ctx context.Context, domainID uuid.UUID, shortCode string, r *models.RequestInfo) (*models.ShortenedURL, error) {
+	// Retrieve URL from database, old codes of regenerated URLs redirect during their grace period
+	shortenedURL, err := s.repo.GetByShortCode(ctx, domainID, shortCode)
+	if errors.Is(err, ErrNotFound) {
+		shortenedURL, err = s.repo.GetByAlias(ctx, domainID, shortCode)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("retrieving URL: %w", err)
 	}
 
 	// Check if URL is expired
 	if shortenedURL.ExpiresAt != nil && time.Now().After(*shortenedURL.ExpiresAt) {
-		return "", fmt.Errorf("URL has expired")
+		return nil, ErrExpired
 	}
 
-	// Get location info from IP
-	location := s.geoIP.GetLocation(r.IPAddress)
-
 	// Create a new context with a timeout for the asynchronous operations
 	asyncCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 
 	// Record analytics asynchronously
 	go func() {
 		defer cancel()
-		analytics := &models.ClickAnalytics{
-			ID:          uuid.New(),
-			URLID:       shortenedURL.ID,
-			ClickedAt:   time.Now(),
-			Referrer:    r.Referrer,
-			UserAgent:   r.UserAgent,
-			IPAddress:   r.IPAddress,
-			CountryCode: location.CountryCode,
-			City:        location.City,
-			Region:      location.Region,
+
+		// Links without tracking only count clicks, no visitor details are stored
+		var analytics *models.ClickAnalytics
+		if shortenedURL.TrackAnalytics {
+			location := s.geoIP.GetLocation(r.IPAddress)
+			analytics = &models.ClickAnalytics{
+				ID:          uuid.New(),
+				URLID:       shortenedURL.ID,
+				ClickedAt:   time.Now(),
+				Referrer:    r.Referrer,
+				UserAgent:   r.UserAgent,
+				IPAddress:   clientip.ForStorage(r.IPAddress, s.ipMode, s.secret),
+				CountryCode: location.CountryCode,
+				City:        location.City,
+				Region:      location.Region,
+			}
 		}
 
-		if err := s.repo.RecordClick(asyncCtx, analytics); err != nil {
-			log.Error().
-				Err(err).
-				Str("url_id", shortenedURL.ID.String()).
-				Str("short_code", shortCode).
-				Str("ip", r.IPAddress).
-				Msg("Failed to record click analytics")
+		if s.clicks != nil {
+			s.clicks.Record(shortenedURL.ID, analytics)
+			return
+		}
+
+		if analytics != nil {
+			if err := s.repo.RecordClick(asyncCtx, analytics); err != nil {
+				log.Error().
+					Err(err).
+					Str("url_id", shortenedURL.ID.String()).
+					Str("short_code", shortCode).
+					Msg("Failed to record click analytics")
+			}
 		}
 
 		if err := s.repo.IncrementAccessCount(asyncCtx, shortenedURL.ID); err != nil {
@@ -138,7 +346,132 @@ func (s *Service) GetOriginalURL(ctx context.Context, shortCode string, r *model
 		}
 	}()
 
-	return shortenedURL.OriginalURL, nil
+	return shortenedURL, nil
+}
+
+// CreatePage creates a link page listing the links of the request under its vanity code
+func (s *Service) CreatePage(ctx context.Context, userID uuid.UUID, req *models.CreatePageRequest) (*models.CreateURLResponse, error) {
+	if err := s.checkURLLimit(ctx, userID); err != nil {
+		return nil, err
+	}
+	if err := s.validateVanityCode(ctx, uuid.Nil, req.VanityCode); err != nil {
+		return nil, err
+	}
+	if err := s.checkPageLinks(ctx, req.Links); err != nil {
+		return nil, err
+	}
+	expiresAt, err := s.checkExpiration(req.ExpiresAt, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.ShortenedURL{
+		ID:             uuid.New(),
+		UserID:         userID,
+		ShortCode:      req.VanityCode,
+		CreatedAt:      time.Now(),
+		ExpiresAt:      expiresAt,
+		IsVanity:       true,
+		IsActive:       true,
+		TrackAnalytics: true,
+		Title:          req.Title,
+		Description:    req.Description,
+		Type:           models.URLTypePage,
+	}
+	if err := s.repo.CreatePage(ctx, page, pageLinks(req.Links)); err != nil {
+		return nil, fmt.Errorf("creating link page: %w", err)
+	}
+
+	shortURL := s.ShortURL("", page.ShortCode)
+	return &models.CreateURLResponse{
+		ID:           page.ID,
+		ShortURL:     shortURL,
+		ShortCode:    page.ShortCode,
+		ExpiresAt:    page.ExpiresAt,
+		IsVanity:     true,
+		QRURL:        qrCodeURL(shortURL),
+		AnalyticsURL: s.apiURL(page.ID),
+	}, nil
+}
+
+// GetPage retrieves a link page of the user with its links
+func (s *Service) GetPage(ctx context.Context, urlID uuid.UUID, userID uuid.UUID) (*models.LinkPage, error) {
+	page, err := s.userPage(ctx, urlID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	links, err := s.repo.GetPageLinks(ctx, page.ID)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving page links: %w", err)
+	}
+	return &models.LinkPage{URL: page, Links: links}, nil
+}
+
+// UpdatePage replaces the title, description and links of a link page of the user
+func (s *Service) UpdatePage(ctx context.Context, urlID uuid.UUID, userID uuid.UUID, req *models.UpdatePageRequest) (*models.LinkPage, error) {
+	page, err := s.userPage(ctx, urlID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkPageLinks(ctx, req.Links); err != nil {
+		return nil, err
+	}
+
+	page.Title = req.Title
+	page.Description = req.Description
+	links := pageLinks(req.Links)
+	if err := s.repo.UpdatePage(ctx, page, links); err != nil {
+		return nil, fmt.Errorf("updating link page: %w", err)
+	}
+	return &models.LinkPage{URL: page, Links: links}, nil
+}
+
+// GetPageLinks retrieves the links shown on a link page
+func (s *Service) GetPageLinks(ctx context.Context, pageID uuid.UUID) ([]*models.PageLink, error) {
+	return s.repo.GetPageLinks(ctx, pageID)
+}
+
+// userPage returns the link page with the ID if it belongs to the user
+func (s *Service) userPage(ctx context.Context, urlID uuid.UUID, userID uuid.UUID) (*models.ShortenedURL, error) {
+	urls, err := s.repo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, url := range urls {
+		if url.ID == urlID {
+			if url.Type != models.URLTypePage {
+				return nil, ErrNotPage
+			}
+			return url, nil
+		}
+	}
+	return nil, ErrForbidden
+}
+
+// pageLinks converts the links of a request in their display order
+func pageLinks(inputs []models.PageLinkInput) []*models.PageLink {
+	links := make([]*models.PageLink, len(inputs))
+	for i, input := range inputs {
+		links[i] = &models.PageLink{
+			ID:       uuid.New(),
+			Position: i,
+			Title:    input.Title,
+			URL:      input.URL,
+		}
+	}
+	return links
+}
+
+// checkPageLinks checks the destination of every link of a page
+func (s *Service) checkPageLinks(ctx context.Context, links []models.PageLinkInput) error {
+	for _, link := range links {
+		if err := s.checkDestination(ctx, link.URL); err != nil {
+			return fmt.Errorf("link %q: %w", link.Title, err)
+		}
+	}
+	return nil
 }
 
 // GetUserURLs retrieves all URLs created by a specific user
@@ -146,6 +479,55 @@ func (s *Service) GetUserURLs(ctx context.Context, userID uuid.UUID) ([]*models.
 	return s.repo.GetByUserID(ctx, userID)
 }
 
+// GetUserURLsPage retrieves a page of the user's URLs and the total number of URLs
+func (s *Service) GetUserURLsPage(ctx context.Context, userID uuid.UUID, limit, offset int, sort string) ([]*models.ShortenedURL, int, error) {
+	urls, err := s.repo.GetByUserIDPaginated(ctx, userID, limit, offset, sort)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := s.GetUserURLsCount(ctx, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return urls, total, nil
+}
+
+// GetUserURLsAfter retrieves the user's URLs following a cursor in creation order. Only the
+// newest and oldest sorts can be continued from a cursor.
+func (s *Service) GetUserURLsAfter(ctx context.Context, userID uuid.UUID, after *cursor.Cursor, limit int, sort string) ([]*models.ShortenedURL, error) {
+	switch sort {
+	case "newest":
+		return s.repo.GetByUserIDAfter(ctx, userID, after, limit, false)
+	case "oldest":
+		return s.repo.GetByUserIDAfter(ctx, userID, after, limit, true)
+	default:
+		return nil, ErrCursorSort
+	}
+}
+
+// GetUserURLsCount returns the number of URLs of the user, including paused ones
+func (s *Service) GetUserURLsCount(ctx context.Context, userID uuid.UUID) (int, error) {
+	return s.repo.CountByUserID(ctx, userID)
+}
+
+// checkURLLimit verifies the user may create another URL
+func (s *Service) checkURLLimit(ctx context.Context, userID uuid.UUID) error {
+	if s.maxURLs <= 0 {
+		return nil
+	}
+
+	count, err := s.GetUserURLsCount(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("checking URL limit: %w", err)
+	}
+	if count >= s.maxURLs {
+		return fmt.Errorf("%w: at most %d URLs per user", ErrURLLimitReached, s.maxURLs)
+	}
+	return nil
+}
+
 // GetURLAnalytics retrieves analytics for a specific URL
 func (s *Service) GetURLAnalytics(ctx context.Context, urlID uuid.UUID, userID uuid.UUID) (*models.URLAnalytics, error) {
 	// First verify the user owns this URL
@@ -163,10 +545,10 @@ func (s *Service) GetURLAnalytics(ctx context.Context, urlID uuid.UUID, userID u
 	}
 
 	if !found {
-		return nil, fmt.Errorf("unauthorized access to URL analytics")
+		return nil, fmt.Errorf("%w analytics", ErrForbidden)
 	}
 
-	return s.repo.GetURLAnalytics(ctx, urlID)
+	return s.repo.GetURLAnalytics(ctx, urlID, s.uniqueWindow)
 }
 
 // DeleteURL soft deletes a URL
@@ -186,23 +568,46 @@ func (s *Service) DeleteURL(ctx context.Context, urlID uuid.UUID, userID uuid.UU
 	}
 
 	if !found {
-		return fmt.Errorf("unauthorized access to URL")
+		return ErrForbidden
 	}
 
 	return s.repo.Delete(ctx, urlID)
 }
 
-// DeleteURLByShortCode deletes a URL by its short code
+// DeleteURLs soft deletes several URLs of the user, IDs the user does not own are reported as not found
+func (s *Service) DeleteURLs(ctx context.Context, ids []uuid.UUID, userID uuid.UUID) ([]models.BulkDeleteResult, error) {
+	deleted, err := s.repo.DeleteUserURLs(ctx, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	deletedSet := make(map[uuid.UUID]bool, len(deleted))
+	for _, id := range deleted {
+		deletedSet[id] = true
+	}
+
+	results := make([]models.BulkDeleteResult, 0, len(ids))
+	for _, id := range ids {
+		result := models.BulkDeleteResult{ID: id, Success: deletedSet[id]}
+		if !result.Success {
+			result.Error = "URL not found"
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// DeleteURLByShortCode deletes a URL by its short code on the default domain
 func (s *Service) DeleteURLByShortCode(ctx context.Context, shortCode string, userID uuid.UUID) error {
 	// Retrieve the URL by short code
-	shortenedURL, err := s.repo.GetByShortCode(ctx, shortCode)
+	shortenedURL, err := s.repo.GetByShortCode(ctx, uuid.Nil, shortCode)
 	if err != nil {
 		return fmt.Errorf("retrieving URL: %w", err)
 	}
 
 	// Verify ownership
 	if shortenedURL.UserID != userID {
-		return fmt.Errorf("unauthorized access to URL")
+		return ErrForbidden
 	}
 
 	// Delete the URL
@@ -213,8 +618,14 @@ func (s *Service) DeleteURLByShortCode(ctx context.Context, shortCode string, us
 	return nil
 }
 
-// UpdateURLExpiration updates the expiration date of a URL
+// UpdateURLExpiration updates the expiration date of a URL, dates past the configured maximum are
+// clamped to it
 func (s *Service) UpdateURLExpiration(ctx context.Context, urlID uuid.UUID, userID uuid.UUID, expiresAt *time.Time) error {
+	expiresAt, err := s.checkExpiration(expiresAt, time.Now())
+	if err != nil {
+		return err
+	}
+
 	// Verify ownership
 	urls, err := s.repo.GetByUserID(ctx, userID)
 	if err != nil {
@@ -230,13 +641,149 @@ func (s *Service) UpdateURLExpiration(ctx context.Context, urlID uuid.UUID, user
 	}
 
 	if targetURL == nil {
-		return fmt.Errorf("unauthorized access to URL")
+		return ErrForbidden
 	}
 
 	targetURL.ExpiresAt = expiresAt
 	return s.repo.Update(ctx, targetURL)
 }
 
+// SetURLActive pauses or resumes the redirect of a URL and returns the updated URL
+func (s *Service) SetURLActive(ctx context.Context, urlID uuid.UUID, userID uuid.UUID, active bool) (*models.ShortenedURL, error) {
+	// Verify ownership
+	urls, err := s.repo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var targetURL *models.ShortenedURL
+	for _, url := range urls {
+		if url.ID == urlID {
+			targetURL = url
+			break
+		}
+	}
+
+	if targetURL == nil {
+		return nil, ErrForbidden
+	}
+
+	targetURL.IsActive = active
+	if err := s.repo.Update(ctx, targetURL); err != nil {
+		return nil, err
+	}
+	return targetURL, nil
+}
+
+// RegenerateShortCode replaces the code of a URL of the user with a new random one, for example
+// after the old one leaked, and returns the new link. The old code keeps redirecting for the grace
+// period, a zero grace period retires it at once. Old codes are never given to other URLs.
+func (s *Service) RegenerateShortCode(ctx context.Context, urlID uuid.UUID, userID uuid.UUID, grace time.Duration) (*models.CreateURLResponse, error) {
+	if grace < 0 || grace > maxCodeGracePeriod {
+		return nil, ErrInvalidGracePeriod
+	}
+
+	// Verify ownership
+	urls, err := s.repo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var targetURL *models.ShortenedURL
+	for _, url := range urls {
+		if url.ID == urlID {
+			targetURL = url
+			break
+		}
+	}
+
+	if targetURL == nil {
+		return nil, ErrForbidden
+	}
+
+	domainID := uuid.Nil
+	if targetURL.DomainID != nil {
+		domainID = *targetURL.DomainID
+	}
+
+	var redirectUntil *time.Time
+	if grace > 0 {
+		until := time.Now().Add(grace)
+		redirectUntil = &until
+	}
+
+	// A code taken by a concurrent request is replaced like when creating URLs
+	var shortCode string
+	for attempt := 1; ; attempt++ {
+		shortCode, err = s.generateUniqueCode(ctx, domainID)
+		if err != nil {
+			return nil, err
+		}
+		err = s.repo.UpdateShortCode(ctx, urlID, shortCode, redirectUntil)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ErrShortCodeExists) || attempt >= s.codeRetries {
+			return nil, fmt.Errorf("updating short code: %w", err)
+		}
+	}
+
+	shortURL := s.ShortURL(targetURL.Domain, shortCode)
+	return &models.CreateURLResponse{
+		ID:           targetURL.ID,
+		ShortURL:     shortURL,
+		OriginalURL:  targetURL.OriginalURL,
+		ShortCode:    shortCode,
+		ExpiresAt:    targetURL.ExpiresAt,
+		QRURL:        qrCodeURL(shortURL),
+		AnalyticsURL: s.apiURL(targetURL.ID),
+	}, nil
+}
+
+// PurgeOldAnalytics deletes click analytics older than the configured retention period
+func (s *Service) PurgeOldAnalytics(ctx context.Context) error {
+	if s.retentionDays <= 0 {
+		return nil
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -s.retentionDays)
+	deleted, err := s.repo.DeleteClicksBefore(ctx, cutoff)
+	if err != nil {
+		return fmt.Errorf("deleting old click analytics: %w", err)
+	}
+
+	if deleted > 0 {
+		log.Info().
+			Int64("deleted", deleted).
+			Time("cutoff", cutoff).
+			Msg("Purged old click analytics")
+	}
+	return nil
+}
+
+// RollupOldAnalytics aggregates raw clicks older than the configured rollup period into daily
+// counts. The cutoff is the start of a UTC day, so although the task runs on every cleanup
+// interval the raw clicks are only rolled up once a night.
+func (s *Service) RollupOldAnalytics(ctx context.Context) error {
+	if s.rollupDays <= 0 {
+		return nil
+	}
+
+	cutoff := time.Now().UTC().AddDate(0, 0, -s.rollupDays).Truncate(24 * time.Hour)
+	rolledUp, err := s.repo.RollupClicksBefore(ctx, cutoff, s.uniqueWindow)
+	if err != nil {
+		return fmt.Errorf("rolling up old click analytics: %w", err)
+	}
+
+	if rolledUp > 0 {
+		log.Info().
+			Int64("clicks", rolledUp).
+			Time("cutoff", cutoff).
+			Msg("Rolled up old click analytics")
+	}
+	return nil
+}
+
 // CleanupExpiredURLs deactivates expired URLs
 func (s *Service) CleanupExpiredURLs(ctx context.Context) error {
 	urls, err := s.repo.GetURLsByExpiration(ctx, time.Now())
@@ -261,42 +808,62 @@ func (s *Service) CleanupExpiredURLs(ctx context.Context) error {
 
 // Helper functions
 
-func (s *Service) generateUniqueCode(ctx context.Context) (string, error) {
-	for attempts := 0; attempts < 5; attempts++ {
+// generateUniqueCode generates random codes until one is found that is not taken.
+// Collisions back off for a random delay so concurrent requests don't keep racing for the same codes.
+func (s *Service) generateUniqueCode(ctx context.Context, domainID uuid.UUID) (string, error) {
+	for attempts := 0; attempts < s.codeRetries; attempts++ {
+		if attempts > 0 {
+			timer := time.NewTimer(mathrand.N(time.Duration(attempts) * codeRetryJitter))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return "", ctx.Err()
+			case <-timer.C:
+			}
+		}
+
 		code, err := s.generateCode(ctx)
 		if err != nil {
+			return "", fmt.Errorf("generating short code: %w", err)
+		}
+		if reserved.IsReserved(code) {
 			continue
 		}
 
-		// Check if code already exists
-		_, err = s.repo.GetByShortCode(ctx, code)
+		exists, err := s.repo.ShortCodeExists(ctx, domainID, code)
 		if err != nil {
-			// If Error "not found", then code is unique
+			return "", fmt.Errorf("checking short code: %w", err)
+		}
+		if !exists {
 			return code, nil
 		}
+
+		log.Warn().
+			Int("attempt", attempts+1).
+			Msg("Short code collision occurred, retrying")
 	}
 
-	return "", fmt.Errorf("could not generate unique code after 5 attempts")
+	return "", fmt.Errorf("could not generate unique code after %d attempts", s.codeRetries)
 }
 
 func (s *Service) generateCode(ctx context.Context) (string, error) {
-	length := len(alphabet)
-	code := make([]byte, codeLength)
+	length := len(s.alphabet)
+	code := make([]byte, s.codeLength)
 
-	for i := 0; i < codeLength; i++ {
+	for i := 0; i < s.codeLength; i++ {
 		n, err := rand.Int(rand.Reader, big.NewInt(int64(length)))
 		if err != nil {
 			return "", err
 		}
-		code[i] = alphabet[n.Int64()]
+		code[i] = s.alphabet[n.Int64()]
 	}
 
 	return string(code), nil
 }
 
-func (s *Service) validateVanityCode(ctx context.Context, code string) error {
+func (s *Service) validateVanityCode(ctx context.Context, domainID uuid.UUID, code string) error {
 	if len(code) < 4 || len(code) > 30 {
-		return fmt.Errorf("vanity code must be between 4 and 30 characters")
+		return fmt.Errorf("%w: must be between 4 and 30 characters", ErrInvalidVanity)
 	}
 
 	// Check if code contains only allowed characters
@@ -305,13 +872,16 @@ func (s *Service) validateVanityCode(ctx context.Context, code string) error {
 		return err
 	}
 	if !matched {
-		return fmt.Errorf("vanity code can only contain letters, numbers, hyphens, and underscores")
+		return fmt.Errorf("%w: can only contain letters, numbers, hyphens, and underscores", ErrInvalidVanity)
+	}
+	if reserved.IsReserved(code) {
+		return fmt.Errorf("%w: is reserved", ErrInvalidVanity)
 	}
 
-	// Check if code already exists
-	_, err = s.repo.GetByShortCode(ctx, code)
+	// Check if code already exists, Create reports codes taken in the meantime
+	_, err = s.repo.GetByShortCode(ctx, domainID, code)
 	if err == nil {
-		return fmt.Errorf("vanity code already in use")
+		return ErrShortCodeExists
 	}
 
 	return nil
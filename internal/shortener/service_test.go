@@ -0,0 +1,310 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"volaticus-go/internal/common/models"
+	"volaticus-go/internal/common/reserved"
+
+	"github.com/google/uuid"
+)
+
+// freeCodeRepository reports every short code as unused and knows no custom domains
+type freeCodeRepository struct {
+	Repository
+}
+
+func (freeCodeRepository) ShortCodeExists(context.Context, uuid.UUID, string) (bool, error) {
+	return false, nil
+}
+
+func (freeCodeRepository) GetVerifiedDomain(context.Context, string) (*models.CustomDomain, error) {
+	return nil, ErrDomainNotFound
+}
+
+func TestGenerateUniqueCodeSkipsReserved(t *testing.T) {
+	// A tiny alphabet of the letters of "api" and "s" makes reserved codes likely
+	s := &Service{
+		repo:        freeCodeRepository{},
+		codeLength:  4,
+		alphabet:    "apis",
+		codeRetries: 1000,
+	}
+
+	for i := 0; i < 2000; i++ {
+		code, err := s.generateUniqueCode(context.Background(), uuid.Nil)
+		if err != nil {
+			t.Fatalf("generateUniqueCode() error = %v", err)
+		}
+		if reserved.IsReserved(code) {
+			t.Fatalf("generateUniqueCode() = %q, a reserved code", code)
+		}
+	}
+}
+
+func TestValidateVanityCodeReserved(t *testing.T) {
+	s := &Service{repo: freeCodeRepository{}}
+	for _, code := range []string{"login", "Settings", "API", "assets"} {
+		if err := s.validateVanityCode(context.Background(), uuid.Nil, code); err == nil {
+			t.Errorf("validateVanityCode(%q) accepted a reserved code", code)
+		}
+	}
+}
+
+// racingRepository loses the first inserts to concurrent requests taking the same code
+type racingRepository struct {
+	freeCodeRepository
+	conflicts int
+	codes     []string
+}
+
+func (r *racingRepository) GetByShortCode(context.Context, uuid.UUID, string) (*models.ShortenedURL, error) {
+	return nil, ErrNotFound
+}
+
+func (r *racingRepository) Create(_ context.Context, url *models.ShortenedURL) error {
+	r.codes = append(r.codes, url.ShortCode)
+	if len(r.codes) <= r.conflicts {
+		return ErrShortCodeExists
+	}
+	return nil
+}
+
+func TestCreateShortURLCodeRace(t *testing.T) {
+	newService := func(repo Repository) *Service {
+		return &Service{repo: repo, codeLength: 8, alphabet: "abcdef", codeRetries: 3}
+	}
+
+	t.Run("generated code is replaced", func(t *testing.T) {
+		repo := &racingRepository{conflicts: 1}
+		resp, err := newService(repo).CreateShortURL(context.Background(), uuid.New(),
+			&models.CreateURLRequest{URL: "https://example.com"})
+		if err != nil {
+			t.Fatalf("CreateShortURL() error = %v", err)
+		}
+		if len(repo.codes) != 2 || resp.ShortCode != repo.codes[1] {
+			t.Errorf("CreateShortURL() = %q after inserting %v, want the second code", resp.ShortCode, repo.codes)
+		}
+	})
+
+	t.Run("vanity code is reported as taken", func(t *testing.T) {
+		repo := &racingRepository{conflicts: 1}
+		_, err := newService(repo).CreateShortURL(context.Background(), uuid.New(),
+			&models.CreateURLRequest{URL: "https://example.com", VanityCode: "my-link"})
+		if !errors.Is(err, ErrShortCodeExists) {
+			t.Fatalf("CreateShortURL() error = %v, want ErrShortCodeExists", err)
+		}
+		if len(repo.codes) != 1 {
+			t.Errorf("Create called %d times, want 1", len(repo.codes))
+		}
+	})
+
+	t.Run("gives up after the retries", func(t *testing.T) {
+		repo := &racingRepository{conflicts: 100}
+		_, err := newService(repo).CreateShortURL(context.Background(), uuid.New(),
+			&models.CreateURLRequest{URL: "https://example.com"})
+		if !errors.Is(err, ErrShortCodeExists) {
+			t.Fatalf("CreateShortURL() error = %v, want ErrShortCodeExists", err)
+		}
+		if len(repo.codes) != 3 {
+			t.Errorf("Create called %d times, want 3", len(repo.codes))
+		}
+	})
+}
+
+// countingRepository reports a fixed number of URLs for every user
+type countingRepository struct {
+	racingRepository
+	count int
+}
+
+func (r *countingRepository) CountByUserID(context.Context, uuid.UUID) (int, error) {
+	return r.count, nil
+}
+
+func TestCreateShortURLLimit(t *testing.T) {
+	req := &models.CreateURLRequest{URL: "https://example.com"}
+
+	repo := &countingRepository{count: 2}
+	s := &Service{repo: repo, codeLength: 8, alphabet: "abcdef", codeRetries: 1, maxURLs: 2}
+	if _, err := s.CreateShortURL(context.Background(), uuid.New(), req); !errors.Is(err, ErrURLLimitReached) {
+		t.Fatalf("CreateShortURL() error = %v, want ErrURLLimitReached", err)
+	}
+	if len(repo.codes) != 0 {
+		t.Errorf("Create called %d times over the limit", len(repo.codes))
+	}
+
+	repo.count = 1
+	if _, err := s.CreateShortURL(context.Background(), uuid.New(), req); err != nil {
+		t.Errorf("CreateShortURL() below the limit error = %v", err)
+	}
+
+	s.maxURLs = 0
+	repo.count = 1000
+	if _, err := s.CreateShortURL(context.Background(), uuid.New(), req); err != nil {
+		t.Errorf("CreateShortURL() without a limit error = %v", err)
+	}
+}
+
+// pageRepository owns one redirect and one link page
+type pageRepository struct {
+	Repository
+	redirect, page *models.ShortenedURL
+}
+
+func (r pageRepository) GetByUserID(context.Context, uuid.UUID) ([]*models.ShortenedURL, error) {
+	return []*models.ShortenedURL{r.redirect, r.page}, nil
+}
+
+func (pageRepository) GetPageLinks(context.Context, uuid.UUID) ([]*models.PageLink, error) {
+	return []*models.PageLink{{Title: "Blog", URL: "https://blog.example.com"}}, nil
+}
+
+func TestGetPage(t *testing.T) {
+	repo := pageRepository{
+		redirect: &models.ShortenedURL{ID: uuid.New(), Type: models.URLTypeRedirect},
+		page:     &models.ShortenedURL{ID: uuid.New(), Type: models.URLTypePage},
+	}
+	s := &Service{repo: repo}
+
+	page, err := s.GetPage(context.Background(), repo.page.ID, uuid.New())
+	if err != nil {
+		t.Fatalf("GetPage() error = %v", err)
+	}
+	if len(page.Links) != 1 {
+		t.Errorf("GetPage() returned %d links, want 1", len(page.Links))
+	}
+
+	if _, err := s.GetPage(context.Background(), repo.redirect.ID, uuid.New()); !errors.Is(err, ErrNotPage) {
+		t.Errorf("GetPage() of a redirect error = %v, want ErrNotPage", err)
+	}
+	if _, err := s.GetPage(context.Background(), uuid.New(), uuid.New()); !errors.Is(err, ErrForbidden) {
+		t.Errorf("GetPage() of an unknown URL error = %v, want ErrForbidden", err)
+	}
+}
+
+// rollupRepository records the cutoff of the last rollup
+type rollupRepository struct {
+	Repository
+	cutoff time.Time
+}
+
+func (r *rollupRepository) RollupClicksBefore(_ context.Context, before time.Time, _ time.Duration) (int64, error) {
+	r.cutoff = before
+	return 0, nil
+}
+
+func TestRollupOldAnalytics(t *testing.T) {
+	repo := &rollupRepository{}
+	s := &Service{repo: repo}
+	if err := s.RollupOldAnalytics(context.Background()); err != nil || !repo.cutoff.IsZero() {
+		t.Fatalf("RollupOldAnalytics() without rollups rolled up before %v, error = %v", repo.cutoff, err)
+	}
+
+	s.rollupDays = 30
+	if err := s.RollupOldAnalytics(context.Background()); err != nil {
+		t.Fatalf("RollupOldAnalytics() error = %v", err)
+	}
+	// Whole days are rolled up, so later runs on the same day find nothing to do
+	want := time.Now().UTC().AddDate(0, 0, -30).Truncate(24 * time.Hour)
+	if !repo.cutoff.Equal(want) {
+		t.Errorf("cutoff = %v, want %v", repo.cutoff, want)
+	}
+}
+
+// regenerateRepository owns one URL on a custom domain and records code updates
+type regenerateRepository struct {
+	freeCodeRepository
+	url           *models.ShortenedURL
+	conflicts     int
+	codes         []string
+	redirectUntil *time.Time
+}
+
+func (r *regenerateRepository) GetByUserID(context.Context, uuid.UUID) ([]*models.ShortenedURL, error) {
+	return []*models.ShortenedURL{r.url}, nil
+}
+
+func (r *regenerateRepository) UpdateShortCode(_ context.Context, _ uuid.UUID, code string, redirectUntil *time.Time) error {
+	r.codes = append(r.codes, code)
+	if len(r.codes) <= r.conflicts {
+		return ErrShortCodeExists
+	}
+	r.redirectUntil = redirectUntil
+	return nil
+}
+
+func TestRegenerateShortCode(t *testing.T) {
+	domainID := uuid.New()
+	newRepo := func() *regenerateRepository {
+		return &regenerateRepository{url: &models.ShortenedURL{
+			ID:          uuid.New(),
+			OriginalURL: "https://example.com",
+			ShortCode:   "leaked",
+			DomainID:    &domainID,
+			Domain:      "go.example.com",
+		}}
+	}
+	newService := func(repo Repository) *Service {
+		return &Service{repo: repo, baseURL: "https://volaticus.test", codeLength: 8, alphabet: "abcdef", codeRetries: 3}
+	}
+
+	t.Run("new code on the domain of the URL", func(t *testing.T) {
+		repo := newRepo()
+		resp, err := newService(repo).RegenerateShortCode(context.Background(), repo.url.ID, uuid.New(), 0)
+		if err != nil {
+			t.Fatalf("RegenerateShortCode() error = %v", err)
+		}
+		if len(repo.codes) != 1 || resp.ShortCode != repo.codes[0] {
+			t.Errorf("RegenerateShortCode() = %q after updating %v", resp.ShortCode, repo.codes)
+		}
+		if want := "https://go.example.com/" + resp.ShortCode; resp.ShortURL != want {
+			t.Errorf("ShortURL = %q, want %q", resp.ShortURL, want)
+		}
+		if want := "https://volaticus.test/api/v1/urls/" + repo.url.ID.String(); resp.AnalyticsURL != want {
+			t.Errorf("AnalyticsURL = %q, want %q", resp.AnalyticsURL, want)
+		}
+		if repo.redirectUntil != nil {
+			t.Errorf("old code redirects until %v without a grace period", repo.redirectUntil)
+		}
+	})
+
+	t.Run("grace period", func(t *testing.T) {
+		repo := newRepo()
+		if _, err := newService(repo).RegenerateShortCode(context.Background(), repo.url.ID, uuid.New(), 24*time.Hour); err != nil {
+			t.Fatalf("RegenerateShortCode() error = %v", err)
+		}
+		if repo.redirectUntil == nil || time.Until(*repo.redirectUntil) < 23*time.Hour {
+			t.Errorf("old code redirects until %v, want in 24 hours", repo.redirectUntil)
+		}
+	})
+
+	t.Run("code taken meanwhile is replaced", func(t *testing.T) {
+		repo := newRepo()
+		repo.conflicts = 1
+		resp, err := newService(repo).RegenerateShortCode(context.Background(), repo.url.ID, uuid.New(), 0)
+		if err != nil {
+			t.Fatalf("RegenerateShortCode() error = %v", err)
+		}
+		if len(repo.codes) != 2 || resp.ShortCode != repo.codes[1] {
+			t.Errorf("RegenerateShortCode() = %q after updating %v, want the second code", resp.ShortCode, repo.codes)
+		}
+	})
+
+	t.Run("URL of another user", func(t *testing.T) {
+		repo := newRepo()
+		if _, err := newService(repo).RegenerateShortCode(context.Background(), uuid.New(), uuid.New(), 0); !errors.Is(err, ErrForbidden) {
+			t.Errorf("RegenerateShortCode() error = %v, want ErrForbidden", err)
+		}
+	})
+
+	t.Run("grace period too long", func(t *testing.T) {
+		repo := newRepo()
+		_, err := newService(repo).RegenerateShortCode(context.Background(), repo.url.ID, uuid.New(), maxCodeGracePeriod+time.Hour)
+		if !errors.Is(err, ErrInvalidGracePeriod) || len(repo.codes) != 0 {
+			t.Errorf("RegenerateShortCode() error = %v after %d updates, want ErrInvalidGracePeriod", err, len(repo.codes))
+		}
+	})
+}
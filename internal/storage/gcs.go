@@ -7,14 +7,17 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog/log"
 	"google.golang.org/api/iterator"
 
 	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 )
 
@@ -22,6 +25,8 @@ type GCSStorageProvider struct {
 	client     *storage.Client
 	bucket     *storage.BucketHandle
 	bucketName string
+	// publicURL is the base URL of publicly readable objects, empty while objects are private
+	publicURL string
 }
 
 func NewGCSStorage(projectID, bucketName string) (*GCSStorageProvider, error) {
@@ -83,7 +88,17 @@ func NewGCSStorage(projectID, bucketName string) (*GCSStorageProvider, error) {
 	}, nil
 }
 
+// MakePublic lets SetPublic make objects readable by everyone, GetURL then returns their direct URL
+// below baseURL. An empty baseURL uses the public storage.googleapis.com endpoint.
+func (g *GCSStorageProvider) MakePublic(baseURL string) {
+	if baseURL == "" {
+		baseURL = "https://storage.googleapis.com/" + g.bucketName
+	}
+	g.publicURL = strings.TrimSuffix(baseURL, "/")
+}
+
 func (g *GCSStorageProvider) Upload(ctx context.Context, file io.Reader, filename string) (string, error) {
+	// Objects start out private, SetPublic opens up those that may be read from the bucket
 	obj := g.bucket.Object(filename)
 	writer := obj.NewWriter(ctx)
 
@@ -107,22 +122,22 @@ func (g *GCSStorageProvider) Stream(ctx context.Context, filename string, w http
 		Str("filename", filename).
 		Msg("streaming file")
 
-	obj := g.bucket.Object(filename)
-	attrs, err := obj.Attrs(ctx)
+	info, err := g.Stat(ctx, filename)
 	if err != nil {
 		log.Error().
 			Err(err).
 			Str("filename", filename).
 			Msg("failed to get object attributes")
-		return fmt.Errorf("failed to get object attributes: %w", err)
+		return err
 	}
 
 	log.Debug().
 		Str("filename", filename).
-		Str("content_type", attrs.ContentType).
-		Int64("size", attrs.Size).
+		Str("content_type", info.ContentType).
+		Int64("size", info.Size).
 		Msg("retrieved object attributes")
 
+	obj := g.bucket.Object(filename)
 	reader, err := obj.NewReader(ctx)
 	if err != nil {
 		log.Error().
@@ -133,15 +148,25 @@ func (g *GCSStorageProvider) Stream(ctx context.Context, filename string, w http
 	}
 	defer reader.Close()
 
-	// Set response headers
-	w.Header().Set("Content-Type", attrs.ContentType)
-	w.Header().Set("Content-Length", strconv.FormatInt(attrs.Size, 10))
-	if attrs.CacheControl != "" {
-		w.Header().Set("Cache-Control", attrs.CacheControl)
+	// Set response headers, keeping a content type already chosen by the caller
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", info.ContentType)
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	// The caller decides how a file may be cached, e.g. signed downloads must not be stored
+	if info.CacheControl != "" && w.Header().Get("Cache-Control") == "" {
+		w.Header().Set("Cache-Control", info.CacheControl)
 	}
 
-	// Stream the file
-	bytesWritten, err := io.Copy(w, reader)
+	// Stream the file, stopping when the client disconnects
+	bytesWritten, err := io.Copy(w, newContextReader(ctx, reader))
+	if errors.Is(err, context.Canceled) {
+		log.Debug().
+			Str("filename", filename).
+			Int64("bytes_written", bytesWritten).
+			Msg("client cancelled file stream")
+		return err
+	}
 	if err != nil {
 		log.Error().
 			Err(err).
@@ -159,6 +184,47 @@ func (g *GCSStorageProvider) Stream(ctx context.Context, filename string, w http
 	return nil
 }
 
+// Stat reads the object attributes
+func (g *GCSStorageProvider) Stat(ctx context.Context, filename string) (FileInfo, error) {
+	attrs, err := g.bucket.Object(filename).Attrs(ctx)
+	if err != nil {
+		return FileInfo{}, fmt.Errorf("failed to get object attributes: %w", err)
+	}
+	return objectInfo(attrs), nil
+}
+
+// SetPublic grants or revokes read access of all users to the object. It needs fine-grained
+// access control, buckets with uniform bucket-level access reject object ACLs.
+func (g *GCSStorageProvider) SetPublic(ctx context.Context, filename string, public bool) error {
+	if g.publicURL == "" {
+		return nil
+	}
+	acl := g.bucket.Object(filename).ACL()
+	if public {
+		if err := acl.Set(ctx, storage.AllUsers, storage.RoleReader); err != nil {
+			return fmt.Errorf("failed to make object public: %w", err)
+		}
+		return nil
+	}
+	// Deleting an entry that isn't there fails with 404, the object is private then already
+	var apiErr *googleapi.Error
+	if err := acl.Delete(ctx, storage.AllUsers); err != nil && !(errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound) {
+		return fmt.Errorf("failed to make object private: %w", err)
+	}
+	return nil
+}
+
+// objectInfo converts the attributes of an object
+func objectInfo(attrs *storage.ObjectAttrs) FileInfo {
+	return FileInfo{
+		Name:         attrs.Name,
+		Size:         attrs.Size,
+		ContentType:  attrs.ContentType,
+		ModifiedTime: attrs.Updated,
+		CacheControl: attrs.CacheControl,
+	}
+}
+
 func (g *GCSStorageProvider) Exists(ctx context.Context, filename string) (bool, error) {
 	obj := g.bucket.Object(filename)
 
@@ -189,6 +255,11 @@ func (g *GCSStorageProvider) GetURL(ctx context.Context, filename string) (strin
 		Str("filename", filename).
 		Msg("getting URL")
 
+	// Public objects are fetched from the bucket directly, no need to look them up first
+	if g.publicURL != "" {
+		return g.publicURL + "/" + (&url.URL{Path: filename}).EscapedPath(), 0, nil
+	}
+
 	// This currently only works with files that are stored as unixtime.ext
 
 	// Ensure the file exists in the bucket
@@ -208,14 +279,14 @@ func (g *GCSStorageProvider) GetURL(ctx context.Context, filename string) (strin
 		Msg("object exists in bucket")
 
 	baseURL := os.Getenv("BASE_URL")
-	url := fmt.Sprintf("%s/f/%s", baseURL, filename)
+	proxyURL := fmt.Sprintf("%s/f/%s", baseURL, filename)
 
 	log.Debug().
 		Str("filename", filename).
-		Str("url", url).
+		Str("url", proxyURL).
 		Msg("constructed URL")
 
-	return url, 0, nil
+	return proxyURL, 0, nil
 }
 
 func (g *GCSStorageProvider) ListFiles(ctx context.Context, prefix string) ([]FileInfo, error) {
@@ -240,12 +311,7 @@ func (g *GCSStorageProvider) ListFiles(ctx context.Context, prefix string) ([]Fi
 				Msg("error iterating objects")
 			return nil, fmt.Errorf("error iterating objects: %w", err)
 		}
-		files = append(files, FileInfo{
-			Name:         attrs.Name,
-			Size:         attrs.Size,
-			ContentType:  attrs.ContentType,
-			ModifiedTime: attrs.Updated,
-		})
+		files = append(files, objectInfo(attrs))
 	}
 
 	log.Debug().
@@ -256,6 +322,14 @@ func (g *GCSStorageProvider) ListFiles(ctx context.Context, prefix string) ([]Fi
 	return files, nil
 }
 
+// Health fetches the bucket attributes, a cheap request failing if the bucket is unreachable
+func (g *GCSStorageProvider) Health(ctx context.Context) error {
+	if _, err := g.bucket.Attrs(ctx); err != nil {
+		return fmt.Errorf("bucket %s unreachable: %w", g.bucketName, err)
+	}
+	return nil
+}
+
 func (g *GCSStorageProvider) Close() error {
 	return g.client.Close()
 }
@@ -8,35 +8,98 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
 )
 
+// shardWidth is the number of filename characters per shard directory
+const shardWidth = 2
+
+// healthWriteInterval is how often Health checks the upload directory is writable, the probes
+// in between reuse the result
+const healthWriteInterval = time.Minute
+
 type LocalStorageProvider struct {
-	baseDir string
-	baseURL string
+	baseDir    string
+	baseURL    string
+	shardDepth int
+
+	healthMu      sync.Mutex
+	healthChecked time.Time
+	healthErr     error
 }
 
-func NewLocalStorage(baseDir, baseURL string) (*LocalStorageProvider, error) {
+// NewLocalStorage creates a provider storing files below baseDir. With a shardDepth > 0 files are
+// spread over nested directories named after the leading characters of the filename.
+func NewLocalStorage(baseDir, baseURL string, shardDepth int) (*LocalStorageProvider, error) {
 	if err := os.MkdirAll(baseDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create upload directory: %w", err)
 	}
 
 	return &LocalStorageProvider{
-		baseDir: baseDir,
-		baseURL: baseURL,
+		baseDir:    baseDir,
+		baseURL:    baseURL,
+		shardDepth: shardDepth,
 	}, nil
 }
 
+// shardDir returns the relative directory a file is stored in, e.g. "ab/cd" for "abcd-123.png".
+// Names too short or with characters unsuitable for directory names are not sharded.
+func (l *LocalStorageProvider) shardDir(filename string) string {
+	n := l.shardDepth * shardWidth
+	if n == 0 || len(filename) <= n {
+		return ""
+	}
+
+	parts := make([]string, 0, l.shardDepth)
+	for i := 0; i < n; i += shardWidth {
+		part := strings.ToLower(filename[i : i+shardWidth])
+		for _, c := range part {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+				return ""
+			}
+		}
+		parts = append(parts, part)
+	}
+	return filepath.Join(parts...)
+}
+
+// path returns the location of a file on disk. Files stored before sharding
+// was enabled are still found at their flat location.
+func (l *LocalStorageProvider) path(filename string) string {
+	sharded := filepath.Join(l.baseDir, l.shardDir(filename), filename)
+	if l.shardDepth == 0 {
+		return sharded
+	}
+
+	if _, err := os.Stat(sharded); os.IsNotExist(err) {
+		flat := filepath.Join(l.baseDir, filename)
+		if _, err := os.Stat(flat); err == nil {
+			return flat
+		}
+	}
+	return sharded
+}
+
 func (l *LocalStorageProvider) Upload(ctx context.Context, file io.Reader, filename string) (string, error) {
-	fullPath := filepath.Join(l.baseDir, filename)
+	fullPath := filepath.Join(l.baseDir, l.shardDir(filename), filename)
 
 	log.Debug().
 		Str("path", fullPath).
 		Str("filename", filename).
 		Msg("uploading file to local storage")
 
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		log.Error().
+			Err(err).
+			Str("path", fullPath).
+			Msg("failed to create shard directory")
+		return "", fmt.Errorf("failed to create shard directory: %w", err)
+	}
+
 	dst, err := os.Create(fullPath)
 	if err != nil {
 		log.Error().
@@ -63,38 +126,36 @@ func (l *LocalStorageProvider) Upload(ctx context.Context, file io.Reader, filen
 }
 
 func (l *LocalStorageProvider) Stream(ctx context.Context, filename string, w http.ResponseWriter) error {
-	fullPath := filepath.Join(l.baseDir, filename)
+	fullPath := l.path(filename)
 	file, err := os.Open(fullPath)
 	if err != nil {
 		return fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 
-	// Get file info for content type detection
-	fileInfo, err := file.Stat()
+	info, err := statFile(file, filename)
 	if err != nil {
-		return fmt.Errorf("failed to get file info: %w", err)
+		return err
 	}
-
-	// Detect content type
-	buffer := make([]byte, 512)
-	_, err = file.Read(buffer)
-	if err != nil && err != io.EOF {
-		return fmt.Errorf("failed to read file header: %w", err)
+	// Reset file pointer after sniffing the content type
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to reset file pointer: %w", err)
 	}
-	contentType := http.DetectContentType(buffer)
 
-	// Reset file pointer after reading header
-	if _, err := file.Seek(0, 0); err != nil {
-		return fmt.Errorf("failed to reset file pointer: %w", err)
+	// Only use the sniffed content type if the caller didn't decide on one,
+	// sniffing must not override the type the handler chose to sandbox
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", info.ContentType)
 	}
 
 	// Set response headers
-	w.Header().Set("Content-Type", contentType)
-	w.Header().Set("Content-Length", strconv.FormatInt(fileInfo.Size(), 10))
-	w.Header().Set("Cache-Control", "public, max-age=86400") // 24 hours cache
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	if w.Header().Get("Cache-Control") == "" {
+		w.Header().Set("Cache-Control", "public, max-age=86400") // 24 hours cache
+	}
 
-	// Stream the file
+	// Copy the bare file so the response writer can send it with sendfile, a client that went
+	// away fails the next write and ends the copy
 	if _, err := io.Copy(w, file); err != nil {
 		return fmt.Errorf("failed to stream file: %w", err)
 	}
@@ -102,8 +163,45 @@ func (l *LocalStorageProvider) Stream(ctx context.Context, filename string, w ht
 	return nil
 }
 
+// Stat reads the file info and sniffs the content type from the first bytes
+func (l *LocalStorageProvider) Stat(ctx context.Context, filename string) (FileInfo, error) {
+	file, err := os.Open(l.path(filename))
+	if err != nil {
+		return FileInfo{}, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+	return statFile(file, filename)
+}
+
+// statFile describes an open file under the given name, reading up to 512 bytes to detect its
+// content type
+func statFile(file *os.File, name string) (FileInfo, error) {
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return FileInfo{}, fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	buffer := make([]byte, 512)
+	n, err := file.Read(buffer)
+	if err != nil && err != io.EOF {
+		return FileInfo{}, fmt.Errorf("failed to read file header: %w", err)
+	}
+
+	return FileInfo{
+		Name:         name,
+		Size:         fileInfo.Size(),
+		ContentType:  http.DetectContentType(buffer[:n]),
+		ModifiedTime: fileInfo.ModTime(),
+	}, nil
+}
+
+// SetPublic does nothing, local files are only served through the app
+func (l *LocalStorageProvider) SetPublic(ctx context.Context, filename string, public bool) error {
+	return nil
+}
+
 func (l *LocalStorageProvider) Exists(ctx context.Context, filename string) (bool, error) {
-	fullPath := filepath.Join(l.baseDir, filename)
+	fullPath := l.path(filename)
 
 	log.Debug().
 		Str("path", fullPath).
@@ -131,7 +229,7 @@ func (l *LocalStorageProvider) Exists(ctx context.Context, filename string) (boo
 }
 
 func (l *LocalStorageProvider) Delete(ctx context.Context, filename string) error {
-	fullPath := filepath.Join(l.baseDir, filename)
+	fullPath := l.path(filename)
 
 	log.Debug().
 		Str("path", fullPath).
@@ -188,6 +286,14 @@ func (l *LocalStorageProvider) ListFiles(ctx context.Context, prefix string) ([]
 			return fmt.Errorf("failed to get relative path: %w", err)
 		}
 
+		// Report sharded files under their logical name
+		if dir := filepath.Dir(relPath); dir != "." && dir == l.shardDir(info.Name()) {
+			relPath, err = filepath.Rel(filepath.Join(l.baseDir, dir), path)
+			if err != nil {
+				return fmt.Errorf("failed to get relative path: %w", err)
+			}
+		}
+
 		file, err := os.Open(path)
 		if err != nil {
 			log.Error().
@@ -198,23 +304,15 @@ func (l *LocalStorageProvider) ListFiles(ctx context.Context, prefix string) ([]
 		}
 		defer file.Close()
 
-		buffer := make([]byte, 512)
-		_, err = file.Read(buffer)
-		if err != nil && err != io.EOF {
+		fileInfo, err := statFile(file, relPath)
+		if err != nil {
 			log.Error().
 				Err(err).
 				Str("path", path).
 				Msg("failed to read file header")
-			return fmt.Errorf("failed to read file header: %w", err)
+			return err
 		}
-		contentType := http.DetectContentType(buffer)
-
-		files = append(files, FileInfo{
-			Name:         relPath,
-			Size:         info.Size(),
-			ContentType:  contentType,
-			ModifiedTime: info.ModTime(),
-		})
+		files = append(files, fileInfo)
 
 		return nil
 	})
@@ -235,6 +333,44 @@ func (l *LocalStorageProvider) ListFiles(ctx context.Context, prefix string) ([]
 	return files, nil
 }
 
+// Health checks the upload directory exists on every probe, and that it is writable by writing
+// and removing a temporary file at most once per healthWriteInterval
+func (l *LocalStorageProvider) Health(ctx context.Context) error {
+	info, err := os.Stat(l.baseDir)
+	if err != nil {
+		return fmt.Errorf("upload directory unavailable: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("upload path %s is not a directory", l.baseDir)
+	}
+
+	l.healthMu.Lock()
+	defer l.healthMu.Unlock()
+	if time.Since(l.healthChecked) < healthWriteInterval {
+		return l.healthErr
+	}
+	l.healthErr = l.checkWritable()
+	l.healthChecked = time.Now()
+	return l.healthErr
+}
+
+// checkWritable writes and removes a temporary file in the upload directory
+func (l *LocalStorageProvider) checkWritable() error {
+	f, err := os.CreateTemp(l.baseDir, ".health-*")
+	if err != nil {
+		return fmt.Errorf("upload directory not writable: %w", err)
+	}
+	name := f.Name()
+	if err := f.Close(); err != nil {
+		os.Remove(name)
+		return fmt.Errorf("closing health check file: %w", err)
+	}
+	if err := os.Remove(name); err != nil {
+		return fmt.Errorf("removing health check file: %w", err)
+	}
+	return nil
+}
+
 func (l *LocalStorageProvider) Close() error {
 	return nil
 }
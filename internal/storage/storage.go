@@ -13,6 +13,7 @@ type FileInfo struct {
 	Size         int64
 	ContentType  string
 	ModifiedTime time.Time
+	CacheControl string // Stored with GCS objects, empty for local files
 }
 
 // StorageProvider defines the interface for different storage implementations
@@ -32,8 +33,18 @@ type StorageProvider interface {
 	// Exists checks if a file exists in storage
 	Exists(ctx context.Context, filename string) (bool, error)
 
+	// Stat returns the size, content type and modification time of a file without reading all of it
+	Stat(ctx context.Context, filename string) (FileInfo, error)
+
+	// SetPublic makes a file readable by everyone at the URL of GetURL, or takes that access away.
+	// Providers without public objects ignore it.
+	SetPublic(ctx context.Context, filename string, public bool) error
+
 	ListFiles(ctx context.Context, prefix string) ([]FileInfo, error)
 
+	// Health checks that the storage is reachable and writable
+	Health(ctx context.Context) error
+
 	// Close cleans up any resources
 	Close() error
 }
@@ -44,22 +55,50 @@ type StorageConfig struct {
 	Provider string `json:"provider"`
 
 	// Local storage config
-	LocalPath string `json:"local_path,omitempty"`
-	BaseURL   string `json:"base_url,omitempty"`
+	LocalPath  string `json:"local_path,omitempty"`
+	BaseURL    string `json:"base_url,omitempty"`
+	ShardDepth int    `json:"shard_depth,omitempty"`
 
 	// GCS config
-	ProjectID  string `json:"project_id,omitempty"`
-	BucketName string `json:"bucket_name,omitempty"`
+	ProjectID     string `json:"project_id,omitempty"`
+	BucketName    string `json:"bucket_name,omitempty"`
+	PublicObjects bool   `json:"public_objects,omitempty"`
+	PublicURL     string `json:"public_url,omitempty"`
 }
 
 // NewStorageProvider creates a storage provider based on configuration
 func NewStorageProvider(cfg StorageConfig) (StorageProvider, error) {
 	switch cfg.Provider {
 	case "local":
-		return NewLocalStorage(cfg.LocalPath, cfg.BaseURL)
+		return NewLocalStorage(cfg.LocalPath, cfg.BaseURL, cfg.ShardDepth)
 	case "gcs":
-		return NewGCSStorage(cfg.ProjectID, cfg.BucketName)
+		gcs, err := NewGCSStorage(cfg.ProjectID, cfg.BucketName)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.PublicObjects {
+			gcs.MakePublic(cfg.PublicURL)
+		}
+		return gcs, nil
 	default:
 		return nil, fmt.Errorf("unsupported storage provider: %s", cfg.Provider)
 	}
 }
+
+// contextReader stops reading once the context is done, so copying a file to a
+// client that went away ends at the next chunk instead of running to the end
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func newContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return &contextReader{ctx: ctx, r: r}
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
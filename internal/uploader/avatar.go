@@ -0,0 +1,128 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// avatarMaxSize caps profile pictures below the upload limit, they are only shown as small icons
+	avatarMaxSize = 2 << 20
+	// avatarPrefix starts the storage key of every profile picture
+	avatarPrefix = "avatar-"
+)
+
+// avatarTypes are the image types accepted as profile pictures with the extension they are stored
+// under. SVG is left out as it can carry scripts.
+var avatarTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// avatarKey returns a new storage key for a profile picture of the user. Every upload gets its
+// own key, so a replaced picture is never served from the old object.
+func avatarKey(userID uuid.UUID, ext string) string {
+	return fmt.Sprintf("%s%s-%d%s", avatarPrefix, userID, time.Now().UnixNano(), ext)
+}
+
+// SetAvatar validates an image like an upload and stores it as the profile picture of the user,
+// the previous picture is deleted
+func (s *service) SetAvatar(ctx context.Context, userID uuid.UUID, file multipart.File, header *multipart.FileHeader) error {
+	maxSize := min(int64(avatarMaxSize), s.config.UploadMaxSize)
+	if header.Size > maxSize {
+		return fmt.Errorf("%w (max %s)", ErrFileTooLarge, formatSize(maxSize))
+	}
+
+	contentType, err := detectContentType(file, header.Filename, nil)
+	if err != nil {
+		return fmt.Errorf("reading avatar: %w", err)
+	}
+	ext, ok := avatarTypes[contentType]
+	if !ok {
+		return ErrInvalidAvatar
+	}
+	if s.config.ImageMaxPixels > 0 {
+		if err := checkImageDimensions(file, s.config.ImageMaxPixels); err != nil {
+			return err
+		}
+	}
+
+	if err := s.scanner.Scan(ctx, file); err != nil {
+		if errors.Is(err, ErrInfected) {
+			log.Warn().
+				Err(err).
+				Str("user_id", userID.String()).
+				Msg("rejected infected avatar")
+			return err
+		}
+		return fmt.Errorf("scanning avatar: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("resetting avatar after scan: %w", err)
+	}
+
+	previous, err := s.repo.GetAvatarKey(ctx, userID)
+	if err != nil && !errors.Is(err, ErrNoAvatar) {
+		return err
+	}
+
+	key := avatarKey(userID, ext)
+	if _, err := s.storage.Upload(ctx, file, key); err != nil {
+		return fmt.Errorf("saving avatar to storage: %w", err)
+	}
+	if err := s.repo.SetAvatarKey(ctx, userID, &key); err != nil {
+		s.deleteObject(ctx, key)
+		return fmt.Errorf("saving avatar: %w", err)
+	}
+	if previous != "" {
+		s.deleteObject(ctx, previous)
+	}
+
+	log.Info().
+		Str("user_id", userID.String()).
+		Str("key", key).
+		Msg("avatar updated")
+	return nil
+}
+
+// ServeAvatar streams the profile picture of the user, ErrNoAvatar if they have none
+func (s *service) ServeAvatar(ctx context.Context, w http.ResponseWriter, userID uuid.UUID) error {
+	key, err := s.repo.GetAvatarKey(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", mime.TypeByExtension(path.Ext(key)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// The URL stays the same when the picture is replaced
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	return s.storage.Stream(ctx, key, w)
+}
+
+// deleteAvatar removes the profile picture of a user whose account is deleted
+func (s *service) deleteAvatar(ctx context.Context, userID uuid.UUID) error {
+	key, err := s.repo.GetAvatarKey(ctx, userID)
+	if errors.Is(err, ErrNoAvatar) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.repo.SetAvatarKey(ctx, userID, nil); err != nil {
+		return err
+	}
+	s.deleteObject(ctx, key)
+	return nil
+}
@@ -0,0 +1,144 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"strings"
+	"testing"
+	"volaticus-go/internal/config"
+	"volaticus-go/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// avatarFile is an in-memory form file
+type avatarFile struct {
+	*bytes.Reader
+}
+
+func (avatarFile) Close() error { return nil }
+
+func newAvatarFile(content []byte, name string) (multipart.File, *multipart.FileHeader) {
+	return avatarFile{bytes.NewReader(content)}, &multipart.FileHeader{Filename: name, Size: int64(len(content))}
+}
+
+// avatarStorage keeps uploaded objects in memory and records deletions
+type avatarStorage struct {
+	storage.StorageProvider
+	objects map[string][]byte
+	deleted []string
+}
+
+func (s *avatarStorage) Upload(_ context.Context, file io.Reader, name string) (string, error) {
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
+	s.objects[name] = content
+	return name, nil
+}
+
+func (s *avatarStorage) Delete(_ context.Context, name string) error {
+	s.deleted = append(s.deleted, name)
+	delete(s.objects, name)
+	return nil
+}
+
+// avatarRepository stores the avatar keys of users
+type avatarRepository struct {
+	Repository
+	keys map[uuid.UUID]string
+}
+
+func (r *avatarRepository) GetAvatarKey(_ context.Context, userID uuid.UUID) (string, error) {
+	key, ok := r.keys[userID]
+	if !ok {
+		return "", ErrNoAvatar
+	}
+	return key, nil
+}
+
+func (r *avatarRepository) SetAvatarKey(_ context.Context, userID uuid.UUID, key *string) error {
+	if key == nil {
+		delete(r.keys, userID)
+	} else {
+		r.keys[userID] = *key
+	}
+	return nil
+}
+
+func TestSetAvatar(t *testing.T) {
+	store := &avatarStorage{objects: make(map[string][]byte)}
+	repo := &avatarRepository{keys: make(map[uuid.UUID]string)}
+	s := &service{
+		repo:    repo,
+		storage: store,
+		config:  &config.Config{UploadMaxSize: 1 << 30, ImageMaxPixels: 10000},
+		scanner: noopScanner{},
+	}
+	userID := uuid.New()
+	image := mustRead(t, encodePNG(t, 10, 10))
+
+	file, header := newAvatarFile(image, "me.png")
+	if err := s.SetAvatar(context.Background(), userID, file, header); err != nil {
+		t.Fatalf("SetAvatar() error = %v", err)
+	}
+	first := repo.keys[userID]
+	if !strings.HasPrefix(first, avatarPrefix+userID.String()) || !strings.HasSuffix(first, ".png") {
+		t.Errorf("avatar key = %q", first)
+	}
+	if !bytes.Equal(store.objects[first], image) {
+		t.Error("stored avatar differs from the upload")
+	}
+
+	// Replacing the picture deletes the previous object
+	file, header = newAvatarFile(image, "again.png")
+	if err := s.SetAvatar(context.Background(), userID, file, header); err != nil {
+		t.Fatalf("SetAvatar() replacing error = %v", err)
+	}
+	if repo.keys[userID] == first || len(store.deleted) != 1 || store.deleted[0] != first {
+		t.Errorf("key = %q, deleted = %v, want the first avatar deleted", repo.keys[userID], store.deleted)
+	}
+
+	tests := []struct {
+		name    string
+		content []byte
+		file    string
+		want    error
+	}{
+		{name: "svg", content: []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`), file: "me.svg", want: ErrInvalidAvatar},
+		{name: "text", content: []byte("hello"), file: "me.txt", want: ErrInvalidAvatar},
+		{name: "too many pixels", content: mustRead(t, encodePNG(t, 101, 100)), file: "big.png", want: ErrImageTooLarge},
+		{name: "too large", content: append(append([]byte{}, image...), make([]byte, avatarMaxSize)...), file: "huge.png", want: ErrFileTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, header := newAvatarFile(tt.content, tt.file)
+			if err := s.SetAvatar(context.Background(), userID, file, header); !errors.Is(err, tt.want) {
+				t.Errorf("SetAvatar() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+	if len(store.objects) != 1 {
+		t.Errorf("rejected avatars were stored, objects = %d", len(store.objects))
+	}
+
+	if err := s.deleteAvatar(context.Background(), userID); err != nil {
+		t.Fatalf("deleteAvatar() error = %v", err)
+	}
+	if _, ok := repo.keys[userID]; ok || len(store.objects) != 0 {
+		t.Error("avatar kept after deleting it")
+	}
+}
+
+func mustRead(t *testing.T, r io.Reader) []byte {
+	t.Helper()
+	content, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading: %v", err)
+	}
+	return content
+}
@@ -0,0 +1,52 @@
+package uploader
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// publicCacheControl returns the Cache-Control header of publicly served files. Caches never keep
+// a file beyond its expiry, a max age of zero makes clients revalidate on every request.
+func publicCacheControl(maxAge time.Duration, expiresAt *time.Time, now time.Time) string {
+	if expiresAt != nil {
+		maxAge = min(maxAge, expiresAt.Sub(now))
+	}
+	if maxAge < time.Second {
+		return "no-cache"
+	}
+	return fmt.Sprintf("public, max-age=%d", int64(maxAge/time.Second))
+}
+
+// wantsRevalidation reports whether the client asked to bypass cached copies, in which case
+// the full response is sent even if its ETag matches
+func wantsRevalidation(r *http.Request) bool {
+	for _, directive := range strings.Split(r.Header.Get("Cache-Control"), ",") {
+		if d := strings.ToLower(strings.TrimSpace(directive)); d == "no-cache" || d == "max-age=0" {
+			return true
+		}
+	}
+	return r.Header.Get("Cache-Control") == "" && strings.EqualFold(r.Header.Get("Pragma"), "no-cache")
+}
+
+// notModified reports whether the copy cached by the client is still current, so a 304 can be sent.
+// If-None-Match is more precise and takes precedence over If-Modified-Since, which only applies to
+// GET and HEAD. Neither is honored when the client asked to revalidate.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if wantsRevalidation(r) {
+		return false
+	}
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		return match == etag
+	}
+	if lastModified.IsZero() || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	// HTTP dates have no fractional seconds
+	return !lastModified.Truncate(time.Second).After(since)
+}
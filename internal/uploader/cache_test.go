@@ -0,0 +1,64 @@
+package uploader
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPublicCacheControl(t *testing.T) {
+	now := time.Now()
+	soon := now.Add(90 * time.Second)
+	expired := now.Add(-time.Minute)
+
+	tests := []struct {
+		name      string
+		maxAge    time.Duration
+		expiresAt *time.Time
+		want      string
+	}{
+		{"never expiring", 24 * time.Hour, nil, "public, max-age=86400"},
+		{"clamped to expiry", 24 * time.Hour, &soon, "public, max-age=90"},
+		{"already expired", 24 * time.Hour, &expired, "no-cache"},
+		{"caching disabled", 0, nil, "no-cache"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := publicCacheControl(tt.maxAge, tt.expiresAt, now); got != tt.want {
+				t.Errorf("publicCacheControl() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWantsRevalidation(t *testing.T) {
+	tests := []struct {
+		name         string
+		cacheControl string
+		pragma       string
+		want         bool
+	}{
+		{"no headers", "", "", false},
+		{"no-cache", "no-cache", "", true},
+		{"max-age=0 among directives", "max-stale, Max-Age=0", "", true},
+		{"other directives", "max-age=600", "", false},
+		{"legacy pragma", "", "no-cache", true},
+		{"cache-control wins over pragma", "max-age=600", "no-cache", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/f/file.png", nil)
+			if tt.cacheControl != "" {
+				r.Header.Set("Cache-Control", tt.cacheControl)
+			}
+			if tt.pragma != "" {
+				r.Header.Set("Pragma", tt.pragma)
+			}
+			if got := wantsRevalidation(r); got != tt.want {
+				t.Errorf("wantsRevalidation() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
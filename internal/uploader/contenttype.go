@@ -0,0 +1,52 @@
+package uploader
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLen is the number of bytes http.DetectContentType considers
+const sniffLen = 512
+
+// detectContentType sniffs the content type from the start of the file and rewinds it.
+// Sniffing only knows a few formats, so the extension of the file name is used when the
+// content is unrecognized binary, or to refine plain text to a more specific text type.
+// Types in overrides win over the system types of their extension, even binary types for text.
+func detectContentType(file io.ReadSeeker, filename string, overrides map[string]string) (string, error) {
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	contentType := http.DetectContentType(buf[:n])
+	isBinary := contentType == "application/octet-stream"
+	if !isBinary && !strings.HasPrefix(contentType, "text/plain") {
+		return contentType, nil
+	}
+
+	ext := strings.ToLower(filepath.Ext(filename))
+	if override, ok := overrides[ext]; ok {
+		return override, nil
+	}
+
+	byExtension := mime.TypeByExtension(ext)
+	switch {
+	case byExtension == "":
+		return contentType, nil
+	case isBinary:
+		return byExtension, nil
+	case strings.HasPrefix(byExtension, "text/"):
+		return byExtension, nil
+	default:
+		// Text content declared as a binary type keeps the sniffed type
+		return contentType, nil
+	}
+}
@@ -0,0 +1,86 @@
+package uploader
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDetectContentType(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		content  string
+		want     string
+	}{
+		{"short text file", "notes", "hi", "text/plain; charset=utf-8"},
+		{"empty file", "empty", "", "text/plain; charset=utf-8"},
+		{"png signature", "image.bin", "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 600), "image/png"},
+		{"text refined by extension", "style.css", "body { color: red }", "text/css; charset=utf-8"},
+		{"unknown binary falls back to extension", "module.wasm", "\x01\x02\x03\x00", "application/wasm"},
+		{"unknown binary without extension", "blob", "\x01\x02\x03\x00", "application/octet-stream"},
+		{"text keeps type for binary extension", "data.wasm", "plain words", "text/plain; charset=utf-8"},
+		{"extension is case insensitive", "STYLE.CSS", "body {}", "text/css; charset=utf-8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := strings.NewReader(tt.content)
+			got, err := detectContentType(file, tt.filename, nil)
+			if err != nil {
+				t.Fatalf("detectContentType() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("detectContentType() = %q, want %q", got, tt.want)
+			}
+
+			// The file is rewound for the upload
+			rest, _ := io.ReadAll(file)
+			if string(rest) != tt.content {
+				t.Error("file was not rewound")
+			}
+		})
+	}
+}
+
+func TestDetectContentTypeOverrides(t *testing.T) {
+	overrides := map[string]string{
+		".md":   "text/markdown; charset=utf-8",
+		".csv":  "text/csv; charset=utf-8",
+		".json": "application/json",
+		".yml":  "application/yaml",
+		".toml": "application/toml",
+		".go":   "text/x-go; charset=utf-8",
+		".ts":   "text/x-typescript; charset=utf-8",
+	}
+
+	tests := []struct {
+		name     string
+		filename string
+		content  string
+		want     string
+	}{
+		{"markdown", "README.md", "# Title\n\nSome *text*", "text/markdown; charset=utf-8"},
+		{"csv", "export.CSV", "id,name\n1,alice\n", "text/csv; charset=utf-8"},
+		{"json", "package.json", `{"name": "app"}`, "application/json"},
+		{"yaml", "compose.yml", "services:\n  app: {}\n", "application/yaml"},
+		{"toml", "Cargo.toml", "[package]\nname = \"app\"\n", "application/toml"},
+		{"go source", "main.go", "package main\n", "text/x-go; charset=utf-8"},
+		{"override replaces the system type", "app.ts", "const a: number = 1\n", "text/x-typescript; charset=utf-8"},
+		{"sniffed formats are kept", "image.md", "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 600), "image/png"},
+		{"html is not relabeled", "page.md", "<!DOCTYPE html><script>alert(1)</script>", "text/html; charset=utf-8"},
+		{"no override", "notes.txt", "hello", "text/plain; charset=utf-8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := detectContentType(strings.NewReader(tt.content), tt.filename, overrides)
+			if err != nil {
+				t.Fatalf("detectContentType() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("detectContentType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package uploader
 
 import (
 	"errors"
+	"fmt"
 )
 
 var (
@@ -14,4 +15,21 @@ var (
 	ErrFileTooLarge      = errors.New("file exceeds maximum allowed size")
 	ErrInvalidURLType    = errors.New("invalid URL type")
 	ErrUnauthorized      = errors.New("unauthorized")
+	ErrInvalidExpiration = errors.New("invalid expiration")
+	ErrInfected          = errors.New("file is infected")
+	ErrValidationFailed  = errors.New("file validation failed")
+	ErrQuotaExceeded     = errors.New("upload would exceed your storage quota")
+	ErrFileLimitReached  = errors.New("upload would exceed your file limit")
+	ErrTooManyFiles      = errors.New("too many files in one upload")
+	ErrFileExpired       = errors.New("file has expired")
+	ErrNoFilename        = errors.New("X-Filename or Content-Type header required")
+	ErrImageTooLarge     = errors.New("image dimensions exceed the limit")
+	ErrInvalidVisibility = errors.New("visibility must be public or private")
+	ErrStorageMissing    = fmt.Errorf("%w: file is missing in storage", ErrNoRows)
+	ErrNoAvatar          = fmt.Errorf("%w: user has no avatar", ErrNoRows)
+	ErrInvalidAvatar     = errors.New("avatar must be a PNG, JPEG, GIF or WebP image")
+	ErrFolderNotFound    = errors.New("folder not found")
+	ErrFolderExists      = errors.New("a folder with this name already exists here")
+	ErrFolderNotEmpty    = errors.New("folder still has files or folders")
+	ErrInvalidFolderName = errors.New("folder names need 1 to 100 characters without slashes")
 )
@@ -0,0 +1,55 @@
+package uploader
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseExpiresIn parses a requested file lifetime such as "12h", "7d" or "never".
+// An empty value returns nil so the configured default is used, "never" and "0" return a zero duration.
+func parseExpiresIn(value string) (*time.Duration, error) {
+	value = strings.TrimSpace(strings.ToLower(value))
+	if value == "" {
+		return nil, nil
+	}
+
+	var d time.Duration
+	switch {
+	case value == "never" || value == "0":
+		d = 0
+	case strings.HasSuffix(value, "d"):
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil || days <= 0 {
+			return nil, ErrInvalidExpiration
+		}
+		d = time.Duration(days) * 24 * time.Hour
+	default:
+		var err error
+		d, err = time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, ErrInvalidExpiration
+		}
+	}
+
+	return &d, nil
+}
+
+// expiresAt resolves the expiration timestamp of a new upload. A nil lifetime uses the
+// default, a zero lifetime never expires. Both are clamped to max when it is set.
+func expiresAt(now time.Time, requested *time.Duration, def, max time.Duration) *time.Time {
+	lifetime := def
+	if requested != nil {
+		lifetime = *requested
+	}
+
+	if max > 0 && (lifetime == 0 || lifetime > max) {
+		lifetime = max
+	}
+	if lifetime == 0 {
+		return nil
+	}
+
+	t := now.Add(lifetime)
+	return &t
+}
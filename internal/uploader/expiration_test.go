@@ -0,0 +1,73 @@
+package uploader
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseExpiresIn(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    *time.Duration
+		wantErr bool
+	}{
+		{value: "", want: nil},
+		{value: "never", want: ptr(time.Duration(0))},
+		{value: "0", want: ptr(time.Duration(0))},
+		{value: "90m", want: ptr(90 * time.Minute)},
+		{value: "7d", want: ptr(7 * 24 * time.Hour)},
+		{value: "-1h", wantErr: true},
+		{value: "0d", wantErr: true},
+		{value: "soon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseExpiresIn(tt.value)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidExpiration) {
+					t.Fatalf("parseExpiresIn(%q) error = %v, want ErrInvalidExpiration", tt.value, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseExpiresIn(%q) unexpected error: %v", tt.value, err)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("parseExpiresIn(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpiresAt(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	def := 24 * time.Hour
+
+	tests := []struct {
+		name      string
+		requested *time.Duration
+		max       time.Duration
+		want      *time.Time
+	}{
+		{name: "default", want: ptr(now.Add(def))},
+		{name: "custom", requested: ptr(time.Hour), want: ptr(now.Add(time.Hour))},
+		{name: "never", requested: ptr(time.Duration(0)), want: nil},
+		{name: "clamped", requested: ptr(30 * 24 * time.Hour), max: 7 * 24 * time.Hour, want: ptr(now.Add(7 * 24 * time.Hour))},
+		{name: "never clamped", requested: ptr(time.Duration(0)), max: 48 * time.Hour, want: ptr(now.Add(48 * time.Hour))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := expiresAt(now, tt.requested, def, tt.max)
+			if (got == nil) != (tt.want == nil) || (got != nil && !got.Equal(*tt.want)) {
+				t.Errorf("expiresAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,153 @@
+package uploader
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Strategies for naming the stored object of an upload
+const (
+	FilenameTimestamp = "timestamp" // <4 random chars>-<unix nanoseconds><ext>
+	FilenameUUID      = "uuid"      // <uuid><ext>
+	FilenameHash      = "hash"      // <content hash prefix>-<random suffix><ext>
+)
+
+// compoundExtensions are multi part extensions that only make sense as a whole
+var compoundExtensions = []string{
+	".tar.gz", ".tar.bz2", ".tar.xz", ".tar.zst", ".tar.lz", ".tar.z",
+	".min.js", ".min.css", ".min.map", ".d.ts",
+}
+
+// fileExtension returns the extension of a file name including compound extensions like
+// ".tar.gz", keeping the original case. Dotfiles like ".env" have no extension.
+func fileExtension(name string) string {
+	name = filepath.Base(name)
+	lower := strings.ToLower(name)
+	for _, compound := range compoundExtensions {
+		if strings.HasSuffix(lower, compound) && len(name) > len(compound) {
+			return name[len(name)-len(compound):]
+		}
+	}
+
+	ext := filepath.Ext(name)
+	if ext == name {
+		return ""
+	}
+	return ext
+}
+
+// filenameGenerator returns the unique storage name of an upload with the given extension.
+// It may read the file but must leave it rewound.
+type filenameGenerator func(file io.ReadSeeker, ext string) (string, error)
+
+// newFilenameGenerator returns the generator of a strategy, unknown strategies use timestamps
+func newFilenameGenerator(strategy string) filenameGenerator {
+	switch strategy {
+	case FilenameUUID:
+		return uuidFilename
+	case FilenameHash:
+		return hashFilename
+	default:
+		return timestampFilename
+	}
+}
+
+func timestampFilename(_ io.ReadSeeker, ext string) (string, error) {
+	randomChars := uuid.New().String()[:4] // include 4 random chars for the rare case of a collision
+	return fmt.Sprintf("%s-%d%s", randomChars, time.Now().UnixNano(), ext), nil
+}
+
+func uuidFilename(_ io.ReadSeeker, ext string) (string, error) {
+	return uuid.New().String() + ext, nil
+}
+
+// hashFilename names the file after its content. Identical uploads still get their own
+// object through the random suffix, deleting one must not remove the other.
+func hashFilename(file io.ReadSeeker, ext string) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("hashing file: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("resetting file after hashing: %w", err)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("generating filename suffix: %w", err)
+	}
+
+	return fmt.Sprintf("%s-%s%s", hex.EncodeToString(h.Sum(nil))[:32], hex.EncodeToString(suffix), ext), nil
+}
+
+// cleanFilename normalizes the name of an upload to NFC, so visually identical names are stored
+// alike, and removes control characters like newlines. Names longer than maxLen characters are
+// shortened, keeping their extension.
+func cleanFilename(name string, maxLen int) string {
+	name = norm.NFC.String(name)
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "file"
+	}
+
+	if maxLen > 0 && utf8.RuneCountInString(name) > maxLen {
+		ext := []rune(fileExtension(name))
+		// An extension taking up the whole length is cut along with the rest
+		if len(ext) >= maxLen {
+			ext = nil
+		}
+		base := []rune(name)[:utf8.RuneCountInString(name)-len(ext)]
+		name = strings.TrimSpace(string(base[:maxLen-len(ext)])) + string(ext)
+	}
+	return name
+}
+
+// contentDisposition returns a Content-Disposition header naming the file. Clients that don't
+// understand the RFC 5987 filename* parameter get an ASCII fallback with every other character
+// replaced.
+func contentDisposition(disposition, name string) string {
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name)
+
+	header := fmt.Sprintf(`%s; filename="%s"`, disposition, fallback)
+	if fallback != name {
+		header += "; filename*=UTF-8''" + encodeRFC5987(name)
+	}
+	return header
+}
+
+// encodeRFC5987 percent-encodes every byte of the value that is not an attr-char of RFC 5987
+func encodeRFC5987(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+			strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,127 @@
+package uploader
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestFilenameGenerators(t *testing.T) {
+	tests := []struct {
+		strategy string
+		pattern  string
+	}{
+		{FilenameTimestamp, `^[0-9a-f]{4}-\d+\.txt$`},
+		{FilenameUUID, `^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\.txt$`},
+		{FilenameHash, `^b94d27b9934d3e08a52e52d7da7dabfa-[0-9a-f]{8}\.txt$`},
+		{"unknown", `^[0-9a-f]{4}-\d+\.txt$`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			file := strings.NewReader("hello world")
+			name, err := newFilenameGenerator(tt.strategy)(file, ".txt")
+			if err != nil {
+				t.Fatalf("generator error = %v", err)
+			}
+			if !regexp.MustCompile(tt.pattern).MatchString(name) {
+				t.Errorf("name = %q, want match of %s", name, tt.pattern)
+			}
+
+			// The file is rewound for the upload
+			if rest, _ := io.ReadAll(file); string(rest) != "hello world" {
+				t.Error("file was not rewound")
+			}
+		})
+	}
+}
+
+func TestHashFilenameUnique(t *testing.T) {
+	first, err := hashFilename(strings.NewReader("same"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := hashFilename(strings.NewReader("same"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Errorf("identical content got the same name %q", first)
+	}
+	if first[:32] != second[:32] {
+		t.Errorf("hash prefixes differ: %q and %q", first, second)
+	}
+}
+
+func TestFileExtension(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"photo.jpg", ".jpg"},
+		{"archive.tar.gz", ".tar.gz"},
+		{"Backup.TAR.GZ", ".TAR.GZ"},
+		{"app.min.js", ".min.js"},
+		{"styles.min.css", ".min.css"},
+		{"report.final.pdf", ".pdf"},
+		{"Makefile", ""},
+		{".env", ""},
+		{".tar.gz", ".gz"},
+		{"dir/file.txt", ".txt"},
+	}
+
+	for _, tt := range tests {
+		if got := fileExtension(tt.name); got != tt.want {
+			t.Errorf("fileExtension(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCleanFilename(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		maxLen int
+		want   string
+	}{
+		{name: "plain", input: "photo.jpg", maxLen: 255, want: "photo.jpg"},
+		{name: "decomposed to NFC", input: "Cafe\u0301.txt", maxLen: 255, want: "Caf\u00e9.txt"},
+		{name: "newlines removed", input: "evil\r\nSet-Cookie: a=b.txt", maxLen: 255, want: "evilSet-Cookie: a=b.txt"},
+		{name: "quotes kept", input: `say "hi".txt`, maxLen: 255, want: `say "hi".txt`},
+		{name: "CJK", input: "写真.png", maxLen: 255, want: "写真.png"},
+		{name: "shortened keeping the extension", input: strings.Repeat("a", 20) + ".tar.gz", maxLen: 10, want: "aaa.tar.gz"},
+		{name: "shortened by characters", input: strings.Repeat("写", 10) + ".png", maxLen: 6, want: "写写.png"},
+		{name: "overlong extension", input: "a." + strings.Repeat("x", 20), maxLen: 5, want: "a.xxx"},
+		{name: "only control characters", input: "\x00\n", maxLen: 255, want: "file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cleanFilename(tt.input, tt.maxLen); got != tt.want {
+				t.Errorf("cleanFilename(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "ascii", input: "report.pdf", want: `attachment; filename="report.pdf"`},
+		{name: "quotes", input: `say "hi".txt`, want: `attachment; filename="say _hi_.txt"; filename*=UTF-8''say%20%22hi%22.txt`},
+		{name: "newline", input: "a\nb.txt", want: `attachment; filename="a_b.txt"; filename*=UTF-8''a%0Ab.txt`},
+		{name: "CJK", input: "写真.png", want: `attachment; filename="__.png"; filename*=UTF-8''%E5%86%99%E7%9C%9F.png`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := contentDisposition("attachment", tt.input); got != tt.want {
+				t.Errorf("contentDisposition(%q) = %s, want %s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
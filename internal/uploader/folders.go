@@ -0,0 +1,199 @@
+package uploader
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+	"volaticus-go/internal/common/cursor"
+	"volaticus-go/internal/common/models"
+
+	"github.com/google/uuid"
+)
+
+// folderNameMaxLen caps folder names so they fit in breadcrumbs and the move menu
+const folderNameMaxLen = 100
+
+// FolderView is what the file list shows of the user's folders while one of them is open
+type FolderView struct {
+	Current  *models.Folder      // Opened folder, nil at the top level
+	Path     []*models.Folder    // Folders from the top level down to the opened one, for breadcrumbs
+	Children []*models.Folder    // Folders directly inside the opened one
+	Targets  []models.FolderPath // Every folder of the user files can be moved to, sorted by path
+}
+
+// normalizeFolderName trims the name and rejects empty or overlong names and names that would
+// read like a path in breadcrumbs
+func normalizeFolderName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > folderNameMaxLen ||
+		strings.ContainsAny(name, `/\`) || strings.ContainsFunc(name, unicode.IsControl) {
+		return "", ErrInvalidFolderName
+	}
+	return name, nil
+}
+
+// userFolder returns a folder of the user, ErrFolderNotFound for unknown folders and those of
+// other users alike
+func (s *service) userFolder(ctx context.Context, userID, folderID uuid.UUID) (*models.Folder, error) {
+	folder, err := s.repo.GetFolder(ctx, folderID)
+	if err != nil {
+		return nil, err
+	}
+	if folder.UserID != userID {
+		return nil, ErrFolderNotFound
+	}
+	return folder, nil
+}
+
+// CreateFolder adds a folder of the user inside parentID, or at the top level if it is nil
+func (s *service) CreateFolder(ctx context.Context, userID uuid.UUID, name string, parentID *uuid.UUID) (*models.Folder, error) {
+	name, err := normalizeFolderName(name)
+	if err != nil {
+		return nil, err
+	}
+	if parentID != nil {
+		if _, err := s.userFolder(ctx, userID, *parentID); err != nil {
+			return nil, err
+		}
+	}
+
+	folder := &models.Folder{
+		ID:        uuid.New(),
+		UserID:    userID,
+		ParentID:  parentID,
+		Name:      name,
+		CreatedAt: time.Now(),
+	}
+	if err := s.repo.CreateFolder(ctx, folder); err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// ListFolders returns every folder of the user sorted by name
+func (s *service) ListFolders(ctx context.Context, userID uuid.UUID) ([]*models.Folder, error) {
+	return s.repo.GetFolders(ctx, userID)
+}
+
+// RenameFolder gives a folder of the user a new name
+func (s *service) RenameFolder(ctx context.Context, userID, folderID uuid.UUID, name string) (*models.Folder, error) {
+	name, err := normalizeFolderName(name)
+	if err != nil {
+		return nil, err
+	}
+	folder, err := s.userFolder(ctx, userID, folderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.RenameFolder(ctx, folder.ID, name); err != nil {
+		return nil, err
+	}
+	folder.Name = name
+	return folder, nil
+}
+
+// DeleteFolder removes a folder of the user. What happens to its files and folders depends on
+// FOLDER_DELETE_MODE: they move up to its parent, or the folder must be empty.
+func (s *service) DeleteFolder(ctx context.Context, userID, folderID uuid.UUID) error {
+	folder, err := s.userFolder(ctx, userID, folderID)
+	if err != nil {
+		return err
+	}
+	return s.repo.DeleteFolder(ctx, folder, s.config.FolderDeletion == "reparent")
+}
+
+// MoveFiles moves files of the user into a folder, or to the top level if folderID is nil, and
+// returns how many were moved. Files of other users are skipped.
+func (s *service) MoveFiles(ctx context.Context, userID uuid.UUID, ids []uuid.UUID, folderID *uuid.UUID) (int64, error) {
+	if folderID != nil {
+		if _, err := s.userFolder(ctx, userID, *folderID); err != nil {
+			return 0, err
+		}
+	}
+	return s.repo.MoveFiles(ctx, userID, ids, folderID)
+}
+
+// GetFolderFiles retrieves a page of the user's files directly in a folder, nil for the top level
+func (s *service) GetFolderFiles(ctx context.Context, userID uuid.UUID, folderID *uuid.UUID, limit, offset int) ([]*models.UploadedFile, error) {
+	return s.repo.GetFolderFiles(ctx, userID, folderID, limit, offset)
+}
+
+// GetFolderFilesAfter retrieves the user's files directly in a folder following a cursor, newest first
+func (s *service) GetFolderFilesAfter(ctx context.Context, userID uuid.UUID, folderID *uuid.UUID, after *cursor.Cursor, limit int) ([]*models.UploadedFile, error) {
+	return s.repo.GetFolderFilesAfter(ctx, userID, folderID, after, limit)
+}
+
+// GetFolderFilesCount gets the number of the user's files directly in a folder
+func (s *service) GetFolderFilesCount(ctx context.Context, userID uuid.UUID, folderID *uuid.UUID) (int, error) {
+	return s.repo.GetFolderFilesCount(ctx, userID, folderID)
+}
+
+// GetFolder returns a folder of the user, ErrFolderNotFound if it's unknown or someone else's
+func (s *service) GetFolder(ctx context.Context, userID, folderID uuid.UUID) (*models.Folder, error) {
+	return s.userFolder(ctx, userID, folderID)
+}
+
+// OpenFolder returns the folders the file list shows while folderID is open, nil opens the top
+// level
+func (s *service) OpenFolder(ctx context.Context, userID uuid.UUID, folderID *uuid.UUID) (*FolderView, error) {
+	folders, err := s.repo.GetFolders(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uuid.UUID]*models.Folder, len(folders))
+	for _, folder := range folders {
+		byID[folder.ID] = folder
+	}
+
+	view := &FolderView{}
+	if folderID != nil {
+		view.Current = byID[*folderID]
+		if view.Current == nil {
+			return nil, ErrFolderNotFound
+		}
+		view.Path = folderAncestors(view.Current, byID)
+	}
+
+	for _, folder := range folders {
+		if sameFolder(folder.ParentID, folderID) {
+			view.Children = append(view.Children, folder)
+		}
+
+		var names []string
+		for _, ancestor := range folderAncestors(folder, byID) {
+			names = append(names, ancestor.Name)
+		}
+		view.Targets = append(view.Targets, models.FolderPath{ID: folder.ID, Path: strings.Join(names, " / ")})
+	}
+	// Sorting by path keeps subfolders right below their parent
+	sort.Slice(view.Targets, func(i, j int) bool {
+		return strings.ToLower(view.Targets[i].Path) < strings.ToLower(view.Targets[j].Path)
+	})
+	return view, nil
+}
+
+// folderAncestors returns the folders from the top level down to folder, itself included. The
+// walk stops after as many steps as there are folders, so corrupt parents can't loop forever.
+func folderAncestors(folder *models.Folder, byID map[uuid.UUID]*models.Folder) []*models.Folder {
+	path := []*models.Folder{folder}
+	for len(path) <= len(byID) && folder.ParentID != nil {
+		folder = byID[*folder.ParentID]
+		if folder == nil {
+			break
+		}
+		path = append([]*models.Folder{folder}, path...)
+	}
+	return path
+}
+
+// sameFolder reports whether two optional folder IDs name the same folder or both the top level
+func sameFolder(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,168 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"volaticus-go/internal/common/models"
+	"volaticus-go/internal/config"
+
+	"github.com/google/uuid"
+)
+
+// folderRepository keeps folders in memory and records how deletions were requested
+type folderRepository struct {
+	Repository
+	folders  []*models.Folder
+	reparent []bool
+}
+
+func (r *folderRepository) GetFolder(_ context.Context, id uuid.UUID) (*models.Folder, error) {
+	for _, folder := range r.folders {
+		if folder.ID == id {
+			return folder, nil
+		}
+	}
+	return nil, ErrFolderNotFound
+}
+
+func (r *folderRepository) GetFolders(_ context.Context, userID uuid.UUID) ([]*models.Folder, error) {
+	var folders []*models.Folder
+	for _, folder := range r.folders {
+		if folder.UserID == userID {
+			folders = append(folders, folder)
+		}
+	}
+	return folders, nil
+}
+
+func (r *folderRepository) CreateFolder(_ context.Context, folder *models.Folder) error {
+	r.folders = append(r.folders, folder)
+	return nil
+}
+
+func (r *folderRepository) DeleteFolder(_ context.Context, _ *models.Folder, reparent bool) error {
+	r.reparent = append(r.reparent, reparent)
+	return nil
+}
+
+func (r *folderRepository) MoveFiles(_ context.Context, _ uuid.UUID, ids []uuid.UUID, _ *uuid.UUID) (int64, error) {
+	return int64(len(ids)), nil
+}
+
+func TestOpenFolder(t *testing.T) {
+	userID := uuid.New()
+	folder := func(name string, parent *models.Folder) *models.Folder {
+		f := &models.Folder{ID: uuid.New(), UserID: userID, Name: name}
+		if parent != nil {
+			f.ParentID = &parent.ID
+		}
+		return f
+	}
+	photos := folder("Photos", nil)
+	trip := folder("Trip", photos)
+	beach := folder("beach", trip)
+	archive := folder("Archive", nil)
+	foreign := &models.Folder{ID: uuid.New(), UserID: uuid.New(), Name: "Other"}
+
+	s := &service{repo: &folderRepository{folders: []*models.Folder{photos, trip, beach, archive, foreign}}}
+
+	view, err := s.OpenFolder(context.Background(), userID, nil)
+	if err != nil {
+		t.Fatalf("OpenFolder() top level error = %v", err)
+	}
+	if view.Current != nil || len(view.Path) != 0 || len(view.Children) != 2 {
+		t.Errorf("top level = %+v, want no path and two children", view)
+	}
+	var paths []string
+	for _, target := range view.Targets {
+		paths = append(paths, target.Path)
+	}
+	if got, want := strings.Join(paths, ", "), "Archive, Photos, Photos / Trip, Photos / Trip / beach"; got != want {
+		t.Errorf("target paths = %q, want %q", got, want)
+	}
+
+	view, err = s.OpenFolder(context.Background(), userID, &trip.ID)
+	if err != nil {
+		t.Fatalf("OpenFolder() error = %v", err)
+	}
+	if view.Current != trip || len(view.Path) != 2 || view.Path[0] != photos || view.Path[1] != trip {
+		t.Errorf("path = %v, want Photos / Trip", view.Path)
+	}
+	if len(view.Children) != 1 || view.Children[0] != beach {
+		t.Errorf("children = %v, want beach", view.Children)
+	}
+
+	// Folders of other users can't be opened
+	if _, err := s.OpenFolder(context.Background(), userID, &foreign.ID); !errors.Is(err, ErrFolderNotFound) {
+		t.Errorf("OpenFolder() foreign folder error = %v, want %v", err, ErrFolderNotFound)
+	}
+}
+
+func TestFolderOwnership(t *testing.T) {
+	userID := uuid.New()
+	foreign := &models.Folder{ID: uuid.New(), UserID: uuid.New(), Name: "Other"}
+	s := &service{repo: &folderRepository{folders: []*models.Folder{foreign}}, config: &config.Config{}}
+	ctx := context.Background()
+
+	if _, err := s.CreateFolder(ctx, userID, "Mine", &foreign.ID); !errors.Is(err, ErrFolderNotFound) {
+		t.Errorf("CreateFolder() in foreign folder error = %v", err)
+	}
+	if _, err := s.RenameFolder(ctx, userID, foreign.ID, "Mine"); !errors.Is(err, ErrFolderNotFound) {
+		t.Errorf("RenameFolder() foreign folder error = %v", err)
+	}
+	if err := s.DeleteFolder(ctx, userID, foreign.ID); !errors.Is(err, ErrFolderNotFound) {
+		t.Errorf("DeleteFolder() foreign folder error = %v", err)
+	}
+	if _, err := s.MoveFiles(ctx, userID, []uuid.UUID{uuid.New()}, &foreign.ID); !errors.Is(err, ErrFolderNotFound) {
+		t.Errorf("MoveFiles() into foreign folder error = %v", err)
+	}
+}
+
+func TestCreateFolderName(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{name: "trimmed", input: "  Photos ", want: "Photos"},
+		{name: "unicode", input: "Fotos 📷", want: "Fotos 📷"},
+		{name: "empty", input: "   ", wantErr: ErrInvalidFolderName},
+		{name: "slash", input: "a/b", wantErr: ErrInvalidFolderName},
+		{name: "backslash", input: `a\b`, wantErr: ErrInvalidFolderName},
+		{name: "control character", input: "a\nb", wantErr: ErrInvalidFolderName},
+		{name: "too long", input: strings.Repeat("a", folderNameMaxLen+1), wantErr: ErrInvalidFolderName},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &service{repo: &folderRepository{}}
+			folder, err := s.CreateFolder(context.Background(), uuid.New(), tt.input, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CreateFolder() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && folder.Name != tt.want {
+				t.Errorf("name = %q, want %q", folder.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteFolderMode(t *testing.T) {
+	userID := uuid.New()
+	for mode, want := range map[string]bool{"block": false, "reparent": true} {
+		t.Run(mode, func(t *testing.T) {
+			folder := &models.Folder{ID: uuid.New(), UserID: userID, Name: "Photos"}
+			repo := &folderRepository{folders: []*models.Folder{folder}}
+			s := &service{repo: repo, config: &config.Config{FolderDeletion: mode}}
+
+			if err := s.DeleteFolder(context.Background(), userID, folder.ID); err != nil {
+				t.Fatalf("DeleteFolder() error = %v", err)
+			}
+			if len(repo.reparent) != 1 || repo.reparent[0] != want {
+				t.Errorf("reparent = %v, want %v", repo.reparent, want)
+			}
+		})
+	}
+}
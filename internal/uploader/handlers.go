@@ -4,11 +4,22 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"mime/multipart"
 	"net/http"
+	"net/url"
+	"os"
 	"strconv"
+	"strings"
+	"time"
+	"volaticus-go/cmd/web"
 	"volaticus-go/cmd/web/components"
 	"volaticus-go/cmd/web/pages"
+	"volaticus-go/internal/audit"
+	"volaticus-go/internal/common/apierror"
+	"volaticus-go/internal/common/cursor"
+	"volaticus-go/internal/common/models"
 	"volaticus-go/internal/context"
 	userctx "volaticus-go/internal/context"
 
@@ -17,11 +28,32 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// Responses of the web upload, selected with the output form field
 const (
-	defaultPageSize = 10
-	maxPageSize     = 50
+	outputHTML     = "html"
+	outputText     = "text"
+	outputRedirect = "redirect"
 )
 
+const (
+	defaultSignedURLTTL = time.Hour
+	maxSignedURLTTL     = 7 * 24 * time.Hour
+
+	// multipartMemory is the part of an upload kept in memory, the rest is buffered on disk
+	multipartMemory = 32 << 20
+
+	// progressStreamTimeout bounds how long a progress stream waits for an upload to finish
+	progressStreamTimeout = 30 * time.Minute
+)
+
+// MultipartOverhead is the room an upload body has beyond its files for boundaries and form fields
+const MultipartOverhead = 1 << 20
+
+// BodyLimit is the largest body of an upload carrying up to maxFiles files of maxSize each
+func BodyLimit(maxSize int64, maxFiles int) int64 {
+	return maxSize*int64(max(maxFiles, 1)) + MultipartOverhead
+}
+
 type Haaandler interface {
 	HandleUpload(w http.ResponseWriter, r *http.Request)
 	HandleAPIUpload(w http.ResponseWriter, r *http.Request)
@@ -32,20 +64,45 @@ type Haaandler interface {
 }
 
 type Handler struct {
-	service *service
+	service  *service
+	progress *ProgressTracker
+	uploads  *UploadSlots
+	audit    *audit.Logger
 }
 
-func NewHandler(service *service) *Handler {
+func NewHandler(service *service, auditLog *audit.Logger) *Handler {
 	return &Handler{
-		service: service,
+		service:  service,
+		progress: NewProgressTracker(),
+		uploads:  NewUploadSlots(service.config.UploadsPerUser),
+		audit:    auditLog,
 	}
 }
 
+// recordFileDelete adds a deletion attempt to the audit log, err is the reason it failed
+func (h *Handler) recordFileDelete(r *http.Request, id uuid.UUID, err error, details string) {
+	event := audit.Event{Action: audit.ActionFileDelete, TargetType: "file", TargetID: id.String(), Details: details}
+	if err != nil {
+		event.Result = audit.ResultFailure
+		event.Details = err.Error()
+		if details != "" {
+			event.Details = details + ": " + event.Details
+		}
+	}
+	h.audit.Record(r, event)
+}
+
 // HandleVerifyFile handles file validation
 func (h *Handler) HandleVerifyFile(w http.ResponseWriter, r *http.Request) {
+	allowSlowTransfer(w, true)
 	file, header, err := r.FormFile("file")
 	if err != nil {
-		err := components.ValidationError("Invalid file").Render(r.Context(), w)
+		message := "Invalid file"
+		if bodyTooLarge(err) {
+			message = "File exceeds maximum allowed size"
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		}
+		err := components.ValidationError(message).Render(r.Context(), w)
 		if err != nil {
 			log.Error().
 				Err(err).
@@ -96,26 +153,34 @@ func (h *Handler) HandleVerifyFile(w http.ResponseWriter, r *http.Request) {
 
 // HandleUpload handles file upload
 func (h *Handler) HandleUpload(w http.ResponseWriter, r *http.Request) {
-	file, header, err := r.FormFile("file")
-	if err != nil {
-		http.Error(w, "Invalid File", http.StatusBadRequest)
-		return
-	}
-	defer func(file multipart.File) {
-		err := file.Close()
-		if err != nil {
-			log.Error().
-				Err(err).
-				Msg("Error closing file")
-		}
-	}(file)
-
 	userContext := userctx.GetUserFromContext(r.Context())
 	if userContext == nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
+	allowSlowTransfer(w, true)
+
+	// Report the received bytes to the progress stream of the upload session
+	if uploadID := r.Header.Get("X-Upload-ID"); uploadID != "" {
+		r.Body = h.progress.Track(uploadID, userContext.ID, r.Body, r.ContentLength)
+		defer h.progress.Finish(uploadID)
+	}
+
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		if bodyTooLarge(err) {
+			http.Error(w, "File exceeds maximum allowed size", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid File", http.StatusBadRequest)
+		return
+	}
+	headers := r.MultipartForm.File["file"]
+	if len(headers) == 0 {
+		http.Error(w, "Invalid File", http.StatusBadRequest)
+		return
+	}
+
 	// Parse the URL type from the form
 	urlType := r.FormValue("url_type")
 	if urlType == "" {
@@ -128,284 +193,1382 @@ func (h *Handler) HandleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	uploadReq := &UploadRequest{
-		File:    file,
-		Header:  header,
-		URLType: parsedURLType,
-		UserID:  userContext.ID,
+	expiresIn, err := parseExpiresIn(r.FormValue("expires_in"))
+	if err != nil {
+		http.Error(w, "Invalid expiration", http.StatusBadRequest)
+		return
+	}
+
+	forceDownload := r.FormValue("force_download") == "true"
+
+	// Scripted form posts can ask for the bare URL or a redirect instead of the HTML fragment
+	output := r.FormValue("output")
+	switch output {
+	case "":
+		output = outputHTML
+	case outputHTML, outputText, outputRedirect:
+	default:
+		http.Error(w, "Invalid output", http.StatusBadRequest)
+		return
 	}
 
-	uploadedFile, err := h.service.UploadFile(r.Context(), uploadReq)
+	results, err := h.service.UploadFiles(r.Context(), userContext.ID, headers, parsedURLType, expiresIn, forceDownload)
+	if errors.Is(err, ErrQuotaExceeded) || errors.Is(err, ErrFileLimitReached) || errors.Is(err, ErrTooManyFiles) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		log.Error().
 			Err(err).
 			Str("userId", userContext.ID.String()).
-			Str("filename", header.Filename).
-			Str("urlType", urlType).
-			Msg("Error uploading file")
+			Msg("Error uploading files")
 		http.Error(w, "Error uploading file", http.StatusInternalServerError)
 		return
 	}
 
-	url := fmt.Sprintf("%s/f/%s", h.service.config.BaseURL, uploadedFile.URLValue)
+	// A single file keeps the original success and error responses
+	if len(results) == 1 {
+		result := results[0]
+		if errors.Is(result.Err, ErrInfected) {
+			http.Error(w, "File rejected: "+result.Err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		if result.Err != nil {
+			log.Error().
+				Err(result.Err).
+				Str("userId", userContext.ID.String()).
+				Str("filename", result.FileName).
+				Str("urlType", urlType).
+				Msg("Error uploading file")
+			http.Error(w, "Error uploading file", http.StatusInternalServerError)
+			return
+		}
 
-	// Render success template
-	if err := pages.UploadSuccess(url, uploadedFile.OriginalName).Render(r.Context(), w); err != nil {
-		log.Error().
-			Err(err).
-			Str("fileUrl", url).
-			Str("originalName", uploadedFile.OriginalName).
-			Msg("Error rendering success template")
-		http.Error(w, "Error rendering response", http.StatusInternalServerError)
-	}
-}
+		url := h.fileURL(result.File)
 
-// HandleServeFile serves the uploaded file
-func (h *Handler) HandleServeFile(w http.ResponseWriter, r *http.Request) {
-	urlValue := chi.URLParam(r, "fileUrl")
-	log.Info().
-		Str("fileUrl", urlValue).
-		Msg("Got Serve File Request")
+		switch output {
+		case outputText:
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fmt.Fprintln(w, url)
+			return
+		case outputRedirect:
+			http.Redirect(w, r, url, http.StatusSeeOther)
+			return
+		}
 
-	if urlValue == "" {
-		http.Error(w, "File not found", http.StatusNotFound)
+		// Render success template
+		if err := pages.UploadSuccess(url, result.File.OriginalName).Render(r.Context(), w); err != nil {
+			log.Error().
+				Err(err).
+				Str("fileUrl", url).
+				Str("originalName", result.File.OriginalName).
+				Msg("Error rendering success template")
+			http.Error(w, "Error rendering response", http.StatusInternalServerError)
+		}
 		return
 	}
 
-	file, err := h.service.GetFile(r.Context(), urlValue)
-	if err != nil {
-		if errors.Is(err, ErrNoRows) {
-			http.Error(w, "File not found", http.StatusNotFound)
-		} else {
-			log.Printf("Error retrieving file: %v", err)
-			http.Error(w, "Error retrieving file", http.StatusInternalServerError)
-		}
+	if output == outputText {
+		h.writeTextResults(w, results)
 		return
 	}
-
-	log.Info().
-		Str("filename", file.OriginalName).
-		Str("mimeType", file.MimeType).
-		Msg("Serving file")
-
-	contentType := file.MimeType
-	if contentType == "" {
-		contentType = "application/octet-stream"
+	if output == outputRedirect {
+		http.Redirect(w, r, web.Path("/files"), http.StatusSeeOther)
+		return
 	}
-	w.Header().Set("Content-Type", contentType)
 
-	if r.URL.Query().Get("download") == "true" {
-		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, file.OriginalName))
-	} else {
-		w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, file.OriginalName))
+	items := make([]pages.UploadResultItem, 0, len(results))
+	for _, result := range results {
+		item := pages.UploadResultItem{FileName: result.FileName}
+		if result.Err != nil {
+			log.Error().
+				Err(result.Err).
+				Str("userId", userContext.ID.String()).
+				Str("filename", result.FileName).
+				Msg("Error uploading file")
+			item.Error = uploadErrorMessage(result.Err)
+		} else {
+			item.URL = h.fileURL(result.File)
+		}
+		items = append(items, item)
 	}
 
-	// Add cache control
-	w.Header().Set("Cache-Control", "public, max-age=86400") // 24 hours
-	w.Header().Set("ETag", fmt.Sprintf(`"%s"`, file.UniqueFilename))
+	if err := pages.UploadResults(items).Render(r.Context(), w); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error rendering upload results")
+		http.Error(w, "Error rendering response", http.StatusInternalServerError)
+	}
+}
 
-	// Check if client has a cached version
-	if match := r.Header.Get("If-None-Match"); match != "" {
-		if match == fmt.Sprintf(`"%s"`, file.UniqueFilename) {
-			w.WriteHeader(http.StatusNotModified)
-			return
+// writeTextResults lists the URL of every uploaded file on its own line, failed files
+// are reported as "name: error" so scripts can tell which ones to retry
+func (h *Handler) writeTextResults(w http.ResponseWriter, results []UploadResult) {
+	succeeded := 0
+	var body strings.Builder
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Fprintf(&body, "%s: %s\n", result.FileName, uploadErrorMessage(result.Err))
+			continue
 		}
+		fmt.Fprintln(&body, h.fileURL(result.File))
+		succeeded++
 	}
 
-	// Serve the file
-	if err := h.service.ServeFile(r.Context(), w, file); err != nil {
-		log.Printf("Error serving file: %v", err)
-		http.Error(w, "Error serving file", http.StatusInternalServerError)
-		return
+	status := http.StatusOK
+	switch {
+	case succeeded == 0:
+		status = http.StatusBadRequest
+	case succeeded < len(results):
+		status = http.StatusMultiStatus
 	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	io.WriteString(w, body.String())
 }
 
-type APIUploadResponse struct {
-	Success bool   `json:"success"`
-	URL     string `json:"url,omitempty"`
-	Error   string `json:"error,omitempty"`
+// fileURL returns the public URL of an uploaded file
+func (h *Handler) fileURL(file *models.UploadedFile) string {
+	return fmt.Sprintf("%s/f/%s", h.service.config.BaseURL, file.URLValue)
 }
 
-// sendAPIResponse handles JSON response formatting consistently
-func sendAPIResponse(w http.ResponseWriter, status int, success bool, url string, err error) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
+// uploadErrorMessage returns the error of a failed upload that can be shown to the user
+func uploadErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, ErrInfected), errors.Is(err, ErrValidationFailed), errors.Is(err, ErrFileTooLarge),
+		errors.Is(err, ErrFileLimitReached):
+		return err.Error()
+	default:
+		return "upload failed"
+	}
+}
 
-	response := APIUploadResponse{
-		Success: success,
-		URL:     url,
+// HandleUploadProgress streams the progress of an upload session as server-sent events
+func (h *Handler) HandleUploadProgress(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
 	}
 
-	if err != nil {
-		response.Error = err.Error()
+	updates, ok := h.progress.Subscribe(chi.URLParam(r, "id"), user.ID)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
 	}
 
-	if err := json.NewEncoder(w).Encode(response); err != nil {
+	// The stream outlives the server's write timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Debug().
+			Err(err).
+			Msg("Could not clear write deadline for progress stream")
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
 		log.Error().
 			Err(err).
-			Msg("Error encoding response")
+			Msg("Streaming not supported for upload progress")
+		return
+	}
+
+	timeout := time.NewTimer(progressStreamTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-timeout.C:
+			return
+		case progress := <-updates:
+			event := "progress"
+			if progress.Done {
+				event = "done"
+			}
+
+			data, err := json.Marshal(progress)
+			if err != nil {
+				log.Error().
+					Err(err).
+					Msg("Error encoding upload progress")
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+
+			if progress.Done {
+				return
+			}
+		}
 	}
 }
 
-// HandleAPIUpload handles file upload through the API with minimal configuration
-func (h *Handler) HandleAPIUpload(w http.ResponseWriter, r *http.Request) {
+// HandleServeFile serves the uploaded file
+func (h *Handler) HandleServeFile(w http.ResponseWriter, r *http.Request) {
+	urlValue := chi.URLParam(r, "fileUrl")
 	log.Info().
-		Str("remoteAddr", r.RemoteAddr).
-		Msg("API Upload request from")
+		Str("fileUrl", urlValue).
+		Msg("Got Serve File Request")
 
-	// Get user from context
-	userContext := userctx.GetUserFromContext(r.Context())
-	if userContext == nil {
-		sendAPIResponse(w, http.StatusUnauthorized, false, "", errors.New("unauthorized"))
+	if urlValue == "" {
+		h.fileError(w, r, http.StatusNotFound)
 		return
 	}
 
-	// Check content length against max size
-	if r.ContentLength > h.service.config.UploadMaxSize {
-		sendAPIResponse(w, http.StatusRequestEntityTooLarge, false, "", ErrFileTooLarge)
+	file, err := h.service.GetFile(r.Context(), urlValue)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrNoRows):
+			h.fileError(w, r, http.StatusNotFound)
+		case errors.Is(err, ErrFileExpired):
+			h.fileError(w, r, http.StatusGone)
+		default:
+			log.Printf("Error retrieving file: %v", err)
+			apierror.Error(w, r, "Error retrieving file", http.StatusInternalServerError)
+		}
 		return
 	}
 
-	// Check current storage usage against quota
-	stats, err := h.service.repo.GetFileStats(r.Context(), userContext.ID)
-	if err != nil {
-		log.Error().
-			Err(err).
-			Str("user_id", userContext.ID.String()).
-			Msg("Failed to get user storage stats")
-		sendAPIResponse(w, http.StatusInternalServerError, false, "", errors.New("failed to check storage quota"))
+	// Private files look missing to everyone but the owner, so their URLs reveal nothing
+	if !visibleTo(r, file) {
+		h.fileError(w, r, http.StatusNotFound)
 		return
 	}
-
-	// Check if this upload would exceed quota
-	if stats.TotalSize+r.ContentLength > h.service.config.UploadUserQuota {
-		log.Warn().
-			Str("user_id", userContext.ID.String()).
-			Int64("current_size", stats.TotalSize).
-			Int64("upload_size", r.ContentLength).
-			Int64("quota", h.service.config.UploadUserQuota).
-			Msg("Upload would exceed user quota")
-		sendAPIResponse(w, http.StatusBadRequest, false, "", fmt.Errorf("upload would exceed your storage quota of %s", formatSize(h.service.config.UploadUserQuota)))
+	if file.Visibility == models.FileVisibilityPrivate {
+		h.serveFile(w, r, file, "private, no-store")
 		return
 	}
-
-	file, header, err := r.FormFile("file")
-	if err != nil {
-		status := http.StatusBadRequest
-		if errors.Is(err, http.ErrMissingFile) {
-			err = ErrNoFile
-		}
-		sendAPIResponse(w, status, false, "", err)
+	if wantsLinkPreview(r) {
+		h.servePreview(w, r, file)
 		return
 	}
-	defer func(file multipart.File) {
-		err := file.Close()
-		if err != nil {
-			log.Error().
-				Err(err).
-				Msg("Error closing file")
-		}
-	}(file)
 
-	// Parse URL type from header
-	urlType := URLTypeDefault
-	if typeHeader := r.Header.Get("Url-Type"); typeHeader != "" {
-		parsedType, err := ParseURLType(typeHeader)
-		if err != nil {
-			sendAPIResponse(w, http.StatusBadRequest, false, "", ErrInvalidURLType)
+	// Public objects are downloaded from storage directly. Files needing headers only the app
+	// sets, like attachments and sandboxing, are still streamed.
+	if !h.isSandboxedType(file.MimeType) && !h.forcesDownload(r, file) {
+		if url, ok := h.service.directURL(r.Context(), file); ok {
+			h.recordAccess(r, file)
+			http.Redirect(w, r, url, http.StatusFound)
 			return
 		}
-		urlType = parsedType
 	}
 
-	uploadReq := &UploadRequest{
-		File:    file,
-		Header:  header,
-		URLType: urlType,
-		UserID:  userContext.ID,
+	h.serveFile(w, r, file, publicCacheControl(h.service.config.FileCacheMaxAge, file.ExpiresAt, time.Now()))
+}
+
+// visibleTo reports whether the file may be served to the requester, private files are
+// only served to their owner. Signed links don't go through this check.
+func visibleTo(r *http.Request, file *models.UploadedFile) bool {
+	if file.Visibility != models.FileVisibilityPrivate {
+		return true
 	}
+	user := context.GetUserFromContext(r.Context())
+	return user != nil && user.ID == file.UserID
+}
 
-	uploadedFile, err := h.service.UploadFile(r.Context(), uploadReq)
+// HandleViewFile shows a file on a page with its metadata instead of the raw content.
+// Types the browser can't preview safely are downloaded instead.
+func (h *Handler) HandleViewFile(w http.ResponseWriter, r *http.Request) {
+	urlValue := chi.URLParam(r, "fileUrl")
+
+	file, err := h.service.GetFile(r.Context(), urlValue)
 	if err != nil {
-		log.Error().
-			Err(err).
-			Msg("Upload error")
-		sendAPIResponse(w, http.StatusInternalServerError, false, "", errors.New("upload failed"))
+		switch {
+		case errors.Is(err, ErrNoRows):
+			h.fileError(w, r, http.StatusNotFound)
+		case errors.Is(err, ErrFileExpired):
+			h.fileError(w, r, http.StatusGone)
+		default:
+			log.Error().
+				Err(err).
+				Str("fileUrl", urlValue).
+				Msg("Error retrieving file for viewer")
+			apierror.Error(w, r, "Error retrieving file", http.StatusInternalServerError)
+		}
 		return
 	}
-
-	url := fmt.Sprintf("%s/f/%s", h.service.config.BaseURL, uploadedFile.URLValue)
-	sendAPIResponse(w, http.StatusOK, true, url, nil)
-}
-
-// HandleFilesList handles the GET /files/list endpoint
-func (h *Handler) HandleFilesList(w http.ResponseWriter, r *http.Request) {
-	user := context.GetUserFromContext(r.Context())
-	if user == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	if !visibleTo(r, file) {
+		h.fileError(w, r, http.StatusNotFound)
 		return
 	}
 
-	// Parse pagination parameters
-	page := 1
-	limit := defaultPageSize
-
-	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
-		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
-			page = p
-		}
+	kind := ""
+	if !h.isSandboxedType(file.MimeType) && !h.forcesDownload(r, file) {
+		kind = viewerKind(file.MimeType)
 	}
-
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= maxPageSize {
-			limit = l
-		}
+	if kind == "" {
+		http.Redirect(w, r, web.Path("/f/"+file.URLValue+"?download=true"), http.StatusSeeOther)
+		return
 	}
 
-	offset := (page - 1) * limit
-
-	// Get files and stats for the current user with pagination
-	files, err := h.service.GetUserFiles(r.Context(), user.ID, limit, offset)
-	if err != nil {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	meta := h.fileMeta(file, h.fileURL(file)+"/view")
+	if err := pages.FileViewer(file, kind, meta).Render(r.Context(), w); err != nil {
 		log.Error().
 			Err(err).
-			Msg("Error fetching files")
-		http.Error(w, "Error fetching files", http.StatusInternalServerError)
-		return
+			Str("fileUrl", urlValue).
+			Msg("Error rendering file viewer")
 	}
+}
 
-	// Get total count for pagination
-	total, err := h.service.GetUserFilesCount(r.Context(), user.ID)
+// viewerKind returns how the viewer page previews a content type, empty if it can't
+func viewerKind(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
 	if err != nil {
-		log.Error().
-			Err(err).
-			Msg("Error fetching file count")
-		http.Error(w, "Error fetching file count", http.StatusInternalServerError)
-		return
+		return ""
 	}
 
-	totalPages := (total + limit - 1) / limit // Ceiling division
+	switch {
+	case strings.HasPrefix(mediaType, "image/"):
+		return "image"
+	case mediaType == "application/pdf":
+		return "pdf"
+	case strings.HasPrefix(mediaType, "text/"), mediaType == "application/json":
+		return "text"
+	default:
+		return ""
+	}
+}
 
-	// Render the file list component
-	props := components.FileListProps{
-		Files:      files,
-		ShowPaging: true,
-		Page:       page,
-		TotalPages: totalPages,
-		EmptyState: "No files uploaded yet",
+// fileError reports a missing or expired file, as a page to browsers and as JSON otherwise
+func (h *Handler) fileError(w http.ResponseWriter, r *http.Request, status int) {
+	message, page := "File not found", pages.Error404()
+	if status == http.StatusGone {
+		message, page = ErrFileExpired.Error(), pages.FileExpired()
 	}
 
-	err = components.FileListComponent(props).Render(r.Context(), w)
-	if err != nil {
+	if !apierror.WantsHTML(r) {
+		apierror.Error(w, r, message, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := page.Render(r.Context(), w); err != nil {
 		log.Error().
 			Err(err).
-			Msg("Error rendering file list")
-		http.Error(w, "Error rendering file list", http.StatusInternalServerError)
-		return
+			Int("status", status).
+			Msg("Error rendering file error page")
 	}
 }
 
-// HandleRecentFiles returns the last N files for a user
+// HandleServeSignedFile serves a file through a signed, time-limited download link without authentication
+func (h *Handler) HandleServeSignedFile(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+	if token == "" {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+
+	file, err := h.service.GetSignedFile(r.Context(), token)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidSignature), errors.Is(err, ErrSignatureExpired):
+			http.Error(w, "Invalid or expired link", http.StatusForbidden)
+		case errors.Is(err, ErrNoRows):
+			http.Error(w, "File not found", http.StatusNotFound)
+		default:
+			log.Error().
+				Err(err).
+				Msg("Error retrieving signed file")
+			http.Error(w, "Error retrieving file", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Shared caches must not keep a copy beyond the link's lifetime
+	h.serveFile(w, r, file, "private, no-store")
+}
+
+// serveFile writes the response headers for a file and streams its content
+func (h *Handler) serveFile(w http.ResponseWriter, r *http.Request, file *models.UploadedFile, cacheControl string) {
+	log.Info().
+		Str("filename", file.OriginalName).
+		Str("mimeType", file.MimeType).
+		Msg("Serving file")
+
+	h.recordAccess(r, file)
+
+	contentType := file.MimeType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	// Scriptable content must never render on our origin, it would have access to the session cookie
+	if h.isSandboxedType(contentType) {
+		w.Header().Set("Content-Security-Policy", "sandbox")
+		w.Header().Set("Content-Disposition", contentDisposition("attachment", file.OriginalName))
+	} else if h.forcesDownload(r, file) {
+		w.Header().Set("Content-Disposition", contentDisposition("attachment", file.OriginalName))
+	} else {
+		w.Header().Set("Content-Disposition", contentDisposition("inline", file.OriginalName))
+	}
+
+	// Add cache control
+	etag := fmt.Sprintf(`"%s"`, file.UniqueFilename)
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("ETag", etag)
+	// Objects are written once under a unique name before the file is created, so the upload
+	// time is their modification time and storage doesn't need to be asked for it
+	lastModified := file.CreatedAt
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	// Check if client has a cached version, unless it asked to bypass it
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// HEAD answers from the size recorded at upload without reading the object
+	if r.Method == http.MethodHead {
+		w.Header().Set("Content-Length", strconv.FormatUint(file.FileSize, 10))
+		return
+	}
+
+	// Serve the file
+	allowSlowTransfer(w, false)
+	if err := h.service.ServeFile(r.Context(), w, file); err != nil {
+		// Nothing can be sent to a client that already went away
+		if r.Context().Err() != nil {
+			return
+		}
+		log.Printf("Error serving file: %v", err)
+		http.Error(w, "Error serving file", http.StatusInternalServerError)
+		return
+	}
+}
+
+// recordAccess counts the request as a download of the file, HEAD requests only probe it
+func (h *Handler) recordAccess(r *http.Request, file *models.UploadedFile) {
+	if r.Method == http.MethodHead {
+		return
+	}
+	h.service.RecordAccess(file, &models.RequestInfo{
+		Referrer:  r.Referer(),
+		UserAgent: r.UserAgent(),
+		IPAddress: h.service.clientIP.FromRequest(r),
+	})
+}
+
+// forcesDownload reports whether a file is served as an attachment. The operator setting applies to
+// every file, then the file's own flag and its owner's account default, and finally ?download=true.
+func (h *Handler) forcesDownload(r *http.Request, file *models.UploadedFile) bool {
+	if h.service.config.ForceDownload || file.ForceDownload || file.OwnerForceDownload {
+		return true
+	}
+	return r.URL.Query().Get("download") == "true"
+}
+
+// isSandboxedType reports whether the content type is configured to be served as a sandboxed attachment
+func (h *Handler) isSandboxedType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// Unparseable types are treated as dangerous
+		return true
+	}
+	for _, t := range h.service.config.SandboxTypes {
+		if strings.EqualFold(mediaType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// SignedURLResponse is returned when creating a signed download link
+type SignedURLResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// HandleSignFile creates a signed, time-limited download link for a file
+func (h *Handler) HandleSignFile(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		apierror.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "fileID"))
+	if err != nil {
+		apierror.Error(w, r, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	ttl := defaultSignedURLTTL
+	if expiresIn := r.FormValue("expires_in"); expiresIn != "" {
+		ttl, err = time.ParseDuration(expiresIn)
+		if err != nil || ttl <= 0 || ttl > maxSignedURLTTL {
+			apierror.Error(w, r, fmt.Sprintf("expires_in must be a duration between 0 and %s", maxSignedURLTTL), http.StatusBadRequest)
+			return
+		}
+	}
+
+	url, expiresAt, err := h.service.SignFileURL(r.Context(), id, user.ID, ttl)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUnauthorized):
+			apierror.Error(w, r, "Unauthorized", http.StatusForbidden)
+		case errors.Is(err, ErrNoRows):
+			apierror.Error(w, r, "File not found", http.StatusNotFound)
+		default:
+			log.Error().
+				Err(err).
+				Str("file_id", id.String()).
+				Msg("Error signing file URL")
+			apierror.Error(w, r, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(SignedURLResponse{URL: url, ExpiresAt: expiresAt}); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error encoding response")
+	}
+}
+
+// UpdateExpirationRequest sets a new expiration for a file, a null expires_at disables expiration
+type UpdateExpirationRequest struct {
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// HandleUpdateExpiration extends, shortens or removes the expiration of a file
+func (h *Handler) HandleUpdateExpiration(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		apierror.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "fileID"))
+	if err != nil {
+		apierror.Error(w, r, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateExpirationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Error(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.UpdateFileExpiration(r.Context(), id, user.ID, req.ExpiresAt); err != nil {
+		switch {
+		case errors.Is(err, ErrUnauthorized):
+			apierror.Error(w, r, "Unauthorized", http.StatusForbidden)
+		case errors.Is(err, ErrNoRows):
+			apierror.Error(w, r, "File not found", http.StatusNotFound)
+		case errors.Is(err, ErrInvalidExpiration):
+			apierror.Error(w, r, err.Error(), http.StatusBadRequest)
+		default:
+			log.Error().
+				Err(err).
+				Str("file_id", id.String()).
+				Msg("Error updating file expiration")
+			apierror.Error(w, r, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleUpdateVisibility makes a file of the user public or private
+func (h *Handler) HandleUpdateVisibility(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		apierror.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "fileID"))
+	if err != nil {
+		apierror.Error(w, r, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.UpdateFileVisibility(r.Context(), id, user.ID, r.FormValue("visibility")); err != nil {
+		switch {
+		case errors.Is(err, ErrUnauthorized):
+			apierror.Error(w, r, "Unauthorized", http.StatusForbidden)
+		case errors.Is(err, ErrNoRows):
+			apierror.Error(w, r, "File not found", http.StatusNotFound)
+		case errors.Is(err, ErrInvalidVisibility):
+			apierror.Error(w, r, err.Error(), http.StatusBadRequest)
+		default:
+			log.Error().
+				Err(err).
+				Str("file_id", id.String()).
+				Msg("Error updating file visibility")
+			apierror.Error(w, r, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleFileAnalytics returns the download history of a file owned by the user
+func (h *Handler) HandleFileAnalytics(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		apierror.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "fileID"))
+	if err != nil {
+		apierror.Error(w, r, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	analytics, err := h.service.GetFileAnalytics(r.Context(), id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUnauthorized):
+			apierror.Error(w, r, "Unauthorized", http.StatusForbidden)
+		case errors.Is(err, ErrNoRows):
+			apierror.Error(w, r, "File not found", http.StatusNotFound)
+		default:
+			log.Error().
+				Err(err).
+				Str("file_id", id.String()).
+				Msg("Error retrieving file analytics")
+			apierror.Error(w, r, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(analytics); err != nil {
+		log.Error().
+			Err(err).
+			Str("file_id", id.String()).
+			Msg("Error encoding file analytics")
+	}
+}
+
+type APIUploadResponse struct {
+	Success bool   `json:"success"`
+	URL     string `json:"url,omitempty"`
+	APIFileMetadata
+	Error string          `json:"error,omitempty"`
+	Code  string          `json:"code,omitempty"`  // Machine readable error code, see the apierror package
+	Files []APIFileResult `json:"files,omitempty"` // Per file results when several files were uploaded
+	*APIQuota
+}
+
+// APIQuota is the storage usage of the user after an upload, in bytes
+type APIQuota struct {
+	Used      int64 `json:"used"`
+	Quota     int64 `json:"quota"`
+	Remaining int64 `json:"remaining"`
+}
+
+// quotaUsage returns the storage usage of the user, or nil if it can't be determined
+// as the upload itself already succeeded
+func (h *Handler) quotaUsage(r *http.Request, userID uuid.UUID) *APIQuota {
+	stats, err := h.service.GetFileStats(r.Context(), userID)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("user_id", userID.String()).
+			Msg("Failed to get user storage stats")
+		return nil
+	}
+	return &APIQuota{
+		Used:      stats.TotalSize,
+		Quota:     stats.StorageQuota,
+		Remaining: stats.StorageRemaining,
+	}
+}
+
+// APIFileResult is the outcome of a single file of a batch upload
+type APIFileResult struct {
+	FileName string `json:"file_name"`
+	Success  bool   `json:"success"`
+	URL      string `json:"url,omitempty"`
+	APIFileMetadata
+	Error string `json:"error,omitempty"`
+}
+
+// APIFileMetadata describes a successfully uploaded file
+type APIFileMetadata struct {
+	FileID       *uuid.UUID `json:"file_id,omitempty"`
+	DeleteURL    string     `json:"delete_url,omitempty"`   // Deletes the file without authentication
+	DeleteToken  string     `json:"delete_token,omitempty"` // Token for DELETE /api/v1/files/{fileID}?token=
+	OriginalName string     `json:"original_name,omitempty"`
+	Size         uint64     `json:"size,omitempty"`
+	MimeType     string     `json:"mime_type,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+}
+
+// fileMetadata returns the API metadata of an uploaded file
+func (h *Handler) fileMetadata(file *models.UploadedFile) APIFileMetadata {
+	return APIFileMetadata{
+		FileID:       &file.ID,
+		DeleteURL:    h.service.DeleteURL(file),
+		DeleteToken:  h.service.signer.DeleteToken(file.ID),
+		OriginalName: file.OriginalName,
+		Size:         file.FileSize,
+		MimeType:     file.MimeType,
+		ExpiresAt:    file.ExpiresAt,
+	}
+}
+
+// sendAPIResponse handles JSON response formatting consistently
+func sendAPIResponse(w http.ResponseWriter, status int, success bool, url string, err error) {
+	response := APIUploadResponse{
+		Success: success,
+		URL:     url,
+	}
+
+	if err != nil {
+		response.Error = err.Error()
+		response.Code = apierror.CodeForStatus(status)
+	}
+
+	writeAPIResponse(w, status, response)
+}
+
+func writeAPIResponse(w http.ResponseWriter, status int, response APIUploadResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error encoding response")
+	}
+}
+
+// HandleAPIUpload handles file upload through the API with minimal configuration
+func (h *Handler) HandleAPIUpload(w http.ResponseWriter, r *http.Request) {
+	log.Info().
+		Str("remoteAddr", r.RemoteAddr).
+		Msg("API Upload request from")
+
+	// Get user from context
+	userContext := userctx.GetUserFromContext(r.Context())
+	if userContext == nil {
+		sendAPIResponse(w, http.StatusUnauthorized, false, "", errors.New("unauthorized"))
+		return
+	}
+
+	// Reject bodies announced too large before reading any of them
+	if r.ContentLength > BodyLimit(h.service.config.UploadMaxSize, h.service.config.UploadMaxFiles) {
+		sendAPIResponse(w, http.StatusRequestEntityTooLarge, false, "", ErrFileTooLarge)
+		return
+	}
+
+	if !h.checkAPIQuota(w, r, userContext.ID) {
+		return
+	}
+
+	allowSlowTransfer(w, true)
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		if bodyTooLarge(err) {
+			sendAPIResponse(w, http.StatusRequestEntityTooLarge, false, "", ErrFileTooLarge)
+			return
+		}
+		sendAPIResponse(w, http.StatusBadRequest, false, "", err)
+		return
+	}
+	headers := r.MultipartForm.File["file"]
+	if len(headers) == 0 {
+		sendAPIResponse(w, http.StatusBadRequest, false, "", ErrNoFile)
+		return
+	}
+
+	opts, ok := parseAPIUploadOptions(w, r)
+	if !ok {
+		return
+	}
+
+	results, err := h.service.UploadFiles(r.Context(), userContext.ID, headers, opts.URLType, opts.ExpiresIn, opts.ForceDownload)
+	if errors.Is(err, ErrQuotaExceeded) || errors.Is(err, ErrFileLimitReached) || errors.Is(err, ErrTooManyFiles) {
+		sendAPIResponse(w, http.StatusBadRequest, false, "", err)
+		return
+	}
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Upload error")
+		sendAPIResponse(w, http.StatusInternalServerError, false, "", errors.New("upload failed"))
+		return
+	}
+
+	// A single file keeps the original response format
+	if len(results) == 1 {
+		h.writeAPIUploadResult(w, r, results[0].File, results[0].Err)
+		return
+	}
+
+	response := APIUploadResponse{Success: true}
+	succeeded := 0
+	for _, result := range results {
+		fileResult := APIFileResult{FileName: result.FileName}
+		if result.Err != nil {
+			log.Error().
+				Err(result.Err).
+				Str("filename", result.FileName).
+				Msg("Upload error")
+			fileResult.Error = uploadErrorMessage(result.Err)
+			response.Success = false
+		} else {
+			fileResult.Success = true
+			fileResult.URL = h.fileURL(result.File)
+			fileResult.APIFileMetadata = h.fileMetadata(result.File)
+			succeeded++
+		}
+		response.Files = append(response.Files, fileResult)
+	}
+
+	// Several files have no single Location, the metadata of each is in the response
+	status := http.StatusCreated
+	switch {
+	case succeeded == 0:
+		status = http.StatusBadRequest
+	case succeeded < len(results):
+		status = http.StatusMultiStatus
+	}
+
+	if succeeded > 0 {
+		response.APIQuota = h.quotaUsage(r, userContext.ID)
+	}
+	writeAPIResponse(w, status, response)
+}
+
+// HandleAPIPutUpload uploads the raw request body as a single file, e.g. with curl --upload-file.
+// The name comes from the X-Filename header, or is derived from the Content-Type.
+func (h *Handler) HandleAPIPutUpload(w http.ResponseWriter, r *http.Request) {
+	userContext := userctx.GetUserFromContext(r.Context())
+	if userContext == nil {
+		sendAPIResponse(w, http.StatusUnauthorized, false, "", errors.New("unauthorized"))
+		return
+	}
+
+	filename := rawUploadFilename(r)
+	if filename == "" {
+		sendAPIResponse(w, http.StatusBadRequest, false, "", ErrNoFilename)
+		return
+	}
+
+	if r.ContentLength > h.service.config.UploadMaxSize {
+		sendAPIResponse(w, http.StatusRequestEntityTooLarge, false, "", ErrFileTooLarge)
+		return
+	}
+	if !h.checkAPIQuota(w, r, userContext.ID) {
+		return
+	}
+	allowSlowTransfer(w, true)
+
+	opts, ok := parseAPIUploadOptions(w, r)
+	if !ok {
+		return
+	}
+
+	// Validation and scanning rewind the file, so the body is buffered on disk first
+	tmp, err := os.CreateTemp("", "volaticus-upload-*")
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Failed to create temporary upload file")
+		sendAPIResponse(w, http.StatusInternalServerError, false, "", errors.New("upload failed"))
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	body := http.MaxBytesReader(w, r.Body, h.service.config.UploadMaxSize)
+	size, err := io.Copy(tmp, body)
+	if err != nil {
+		if bodyTooLarge(err) {
+			sendAPIResponse(w, http.StatusRequestEntityTooLarge, false, "", ErrFileTooLarge)
+			return
+		}
+		sendAPIResponse(w, http.StatusBadRequest, false, "", errors.New("failed to read request body"))
+		return
+	}
+	if size == 0 {
+		sendAPIResponse(w, http.StatusBadRequest, false, "", ErrNoFile)
+		return
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		sendAPIResponse(w, http.StatusInternalServerError, false, "", errors.New("upload failed"))
+		return
+	}
+
+	file, err := h.service.UploadFile(r.Context(), &UploadRequest{
+		File:          tmp,
+		Header:        &multipart.FileHeader{Filename: filename, Size: size},
+		URLType:       opts.URLType,
+		UserID:        userContext.ID,
+		ExpiresIn:     opts.ExpiresIn,
+		ForceDownload: opts.ForceDownload,
+	})
+	h.writeAPIUploadResult(w, r, file, err)
+}
+
+// rawUploadFilename returns the name of a raw upload, empty if neither
+// X-Filename nor a Content-Type with a known extension is present
+func rawUploadFilename(r *http.Request) string {
+	if name := r.Header.Get("X-Filename"); name != "" {
+		// Clients may percent-encode names that aren't ASCII
+		if decoded, err := url.PathUnescape(name); err == nil {
+			name = decoded
+		}
+		// Like multipart file names, only the last path element is kept
+		if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+			name = name[i+1:]
+		}
+		if name = strings.TrimSpace(name); name != "" && name != "." && name != ".." {
+			return name
+		}
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	extensions, err := mime.ExtensionsByType(mediaType)
+	if err != nil || len(extensions) == 0 {
+		return ""
+	}
+	return "upload" + extensions[0]
+}
+
+// apiUploadOptions are the upload settings API clients pass as headers
+type apiUploadOptions struct {
+	URLType       URLType
+	ExpiresIn     *time.Duration
+	ForceDownload bool
+}
+
+// parseAPIUploadOptions reads the Url-Type, X-Expires-In and X-Force-Download headers,
+// writing an error response if one is invalid
+func parseAPIUploadOptions(w http.ResponseWriter, r *http.Request) (apiUploadOptions, bool) {
+	opts := apiUploadOptions{URLType: URLTypeDefault}
+
+	if typeHeader := r.Header.Get("Url-Type"); typeHeader != "" {
+		parsedType, err := ParseURLType(typeHeader)
+		if err != nil {
+			sendAPIResponse(w, http.StatusBadRequest, false, "", ErrInvalidURLType)
+			return opts, false
+		}
+		opts.URLType = parsedType
+	}
+
+	expiresIn, err := parseExpiresIn(r.Header.Get("X-Expires-In"))
+	if err != nil {
+		sendAPIResponse(w, http.StatusBadRequest, false, "", ErrInvalidExpiration)
+		return opts, false
+	}
+	opts.ExpiresIn = expiresIn
+
+	opts.ForceDownload = r.Header.Get("X-Force-Download") == "true"
+	return opts, true
+}
+
+// checkAPIQuota rejects an upload whose declared size would exceed the user's quota, before the body is read
+func (h *Handler) checkAPIQuota(w http.ResponseWriter, r *http.Request, userID uuid.UUID) bool {
+	stats, err := h.service.repo.GetFileStats(r.Context(), userID)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("user_id", userID.String()).
+			Msg("Failed to get user storage stats")
+		sendAPIResponse(w, http.StatusInternalServerError, false, "", errors.New("failed to check storage quota"))
+		return false
+	}
+
+	if stats.TotalSize+r.ContentLength > h.service.config.UploadUserQuota {
+		log.Warn().
+			Str("user_id", userID.String()).
+			Int64("current_size", stats.TotalSize).
+			Int64("upload_size", r.ContentLength).
+			Int64("quota", h.service.config.UploadUserQuota).
+			Msg("Upload would exceed user quota")
+		sendAPIResponse(w, http.StatusBadRequest, false, "", fmt.Errorf("upload would exceed your storage quota of %s", formatSize(h.service.config.UploadUserQuota)))
+		return false
+	}
+	return true
+}
+
+// allowSlowTransfer lifts the server's write timeout, and the read timeout of uploads, for
+// requests moving whole files. Those take longer than the timeouts on slow connections, uploads
+// stay bounded by the body size limit and both end when the client goes away.
+func allowSlowTransfer(w http.ResponseWriter, upload bool) {
+	rc := http.NewResponseController(w)
+	if upload {
+		if err := rc.SetReadDeadline(time.Time{}); err != nil {
+			log.Debug().
+				Err(err).
+				Msg("Could not clear read deadline for upload")
+		}
+	}
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Debug().
+			Err(err).
+			Msg("Could not clear write deadline for file transfer")
+	}
+}
+
+// bodyTooLarge reports whether reading the request body failed on its size limit
+func bodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+// writeAPIUploadResult writes the response of a single uploaded file
+func (h *Handler) writeAPIUploadResult(w http.ResponseWriter, r *http.Request, file *models.UploadedFile, err error) {
+	switch {
+	case err == nil:
+		w.Header().Set("Location", h.service.config.BaseURL+"/api/v1/files/"+file.ID.String())
+		writeAPIResponse(w, http.StatusCreated, APIUploadResponse{
+			Success:         true,
+			URL:             h.fileURL(file),
+			APIFileMetadata: h.fileMetadata(file),
+			APIQuota:        h.quotaUsage(r, file.UserID),
+		})
+	case errors.Is(err, ErrFileTooLarge):
+		sendAPIResponse(w, http.StatusRequestEntityTooLarge, false, "", ErrFileTooLarge)
+	case errors.Is(err, ErrInfected):
+		sendAPIResponse(w, http.StatusUnprocessableEntity, false, "", err)
+	case errors.Is(err, ErrQuotaExceeded), errors.Is(err, ErrFileLimitReached), errors.Is(err, ErrValidationFailed):
+		sendAPIResponse(w, http.StatusBadRequest, false, "", err)
+	default:
+		log.Error().
+			Err(err).
+			Msg("Upload error")
+		sendAPIResponse(w, http.StatusInternalServerError, false, "", errors.New(uploadErrorMessage(err)))
+	}
+}
+
+// HandleAPIDeleteFile deletes a file using the delete token from its upload response.
+// Without a token the request must be authenticated with an API token of the file owner.
+func (h *Handler) HandleAPIDeleteFile(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "fileID"))
+	if err != nil {
+		sendAPIResponse(w, http.StatusBadRequest, false, "", errors.New("invalid file ID"))
+		return
+	}
+
+	if token := r.URL.Query().Get("token"); token != "" {
+		err = h.service.DeleteFileByToken(r.Context(), id, token)
+		h.recordFileDelete(r, id, err, "delete token")
+	} else if user := context.GetUserFromContext(r.Context()); user != nil {
+		err = h.service.DeleteFileByID(r.Context(), id, user.ID)
+		h.recordFileDelete(r, id, err, "")
+	} else {
+		sendAPIResponse(w, http.StatusUnauthorized, false, "", errors.New("delete token or API token required"))
+		return
+	}
+
+	switch {
+	case err == nil:
+		sendAPIResponse(w, http.StatusOK, true, "", nil)
+	case errors.Is(err, ErrInvalidSignature):
+		sendAPIResponse(w, http.StatusForbidden, false, "", errors.New("invalid delete token"))
+	case errors.Is(err, ErrUnauthorized), errors.Is(err, ErrNoRows):
+		// Files of other users look missing, so IDs can't be probed for existence
+		sendAPIResponse(w, http.StatusNotFound, false, "", errors.New("file not found"))
+	default:
+		log.Error().
+			Err(err).
+			Str("file_id", id.String()).
+			Msg("Error deleting file by token")
+		sendAPIResponse(w, http.StatusInternalServerError, false, "", errors.New("delete failed"))
+	}
+}
+
+// pageParams parses the page and limit query parameters, falling back to the configured page
+// size. A limit above the configured maximum is capped.
+func (h *Handler) pageParams(r *http.Request) (page, limit int) {
+	page, limit = 1, h.service.config.PageSize
+
+	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = min(l, h.service.config.MaxPageSize)
+		}
+	}
+
+	return page, limit
+}
+
+// APIFile is a file in the API file list
+type APIFile struct {
+	URL string `json:"url"`
+	APIFileMetadata
+	CreatedAt      time.Time  `json:"created_at"`
+	AccessCount    int        `json:"access_count"`
+	LastAccessedAt *time.Time `json:"last_accessed_at,omitempty"`
+	Visibility     string     `json:"visibility"`
+	StorageMissing bool       `json:"storage_missing,omitempty"` // The file was lost in storage and can't be downloaded
+	FolderID       *uuid.UUID `json:"folder_id,omitempty"`       // Folder the file was moved to, missing at the top level
+}
+
+// apiFile returns the API representation of a file of the token owner
+func (h *Handler) apiFile(file *models.UploadedFile) APIFile {
+	return APIFile{
+		URL:             h.fileURL(file),
+		APIFileMetadata: h.fileMetadata(file),
+		CreatedAt:       file.CreatedAt,
+		AccessCount:     file.AccessCount,
+		LastAccessedAt:  file.LastAccessedAt,
+		Visibility:      file.Visibility,
+		StorageMissing:  file.StorageMissing,
+		FolderID:        file.FolderID,
+	}
+}
+
+// APIFileListResponse is a page of the files of the API token owner. Cursor pages have no page
+// numbers and carry the cursor of the following page until the last one.
+type APIFileListResponse struct {
+	Files      []APIFile `json:"files"`
+	Page       int       `json:"page,omitempty"`
+	Limit      int       `json:"limit"`
+	Total      int       `json:"total"`
+	TotalPages int       `json:"total_pages,omitempty"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// HandleAPIListFiles handles GET /api/v1/files, listing the files of the API token owner
+func (h *Handler) HandleAPIListFiles(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		apierror.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	after, cursorPaging, err := cursor.FromRequest(r)
+	if err != nil {
+		apierror.Error(w, r, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
+
+	// folder_id limits the list to the files directly in one folder, without it all files are listed
+	folderID, err := parseFolderID(r.URL.Query().Get("folder_id"))
+	if err != nil {
+		apierror.Error(w, r, "Invalid folder ID", http.StatusBadRequest)
+		return
+	}
+	if folderID != nil {
+		_, err := h.service.GetFolder(r.Context(), user.ID, *folderID)
+		if errors.Is(err, ErrFolderNotFound) {
+			apierror.Error(w, r, "Folder not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("folder_id", folderID.String()).
+				Msg("Error fetching folder")
+			apierror.Error(w, r, "Error fetching folder", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	page, limit := h.pageParams(r)
+	var files []*models.UploadedFile
+	switch {
+	case cursorPaging && folderID != nil:
+		// One more file than needed tells whether there is a next page
+		files, err = h.service.GetFolderFilesAfter(r.Context(), user.ID, folderID, after, limit+1)
+	case cursorPaging:
+		files, err = h.service.GetUserFilesAfter(r.Context(), user.ID, after, limit+1)
+	case folderID != nil:
+		files, err = h.service.GetFolderFiles(r.Context(), user.ID, folderID, limit, (page-1)*limit)
+	default:
+		files, err = h.service.GetUserFiles(r.Context(), user.ID, limit, (page-1)*limit)
+	}
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("user_id", user.ID.String()).
+			Msg("Error fetching files")
+		apierror.Error(w, r, "Error fetching files", http.StatusInternalServerError)
+		return
+	}
+
+	var total int
+	if folderID != nil {
+		total, err = h.service.GetFolderFilesCount(r.Context(), user.ID, folderID)
+	} else {
+		total, err = h.service.GetUserFilesCount(r.Context(), user.ID)
+	}
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("user_id", user.ID.String()).
+			Msg("Error fetching file count")
+		apierror.Error(w, r, "Error fetching file count", http.StatusInternalServerError)
+		return
+	}
+
+	response := APIFileListResponse{
+		Limit: limit,
+		Total: total,
+	}
+	if cursorPaging {
+		if len(files) > limit {
+			files = files[:limit]
+			last := files[limit-1]
+			response.NextCursor = cursor.New(last.CreatedAt, last.ID).String()
+		}
+	} else {
+		response.Page = page
+		response.TotalPages = (total + limit - 1) / limit
+	}
+	response.Files = make([]APIFile, 0, len(files))
+	for _, file := range files {
+		response.Files = append(response.Files, h.apiFile(file))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error encoding file list")
+	}
+}
+
+// HandleAPIGetFile handles GET /api/v1/files/{fileID}, returning one file of the API token owner
+func (h *Handler) HandleAPIGetFile(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		apierror.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "fileID"))
+	if err != nil {
+		apierror.Error(w, r, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	file, err := h.service.GetUserFile(r.Context(), id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUnauthorized), errors.Is(err, ErrNoRows):
+			// Files of other users look missing, so IDs can't be probed for existence
+			apierror.Error(w, r, "File not found", http.StatusNotFound)
+		default:
+			log.Error().
+				Err(err).
+				Str("file_id", id.String()).
+				Msg("Error fetching file")
+			apierror.Error(w, r, "Error fetching file", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.apiFile(file)); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error encoding file")
+	}
+}
+
+// HandleFilesList handles the GET /files/list endpoint
+func (h *Handler) HandleFilesList(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	page, limit := h.pageParams(r)
+	offset := (page - 1) * limit
+
+	// The list shows the files directly in the open folder, the top level without folder_id
+	folderID, err := parseFolderID(r.URL.Query().Get("folder_id"))
+	if err != nil {
+		http.Error(w, "Invalid folder ID", http.StatusBadRequest)
+		return
+	}
+	folders, err := h.service.OpenFolder(r.Context(), user.ID, folderID)
+	if errors.Is(err, ErrFolderNotFound) {
+		http.Error(w, "Folder not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error fetching folders")
+		http.Error(w, "Error fetching folders", http.StatusInternalServerError)
+		return
+	}
+
+	// Get files and stats for the current user with pagination
+	files, err := h.service.GetFolderFiles(r.Context(), user.ID, folderID, limit, offset)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error fetching files")
+		http.Error(w, "Error fetching files", http.StatusInternalServerError)
+		return
+	}
+
+	// Get total count for pagination
+	total, err := h.service.GetFolderFilesCount(r.Context(), user.ID, folderID)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error fetching file count")
+		http.Error(w, "Error fetching file count", http.StatusInternalServerError)
+		return
+	}
+
+	totalPages := (total + limit - 1) / limit // Ceiling division
+
+	// Render the file list component
+	props := components.FileListProps{
+		Files:       files,
+		ShowPaging:  true,
+		Page:        page,
+		TotalPages:  totalPages,
+		EmptyState:  "No files uploaded yet",
+		ShowFolders: true,
+		Folder:      folders.Current,
+		Breadcrumbs: folders.Path,
+		Folders:     folders.Children,
+		MoveTargets: folders.Targets,
+	}
+
+	err = components.FileListComponent(props).Render(r.Context(), w)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error rendering file list")
+		http.Error(w, "Error rendering file list", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandleRecentFiles returns the last N files for a user
 func (h *Handler) HandleRecentFiles(w http.ResponseWriter, r *http.Request, limit int) {
 	user := context.GetUserFromContext(r.Context())
 	if user == nil {
@@ -465,6 +1628,7 @@ func (h *Handler) HandleDeleteFile(w http.ResponseWriter, r *http.Request) {
 
 	// Delete the file
 	err = h.service.DeleteFileByID(r.Context(), id, user.ID)
+	h.recordFileDelete(r, id, err, "")
 	if err != nil {
 		switch {
 		case errors.Is(err, ErrUnauthorized):
@@ -487,7 +1651,149 @@ func (h *Handler) HandleDeleteFile(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-// HandleGetFileStats returns the file stats component for a user
+// HandleBulkDeleteFiles deletes several files of the user
+func (h *Handler) HandleBulkDeleteFiles(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		apierror.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.BulkDeleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.IDs) == 0 {
+		apierror.Error(w, r, "A list of file IDs is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) > models.MaxBulkDeleteIDs {
+		apierror.Error(w, r, fmt.Sprintf("At most %d files can be deleted at once", models.MaxBulkDeleteIDs), http.StatusBadRequest)
+		return
+	}
+
+	results, err := h.service.DeleteFiles(r.Context(), req.IDs, user.ID)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("user_id", user.ID.String()).
+			Msg("Error bulk deleting files")
+		apierror.Error(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.BulkDeleteResponse{Results: results}
+	for _, result := range results {
+		var resultErr error
+		if result.Success {
+			response.Deleted++
+		} else {
+			resultErr = errors.New(result.Error)
+		}
+		h.recordFileDelete(r, result.ID, resultErr, "bulk delete")
+	}
+
+	if response.Deleted > 0 {
+		w.Header().Set("HX-Trigger", "fileDeleted")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error encoding bulk delete response")
+	}
+}
+
+// HandleStorageReport returns the storage report as JSON. The within query parameter sets how far
+// ahead expiring files are listed, e.g. 72h, defaulting to a day.
+func (h *Handler) HandleStorageReport(w http.ResponseWriter, r *http.Request) {
+	within := 24 * time.Hour
+	if withinStr := r.URL.Query().Get("within"); withinStr != "" {
+		var err error
+		within, err = time.ParseDuration(withinStr)
+		if err != nil || within < 0 {
+			apierror.Error(w, r, "Invalid within duration", http.StatusBadRequest)
+			return
+		}
+	}
+
+	report, err := h.service.StorageReport(r.Context(), within)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error building storage report")
+		apierror.Error(w, r, "Error building storage report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error encoding storage report")
+	}
+}
+
+// HandleStorageSync syncs storage with the database. It is a dry run listing what would be deleted
+// unless the confirm query parameter is true.
+func (h *Handler) HandleStorageSync(w http.ResponseWriter, r *http.Request) {
+	confirm := false
+	if confirmStr := r.URL.Query().Get("confirm"); confirmStr != "" {
+		var err error
+		confirm, err = strconv.ParseBool(confirmStr)
+		if err != nil {
+			apierror.Error(w, r, "Invalid confirm parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	result, err := h.service.SyncStorageWithDatabase(r.Context(), !confirm)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Bool("dry_run", !confirm).
+			Msg("Error syncing storage")
+		h.audit.Record(r, audit.Event{Action: audit.ActionStorageSync, Result: audit.ResultFailure, Details: err.Error()})
+		apierror.Error(w, r, "Error syncing storage", http.StatusInternalServerError)
+		return
+	}
+	h.audit.Record(r, audit.Event{
+		Action: audit.ActionStorageSync,
+		Details: fmt.Sprintf("dry_run=%t orphaned=%d missing=%d failed=%d",
+			result.DryRun, len(result.OrphanedObjects), len(result.MissingObjects), result.Failed),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error encoding storage sync result")
+	}
+}
+
+// HandleVerifyStorage checks every file record for its object in storage and flags the missing ones
+func (h *Handler) HandleVerifyStorage(w http.ResponseWriter, r *http.Request) {
+	result, err := h.service.VerifyStorage(r.Context())
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error verifying storage")
+		h.audit.Record(r, audit.Event{Action: audit.ActionStorageVerify, Result: audit.ResultFailure, Details: err.Error()})
+		apierror.Error(w, r, "Error verifying storage", http.StatusInternalServerError)
+		return
+	}
+	h.audit.Record(r, audit.Event{
+		Action: audit.ActionStorageVerify,
+		Details: fmt.Sprintf("missing=%d flagged=%d restored=%d failed=%d",
+			len(result.Missing), result.Flagged, result.Restored, result.Failed),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error encoding storage verification result")
+	}
+}
+
+// HandleGetFileStats returns the file stats component for a user, or the stats as JSON outside of HTMX
 func (h *Handler) HandleGetFileStats(w http.ResponseWriter, r *http.Request) {
 	user := context.GetUserFromContext(r.Context())
 	if user == nil {
@@ -501,9 +1807,326 @@ func (h *Handler) HandleGetFileStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Stats are rendered for HTMX, other clients get the numbers as JSON
+	if r.Header.Get("HX-Request") != "true" {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(stats); err != nil {
+			log.Error().
+				Err(err).
+				Msg("Error encoding file stats")
+		}
+		return
+	}
+
 	err = components.FileStatsComponent(stats).Render(r.Context(), w)
 	if err != nil {
 		http.Error(w, "Error rendering file stats", http.StatusInternalServerError)
 		return
 	}
 }
+
+// HandleUploadAvatar replaces the profile picture of the authenticated user with the image
+// in the avatar form field
+func (h *Handler) HandleUploadAvatar(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	file, header, err := r.FormFile("avatar")
+	if err != nil {
+		if bodyTooLarge(err) {
+			http.Error(w, "File exceeds maximum allowed size", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid File", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	if err := h.service.SetAvatar(r.Context(), user.ID, file, header); err != nil {
+		switch {
+		case errors.Is(err, ErrFileTooLarge), errors.Is(err, ErrImageTooLarge):
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		case errors.Is(err, ErrInvalidAvatar), errors.Is(err, ErrInfected):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		default:
+			log.Error().
+				Err(err).
+				Str("user_id", user.ID.String()).
+				Msg("Error saving avatar")
+			http.Error(w, "Error saving avatar", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// The picture is shown in the navigation of every page
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Refresh", "true")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleServeAvatar serves the profile picture of a user
+func (h *Handler) HandleServeAvatar(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.ServeAvatar(r.Context(), w, userID); err != nil {
+		if errors.Is(err, ErrNoAvatar) {
+			http.Error(w, "Avatar not found", http.StatusNotFound)
+			return
+		}
+		log.Error().
+			Err(err).
+			Str("user_id", userID.String()).
+			Msg("Error serving avatar")
+		http.Error(w, "Error serving avatar", http.StatusInternalServerError)
+	}
+}
+
+// parseFolderID parses an optional folder ID, empty names the top level
+func parseFolderID(value string) (*uuid.UUID, error) {
+	if value == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// decodeFolderRequest reads the body of a folder create or rename. The web interface asks for
+// the name with hx-prompt, which sends it in a header instead of the body.
+func decodeFolderRequest(r *http.Request) (*models.FolderRequest, error) {
+	var req models.FolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if req.Name == "" {
+		req.Name = r.Header.Get("HX-Prompt")
+	}
+	return &req, nil
+}
+
+// APIFolderListResponse lists every folder of the user, nesting follows parent_id
+type APIFolderListResponse struct {
+	Folders []*models.Folder `json:"folders"`
+}
+
+// HandleListFolders handles GET /api/v1/folders, listing the folders of the user
+func (h *Handler) HandleListFolders(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		apierror.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	folders, err := h.service.ListFolders(r.Context(), user.ID)
+	if err != nil {
+		h.handleFolderError(w, r, err, "listing folders")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(APIFolderListResponse{Folders: folders}); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error encoding folder list")
+	}
+}
+
+// HandleCreateFolder creates a folder of the user, inside parent_id if it is given
+func (h *Handler) HandleCreateFolder(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		apierror.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	req, err := decodeFolderRequest(r)
+	if err != nil {
+		apierror.Error(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	parentID, err := parseFolderID(req.ParentID)
+	if err != nil {
+		apierror.Error(w, r, "Invalid parent folder ID", http.StatusBadRequest)
+		return
+	}
+
+	folder, err := h.service.CreateFolder(r.Context(), user.ID, req.Name, parentID)
+	if err != nil {
+		h.handleFolderError(w, r, err, "creating folder")
+		return
+	}
+
+	w.Header().Set("HX-Trigger", "folderChanged")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(folder); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error encoding folder")
+	}
+}
+
+// HandleRenameFolder gives a folder of the user a new name
+func (h *Handler) HandleRenameFolder(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		apierror.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "folderID"))
+	if err != nil {
+		apierror.Error(w, r, "Invalid folder ID", http.StatusBadRequest)
+		return
+	}
+	req, err := decodeFolderRequest(r)
+	if err != nil {
+		apierror.Error(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	folder, err := h.service.RenameFolder(r.Context(), user.ID, id, req.Name)
+	if err != nil {
+		h.handleFolderError(w, r, err, "renaming folder")
+		return
+	}
+
+	w.Header().Set("HX-Trigger", "folderChanged")
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(folder); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error encoding folder")
+	}
+}
+
+// HandleDeleteFolder deletes a folder of the user, its contents are handled as FOLDER_DELETE_MODE says
+func (h *Handler) HandleDeleteFolder(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		apierror.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "folderID"))
+	if err != nil {
+		apierror.Error(w, r, "Invalid folder ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.DeleteFolder(r.Context(), user.ID, id); err != nil {
+		h.handleFolderError(w, r, err, "deleting folder")
+		return
+	}
+
+	w.Header().Set("HX-Trigger", "folderChanged")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleMoveFile moves one file of the user into the folder_id of the body, the top level if it is empty
+func (h *Handler) HandleMoveFile(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		apierror.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "fileID"))
+	if err != nil {
+		apierror.Error(w, r, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+	var req models.MoveFilesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Error(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	folderID, err := parseFolderID(req.FolderID)
+	if err != nil {
+		apierror.Error(w, r, "Invalid folder ID", http.StatusBadRequest)
+		return
+	}
+
+	moved, err := h.service.MoveFiles(r.Context(), user.ID, []uuid.UUID{id}, folderID)
+	if err != nil {
+		h.handleFolderError(w, r, err, "moving file")
+		return
+	}
+	if moved == 0 {
+		apierror.Error(w, r, "File not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("HX-Trigger", "folderChanged")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleMoveFiles handles POST /api/v1/files/move, moving several files of the user at once
+func (h *Handler) HandleMoveFiles(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	if user == nil {
+		apierror.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.MoveFilesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.IDs) == 0 {
+		apierror.Error(w, r, "A list of file IDs is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) > models.MaxMoveFileIDs {
+		apierror.Error(w, r, fmt.Sprintf("At most %d files can be moved at once", models.MaxMoveFileIDs), http.StatusBadRequest)
+		return
+	}
+	folderID, err := parseFolderID(req.FolderID)
+	if err != nil {
+		apierror.Error(w, r, "Invalid folder ID", http.StatusBadRequest)
+		return
+	}
+
+	moved, err := h.service.MoveFiles(r.Context(), user.ID, req.IDs, folderID)
+	if err != nil {
+		h.handleFolderError(w, r, err, "moving files")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(models.MoveFilesResponse{Moved: moved}); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error encoding move response")
+	}
+}
+
+// handleFolderError writes the response of a failed folder operation
+func (h *Handler) handleFolderError(w http.ResponseWriter, r *http.Request, err error, action string) {
+	switch {
+	case errors.Is(err, ErrFolderNotFound):
+		apierror.Error(w, r, "Folder not found", http.StatusNotFound)
+	case errors.Is(err, ErrInvalidFolderName):
+		apierror.Error(w, r, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrFolderExists):
+		apierror.Error(w, r, "A folder with this name already exists here", http.StatusConflict)
+	case errors.Is(err, ErrFolderNotEmpty):
+		apierror.Respond(w, r, &apierror.APIError{
+			Code:    apierror.ErrCodeRejected,
+			Message: "Folder is not empty, move or delete its files and folders first",
+		}, http.StatusConflict)
+	default:
+		log.Error().
+			Err(err).
+			Msg("Error " + action)
+		apierror.Error(w, r, "Internal server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,684 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"volaticus-go/internal/common/clientip"
+	"volaticus-go/internal/common/cursor"
+	"volaticus-go/internal/common/models"
+	"volaticus-go/internal/config"
+	userctx "volaticus-go/internal/context"
+	"volaticus-go/internal/storage"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func TestForcesDownload(t *testing.T) {
+	tests := []struct {
+		name    string
+		global  bool
+		file    bool
+		account bool
+		query   string
+		want    bool
+	}{
+		{name: "inline by default"},
+		{name: "query parameter", query: "?download=true", want: true},
+		{name: "file flag", file: true, want: true},
+		{name: "account default", account: true, want: true},
+		{name: "operator setting", global: true, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(&service{config: &config.Config{ForceDownload: tt.global}}, nil)
+			r := httptest.NewRequest("GET", "/f/file"+tt.query, nil)
+			file := &models.UploadedFile{UserID: uuid.New(), ForceDownload: tt.file, OwnerForceDownload: tt.account}
+
+			if got := h.forcesDownload(r, file); got != tt.want {
+				t.Errorf("forcesDownload() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVisibleTo(t *testing.T) {
+	owner := uuid.New()
+	tests := []struct {
+		name       string
+		visibility string
+		user       *userctx.UserInfo
+		want       bool
+	}{
+		{name: "public without session", visibility: models.FileVisibilityPublic, want: true},
+		{name: "files from before visibility", visibility: "", want: true},
+		{name: "private without session", visibility: models.FileVisibilityPrivate},
+		{name: "private for another user", visibility: models.FileVisibilityPrivate, user: &userctx.UserInfo{ID: uuid.New(), Username: "bob"}},
+		{name: "private for the owner", visibility: models.FileVisibilityPrivate, user: &userctx.UserInfo{ID: owner, Username: "alice"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/f/file", nil)
+			if tt.user != nil {
+				r = r.WithContext(userctx.WithUser(r.Context(), tt.user))
+			}
+			file := &models.UploadedFile{UserID: owner, Visibility: tt.visibility}
+
+			if got := visibleTo(r, file); got != tt.want {
+				t.Errorf("visibleTo() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestViewerKind(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        string
+	}{
+		{"image/png", "image"},
+		{"application/pdf", "pdf"},
+		{"text/plain; charset=utf-8", "text"},
+		{"application/json", "text"},
+		{"application/zip", ""},
+		{"video/mp4", ""},
+		{"not a type", ""},
+	}
+
+	for _, tt := range tests {
+		if got := viewerKind(tt.contentType); got != tt.want {
+			t.Errorf("viewerKind(%q) = %q, want %q", tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestRawUploadFilename(t *testing.T) {
+	tests := []struct {
+		name        string
+		filename    string
+		contentType string
+		want        string
+	}{
+		{name: "filename header", filename: "report.pdf", contentType: "application/pdf", want: "report.pdf"},
+		{name: "percent encoded", filename: "caf%C3%A9.txt", want: "café.txt"},
+		{name: "path is stripped", filename: `..\..\secret/notes.txt`, want: "notes.txt"},
+		{name: "derived from content type", contentType: "application/pdf; charset=binary", want: "upload.pdf"},
+		{name: "dot dot falls back to content type", filename: "..", contentType: "application/pdf", want: "upload.pdf"},
+		{name: "unknown content type", contentType: "application/x-unknown-thing", want: ""},
+		{name: "nothing derivable", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("PUT", "/api/v1/upload", nil)
+			if tt.filename != "" {
+				r.Header.Set("X-Filename", tt.filename)
+			}
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+
+			if got := rawUploadFilename(r); got != tt.want {
+				t.Errorf("rawUploadFilename() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteTextResults(t *testing.T) {
+	h := NewHandler(&service{config: &config.Config{BaseURL: "https://files.example.com"}}, nil)
+	results := []UploadResult{
+		{FileName: "a.png", File: &models.UploadedFile{URLValue: "a.png"}},
+		{FileName: "b.exe", Err: ErrInfected},
+	}
+
+	w := httptest.NewRecorder()
+	h.writeTextResults(w, results)
+
+	if w.Code != http.StatusMultiStatus {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusMultiStatus)
+	}
+	want := "https://files.example.com/f/a.png\nb.exe: file is infected\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+}
+
+// statsRepository reports fixed storage usage for every user
+type statsRepository struct {
+	Repository
+	stats models.FileStats
+}
+
+func (r statsRepository) GetFileStats(context.Context, uuid.UUID) (*models.FileStats, error) {
+	stats := r.stats
+	return &stats, nil
+}
+
+func TestHandleGetFileStatsJSON(t *testing.T) {
+	h := NewHandler(&service{repo: statsRepository{stats: models.FileStats{
+		TotalFiles:       2,
+		TotalSize:        300,
+		StorageQuota:     1000,
+		StorageRemaining: 700,
+	}}, config: &config.Config{}}, nil)
+
+	r := httptest.NewRequest("GET", "/files/stats", nil)
+	r = r.WithContext(userctx.WithUser(r.Context(), &userctx.UserInfo{ID: uuid.New(), Username: "alice"}))
+	w := httptest.NewRecorder()
+	h.HandleGetFileStats(w, r)
+
+	var got struct {
+		Used      int64 `json:"used"`
+		Quota     int64 `json:"quota"`
+		Remaining int64 `json:"remaining"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if got.Used != 300 || got.Quota != 1000 || got.Remaining != 700 {
+		t.Errorf("stats = %+v, want 300 used of 1000 with 700 remaining", got)
+	}
+}
+
+func TestPageParams(t *testing.T) {
+	h := NewHandler(&service{config: &config.Config{PageSize: 20, MaxPageSize: 30}}, nil)
+
+	tests := []struct {
+		query     string
+		wantPage  int
+		wantLimit int
+	}{
+		{query: "", wantPage: 1, wantLimit: 20},
+		{query: "page=3&limit=5", wantPage: 3, wantLimit: 5},
+		{query: "limit=100", wantPage: 1, wantLimit: 30},
+		{query: "page=0&limit=-1", wantPage: 1, wantLimit: 20},
+		{query: "page=x&limit=y", wantPage: 1, wantLimit: 20},
+	}
+	for _, tt := range tests {
+		page, limit := h.pageParams(httptest.NewRequest("GET", "/api/v1/files?"+tt.query, nil))
+		if page != tt.wantPage || limit != tt.wantLimit {
+			t.Errorf("pageParams(%q) = %d, %d, want %d, %d", tt.query, page, limit, tt.wantPage, tt.wantLimit)
+		}
+	}
+}
+
+func TestWriteAPIUploadResultCreated(t *testing.T) {
+	h := NewHandler(&service{
+		repo:   statsRepository{stats: models.FileStats{TotalSize: 300, StorageQuota: 1000, StorageRemaining: 700}},
+		config: &config.Config{BaseURL: "https://files.example.com"},
+		signer: NewURLSigner("secret"),
+	}, nil)
+	file := &models.UploadedFile{ID: uuid.New(), UserID: uuid.New(), URLValue: "a.png"}
+
+	w := httptest.NewRecorder()
+	h.writeAPIUploadResult(w, httptest.NewRequest("POST", "/api/v1/upload", nil), file, nil)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusCreated)
+	}
+	if want := "https://files.example.com/api/v1/files/" + file.ID.String(); w.Header().Get("Location") != want {
+		t.Errorf("Location = %q, want %q", w.Header().Get("Location"), want)
+	}
+
+	w = httptest.NewRecorder()
+	h.writeAPIUploadResult(w, httptest.NewRequest("POST", "/api/v1/upload", nil), nil, ErrInfected)
+	if w.Code != http.StatusUnprocessableEntity || w.Header().Get("Location") != "" {
+		t.Errorf("failed upload = %d with Location %q", w.Code, w.Header().Get("Location"))
+	}
+}
+
+// fileRepository looks files up by ID in a map
+type fileRepository struct {
+	Repository
+	files map[uuid.UUID]*models.UploadedFile
+}
+
+func (r fileRepository) GetByID(_ context.Context, id uuid.UUID) (*models.UploadedFile, error) {
+	file, ok := r.files[id]
+	if !ok {
+		return nil, ErrNoRows
+	}
+	return file, nil
+}
+
+func TestHandleAPIGetFile(t *testing.T) {
+	owner := uuid.New()
+	file := &models.UploadedFile{ID: uuid.New(), UserID: owner, URLValue: "a.png", FileSize: 2048, AccessCount: 3}
+	h := NewHandler(&service{
+		repo:   fileRepository{files: map[uuid.UUID]*models.UploadedFile{file.ID: file}},
+		config: &config.Config{BaseURL: "https://files.example.com"},
+		signer: NewURLSigner("secret"),
+	}, nil)
+	router := chi.NewRouter()
+	router.Get("/api/v1/files/{fileID}", h.HandleAPIGetFile)
+
+	tests := []struct {
+		name   string
+		fileID string
+		user   uuid.UUID
+		want   int
+	}{
+		{name: "owner", fileID: file.ID.String(), user: owner, want: http.StatusOK},
+		{name: "another user", fileID: file.ID.String(), user: uuid.New(), want: http.StatusNotFound},
+		{name: "unknown file", fileID: uuid.New().String(), user: owner, want: http.StatusNotFound},
+		{name: "invalid id", fileID: "nope", user: owner, want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/v1/files/"+tt.fileID, nil)
+			r = r.WithContext(userctx.WithUser(r.Context(), &userctx.UserInfo{ID: tt.user, Username: "alice"}))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			var got APIFile
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if got.URL != "https://files.example.com/f/a.png" || got.Size != 2048 || got.AccessCount != 3 {
+				t.Errorf("file = %+v, want the stored file", got)
+			}
+		})
+	}
+}
+
+// publicStorage serves every object from a fixed public base URL
+type publicStorage struct {
+	storage.StorageProvider
+}
+
+func (publicStorage) GetURL(_ context.Context, filename string) (string, time.Duration, error) {
+	return "https://cdn.example.com/" + filename, 0, nil
+}
+
+func TestHandleServeFileRedirectsToPublicObject(t *testing.T) {
+	file := &models.UploadedFile{ID: uuid.New(), URLValue: "a.png", UniqueFilename: "1700000000.png", MimeType: "image/png"}
+	h := NewHandler(&service{
+		repo:     servedFileRepository{file: file},
+		storage:  publicStorage{},
+		config:   &config.Config{Storage: config.StorageConfig{PublicObjects: true}, SandboxTypes: []string{"text/html"}},
+		clientIP: clientip.NewResolver(0, nil),
+	}, nil)
+	router := chi.NewRouter()
+	router.Get("/f/{fileUrl}", h.HandleServeFile)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/f/a.png", nil))
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "https://cdn.example.com/1700000000.png" {
+		t.Errorf("response = %d to %q, want a redirect to the public object", w.Code, w.Header().Get("Location"))
+	}
+}
+
+// servedFileRepository returns one file for every lookup and ignores access recording
+type servedFileRepository struct {
+	Repository
+	file *models.UploadedFile
+}
+
+func (r servedFileRepository) GetByURLValue(context.Context, string) (*models.UploadedFile, error) {
+	return r.file, nil
+}
+
+func (r servedFileRepository) RecordAccess(context.Context, *models.FileAccess) error {
+	return nil
+}
+
+func (r servedFileRepository) IncrementAccessCount(context.Context, uuid.UUID) error {
+	return nil
+}
+
+// countingStorage streams a fixed body and counts how often it was read
+type countingStorage struct {
+	storage.StorageProvider
+	streams int
+}
+
+func (s *countingStorage) Stream(_ context.Context, _ string, w http.ResponseWriter) error {
+	s.streams++
+	_, err := w.Write([]byte("content"))
+	return err
+}
+
+func TestHandleServeFileHead(t *testing.T) {
+	file := &models.UploadedFile{ID: uuid.New(), URLValue: "a.png", UniqueFilename: "1700000000.png", MimeType: "image/png", FileSize: 7}
+	store := &countingStorage{}
+	h := NewHandler(&service{
+		repo:     servedFileRepository{file: file},
+		storage:  store,
+		config:   &config.Config{SandboxTypes: []string{"text/html"}},
+		clientIP: clientip.NewResolver(0, nil),
+	}, nil)
+	router := chi.NewRouter()
+	router.Get("/f/{fileUrl}", h.HandleServeFile)
+	router.Head("/f/{fileUrl}", h.HandleServeFile)
+
+	head := httptest.NewRecorder()
+	router.ServeHTTP(head, httptest.NewRequest("HEAD", "/f/a.png", nil))
+	get := httptest.NewRecorder()
+	router.ServeHTTP(get, httptest.NewRequest("GET", "/f/a.png", nil))
+
+	if head.Code != http.StatusOK || head.Body.Len() != 0 {
+		t.Errorf("HEAD = %d with %d body bytes, want 200 without a body", head.Code, head.Body.Len())
+	}
+	if store.streams != 1 {
+		t.Errorf("object streamed %d times, want only for GET", store.streams)
+	}
+	if got := head.Header().Get("Content-Length"); got != "7" {
+		t.Errorf("HEAD Content-Length = %q, want 7", got)
+	}
+	for _, name := range []string{"Content-Type", "ETag", "Cache-Control", "Content-Disposition"} {
+		if head.Header().Get(name) != get.Header().Get(name) {
+			t.Errorf("HEAD %s = %q, GET sent %q", name, head.Header().Get(name), get.Header().Get(name))
+		}
+	}
+}
+
+func TestHandleServeFileConditional(t *testing.T) {
+	// Last-Modified is the upload time, storage isn't asked for the modification time of the object
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)
+	file := &models.UploadedFile{ID: uuid.New(), URLValue: "a.png", UniqueFilename: "1700000000.png", MimeType: "image/png", FileSize: 7, CreatedAt: createdAt}
+	store := &countingStorage{}
+	h := NewHandler(&service{
+		repo:     servedFileRepository{file: file},
+		storage:  store,
+		config:   &config.Config{SandboxTypes: []string{"text/html"}},
+		clientIP: clientip.NewResolver(0, nil),
+	}, nil)
+	router := chi.NewRouter()
+	router.Get("/f/{fileUrl}", h.HandleServeFile)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{name: "unconditional", want: http.StatusOK},
+		{name: "not modified since", headers: map[string]string{"If-Modified-Since": "Wed, 01 May 2024 12:00:00 GMT"}, want: http.StatusNotModified},
+		{name: "modified since", headers: map[string]string{"If-Modified-Since": "Wed, 01 May 2024 11:59:59 GMT"}, want: http.StatusOK},
+		{name: "invalid date", headers: map[string]string{"If-Modified-Since": "yesterday"}, want: http.StatusOK},
+		{name: "etag takes precedence", headers: map[string]string{
+			"If-None-Match":     `"other"`,
+			"If-Modified-Since": "Wed, 01 May 2024 12:00:00 GMT",
+		}, want: http.StatusOK},
+		{name: "revalidation", headers: map[string]string{
+			"If-Modified-Since": "Wed, 01 May 2024 12:00:00 GMT",
+			"Cache-Control":     "no-cache",
+		}, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/f/a.png", nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if got := w.Header().Get("Last-Modified"); got != "Wed, 01 May 2024 12:00:00 GMT" {
+				t.Errorf("Last-Modified = %q", got)
+			}
+		})
+	}
+}
+
+// cursorRepository lists files newest first like the keyset query of the repository
+type cursorRepository struct {
+	Repository
+	files []*models.UploadedFile
+}
+
+func (r cursorRepository) GetUserFilesAfter(_ context.Context, _ uuid.UUID, after *cursor.Cursor, limit int) ([]*models.UploadedFile, error) {
+	var files []*models.UploadedFile
+	for _, file := range r.files {
+		older := after == nil || file.CreatedAt.Before(after.CreatedAt) ||
+			file.CreatedAt.Equal(after.CreatedAt) && bytes.Compare(file.ID[:], after.ID[:]) < 0
+		if older && len(files) < limit {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+func (r cursorRepository) GetUserFilesCount(context.Context, uuid.UUID) (int, error) {
+	return len(r.files), nil
+}
+
+func TestHandleAPIListFilesCursor(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+	var files []*models.UploadedFile
+	for i := 0; i < 5; i++ {
+		// Two files share a creation time, the ID keeps them apart
+		files = append(files, &models.UploadedFile{ID: uuid.New(), URLValue: fmt.Sprintf("%d.png", i), CreatedAt: base.Add(time.Duration(i/2) * time.Second)})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].CreatedAt.Equal(files[j].CreatedAt) {
+			return files[i].CreatedAt.After(files[j].CreatedAt)
+		}
+		return bytes.Compare(files[i].ID[:], files[j].ID[:]) > 0
+	})
+	h := NewHandler(&service{
+		repo:   cursorRepository{files: files},
+		config: &config.Config{BaseURL: "https://files.example.com", PageSize: 2, MaxPageSize: 10},
+		signer: NewURLSigner("secret"),
+	}, nil)
+	list := func(query string) (*httptest.ResponseRecorder, map[string]json.RawMessage, APIFileListResponse) {
+		r := httptest.NewRequest("GET", "/api/v1/files?"+query, nil)
+		r = r.WithContext(userctx.WithUser(r.Context(), &userctx.UserInfo{ID: uuid.New(), Username: "alice"}))
+		w := httptest.NewRecorder()
+		h.HandleAPIListFiles(w, r)
+
+		var fields map[string]json.RawMessage
+		var resp APIFileListResponse
+		if w.Code == http.StatusOK {
+			body := w.Body.Bytes()
+			if err := json.Unmarshal(body, &fields); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			json.Unmarshal(body, &resp)
+		}
+		return w, fields, resp
+	}
+
+	var got []string
+	query := "cursor="
+	for pages := 0; ; pages++ {
+		if pages > len(files) {
+			t.Fatal("cursor pagination doesn't end")
+		}
+		w, fields, resp := list(query)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d", query, w.Code)
+		}
+		if _, ok := fields["page"]; ok || resp.Total != len(files) {
+			t.Errorf("%s: cursor page = %s", query, w.Body.String())
+		}
+		for _, file := range resp.Files {
+			got = append(got, file.URL)
+		}
+		if resp.NextCursor == "" {
+			break
+		}
+		query = "cursor=" + resp.NextCursor
+	}
+	var want []string
+	for _, file := range files {
+		want = append(want, "https://files.example.com/f/"+file.URLValue)
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("listed %v, want %v", got, want)
+	}
+
+	if w, _, _ := list("cursor=bogus"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid cursor status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+// folderFilesRepository holds one folder of a user and the files in it
+type folderFilesRepository struct {
+	cursorRepository
+	folder *models.Folder
+}
+
+func (r folderFilesRepository) GetFolder(_ context.Context, id uuid.UUID) (*models.Folder, error) {
+	if id != r.folder.ID {
+		return nil, ErrFolderNotFound
+	}
+	return r.folder, nil
+}
+
+func (r folderFilesRepository) GetFolderFilesAfter(ctx context.Context, userID uuid.UUID, folderID *uuid.UUID, after *cursor.Cursor, limit int) ([]*models.UploadedFile, error) {
+	if *folderID != r.folder.ID {
+		return nil, nil
+	}
+	return r.GetUserFilesAfter(ctx, userID, after, limit)
+}
+
+func (r folderFilesRepository) GetFolderFiles(_ context.Context, _ uuid.UUID, folderID *uuid.UUID, limit, offset int) ([]*models.UploadedFile, error) {
+	if *folderID != r.folder.ID || offset >= len(r.files) {
+		return nil, nil
+	}
+	return r.files[offset:min(offset+limit, len(r.files))], nil
+}
+
+func (r folderFilesRepository) GetFolderFilesCount(_ context.Context, _ uuid.UUID, folderID *uuid.UUID) (int, error) {
+	if *folderID != r.folder.ID {
+		return 0, nil
+	}
+	return len(r.files), nil
+}
+
+func TestHandleAPIListFilesFolder(t *testing.T) {
+	userID := uuid.New()
+	folder := &models.Folder{ID: uuid.New(), UserID: userID, Name: "Screenshots"}
+	base := time.Unix(1700000000, 0)
+	files := []*models.UploadedFile{
+		{ID: uuid.New(), URLValue: "b.png", FolderID: &folder.ID, CreatedAt: base.Add(time.Second)},
+		{ID: uuid.New(), URLValue: "a.png", FolderID: &folder.ID, CreatedAt: base},
+	}
+	h := NewHandler(&service{
+		repo:   folderFilesRepository{cursorRepository: cursorRepository{files: files}, folder: folder},
+		config: &config.Config{BaseURL: "https://files.example.com", PageSize: 1, MaxPageSize: 10},
+		signer: NewURLSigner("secret"),
+	}, nil)
+	list := func(query string, user uuid.UUID) (*httptest.ResponseRecorder, APIFileListResponse) {
+		r := httptest.NewRequest("GET", "/api/v1/files?"+query, nil)
+		r = r.WithContext(userctx.WithUser(r.Context(), &userctx.UserInfo{ID: user, Username: "alice"}))
+		w := httptest.NewRecorder()
+		h.HandleAPIListFiles(w, r)
+		var resp APIFileListResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp
+	}
+
+	w, resp := list("folder_id="+folder.ID.String()+"&page=2", userID)
+	if w.Code != http.StatusOK || resp.Total != 2 || len(resp.Files) != 1 || resp.Files[0].URL != "https://files.example.com/f/a.png" {
+		t.Errorf("second page of the folder = %d %s", w.Code, w.Body)
+	}
+
+	w, resp = list("folder_id="+folder.ID.String()+"&cursor=", userID)
+	if w.Code != http.StatusOK || len(resp.Files) != 1 || resp.NextCursor == "" {
+		t.Fatalf("first cursor page of the folder = %d %s", w.Code, w.Body)
+	}
+	w, resp = list("folder_id="+folder.ID.String()+"&cursor="+resp.NextCursor, userID)
+	if w.Code != http.StatusOK || len(resp.Files) != 1 || resp.Files[0].URL != "https://files.example.com/f/a.png" || resp.NextCursor != "" {
+		t.Errorf("last cursor page of the folder = %d %s", w.Code, w.Body)
+	}
+
+	tests := []struct {
+		query string
+		user  uuid.UUID
+		want  int
+	}{
+		{query: "folder_id=bogus", user: userID, want: http.StatusBadRequest},
+		{query: "folder_id=" + uuid.New().String(), user: userID, want: http.StatusNotFound},
+		{query: "folder_id=" + folder.ID.String(), user: uuid.New(), want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w, _ := list(tt.query, tt.user); w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.query, w.Code, tt.want)
+		}
+	}
+}
+
+func TestHandleAPIUploadTooLarge(t *testing.T) {
+	// No repository, the announced size alone has to turn the request away
+	h := NewHandler(&service{config: &config.Config{UploadMaxSize: 64, UploadMaxFiles: 2}}, nil)
+
+	r := httptest.NewRequest("POST", "/api/v1/upload", strings.NewReader(""))
+	r.ContentLength = BodyLimit(64, 2) + 1
+	r = r.WithContext(userctx.WithUser(r.Context(), &userctx.UserInfo{ID: uuid.New(), Username: "alice"}))
+	w := httptest.NewRecorder()
+	h.HandleAPIUpload(w, r)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestHandleAPIDeleteFileOfOtherUser(t *testing.T) {
+	file := &models.UploadedFile{ID: uuid.New(), UserID: uuid.New()}
+	h := NewHandler(&service{repo: &expirationRepository{file: file}, config: &config.Config{}}, nil)
+	router := chi.NewRouter()
+	router.Delete("/api/v1/files/{fileID}", h.HandleAPIDeleteFile)
+
+	r := httptest.NewRequest("DELETE", "/api/v1/files/"+file.ID.String(), nil)
+	r = r.WithContext(userctx.WithUser(r.Context(), &userctx.UserInfo{ID: uuid.New(), Username: "mallory"}))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d like a missing file", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestAllowSlowTransfer(t *testing.T) {
+	var received int
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowSlowTransfer(w, true)
+		body, _ := io.ReadAll(r.Body)
+		received = len(body)
+	}))
+	server.Config.ReadTimeout = 50 * time.Millisecond
+	server.Config.WriteTimeout = 50 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	// The body arrives slower than the server's timeouts allow
+	body, writer := io.Pipe()
+	go func() {
+		for range 4 {
+			time.Sleep(30 * time.Millisecond)
+			writer.Write(make([]byte, 10))
+		}
+		writer.Close()
+	}()
+	resp, err := http.Post(server.URL, "application/octet-stream", body)
+	if err != nil {
+		t.Fatalf("slow upload failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || received != 40 {
+		t.Errorf("slow upload = %d with %d bytes received, want all 40", resp.StatusCode, received)
+	}
+}
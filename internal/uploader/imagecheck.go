@@ -0,0 +1,34 @@
+package uploader
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// checkImageDimensions reads only the image header and rejects images with more than
+// maxPixels pixels, before anything decodes the whole image into memory. GIF, JPEG, PNG, BMP,
+// TIFF and WebP headers are read, other formats and unreadable headers are not rejected
+// here. The file is rewound.
+func checkImageDimensions(file io.ReadSeeker, maxPixels int64) error {
+	cfg, _, err := image.DecodeConfig(bufio.NewReader(file))
+	if _, seekErr := file.Seek(0, io.SeekStart); seekErr != nil {
+		return seekErr
+	}
+	if err != nil {
+		return nil
+	}
+
+	if int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+		return fmt.Errorf("%w: %dx%d pixels", ErrImageTooLarge, cfg.Width, cfg.Height)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package uploader
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"testing"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+func encodePNG(t *testing.T, width, height int) *bytes.Reader {
+	return encodeImage(t, png.Encode, width, height)
+}
+
+func encodeImage(t *testing.T, encode func(io.Writer, image.Image) error, width, height int) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("encoding image: %v", err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestCheckImageDimensions(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      *bytes.Reader
+		maxPixels int64
+		wantErr   bool
+	}{
+		{name: "within limit", file: encodePNG(t, 100, 50), maxPixels: 5000},
+		{name: "over limit", file: encodePNG(t, 100, 51), maxPixels: 5000, wantErr: true},
+		{name: "bmp over limit", file: encodeImage(t, bmp.Encode, 100, 51), maxPixels: 5000, wantErr: true},
+		{name: "tiff over limit", file: encodeImage(t, func(w io.Writer, m image.Image) error { return tiff.Encode(w, m, nil) }, 100, 51), maxPixels: 5000, wantErr: true},
+		{name: "unknown format", file: bytes.NewReader([]byte("not an image")), maxPixels: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkImageDimensions(tt.file, tt.maxPixels)
+			if errors.Is(err, ErrImageTooLarge) != tt.wantErr {
+				t.Errorf("checkImageDimensions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if pos, _ := tt.file.Seek(0, io.SeekCurrent); pos != 0 {
+				t.Errorf("file left at offset %d, want it rewound", pos)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package uploader
+
+import (
+	"net/http"
+	"strings"
+	"volaticus-go/cmd/web/pages"
+	"volaticus-go/internal/common/models"
+
+	"github.com/dustin/go-humanize"
+	"github.com/rs/zerolog/log"
+)
+
+// linkPreviewBots are User-Agent fragments of crawlers building link previews, in lower case
+var linkPreviewBots = []string{
+	"facebookexternalhit",
+	"facebot",
+	"twitterbot",
+	"slackbot",
+	"discordbot",
+	"linkedinbot",
+	"whatsapp",
+	"telegrambot",
+	"skypeuripreview",
+	"mastodon",
+	"redditbot",
+	"embedly",
+	"iframely",
+}
+
+// wantsLinkPreview reports whether the request comes from a link preview crawler that should
+// get a page with Open Graph tags instead of the file. ?raw=true always returns the file,
+// that is how the preview image itself is fetched.
+func wantsLinkPreview(r *http.Request) bool {
+	if r.URL.Query().Get("raw") == "true" {
+		return false
+	}
+	userAgent := strings.ToLower(r.UserAgent())
+	for _, bot := range linkPreviewBots {
+		if strings.Contains(userAgent, bot) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileMeta returns the link preview tags of a file, pageURL is the shared link
+func (h *Handler) fileMeta(file *models.UploadedFile, pageURL string) pages.Meta {
+	meta := pages.Meta{
+		PageTitle:   file.OriginalName + " - Volaticus",
+		Title:       file.OriginalName,
+		Description: humanize.Bytes(file.FileSize) + " · " + file.MimeType + " · shared with Volaticus",
+		Type:        "website",
+		URL:         pageURL,
+	}
+	if strings.HasPrefix(file.MimeType, "image/") && !h.isSandboxedType(file.MimeType) {
+		meta.Image = h.fileURL(file) + "?raw=true"
+	}
+	return meta
+}
+
+// servePreview renders the link preview page of a file
+func (h *Handler) servePreview(w http.ResponseWriter, r *http.Request, file *models.UploadedFile) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// The page shares its URL with the file, caches must not hand it to browsers
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Vary", "User-Agent")
+	if err := pages.FilePreview(file, h.fileMeta(file, h.fileURL(file))).Render(r.Context(), w); err != nil {
+		log.Error().
+			Err(err).
+			Str("fileUrl", file.URLValue).
+			Msg("Error rendering link preview")
+	}
+}
@@ -0,0 +1,62 @@
+package uploader
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"volaticus-go/internal/common/models"
+	"volaticus-go/internal/config"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func TestWantsLinkPreview(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		query     string
+		want      bool
+	}{
+		{name: "browser", userAgent: "Mozilla/5.0 (X11; Linux x86_64) Firefox/131.0"},
+		{name: "discord", userAgent: "Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)", want: true},
+		{name: "facebook", userAgent: "facebookexternalhit/1.1", want: true},
+		{name: "raw file for the preview image", userAgent: "Twitterbot/1.0", query: "?raw=true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/f/file"+tt.query, nil)
+			r.Header.Set("User-Agent", tt.userAgent)
+
+			if got := wantsLinkPreview(r); got != tt.want {
+				t.Errorf("wantsLinkPreview() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleServeFileLinkPreview(t *testing.T) {
+	file := &models.UploadedFile{ID: uuid.New(), OriginalName: "cat.png", URLValue: "cat.png", MimeType: "image/png", FileSize: 2048}
+	h := NewHandler(&service{
+		repo:   servedFileRepository{file: file},
+		config: &config.Config{BaseURL: "https://files.example.com"},
+	}, nil)
+	router := chi.NewRouter()
+	router.Get("/f/{fileUrl}", h.HandleServeFile)
+
+	r := httptest.NewRequest("GET", "/f/cat.png", nil)
+	r.Header.Set("User-Agent", "Slackbot-LinkExpanding 1.0")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	body := w.Body.String()
+	for _, tag := range []string{
+		`<meta property="og:title" content="cat.png">`,
+		`<meta property="og:image" content="https://files.example.com/f/cat.png?raw=true">`,
+	} {
+		if !strings.Contains(body, tag) {
+			t.Errorf("preview page is missing %s", tag)
+		}
+	}
+}
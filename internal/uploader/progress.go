@@ -0,0 +1,155 @@
+package uploader
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// progressSessionTimeout is how long a session without updates is kept before it is pruned
+const progressSessionTimeout = 10 * time.Minute
+
+// UploadProgress is a snapshot of how much of an upload has been received
+type UploadProgress struct {
+	Received int64 `json:"received"`
+	Total    int64 `json:"total"`
+	Done     bool  `json:"done"`
+}
+
+// progressSession holds the latest progress of a single upload.
+// The channel only ever buffers the newest snapshot, slow subscribers skip intermediate values.
+type progressSession struct {
+	userID   uuid.UUID
+	updates  chan UploadProgress
+	progress UploadProgress
+	lastSeen time.Time
+}
+
+// ProgressTracker publishes the progress of uploads keyed by a client generated session ID
+type ProgressTracker struct {
+	mu        sync.Mutex
+	sessions  map[string]*progressSession
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+func NewProgressTracker() *ProgressTracker {
+	return &ProgressTracker{
+		sessions: make(map[string]*progressSession),
+		now:      time.Now,
+	}
+}
+
+// session returns the session of the ID, creating it if necessary. Either the upload or the
+// subscriber may arrive first. Returns nil if the session belongs to another user.
+// Must be called with the lock held.
+func (t *ProgressTracker) session(id string, userID uuid.UUID) *progressSession {
+	now := t.now()
+	t.prune(now)
+
+	s, ok := t.sessions[id]
+	if !ok {
+		s = &progressSession{
+			userID:  userID,
+			updates: make(chan UploadProgress, 1),
+		}
+		t.sessions[id] = s
+	}
+	if s.userID != userID {
+		return nil
+	}
+	s.lastSeen = now
+	return s
+}
+
+// Subscribe returns the channel receiving progress updates of a session
+func (t *ProgressTracker) Subscribe(id string, userID uuid.UUID) (<-chan UploadProgress, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := t.session(id, userID)
+	if s == nil {
+		return nil, false
+	}
+	return s.updates, true
+}
+
+// Track wraps the body of an upload so every read publishes the number of bytes received
+func (t *ProgressTracker) Track(id string, userID uuid.UUID, body io.ReadCloser, total int64) io.ReadCloser {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := t.session(id, userID)
+	if s == nil {
+		return body
+	}
+	s.progress = UploadProgress{Total: total}
+	return &progressReader{ReadCloser: body, tracker: t, id: id}
+}
+
+// Finish marks the upload as complete and removes the session
+func (t *ProgressTracker) Finish(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.sessions[id]
+	if !ok {
+		return
+	}
+	s.progress.Done = true
+	s.publish()
+	delete(t.sessions, id)
+}
+
+// add records n more received bytes
+func (t *ProgressTracker) add(id string, n int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.sessions[id]
+	if !ok {
+		return
+	}
+	s.progress.Received += n
+	s.lastSeen = t.now()
+	s.publish()
+}
+
+// publish replaces any unread snapshot with the current progress, must be called with the lock held
+func (s *progressSession) publish() {
+	select {
+	case <-s.updates:
+	default:
+	}
+	s.updates <- s.progress
+}
+
+// prune removes sessions that have not been updated recently, must be called with the lock held
+func (t *ProgressTracker) prune(now time.Time) {
+	if now.Sub(t.lastPrune) < progressSessionTimeout {
+		return
+	}
+	for id, s := range t.sessions {
+		if now.Sub(s.lastSeen) > progressSessionTimeout {
+			delete(t.sessions, id)
+		}
+	}
+	t.lastPrune = now
+}
+
+// progressReader counts the bytes read from an upload body
+type progressReader struct {
+	io.ReadCloser
+	tracker *ProgressTracker
+	id      string
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.tracker.add(r.id, int64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,79 @@
+package uploader
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestProgressTracker(t *testing.T) {
+	tracker := NewProgressTracker()
+	userID := uuid.New()
+
+	updates, ok := tracker.Subscribe("session", userID)
+	if !ok {
+		t.Fatal("Subscribe() refused the owner")
+	}
+
+	body := io.NopCloser(strings.NewReader("hello world"))
+	reader := tracker.Track("session", userID, body, 11)
+
+	buf := make([]byte, 5)
+	if _, err := reader.Read(buf); err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	got := <-updates
+	if got.Received != 5 || got.Total != 11 || got.Done {
+		t.Errorf("progress = %+v, want 5 of 11 bytes", got)
+	}
+
+	// Only the latest snapshot is buffered
+	if _, err := io.ReadAll(reader); err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	tracker.Finish("session")
+
+	got = <-updates
+	if got.Received != 11 || !got.Done {
+		t.Errorf("progress = %+v, want all 11 bytes and done", got)
+	}
+	if _, ok := tracker.sessions["session"]; ok {
+		t.Error("Finish() did not remove the session")
+	}
+}
+
+func TestProgressTrackerOtherUser(t *testing.T) {
+	tracker := NewProgressTracker()
+	tracker.Subscribe("session", uuid.New())
+
+	if _, ok := tracker.Subscribe("session", uuid.New()); ok {
+		t.Error("Subscribe() allowed another user to join the session")
+	}
+
+	body := io.NopCloser(strings.NewReader("data"))
+	if reader := tracker.Track("session", uuid.New(), body, 4); reader != body {
+		t.Error("Track() wrapped the body of another user's session")
+	}
+}
+
+func TestProgressTrackerPrune(t *testing.T) {
+	now := time.Now()
+	tracker := NewProgressTracker()
+	tracker.now = func() time.Time { return now }
+
+	tracker.Subscribe("stale", uuid.New())
+
+	now = now.Add(progressSessionTimeout + time.Second)
+	tracker.Subscribe("fresh", uuid.New())
+
+	if _, ok := tracker.sessions["stale"]; ok {
+		t.Error("stale session was not pruned")
+	}
+	if _, ok := tracker.sessions["fresh"]; !ok {
+		t.Error("fresh session was pruned")
+	}
+}
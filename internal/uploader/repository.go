@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
+	"volaticus-go/internal/common/cursor"
 	"volaticus-go/internal/common/models"
 	"volaticus-go/internal/config"
 	"volaticus-go/internal/database"
@@ -19,13 +21,42 @@ type Repository interface {
 	GetByUniqueFilename(ctx context.Context, code string) (*models.UploadedFile, error)
 	GetByURLValue(ctx context.Context, urlValue string) (*models.UploadedFile, error)
 	IncrementAccessCount(ctx context.Context, id uuid.UUID) error
+	UpdateExpiration(ctx context.Context, id uuid.UUID, expiresAt *time.Time) error
+	UpdateVisibility(ctx context.Context, id uuid.UUID, visibility string) error
+	SetStorageMissing(ctx context.Context, id uuid.UUID, missing bool) error
+	GetStorageMissingFiles(ctx context.Context) ([]*models.UploadedFile, error)
 	GetExpiredFiles(ctx context.Context) ([]*models.UploadedFile, error)
 	GetUserFiles(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*models.UploadedFile, error)
+	GetUserFilesAfter(ctx context.Context, userID uuid.UUID, after *cursor.Cursor, limit int) ([]*models.UploadedFile, error)
+	GetAllUserFiles(ctx context.Context, userID uuid.UUID) ([]*models.UploadedFile, error)
 	GetByID(ctx context.Context, id uuid.UUID) (*models.UploadedFile, error)
 	GetUserFilesCount(ctx context.Context, userID uuid.UUID) (int, error)
+	GetAvatarKey(ctx context.Context, userID uuid.UUID) (string, error)
+	SetAvatarKey(ctx context.Context, userID uuid.UUID, key *string) error
+	GetAvatarKeys(ctx context.Context) ([]string, error)
 	Delete(ctx context.Context, id uuid.UUID) error
 	DeleteByUniqueName(ctx context.Context, file string) error
+	DeleteUserFilesByIDs(ctx context.Context, userID uuid.UUID, ids []uuid.UUID) ([]*models.UploadedFile, error)
 	GetFileStats(ctx context.Context, userID uuid.UUID) (*models.FileStats, error)
+	GetStorageUsageByUser(ctx context.Context) ([]models.UserStorageUsage, error)
+	GetFilesExpiringBefore(ctx context.Context, before time.Time) ([]*models.UploadedFile, error)
+	RecordAccess(ctx context.Context, access *models.FileAccess) error
+	GetFileAnalytics(ctx context.Context, fileID uuid.UUID) (*models.FileAnalytics, error)
+	DeleteAccessesBefore(ctx context.Context, before time.Time) (int64, error)
+	QueueDeletion(ctx context.Context, filename, lastError string, nextAttempt time.Time) error
+	GetDueDeletions(ctx context.Context, now time.Time, limit int) ([]*models.PendingDeletion, error)
+	RemovePendingDeletion(ctx context.Context, filename string) error
+
+	// Folder methods
+	CreateFolder(ctx context.Context, folder *models.Folder) error
+	GetFolder(ctx context.Context, id uuid.UUID) (*models.Folder, error)
+	GetFolders(ctx context.Context, userID uuid.UUID) ([]*models.Folder, error)
+	RenameFolder(ctx context.Context, id uuid.UUID, name string) error
+	DeleteFolder(ctx context.Context, folder *models.Folder, reparent bool) error
+	MoveFiles(ctx context.Context, userID uuid.UUID, ids []uuid.UUID, folderID *uuid.UUID) (int64, error)
+	GetFolderFiles(ctx context.Context, userID uuid.UUID, folderID *uuid.UUID, limit, offset int) ([]*models.UploadedFile, error)
+	GetFolderFilesAfter(ctx context.Context, userID uuid.UUID, folderID *uuid.UUID, after *cursor.Cursor, limit int) ([]*models.UploadedFile, error)
+	GetFolderFilesCount(ctx context.Context, userID uuid.UUID, folderID *uuid.UUID) (int, error)
 }
 
 type repository struct {
@@ -53,9 +84,17 @@ func (r *repository) CreateWithURL(ctx context.Context, file *models.UploadedFil
 			return fmt.Errorf("%w: %s", ErrDuplicateURLValue, urlValue)
 		}
 
+		if file.Visibility == "" {
+			file.Visibility = models.FileVisibilityPublic
+		}
+
 		// Insert uploaded file
-		_, err = tx.NamedExecContext(ctx, `INSERT INTO uploaded_files (id, original_name, unique_filename, mime_type, file_size, user_id, created_at, last_accessed_at, access_count, expires_at, url_value)
-			VALUES (:id, :original_name, :unique_filename, :mime_type, :file_size, :user_id, :created_at, :last_accessed_at, :access_count, :expires_at, :url_value)`, file)
+		_, err = tx.NamedExecContext(ctx, `INSERT INTO uploaded_files (id, original_name, unique_filename, mime_type, file_size, user_id, created_at, last_accessed_at, access_count, expires_at, url_value, force_download, visibility)
+			VALUES (:id, :original_name, :unique_filename, :mime_type, :file_size, :user_id, :created_at, :last_accessed_at, :access_count, :expires_at, :url_value, :force_download, :visibility)`, file)
+		if constraint, _ := database.UniqueConstraint(err); constraint == "unique_unique_urlvalue" {
+			// Taken by a concurrent upload after the check above
+			return fmt.Errorf("%w: %s", ErrDuplicateURLValue, urlValue)
+		}
 		if err != nil {
 			return fmt.Errorf("%w: %v", ErrTransaction, err)
 		}
@@ -76,9 +115,16 @@ func (r *repository) GetByUniqueFilename(ctx context.Context, code string) (*mod
 	return &file, nil
 }
 
+// fileQuery selects single files together with the account download setting of their owner, files
+// without an owner have no account default
+const fileQuery = `
+    SELECT f.*, COALESCE(u.force_download, false) AS owner_force_download
+    FROM uploaded_files f
+    LEFT JOIN users u ON u.id = f.user_id`
+
 func (r *repository) GetByURLValue(ctx context.Context, urlValue string) (*models.UploadedFile, error) {
 	var file models.UploadedFile
-	err := r.Get(ctx, &file, `SELECT * FROM uploaded_files WHERE url_value = $1`, urlValue)
+	err := r.Get(ctx, &file, fileQuery+` WHERE f.url_value = $1`, urlValue)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNoRows
@@ -96,6 +142,47 @@ func (r *repository) IncrementAccessCount(ctx context.Context, id uuid.UUID) err
 	return nil
 }
 
+func (r *repository) UpdateExpiration(ctx context.Context, id uuid.UUID, expiresAt *time.Time) error {
+	result, err := r.Exec(ctx, `UPDATE uploaded_files SET expires_at = $1 WHERE id = $2`, expiresAt, id)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTransaction, err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return ErrNoRows
+	}
+	return nil
+}
+
+func (r *repository) UpdateVisibility(ctx context.Context, id uuid.UUID, visibility string) error {
+	result, err := r.Exec(ctx, `UPDATE uploaded_files SET visibility = $1 WHERE id = $2`, visibility, id)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTransaction, err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return ErrNoRows
+	}
+	return nil
+}
+
+// SetStorageMissing flags or clears a file whose object was found missing in storage
+func (r *repository) SetStorageMissing(ctx context.Context, id uuid.UUID, missing bool) error {
+	result, err := r.Exec(ctx, `UPDATE uploaded_files SET storage_missing = $1 WHERE id = $2`, missing, id)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTransaction, err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return ErrNoRows
+	}
+	return nil
+}
+
+// GetStorageMissingFiles returns the files flagged as missing in storage
+func (r *repository) GetStorageMissingFiles(ctx context.Context) ([]*models.UploadedFile, error) {
+	var files []*models.UploadedFile
+	err := r.Select(ctx, &files, `SELECT * FROM uploaded_files WHERE storage_missing`)
+	return files, err
+}
+
 func (r *repository) GetExpiredFiles(ctx context.Context) ([]*models.UploadedFile, error) {
 	var files []*models.UploadedFile
 	err := r.Select(ctx, &files, `SELECT * FROM uploaded_files WHERE expires_at < NOW()`)
@@ -105,6 +192,35 @@ func (r *repository) GetExpiredFiles(ctx context.Context) ([]*models.UploadedFil
 	return files, nil
 }
 
+// GetFilesExpiringBefore returns files that have not expired yet but will before the given time, soonest first
+func (r *repository) GetFilesExpiringBefore(ctx context.Context, before time.Time) ([]*models.UploadedFile, error) {
+	var files []*models.UploadedFile
+	err := r.Select(ctx, &files, `
+        SELECT * FROM uploaded_files
+        WHERE expires_at >= NOW() AND expires_at < $1
+        ORDER BY expires_at`, before)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTransaction, err)
+	}
+	return files, nil
+}
+
+// GetStorageUsageByUser returns the number and size of files of every user with uploads, largest first
+func (r *repository) GetStorageUsageByUser(ctx context.Context) ([]models.UserStorageUsage, error) {
+	var usage []models.UserStorageUsage
+	err := r.Select(ctx, &usage, `
+        SELECT f.user_id, COALESCE(u.username, '') AS username,
+               COUNT(*) AS file_count, COALESCE(SUM(f.file_size), 0) AS total_size
+        FROM uploaded_files f
+        LEFT JOIN users u ON u.id = f.user_id
+        GROUP BY f.user_id, u.username
+        ORDER BY total_size DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTransaction, err)
+	}
+	return usage, nil
+}
+
 func (r *repository) Delete(ctx context.Context, id uuid.UUID) error {
 	_, err := r.Exec(ctx, `DELETE FROM uploaded_files WHERE id = $1`, id)
 	if err != nil {
@@ -136,6 +252,33 @@ func (r *repository) GetUserFiles(ctx context.Context, userID uuid.UUID, limit,
 	return files, nil
 }
 
+// GetUserFilesAfter returns the newest files of a user created before the cursor, or from the
+// start of the list without one. Unlike offsets, the cursor stays valid while files are added.
+func (r *repository) GetUserFilesAfter(ctx context.Context, userID uuid.UUID, after *cursor.Cursor, limit int) ([]*models.UploadedFile, error) {
+	query := `SELECT * FROM uploaded_files WHERE user_id = $1`
+	args := []any{userID}
+	if after != nil {
+		query += ` AND (created_at, id) < ($2, $3)`
+		args = append(args, after.CreatedAt, after.ID)
+	}
+	query += fmt.Sprintf(` ORDER BY created_at DESC, id DESC LIMIT $%d`, len(args)+1)
+
+	var files []*models.UploadedFile
+	if err := r.Select(ctx, &files, query, append(args, limit)...); err != nil {
+		return nil, fmt.Errorf("getting user files after cursor: %w", err)
+	}
+	return files, nil
+}
+
+func (r *repository) GetAllUserFiles(ctx context.Context, userID uuid.UUID) ([]*models.UploadedFile, error) {
+	var files []*models.UploadedFile
+	err := r.Select(ctx, &files, `SELECT * FROM uploaded_files WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("getting all user files: %w", err)
+	}
+	return files, nil
+}
+
 func (r *repository) GetUserFilesCount(ctx context.Context, userID uuid.UUID) (int, error) {
 	var count int
 	query := `SELECT COUNT(*) FROM uploaded_files WHERE user_id = $1`
@@ -146,6 +289,44 @@ func (r *repository) GetUserFilesCount(ctx context.Context, userID uuid.UUID) (i
 	return count, nil
 }
 
+// GetAvatarKey returns the storage object of the user's profile picture, ErrNoAvatar if they have none
+func (r *repository) GetAvatarKey(ctx context.Context, userID uuid.UUID) (string, error) {
+	var key *string
+	err := r.Get(ctx, &key, `SELECT avatar_key FROM users WHERE id = $1`, userID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && key == nil) {
+		return "", ErrNoAvatar
+	}
+	if err != nil {
+		return "", fmt.Errorf("getting avatar key: %w", err)
+	}
+	return *key, nil
+}
+
+// SetAvatarKey replaces the profile picture of the user, nil removes it
+func (r *repository) SetAvatarKey(ctx context.Context, userID uuid.UUID, key *string) error {
+	result, err := r.Exec(ctx, `UPDATE users SET avatar_key = $2, updated_at = NOW() WHERE id = $1`, userID, key)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTransaction, err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTransaction, err)
+	}
+	if rows == 0 {
+		return ErrNoRows
+	}
+	return nil
+}
+
+// GetAvatarKeys returns the storage objects of all profile pictures
+func (r *repository) GetAvatarKeys(ctx context.Context) ([]string, error) {
+	var keys []string
+	if err := r.Select(ctx, &keys, `SELECT avatar_key FROM users WHERE avatar_key IS NOT NULL`); err != nil {
+		return nil, fmt.Errorf("getting avatar keys: %w", err)
+	}
+	return keys, nil
+}
+
 func (r *repository) DeleteFile(ctx context.Context, fileID, userID uuid.UUID) error {
 	// First check if the file belongs to the user
 	var exists bool
@@ -180,7 +361,7 @@ func (r *repository) DeleteFile(ctx context.Context, fileID, userID uuid.UUID) e
 
 func (r *repository) GetByID(ctx context.Context, id uuid.UUID) (*models.UploadedFile, error) {
 	var file models.UploadedFile
-	err := r.Get(ctx, &file, `SELECT * FROM uploaded_files WHERE id = $1`, id)
+	err := r.Get(ctx, &file, fileQuery+` WHERE f.id = $1`, id)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNoRows
@@ -200,6 +381,30 @@ func (r *repository) DeleteByUniqueName(ctx context.Context, file string) error
 	})
 }
 
+// DeleteUserFilesByIDs removes the records of the user's files among ids in a single transaction
+// and returns the deleted files
+func (r *repository) DeleteUserFilesByIDs(ctx context.Context, userID uuid.UUID, ids []uuid.UUID) ([]*models.UploadedFile, error) {
+	var deleted []*models.UploadedFile
+	err := r.WithTx(ctx, func(tx *sqlx.Tx) error {
+		for _, id := range ids {
+			var file models.UploadedFile
+			err := tx.GetContext(ctx, &file, `DELETE FROM uploaded_files WHERE id = $1 AND user_id = $2 RETURNING *`, id, userID)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrTransaction, err)
+			}
+			deleted = append(deleted, &file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
 func (r *repository) GetFileStats(ctx context.Context, userID uuid.UUID) (*models.FileStats, error) {
 	// Get total files and size
 	var stats models.FileStats
@@ -239,6 +444,302 @@ func (r *repository) GetFileStats(ctx context.Context, userID uuid.UUID) (*model
 
 	// Set storage quota from config
 	stats.StorageQuota = int64(r.cfg.UploadUserQuota)
+	stats.StorageRemaining = max(stats.StorageQuota-stats.TotalSize, 0)
 
 	return &stats, nil
 }
+
+// RecordAccess stores a single download of a file
+func (r *repository) RecordAccess(ctx context.Context, access *models.FileAccess) error {
+	_, err := r.Exec(ctx, `
+		INSERT INTO file_access_log (id, file_id, accessed_at, referrer, user_agent, ip_address)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		access.ID, access.FileID, access.AccessedAt, access.Referrer, access.UserAgent, access.IPAddress,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTransaction, err)
+	}
+	return nil
+}
+
+// GetFileAnalytics summarizes the download history of a file
+func (r *repository) GetFileAnalytics(ctx context.Context, fileID uuid.UUID) (*models.FileAnalytics, error) {
+	analytics := &models.FileAnalytics{
+		TopReferrers:  []models.ReferrerStats{},
+		AccessesByDay: []models.ClicksByDay{},
+	}
+
+	err := r.Get(ctx, &analytics.TotalAccesses, `SELECT COUNT(*) FROM file_access_log WHERE file_id = $1`, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTransaction, err)
+	}
+
+	err = r.Get(ctx, &analytics.UniqueVisitors, `
+		SELECT COUNT(*)
+		FROM (
+			SELECT DISTINCT ip_address, user_agent
+			FROM file_access_log
+			WHERE file_id = $1
+		) visitors`,
+		fileID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTransaction, err)
+	}
+
+	err = r.Select(ctx, &analytics.TopReferrers, `
+		SELECT referrer, COUNT(*) AS count
+		FROM file_access_log
+		WHERE file_id = $1 AND referrer IS NOT NULL AND referrer != ''
+		GROUP BY referrer
+		ORDER BY count DESC
+		LIMIT 10`,
+		fileID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTransaction, err)
+	}
+
+	err = r.Select(ctx, &analytics.AccessesByDay, `
+		SELECT DATE_TRUNC('day', accessed_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS date, COUNT(*) AS count
+		FROM file_access_log
+		WHERE file_id = $1
+		GROUP BY 1
+		ORDER BY date DESC
+		LIMIT 30`,
+		fileID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTransaction, err)
+	}
+
+	return analytics, nil
+}
+
+// DeleteAccessesBefore removes the download history recorded before a given time
+func (r *repository) DeleteAccessesBefore(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.Exec(ctx, `DELETE FROM file_access_log WHERE accessed_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrTransaction, err)
+	}
+	return result.RowsAffected()
+}
+
+// QueueDeletion records a failed storage deletion for a retry at nextAttempt. Queueing a filename
+// again counts another failed attempt.
+func (r *repository) QueueDeletion(ctx context.Context, filename, lastError string, nextAttempt time.Time) error {
+	_, err := r.Exec(ctx, `
+        INSERT INTO pending_deletions (filename, last_error, next_attempt_at)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (filename) DO UPDATE
+        SET attempts = pending_deletions.attempts + 1,
+            last_error = EXCLUDED.last_error,
+            next_attempt_at = EXCLUDED.next_attempt_at`,
+		filename, lastError, nextAttempt,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTransaction, err)
+	}
+	return nil
+}
+
+// GetDueDeletions returns up to limit pending deletions whose next attempt is due, oldest first
+func (r *repository) GetDueDeletions(ctx context.Context, now time.Time, limit int) ([]*models.PendingDeletion, error) {
+	var pending []*models.PendingDeletion
+	err := r.Select(ctx, &pending, `
+        SELECT * FROM pending_deletions
+        WHERE next_attempt_at <= $1
+        ORDER BY next_attempt_at
+        LIMIT $2`,
+		now, limit,
+	)
+	return pending, err
+}
+
+// RemovePendingDeletion forgets a pending deletion once the object is gone
+func (r *repository) RemovePendingDeletion(ctx context.Context, filename string) error {
+	_, err := r.Exec(ctx, `DELETE FROM pending_deletions WHERE filename = $1`, filename)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTransaction, err)
+	}
+	return nil
+}
+
+// CreateFolder inserts a folder, ErrFolderExists if its parent already has one of the same name
+func (r *repository) CreateFolder(ctx context.Context, folder *models.Folder) error {
+	_, err := r.Exec(ctx, `
+        INSERT INTO folders (id, user_id, parent_id, name, created_at)
+        VALUES ($1, $2, $3, $4, $5)`,
+		folder.ID,
+		folder.UserID,
+		folder.ParentID,
+		folder.Name,
+		folder.CreatedAt,
+	)
+	if database.IsUniqueViolation(err) {
+		return ErrFolderExists
+	}
+	if err != nil {
+		return fmt.Errorf("creating folder: %w", err)
+	}
+	return nil
+}
+
+// GetFolder returns a folder by its ID, ErrFolderNotFound if there is none
+func (r *repository) GetFolder(ctx context.Context, id uuid.UUID) (*models.Folder, error) {
+	var folder models.Folder
+	err := r.Get(ctx, &folder, `SELECT * FROM folders WHERE id = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrFolderNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting folder: %w", err)
+	}
+	return &folder, nil
+}
+
+// GetFolders returns every folder of the user sorted by name, the tree is small enough to be
+// assembled in memory
+func (r *repository) GetFolders(ctx context.Context, userID uuid.UUID) ([]*models.Folder, error) {
+	folders := []*models.Folder{}
+	err := r.Select(ctx, &folders, `SELECT * FROM folders WHERE user_id = $1 ORDER BY LOWER(name), id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("getting folders: %w", err)
+	}
+	return folders, nil
+}
+
+// RenameFolder changes the name of a folder, ErrFolderExists if a sibling already has the name
+func (r *repository) RenameFolder(ctx context.Context, id uuid.UUID, name string) error {
+	result, err := r.Exec(ctx, `UPDATE folders SET name = $1 WHERE id = $2`, name, id)
+	if database.IsUniqueViolation(err) {
+		return ErrFolderExists
+	}
+	if err != nil {
+		return fmt.Errorf("renaming folder: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return ErrFolderNotFound
+	}
+	return nil
+}
+
+// DeleteFolder removes a folder. With reparent its files and folders move to its parent,
+// otherwise ErrFolderNotEmpty is returned unless it is empty. The folder row stays locked until
+// the transaction ends, so nothing can be moved into it meanwhile.
+func (r *repository) DeleteFolder(ctx context.Context, folder *models.Folder, reparent bool) error {
+	return r.WithTx(ctx, func(tx *sqlx.Tx) error {
+		var id uuid.UUID
+		err := tx.GetContext(ctx, &id, `SELECT id FROM folders WHERE id = $1 FOR UPDATE`, folder.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrFolderNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("locking folder: %w", err)
+		}
+
+		if reparent {
+			_, err := tx.ExecContext(ctx, `UPDATE folders SET parent_id = $1 WHERE parent_id = $2`, folder.ParentID, folder.ID)
+			if database.IsUniqueViolation(err) {
+				return ErrFolderExists
+			}
+			if err != nil {
+				return fmt.Errorf("moving subfolders: %w", err)
+			}
+			if _, err := tx.ExecContext(ctx, `UPDATE uploaded_files SET folder_id = $1 WHERE folder_id = $2`, folder.ParentID, folder.ID); err != nil {
+				return fmt.Errorf("moving folder files: %w", err)
+			}
+		} else {
+			var empty bool
+			err := tx.GetContext(ctx, &empty, `
+                SELECT NOT EXISTS (SELECT 1 FROM folders WHERE parent_id = $1)
+                    AND NOT EXISTS (SELECT 1 FROM uploaded_files WHERE folder_id = $1)`,
+				folder.ID,
+			)
+			if err != nil {
+				return fmt.Errorf("checking folder contents: %w", err)
+			}
+			if !empty {
+				return ErrFolderNotEmpty
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM folders WHERE id = $1`, folder.ID); err != nil {
+			return fmt.Errorf("deleting folder: %w", err)
+		}
+		return nil
+	})
+}
+
+// MoveFiles files the user's files among ids into a folder, or the top level with a nil folder,
+// in a single transaction and returns how many were moved
+func (r *repository) MoveFiles(ctx context.Context, userID uuid.UUID, ids []uuid.UUID, folderID *uuid.UUID) (int64, error) {
+	var moved int64
+	err := r.WithTx(ctx, func(tx *sqlx.Tx) error {
+		for _, id := range ids {
+			result, err := tx.ExecContext(ctx, `UPDATE uploaded_files SET folder_id = $1 WHERE id = $2 AND user_id = $3`, folderID, id, userID)
+			if err != nil {
+				return fmt.Errorf("moving files: %w", err)
+			}
+			rows, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			moved += rows
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return moved, nil
+}
+
+// GetFolderFiles returns a page of the user's files directly in a folder, newest first. A nil
+// folder lists the files at the top level.
+func (r *repository) GetFolderFiles(ctx context.Context, userID uuid.UUID, folderID *uuid.UUID, limit, offset int) ([]*models.UploadedFile, error) {
+	var files []*models.UploadedFile
+	err := r.Select(ctx, &files, `
+        SELECT * FROM uploaded_files
+        WHERE user_id = $1 AND folder_id IS NOT DISTINCT FROM $2::uuid
+        ORDER BY created_at DESC
+        LIMIT $3 OFFSET $4`,
+		userID, folderID, limit, offset,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("getting folder files: %w", err)
+	}
+	return files, nil
+}
+
+// GetFolderFilesAfter returns the newest files of a user directly in a folder created before the
+// cursor, like GetUserFilesAfter. A nil folder lists the files at the top level.
+func (r *repository) GetFolderFilesAfter(ctx context.Context, userID uuid.UUID, folderID *uuid.UUID, after *cursor.Cursor, limit int) ([]*models.UploadedFile, error) {
+	query := `SELECT * FROM uploaded_files WHERE user_id = $1 AND folder_id IS NOT DISTINCT FROM $2::uuid`
+	args := []any{userID, folderID}
+	if after != nil {
+		query += ` AND (created_at, id) < ($3, $4)`
+		args = append(args, after.CreatedAt, after.ID)
+	}
+	query += fmt.Sprintf(` ORDER BY created_at DESC, id DESC LIMIT $%d`, len(args)+1)
+
+	var files []*models.UploadedFile
+	if err := r.Select(ctx, &files, query, append(args, limit)...); err != nil {
+		return nil, fmt.Errorf("getting folder files after cursor: %w", err)
+	}
+	return files, nil
+}
+
+// GetFolderFilesCount returns the number of the user's files directly in a folder
+func (r *repository) GetFolderFilesCount(ctx context.Context, userID uuid.UUID, folderID *uuid.UUID) (int, error) {
+	var count int
+	err := r.Get(ctx, &count, `
+        SELECT COUNT(*) FROM uploaded_files
+        WHERE user_id = $1 AND folder_id IS NOT DISTINCT FROM $2::uuid`,
+		userID, folderID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("counting folder files: %w", err)
+	}
+	return count, nil
+}
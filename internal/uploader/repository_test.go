@@ -8,6 +8,7 @@ import (
 
 	"testing"
 	"time"
+	"volaticus-go/internal/common/cursor"
 	"volaticus-go/internal/common/models"
 	"volaticus-go/internal/config"
 	"volaticus-go/internal/database"
@@ -276,6 +277,7 @@ func TestRepository_GetFileStats(t *testing.T) {
 		assert.Equal(t, 3, stats.TotalFiles)
 		assert.Equal(t, int64(6144), stats.TotalSize) // 1024 + 2048 + 3072
 		assert.Equal(t, int64(3), stats.TotalViews)   // 0 + 1 + 2
+		assert.Equal(t, int64(1024*1024*10-6144), stats.StorageRemaining)
 		assert.Contains(t, stats.PopularTypes, "text/plain")
 	})
 }
@@ -310,6 +312,38 @@ func TestRepository_DeleteFile(t *testing.T) {
 	})
 }
 
+func TestRepository_DeleteUserFilesByIDs(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	cfg := config.Config{UploadUserQuota: 1024 * 1024 * 10} // 10 MB
+
+	repo := NewRepository(db, cfg)
+	ctx := context.Background()
+
+	userID, err := createTestUser(ctx, db)
+	require.NoError(t, err)
+	otherUserID, err := createTestUser(ctx, db)
+	require.NoError(t, err)
+
+	own, err := createTestFile(ctx, repo, userID)
+	require.NoError(t, err)
+	foreign, err := createTestFile(ctx, repo, otherUserID)
+	require.NoError(t, err)
+
+	deleted, err := repo.DeleteUserFilesByIDs(ctx, userID, []uuid.UUID{own.ID, foreign.ID, uuid.New()})
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	assert.Equal(t, own.ID, deleted[0].ID)
+	assert.Equal(t, own.UniqueFilename, deleted[0].UniqueFilename)
+
+	_, err = repo.GetByID(ctx, own.ID)
+	assert.ErrorIs(t, err, ErrNoRows)
+
+	// Files of other users are untouched
+	_, err = repo.GetByID(ctx, foreign.ID)
+	assert.NoError(t, err)
+}
+
 func TestRepository_IncrementAccessCount(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
@@ -338,6 +372,158 @@ func TestRepository_IncrementAccessCount(t *testing.T) {
 	})
 }
 
+func TestRepository_OwnerForceDownload(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	cfg := config.Config{UploadUserQuota: 1024 * 1024 * 10} // 10 MB
+
+	repo := NewRepository(db, cfg)
+	ctx := context.Background()
+
+	userID, err := createTestUser(ctx, db)
+	require.NoError(t, err)
+	file, err := createTestFile(ctx, repo, userID)
+	require.NoError(t, err)
+
+	_, err = db.ExecContext(ctx, `UPDATE users SET force_download = true WHERE id = $1`, userID)
+	require.NoError(t, err)
+
+	byURL, err := repo.GetByURLValue(ctx, file.URLValue)
+	require.NoError(t, err)
+	assert.True(t, byURL.OwnerForceDownload)
+
+	byID, err := repo.GetByID(ctx, file.ID)
+	require.NoError(t, err)
+	assert.True(t, byID.OwnerForceDownload)
+}
+
+func TestRepository_UpdateExpiration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	cfg := config.Config{UploadUserQuota: 1024 * 1024 * 10} // 10 MB
+
+	repo := NewRepository(db, cfg)
+	ctx := context.Background()
+
+	userID, err := createTestUser(ctx, db)
+	require.NoError(t, err)
+
+	t.Run("set and clear expiration", func(t *testing.T) {
+		file, err := createTestFile(ctx, repo, userID)
+		require.NoError(t, err)
+
+		expiresAt := time.Now().Add(48 * time.Hour).Truncate(time.Microsecond)
+		err = repo.UpdateExpiration(ctx, file.ID, &expiresAt)
+		require.NoError(t, err)
+
+		updated, err := repo.GetByID(ctx, file.ID)
+		require.NoError(t, err)
+		require.NotNil(t, updated.ExpiresAt)
+		assert.True(t, expiresAt.Equal(*updated.ExpiresAt))
+
+		err = repo.UpdateExpiration(ctx, file.ID, nil)
+		require.NoError(t, err)
+
+		updated, err = repo.GetByID(ctx, file.ID)
+		require.NoError(t, err)
+		assert.Nil(t, updated.ExpiresAt)
+	})
+
+	t.Run("non-existent file", func(t *testing.T) {
+		err := repo.UpdateExpiration(ctx, uuid.New(), nil)
+		assert.ErrorIs(t, err, ErrNoRows)
+	})
+}
+
+func TestRepository_UpdateVisibility(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	cfg := config.Config{UploadUserQuota: 1024 * 1024 * 10} // 10 MB
+
+	repo := NewRepository(db, cfg)
+	ctx := context.Background()
+
+	userID, err := createTestUser(ctx, db)
+	require.NoError(t, err)
+
+	file, err := createTestFile(ctx, repo, userID)
+	require.NoError(t, err)
+
+	stored, err := repo.GetByID(ctx, file.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.FileVisibilityPublic, stored.Visibility)
+
+	require.NoError(t, repo.UpdateVisibility(ctx, file.ID, models.FileVisibilityPrivate))
+	stored, err = repo.GetByID(ctx, file.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.FileVisibilityPrivate, stored.Visibility)
+
+	err = repo.UpdateVisibility(ctx, uuid.New(), models.FileVisibilityPrivate)
+	assert.ErrorIs(t, err, ErrNoRows)
+}
+
+func TestRepository_AvatarKeys(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewRepository(db, config.Config{})
+	ctx := context.Background()
+
+	userID, err := createTestUser(ctx, db)
+	require.NoError(t, err)
+
+	_, err = repo.GetAvatarKey(ctx, userID)
+	assert.ErrorIs(t, err, ErrNoAvatar)
+
+	key := avatarKey(userID, ".png")
+	require.NoError(t, repo.SetAvatarKey(ctx, userID, &key))
+	stored, err := repo.GetAvatarKey(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, key, stored)
+
+	keys, err := repo.GetAvatarKeys(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, keys, key)
+
+	require.NoError(t, repo.SetAvatarKey(ctx, userID, nil))
+	_, err = repo.GetAvatarKey(ctx, userID)
+	assert.ErrorIs(t, err, ErrNoAvatar)
+}
+
+func TestRepository_SetStorageMissing(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	cfg := config.Config{UploadUserQuota: 1024 * 1024 * 10} // 10 MB
+
+	repo := NewRepository(db, cfg)
+	ctx := context.Background()
+
+	userID, err := createTestUser(ctx, db)
+	require.NoError(t, err)
+
+	file, err := createTestFile(ctx, repo, userID)
+	require.NoError(t, err)
+
+	flagged, err := repo.GetStorageMissingFiles(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, flagged)
+
+	require.NoError(t, repo.SetStorageMissing(ctx, file.ID, true))
+	flagged, err = repo.GetStorageMissingFiles(ctx)
+	require.NoError(t, err)
+	require.Len(t, flagged, 1)
+	assert.Equal(t, file.ID, flagged[0].ID)
+	assert.True(t, flagged[0].StorageMissing)
+
+	require.NoError(t, repo.SetStorageMissing(ctx, file.ID, false))
+	flagged, err = repo.GetStorageMissingFiles(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, flagged)
+
+	err = repo.SetStorageMissing(ctx, uuid.New(), true)
+	assert.ErrorIs(t, err, ErrNoRows)
+}
+
 func TestRepository_GetUserFiles(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
@@ -379,4 +565,208 @@ func TestRepository_GetUserFiles(t *testing.T) {
 			assert.True(t, files[i-1].CreatedAt.After(files[i].CreatedAt))
 		}
 	})
+
+	t.Run("cursor", func(t *testing.T) {
+		all, err := repo.GetUserFiles(ctx, userID, 5, 0)
+		require.NoError(t, err)
+
+		var seen []uuid.UUID
+		var after *cursor.Cursor
+		for {
+			files, err := repo.GetUserFilesAfter(ctx, userID, after, 2)
+			require.NoError(t, err)
+			if len(files) == 0 {
+				break
+			}
+			for _, file := range files {
+				seen = append(seen, file.ID)
+			}
+			last := files[len(files)-1]
+			after = cursor.New(last.CreatedAt, last.ID)
+		}
+
+		require.Len(t, seen, len(all))
+		for i, file := range all {
+			assert.Equal(t, file.ID, seen[i])
+		}
+	})
+}
+
+func TestRepository_StorageReportQueries(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	cfg := config.Config{UploadUserQuota: 1024 * 1024 * 10} // 10 MB
+
+	repo := NewRepository(db, cfg)
+	ctx := context.Background()
+
+	// Create test user
+	userID, err := createTestUser(ctx, db)
+	require.NoError(t, err)
+
+	expiring, err := createTestFile(ctx, repo, userID)
+	require.NoError(t, err)
+	later, err := createTestFile(ctx, repo, userID)
+	require.NoError(t, err)
+
+	soon := time.Now().Add(time.Hour)
+	require.NoError(t, repo.UpdateExpiration(ctx, expiring.ID, &soon))
+	notSoon := time.Now().Add(7 * 24 * time.Hour)
+	require.NoError(t, repo.UpdateExpiration(ctx, later.ID, &notSoon))
+
+	t.Run("usage per user", func(t *testing.T) {
+		usage, err := repo.GetStorageUsageByUser(ctx)
+		require.NoError(t, err)
+
+		var found *models.UserStorageUsage
+		for i := range usage {
+			if usage[i].UserID == userID {
+				found = &usage[i]
+			}
+		}
+		require.NotNil(t, found)
+		assert.Equal(t, 2, found.FileCount)
+		assert.Equal(t, int64(2048), found.TotalSize)
+		assert.NotEmpty(t, found.Username)
+	})
+
+	t.Run("files expiring soon", func(t *testing.T) {
+		files, err := repo.GetFilesExpiringBefore(ctx, time.Now().Add(2*time.Hour))
+		require.NoError(t, err)
+
+		var ids []uuid.UUID
+		for _, file := range files {
+			ids = append(ids, file.ID)
+		}
+		assert.Contains(t, ids, expiring.ID)
+		assert.NotContains(t, ids, later.ID)
+	})
+}
+
+func TestRepository_FileAnalytics(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	cfg := config.Config{UploadUserQuota: 1024 * 1024 * 10} // 10 MB
+
+	repo := NewRepository(db, cfg)
+	ctx := context.Background()
+
+	userID, err := createTestUser(ctx, db)
+	require.NoError(t, err)
+	file, err := createTestFile(ctx, repo, userID)
+	require.NoError(t, err)
+
+	accesses := []struct {
+		referrer string
+		ip       string
+		at       time.Time
+	}{
+		{"https://example.com", "203.0.113.1", time.Now()},
+		{"https://example.com", "203.0.113.2", time.Now()},
+		{"", "203.0.113.1", time.Now().AddDate(0, 0, -1)},
+		{"https://old.example.com", "203.0.113.3", time.Now().AddDate(0, 0, -100)},
+	}
+	for _, a := range accesses {
+		require.NoError(t, repo.RecordAccess(ctx, &models.FileAccess{
+			ID:         uuid.New(),
+			FileID:     file.ID,
+			AccessedAt: a.at,
+			Referrer:   a.referrer,
+			UserAgent:  "test-agent",
+			IPAddress:  a.ip,
+		}))
+	}
+
+	analytics, err := repo.GetFileAnalytics(ctx, file.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 4, analytics.TotalAccesses)
+	assert.Equal(t, 3, analytics.UniqueVisitors)
+	require.NotEmpty(t, analytics.TopReferrers)
+	assert.Equal(t, "https://example.com", analytics.TopReferrers[0].Referrer)
+	assert.Equal(t, 2, analytics.TopReferrers[0].Count)
+	assert.Len(t, analytics.AccessesByDay, 3)
+
+	t.Run("purge old accesses", func(t *testing.T) {
+		deleted, err := repo.DeleteAccessesBefore(ctx, time.Now().AddDate(0, 0, -30))
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), deleted)
+
+		analytics, err := repo.GetFileAnalytics(ctx, file.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 3, analytics.TotalAccesses)
+	})
+}
+
+func TestRepository_Folders(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	cfg := config.Config{UploadUserQuota: 1024 * 1024 * 10} // 10 MB
+
+	repo := NewRepository(db, cfg)
+	ctx := context.Background()
+
+	userID, err := createTestUser(ctx, db)
+	require.NoError(t, err)
+	otherUserID, err := createTestUser(ctx, db)
+	require.NoError(t, err)
+
+	newFolder := func(name string, parentID *uuid.UUID) *models.Folder {
+		return &models.Folder{ID: uuid.New(), UserID: userID, ParentID: parentID, Name: name, CreatedAt: time.Now()}
+	}
+	photos := newFolder("Photos", nil)
+	require.NoError(t, repo.CreateFolder(ctx, photos))
+	trip := newFolder("Trip", &photos.ID)
+	require.NoError(t, repo.CreateFolder(ctx, trip))
+
+	// Names are unique per parent, ignoring case
+	assert.ErrorIs(t, repo.CreateFolder(ctx, newFolder("photos", nil)), ErrFolderExists)
+	require.NoError(t, repo.CreateFolder(ctx, newFolder("Photos", &trip.ID)))
+
+	file, err := createTestFile(ctx, repo, userID)
+	require.NoError(t, err)
+	foreign, err := createTestFile(ctx, repo, otherUserID)
+	require.NoError(t, err)
+
+	moved, err := repo.MoveFiles(ctx, userID, []uuid.UUID{file.ID, foreign.ID}, &trip.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), moved)
+
+	files, err := repo.GetFolderFiles(ctx, userID, &trip.ID, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, file.ID, files[0].ID)
+	files, err = repo.GetFolderFilesAfter(ctx, userID, &trip.ID, nil, 10)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, file.ID, files[0].ID)
+	files, err = repo.GetFolderFilesAfter(ctx, userID, &trip.ID, cursor.New(file.CreatedAt, file.ID), 10)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+	count, err := repo.GetFolderFilesCount(ctx, userID, nil)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	t.Run("block non-empty", func(t *testing.T) {
+		assert.ErrorIs(t, repo.DeleteFolder(ctx, trip, false), ErrFolderNotEmpty)
+	})
+
+	t.Run("reparent", func(t *testing.T) {
+		require.NoError(t, repo.DeleteFolder(ctx, trip, true))
+
+		_, err := repo.GetFolder(ctx, trip.ID)
+		assert.ErrorIs(t, err, ErrFolderNotFound)
+		files, err := repo.GetFolderFiles(ctx, userID, &photos.ID, 10, 0)
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		assert.Equal(t, file.ID, files[0].ID)
+
+		folders, err := repo.GetFolders(ctx, userID)
+		require.NoError(t, err)
+		require.Len(t, folders, 2)
+		for _, folder := range folders {
+			if folder.ID != photos.ID {
+				assert.Equal(t, &photos.ID, folder.ParentID)
+			}
+		}
+	})
 }
@@ -0,0 +1,134 @@
+package uploader
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// scanChunkSize is the size of the chunks streamed to clamd
+const scanChunkSize = 64 * 1024
+
+// Scanner checks uploaded content for malware
+type Scanner interface {
+	// Scan reads the content and returns an error wrapping ErrInfected if malware was found
+	Scan(ctx context.Context, r io.Reader) error
+}
+
+// NewScanner returns a ClamAV scanner for the address, or a scanner accepting everything if no address is set
+func NewScanner(address string, timeout time.Duration) Scanner {
+	if address == "" {
+		return noopScanner{}
+	}
+	return NewClamAVScanner(address, timeout)
+}
+
+type noopScanner struct{}
+
+func (noopScanner) Scan(context.Context, io.Reader) error {
+	return nil
+}
+
+// ClamAVScanner scans content with a clamd daemon using the INSTREAM command
+type ClamAVScanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamAVScanner creates a scanner for clamd listening on a TCP address like "localhost:3310"
+// or a unix socket like "unix:///var/run/clamav/clamd.ctl"
+func NewClamAVScanner(address string, timeout time.Duration) *ClamAVScanner {
+	network := "tcp"
+	if path, ok := strings.CutPrefix(address, "unix://"); ok {
+		network, address = "unix", path
+	} else {
+		address = strings.TrimPrefix(address, "tcp://")
+	}
+
+	return &ClamAVScanner{
+		network: network,
+		address: address,
+		timeout: timeout,
+	}
+}
+
+func (s *ClamAVScanner) Scan(ctx context.Context, r io.Reader) error {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return fmt.Errorf("connecting to clamd: %w", err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return fmt.Errorf("setting clamd deadline: %w", err)
+		}
+	}
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return fmt.Errorf("sending clamd command: %w", err)
+	}
+
+	// Content is sent as length prefixed chunks, terminated by an empty chunk
+	buf := make([]byte, scanChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := conn.Write(size); err != nil {
+				return fmt.Errorf("streaming to clamd: %w", err)
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				return fmt.Errorf("streaming to clamd: %w", err)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return fmt.Errorf("reading file for scan: %w", readErr)
+		}
+	}
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := conn.Write(size); err != nil {
+		return fmt.Errorf("streaming to clamd: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("reading clamd reply: %w", err)
+	}
+	return parseClamAVReply(string(bytes.TrimRight(reply, "\x00\n")))
+}
+
+// parseClamAVReply interprets replies like "stream: OK" or "stream: Eicar-Signature FOUND"
+func parseClamAVReply(reply string) error {
+	result := strings.TrimSpace(reply)
+	if i := strings.Index(result, ": "); i >= 0 {
+		result = result[i+2:]
+	}
+
+	switch {
+	case result == "OK":
+		return nil
+	case strings.HasSuffix(result, " FOUND"):
+		return fmt.Errorf("%w: %s", ErrInfected, strings.TrimSuffix(result, " FOUND"))
+	default:
+		return fmt.Errorf("unexpected clamd reply: %q", reply)
+	}
+}
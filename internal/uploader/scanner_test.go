@@ -0,0 +1,109 @@
+package uploader
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClamd accepts a single INSTREAM session and replies with the result of inspect
+func fakeClamd(t *testing.T, inspect func(content string) string) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		if _, err := reader.ReadString(0); err != nil {
+			return
+		}
+
+		var content strings.Builder
+		size := make([]byte, 4)
+		for {
+			if _, err := io.ReadFull(reader, size); err != nil {
+				return
+			}
+			n := binary.BigEndian.Uint32(size)
+			if n == 0 {
+				break
+			}
+			if _, err := io.CopyN(&content, reader, int64(n)); err != nil {
+				return
+			}
+		}
+
+		conn.Write([]byte(inspect(content.String()) + "\x00"))
+	}()
+
+	return ln.Addr().String()
+}
+
+func TestClamAVScanner(t *testing.T) {
+	inspect := func(content string) string {
+		if strings.Contains(content, "EICAR") {
+			return "stream: Eicar-Signature FOUND"
+		}
+		return "stream: OK"
+	}
+
+	t.Run("clean file", func(t *testing.T) {
+		scanner := NewClamAVScanner(fakeClamd(t, inspect), time.Second)
+		if err := scanner.Scan(context.Background(), strings.NewReader("hello world")); err != nil {
+			t.Errorf("Scan() error = %v, want nil", err)
+		}
+	})
+
+	t.Run("infected file", func(t *testing.T) {
+		scanner := NewClamAVScanner("tcp://"+fakeClamd(t, inspect), time.Second)
+		err := scanner.Scan(context.Background(), strings.NewReader("X5O!P%@AP EICAR test"))
+		if !errors.Is(err, ErrInfected) {
+			t.Fatalf("Scan() error = %v, want ErrInfected", err)
+		}
+		if !strings.Contains(err.Error(), "Eicar-Signature") {
+			t.Errorf("Scan() error = %q, want the signature name", err)
+		}
+	})
+
+	t.Run("unreachable daemon", func(t *testing.T) {
+		scanner := NewClamAVScanner("127.0.0.1:1", time.Second)
+		err := scanner.Scan(context.Background(), strings.NewReader("data"))
+		if err == nil || errors.Is(err, ErrInfected) {
+			t.Errorf("Scan() error = %v, want a connection error", err)
+		}
+	})
+}
+
+func TestParseClamAVReply(t *testing.T) {
+	if err := parseClamAVReply("stream: OK"); err != nil {
+		t.Errorf("OK reply returned %v", err)
+	}
+	if err := parseClamAVReply("stream: Win.Test FOUND"); !errors.Is(err, ErrInfected) {
+		t.Errorf("FOUND reply returned %v, want ErrInfected", err)
+	}
+	if err := parseClamAVReply("INSTREAM size limit exceeded. ERROR"); err == nil || errors.Is(err, ErrInfected) {
+		t.Errorf("ERROR reply returned %v, want a scan error", err)
+	}
+}
+
+func TestNewScannerUnconfigured(t *testing.T) {
+	if err := NewScanner("", time.Second).Scan(context.Background(), strings.NewReader("anything")); err != nil {
+		t.Errorf("unconfigured scanner returned %v", err)
+	}
+}
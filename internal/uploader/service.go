@@ -2,27 +2,50 @@ package uploader
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"mime/multipart"
 	"net/http"
-	"path/filepath"
+	"sort"
 	"strings"
 	"time"
+	"volaticus-go/internal/common/clientip"
+	"volaticus-go/internal/common/cursor"
 	"volaticus-go/internal/common/models"
 	"volaticus-go/internal/config"
 	userctx "volaticus-go/internal/context"
 	"volaticus-go/internal/storage"
 
+	"github.com/dustin/go-humanize"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 )
 
+const (
+	// deletionRetryBatch is the number of failed storage deletions retried per cleanup run
+	deletionRetryBatch = 100
+	// maxDeletionRetryDelay caps the wait between attempts of a failing storage deletion
+	maxDeletionRetryDelay = 6 * time.Hour
+)
+
 // UploadRequest represents file upload parameters
 type UploadRequest struct {
 	File    multipart.File
 	Header  *multipart.FileHeader
 	URLType URLType
 	UserID  uuid.UUID
+	// ExpiresIn is the requested lifetime of the file, nil uses the configured default and 0 never expires
+	ExpiresIn *time.Duration
+	// ForceDownload serves the file as an attachment instead of rendering it in the browser
+	ForceDownload bool
+}
+
+// UploadResult is the outcome of a single file of a batch upload
+type UploadResult struct {
+	FileName string
+	File     *models.UploadedFile
+	Err      error
 }
 
 // FileValidationResult contains validation results TODO: json tags
@@ -41,9 +64,24 @@ type Service interface {
 	// GetFile retrieves file information
 	GetFile(ctx context.Context, fileUrl string) (*models.UploadedFile, error)
 
+	// GetUserFile retrieves a file by ID if it belongs to the user
+	GetUserFile(ctx context.Context, fileID, userID uuid.UUID) (*models.UploadedFile, error)
+
 	// ServeFile serves a file to an HTTP response
 	ServeFile(ctx context.Context, w http.ResponseWriter, file *models.UploadedFile) error
 
+	// RecordAccess records a download of a file in the background
+	RecordAccess(file *models.UploadedFile, r *models.RequestInfo)
+
+	// GetFileAnalytics returns the download history of a file
+	GetFileAnalytics(ctx context.Context, fileID, userID uuid.UUID) (*models.FileAnalytics, error)
+
+	// UpdateFileExpiration changes when a file expires, nil disables expiration
+	UpdateFileExpiration(ctx context.Context, fileID, userID uuid.UUID, expiresAt *time.Time) error
+
+	// UpdateFileVisibility makes a file public or private
+	UpdateFileVisibility(ctx context.Context, fileID, userID uuid.UUID, visibility string) error
+
 	// DeleteFileByID deletes a file
 	DeleteFileByID(ctx context.Context, fileID, userID uuid.UUID) error
 
@@ -53,11 +91,26 @@ type Service interface {
 	// CleanupExpiredFiles removes expired files
 	CleanupExpiredFiles(ctx context.Context) error
 
-	// SyncStorageWithDatabase ensures storage and database are in sync
-	SyncStorageWithDatabase(ctx context.Context) error
+	// RetryPendingDeletions retries the storage deletions that failed when their file was deleted
+	RetryPendingDeletions(ctx context.Context) error
+
+	// SyncStorageWithDatabase ensures storage and database are in sync, a dry run only reports the candidates
+	SyncStorageWithDatabase(ctx context.Context, dryRun bool) (*models.StorageSyncResult, error)
+
+	// VerifyStorage flags the files whose object is missing in storage instead of deleting them
+	VerifyStorage(ctx context.Context) (*models.StorageVerifyResult, error)
+
+	// StorageReport summarizes storage usage and drift without changing anything
+	StorageReport(ctx context.Context, expiringWithin time.Duration) (*models.StorageReport, error)
 
 	// ValidateFile validates an uploaded file
 	ValidateFile(ctx context.Context, file multipart.File, header *multipart.FileHeader) *FileValidationResult
+
+	// SetAvatar replaces the profile picture of a user
+	SetAvatar(ctx context.Context, userID uuid.UUID, file multipart.File, header *multipart.FileHeader) error
+
+	// ServeAvatar streams the profile picture of a user
+	ServeAvatar(ctx context.Context, w http.ResponseWriter, userID uuid.UUID) error
 }
 
 type service struct {
@@ -65,6 +118,10 @@ type service struct {
 	config       *config.Config
 	storage      storage.StorageProvider
 	urlGenerator *URLGenerator
+	signer       *URLSigner
+	scanner      Scanner
+	storedName   filenameGenerator
+	clientIP     *clientip.Resolver
 }
 
 func NewService(repo Repository, config *config.Config, storage storage.StorageProvider) *service {
@@ -73,32 +130,64 @@ func NewService(repo Repository, config *config.Config, storage storage.StorageP
 		config:       config,
 		storage:      storage,
 		urlGenerator: NewURLGenerator(),
+		signer:       NewURLSigner(config.Secret),
+		scanner:      NewScanner(config.ClamAVAddress, config.ClamAVTimeout),
+		storedName:   newFilenameGenerator(config.UploadNaming),
+		clientIP:     clientip.NewResolver(config.TrustProxyHops, config.TrustedProxies),
 	}
 }
 
 // UploadFile handles the file upload process
 func (s *service) UploadFile(ctx context.Context, req *UploadRequest) (*models.UploadedFile, error) {
+	if req.Header.Size > s.config.UploadMaxSize {
+		return nil, fmt.Errorf("%w (max %s)", ErrFileTooLarge, formatSize(s.config.UploadMaxSize))
+	}
+
+	if err := s.checkFileLimit(ctx, req.UserID, 1); err != nil {
+		return nil, err
+	}
+
+	// The name ends up in headers and links, tricky unicode and overlong names are cleaned up first
+	filename := cleanFilename(req.Header.Filename, s.config.FilenameMaxLen)
+
 	// Verify file first
 	validation := s.ValidateFile(ctx, req.File, req.Header)
 	if !validation.IsValid {
-		return nil, fmt.Errorf("file validation failed: %s", validation.Error)
+		return nil, fmt.Errorf("%w: %s", ErrValidationFailed, validation.Error)
+	}
+
+	// Scan before anything is written, infected files never reach the storage
+	if err := s.scanner.Scan(ctx, req.File); err != nil {
+		if errors.Is(err, ErrInfected) {
+			log.Warn().
+				Err(err).
+				Str("user_id", req.UserID.String()).
+				Str("filename", filename).
+				Msg("rejected infected upload")
+			return nil, err
+		}
+		return nil, fmt.Errorf("scanning file: %w", err)
+	}
+	if _, err := req.File.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("resetting file after scan: %w", err)
 	}
 
 	// Generate URL based on selected type
-	urlValue, err := s.urlGenerator.GenerateURL(req.URLType, req.Header.Filename)
+	urlValue, err := s.urlGenerator.GenerateURL(req.URLType, filename)
 	if err != nil {
 		return nil, fmt.Errorf("error generating URL: %w", err)
 	}
 
 	// Add extension if not present
-	ext := filepath.Ext(req.Header.Filename)
-	if ext != "" && !strings.Contains(urlValue, ext) {
-		urlValue = urlValue + ext
+	ext := fileExtension(filename)
+	if urlExt := urlExtension(filename); urlExt != "" && !strings.HasSuffix(urlValue, urlExt) {
+		urlValue = urlValue + urlExt
 	}
 
-	unixTimestamp := uint64(time.Now().UnixNano())
-	randomChars := uuid.New().String()[:4] // include 4 random chars for the rare case of a collision
-	uniqueFilename := fmt.Sprintf("%s-%d%s", randomChars, unixTimestamp, ext)
+	uniqueFilename, err := s.storedName(req.File, ext)
+	if err != nil {
+		return nil, fmt.Errorf("generating stored filename: %w", err)
+	}
 
 	// Upload file to storage
 	if _, err := s.storage.Upload(ctx, req.File, uniqueFilename); err != nil {
@@ -108,32 +197,128 @@ func (s *service) UploadFile(ctx context.Context, req *UploadRequest) (*models.U
 	// Create uploaded file record
 	uploadedFile := &models.UploadedFile{
 		ID:             uuid.New(),
-		OriginalName:   req.Header.Filename,
+		OriginalName:   filename,
 		UniqueFilename: uniqueFilename,
 		MimeType:       validation.ContentType,
 		FileSize:       uint64(req.Header.Size),
 		UserID:         req.UserID,
 		CreatedAt:      time.Now(),
 		AccessCount:    0,
-		ExpiresAt:      time.Now().Add(s.config.UploadExpiresIn),
+		ExpiresAt:      expiresAt(time.Now(), req.ExpiresIn, s.config.UploadExpiresIn, s.config.UploadMaxExpiry),
 		URLValue:       urlValue,
+		ForceDownload:  req.ForceDownload,
+	}
+
+	if s.publicObject(uploadedFile) {
+		if err := s.storage.SetPublic(ctx, uniqueFilename, true); err != nil {
+			s.deleteObject(ctx, uniqueFilename)
+			return nil, fmt.Errorf("making file public: %w", err)
+		}
 	}
 
 	// Save to database
 	if err := s.repo.CreateWithURL(ctx, uploadedFile, urlValue); err != nil {
 		// Rollback file creation if database save fails
-		if delErr := s.storage.Delete(ctx, uniqueFilename); delErr != nil {
-			log.Error().
-				Err(delErr).
-				Str("filename", uniqueFilename).
-				Msg("failed to clean up file after failed database save")
-		}
+		s.deleteObject(ctx, uniqueFilename)
 		return nil, fmt.Errorf("saving to database: %w", err)
 	}
 
 	return uploadedFile, nil
 }
 
+// UploadFiles uploads a batch of files of one user. The whole batch is rejected if it carries more
+// than UploadMaxFiles files or would exceed the user's quota or file limit, otherwise every file
+// succeeds or fails on its own.
+func (s *service) UploadFiles(ctx context.Context, userID uuid.UUID, headers []*multipart.FileHeader, urlType URLType, expiresIn *time.Duration, forceDownload bool) ([]UploadResult, error) {
+	if maxFiles := s.config.UploadMaxFiles; maxFiles > 0 && len(headers) > maxFiles {
+		return nil, fmt.Errorf("%w (max %d)", ErrTooManyFiles, maxFiles)
+	}
+	var total int64
+	for _, header := range headers {
+		total += header.Size
+	}
+	if err := s.checkQuota(ctx, userID, total); err != nil {
+		return nil, err
+	}
+	if err := s.checkFileLimit(ctx, userID, len(headers)); err != nil {
+		return nil, err
+	}
+
+	results := make([]UploadResult, 0, len(headers))
+	for _, header := range headers {
+		result := UploadResult{FileName: header.Filename}
+		result.File, result.Err = s.uploadHeader(ctx, &UploadRequest{
+			Header:        header,
+			URLType:       urlType,
+			UserID:        userID,
+			ExpiresIn:     expiresIn,
+			ForceDownload: forceDownload,
+		})
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// uploadHeader opens the file of a multipart header and uploads it
+func (s *service) uploadHeader(ctx context.Context, req *UploadRequest) (*models.UploadedFile, error) {
+	file, err := req.Header.Open()
+	if err != nil {
+		return nil, fmt.Errorf("opening uploaded file: %w", err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Error().
+				Err(err).
+				Msg("Error closing file")
+		}
+	}()
+
+	req.File = file
+	return s.UploadFile(ctx, req)
+}
+
+// checkQuota verifies the user can store size more bytes
+func (s *service) checkQuota(ctx context.Context, userID uuid.UUID, size int64) error {
+	stats, err := s.repo.GetFileStats(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("checking storage quota: %w", err)
+	}
+
+	if stats.TotalSize+size > s.config.UploadUserQuota {
+		log.Warn().
+			Str("user_id", userID.String()).
+			Int64("current_size", stats.TotalSize).
+			Int64("upload_size", size).
+			Int64("quota", s.config.UploadUserQuota).
+			Msg("Upload would exceed user quota")
+		return fmt.Errorf("%w of %s", ErrQuotaExceeded, formatSize(s.config.UploadUserQuota))
+	}
+	return nil
+}
+
+// checkFileLimit verifies the user can store count more files
+func (s *service) checkFileLimit(ctx context.Context, userID uuid.UUID, count int) error {
+	if s.config.MaxUserFiles <= 0 {
+		return nil
+	}
+
+	files, err := s.repo.GetUserFilesCount(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("checking file limit: %w", err)
+	}
+
+	if files+count > s.config.MaxUserFiles {
+		log.Warn().
+			Str("user_id", userID.String()).
+			Int("current_files", files).
+			Int("upload_files", count).
+			Int("limit", s.config.MaxUserFiles).
+			Msg("Upload would exceed user file limit")
+		return fmt.Errorf("%w of %d files", ErrFileLimitReached, s.config.MaxUserFiles)
+	}
+	return nil
+}
+
 // GetFile retrieves file information
 func (s *service) GetFile(ctx context.Context, fileUrl string) (*models.UploadedFile, error) {
 	file, err := s.repo.GetByURLValue(ctx, fileUrl)
@@ -142,18 +327,222 @@ func (s *service) GetFile(ctx context.Context, fileUrl string) (*models.Uploaded
 	}
 
 	// Check if file is expired
-	if !file.ExpiresAt.IsZero() && time.Now().After(file.ExpiresAt) {
-		return nil, fmt.Errorf("file has expired")
+	if file.ExpiresAt != nil && time.Now().After(*file.ExpiresAt) {
+		return nil, ErrFileExpired
+	}
+	// Streaming a lost object fails after the headers are sent, it is reported as not found instead
+	if file.StorageMissing {
+		return nil, ErrStorageMissing
+	}
+
+	return file, nil
+}
+
+// RecordAccess counts a download of the file and stores it in the access log.
+// Recording happens in the background so serving the file is not delayed.
+func (s *service) RecordAccess(file *models.UploadedFile, r *models.RequestInfo) {
+	asyncCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+
+	go func() {
+		defer cancel()
+
+		access := &models.FileAccess{
+			ID:         uuid.New(),
+			FileID:     file.ID,
+			AccessedAt: time.Now(),
+			Referrer:   r.Referrer,
+			UserAgent:  r.UserAgent,
+			IPAddress:  clientip.ForStorage(r.IPAddress, s.config.AnalyticsIPMode, s.config.Secret),
+		}
+		if err := s.repo.RecordAccess(asyncCtx, access); err != nil {
+			log.Error().
+				Err(err).
+				Str("file_id", file.ID.String()).
+				Msg("failed to record file access")
+		}
+
+		if err := s.repo.IncrementAccessCount(asyncCtx, file.ID); err != nil {
+			log.Error().
+				Err(err).
+				Str("file_id", file.ID.String()).
+				Msg("failed to increment access count")
+		}
+	}()
+}
+
+// GetFileAnalytics returns the download history of a file owned by the user
+func (s *service) GetFileAnalytics(ctx context.Context, fileID, userID uuid.UUID) (*models.FileAnalytics, error) {
+	file, err := s.repo.GetByID(ctx, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("getting file details: %w", err)
+	}
+
+	if file.UserID != userID {
+		return nil, ErrUnauthorized
+	}
+
+	analytics, err := s.repo.GetFileAnalytics(ctx, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("getting file analytics: %w", err)
+	}
+	analytics.File = file
+	return analytics, nil
+}
+
+// PurgeOldAccessLogs deletes file downloads older than the analytics retention period
+func (s *service) PurgeOldAccessLogs(ctx context.Context) error {
+	if s.config.RetentionDays <= 0 {
+		return nil
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -s.config.RetentionDays)
+	deleted, err := s.repo.DeleteAccessesBefore(ctx, cutoff)
+	if err != nil {
+		return fmt.Errorf("deleting old file access logs: %w", err)
+	}
+
+	if deleted > 0 {
+		log.Info().
+			Int64("deleted", deleted).
+			Time("cutoff", cutoff).
+			Msg("Purged old file access logs")
+	}
+	return nil
+}
+
+// UpdateFileExpiration changes the expiration of a file owned by the user
+func (s *service) UpdateFileExpiration(ctx context.Context, fileID, userID uuid.UUID, expiresAt *time.Time) error {
+	file, err := s.repo.GetByID(ctx, fileID)
+	if err != nil {
+		return fmt.Errorf("getting file details: %w", err)
+	}
+
+	if file.UserID != userID {
+		return ErrUnauthorized
+	}
+
+	now := time.Now()
+	if expiresAt != nil && !expiresAt.After(now) {
+		return fmt.Errorf("%w: expiration must be in the future", ErrInvalidExpiration)
+	}
+
+	if expiresAt != nil {
+		utc := expiresAt.UTC()
+		expiresAt = &utc
+	}
+	// Like at upload, later dates and never expiring are clamped to the configured maximum
+	if maxExpiry := s.config.UploadMaxExpiry; maxExpiry > 0 {
+		if limit := now.Add(maxExpiry).UTC(); expiresAt == nil || expiresAt.After(limit) {
+			expiresAt = &limit
+		}
+	}
+
+	updated := *file
+	updated.ExpiresAt = expiresAt
+	return s.withObjectACL(ctx, file, &updated, func() error {
+		if err := s.repo.UpdateExpiration(ctx, fileID, expiresAt); err != nil {
+			return fmt.Errorf("updating expiration: %w", err)
+		}
+		return nil
+	})
+}
+
+// UpdateFileVisibility changes who a file is served to, only its owner may change it
+func (s *service) UpdateFileVisibility(ctx context.Context, fileID, userID uuid.UUID, visibility string) error {
+	if visibility != models.FileVisibilityPublic && visibility != models.FileVisibilityPrivate {
+		return ErrInvalidVisibility
+	}
+
+	file, err := s.repo.GetByID(ctx, fileID)
+	if err != nil {
+		return fmt.Errorf("getting file details: %w", err)
+	}
+
+	if file.UserID != userID {
+		return ErrUnauthorized
 	}
 
-	if err := s.repo.IncrementAccessCount(ctx, file.ID); err != nil {
+	updated := *file
+	updated.Visibility = visibility
+	return s.withObjectACL(ctx, file, &updated, func() error {
+		if err := s.repo.UpdateVisibility(ctx, fileID, visibility); err != nil {
+			return fmt.Errorf("updating visibility: %w", err)
+		}
+		return nil
+	})
+}
+
+// publicObject reports whether the object of a file may be read from the bucket directly. Only
+// public files that never expire qualify, once a bucket URL has been handed out it can't be taken
+// back when the file is made private or expires.
+func (s *service) publicObject(file *models.UploadedFile) bool {
+	return s.config.Storage.PublicObjects && file.Visibility != models.FileVisibilityPrivate && file.ExpiresAt == nil
+}
+
+// withObjectACL changes the object ACL from what old needs to what updated needs before update
+// stores the change, and restores it if storing fails
+func (s *service) withObjectACL(ctx context.Context, old, updated *models.UploadedFile, update func() error) error {
+	was, is := s.publicObject(old), s.publicObject(updated)
+	if was == is {
+		return update()
+	}
+	if err := s.storage.SetPublic(ctx, old.UniqueFilename, is); err != nil {
+		return fmt.Errorf("changing object access: %w", err)
+	}
+	if err := update(); err != nil {
+		if aclErr := s.storage.SetPublic(ctx, old.UniqueFilename, was); aclErr != nil {
+			log.Error().
+				Err(aclErr).
+				Str("file_id", old.ID.String()).
+				Bool("public", was).
+				Msg("failed to restore object access")
+		}
+		return err
+	}
+	return nil
+}
+
+// SignFileURL creates a temporary download link for a file owned by the user
+func (s *service) SignFileURL(ctx context.Context, fileID, userID uuid.UUID, ttl time.Duration) (string, time.Time, error) {
+	file, err := s.repo.GetByID(ctx, fileID)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("getting file details: %w", err)
+	}
+
+	if file.UserID != userID {
+		return "", time.Time{}, ErrUnauthorized
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	token := s.signer.Sign(file.URLValue, expiresAt)
+
+	return fmt.Sprintf("%s/d/%s", s.config.BaseURL, token), expiresAt, nil
+}
+
+// GetSignedFile retrieves the file a signed download token grants access to
+func (s *service) GetSignedFile(ctx context.Context, token string) (*models.UploadedFile, error) {
+	urlValue, err := s.signer.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetFile(ctx, urlValue)
+}
+
+// directURL returns the URL the storage provider serves a file from without going through
+// the app, if public objects are enabled and the object of the file is one of them
+func (s *service) directURL(ctx context.Context, file *models.UploadedFile) (string, bool) {
+	if !s.publicObject(file) {
+		return "", false
+	}
+	url, _, err := s.storage.GetURL(ctx, file.UniqueFilename)
+	if err != nil {
 		log.Error().
 			Err(err).
-			Str("file_id", file.ID.String()).
-			Msg("failed to increment access count")
+			Str("filename", file.UniqueFilename).
+			Msg("failed to get direct file URL, streaming instead")
+		return "", false
 	}
-
-	return file, nil
+	return url, true
 }
 
 // ServeFile serves the file through the storage provider
@@ -200,19 +589,29 @@ func (s *service) ValidateFile(ctx context.Context, file multipart.File, header
 		return result
 	}
 
-	// Read first 512 bytes for content type detection
-	buff := make([]byte, 512)
-	if _, err := file.Read(buff); err != nil {
+	contentType, err := detectContentType(file, header.Filename, s.config.MIMEOverrides)
+	if err != nil {
 		result.Error = "Error reading file"
 		return result
 	}
 
-	if _, err := file.Seek(0, 0); err != nil {
-		result.Error = "Error processing file"
-		return result
+	if strings.HasPrefix(contentType, "image/") && s.config.ImageMaxPixels > 0 {
+		if err := checkImageDimensions(file, s.config.ImageMaxPixels); err != nil {
+			if !errors.Is(err, ErrImageTooLarge) {
+				result.Error = "Error reading file"
+				return result
+			}
+			result.Error = fmt.Sprintf("Image too large (max %s pixels)", humanize.Comma(s.config.ImageMaxPixels))
+			log.Warn().
+				Err(err).
+				Str("user_id", user.ID.String()).
+				Str("filename", header.Filename).
+				Msg("Rejected image exceeding the pixel limit")
+			return result
+		}
 	}
 
-	result.ContentType = http.DetectContentType(buff)
+	result.ContentType = contentType
 	result.IsValid = true
 	return result
 }
@@ -235,6 +634,24 @@ func (s *service) GetUserFiles(ctx context.Context, userID uuid.UUID, limit, off
 	return s.repo.GetUserFiles(ctx, userID, limit, offset)
 }
 
+// GetUserFilesAfter retrieves the files of a user following a cursor, newest first
+func (s *service) GetUserFilesAfter(ctx context.Context, userID uuid.UUID, after *cursor.Cursor, limit int) ([]*models.UploadedFile, error) {
+	return s.repo.GetUserFilesAfter(ctx, userID, after, limit)
+}
+
+// GetUserFile gets a file of the user by its ID, expired files that are not cleaned up yet included
+func (s *service) GetUserFile(ctx context.Context, fileID, userID uuid.UUID) (*models.UploadedFile, error) {
+	file, err := s.repo.GetByID(ctx, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("getting file details: %w", err)
+	}
+
+	if file.UserID != userID {
+		return nil, ErrUnauthorized
+	}
+	return file, nil
+}
+
 // GetUserFilesCount gets the total number of files for a user
 func (s *service) GetUserFilesCount(ctx context.Context, userID uuid.UUID) (int, error) {
 	return s.repo.GetUserFilesCount(ctx, userID)
@@ -251,19 +668,179 @@ func (s *service) DeleteFileByID(ctx context.Context, fileID, userID uuid.UUID)
 		return ErrUnauthorized
 	}
 
-	if err := s.storage.Delete(ctx, file.UniqueFilename); err != nil {
-		return fmt.Errorf("deleting file from storage: %w", err)
+	return s.deleteFile(ctx, file)
+}
+
+// DeleteURL returns the link deleting the file without a session
+func (s *service) DeleteURL(file *models.UploadedFile) string {
+	return fmt.Sprintf("%s/api/v1/files/%s?token=%s", s.config.BaseURL, file.ID, s.signer.DeleteToken(file.ID))
+}
+
+// DeleteFileByToken deletes a file using the delete token returned at upload time
+func (s *service) DeleteFileByToken(ctx context.Context, fileID uuid.UUID, token string) error {
+	if !s.signer.VerifyDeleteToken(fileID, token) {
+		return ErrInvalidSignature
 	}
 
-	if err := s.repo.Delete(ctx, fileID); err != nil {
+	file, err := s.repo.GetByID(ctx, fileID)
+	if err != nil {
+		return fmt.Errorf("getting file details: %w", err)
+	}
+
+	return s.deleteFile(ctx, file)
+}
+
+// deleteFile removes the file from the database and then from storage. Once the record is gone the
+// file is deleted for the user, a failed storage deletion is retried by the cleanup worker.
+func (s *service) deleteFile(ctx context.Context, file *models.UploadedFile) error {
+	if err := s.repo.Delete(ctx, file.ID); err != nil {
+		return fmt.Errorf("deleting file from database: %w", err)
+	}
+
+	s.deleteObject(ctx, file.UniqueFilename)
+	return nil
+}
+
+// deleteObject removes an object from storage, queueing it for a retry if that fails
+func (s *service) deleteObject(ctx context.Context, filename string) {
+	err := s.storage.Delete(ctx, filename)
+	if err == nil {
+		return
+	}
+	log.Warn().
+		Err(err).
+		Str("filename", filename).
+		Msg("failed to delete file from storage, retrying later")
+
+	// A client giving up must not keep the retry from being recorded
+	ctx = context.WithoutCancel(ctx)
+	if err := s.repo.QueueDeletion(ctx, filename, err.Error(), time.Now().Add(deletionRetryDelay(1))); err != nil {
 		log.Error().
 			Err(err).
-			Str("file_id", fileID.String()).
-			Str("filename", file.UniqueFilename).
-			Msg("file deleted from storage but database deletion failed")
-		return fmt.Errorf("deleting file from database: %w", err)
+			Str("filename", filename).
+			Msg("failed to queue storage deletion, the storage sync reports the object as orphaned")
+	}
+}
+
+// deletionRetryDelay is the wait before the next attempt of a storage deletion that failed
+// attempts times, doubling from a minute up to maxDeletionRetryDelay
+func deletionRetryDelay(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	if attempts > 16 {
+		return maxDeletionRetryDelay
+	}
+	return min(time.Minute<<(attempts-1), maxDeletionRetryDelay)
+}
+
+// RetryPendingDeletions retries the storage deletions that failed when their file was deleted
+func (s *service) RetryPendingDeletions(ctx context.Context) error {
+	pending, err := s.repo.GetDueDeletions(ctx, time.Now(), deletionRetryBatch)
+	if err != nil {
+		return fmt.Errorf("getting pending deletions: %w", err)
+	}
+
+	for _, deletion := range pending {
+		// A new upload may have been stored under the same name since, its object must stay
+		_, err := s.repo.GetByUniqueFilename(ctx, deletion.Filename)
+		if err == nil {
+			s.removePendingDeletion(ctx, deletion.Filename)
+			continue
+		}
+		if !errors.Is(err, ErrNoRows) {
+			log.Error().
+				Err(err).
+				Str("filename", deletion.Filename).
+				Msg("failed to look up file of pending deletion")
+			continue
+		}
+
+		if err := s.storage.Delete(ctx, deletion.Filename); err != nil {
+			// Deleting an object that is already gone fails with some providers
+			if exists, existsErr := s.storage.Exists(ctx, deletion.Filename); existsErr != nil || exists {
+				attempts := deletion.Attempts + 1
+				log.Warn().
+					Err(err).
+					Str("filename", deletion.Filename).
+					Int("attempts", attempts).
+					Msg("retried storage deletion failed")
+				if err := s.repo.QueueDeletion(ctx, deletion.Filename, err.Error(), time.Now().Add(deletionRetryDelay(attempts))); err != nil {
+					log.Error().
+						Err(err).
+						Str("filename", deletion.Filename).
+						Msg("failed to reschedule storage deletion")
+				}
+				continue
+			}
+		}
+
+		log.Info().
+			Str("filename", deletion.Filename).
+			Int("attempts", deletion.Attempts).
+			Msg("deleted file from storage after failed attempts")
+		s.removePendingDeletion(ctx, deletion.Filename)
+	}
+	return nil
+}
+
+func (s *service) removePendingDeletion(ctx context.Context, filename string) {
+	if err := s.repo.RemovePendingDeletion(ctx, filename); err != nil {
+		log.Error().
+			Err(err).
+			Str("filename", filename).
+			Msg("failed to remove pending deletion")
+	}
+}
+
+// DeleteFiles deletes several files of the user. The records are removed in one transaction,
+// failed storage deletions are retried later like in DeleteUserFiles.
+func (s *service) DeleteFiles(ctx context.Context, ids []uuid.UUID, userID uuid.UUID) ([]models.BulkDeleteResult, error) {
+	files, err := s.repo.DeleteUserFilesByIDs(ctx, userID, ids)
+	if err != nil {
+		return nil, fmt.Errorf("deleting file records: %w", err)
+	}
+
+	deleted := make(map[uuid.UUID]bool, len(files))
+	for _, file := range files {
+		deleted[file.ID] = true
+		s.deleteObject(ctx, file.UniqueFilename)
+	}
+
+	results := make([]models.BulkDeleteResult, 0, len(ids))
+	for _, id := range ids {
+		result := models.BulkDeleteResult{ID: id, Success: deleted[id]}
+		if !result.Success {
+			result.Error = "file not found"
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// DeleteUserFiles removes all files of a user from the database and storage.
+// Failed storage deletions are retried by the cleanup worker.
+func (s *service) DeleteUserFiles(ctx context.Context, userID uuid.UUID) error {
+	files, err := s.repo.GetAllUserFiles(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("getting user files: %w", err)
 	}
 
+	for _, file := range files {
+		if err := s.repo.Delete(ctx, file.ID); err != nil {
+			return fmt.Errorf("deleting file record: %w", err)
+		}
+		s.deleteObject(ctx, file.UniqueFilename)
+	}
+	if err := s.deleteAvatar(ctx, userID); err != nil {
+		return fmt.Errorf("deleting avatar: %w", err)
+	}
+
+	log.Info().
+		Str("user_id", userID.String()).
+		Int("file_count", len(files)).
+		Msg("deleted all user files")
+
 	return nil
 }
 
@@ -306,36 +883,31 @@ func (s *service) CleanupExpiredFiles(ctx context.Context) error {
 	}
 
 	for _, file := range files {
-		if err := s.storage.Delete(ctx, file.UniqueFilename); err != nil {
-			log.Error().
-				Err(err).
-				Str("filename", file.UniqueFilename).
-				Msg("failed to delete expired file from storage")
-			continue
-		}
-
 		if err := s.repo.Delete(ctx, file.ID); err != nil {
 			log.Error().
 				Err(err).
 				Str("filename", file.UniqueFilename).
 				Str("file_id", file.ID.String()).
 				Msg("failed to delete expired file record")
+			continue
 		}
+		s.deleteObject(ctx, file.UniqueFilename)
 	}
 
 	return nil
 }
 
-// SyncStorageWithDatabase ensures storage and database are in sync
-func (s *service) SyncStorageWithDatabase(ctx context.Context) error {
+// storageDiff compares storage with the database, returning the objects without a database record
+// and the records whose object is missing in storage
+func (s *service) storageDiff(ctx context.Context) ([]storage.FileInfo, []*models.UploadedFile, error) {
 	storageFiles, err := s.storage.ListFiles(ctx, "")
 	if err != nil {
-		return fmt.Errorf("listing storage files: %w", err)
+		return nil, nil, fmt.Errorf("listing storage files: %w", err)
 	}
 
 	dbFiles, err := s.repo.GetAllFiles(ctx)
 	if err != nil {
-		return fmt.Errorf("getting database files: %w", err)
+		return nil, nil, fmt.Errorf("getting database files: %w", err)
 	}
 
 	storageMap := make(map[string]storage.FileInfo)
@@ -348,38 +920,229 @@ func (s *service) SyncStorageWithDatabase(ctx context.Context) error {
 		dbMap[file.UniqueFilename] = file
 	}
 
-	// Find and handle orphaned storage files
-	for name := range storageMap {
-		if _, exists := dbMap[name]; !exists {
-			log.Info().
-				Str("filename", name).
-				Msg("deleting orphaned storage file")
-			if err := s.storage.Delete(ctx, name); err != nil {
-				log.Error().
-					Err(err).
-					Str("filename", name).
-					Msg("failed to delete orphaned file")
-			}
+	// Profile pictures are referenced by their user instead of a file record
+	avatarKeys, err := s.repo.GetAvatarKeys(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting avatars: %w", err)
+	}
+	avatars := make(map[string]bool, len(avatarKeys))
+	for _, key := range avatarKeys {
+		avatars[key] = true
+	}
+
+	var orphanedObjects []storage.FileInfo
+	for name, file := range storageMap {
+		if _, exists := dbMap[name]; !exists && !avatars[name] {
+			orphanedObjects = append(orphanedObjects, file)
 		}
 	}
 
+	var missingObjects []*models.UploadedFile
 	for name, file := range dbMap {
 		if _, exists := storageMap[name]; !exists {
+			missingObjects = append(missingObjects, file)
+		}
+	}
+
+	return orphanedObjects, missingObjects, nil
+}
+
+// SyncStorageWithDatabase deletes storage objects without a database record and records whose
+// object is missing. With dryRun set every candidate is only logged and returned.
+func (s *service) SyncStorageWithDatabase(ctx context.Context, dryRun bool) (*models.StorageSyncResult, error) {
+	orphanedObjects, missingObjects, err := s.storageDiff(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.StorageSyncResult{
+		DryRun:          dryRun,
+		OrphanedObjects: make([]models.StorageObject, 0, len(orphanedObjects)),
+		MissingObjects:  missingObjects,
+	}
+
+	// Find and handle orphaned storage files
+	for _, object := range orphanedObjects {
+		result.OrphanedObjects = append(result.OrphanedObjects, models.StorageObject{
+			Name:         object.Name,
+			Size:         object.Size,
+			ModifiedTime: object.ModifiedTime,
+		})
+		if dryRun {
 			log.Info().
-				Str("filename", name).
+				Str("filename", object.Name).
+				Int64("size", object.Size).
+				Msg("dry run: would delete orphaned storage file")
+			continue
+		}
+
+		log.Info().
+			Str("filename", object.Name).
+			Msg("deleting orphaned storage file")
+		if err := s.storage.Delete(ctx, object.Name); err != nil {
+			result.Failed++
+			log.Error().
+				Err(err).
+				Str("filename", object.Name).
+				Msg("failed to delete orphaned file")
+		}
+	}
+
+	for _, file := range missingObjects {
+		if dryRun {
+			log.Info().
+				Str("filename", file.UniqueFilename).
 				Str("file_id", file.ID.String()).
-				Msg("deleting orphaned database record")
-			if err := s.repo.Delete(ctx, file.ID); err != nil {
-				log.Error().
-					Err(err).
-					Str("filename", name).
-					Str("file_id", file.ID.String()).
-					Msg("failed to delete orphaned record")
-			}
+				Msg("dry run: would delete orphaned database record")
+			continue
+		}
+
+		log.Info().
+			Str("filename", file.UniqueFilename).
+			Str("file_id", file.ID.String()).
+			Msg("deleting orphaned database record")
+		if err := s.repo.Delete(ctx, file.ID); err != nil {
+			result.Failed++
+			log.Error().
+				Err(err).
+				Str("filename", file.UniqueFilename).
+				Str("file_id", file.ID.String()).
+				Msg("failed to delete orphaned record")
 		}
 	}
 
-	return nil
+	return result, nil
+}
+
+// VerifyStorage compares the database with storage like SyncStorageWithDatabase, but instead of
+// deleting the records without an object it flags them as missing so they are served as a 404.
+// Files whose object is back, e.g. after restoring a backup, are cleared again.
+func (s *service) VerifyStorage(ctx context.Context) (*models.StorageVerifyResult, error) {
+	_, candidates, err := s.storageDiff(ctx)
+	if err != nil {
+		return nil, err
+	}
+	flagged, err := s.repo.GetStorageMissingFiles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting files missing in storage: %w", err)
+	}
+
+	result := &models.StorageVerifyResult{
+		Missing: make([]*models.UploadedFile, 0, len(candidates)),
+	}
+	missing := make(map[uuid.UUID]bool, len(candidates))
+	unchecked := make(map[uuid.UUID]bool)
+	for _, file := range candidates {
+		// Uploads and deletions may have happened since the listing, each candidate is checked again
+		exists, err := s.storage.Exists(ctx, file.UniqueFilename)
+		if err != nil {
+			result.Failed++
+			unchecked[file.ID] = true
+			log.Error().
+				Err(err).
+				Str("filename", file.UniqueFilename).
+				Str("file_id", file.ID.String()).
+				Msg("failed to check file in storage")
+			continue
+		}
+		if exists {
+			continue
+		}
+
+		missing[file.ID] = true
+		result.Missing = append(result.Missing, file)
+		if file.StorageMissing {
+			continue
+		}
+		log.Warn().
+			Str("filename", file.UniqueFilename).
+			Str("file_id", file.ID.String()).
+			Msg("file is missing in storage")
+		if err := s.repo.SetStorageMissing(ctx, file.ID, true); err != nil {
+			result.Failed++
+			log.Error().
+				Err(err).
+				Str("file_id", file.ID.String()).
+				Msg("failed to flag file as missing")
+			continue
+		}
+		file.StorageMissing = true
+		result.Flagged++
+	}
+
+	for _, file := range flagged {
+		if missing[file.ID] || unchecked[file.ID] {
+			continue
+		}
+		log.Info().
+			Str("filename", file.UniqueFilename).
+			Str("file_id", file.ID.String()).
+			Msg("file is back in storage")
+		if err := s.repo.SetStorageMissing(ctx, file.ID, false); err != nil {
+			result.Failed++
+			log.Error().
+				Err(err).
+				Str("file_id", file.ID.String()).
+				Msg("failed to clear missing flag of file")
+			continue
+		}
+		result.Restored++
+	}
+
+	sort.Slice(result.Missing, func(i, j int) bool {
+		return result.Missing[i].UniqueFilename < result.Missing[j].UniqueFilename
+	})
+	return result, nil
+}
+
+// StorageReport summarizes the storage used per user, the drift between storage and database and
+// the files expiring within the given duration. Unlike SyncStorageWithDatabase nothing is deleted.
+func (s *service) StorageReport(ctx context.Context, expiringWithin time.Duration) (*models.StorageReport, error) {
+	orphanedObjects, missingObjects, err := s.storageDiff(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	usage, err := s.repo.GetStorageUsageByUser(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting storage usage: %w", err)
+	}
+
+	now := time.Now()
+	expiring, err := s.repo.GetFilesExpiringBefore(ctx, now.Add(expiringWithin))
+	if err != nil {
+		return nil, fmt.Errorf("getting expiring files: %w", err)
+	}
+
+	report := &models.StorageReport{
+		GeneratedAt:     now,
+		Users:           usage,
+		OrphanedObjects: make([]models.StorageObject, 0, len(orphanedObjects)),
+		MissingObjects:  missingObjects,
+		ExpiringSoon:    expiring,
+	}
+	for _, u := range usage {
+		report.TotalFiles += u.FileCount
+		report.TotalSize += u.TotalSize
+	}
+	for _, object := range orphanedObjects {
+		report.OrphanedObjects = append(report.OrphanedObjects, models.StorageObject{
+			Name:         object.Name,
+			Size:         object.Size,
+			ModifiedTime: object.ModifiedTime,
+		})
+		report.OrphanedSize += object.Size
+	}
+
+	// Map iteration order is random, keep the report stable
+	sort.Slice(report.OrphanedObjects, func(i, j int) bool {
+		return report.OrphanedObjects[i].Name < report.OrphanedObjects[j].Name
+	})
+	sort.Slice(report.MissingObjects, func(i, j int) bool {
+		return report.MissingObjects[i].UniqueFilename < report.MissingObjects[j].UniqueFilename
+	})
+
+	return report, nil
 }
 
 // GetFileStats retrieves statistics about uploaded files
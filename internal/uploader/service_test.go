@@ -0,0 +1,546 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"mime/multipart"
+	"slices"
+	"testing"
+	"time"
+	"volaticus-go/internal/common/models"
+	"volaticus-go/internal/config"
+	"volaticus-go/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// syncStorage holds a fixed set of objects and records deletions
+type syncStorage struct {
+	storage.StorageProvider
+	files   []storage.FileInfo
+	deleted []string
+}
+
+func (s *syncStorage) ListFiles(context.Context, string) ([]storage.FileInfo, error) {
+	return s.files, nil
+}
+
+func (s *syncStorage) Exists(_ context.Context, name string) (bool, error) {
+	for _, file := range s.files {
+		if file.Name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *syncStorage) Delete(_ context.Context, name string) error {
+	s.deleted = append(s.deleted, name)
+	return nil
+}
+
+// syncRepository holds a fixed set of records and records deletions
+type syncRepository struct {
+	Repository
+	files   []*models.UploadedFile
+	avatars []string
+	deleted []uuid.UUID
+}
+
+func (r *syncRepository) GetAllFiles(context.Context) ([]*models.UploadedFile, error) {
+	return r.files, nil
+}
+
+func (r *syncRepository) GetAvatarKeys(context.Context) ([]string, error) {
+	return r.avatars, nil
+}
+
+func (r *syncRepository) Delete(_ context.Context, id uuid.UUID) error {
+	r.deleted = append(r.deleted, id)
+	return nil
+}
+
+func (r *syncRepository) GetStorageMissingFiles(context.Context) ([]*models.UploadedFile, error) {
+	var flagged []*models.UploadedFile
+	for _, file := range r.files {
+		if file.StorageMissing {
+			flagged = append(flagged, file)
+		}
+	}
+	return flagged, nil
+}
+
+func (r *syncRepository) SetStorageMissing(_ context.Context, id uuid.UUID, missing bool) error {
+	for _, file := range r.files {
+		if file.ID == id {
+			file.StorageMissing = missing
+			return nil
+		}
+	}
+	return ErrNoRows
+}
+
+func newSyncFixture() (*service, *syncStorage, *syncRepository) {
+	store := &syncStorage{files: []storage.FileInfo{
+		{Name: "kept.png", Size: 10},
+		{Name: "orphan.png", Size: 20},
+		{Name: "avatar-1.png", Size: 5}, // Referenced by a user instead of a file record
+	}}
+	repo := &syncRepository{
+		files: []*models.UploadedFile{
+			{ID: uuid.New(), UniqueFilename: "kept.png"},
+			{ID: uuid.New(), UniqueFilename: "missing.png"},
+		},
+		avatars: []string{"avatar-1.png"},
+	}
+	return &service{repo: repo, storage: store}, store, repo
+}
+
+func TestSyncStorageWithDatabaseDryRun(t *testing.T) {
+	s, store, repo := newSyncFixture()
+
+	result, err := s.SyncStorageWithDatabase(context.Background(), true)
+	if err != nil {
+		t.Fatalf("SyncStorageWithDatabase() error = %v", err)
+	}
+	if !result.DryRun {
+		t.Error("result is not marked as dry run")
+	}
+	if len(result.OrphanedObjects) != 1 || result.OrphanedObjects[0].Name != "orphan.png" {
+		t.Errorf("orphaned objects = %+v, want orphan.png", result.OrphanedObjects)
+	}
+	if len(result.MissingObjects) != 1 || result.MissingObjects[0].UniqueFilename != "missing.png" {
+		t.Errorf("missing objects = %+v, want missing.png", result.MissingObjects)
+	}
+	if len(store.deleted) != 0 || len(repo.deleted) != 0 {
+		t.Errorf("dry run deleted objects %v and records %v", store.deleted, repo.deleted)
+	}
+}
+
+func TestSyncStorageWithDatabaseConfirmed(t *testing.T) {
+	s, store, repo := newSyncFixture()
+
+	result, err := s.SyncStorageWithDatabase(context.Background(), false)
+	if err != nil {
+		t.Fatalf("SyncStorageWithDatabase() error = %v", err)
+	}
+	if len(store.deleted) != 1 || store.deleted[0] != "orphan.png" {
+		t.Errorf("deleted objects = %v, want orphan.png", store.deleted)
+	}
+	if len(repo.deleted) != 1 || repo.deleted[0] != result.MissingObjects[0].ID {
+		t.Errorf("deleted records = %v, want the missing record", repo.deleted)
+	}
+}
+
+func TestVerifyStorage(t *testing.T) {
+	s, store, repo := newSyncFixture()
+	// Flagged by an earlier verification, the object was restored since
+	restored := &models.UploadedFile{ID: uuid.New(), UniqueFilename: "restored.png", StorageMissing: true}
+	repo.files = append(repo.files, restored)
+	store.files = append(store.files, storage.FileInfo{Name: "restored.png"})
+
+	result, err := s.VerifyStorage(context.Background())
+	if err != nil {
+		t.Fatalf("VerifyStorage() error = %v", err)
+	}
+	if len(result.Missing) != 1 || result.Missing[0].UniqueFilename != "missing.png" || !repo.files[1].StorageMissing {
+		t.Errorf("missing = %+v, want missing.png flagged", result.Missing)
+	}
+	if result.Flagged != 1 || result.Restored != 1 || restored.StorageMissing {
+		t.Errorf("flagged %d and restored %d, want 1 each", result.Flagged, result.Restored)
+	}
+	if len(store.deleted) != 0 || len(repo.deleted) != 0 {
+		t.Errorf("verification deleted objects %v and records %v", store.deleted, repo.deleted)
+	}
+
+	// Nothing changes when verifying again
+	result, err = s.VerifyStorage(context.Background())
+	if err != nil || result.Flagged != 0 || result.Restored != 0 || len(result.Missing) != 1 {
+		t.Errorf("second VerifyStorage() = %+v, %v, want the same file missing without changes", result, err)
+	}
+}
+
+func TestGetFileStorageMissing(t *testing.T) {
+	repo := &servedFileRepository{file: &models.UploadedFile{URLValue: "lost", StorageMissing: true}}
+	s := &service{repo: repo}
+	if _, err := s.GetFile(context.Background(), "lost"); !errors.Is(err, ErrNoRows) {
+		t.Errorf("GetFile() error = %v, want a not found error", err)
+	}
+}
+
+// deletionStorage fails deleting the objects in failing, the objects in present exist
+type deletionStorage struct {
+	storage.StorageProvider
+	failing map[string]bool
+	present map[string]bool
+	deleted []string
+}
+
+func (s *deletionStorage) Delete(_ context.Context, name string) error {
+	if s.failing[name] {
+		return errors.New("storage unavailable")
+	}
+	s.deleted = append(s.deleted, name)
+	return nil
+}
+
+func (s *deletionStorage) Exists(_ context.Context, name string) (bool, error) {
+	return s.present[name], nil
+}
+
+// deletionRepository holds file records and the queue of failed storage deletions
+type deletionRepository struct {
+	Repository
+	files     map[uuid.UUID]*models.UploadedFile
+	deleteErr error
+	pending   map[string]*models.PendingDeletion
+}
+
+func newDeletionRepository(files ...*models.UploadedFile) *deletionRepository {
+	r := &deletionRepository{
+		files:   make(map[uuid.UUID]*models.UploadedFile),
+		pending: make(map[string]*models.PendingDeletion),
+	}
+	for _, file := range files {
+		r.files[file.ID] = file
+	}
+	return r
+}
+
+func (r *deletionRepository) GetByID(_ context.Context, id uuid.UUID) (*models.UploadedFile, error) {
+	if file, ok := r.files[id]; ok {
+		return file, nil
+	}
+	return nil, ErrNoRows
+}
+
+func (r *deletionRepository) GetByUniqueFilename(_ context.Context, name string) (*models.UploadedFile, error) {
+	for _, file := range r.files {
+		if file.UniqueFilename == name {
+			return file, nil
+		}
+	}
+	return nil, ErrNoRows
+}
+
+func (r *deletionRepository) Delete(_ context.Context, id uuid.UUID) error {
+	if r.deleteErr != nil {
+		return r.deleteErr
+	}
+	delete(r.files, id)
+	return nil
+}
+
+func (r *deletionRepository) QueueDeletion(_ context.Context, filename, lastError string, nextAttempt time.Time) error {
+	if p, ok := r.pending[filename]; ok {
+		p.Attempts++
+		p.LastError, p.NextAttemptAt = lastError, nextAttempt
+		return nil
+	}
+	r.pending[filename] = &models.PendingDeletion{Filename: filename, Attempts: 1, LastError: lastError, NextAttemptAt: nextAttempt}
+	return nil
+}
+
+func (r *deletionRepository) GetDueDeletions(_ context.Context, now time.Time, _ int) ([]*models.PendingDeletion, error) {
+	var due []*models.PendingDeletion
+	for _, p := range r.pending {
+		if !p.NextAttemptAt.After(now) {
+			due = append(due, p)
+		}
+	}
+	return due, nil
+}
+
+func (r *deletionRepository) RemovePendingDeletion(_ context.Context, filename string) error {
+	delete(r.pending, filename)
+	return nil
+}
+
+func TestDeleteFileStorageFailure(t *testing.T) {
+	userID := uuid.New()
+	file := &models.UploadedFile{ID: uuid.New(), UserID: userID, UniqueFilename: "a.png"}
+	repo := newDeletionRepository(file)
+	store := &deletionStorage{failing: map[string]bool{"a.png": true}}
+	s := &service{repo: repo, storage: store}
+
+	if err := s.DeleteFileByID(context.Background(), file.ID, userID); err != nil {
+		t.Fatalf("DeleteFileByID() error = %v, want the deletion to succeed for the user", err)
+	}
+	if _, ok := repo.files[file.ID]; ok {
+		t.Error("file record was not deleted")
+	}
+	pending, ok := repo.pending["a.png"]
+	if !ok || pending.Attempts != 1 || pending.LastError != "storage unavailable" {
+		t.Errorf("pending deletion = %+v, want the failed storage deletion queued", pending)
+	}
+}
+
+func TestDeleteFileDatabaseFailure(t *testing.T) {
+	userID := uuid.New()
+	file := &models.UploadedFile{ID: uuid.New(), UserID: userID, UniqueFilename: "a.png"}
+	repo := newDeletionRepository(file)
+	repo.deleteErr = errors.New("connection reset")
+	store := &deletionStorage{}
+	s := &service{repo: repo, storage: store}
+
+	if err := s.DeleteFileByID(context.Background(), file.ID, userID); err == nil {
+		t.Fatal("DeleteFileByID() succeeded although the record wasn't deleted")
+	}
+	if len(store.deleted) != 0 {
+		t.Errorf("deleted objects %v of a file that still has its record", store.deleted)
+	}
+}
+
+func TestRetryPendingDeletions(t *testing.T) {
+	reused := &models.UploadedFile{ID: uuid.New(), UniqueFilename: "reused.png"}
+	repo := newDeletionRepository(reused)
+	store := &deletionStorage{
+		failing: map[string]bool{"stuck.png": true, "gone.png": true},
+		present: map[string]bool{"stuck.png": true, "reused.png": true},
+	}
+	s := &service{repo: repo, storage: store}
+
+	due := time.Now().Add(-time.Second)
+	for _, name := range []string{"retried.png", "stuck.png", "gone.png", "reused.png"} {
+		repo.pending[name] = &models.PendingDeletion{Filename: name, Attempts: 1, NextAttemptAt: due}
+	}
+	repo.pending["later.png"] = &models.PendingDeletion{Filename: "later.png", Attempts: 3, NextAttemptAt: time.Now().Add(time.Hour)}
+
+	if err := s.RetryPendingDeletions(context.Background()); err != nil {
+		t.Fatalf("RetryPendingDeletions() error = %v", err)
+	}
+
+	if len(store.deleted) != 1 || store.deleted[0] != "retried.png" {
+		t.Errorf("deleted objects = %v, want retried.png", store.deleted)
+	}
+	stuck, ok := repo.pending["stuck.png"]
+	if !ok || stuck.Attempts != 2 || !stuck.NextAttemptAt.After(time.Now()) {
+		t.Errorf("stuck.png = %+v, want a rescheduled second attempt", stuck)
+	}
+	// Objects that are already gone and names taken by a new upload are done
+	for _, name := range []string{"retried.png", "gone.png", "reused.png"} {
+		if _, ok := repo.pending[name]; ok {
+			t.Errorf("%s is still pending", name)
+		}
+	}
+	if _, ok := repo.pending["later.png"]; !ok {
+		t.Error("deletion that isn't due yet was dropped")
+	}
+}
+
+func TestDeletionRetryDelay(t *testing.T) {
+	tests := map[int]time.Duration{
+		1:   time.Minute,
+		2:   2 * time.Minute,
+		5:   16 * time.Minute,
+		10:  maxDeletionRetryDelay,
+		100: maxDeletionRetryDelay,
+	}
+	for attempts, want := range tests {
+		if got := deletionRetryDelay(attempts); got != want {
+			t.Errorf("deletionRetryDelay(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+// countRepository reports a fixed number of files for every user
+type countRepository struct {
+	Repository
+	count int
+}
+
+func (r countRepository) GetUserFilesCount(context.Context, uuid.UUID) (int, error) {
+	return r.count, nil
+}
+
+func TestCheckFileLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   int
+		current int
+		upload  int
+		wantErr bool
+	}{
+		{name: "unlimited", limit: 0, current: 1000, upload: 5},
+		{name: "below limit", limit: 10, current: 8, upload: 2},
+		{name: "batch over limit", limit: 10, current: 8, upload: 3, wantErr: true},
+		{name: "limit reached", limit: 10, current: 10, upload: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &service{
+				repo:   countRepository{count: tt.current},
+				config: &config.Config{MaxUserFiles: tt.limit},
+			}
+			err := s.checkFileLimit(context.Background(), uuid.New(), tt.upload)
+			if tt.wantErr != errors.Is(err, ErrFileLimitReached) {
+				t.Errorf("checkFileLimit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// expirationRepository holds one file and records the expiration stored for it
+type expirationRepository struct {
+	Repository
+	file   *models.UploadedFile
+	stored *time.Time
+}
+
+func (r *expirationRepository) GetByID(context.Context, uuid.UUID) (*models.UploadedFile, error) {
+	return r.file, nil
+}
+
+func (r *expirationRepository) UpdateExpiration(_ context.Context, _ uuid.UUID, expiresAt *time.Time) error {
+	r.stored = expiresAt
+	return nil
+}
+
+func TestUpdateFileExpiration(t *testing.T) {
+	userID := uuid.New()
+	maxExpiry := 7 * 24 * time.Hour
+
+	tests := []struct {
+		name      string
+		expiresAt *time.Time
+		max       time.Duration
+		wantErr   error
+		wantMax   bool // Stored expiration is the maximum from now
+	}{
+		{name: "past", expiresAt: ptr(time.Now().Add(-time.Minute)), wantErr: ErrInvalidExpiration},
+		{name: "future", expiresAt: ptr(time.Now().Add(time.Hour)), max: maxExpiry},
+		{name: "offset", expiresAt: ptr(time.Now().Add(time.Hour).In(time.FixedZone("UTC-5", -5*60*60)))},
+		{name: "never", expiresAt: nil},
+		{name: "far future clamped", expiresAt: ptr(time.Now().AddDate(10, 0, 0)), max: maxExpiry, wantMax: true},
+		{name: "never clamped", expiresAt: nil, max: maxExpiry, wantMax: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &expirationRepository{file: &models.UploadedFile{ID: uuid.New(), UserID: userID}}
+			s := &service{repo: repo, config: &config.Config{UploadMaxExpiry: tt.max}}
+
+			err := s.UpdateFileExpiration(context.Background(), repo.file.ID, userID, tt.expiresAt)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateFileExpiration() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if repo.stored != nil && repo.stored.Location() != time.UTC {
+				t.Errorf("stored expiration = %v, want UTC", repo.stored)
+			}
+			switch {
+			case tt.wantMax:
+				if repo.stored == nil || time.Until(*repo.stored) > maxExpiry || time.Until(*repo.stored) < maxExpiry-time.Minute {
+					t.Errorf("stored expiration = %v, want %s from now", repo.stored, maxExpiry)
+				}
+			case tt.expiresAt == nil:
+				if repo.stored != nil {
+					t.Errorf("stored expiration = %v, want none", repo.stored)
+				}
+			case repo.stored == nil || !repo.stored.Equal(*tt.expiresAt):
+				t.Errorf("stored expiration = %v, want %v", repo.stored, tt.expiresAt)
+			}
+		})
+	}
+}
+
+// visibilityRepository holds one file and fails storing its visibility if err is set
+type visibilityRepository struct {
+	Repository
+	file *models.UploadedFile
+	err  error
+}
+
+func (r *visibilityRepository) GetByID(context.Context, uuid.UUID) (*models.UploadedFile, error) {
+	return r.file, nil
+}
+
+func (r *visibilityRepository) UpdateVisibility(context.Context, uuid.UUID, string) error {
+	return r.err
+}
+
+// aclStorage records the access changes of objects
+type aclStorage struct {
+	storage.StorageProvider
+	public []bool
+}
+
+func (s *aclStorage) SetPublic(_ context.Context, _ string, public bool) error {
+	s.public = append(s.public, public)
+	return nil
+}
+
+func TestUpdateFileVisibilityACL(t *testing.T) {
+	userID := uuid.New()
+	errDB := errors.New("db down")
+
+	tests := []struct {
+		name       string
+		file       models.UploadedFile
+		visibility string
+		repoErr    error
+		want       []bool
+	}{
+		{
+			name:       "made private",
+			file:       models.UploadedFile{Visibility: models.FileVisibilityPublic},
+			visibility: models.FileVisibilityPrivate,
+			want:       []bool{false},
+		},
+		{
+			name:       "made public",
+			file:       models.UploadedFile{Visibility: models.FileVisibilityPrivate},
+			visibility: models.FileVisibilityPublic,
+			want:       []bool{true},
+		},
+		{
+			name:       "expiring stays private",
+			file:       models.UploadedFile{Visibility: models.FileVisibilityPrivate, ExpiresAt: ptr(time.Now().Add(time.Hour))},
+			visibility: models.FileVisibilityPublic,
+		},
+		{
+			name:       "unchanged",
+			file:       models.UploadedFile{Visibility: models.FileVisibilityPublic},
+			visibility: models.FileVisibilityPublic,
+		},
+		{
+			name:       "restored on database failure",
+			file:       models.UploadedFile{Visibility: models.FileVisibilityPublic},
+			visibility: models.FileVisibilityPrivate,
+			repoErr:    errDB,
+			want:       []bool{false, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := tt.file
+			file.ID, file.UserID = uuid.New(), userID
+			store := &aclStorage{}
+			s := &service{
+				repo:    &visibilityRepository{file: &file, err: tt.repoErr},
+				storage: store,
+				config:  &config.Config{Storage: config.StorageConfig{PublicObjects: true}},
+			}
+
+			err := s.UpdateFileVisibility(context.Background(), file.ID, userID, tt.visibility)
+			if !errors.Is(err, tt.repoErr) {
+				t.Fatalf("UpdateFileVisibility() error = %v, want %v", err, tt.repoErr)
+			}
+			if !slices.Equal(store.public, tt.want) {
+				t.Errorf("SetPublic() calls = %v, want %v", store.public, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadFilesTooMany(t *testing.T) {
+	s := &service{config: &config.Config{UploadMaxFiles: 2}}
+	headers := make([]*multipart.FileHeader, 3)
+
+	_, err := s.UploadFiles(context.Background(), uuid.New(), headers, URLTypeDefault, nil, false)
+	if !errors.Is(err, ErrTooManyFiles) {
+		t.Errorf("UploadFiles() error = %v, want %v", err, ErrTooManyFiles)
+	}
+}
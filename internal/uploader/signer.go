@@ -0,0 +1,93 @@
+package uploader
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrSignatureExpired = errors.New("signature has expired")
+)
+
+// URLSigner creates and verifies time-limited download tokens for files.
+// A token is the base64 encoded "urlValue:expiry" payload followed by its HMAC.
+type URLSigner struct {
+	secret []byte
+}
+
+// NewURLSigner creates a signer using the server secret
+func NewURLSigner(secret string) *URLSigner {
+	return &URLSigner{secret: []byte(secret)}
+}
+
+// Sign returns a token granting access to the file until expiresAt
+func (s *URLSigner) Sign(urlValue string, expiresAt time.Time) string {
+	payload := fmt.Sprintf("%s:%d", urlValue, expiresAt.Unix())
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(s.mac(payload))
+}
+
+// Verify validates a token and returns the URL value of the file it grants access to
+func (s *URLSigner) Verify(token string) (string, error) {
+	encodedPayload, encodedMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalidSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+	if !hmac.Equal(mac, s.mac(string(payload))) {
+		return "", ErrInvalidSignature
+	}
+
+	// The URL value may itself contain colons, the expiry is always the last field
+	sep := strings.LastIndexByte(string(payload), ':')
+	if sep <= 0 {
+		return "", ErrInvalidSignature
+	}
+	expiresAt, err := strconv.ParseInt(string(payload[sep+1:]), 10, 64)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+	if time.Now().Unix() > expiresAt {
+		return "", ErrSignatureExpired
+	}
+
+	return string(payload[:sep]), nil
+}
+
+// DeleteToken returns a token allowing the file to be deleted without a session.
+// The payload is prefixed so download tokens can never be used as delete tokens.
+func (s *URLSigner) DeleteToken(fileID uuid.UUID) string {
+	return base64.RawURLEncoding.EncodeToString(s.mac("delete:" + fileID.String()))
+}
+
+// VerifyDeleteToken reports whether the token was issued for deleting the file
+func (s *URLSigner) VerifyDeleteToken(fileID uuid.UUID, token string) bool {
+	mac, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(mac, s.mac("delete:"+fileID.String()))
+}
+
+func (s *URLSigner) mac(payload string) []byte {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
@@ -0,0 +1,61 @@
+package uploader
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestURLSignerRoundTrip(t *testing.T) {
+	s := NewURLSigner("secret")
+	token := s.Sign("my:file.png", time.Now().Add(time.Hour))
+
+	urlValue, err := s.Verify(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "my:file.png", urlValue)
+}
+
+func TestURLSignerExpired(t *testing.T) {
+	s := NewURLSigner("secret")
+	token := s.Sign("file.png", time.Now().Add(-time.Minute))
+
+	_, err := s.Verify(token)
+	assert.ErrorIs(t, err, ErrSignatureExpired)
+}
+
+func TestURLSignerTampered(t *testing.T) {
+	s := NewURLSigner("secret")
+	token := s.Sign("file.png", time.Now().Add(time.Hour))
+
+	// Signed with a different secret
+	_, err := NewURLSigner("other").Verify(token)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	// Payload swapped for another file
+	forged := NewURLSigner("other").Sign("other.png", time.Now().Add(time.Hour))
+	payload, _, _ := strings.Cut(forged, ".")
+	_, mac, _ := strings.Cut(token, ".")
+	_, err = s.Verify(payload + "." + mac)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	// Garbage input
+	for _, token := range []string{"", "nodot", "!!.!!"} {
+		_, err = s.Verify(token)
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+	}
+}
+
+func TestURLSignerDeleteToken(t *testing.T) {
+	s := NewURLSigner("secret")
+	fileID := uuid.New()
+	token := s.DeleteToken(fileID)
+
+	assert.True(t, s.VerifyDeleteToken(fileID, token))
+	assert.False(t, s.VerifyDeleteToken(uuid.New(), token))
+	assert.False(t, NewURLSigner("other").VerifyDeleteToken(fileID, token))
+	assert.False(t, s.VerifyDeleteToken(fileID, ""))
+	assert.False(t, s.VerifyDeleteToken(fileID, "!!"))
+}
@@ -0,0 +1,91 @@
+package uploader
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"volaticus-go/internal/common/apierror"
+	"volaticus-go/internal/context"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// uploadRetryAfter is when a client turned away for running too many uploads should try again.
+// Large uploads take longer, but a short wait lets small ones through soon after a slot frees up.
+const uploadRetryAfter = 5 * time.Second
+
+// UploadSlots limits how many uploads each user can send at the same time, so one user with
+// parallel large transfers can't take up all bandwidth and disk of the server
+type UploadSlots struct {
+	mu     sync.Mutex
+	limit  int
+	active map[uuid.UUID]int
+}
+
+// NewUploadSlots returns slots allowing limit uploads per user at once, 0 is unlimited
+func NewUploadSlots(limit int) *UploadSlots {
+	return &UploadSlots{
+		limit:  limit,
+		active: make(map[uuid.UUID]int),
+	}
+}
+
+// Acquire takes a slot of the user, false if all of them are in use. Every acquired slot must
+// be given back with Release.
+func (s *UploadSlots) Acquire(userID uuid.UUID) bool {
+	if s.limit <= 0 {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active[userID] >= s.limit {
+		return false
+	}
+	s.active[userID]++
+	return true
+}
+
+// Release gives back a slot taken by Acquire
+func (s *UploadSlots) Release(userID uuid.UUID) {
+	if s.limit <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Users without uploads are removed, so the map only holds the ones sending right now
+	if s.active[userID] <= 1 {
+		delete(s.active, userID)
+		return
+	}
+	s.active[userID]--
+}
+
+// LimitConcurrentUploads answers uploads with 429 while the user already sends as many as
+// MAX_CONCURRENT_UPLOADS allows. It runs before the body is read, so rejected uploads aren't
+// transferred.
+func (h *Handler) LimitConcurrentUploads(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := context.GetUserFromContext(r.Context())
+		if user == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !h.uploads.Acquire(user.ID) {
+			log.Warn().
+				Str("user_id", user.ID.String()).
+				Int("limit", h.uploads.limit).
+				Msg("concurrent upload limit reached")
+			w.Header().Set("Retry-After", strconv.Itoa(int(uploadRetryAfter.Seconds())))
+			apierror.Error(w, r, "Too many uploads at once, wait for the others to finish", http.StatusTooManyRequests)
+			return
+		}
+		defer h.uploads.Release(user.ID)
+
+		next.ServeHTTP(w, r)
+	})
+}
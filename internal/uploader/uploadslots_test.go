@@ -0,0 +1,85 @@
+package uploader
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"volaticus-go/internal/config"
+	userctx "volaticus-go/internal/context"
+
+	"github.com/google/uuid"
+)
+
+func TestUploadSlots(t *testing.T) {
+	slots := NewUploadSlots(2)
+	alice, bob := uuid.New(), uuid.New()
+
+	if !slots.Acquire(alice) || !slots.Acquire(alice) {
+		t.Fatal("Acquire() below the limit = false")
+	}
+	if slots.Acquire(alice) {
+		t.Error("Acquire() over the limit = true")
+	}
+	if !slots.Acquire(bob) {
+		t.Error("Acquire() of another user = false, slots are per user")
+	}
+
+	slots.Release(alice)
+	if !slots.Acquire(alice) {
+		t.Error("Acquire() after Release() = false")
+	}
+
+	slots.Release(alice)
+	slots.Release(alice)
+	slots.Release(bob)
+	if len(slots.active) != 0 {
+		t.Errorf("active = %v, want users without uploads removed", slots.active)
+	}
+
+	unlimited := NewUploadSlots(0)
+	for range 100 {
+		if !unlimited.Acquire(alice) {
+			t.Fatal("Acquire() without a limit = false")
+		}
+	}
+}
+
+func TestLimitConcurrentUploads(t *testing.T) {
+	h := NewHandler(&service{config: &config.Config{UploadsPerUser: 1}}, nil)
+	user := &userctx.UserInfo{ID: uuid.New(), Username: "alice"}
+
+	// The first upload is still running while the second arrives
+	started, finish := make(chan struct{}), make(chan struct{})
+	handler := h.LimitConcurrentUploads(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-finish
+		w.WriteHeader(http.StatusCreated)
+	}))
+	upload := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/upload", nil)
+		r = r.WithContext(userctx.WithUser(r.Context(), user))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- upload() }()
+	<-started
+
+	w := upload()
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("concurrent upload status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if w.Header().Get("Retry-After") != "5" {
+		t.Errorf("Retry-After = %q, want 5", w.Header().Get("Retry-After"))
+	}
+
+	close(finish)
+	if w := <-first; w.Code != http.StatusCreated {
+		t.Errorf("first upload status = %d, want %d", w.Code, http.StatusCreated)
+	}
+	if !h.uploads.Acquire(user.ID) {
+		t.Error("slot not released after the upload finished")
+	}
+}
@@ -8,8 +8,11 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+	"unicode"
+	"volaticus-go/internal/common/reserved"
 
 	"github.com/google/uuid"
+	"golang.org/x/text/unicode/norm"
 )
 
 var (
@@ -183,11 +186,27 @@ func (ut *URLType) Scan(value interface{}) error {
 	return nil
 }
 
-// GenerateURL generates a URL based on the specified type
+// maxReservedRetries bounds how often a generated URL matching a reserved word is regenerated
+const maxReservedRetries = 10
+
+// GenerateURL generates a URL based on the specified type. Generated values never match a reserved
+// word, URLs derived from the original filename are kept as chosen by the user.
 func (g *URLGenerator) GenerateURL(urlType URLType, originalName string) (string, error) {
-	switch urlType {
-	case URLTypeOriginalName:
+	if urlType == URLTypeOriginalName {
 		return g.generateOriginalNameURL(originalName)
+	}
+
+	for attempts := 0; attempts < maxReservedRetries; attempts++ {
+		url, err := g.generateURL(urlType)
+		if err != nil || !reserved.IsReserved(url) {
+			return url, err
+		}
+	}
+	return "", fmt.Errorf("could not generate an unreserved URL after %d attempts", maxReservedRetries)
+}
+
+func (g *URLGenerator) generateURL(urlType URLType) (string, error) {
+	switch urlType {
 	case URLTypeDefault:
 		return g.generateDefaultURL()
 	case URLTypeRandom:
@@ -203,20 +222,69 @@ func (g *URLGenerator) GenerateURL(urlType URLType, originalName string) (string
 	}
 }
 
+// Limits of URLs derived from the original filename, excluding the random suffix
+const (
+	maxSlugLength      = 64
+	maxExtensionLength = 16
+)
+
 // generateOriginalNameURL creates a URL using the original filename
 func (g *URLGenerator) generateOriginalNameURL(originalName string) (string, error) {
-	// Clean the filename and remove any potentially problematic characters
-	base := filepath.Base(originalName)
-	base = strings.ToLower(base)
-	base = strings.ReplaceAll(base, " ", "-")
+	// Only the last path element counts, clients may send Windows paths
+	base := filepath.Base(strings.ReplaceAll(originalName, `\`, "/"))
 
-	// Add a random suffix to prevent collisions
+	name := slugify(strings.TrimSuffix(base, fileExtension(base)))
+	if len(name) > maxSlugLength {
+		name = strings.TrimRight(name[:maxSlugLength], "-_.")
+	}
+	if name == "" {
+		name = "file"
+	}
+
+	// Add a random suffix to prevent collisions, in front of the extension so it is kept
 	suffix := make([]byte, 4)
 	if _, err := rand.Read(suffix); err != nil {
 		return "", err
 	}
-	nameWithSuffix := fmt.Sprintf("%s-%x", base, suffix)
-	return nameWithSuffix, nil
+	return fmt.Sprintf("%s-%x%s", name, suffix, urlExtension(base)), nil
+}
+
+// urlExtension returns the slugified extension of a filename for use in URLs,
+// or an empty string if nothing usable is left or it is unreasonably long
+func urlExtension(filename string) string {
+	ext := slugify(fileExtension(filepath.Base(filename)))
+	if ext == "" || len(ext) > maxExtensionLength {
+		return ""
+	}
+	return "." + ext
+}
+
+// slugify reduces s to lowercase [a-z0-9-_.]. Accents are stripped from letters, every other
+// character becomes a dash, runs of separators are collapsed and trimmed from both ends.
+func slugify(s string) string {
+	var b strings.Builder
+	lastSep := true // drops leading separators
+	for _, r := range norm.NFKD.String(s) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		r = unicode.ToLower(r)
+
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+			lastSep = false
+		case lastSep:
+			continue
+		case r == '.' || r == '_' || r == '-':
+			b.WriteRune(r)
+			lastSep = true
+		default:
+			b.WriteByte('-')
+			lastSep = true
+		}
+	}
+	return strings.TrimRight(b.String(), "-_.")
 }
 
 // generateDefaultURL creates a URL using a timestamp
@@ -22,6 +22,56 @@ func TestGenerateOriginalNameURL(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Contains(t, url, "test-file")
 	assert.Len(t, url, len("test-file.jpg-")+8)
+	assert.True(t, strings.HasSuffix(url, ".jpg"), "extension must stay at the end")
+}
+
+func TestGenerateOriginalNameURLCompoundExtension(t *testing.T) {
+	g := NewURLGenerator()
+	url, err := g.generateOriginalNameURL("Backup.tar.gz")
+	assert.NoError(t, err)
+	assert.Regexp(t, `^backup-[0-9a-f]{8}\.tar\.gz$`, url)
+
+	url, err = g.generateOriginalNameURL("Makefile")
+	assert.NoError(t, err)
+	assert.Regexp(t, `^makefile-[0-9a-f]{8}$`, url)
+}
+
+func TestGenerateOriginalNameURLSanitizes(t *testing.T) {
+	g := NewURLGenerator()
+	tests := []struct {
+		name     string
+		filename string
+		want     string
+	}{
+		{name: "path traversal", filename: "../../etc/passwd", want: `^passwd-[0-9a-f]{8}$`},
+		{name: "windows path", filename: `C:\Users\me\Report.PDF`, want: `^report-[0-9a-f]{8}\.pdf$`},
+		{name: "only dots", filename: "..", want: `^file-[0-9a-f]{8}$`},
+		{name: "emoji", filename: "🎉 party 🎉.png", want: `^party-[0-9a-f]{8}\.png$`},
+		{name: "only emoji", filename: "🎉🎉.gif", want: `^file-[0-9a-f]{8}\.gif$`},
+		{name: "accents", filename: "Crème Brûlée.jpg", want: `^creme-brulee-[0-9a-f]{8}\.jpg$`},
+		{name: "query characters", filename: "a?b=c&d#e%20f.txt", want: `^a-b-c-d-e-20f-[0-9a-f]{8}\.txt$`},
+		{name: "collapsed separators", filename: "my -- file__name.zip", want: `^my-file_name-[0-9a-f]{8}\.zip$`},
+		{name: "unsafe extension", filename: "image.??", want: `^image-[0-9a-f]{8}$`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url, err := g.generateOriginalNameURL(tt.filename)
+			assert.NoError(t, err)
+			assert.Regexp(t, tt.want, url)
+		})
+	}
+}
+
+func TestGenerateOriginalNameURLLongName(t *testing.T) {
+	g := NewURLGenerator()
+	url, err := g.generateOriginalNameURL(strings.Repeat("a", 300) + "." + strings.Repeat("x", 40))
+	assert.NoError(t, err)
+	assert.Regexp(t, `^a{64}-[0-9a-f]{8}$`, url, "long names are clamped and overlong extensions dropped")
+
+	url, err = g.generateOriginalNameURL(strings.Repeat("ab-", 30) + ".png")
+	assert.NoError(t, err)
+	assert.Regexp(t, `^[a-z-]{1,64}[a-z]-[0-9a-f]{8}\.png$`, url, "no separator is left before the suffix")
 }
 
 func TestGenerateRandomURL(t *testing.T) {
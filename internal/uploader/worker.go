@@ -7,10 +7,17 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// CleanupTask is additional periodic maintenance run alongside the expired files cleanup
+type CleanupTask struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
 type CleanupWorker struct {
 	service       *service
 	interval      time.Duration
 	syncInterval  time.Duration
+	tasks         []CleanupTask
 	done          chan struct{}
 	cleanupTicker *time.Ticker
 	syncTicker    *time.Ticker
@@ -25,6 +32,11 @@ func NewCleanupWorker(service *service, interval time.Duration) *CleanupWorker {
 	}
 }
 
+// AddTask registers a task that runs on every cleanup interval, it must be called before Start
+func (w *CleanupWorker) AddTask(name string, run func(ctx context.Context) error) {
+	w.tasks = append(w.tasks, CleanupTask{Name: name, Run: run})
+}
+
 func (w *CleanupWorker) Start(ctx context.Context) {
 	// Perform initial cleanup
 	w.performInitialCleanup(ctx)
@@ -57,11 +69,39 @@ func (w *CleanupWorker) performInitialCleanup(ctx context.Context) {
 			Msg("error during initial expired files cleanup")
 	}
 
-	if err := w.service.SyncStorageWithDatabase(ctx); err != nil {
+	if err := w.syncStorage(ctx); err != nil {
 		log.Error().
 			Err(err).
 			Msg("error during initial storage sync")
 	}
+
+	w.runTasks(ctx)
+}
+
+// syncStorage runs the storage sync, which only reports drift unless deletions are enabled with STORAGE_SYNC_DELETE
+func (w *CleanupWorker) syncStorage(ctx context.Context) error {
+	result, err := w.service.SyncStorageWithDatabase(ctx, !w.service.config.SyncDeletes)
+	if err != nil {
+		return err
+	}
+	if result.DryRun && (len(result.OrphanedObjects) > 0 || len(result.MissingObjects) > 0) {
+		log.Warn().
+			Int("orphaned_objects", len(result.OrphanedObjects)).
+			Int("missing_objects", len(result.MissingObjects)).
+			Msg("storage and database are out of sync, set STORAGE_SYNC_DELETE=true or use the admin sync to clean up")
+	}
+	return nil
+}
+
+func (w *CleanupWorker) runTasks(ctx context.Context) {
+	for _, task := range w.tasks {
+		if err := task.Run(ctx); err != nil {
+			log.Error().
+				Err(err).
+				Str("task", task.Name).
+				Msg("error running cleanup task")
+		}
+	}
 }
 
 func (w *CleanupWorker) run(ctx context.Context) {
@@ -78,8 +118,9 @@ func (w *CleanupWorker) run(ctx context.Context) {
 					Err(err).
 					Msg("error cleaning up expired files")
 			}
+			w.runTasks(ctx)
 		case <-w.syncTicker.C:
-			if err := w.service.SyncStorageWithDatabase(ctx); err != nil {
+			if err := w.syncStorage(ctx); err != nil {
 				log.Error().
 					Err(err).
 					Msg("error syncing storage with database")
@@ -87,9 +128,3 @@ func (w *CleanupWorker) run(ctx context.Context) {
 		}
 	}
 }
-
-// StartExpiredFilesWorker is kept for backward compatibility
-func StartExpiredFilesWorker(ctx context.Context, service *service, interval time.Duration) {
-	worker := NewCleanupWorker(service, interval)
-	worker.Start(ctx)
-}
@@ -0,0 +1,49 @@
+package user
+
+import (
+	"net/http"
+	"volaticus-go/cmd/web"
+)
+
+// sessionMaxAge is how long browsers keep the session cookie, in seconds
+const sessionMaxAge = 3600 * 24
+
+// SessionCookie holds the attributes of the cookie carrying the JWT of signed in users
+type SessionCookie struct {
+	Secure   bool // Always Secure, otherwise only requests over TLS get a Secure cookie
+	SameSite http.SameSite
+	Domain   string
+}
+
+// NewSessionCookie returns the cookie attributes for a SameSite mode of strict or lax.
+// Unknown modes fall back to strict, None would send the session along with cross-site requests.
+func NewSessionCookie(secure bool, sameSite, domain string) SessionCookie {
+	mode := http.SameSiteStrictMode
+	if sameSite == "lax" {
+		mode = http.SameSiteLaxMode
+	}
+	return SessionCookie{Secure: secure, SameSite: mode, Domain: domain}
+}
+
+func (c SessionCookie) cookie(r *http.Request, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     "jwt",
+		Value:    value,
+		Path:     web.Path("/"),
+		Domain:   c.Domain,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   c.Secure || r.TLS != nil,
+		SameSite: c.SameSite,
+	}
+}
+
+// set stores the JWT of a signed in user
+func (c SessionCookie) set(w http.ResponseWriter, r *http.Request, token string) {
+	http.SetCookie(w, c.cookie(r, token, sessionMaxAge))
+}
+
+// clear removes the session, the attributes have to match the cookie that was set
+func (c SessionCookie) clear(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, c.cookie(r, "", -1))
+}
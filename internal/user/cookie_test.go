@@ -0,0 +1,40 @@
+package user
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionCookie(t *testing.T) {
+	plain := httptest.NewRequest(http.MethodPost, "http://example.com/login", nil)
+	overTLS := httptest.NewRequest(http.MethodPost, "https://example.com/login", nil)
+	overTLS.TLS = &tls.ConnectionState{}
+
+	defaults := NewSessionCookie(false, "strict", "")
+	assert.False(t, defaults.cookie(plain, "token", sessionMaxAge).Secure)
+	assert.True(t, defaults.cookie(overTLS, "token", sessionMaxAge).Secure)
+	assert.Equal(t, http.SameSiteStrictMode, defaults.SameSite)
+
+	// Behind a proxy terminating TLS the request itself is plain HTTP
+	proxied := NewSessionCookie(true, "lax", "example.com")
+	cookie := proxied.cookie(plain, "token", sessionMaxAge)
+	assert.True(t, cookie.Secure)
+	assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+	assert.Equal(t, "example.com", cookie.Domain)
+
+	// Logging out has to clear the cookie with the attributes it was set with
+	w := httptest.NewRecorder()
+	proxied.clear(w, plain)
+	cleared := w.Result().Cookies()
+	if assert.Len(t, cleared, 1) {
+		assert.Equal(t, "jwt", cleared[0].Name)
+		assert.Equal(t, "example.com", cleared[0].Domain)
+		assert.Negative(t, cleared[0].MaxAge)
+	}
+
+	assert.Equal(t, http.SameSiteStrictMode, NewSessionCookie(true, "none", "").SameSite)
+}
@@ -8,4 +8,12 @@ var (
 	ErrUsernameExists     = errors.New("username already exists")
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrInvalidInput       = errors.New("invalid input")
+	ErrEmailNotVerified   = errors.New("email not verified")
+	ErrAccountLocked      = errors.New("too many failed login attempts")
+
+	ErrInvalidVerification = errors.New("invalid verification token")
+	ErrVerificationExpired = errors.New("verification token has expired")
 )
+
+// ErrCodeEmailNotVerified tells API clients that the login failed only because of the missing verification
+const ErrCodeEmailNotVerified = "EMAIL_NOT_VERIFIED"
@@ -1,11 +1,23 @@
 package user
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
+	"html"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"volaticus-go/cmd/web"
+	"volaticus-go/internal/audit"
+	"volaticus-go/internal/common/apierror"
+	"volaticus-go/internal/common/clientip"
 	"volaticus-go/internal/common/models"
+	userctx "volaticus-go/internal/context"
 	"volaticus-go/internal/validation"
 )
 
@@ -16,15 +28,30 @@ type AuthService interface {
 	GenerateToken(user *models.User) (string, error)
 }
 
+// FileCleaner removes all uploaded files of a user, including their stored content.
+type FileCleaner interface {
+	DeleteUserFiles(ctx context.Context, userID uuid.UUID) error
+}
+
 type Handler struct {
 	service     Service
 	authService AuthService
+	fileCleaner FileCleaner
+	clientIP    *clientip.Resolver
+	cookies     SessionCookie
+	audit       *audit.Logger
 }
 
-func NewHandler(service Service, authService AuthService) *Handler {
+// NewHandler creates the user handler, clientIP finds the client IP of login attempts behind reverse proxies,
+// cookies are the attributes of the session cookie set on login and auditLog records account changes
+func NewHandler(service Service, authService AuthService, fileCleaner FileCleaner, clientIP *clientip.Resolver, cookies SessionCookie, auditLog *audit.Logger) *Handler {
 	return &Handler{
 		service:     service,
 		authService: authService,
+		fileCleaner: fileCleaner,
+		clientIP:    clientIP,
+		cookies:     cookies,
+		audit:       auditLog,
 	}
 }
 
@@ -42,6 +69,23 @@ type UpdateUserRequest struct {
 	IsActive *bool   `json:"is_active"`
 }
 
+// UpdateProfileRequest changes the email and username of the authenticated user, missing
+// and empty fields are kept
+type UpdateProfileRequest struct {
+	Email    *string `json:"email" validate:"omitempty,email,max=255"`
+	Username *string `json:"username" validate:"omitempty,username"`
+}
+
+// DeleteAccountRequest confirms account deletion with the current password
+type DeleteAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// ResendVerificationRequest asks for another verification email
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
 type LoginRequest struct {
 	Username string `json:"username" validate:"required,username"`
 	Password string `json:"password" validate:"required,min=1"`
@@ -50,13 +94,13 @@ type LoginRequest struct {
 func (h *Handler) HandleRegister(w http.ResponseWriter, r *http.Request) {
 	var req CreateUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Error(w, r, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	if err := validation.Validate(&req); err != nil {
 		errs := validation.FormatError(err)
-		http.Error(w, errs[0].Error, http.StatusBadRequest)
+		apierror.Error(w, r, errs[0].Error, http.StatusBadRequest)
 		return
 	}
 
@@ -64,43 +108,41 @@ func (h *Handler) HandleRegister(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		switch {
 		case errors.Is(err, ErrEmailExists):
-			http.Error(w, "Email already exists", http.StatusConflict)
+			apierror.Error(w, r, "Email already exists", http.StatusConflict)
 		case errors.Is(err, ErrUsernameExists):
-			http.Error(w, "Username already exists", http.StatusConflict)
+			apierror.Error(w, r, "Username already exists", http.StatusConflict)
 		default:
 			log.Error().
 				Err(err).
 				Str("username", req.Username).
 				Msg("Failed to register user")
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			apierror.Error(w, r, "Internal server error", http.StatusInternalServerError)
 		}
 		return
 	}
 
+	// No session until the address is verified, the user signs in after following the link
+	if h.service.VerificationRequired() && !user.EmailVerified {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("Account created. Check your email to verify your address before signing in."))
+		return
+	}
+
 	token, err := h.authService.GenerateToken(user)
 	if err != nil {
 		log.Error().
 			Err(err).
 			Str("user_id", user.ID.String()).
 			Msg("Failed to generate token")
-		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		apierror.Error(w, r, "Error generating token", http.StatusInternalServerError)
 		return
 	}
 
-	// Set JWT cookie with appropriate security flags
-	http.SetCookie(w, &http.Cookie{
-		Name:     "jwt",
-		Value:    token,
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   r.TLS != nil,
-		SameSite: http.SameSiteStrictMode,
-		MaxAge:   3600 * 24, // 24 hours
-	})
+	h.cookies.set(w, r, token)
 
 	// If this is a HTMX request, send a redirect
 	if r.Header.Get("HX-Request") == "true" {
-		w.Header().Set("HX-Redirect", "/")
+		w.Header().Set("HX-Redirect", web.Path("/"))
 		return
 	}
 
@@ -112,28 +154,45 @@ func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	var req LoginRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Error(w, r, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 	if err := validation.Validate(&req); err != nil {
 		errs := validation.FormatError(err)
-		http.Error(w, errs[0].Error, http.StatusBadRequest)
+		apierror.Error(w, r, errs[0].Error, http.StatusBadRequest)
 		return
 	}
 
-	user, err := h.service.ValidateCredentials(r.Context(), req.Username, req.Password)
+	user, err := h.service.ValidateCredentials(r.Context(), req.Username, req.Password, h.clientIP.FromRequest(r))
 	if err != nil {
+		h.audit.Record(r, audit.Event{
+			Action:    audit.ActionLogin,
+			ActorName: req.Username,
+			Result:    audit.ResultFailure,
+			Details:   err.Error(),
+		})
+		var locked *LockedError
 		switch {
+		case errors.As(err, &locked):
+			minutes := int(math.Ceil(locked.RetryAfter.Minutes()))
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+			apierror.Error(w, r, fmt.Sprintf("Too many failed login attempts, please try again in %d minute(s)", minutes),
+				http.StatusTooManyRequests)
 		case errors.Is(err, ErrUserNotFound):
-			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+			apierror.Error(w, r, "Invalid credentials", http.StatusUnauthorized)
 		case errors.Is(err, ErrInvalidCredentials):
-			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+			apierror.Error(w, r, "Invalid credentials", http.StatusUnauthorized)
+		case errors.Is(err, ErrEmailNotVerified):
+			apierror.Respond(w, r, &apierror.APIError{
+				Code:    ErrCodeEmailNotVerified,
+				Message: "Please verify your email address before signing in",
+			}, http.StatusForbidden)
 		default:
 			log.Error().
 				Err(err).
 				Str("username", req.Username).
 				Msg("Error validating user credentials")
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			apierror.Error(w, r, "Internal server error", http.StatusInternalServerError)
 		}
 		return
 	}
@@ -144,43 +203,245 @@ func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 			Err(err).
 			Str("user_id", user.ID.String()).
 			Msg("Failed to generate auth token")
-		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		apierror.Error(w, r, "Error generating token", http.StatusInternalServerError)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "jwt",
-		Value:    token,
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   r.TLS != nil,
-		SameSite: http.SameSiteStrictMode,
-		MaxAge:   3600 * 24,
-	})
+	h.cookies.set(w, r, token)
+	h.audit.Record(r, audit.Event{Action: audit.ActionLogin, ActorID: &user.ID, ActorName: user.Username})
 
 	if r.Header.Get("HX-Request") == "true" {
-		w.Header().Set("HX-Redirect", "/")
+		w.Header().Set("HX-Redirect", web.Path("/"))
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
+// HandleVerifyEmail marks an email address verified with the token from the verification link
+func (h *Handler) HandleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	err := h.service.VerifyEmail(r.Context(), r.URL.Query().Get("token"))
+	switch {
+	case err == nil:
+		http.Redirect(w, r, web.Path("/login"), http.StatusSeeOther)
+	case errors.Is(err, ErrInvalidVerification), errors.Is(err, ErrVerificationExpired):
+		http.Error(w, "Invalid or expired verification link", http.StatusBadRequest)
+	default:
+		log.Error().
+			Err(err).
+			Msg("Failed to verify email")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// HandleResendVerification sends another verification email. The response is the same
+// for unknown addresses so it cannot be used to find registered accounts.
+func (h *Handler) HandleResendVerification(w http.ResponseWriter, r *http.Request) {
+	var req ResendVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Error(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := validation.Validate(&req); err != nil {
+		errs := validation.FormatError(err)
+		apierror.Error(w, r, errs[0].Error, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.ResendVerification(r.Context(), req.Email); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Failed to resend verification email")
+		apierror.Error(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
 func (h *Handler) HandleLogout(w http.ResponseWriter, r *http.Request) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     "jwt",
-		Value:    "",
-		Path:     "/",
-		MaxAge:   -1,
-		HttpOnly: true,
-		Secure:   r.TLS != nil,
-		SameSite: http.SameSiteStrictMode,
+	h.audit.Record(r, audit.Event{Action: audit.ActionLogout})
+	h.endSession(w, r)
+}
+
+// endSession clears the session cookie and sends the browser to the login page
+func (h *Handler) endSession(w http.ResponseWriter, r *http.Request) {
+	h.cookies.clear(w, r)
+
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Redirect", web.Path("/login"))
+		return
+	}
+
+	http.Redirect(w, r, web.Path("/login"), http.StatusSeeOther)
+}
+
+// HandleDeleteAccount permanently deletes the authenticated user after password confirmation
+func (h *Handler) HandleDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	userContext := userctx.GetUserFromContext(r.Context())
+	if userContext == nil {
+		apierror.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Error(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := validation.Validate(&req); err != nil {
+		apierror.Error(w, r, "Password is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.VerifyPassword(r.Context(), userContext.ID, req.Password); err != nil {
+		h.audit.Record(r, audit.Event{
+			Action:     audit.ActionAccountDelete,
+			TargetType: "user",
+			TargetID:   userContext.ID.String(),
+			Result:     audit.ResultFailure,
+			Details:    err.Error(),
+		})
+		switch {
+		case errors.Is(err, ErrInvalidCredentials), errors.Is(err, ErrUserNotFound):
+			apierror.Error(w, r, "Invalid password", http.StatusUnauthorized)
+		default:
+			log.Error().
+				Err(err).
+				Str("user_id", userContext.ID.String()).
+				Msg("Error verifying password")
+			apierror.Error(w, r, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := h.fileCleaner.DeleteUserFiles(r.Context(), userContext.ID); err != nil {
+		log.Error().
+			Err(err).
+			Str("user_id", userContext.ID.String()).
+			Msg("Failed to delete user files")
+		apierror.Error(w, r, "Error deleting account", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.service.DeleteAccount(r.Context(), userContext.ID); err != nil {
+		apierror.Error(w, r, "Error deleting account", http.StatusInternalServerError)
+		return
+	}
+	h.audit.Record(r, audit.Event{Action: audit.ActionAccountDelete, TargetType: "user", TargetID: userContext.ID.String()})
+
+	// The session belongs to a user that no longer exists
+	h.endSession(w, r)
+}
+
+// HandleForceDownload updates whether the authenticated user's files are served as downloads
+func (h *Handler) HandleForceDownload(w http.ResponseWriter, r *http.Request) {
+	userContext := userctx.GetUserFromContext(r.Context())
+	if userContext == nil {
+		apierror.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		apierror.Error(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	enabled := r.FormValue("force_download") == "true"
+
+	if err := h.service.SetForceDownload(r.Context(), userContext.ID, enabled); err != nil {
+		apierror.Error(w, r, "Error saving setting", http.StatusInternalServerError)
+		return
+	}
+
+	if enabled {
+		w.Write([]byte("Your files are now downloaded instead of opened in the browser"))
+	} else {
+		w.Write([]byte("Your files open in the browser unless a download is requested"))
+	}
+}
+
+// HandleUpdateProfile changes the email and username of the authenticated user. The session
+// token carries the username, so a new one is issued when it changes.
+func (h *Handler) HandleUpdateProfile(w http.ResponseWriter, r *http.Request) {
+	userContext := userctx.GetUserFromContext(r.Context())
+	if userContext == nil {
+		apierror.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req UpdateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Error(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := validation.Validate(&req); err != nil {
+		errs := validation.FormatError(err)
+		apierror.Error(w, r, errs[0].Error, http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.service.Update(r.Context(), userContext.ID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrEmailExists):
+			apierror.Error(w, r, "Email already exists", http.StatusConflict)
+		case errors.Is(err, ErrUsernameExists):
+			apierror.Error(w, r, "Username already exists", http.StatusConflict)
+		case errors.Is(err, ErrUserNotFound):
+			apierror.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+		default:
+			apierror.Error(w, r, "Error updating profile", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	usernameChanged := user.Username != userContext.Username
+	var changed []string
+	if req.Email != nil && *req.Email != "" {
+		changed = append(changed, "email")
+	}
+	if usernameChanged {
+		changed = append(changed, "username (was "+userContext.Username+")")
+	}
+	h.audit.Record(r, audit.Event{
+		Action:     audit.ActionProfileUpdate,
+		TargetType: "user",
+		TargetID:   user.ID.String(),
+		Details:    strings.Join(changed, ", "),
 	})
+	// Requests authenticated with an API token have no session to replace
+	if _, err := r.Cookie("jwt"); err == nil && usernameChanged {
+		token, err := h.authService.GenerateToken(user)
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("user_id", user.ID.String()).
+				Msg("Failed to generate auth token")
+			apierror.Error(w, r, "Error generating token", http.StatusInternalServerError)
+			return
+		}
+		h.cookies.set(w, r, token)
+	}
 
 	if r.Header.Get("HX-Request") == "true" {
-		w.Header().Set("HX-Redirect", "/login")
+		// The username is shown throughout the page
+		if usernameChanged {
+			w.Header().Set("HX-Refresh", "true")
+			return
+		}
+		message := "Your profile was updated"
+		if user.PendingEmail != nil {
+			message += ", open the link sent to " + html.EscapeString(*user.PendingEmail) + " to switch to the new address"
+		}
+		w.Write([]byte(message))
 		return
 	}
 
-	http.Redirect(w, r, "/login", http.StatusSeeOther)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"email":          user.Email,
+		"username":       user.Username,
+		"email_verified": user.EmailVerified,
+		"pending_email":  user.PendingEmail,
+	})
 }
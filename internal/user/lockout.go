@@ -0,0 +1,150 @@
+package user
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LockedError is returned while logins are refused after too many failed attempts
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s, retry in %s", ErrAccountLocked, e.RetryAfter.Round(time.Second))
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrAccountLocked
+}
+
+// lockoutMaxKeys caps the usernames and IPs tracked at once, so failed logins for many different
+// names can't grow the memory without bound
+const lockoutMaxKeys = 10000
+
+// loginAttempts holds the recent failed logins of a single username and IP
+type loginAttempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// loginLockout refuses logins for a cooldown after too many failed attempts.
+// Attempts are keyed by username and client IP, so a third party cannot lock
+// a user out of their account from another address. Failures older than the
+// cooldown are forgotten, and the oldest keys are evicted beyond maxKeys.
+type loginLockout struct {
+	mu          sync.Mutex
+	attempts    map[string]*loginAttempts
+	maxAttempts int
+	maxKeys     int
+	duration    time.Duration
+	lastPrune   time.Time
+	now         func() time.Time
+}
+
+// newLoginLockout creates a lockout after maxAttempts failures, 0 disables it
+func newLoginLockout(maxAttempts int, duration time.Duration) *loginLockout {
+	return &loginLockout{
+		attempts:    make(map[string]*loginAttempts),
+		maxAttempts: maxAttempts,
+		maxKeys:     lockoutMaxKeys,
+		duration:    duration,
+		now:         time.Now,
+	}
+}
+
+// Locked returns how long logins of the key are still refused, 0 if they are allowed
+func (l *loginLockout) Locked(key string) time.Duration {
+	if l.maxAttempts <= 0 {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, ok := l.attempts[key]
+	if !ok {
+		return 0
+	}
+	return max(a.lockedUntil.Sub(l.now()), 0)
+}
+
+// Fail records a failed login and returns the cooldown if the key is now locked
+func (l *loginLockout) Fail(key string) time.Duration {
+	if l.maxAttempts <= 0 {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+
+	a, ok := l.attempts[key]
+	if !ok && len(l.attempts) >= l.maxKeys {
+		l.evict(now)
+	}
+	if !ok || now.Sub(a.lastFailure) > l.duration {
+		a = &loginAttempts{}
+		l.attempts[key] = a
+	}
+	a.failures++
+	a.lastFailure = now
+
+	if a.failures < l.maxAttempts {
+		return 0
+	}
+	// The next attempt starts counting from zero once the cooldown is over
+	a.failures = 0
+	a.lockedUntil = now.Add(l.duration)
+	return l.duration
+}
+
+// Reset forgets the failed attempts of the key after a successful login
+func (l *loginLockout) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.attempts, key)
+}
+
+// prune removes keys without recent failures, must be called with the lock held
+func (l *loginLockout) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < l.duration {
+		return
+	}
+	l.removeExpired(now)
+}
+
+// evict makes room for a new key when the map is full. Expired keys go first, then the key
+// failing longest ago, keys that are still locked only when no other is left.
+func (l *loginLockout) evict(now time.Time) {
+	l.removeExpired(now)
+	if len(l.attempts) < l.maxKeys {
+		return
+	}
+
+	var oldest string
+	var oldestFailure time.Time
+	oldestLocked := true
+	for key, a := range l.attempts {
+		locked := now.Before(a.lockedUntil)
+		if oldest == "" || oldestLocked && !locked || locked == oldestLocked && a.lastFailure.Before(oldestFailure) {
+			oldest, oldestFailure, oldestLocked = key, a.lastFailure, locked
+		}
+	}
+	delete(l.attempts, oldest)
+}
+
+// removeExpired removes keys without recent failures that are not locked
+func (l *loginLockout) removeExpired(now time.Time) {
+	for key, a := range l.attempts {
+		if now.Sub(a.lastFailure) > l.duration && now.After(a.lockedUntil) {
+			delete(l.attempts, key)
+		}
+	}
+	l.lastPrune = now
+}
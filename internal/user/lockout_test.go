@@ -0,0 +1,75 @@
+package user
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginLockout(t *testing.T) {
+	now := time.Now()
+	l := newLoginLockout(3, time.Minute)
+	l.now = func() time.Time { return now }
+
+	assert.Zero(t, l.Fail("alice|1.2.3.4"))
+	assert.Zero(t, l.Fail("alice|1.2.3.4"))
+	assert.Equal(t, time.Minute, l.Fail("alice|1.2.3.4"))
+	assert.Equal(t, time.Minute, l.Locked("alice|1.2.3.4"))
+
+	// Other addresses are not affected
+	assert.Zero(t, l.Locked("alice|5.6.7.8"))
+
+	now = now.Add(45 * time.Second)
+	assert.Equal(t, 15*time.Second, l.Locked("alice|1.2.3.4"))
+
+	now = now.Add(15 * time.Second)
+	assert.Zero(t, l.Locked("alice|1.2.3.4"))
+}
+
+func TestLoginLockoutForgetsOldFailures(t *testing.T) {
+	now := time.Now()
+	l := newLoginLockout(2, time.Minute)
+	l.now = func() time.Time { return now }
+
+	l.Fail("bob|1.2.3.4")
+	now = now.Add(2 * time.Minute)
+	assert.Zero(t, l.Fail("bob|1.2.3.4"), "failure outside the window counted")
+
+	l.Reset("bob|1.2.3.4")
+	assert.Zero(t, l.Fail("bob|1.2.3.4"), "Reset() kept the failures")
+}
+
+func TestLoginLockoutEvictsWhenFull(t *testing.T) {
+	now := time.Now()
+	l := newLoginLockout(2, time.Minute)
+	l.now = func() time.Time { return now }
+	l.maxKeys = 3
+
+	l.Fail("dave|1.2.3.4")
+	l.Fail("dave|1.2.3.4")
+	now = now.Add(time.Second)
+	l.Fail("erin|1.2.3.4")
+	now = now.Add(time.Second)
+	l.Fail("frank|1.2.3.4")
+	now = now.Add(time.Second)
+	l.Fail("grace|1.2.3.4")
+
+	assert.Len(t, l.attempts, 3)
+	assert.NotContains(t, l.attempts, "erin|1.2.3.4", "the oldest unlocked key was kept")
+	assert.NotZero(t, l.Locked("dave|1.2.3.4"), "a locked key was evicted")
+}
+
+func TestLoginLockoutDisabled(t *testing.T) {
+	l := newLoginLockout(0, time.Minute)
+	for range 10 {
+		assert.Zero(t, l.Fail("carol|1.2.3.4"))
+	}
+	assert.Zero(t, l.Locked("carol|1.2.3.4"))
+}
+
+func TestLockedError(t *testing.T) {
+	var err error = &LockedError{RetryAfter: time.Minute}
+	assert.True(t, errors.Is(err, ErrAccountLocked))
+}
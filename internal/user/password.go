@@ -0,0 +1,111 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing schemes selectable with PASSWORD_HASH
+const (
+	SchemeBcrypt = "bcrypt"
+	SchemeArgon2 = "argon2"
+)
+
+// argon2id parameters for new hashes, the second recommendation of RFC 9106
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024 // KiB
+	argon2Threads = 4
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+)
+
+// argon2Prefix starts hashes in the PHC string format, e.g. $argon2id$v=19$m=65536,t=3,p=4$salt$key
+const argon2Prefix = "$argon2id$"
+
+var errUnknownHash = errors.New("unknown password hash format")
+
+// passwordHasher creates hashes with the configured scheme and verifies hashes of every
+// supported scheme. Both formats carry their parameters, so stored hashes keep working
+// when the configuration changes and are upgraded on the next login.
+type passwordHasher struct {
+	scheme     string
+	bcryptCost int
+}
+
+func newPasswordHasher(scheme string, bcryptCost int) *passwordHasher {
+	if bcryptCost == 0 {
+		bcryptCost = bcrypt.DefaultCost
+	}
+	return &passwordHasher{scheme: scheme, bcryptCost: bcryptCost}
+}
+
+// Hash returns a new hash of the password
+func (h *passwordHasher) Hash(password string) (string, error) {
+	if h.scheme != SchemeArgon2 {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+		return string(hash), err
+	}
+
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2Prefix, argon2.Version,
+		argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify reports whether the password matches the hash, and whether the hash
+// should be replaced because it was made with another scheme or other parameters
+func (h *passwordHasher) Verify(hash, password string) (ok, rehash bool, err error) {
+	if !strings.HasPrefix(hash, argon2Prefix) {
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return false, false, nil
+			}
+			return false, false, err
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		return true, h.scheme != SchemeBcrypt || cost != h.bcryptCost, err
+	}
+
+	var version int
+	var memory, iterations uint32
+	var threads uint8
+	params := strings.Split(strings.TrimPrefix(hash, argon2Prefix), "$")
+	if len(params) != 4 {
+		return false, false, errUnknownHash
+	}
+	if _, err := fmt.Sscanf(params[0], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false, errUnknownHash
+	}
+	if _, err := fmt.Sscanf(params[1], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false, false, errUnknownHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(params[2])
+	if err != nil {
+		return false, false, errUnknownHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(params[3])
+	if err != nil || len(key) == 0 {
+		return false, false, errUnknownHash
+	}
+
+	got := argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(got, key) != 1 {
+		return false, false, nil
+	}
+	rehash = h.scheme != SchemeArgon2 ||
+		memory != argon2Memory || iterations != argon2Time || threads != argon2Threads || len(key) != argon2KeyLen
+	return true, rehash, nil
+}
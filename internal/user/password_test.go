@@ -0,0 +1,65 @@
+package user
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordHasher(t *testing.T) {
+	for _, scheme := range []string{SchemeBcrypt, SchemeArgon2} {
+		t.Run(scheme, func(t *testing.T) {
+			h := newPasswordHasher(scheme, 4)
+			hash, err := h.Hash("correct horse")
+			require.NoError(t, err)
+
+			ok, rehash, err := h.Verify(hash, "correct horse")
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.False(t, rehash)
+
+			ok, _, err = h.Verify(hash, "wrong")
+			assert.NoError(t, err)
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestPasswordHasherRehash(t *testing.T) {
+	bcryptHash, err := newPasswordHasher(SchemeBcrypt, 4).Hash("secret")
+	require.NoError(t, err)
+	argon2Hash, err := newPasswordHasher(SchemeArgon2, 4).Hash("secret")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(argon2Hash, "$argon2id$v=19$"))
+
+	tests := []struct {
+		name   string
+		hasher *passwordHasher
+		hash   string
+		rehash bool
+	}{
+		{"bcrypt to argon2", newPasswordHasher(SchemeArgon2, 4), bcryptHash, true},
+		{"argon2 to bcrypt", newPasswordHasher(SchemeBcrypt, 4), argon2Hash, true},
+		{"bcrypt cost raised", newPasswordHasher(SchemeBcrypt, 5), bcryptHash, true},
+		{"argon2 unchanged", newPasswordHasher(SchemeArgon2, 5), argon2Hash, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash, err := tt.hasher.Verify(tt.hash, "secret")
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, tt.rehash, rehash)
+		})
+	}
+}
+
+func TestPasswordHasherMalformed(t *testing.T) {
+	h := newPasswordHasher(SchemeArgon2, 4)
+	for _, hash := range []string{"", "plain", "$argon2id$v=19$m=1,t=1,p=1$salt", "$argon2id$v=18$m=1,t=1,p=1$c2FsdA$a2V5"} {
+		ok, _, err := h.Verify(hash, "secret")
+		assert.False(t, ok)
+		assert.Error(t, err, hash)
+	}
+}
@@ -24,6 +24,15 @@ type Repository interface {
 	Update(ctx context.Context, user *models.User) error
 	// Delete performs a soft delete of a user
 	Delete(ctx context.Context, id uuid.UUID) error
+	// HardDelete permanently removes a user and all of their data
+	HardDelete(ctx context.Context, id uuid.UUID) error
+	// UpdatePasswordHash replaces the password hash of a user
+	UpdatePasswordHash(ctx context.Context, id uuid.UUID, hash string) error
+	// SetEmailVerified marks the email of a user as verified, if it is still their current address,
+	// or makes their pending new address the verified current one
+	SetEmailVerified(ctx context.Context, id uuid.UUID, email string) error
+	// UpdateForceDownload sets whether all files of a user are served as attachments
+	UpdateForceDownload(ctx context.Context, id uuid.UUID, enabled bool) error
 }
 
 type repository struct {
@@ -49,9 +58,9 @@ func (r *repository) Create(ctx context.Context, user *models.User) error {
 			return ErrEmailExists
 		}
 
-		// Check if username exists
+		// Check if username exists, names differing only in case count as the same
 		if err := tx.GetContext(ctx, &exists,
-			"SELECT EXISTS(SELECT 1 FROM users WHERE username = $1)", user.Username); err != nil {
+			"SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(username) = LOWER($1))", user.Username); err != nil {
 			return err
 		}
 		if exists {
@@ -59,14 +68,26 @@ func (r *repository) Create(ctx context.Context, user *models.User) error {
 		}
 
 		query := `
-            INSERT INTO users (id, email, username, password_hash, is_active, created_at, updated_at)
-            VALUES (:id, :email, :username, :password_hash, :is_active, NOW(), NOW())`
+            INSERT INTO users (id, email, username, password_hash, is_active, email_verified, created_at, updated_at)
+            VALUES (:id, :email, :username, :password_hash, :is_active, :email_verified, NOW(), NOW())`
 
 		_, err := tx.NamedExecContext(ctx, query, user)
-		return err
+		return constraintError(err)
 	})
 }
 
+// constraintError maps violations of the unique user columns to their domain errors.
+// The existence checks miss concurrent requests registering the same name or email.
+func constraintError(err error) error {
+	switch constraint, _ := database.UniqueConstraint(err); constraint {
+	case "users_email_key":
+		return ErrEmailExists
+	case "users_username_key", "idx_users_username_lower":
+		return ErrUsernameExists
+	}
+	return err
+}
+
 func (r *repository) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
 	var user models.User
 	err := r.Get(ctx, &user, "SELECT * FROM users WHERE id = $1", id)
@@ -118,11 +139,24 @@ func (r *repository) Update(ctx context.Context, user *models.User) error {
 			}
 		}
 
+		// Nobody else may have the pending address either, it becomes theirs once verified
+		if user.PendingEmail != nil {
+			var exists bool
+			if err := tx.GetContext(ctx, &exists,
+				"SELECT EXISTS(SELECT 1 FROM users WHERE email = $1 AND id != $2)",
+				*user.PendingEmail, user.ID); err != nil {
+				return err
+			}
+			if exists {
+				return ErrEmailExists
+			}
+		}
+
 		// Similar check for username
 		if existingUser.Username != user.Username {
 			var exists bool
 			if err := tx.GetContext(ctx, &exists,
-				"SELECT EXISTS(SELECT 1 FROM users WHERE username = $1 AND id != $2)",
+				"SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(username) = LOWER($1) AND id != $2)",
 				user.Username, user.ID); err != nil {
 				return err
 			}
@@ -136,12 +170,14 @@ func (r *repository) Update(ctx context.Context, user *models.User) error {
             SET email = :email, 
                 username = :username,
                 is_active = :is_active,
+                email_verified = email_verified AND email = :email, -- a new address has to be verified again
+                pending_email = :pending_email,
                 updated_at = NOW()
             WHERE id = :id`
 
 		result, err := tx.NamedExecContext(ctx, query, user)
 		if err != nil {
-			return err
+			return constraintError(err)
 		}
 
 		rows, err := result.RowsAffected()
@@ -156,6 +192,66 @@ func (r *repository) Update(ctx context.Context, user *models.User) error {
 	})
 }
 
+func (r *repository) UpdatePasswordHash(ctx context.Context, id uuid.UUID, hash string) error {
+	result, err := r.Exec(ctx, "UPDATE users SET password_hash = $2, updated_at = NOW() WHERE id = $1", id, hash)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (r *repository) SetEmailVerified(ctx context.Context, id uuid.UUID, email string) error {
+	result, err := r.Exec(ctx, `
+        UPDATE users
+        SET email = $2,
+            email_verified = true,
+            pending_email = CASE WHEN pending_email = $2 THEN NULL ELSE pending_email END,
+            updated_at = NOW()
+        WHERE id = $1
+        AND (email = $2 OR pending_email = $2)`,
+		id, email)
+	if err != nil {
+		// The pending address may have been taken by another account meanwhile
+		return constraintError(err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (r *repository) UpdateForceDownload(ctx context.Context, id uuid.UUID, enabled bool) error {
+	result, err := r.Exec(ctx, "UPDATE users SET force_download = $2, updated_at = NOW() WHERE id = $1", id, enabled)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
 func (r *repository) Delete(ctx context.Context, id uuid.UUID) error {
 	result, err := r.Exec(ctx, "UPDATE users SET is_active = false, updated_at = NOW() WHERE id = $1", id)
 	if err != nil {
@@ -172,3 +268,34 @@ func (r *repository) Delete(ctx context.Context, id uuid.UUID) error {
 
 	return nil
 }
+
+func (r *repository) HardDelete(ctx context.Context, id uuid.UUID) error {
+	return r.WithTx(ctx, func(tx *sqlx.Tx) error {
+		// Click analytics are removed through the cascade on shortened_urls
+		queries := []string{
+			"DELETE FROM api_tokens WHERE user_id = $1",
+			"DELETE FROM shortened_urls WHERE user_id = $1",
+			"DELETE FROM uploaded_files WHERE user_id = $1",
+		}
+		for _, query := range queries {
+			if _, err := tx.ExecContext(ctx, query, id); err != nil {
+				return err
+			}
+		}
+
+		result, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id = $1", id)
+		if err != nil {
+			return err
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrUserNotFound
+		}
+
+		return nil
+	})
+}
@@ -360,3 +360,105 @@ func TestRepository_Delete(t *testing.T) {
 		assert.ErrorIs(t, err, ErrUserNotFound)
 	})
 }
+
+func TestRepository_HardDelete(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	ctx := context.Background()
+
+	t.Run("removes user and owned data", func(t *testing.T) {
+		user := createTestUser(t, repo)
+
+		_, err := db.ExecContext(ctx,
+			`INSERT INTO api_tokens (user_id, name, token) VALUES ($1, 'token', $2)`,
+			user.ID, "hard-delete-"+uuid.New().String())
+		require.NoError(t, err)
+		_, err = db.ExecContext(ctx,
+			`INSERT INTO shortened_urls (user_id, original_url, short_code) VALUES ($1, 'https://example.com', $2)`,
+			user.ID, uuid.New().String()[:8])
+		require.NoError(t, err)
+		_, err = db.ExecContext(ctx,
+			`INSERT INTO uploaded_files (original_name, unique_filename, url_value, user_id) VALUES ('a.txt', $1, $1, $2)`,
+			uuid.New().String(), user.ID)
+		require.NoError(t, err)
+
+		require.NoError(t, repo.HardDelete(ctx, user.ID))
+
+		_, err = repo.GetByID(ctx, user.ID)
+		assert.ErrorIs(t, err, ErrUserNotFound)
+
+		for _, table := range []string{"api_tokens", "shortened_urls", "uploaded_files"} {
+			var count int
+			err := db.GetContext(ctx, &count, "SELECT COUNT(*) FROM "+table+" WHERE user_id = $1", user.ID)
+			require.NoError(t, err)
+			assert.Zero(t, count, table)
+		}
+	})
+
+	t.Run("delete non-existent user", func(t *testing.T) {
+		err := repo.HardDelete(ctx, uuid.New())
+		assert.ErrorIs(t, err, ErrUserNotFound)
+	})
+}
+
+func TestRepository_SetEmailVerified(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	ctx := context.Background()
+
+	user := createTestUser(t, repo)
+	assert.False(t, user.EmailVerified)
+
+	// A link for an old address does not verify the current one
+	err := repo.SetEmailVerified(ctx, user.ID, "old@example.com")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	require.NoError(t, repo.SetEmailVerified(ctx, user.ID, user.Email))
+	fetched, err := repo.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.True(t, fetched.EmailVerified)
+
+	// A pending address replaces the current one once verified
+	pending := "pending-" + fetched.Email
+	fetched.PendingEmail = &pending
+	require.NoError(t, repo.Update(ctx, fetched))
+	fetched, err = repo.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.True(t, fetched.EmailVerified)
+	require.NoError(t, repo.SetEmailVerified(ctx, user.ID, pending))
+	fetched, err = repo.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, pending, fetched.Email)
+	assert.Nil(t, fetched.PendingEmail)
+	assert.True(t, fetched.EmailVerified)
+
+	// Changing the address requires verifying it again
+	fetched.Email = "changed-" + fetched.Email
+	require.NoError(t, repo.Update(ctx, fetched))
+	fetched, err = repo.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.False(t, fetched.EmailVerified)
+}
+
+func TestRepository_UpdateForceDownload(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	ctx := context.Background()
+
+	user := createTestUser(t, repo)
+	assert.False(t, user.ForceDownload)
+
+	require.NoError(t, repo.UpdateForceDownload(ctx, user.ID, true))
+	fetched, err := repo.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.True(t, fetched.ForceDownload)
+
+	err = repo.UpdateForceDownload(ctx, uuid.New(), true)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
@@ -2,10 +2,15 @@ package user
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
-	"golang.org/x/crypto/bcrypt"
+	"net/url"
+	"strings"
 	"volaticus-go/internal/common/models"
+	"volaticus-go/internal/config"
+	"volaticus-go/internal/email"
 )
 
 type Service interface {
@@ -13,20 +18,69 @@ type Service interface {
 	GetByID(ctx context.Context, id uuid.UUID) (*models.User, error)
 	GetByEmail(ctx context.Context, email string) (*models.User, error)
 	GetByUsername(ctx context.Context, username string) (*models.User, error)
-	ValidateCredentials(ctx context.Context, username, password string) (*models.User, error)
+	ValidateCredentials(ctx context.Context, username, password, clientIP string) (*models.User, error)
 	Delete(ctx context.Context, id uuid.UUID) error
+	VerifyPassword(ctx context.Context, id uuid.UUID, password string) error
+	DeleteAccount(ctx context.Context, id uuid.UUID) error
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerification(ctx context.Context, email string) error
+	VerificationRequired() bool
+	SetForceDownload(ctx context.Context, id uuid.UUID, enabled bool) error
+	Update(ctx context.Context, id uuid.UUID, req *UpdateProfileRequest) (*models.User, error)
 }
 
 type service struct {
-	repo Repository
+	repo            Repository
+	emailer         email.Emailer
+	verifier        *Verifier
+	baseURL         string
+	requireVerified bool
+	lockout         *loginLockout
+	hasher          *passwordHasher
+	adminNames      []string // Usernames in ADMIN_USERS, nobody else may take them
 }
 
-func NewService(repo Repository) Service {
-	return &service{repo: repo}
+func NewService(repo Repository, config *config.Config, emailer email.Emailer) Service {
+	return &service{
+		repo:            repo,
+		emailer:         emailer,
+		verifier:        NewVerifier(config.Secret),
+		baseURL:         config.BaseURL,
+		requireVerified: config.VerifyEmail,
+		lockout:         newLoginLockout(config.LoginAttempts, config.LoginLockout),
+		hasher:          newPasswordHasher(config.PasswordScheme, config.BcryptCost),
+		adminNames:      adminNames(config.AdminUsers),
+	}
+}
+
+// adminNames returns the usernames of ADMIN_USERS, leaving out the user IDs
+func adminNames(admins []string) []string {
+	var names []string
+	for _, admin := range admins {
+		if _, err := uuid.Parse(admin); err != nil {
+			names = append(names, admin)
+		}
+	}
+	return names
+}
+
+// isAdminName reports whether the username matches a username of ADMIN_USERS ignoring case. Those
+// count as taken, otherwise anyone could register an admin name that has no account yet.
+func (s *service) isAdminName(username string) bool {
+	for _, name := range s.adminNames {
+		if strings.EqualFold(name, username) {
+			return true
+		}
+	}
+	return false
 }
 
 func (s *service) Register(ctx context.Context, req *CreateUserRequest) (*models.User, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if s.isAdminName(req.Username) {
+		return nil, ErrUsernameExists
+	}
+
+	hash, err := s.hasher.Hash(req.Password)
 	if err != nil {
 		log.Error().
 			Err(err).
@@ -38,7 +92,7 @@ func (s *service) Register(ctx context.Context, req *CreateUserRequest) (*models
 		ID:           uuid.New(),
 		Email:        req.Email,
 		Username:     req.Username,
-		PasswordHash: string(hash),
+		PasswordHash: hash,
 		IsActive:     true,
 	}
 
@@ -54,9 +108,70 @@ func (s *service) Register(ctx context.Context, req *CreateUserRequest) (*models
 		Str("user_id", user.ID.String()).
 		Str("username", user.Username).
 		Msg("New user registered")
+
+	// The account exists either way, the user can request another email
+	if err := s.sendVerification(ctx, user, user.Email); err != nil {
+		log.Error().
+			Err(err).
+			Str("user_id", user.ID.String()).
+			Msg("Failed to send verification email")
+	}
 	return user, nil
 }
 
+// sendVerification emails the user a link to verify an address, their current or a pending new one
+func (s *service) sendVerification(ctx context.Context, user *models.User, address string) error {
+	link := s.baseURL + "/auth/verify?token=" + url.QueryEscape(s.verifier.Token(user.ID, address))
+	body := fmt.Sprintf("Hi %s,\n\nplease confirm your email address by opening this link:\n\n%s\n\n"+
+		"The link is valid for %d hours. If you did not create an account, you can ignore this email.\n",
+		user.Username, link, int(verificationTTL.Hours()))
+	return s.emailer.Send(ctx, address, "Verify your email address", body)
+}
+
+// VerifyEmail marks the address a verification token was issued for as verified, a pending new
+// address replaces the current one
+func (s *service) VerifyEmail(ctx context.Context, token string) error {
+	userID, address, err := s.verifier.Verify(token)
+	if err != nil {
+		return err
+	}
+
+	// Fails as well if the address was changed after the link was sent, or another account
+	// took the pending address meanwhile
+	if err := s.repo.SetEmailVerified(ctx, userID, address); err != nil {
+		if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrEmailExists) {
+			return ErrInvalidVerification
+		}
+		return err
+	}
+
+	log.Info().
+		Str("user_id", userID.String()).
+		Msg("Email address verified")
+	return nil
+}
+
+// ResendVerification sends a new verification link. Unknown and already verified
+// addresses are ignored so the response does not reveal which accounts exist.
+func (s *service) ResendVerification(ctx context.Context, address string) error {
+	user, err := s.repo.GetByEmail(ctx, address)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified || !user.IsActive {
+		return nil
+	}
+	return s.sendVerification(ctx, user, user.Email)
+}
+
+// VerificationRequired reports whether users have to verify their email before signing in
+func (s *service) VerificationRequired() bool {
+	return s.requireVerified
+}
+
 func (s *service) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
 	return s.repo.GetByID(ctx, id)
 }
@@ -69,18 +184,49 @@ func (s *service) GetByUsername(ctx context.Context, username string) (*models.U
 	return s.repo.GetByUsername(ctx, username)
 }
 
-func (s *service) ValidateCredentials(ctx context.Context, username, password string) (*models.User, error) {
+// ValidateCredentials checks a login attempt. After too many failures from the client IP
+// the username is locked for a while and a *LockedError is returned, even for the correct password.
+func (s *service) ValidateCredentials(ctx context.Context, username, password, clientIP string) (*models.User, error) {
+	key := strings.ToLower(username) + "|" + clientIP
+	if retryAfter := s.lockout.Locked(key); retryAfter > 0 {
+		return nil, &LockedError{RetryAfter: retryAfter}
+	}
+
 	user, err := s.repo.GetByUsername(ctx, username)
-	if err != nil {
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
 		return nil, err
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+	// Unknown usernames count as failed attempts as well
+	var ok, rehash bool
+	if user != nil {
+		ok, rehash = s.checkPassword(user, password)
+	}
+	if !ok {
 		log.Info().
 			Str("username", username).
+			Str("ip", clientIP).
 			Msg("Failed login attempt")
+		if lockedFor := s.lockout.Fail(key); lockedFor > 0 {
+			log.Warn().
+				Str("username", username).
+				Str("ip", clientIP).
+				Dur("duration", lockedFor).
+				Msg("Login locked after too many failed attempts")
+			return nil, &LockedError{RetryAfter: lockedFor}
+		}
 		return nil, ErrInvalidCredentials
 	}
+	s.lockout.Reset(key)
+
+	if rehash {
+		s.upgradePasswordHash(ctx, user, password)
+	}
+
+	// Checked after the password so the response does not reveal unverified accounts
+	if s.requireVerified && !user.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
 
 	log.Info().
 		Str("user_id", user.ID.String()).
@@ -89,6 +235,41 @@ func (s *service) ValidateCredentials(ctx context.Context, username, password st
 	return user, nil
 }
 
+// checkPassword verifies the password of the user and reports whether their hash is outdated
+func (s *service) checkPassword(user *models.User, password string) (ok, rehash bool) {
+	ok, rehash, err := s.hasher.Verify(user.PasswordHash, password)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("user_id", user.ID.String()).
+			Msg("Failed to verify password hash")
+		return false, false
+	}
+	return ok, rehash
+}
+
+// upgradePasswordHash replaces the stored hash with one of the configured scheme and cost.
+// The login succeeds either way, the upgrade is retried on the next login.
+func (s *service) upgradePasswordHash(ctx context.Context, user *models.User, password string) {
+	hash, err := s.hasher.Hash(password)
+	if err == nil {
+		err = s.repo.UpdatePasswordHash(ctx, user.ID, hash)
+	}
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("user_id", user.ID.String()).
+			Msg("Failed to upgrade password hash")
+		return
+	}
+
+	user.PasswordHash = hash
+	log.Info().
+		Str("user_id", user.ID.String()).
+		Str("scheme", s.hasher.scheme).
+		Msg("Password hash upgraded")
+}
+
 func (s *service) Delete(ctx context.Context, id uuid.UUID) error {
 	if err := s.repo.Delete(ctx, id); err != nil {
 		log.Error().
@@ -103,3 +284,104 @@ func (s *service) Delete(ctx context.Context, id uuid.UUID) error {
 		Msg("User deleted")
 	return nil
 }
+
+// SetForceDownload changes the account default for serving the user's files as attachments
+func (s *service) SetForceDownload(ctx context.Context, id uuid.UUID, enabled bool) error {
+	if err := s.repo.UpdateForceDownload(ctx, id, enabled); err != nil {
+		log.Error().
+			Err(err).
+			Str("user_id", id.String()).
+			Msg("Failed to update download setting")
+		return err
+	}
+
+	log.Info().
+		Str("user_id", id.String()).
+		Bool("force_download", enabled).
+		Msg("Download setting updated")
+	return nil
+}
+
+// Update changes the email and username of a user, missing and empty fields are kept. A new
+// email address is only pending until the verification link sent to it is opened, the current
+// address stays in use meanwhile. Usernames of ADMIN_USERS can't be taken.
+func (s *service) Update(ctx context.Context, id uuid.UUID, req *UpdateProfileRequest) (*models.User, error) {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	emailChanged := req.Email != nil && *req.Email != "" && *req.Email != user.Email
+	usernameChanged := req.Username != nil && *req.Username != "" && *req.Username != user.Username
+	if !emailChanged && !usernameChanged {
+		return user, nil
+	}
+	if emailChanged {
+		user.PendingEmail = req.Email
+	}
+	if usernameChanged {
+		// A different case of the own name is still the same account
+		if s.isAdminName(*req.Username) && !strings.EqualFold(*req.Username, user.Username) {
+			return nil, ErrUsernameExists
+		}
+		user.Username = *req.Username
+	}
+
+	if err := s.repo.Update(ctx, user); err != nil {
+		if !errors.Is(err, ErrEmailExists) && !errors.Is(err, ErrUsernameExists) {
+			log.Error().
+				Err(err).
+				Str("user_id", id.String()).
+				Msg("Failed to update profile")
+		}
+		return nil, err
+	}
+
+	log.Info().
+		Str("user_id", id.String()).
+		Bool("email_changed", emailChanged).
+		Bool("username_changed", usernameChanged).
+		Msg("Profile updated")
+
+	if emailChanged {
+		if err := s.sendVerification(ctx, user, *user.PendingEmail); err != nil {
+			log.Error().
+				Err(err).
+				Str("user_id", id.String()).
+				Msg("Failed to send verification email")
+		}
+	}
+	return user, nil
+}
+
+// VerifyPassword checks the password of an already authenticated user
+func (s *service) VerifyPassword(ctx context.Context, id uuid.UUID, password string) error {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if ok, _ := s.checkPassword(user, password); !ok {
+		log.Info().
+			Str("user_id", id.String()).
+			Msg("Failed password confirmation")
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// DeleteAccount permanently removes a user together with their tokens, URLs and file records
+func (s *service) DeleteAccount(ctx context.Context, id uuid.UUID) error {
+	if err := s.repo.HardDelete(ctx, id); err != nil {
+		log.Error().
+			Err(err).
+			Str("user_id", id.String()).
+			Msg("Failed to delete user account")
+		return err
+	}
+
+	log.Info().
+		Str("user_id", id.String()).
+		Msg("User account deleted")
+	return nil
+}
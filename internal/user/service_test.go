@@ -0,0 +1,106 @@
+package user
+
+import (
+	"context"
+	"testing"
+	"volaticus-go/internal/common/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// profileRepository holds one user and rejects a username taken by someone else
+type profileRepository struct {
+	Repository
+	user    models.User
+	taken   string
+	updates int
+}
+
+func (r *profileRepository) GetByID(context.Context, uuid.UUID) (*models.User, error) {
+	user := r.user
+	return &user, nil
+}
+
+func (r *profileRepository) Update(_ context.Context, user *models.User) error {
+	if user.Username == r.taken {
+		return ErrUsernameExists
+	}
+	r.updates++
+	r.user = *user
+	return nil
+}
+
+// sentEmails records the recipients of all emails
+type sentEmails []string
+
+func (s *sentEmails) Send(_ context.Context, to, _, _ string) error {
+	*s = append(*s, to)
+	return nil
+}
+
+func TestUpdateProfile(t *testing.T) {
+	newService := func() (*service, *profileRepository, *sentEmails) {
+		repo := &profileRepository{
+			user:  models.User{ID: uuid.New(), Email: "old@example.com", Username: "alice", EmailVerified: true},
+			taken: "bob",
+		}
+		emails := &sentEmails{}
+		return &service{repo: repo, emailer: emails, verifier: NewVerifier("secret")}, repo, emails
+	}
+	ptr := func(s string) *string { return &s }
+
+	t.Run("username only", func(t *testing.T) {
+		s, repo, emails := newService()
+		user, err := s.Update(context.Background(), repo.user.ID, &UpdateProfileRequest{Username: ptr("alicia"), Email: ptr("")})
+		require.NoError(t, err)
+		assert.Equal(t, "alicia", user.Username)
+		assert.Equal(t, "old@example.com", user.Email)
+		assert.True(t, user.EmailVerified)
+		assert.Empty(t, *emails)
+	})
+
+	t.Run("new email is pending until verified", func(t *testing.T) {
+		s, repo, emails := newService()
+		user, err := s.Update(context.Background(), repo.user.ID, &UpdateProfileRequest{Email: ptr("new@example.com")})
+		require.NoError(t, err)
+		// The old address stays verified, signing in keeps working before the mail arrives
+		assert.Equal(t, "old@example.com", user.Email)
+		assert.True(t, user.EmailVerified)
+		if assert.NotNil(t, user.PendingEmail) {
+			assert.Equal(t, "new@example.com", *user.PendingEmail)
+		}
+		assert.Equal(t, "alice", user.Username)
+		assert.Equal(t, sentEmails{"new@example.com"}, *emails)
+	})
+
+	t.Run("nothing changed", func(t *testing.T) {
+		s, repo, _ := newService()
+		_, err := s.Update(context.Background(), repo.user.ID, &UpdateProfileRequest{Username: ptr("alice")})
+		require.NoError(t, err)
+		assert.Zero(t, repo.updates)
+	})
+
+	t.Run("taken username", func(t *testing.T) {
+		s, repo, _ := newService()
+		_, err := s.Update(context.Background(), repo.user.ID, &UpdateProfileRequest{Username: ptr("bob")})
+		assert.ErrorIs(t, err, ErrUsernameExists)
+	})
+
+	t.Run("admin username", func(t *testing.T) {
+		s, repo, _ := newService()
+		s.adminNames = []string{"root"}
+		_, err := s.Update(context.Background(), repo.user.ID, &UpdateProfileRequest{Username: ptr("Root")})
+		assert.ErrorIs(t, err, ErrUsernameExists)
+		assert.Zero(t, repo.updates)
+	})
+}
+
+func TestRegisterAdminName(t *testing.T) {
+	s := &service{adminNames: adminNames([]string{uuid.NewString(), "admin"})}
+	for _, name := range []string{"admin", "ADMIN", "Admin"} {
+		_, err := s.Register(context.Background(), &CreateUserRequest{Username: name, Password: "password"})
+		assert.ErrorIs(t, err, ErrUsernameExists, "registering %q", name)
+	}
+}
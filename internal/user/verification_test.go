@@ -0,0 +1,50 @@
+package user
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifierRoundTrip(t *testing.T) {
+	v := NewVerifier("secret")
+	userID := uuid.New()
+
+	gotID, gotEmail, err := v.Verify(v.Token(userID, "odd:address@example.com"))
+	assert.NoError(t, err)
+	assert.Equal(t, userID, gotID)
+	assert.Equal(t, "odd:address@example.com", gotEmail)
+}
+
+func TestVerifierExpired(t *testing.T) {
+	v := NewVerifier("secret")
+	token := v.Token(uuid.New(), "user@example.com")
+
+	v.now = func() time.Time { return time.Now().Add(verificationTTL + time.Minute) }
+	_, _, err := v.Verify(token)
+	assert.ErrorIs(t, err, ErrVerificationExpired)
+}
+
+func TestVerifierTampered(t *testing.T) {
+	v := NewVerifier("secret")
+	token := v.Token(uuid.New(), "user@example.com")
+
+	// Signed with a different secret
+	_, _, err := NewVerifier("other").Verify(token)
+	assert.ErrorIs(t, err, ErrInvalidVerification)
+
+	// Payload swapped for another address
+	forged := v.Token(uuid.New(), "attacker@example.com")
+	payload, _, _ := strings.Cut(forged, ".")
+	_, mac, _ := strings.Cut(token, ".")
+	_, _, err = v.Verify(payload + "." + mac)
+	assert.ErrorIs(t, err, ErrInvalidVerification)
+
+	for _, token := range []string{"", "nodot", "!!.!!"} {
+		_, _, err = v.Verify(token)
+		assert.ErrorIs(t, err, ErrInvalidVerification)
+	}
+}